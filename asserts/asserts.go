@@ -80,6 +80,7 @@ var (
 	SystemUserType      = &AssertionType{"system-user", []string{"brand-id", "email"}, assembleSystemUser, 0}
 	ValidationType      = &AssertionType{"validation", []string{"series", "snap-id", "approved-snap-id", "approved-snap-revision"}, assembleValidation, 0}
 	StoreType           = &AssertionType{"store", []string{"store"}, assembleStore, 0}
+	ValidationSetType   = &AssertionType{"validation-set", []string{"series", "account-id", "name", "sequence"}, assembleValidationSet, 0}
 
 // ...
 )
@@ -105,6 +106,7 @@ var typeRegistry = map[string]*AssertionType{
 	ValidationType.Name:      ValidationType,
 	RepairType.Name:          RepairType,
 	StoreType.Name:           StoreType,
+	ValidationSetType.Name:   ValidationSetType,
 	// no authority
 	DeviceSessionRequestType.Name: DeviceSessionRequestType,
 	SerialRequestType.Name:        SerialRequestType,
@@ -0,0 +1,253 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package asserts
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/snapcore/snapd/snap/naming"
+)
+
+// Presence represents a presence constraint of a snap in a validation set.
+type Presence string
+
+const (
+	// PresenceRequired means the snap must be installed.
+	PresenceRequired Presence = "required"
+	// PresenceOptional means the snap may or may not be installed.
+	PresenceOptional Presence = "optional"
+	// PresenceInvalid means the snap must not be installed.
+	PresenceInvalid Presence = "invalid"
+)
+
+var validPresences = []Presence{PresenceRequired, PresenceOptional, PresenceInvalid}
+
+// ValidationSetSnap holds the details about a snap constrained by a
+// validation-set assertion.
+type ValidationSetSnap struct {
+	Name   string
+	SnapID string
+	// Presence is one of: required|optional|invalid, default is required
+	Presence Presence
+	// Revision is the revision the snap must be at if installed, 0
+	// if any revision is fine
+	Revision int
+}
+
+// SnapName implements naming.SnapRef.
+func (s *ValidationSetSnap) SnapName() string {
+	return s.Name
+}
+
+// ID implements naming.SnapRef.
+func (s *ValidationSetSnap) ID() string {
+	return s.SnapID
+}
+
+// ValidationSet holds a validation-set assertion, which is a
+// statement by an account about a set of snaps that must (or must
+// not) be installed on a system, possibly at specific revisions.
+// Validation sets of an account with the same name form a sequence,
+// with later sequence points superseding the earlier ones.
+type ValidationSet struct {
+	assertionBase
+
+	seq       int
+	snaps     []*ValidationSetSnap
+	timestamp time.Time
+}
+
+// Series returns the series for which the validation set is meant.
+func (vs *ValidationSet) Series() string {
+	return vs.HeaderString("series")
+}
+
+// AccountID returns the identifier of the account that issued the
+// validation set.
+func (vs *ValidationSet) AccountID() string {
+	return vs.HeaderString("account-id")
+}
+
+// Name returns the name of the validation set, unique within the
+// issuing account.
+func (vs *ValidationSet) Name() string {
+	return vs.HeaderString("name")
+}
+
+// Sequence returns the sequence point of this validation set.
+func (vs *ValidationSet) Sequence() int {
+	return vs.seq
+}
+
+// SequenceKey returns the primary key of the validation set without
+// the sequence, that is the key shared by all the points of the
+// sequence.
+func (vs *ValidationSet) SequenceKey() []string {
+	return []string{vs.Series(), vs.AccountID(), vs.Name()}
+}
+
+// Snaps returns the snaps constrained by the validation set.
+func (vs *ValidationSet) Snaps() []*ValidationSetSnap {
+	return vs.snaps
+}
+
+// Timestamp returns the time when the validation set was issued.
+func (vs *ValidationSet) Timestamp() time.Time {
+	return vs.timestamp
+}
+
+var validValidationSetName = regexp.MustCompile("^[a-z0-9](?:-?[a-z0-9])*$")
+
+func checkValidationSetSnap(snap map[string]interface{}) (*ValidationSetSnap, error) {
+	name, err := checkNotEmptyStringWhat(snap, "name", "of snap")
+	if err != nil {
+		return nil, err
+	}
+	if err := naming.ValidateSnap(name); err != nil {
+		return nil, fmt.Errorf("invalid snap name %q", name)
+	}
+
+	what := fmt.Sprintf("of snap %q", name)
+
+	snapID, err := checkStringMatchesWhat(snap, "id", what, validSnapID)
+	if err != nil {
+		return nil, err
+	}
+
+	presence, err := checkOptionalStringWhat(snap, "presence", what)
+	if err != nil {
+		return nil, err
+	}
+	if presence == "" {
+		presence = string(PresenceRequired)
+	}
+	valid := false
+	for _, p := range validPresences {
+		if Presence(presence) == p {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf("presence of snap %q must be one of required|optional|invalid", name)
+	}
+
+	revStr, err := checkOptionalStringWhat(snap, "revision", what)
+	if err != nil {
+		return nil, err
+	}
+	revision := 0
+	if revStr != "" {
+		revision, err = strconv.Atoi(revStr)
+		if err != nil || revision < 1 {
+			return nil, fmt.Errorf("%q %s must be a positive integer: %s", "revision", what, revStr)
+		}
+		if Presence(presence) == PresenceInvalid {
+			return nil, fmt.Errorf("cannot specify revision of snap %q at the same time as stating its presence is invalid", name)
+		}
+	}
+
+	return &ValidationSetSnap{
+		Name:     name,
+		SnapID:   snapID,
+		Presence: Presence(presence),
+		Revision: revision,
+	}, nil
+}
+
+func checkValidationSetSnaps(snapList interface{}) ([]*ValidationSetSnap, error) {
+	const wrongHeaderType = `"snaps" header must be a list of maps`
+
+	entries, ok := snapList.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf(wrongHeaderType)
+	}
+
+	seen := make(map[string]bool, len(entries))
+	seenIDs := make(map[string]string, len(entries))
+	snaps := make([]*ValidationSetSnap, 0, len(entries))
+	for _, entry := range entries {
+		snap, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf(wrongHeaderType)
+		}
+		valSetSnap, err := checkValidationSetSnap(snap)
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[valSetSnap.Name] {
+			return nil, fmt.Errorf("cannot list the same snap %q multiple times", valSetSnap.Name)
+		}
+		if underName := seenIDs[valSetSnap.SnapID]; underName != "" {
+			return nil, fmt.Errorf("cannot specify the same snap id %q multiple times, specified for snaps %q and %q", valSetSnap.SnapID, underName, valSetSnap.Name)
+		}
+		seen[valSetSnap.Name] = true
+		seenIDs[valSetSnap.SnapID] = valSetSnap.Name
+
+		snaps = append(snaps, valSetSnap)
+	}
+
+	return snaps, nil
+}
+
+func assembleValidationSet(assert assertionBase) (Assertion, error) {
+	authorityID := assert.AuthorityID()
+	accountID := assert.HeaderString("account-id")
+	if accountID != authorityID {
+		return nil, fmt.Errorf("authority-id and account-id must match, validation-set assertions are expected to be signed by the issuer account: %q != %q", authorityID, accountID)
+	}
+
+	if _, err := checkStringMatches(assert.headers, "name", validValidationSetName); err != nil {
+		return nil, err
+	}
+
+	seq, err := checkInt(assert.headers, "sequence")
+	if err != nil {
+		return nil, err
+	}
+	if seq < 1 {
+		return nil, fmt.Errorf(`"sequence" header must be >=1: %d`, seq)
+	}
+
+	snapList, ok := assert.headers["snaps"]
+	if !ok {
+		return nil, fmt.Errorf(`"snaps" header is mandatory`)
+	}
+	snaps, err := checkValidationSetSnaps(snapList)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp, err := checkRFC3339Date(assert.headers, "timestamp")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ValidationSet{
+		assertionBase: assert,
+		seq:           seq,
+		snaps:         snaps,
+		timestamp:     timestamp,
+	}, nil
+}
@@ -0,0 +1,147 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package asserts_test
+
+import (
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+)
+
+type validationSetSuite struct {
+	ts     time.Time
+	tsLine string
+}
+
+var _ = Suite(&validationSetSuite{})
+
+func (vss *validationSetSuite) SetUpSuite(c *C) {
+	vss.ts = time.Now().Truncate(time.Second).UTC()
+	vss.tsLine = "timestamp: " + vss.ts.Format(time.RFC3339) + "\n"
+}
+
+const (
+	validationSetExample = `type: validation-set
+authority-id: brand-id1
+series: 16
+account-id: brand-id1
+name: baz-3000-good
+sequence: 2
+snaps:
+  -
+    name: baz-linux
+    id: bazlinuxidididididididididididid
+    presence: optional
+    revision: 99
+  -
+    name: foo-linux
+    id: foolinuxidididididididididididid
+  -
+    name: bar-linux
+    id: barlinuxidididididididididididid
+    presence: invalid
+TSLINE
+body-length: 0
+sign-key-sha3-384: Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij
+
+AXNpZw==`
+
+	validationSetErrPrefix = "assertion validation-set: "
+)
+
+func (vss *validationSetSuite) TestDecodeOK(c *C) {
+	encoded := strings.Replace(validationSetExample, "TSLINE\n", vss.tsLine, 1)
+
+	a, err := asserts.Decode([]byte(encoded))
+	c.Assert(err, IsNil)
+	c.Check(a.Type(), Equals, asserts.ValidationSetType)
+	valset := a.(*asserts.ValidationSet)
+	c.Check(valset.AuthorityID(), Equals, "brand-id1")
+	c.Check(valset.Timestamp(), Equals, vss.ts)
+	c.Check(valset.Series(), Equals, "16")
+	c.Check(valset.AccountID(), Equals, "brand-id1")
+	c.Check(valset.Name(), Equals, "baz-3000-good")
+	c.Check(valset.Sequence(), Equals, 2)
+	c.Check(valset.SequenceKey(), DeepEquals, []string{"16", "brand-id1", "baz-3000-good"})
+	c.Check(valset.Ref().PrimaryKey, DeepEquals, []string{"16", "brand-id1", "baz-3000-good", "2"})
+
+	snaps := valset.Snaps()
+	c.Assert(snaps, DeepEquals, []*asserts.ValidationSetSnap{
+		{
+			Name:     "baz-linux",
+			SnapID:   "bazlinuxidididididididididididid",
+			Presence: asserts.PresenceOptional,
+			Revision: 99,
+		}, {
+			Name:     "foo-linux",
+			SnapID:   "foolinuxidididididididididididid",
+			Presence: asserts.PresenceRequired,
+		}, {
+			Name:     "bar-linux",
+			SnapID:   "barlinuxidididididididididididid",
+			Presence: asserts.PresenceInvalid,
+		},
+	})
+	c.Check(snaps[0].SnapName(), Equals, "baz-linux")
+	c.Check(snaps[0].ID(), Equals, "bazlinuxidididididididididididid")
+}
+
+func (vss *validationSetSuite) TestDecodeInvalid(c *C) {
+	encoded := strings.Replace(validationSetExample, "TSLINE\n", vss.tsLine, 1)
+
+	snapsStanza := encoded[strings.Index(encoded, "snaps:"):strings.Index(encoded, "timestamp:")]
+
+	invalidTests := []struct{ original, invalid, expectedErr string }{
+		{"series: 16\n", "", `"series" header is mandatory`},
+		{"account-id: brand-id1\n", "", `"account-id" header is mandatory`},
+		{"account-id: brand-id1\n", "account-id: other\n", `authority-id and account-id must match, validation-set assertions are expected to be signed by the issuer account: "brand-id1" != "other"`},
+		{"name: baz-3000-good\n", "", `"name" header is mandatory`},
+		{"name: baz-3000-good\n", "name: \n", `"name" header should not be empty`},
+		{"name: baz-3000-good\n", "name: baz/3000\n", `"name" primary key header cannot contain '/'`},
+		{"name: baz-3000-good\n", "name: baz+3000\n", `"name" header contains invalid characters: "baz\+3000"`},
+		{"sequence: 2\n", "", `"sequence" header is mandatory`},
+		{"sequence: 2\n", "sequence: one\n", `"sequence" header is not an integer: one`},
+		{"sequence: 2\n", "sequence: 0\n", `"sequence" header must be >=1: 0`},
+		{snapsStanza, "", `"snaps" header is mandatory`},
+		{snapsStanza, "snaps: snap\n", `"snaps" header must be a list of maps`},
+		{snapsStanza, "snaps:\n  - snap\n", `"snaps" header must be a list of maps`},
+		{"name: baz-linux\n", "other: 1\n", `"name" of snap is mandatory`},
+		{"name: baz-linux\n", "name: linux_2\n", `invalid snap name "linux_2"`},
+		{"name: foo-linux\n", "name: baz-linux\n", `cannot list the same snap "baz-linux" multiple times`},
+		{"id: bazlinuxidididididididididididid\n", "id: 2\n", `"id" of snap "baz-linux" contains invalid characters: "2"`},
+		{"id: foolinuxidididididididididididid\n", "id: bazlinuxidididididididididididid\n", `cannot specify the same snap id "bazlinuxidididididididididididid" multiple times, specified for snaps "baz-linux" and "foo-linux"`},
+		{"presence: optional\n", "presence:\n      - opt\n", `"presence" of snap "baz-linux" must be a string`},
+		{"presence: optional\n", "presence: no\n", `presence of snap "baz-linux" must be one of required\|optional\|invalid`},
+		{"revision: 99\n", "revision: 0\n", `"revision" of snap "baz-linux" must be a positive integer: 0`},
+		{"revision: 99\n", "revision: x\n", `"revision" of snap "baz-linux" must be a positive integer: x`},
+		{"presence: invalid\n", "presence: invalid\n    revision: 1\n", `cannot specify revision of snap "bar-linux" at the same time as stating its presence is invalid`},
+		{vss.tsLine, "", `"timestamp" header is mandatory`},
+		{vss.tsLine, "timestamp: 12:30\n", `"timestamp" header is not a RFC3339 date: .*`},
+	}
+
+	for _, test := range invalidTests {
+		invalid := strings.Replace(encoded, test.original, test.invalid, 1)
+		_, err := asserts.Decode([]byte(invalid))
+		c.Check(err, ErrorMatches, validationSetErrPrefix+test.expectedErr)
+	}
+}
@@ -246,11 +246,30 @@ func nameAndRevnoFromSnap(sn string) (*NameAndRevision, error) {
 //   means snapd did not start successfully. In this case the bootloader
 //   will set snap_mode="" and the system will boot with the known good
 //   values from snap_{core,kernel}
+//
+// Bootloaders supporting a trial boot of new boot assets, such as bootloader
+// binaries updated with the gadget, go through similar states, and the new
+// boot assets are promoted, or removed if the bootloader fell back to the old
+// ones, the same way.
 func MarkBootSuccessful() error {
 	bl, err := bootloader.Find("", nil)
 	if err != nil {
 		return fmt.Errorf("cannot mark boot successful: %s", err)
 	}
+	// the boot snaps are marked first, so that failing to handle the
+	// boot assets does not roll back a kernel or core that booted fine
+	if err := markBootSnapsSuccessful(bl); err != nil {
+		return err
+	}
+	if tbl, ok := bl.(bootloader.TrialBootAssetsBootloader); ok {
+		if err := tbl.MarkBootAssetsSuccessful(); err != nil {
+			return fmt.Errorf("cannot mark boot assets successful: %v", err)
+		}
+	}
+	return nil
+}
+
+func markBootSnapsSuccessful(bl bootloader.Bootloader) error {
 	m, err := bl.GetBootVars("snap_mode", "snap_try_core", "snap_try_kernel")
 	if err != nil {
 		return err
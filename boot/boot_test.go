@@ -365,6 +365,38 @@ func (s *bootSetSuite) TestMarkBootSuccessfulKKernelUpdate(c *C) {
 	})
 }
 
+func (s *bootSetSuite) TestMarkBootSuccessfulBootAssets(c *C) {
+	tbl := s.bootloader.WithTrialBootAssets()
+	bootloader.Force(tbl)
+
+	s.bootloader.BootVars["snap_mode"] = "trying"
+	s.bootloader.BootVars["snap_try_kernel"] = "k2"
+	err := boot.MarkBootSuccessful()
+	c.Assert(err, IsNil)
+	c.Check(tbl.MarkBootAssetsSuccessfulCalls, Equals, 1)
+	c.Check(s.bootloader.BootVars["snap_kernel"], Equals, "k2")
+
+	// boot assets are handled even when no snap was tried
+	err = boot.MarkBootSuccessful()
+	c.Assert(err, IsNil)
+	c.Check(tbl.MarkBootAssetsSuccessfulCalls, Equals, 2)
+}
+
+func (s *bootSetSuite) TestMarkBootSuccessfulBootAssetsError(c *C) {
+	tbl := s.bootloader.WithTrialBootAssets()
+	tbl.MarkBootAssetsSuccessfulErr = errors.New("boom")
+	bootloader.Force(tbl)
+
+	s.bootloader.BootVars["snap_mode"] = "trying"
+	s.bootloader.BootVars["snap_try_kernel"] = "k2"
+	err := boot.MarkBootSuccessful()
+	c.Assert(err, ErrorMatches, "cannot mark boot assets successful: boom")
+	// the kernel that booted fine is marked successful regardless
+	c.Check(s.bootloader.BootVars["snap_mode"], Equals, "")
+	c.Check(s.bootloader.BootVars["snap_try_kernel"], Equals, "")
+	c.Check(s.bootloader.BootVars["snap_kernel"], Equals, "k2")
+}
+
 func (s *bootSetSuite) makeSnap(c *C, name, yaml string, revno snap.Revision) (fn string, info *snap.Info) {
 	si := &snap.SideInfo{
 		RealName: name,
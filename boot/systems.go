@@ -0,0 +1,89 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package boot
+
+import (
+	"fmt"
+
+	"github.com/snapcore/snapd/bootloader"
+)
+
+const (
+	// ModeRun is the mode of a regular, fully installed system.
+	ModeRun = "run"
+	// ModeInstall installs the system from a recovery system.
+	ModeInstall = "install"
+	// ModeRecover boots into a recovery system for repairing the
+	// installed system.
+	ModeRecover = "recover"
+)
+
+var validModes = []string{ModeRun, ModeInstall, ModeRecover}
+
+// ValidateMode returns an error if the given mode is not one of
+// install, recover or run.
+func ValidateMode(mode string) error {
+	for _, m := range validModes {
+		if mode == m {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid system mode %q", mode)
+}
+
+// SetRecoveryBootSystemAndMode configures the bootloader to boot into
+// the given recovery system in the given mode on the next boot.
+func SetRecoveryBootSystemAndMode(systemLabel, mode string) error {
+	if systemLabel == "" {
+		return fmt.Errorf("internal error: system label is unset")
+	}
+	if err := ValidateMode(mode); err != nil {
+		return err
+	}
+
+	bl, err := bootloader.Find("", nil)
+	if err != nil {
+		return fmt.Errorf("cannot set recovery system: %v", err)
+	}
+	m := map[string]string{
+		"snapd_recovery_system": systemLabel,
+		"snapd_recovery_mode":   mode,
+	}
+	return bl.SetBootVars(m)
+}
+
+// RecoveryBootSystemAndMode returns the recovery system and mode the
+// system was booted with, or set to boot with next. The mode defaults
+// to run if unset.
+func RecoveryBootSystemAndMode() (systemLabel, mode string, err error) {
+	bl, err := bootloader.Find("", nil)
+	if err != nil {
+		return "", "", fmt.Errorf("cannot get recovery system: %v", err)
+	}
+	m, err := bl.GetBootVars("snapd_recovery_system", "snapd_recovery_mode")
+	if err != nil {
+		return "", "", err
+	}
+	mode = m["snapd_recovery_mode"]
+	if mode == "" {
+		mode = ModeRun
+	}
+	return m["snapd_recovery_system"], mode, nil
+}
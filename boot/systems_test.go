@@ -0,0 +1,88 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package boot_test
+
+import (
+	"errors"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/bootloader"
+	"github.com/snapcore/snapd/bootloader/bootloadertest"
+)
+
+type systemsSuite struct {
+	baseBootSetSuite
+
+	bootloader *bootloadertest.MockBootloader
+}
+
+var _ = Suite(&systemsSuite{})
+
+func (s *systemsSuite) SetUpTest(c *C) {
+	s.baseBootSetSuite.SetUpTest(c)
+
+	s.bootloader = bootloadertest.Mock("mock", c.MkDir())
+	bootloader.Force(s.bootloader)
+	s.AddCleanup(func() { bootloader.Force(nil) })
+}
+
+func (s *systemsSuite) TestValidateMode(c *C) {
+	for _, mode := range []string{"run", "install", "recover"} {
+		c.Check(boot.ValidateMode(mode), IsNil)
+	}
+	for _, mode := range []string{"", "Run", "reinstall"} {
+		c.Check(boot.ValidateMode(mode), ErrorMatches, `invalid system mode ".*"`)
+	}
+}
+
+func (s *systemsSuite) TestSetRecoveryBootSystemAndMode(c *C) {
+	err := boot.SetRecoveryBootSystemAndMode("20191119", "install")
+	c.Assert(err, IsNil)
+	c.Check(s.bootloader.BootVars, DeepEquals, map[string]string{
+		"snapd_recovery_system": "20191119",
+		"snapd_recovery_mode":   "install",
+	})
+
+	label, mode, err := boot.RecoveryBootSystemAndMode()
+	c.Assert(err, IsNil)
+	c.Check(label, Equals, "20191119")
+	c.Check(mode, Equals, "install")
+}
+
+func (s *systemsSuite) TestSetRecoveryBootSystemAndModeErrors(c *C) {
+	err := boot.SetRecoveryBootSystemAndMode("", "install")
+	c.Check(err, ErrorMatches, "internal error: system label is unset")
+	err = boot.SetRecoveryBootSystemAndMode("20191119", "reboot")
+	c.Check(err, ErrorMatches, `invalid system mode "reboot"`)
+	c.Check(s.bootloader.BootVars, HasLen, 0)
+
+	s.bootloader.SetErr = errors.New("no space left")
+	err = boot.SetRecoveryBootSystemAndMode("20191119", "recover")
+	c.Check(err, ErrorMatches, "no space left")
+}
+
+func (s *systemsSuite) TestRecoveryBootSystemAndModeDefaultsToRun(c *C) {
+	label, mode, err := boot.RecoveryBootSystemAndMode()
+	c.Assert(err, IsNil)
+	c.Check(label, Equals, "")
+	c.Check(mode, Equals, "run")
+}
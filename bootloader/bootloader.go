@@ -57,6 +57,35 @@ type Bootloader interface {
 	RemoveKernelAssets(s snap.PlaceInfo) error
 }
 
+// TrialBootAssetsDir is the name of the directory, next to the current boot
+// assets such as bootloader binaries, where new versions of the boot assets
+// are staged for a trial boot.
+const TrialBootAssetsDir = "try"
+
+// TrialBootAssetPath returns the path where the new version of the boot
+// asset at the given path is staged for a trial boot.
+func TrialBootAssetPath(asset string) string {
+	return filepath.Join(filepath.Dir(asset), TrialBootAssetsDir, filepath.Base(asset))
+}
+
+// TrialBootAssetsBootloader is implemented by bootloaders that can boot new
+// boot assets in trial mode, and fall back to the current ones should the
+// trial boot fail.
+type TrialBootAssetsBootloader interface {
+	Bootloader
+
+	// TryBootAssets schedules a trial boot of the given boot assets. The
+	// new assets must have been staged at TrialBootAssetPath of the
+	// current ones. Asset paths are relative to the root of the boot
+	// partition, the first asset is the one booted first.
+	TryBootAssets(assets []string) error
+
+	// MarkBootAssetsSuccessful promotes the staged boot assets after a
+	// successful trial boot, or removes them if the bootloader fell back
+	// to the current ones.
+	MarkBootAssetsSuccessful() error
+}
+
 type installableBootloader interface {
 	Bootloader
 	setRootDir(string)
@@ -97,3 +97,35 @@ func (b *MockBootloader) SetBootKernel(kernel string) {
 func (b *MockBootloader) SetBootBase(base string) {
 	b.SetBootVars(map[string]string{"snap_core": base})
 }
+
+// MockTrialBootAssetsBootloader mocks a bootloader implementing the
+// bootloader.TrialBootAssetsBootloader interface.
+type MockTrialBootAssetsBootloader struct {
+	*MockBootloader
+
+	TryBootAssetsErr            error
+	MarkBootAssetsSuccessfulErr error
+
+	TryBootAssetsCalls            [][]string
+	MarkBootAssetsSuccessfulCalls int
+}
+
+// ensure MockTrialBootAssetsBootloader implements the
+// TrialBootAssetsBootloader interface
+var _ bootloader.TrialBootAssetsBootloader = (*MockTrialBootAssetsBootloader)(nil)
+
+// WithTrialBootAssets turns a MockBootloader into a
+// MockTrialBootAssetsBootloader.
+func (b *MockBootloader) WithTrialBootAssets() *MockTrialBootAssetsBootloader {
+	return &MockTrialBootAssetsBootloader{MockBootloader: b}
+}
+
+func (b *MockTrialBootAssetsBootloader) TryBootAssets(assets []string) error {
+	b.TryBootAssetsCalls = append(b.TryBootAssetsCalls, assets)
+	return b.TryBootAssetsErr
+}
+
+func (b *MockTrialBootAssetsBootloader) MarkBootAssetsSuccessful() error {
+	b.MarkBootAssetsSuccessfulCalls++
+	return b.MarkBootAssetsSuccessfulErr
+}
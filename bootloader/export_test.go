@@ -100,3 +100,11 @@ func LkRuntimeMode(b Bootloader) bool {
 	lk := b.(*lk)
 	return lk.inRuntimeMode
 }
+
+func MockBootID(f func() (string, error)) (restore func()) {
+	old := bootID
+	bootID = f
+	return func() {
+		bootID = old
+	}
+}
@@ -20,12 +20,16 @@
 package bootloader
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/snapcore/snapd/bootloader/grubenv"
+	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
 )
 
 type grub struct {
@@ -57,6 +61,15 @@ func (g *grub) dir() string {
 	return filepath.Join(g.rootdir, "/boot/grub")
 }
 
+// bootAssetsDir returns the location of the EFI system partition, which holds
+// the boot assets.
+func (g *grub) bootAssetsDir() string {
+	if g.rootdir == "" {
+		panic("internal error: unset rootdir")
+	}
+	return filepath.Join(g.rootdir, "/boot/efi")
+}
+
 func (g *grub) ConfigFile() string {
 	return filepath.Join(g.dir(), "grub.cfg")
 }
@@ -102,3 +115,145 @@ func (g *grub) ExtractKernelAssets(s snap.PlaceInfo, snapf snap.Container) error
 func (g *grub) RemoveKernelAssets(s snap.PlaceInfo) error {
 	return removeKernelAssetsFromBootDir(g.dir(), s)
 }
+
+// Trial boot of boot assets is driven by the following variables kept in
+// grubenv:
+// - snap_try_boot_assets is a space separated list of boot assets, relative to
+//   the root of the EFI system partition, with new versions staged at their
+//   TrialBootAssetPath; the first asset is the one grub chainloads
+// - snap_boot_assets_mode goes from "" -> "try" -> "trying" -> ""
+// - snap_boot_assets_boot_id is the boot ID of the system that scheduled the
+//   trial boot
+//
+// Snapd sets the mode to "try" once new assets are staged. On the next boot,
+// grub sets the mode to "trying" and chainloads the staged assets, which run
+// from the TrialBootAssetsDir. If the system comes up, snapd promotes the
+// staged assets and resets the mode to "". If grub, running from the current
+// assets, finds the mode set to "trying", the trial boot has failed, and grub
+// sets the mode to "" and boots with the current assets, leaving it to snapd
+// to remove the staged ones. The grub side of this is implemented by
+// data/grub/snap-boot-assets.cfg, which gadgets using boot assets include in
+// their grub.cfg.
+
+// bootID is mocked in tests
+var bootID = osutil.BootID
+
+// TryBootAssets schedules a trial boot of the staged boot assets.
+func (g *grub) TryBootAssets(assets []string) error {
+	env := grubenv.NewEnv(g.envFile())
+	if err := env.Load(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var staged []string
+	switch env.Get("snap_boot_assets_mode") {
+	case "trying":
+		return fmt.Errorf("cannot try new boot assets while a trial boot is in progress")
+	case "try":
+		// the trial boot has not happened yet, try all the assets at once
+		staged = strings.Fields(env.Get("snap_try_boot_assets"))
+	}
+	tryAssets := make([]string, 0, len(assets)+len(staged))
+	for _, asset := range assets {
+		if strings.ContainsAny(asset, " \t\n") {
+			return fmt.Errorf("cannot try boot asset %q: path contains whitespace", asset)
+		}
+		if !strutil.ListContains(tryAssets, asset) {
+			tryAssets = append(tryAssets, asset)
+		}
+	}
+	for _, asset := range staged {
+		if !strutil.ListContains(tryAssets, asset) {
+			tryAssets = append(tryAssets, asset)
+		}
+	}
+	id, err := bootID()
+	if err != nil {
+		return fmt.Errorf("cannot get boot ID: %v", err)
+	}
+
+	env.Set("snap_try_boot_assets", strings.Join(tryAssets, " "))
+	env.Set("snap_boot_assets_mode", "try")
+	env.Set("snap_boot_assets_boot_id", id)
+	return env.Save()
+}
+
+// MarkBootAssetsSuccessful promotes the staged boot assets after a successful
+// trial boot or removes them when grub fell back to the current assets.
+func (g *grub) MarkBootAssetsSuccessful() error {
+	env := grubenv.NewEnv(g.envFile())
+	if err := env.Load(); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	assets := strings.Fields(env.Get("snap_try_boot_assets"))
+	if len(assets) == 0 {
+		return nil
+	}
+
+	switch env.Get("snap_boot_assets_mode") {
+	case "try":
+		id, err := bootID()
+		if err != nil {
+			return fmt.Errorf("cannot get boot ID: %v", err)
+		}
+		if id == env.Get("snap_boot_assets_boot_id") {
+			// not rebooted into the new assets yet
+			return nil
+		}
+		// the system was rebooted, but grub did not attempt the
+		// trial boot, most likely its configuration does not support it
+		logger.Noticef("trial boot of boot assets did not happen, removing %s", strings.Join(assets, ", "))
+		if err := g.removeStagedBootAssets(assets); err != nil {
+			return err
+		}
+	case "trying":
+		for _, asset := range assets {
+			current := filepath.Join(g.bootAssetsDir(), asset)
+			err := os.Rename(filepath.Join(g.bootAssetsDir(), TrialBootAssetPath(asset)), current)
+			if os.IsNotExist(err) && osutil.FileExists(current) {
+				// promoted by an earlier, interrupted call
+				err = nil
+			}
+			if err != nil {
+				return fmt.Errorf("cannot promote boot asset %q: %v", asset, err)
+			}
+		}
+		g.removeTrialBootAssetsDirs(assets)
+	default:
+		logger.Noticef("trial boot of boot assets failed, removing %s", strings.Join(assets, ", "))
+		if err := g.removeStagedBootAssets(assets); err != nil {
+			return err
+		}
+	}
+
+	env.Set("snap_try_boot_assets", "")
+	env.Set("snap_boot_assets_mode", "")
+	env.Set("snap_boot_assets_boot_id", "")
+	return env.Save()
+}
+
+func (g *grub) removeStagedBootAssets(assets []string) error {
+	for _, asset := range assets {
+		staged := filepath.Join(g.bootAssetsDir(), TrialBootAssetPath(asset))
+		if err := os.Remove(staged); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot remove staged boot asset %q: %v", asset, err)
+		}
+	}
+	g.removeTrialBootAssetsDirs(assets)
+	return nil
+}
+
+// removeTrialBootAssetsDirs removes the trial boot directories of the given
+// assets, unless something else was put there.
+func (g *grub) removeTrialBootAssetsDirs(assets []string) {
+	for _, asset := range assets {
+		dir := filepath.Dir(filepath.Join(g.bootAssetsDir(), TrialBootAssetPath(asset)))
+		if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+			logger.Noticef("cannot remove trial boot directory %q: %v", dir, err)
+		}
+	}
+}
@@ -20,7 +20,10 @@
 package bootloader_test
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"os/exec"
 	"path/filepath"
 
@@ -32,12 +35,14 @@ import (
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/testutil"
 )
 
 type grubTestSuite struct {
 	baseBootenvTestSuite
 
 	bootdir string
+	bootID  string
 }
 
 var _ = Suite(&grubTestSuite{})
@@ -218,3 +223,225 @@ func (s *grubTestSuite) TestExtractKernelForceWorks(c *C) {
 	c.Assert(err, IsNil)
 	c.Check(exists, Equals, false)
 }
+
+func (s *grubTestSuite) makeBootAssets(c *C, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(s.bootdir, "efi", name)
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		c.Assert(err, IsNil)
+		err = ioutil.WriteFile(p, []byte(content), 0644)
+		c.Assert(err, IsNil)
+	}
+}
+
+func (s *grubTestSuite) trialBootloader(c *C) bootloader.TrialBootAssetsBootloader {
+	s.bootID = "boot-1"
+	s.AddCleanup(bootloader.MockBootID(func() (string, error) {
+		return s.bootID, nil
+	}))
+	g := bootloader.NewGrub(s.rootdir)
+	c.Assert(g, NotNil)
+	tg, ok := g.(bootloader.TrialBootAssetsBootloader)
+	c.Assert(ok, Equals, true)
+	return tg
+}
+
+func (s *grubTestSuite) TestTrialBootAssetPath(c *C) {
+	c.Check(bootloader.TrialBootAssetPath("EFI/boot/grubx64.efi"), Equals, "EFI/boot/try/grubx64.efi")
+	c.Check(bootloader.TrialBootAssetPath("grubx64.efi"), Equals, "try/grubx64.efi")
+}
+
+func (s *grubTestSuite) TestTryBootAssets(c *C) {
+	g := s.trialBootloader(c)
+
+	err := g.TryBootAssets([]string{"EFI/boot/grubx64.efi"})
+	c.Assert(err, IsNil)
+	m, err := g.GetBootVars("snap_boot_assets_mode", "snap_try_boot_assets", "snap_boot_assets_boot_id")
+	c.Assert(err, IsNil)
+	c.Check(m, DeepEquals, map[string]string{
+		"snap_boot_assets_mode":    "try",
+		"snap_try_boot_assets":     "EFI/boot/grubx64.efi",
+		"snap_boot_assets_boot_id": "boot-1",
+	})
+
+	// not booted yet, more assets are tried at once, the latest ones
+	// come first
+	err = g.TryBootAssets([]string{"EFI/boot/bootx64.efi"})
+	c.Assert(err, IsNil)
+	m, err = g.GetBootVars("snap_boot_assets_mode", "snap_try_boot_assets")
+	c.Assert(err, IsNil)
+	c.Check(m, DeepEquals, map[string]string{
+		"snap_boot_assets_mode": "try",
+		"snap_try_boot_assets":  "EFI/boot/bootx64.efi EFI/boot/grubx64.efi",
+	})
+}
+
+func (s *grubTestSuite) TestTryBootAssetsErrors(c *C) {
+	g := s.trialBootloader(c)
+
+	err := g.TryBootAssets([]string{"EFI/boot/grub x64.efi"})
+	c.Assert(err, ErrorMatches, `cannot try boot asset "EFI/boot/grub x64.efi": path contains whitespace`)
+
+	err = g.SetBootVars(map[string]string{"snap_boot_assets_mode": "trying"})
+	c.Assert(err, IsNil)
+	err = g.TryBootAssets([]string{"EFI/boot/grubx64.efi"})
+	c.Assert(err, ErrorMatches, "cannot try new boot assets while a trial boot is in progress")
+
+	err = g.SetBootVars(map[string]string{"snap_boot_assets_mode": ""})
+	c.Assert(err, IsNil)
+	s.AddCleanup(bootloader.MockBootID(func() (string, error) {
+		return "", errors.New("boom")
+	}))
+	err = g.TryBootAssets([]string{"EFI/boot/grubx64.efi"})
+	c.Assert(err, ErrorMatches, "cannot get boot ID: boom")
+}
+
+func (s *grubTestSuite) TestMarkBootAssetsSuccessfulPromotes(c *C) {
+	g := s.trialBootloader(c)
+	s.makeBootAssets(c, map[string]string{
+		"EFI/boot/grubx64.efi":     "old grub",
+		"EFI/boot/try/grubx64.efi": "new grub",
+		"EFI/boot/bootx64.efi":     "old shim",
+		"EFI/boot/try/bootx64.efi": "new shim",
+	})
+	err := g.TryBootAssets([]string{"EFI/boot/bootx64.efi", "EFI/boot/grubx64.efi"})
+	c.Assert(err, IsNil)
+
+	// snapd is restarted before the system reboots
+	err = g.MarkBootAssetsSuccessful()
+	c.Assert(err, IsNil)
+	c.Check(filepath.Join(s.bootdir, "efi/EFI/boot/grubx64.efi"), testutil.FileEquals, "old grub")
+	c.Check(filepath.Join(s.bootdir, "efi/EFI/boot/try/grubx64.efi"), testutil.FilePresent)
+
+	// grub booted the staged assets
+	s.bootID = "boot-2"
+	err = g.SetBootVars(map[string]string{"snap_boot_assets_mode": "trying"})
+	c.Assert(err, IsNil)
+
+	err = g.MarkBootAssetsSuccessful()
+	c.Assert(err, IsNil)
+	c.Check(filepath.Join(s.bootdir, "efi/EFI/boot/grubx64.efi"), testutil.FileEquals, "new grub")
+	c.Check(filepath.Join(s.bootdir, "efi/EFI/boot/bootx64.efi"), testutil.FileEquals, "new shim")
+	c.Check(filepath.Join(s.bootdir, "efi/EFI/boot/try"), testutil.FileAbsent)
+	m, err := g.GetBootVars("snap_boot_assets_mode", "snap_try_boot_assets", "snap_boot_assets_boot_id")
+	c.Assert(err, IsNil)
+	c.Check(m, DeepEquals, map[string]string{
+		"snap_boot_assets_mode":    "",
+		"snap_try_boot_assets":     "",
+		"snap_boot_assets_boot_id": "",
+	})
+}
+
+func (s *grubTestSuite) TestMarkBootAssetsSuccessfulResumesPromotion(c *C) {
+	g := s.trialBootloader(c)
+	// one of the assets was promoted already
+	s.makeBootAssets(c, map[string]string{
+		"EFI/boot/grubx64.efi":     "new grub",
+		"EFI/boot/bootx64.efi":     "old shim",
+		"EFI/boot/try/bootx64.efi": "new shim",
+	})
+	err := g.SetBootVars(map[string]string{
+		"snap_boot_assets_mode": "trying",
+		"snap_try_boot_assets":  "EFI/boot/bootx64.efi EFI/boot/grubx64.efi",
+	})
+	c.Assert(err, IsNil)
+
+	err = g.MarkBootAssetsSuccessful()
+	c.Assert(err, IsNil)
+	c.Check(filepath.Join(s.bootdir, "efi/EFI/boot/grubx64.efi"), testutil.FileEquals, "new grub")
+	c.Check(filepath.Join(s.bootdir, "efi/EFI/boot/bootx64.efi"), testutil.FileEquals, "new shim")
+	c.Check(filepath.Join(s.bootdir, "efi/EFI/boot/try"), testutil.FileAbsent)
+}
+
+func (s *grubTestSuite) TestMarkBootAssetsSuccessfulMissingAsset(c *C) {
+	g := s.trialBootloader(c)
+	// the assets were staged elsewhere
+	s.makeBootAssets(c, map[string]string{
+		"EFI/boot/grubx64.efi": "old grub",
+	})
+	err := g.SetBootVars(map[string]string{
+		"snap_boot_assets_mode": "trying",
+		"snap_try_boot_assets":  "EFI/other/bootx64.efi",
+	})
+	c.Assert(err, IsNil)
+
+	err = g.MarkBootAssetsSuccessful()
+	c.Assert(err, ErrorMatches, `cannot promote boot asset "EFI/other/bootx64.efi": rename .*/EFI/other/try/bootx64.efi .*: no such file or directory`)
+	// the trial boot state is kept
+	m, err := g.GetBootVars("snap_boot_assets_mode", "snap_try_boot_assets")
+	c.Assert(err, IsNil)
+	c.Check(m, DeepEquals, map[string]string{
+		"snap_boot_assets_mode": "trying",
+		"snap_try_boot_assets":  "EFI/other/bootx64.efi",
+	})
+}
+
+func (s *grubTestSuite) TestMarkBootAssetsSuccessfulFallback(c *C) {
+	g := s.trialBootloader(c)
+	s.makeBootAssets(c, map[string]string{
+		"EFI/boot/grubx64.efi":     "old grub",
+		"EFI/boot/try/grubx64.efi": "new grub",
+	})
+	// grub fell back to the current assets
+	err := g.SetBootVars(map[string]string{
+		"snap_boot_assets_mode": "",
+		"snap_try_boot_assets":  "EFI/boot/grubx64.efi",
+	})
+	c.Assert(err, IsNil)
+
+	err = g.MarkBootAssetsSuccessful()
+	c.Assert(err, IsNil)
+	c.Check(filepath.Join(s.bootdir, "efi/EFI/boot/grubx64.efi"), testutil.FileEquals, "old grub")
+	c.Check(filepath.Join(s.bootdir, "efi/EFI/boot/try"), testutil.FileAbsent)
+	m, err := g.GetBootVars("snap_boot_assets_mode", "snap_try_boot_assets")
+	c.Assert(err, IsNil)
+	c.Check(m, DeepEquals, map[string]string{
+		"snap_boot_assets_mode": "",
+		"snap_try_boot_assets":  "",
+	})
+}
+
+func (s *grubTestSuite) TestMarkBootAssetsSuccessfulStaleTry(c *C) {
+	g := s.trialBootloader(c)
+	s.makeBootAssets(c, map[string]string{
+		"EFI/boot/grubx64.efi":     "old grub",
+		"EFI/boot/try/grubx64.efi": "new grub",
+	})
+	err := g.TryBootAssets([]string{"EFI/boot/grubx64.efi"})
+	c.Assert(err, IsNil)
+
+	// the system was rebooted, but grub did not attempt the trial boot
+	s.bootID = "boot-2"
+	err = g.MarkBootAssetsSuccessful()
+	c.Assert(err, IsNil)
+	c.Check(filepath.Join(s.bootdir, "efi/EFI/boot/grubx64.efi"), testutil.FileEquals, "old grub")
+	c.Check(filepath.Join(s.bootdir, "efi/EFI/boot/try"), testutil.FileAbsent)
+	m, err := g.GetBootVars("snap_boot_assets_mode", "snap_try_boot_assets", "snap_boot_assets_boot_id")
+	c.Assert(err, IsNil)
+	c.Check(m, DeepEquals, map[string]string{
+		"snap_boot_assets_mode":    "",
+		"snap_try_boot_assets":     "",
+		"snap_boot_assets_boot_id": "",
+	})
+
+	// new assets can be tried again
+	err = g.TryBootAssets([]string{"EFI/boot/grubx64.efi"})
+	c.Assert(err, IsNil)
+}
+
+func (s *grubTestSuite) TestMarkBootAssetsSuccessfulNothingToDo(c *C) {
+	g := s.trialBootloader(c)
+
+	// no grubenv yet
+	err := g.MarkBootAssetsSuccessful()
+	c.Assert(err, IsNil)
+	c.Check(grubEnvPath(s.rootdir), testutil.FileAbsent)
+
+	err = g.SetBootVars(map[string]string{"snap_mode": "trying"})
+	c.Assert(err, IsNil)
+	err = g.MarkBootAssetsSuccessful()
+	c.Assert(err, IsNil)
+	m, err := g.GetBootVars("snap_mode")
+	c.Assert(err, IsNil)
+	c.Check(m["snap_mode"], Equals, "trying")
+}
@@ -47,6 +47,7 @@ type AppInfo struct {
 	Name        string         `json:"name"`
 	DesktopFile string         `json:"desktop-file,omitempty"`
 	Daemon      string         `json:"daemon,omitempty"`
+	DaemonScope string         `json:"daemon-scope,omitempty"`
 	Enabled     bool           `json:"enabled,omitempty"`
 	Active      bool           `json:"active,omitempty"`
 	CommonID    string         `json:"common-id,omitempty"`
@@ -92,8 +93,11 @@ func (client *Client) Apps(names []string, opts AppOptions) ([]*AppInfo, error)
 
 // LogOptions represent the options of the Logs call.
 type LogOptions struct {
-	N      int  // The maximum number of log lines to retrieve initially. If <0, no limit.
-	Follow bool // Whether to continue returning new lines as they appear
+	N        int       // The maximum number of log lines to retrieve initially. If <0, no limit.
+	Follow   bool      // Whether to continue returning new lines as they appear
+	Since    time.Time // Only return entries not older than this, if set
+	Until    time.Time // Only return entries not newer than this, if set
+	Priority string    // Only return entries of this priority or more important, if set
 }
 
 // A Log holds the information of a single syslog entry
@@ -118,6 +122,15 @@ func (client *Client) Logs(names []string, opts LogOptions) (<-chan Log, error)
 	if opts.Follow {
 		query.Set("follow", strconv.FormatBool(opts.Follow))
 	}
+	if !opts.Since.IsZero() {
+		query.Set("since", opts.Since.Format(time.RFC3339))
+	}
+	if !opts.Until.IsZero() {
+		query.Set("until", opts.Until.Format(time.RFC3339))
+	}
+	if opts.Priority != "" {
+		query.Set("priority", opts.Priority)
+	}
 
 	rsp, err := client.raw("GET", "/v2/logs", query, nil, nil)
 	if err != nil {
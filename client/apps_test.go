@@ -22,8 +22,10 @@ package client_test
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/check.v1"
 
@@ -204,6 +206,28 @@ func (cs *clientSuite) TestClientLogsOpts(c *check.C) {
 	}
 }
 
+func (cs *clientSuite) TestClientLogsFilters(c *check.C) {
+	since := time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC)
+	until := since.Add(time.Hour)
+	ch, err := cs.cli.Logs([]string{"foo"}, client.LogOptions{
+		N:        10,
+		Since:    since,
+		Until:    until,
+		Priority: "warning",
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/logs")
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"names":    []string{"foo"},
+		"n":        []string{"10"},
+		"since":    []string{"2020-09-13T12:26:40Z"},
+		"until":    []string{"2020-09-13T13:26:40Z"},
+		"priority": []string{"warning"},
+	})
+	for range ch {
+	}
+}
+
 func (cs *clientSuite) TestClientLogsNotFound(c *check.C) {
 	cs.rsp = `{"type":"error","status-code":404,"status":"Not Found","result":{"message":"snap \"foo\" not found","kind":"snap-not-found","value":"foo"}}`
 	cs.status = 404
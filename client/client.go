@@ -458,6 +458,10 @@ const (
 	ErrorKindDaemonRestart = "daemon-restart"
 
 	ErrorKindAssertionNotFound = "assertion-not-found"
+
+	ErrorKindUnsuccessful = "unsuccessful"
+
+	ErrorKindStoreProxyUnreachable = "store-proxy-unreachable"
 )
 
 // IsRetryable returns true if the given error is an error
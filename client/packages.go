@@ -77,6 +77,10 @@ type Snap struct {
 	Tracks []string `json:"tracks,omitempty"`
 
 	Health *SnapHealth `json:"health,omitempty"`
+
+	// Hold is set when automatic refreshes of the snap are held, to
+	// the time until which they are; the zero time means indefinitely.
+	Hold *time.Time `json:"hold,omitempty"`
 }
 
 type SnapHealth struct {
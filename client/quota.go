@@ -0,0 +1,127 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// QuotaGroupResult holds the details about a quota group and the
+// current usage of its resources.
+type QuotaGroupResult struct {
+	GroupName string   `json:"group-name"`
+	Snaps     []string `json:"snaps,omitempty"`
+	// MaxMemory is the memory limit of the group in bytes, 0 if
+	// there is none.
+	MaxMemory int64 `json:"max-memory,omitempty"`
+	// CPU is the CPU limit of the group as a percentage of a single
+	// CPU, 0 if there is none.
+	CPU int `json:"cpu,omitempty"`
+	// Threads is the limit of threads of the group, 0 if there is
+	// none.
+	Threads int `json:"threads,omitempty"`
+	// CurrentMemory is the memory currently used by the group in
+	// bytes.
+	CurrentMemory uint64 `json:"current-memory,omitempty"`
+	// CurrentThreads is the number of threads currently in the group.
+	CurrentThreads uint64 `json:"current-threads,omitempty"`
+}
+
+// QuotaValues holds the resource limits to set on a quota group. Zero
+// values leave the corresponding limit unchanged.
+type QuotaValues struct {
+	MaxMemory int64
+	CPU       int
+	Threads   int
+}
+
+type postQuotaData struct {
+	Action    string   `json:"action"`
+	GroupName string   `json:"group-name"`
+	Snaps     []string `json:"snaps,omitempty"`
+	MaxMemory int64    `json:"max-memory,omitempty"`
+	CPU       int      `json:"cpu,omitempty"`
+	Threads   int      `json:"threads,omitempty"`
+}
+
+// EnsureQuota creates the quota group with the given name or updates
+// it if it exists, setting the given limits and adding the given snaps
+// to it. It returns the ID of the change doing so.
+func (client *Client) EnsureQuota(groupName string, snaps []string, values *QuotaValues) (changeID string, err error) {
+	if groupName == "" {
+		return "", fmt.Errorf("cannot create or update quota group without a name")
+	}
+	if values == nil {
+		values = &QuotaValues{}
+	}
+	data, err := json.Marshal(&postQuotaData{
+		Action:    "ensure",
+		GroupName: groupName,
+		Snaps:     snaps,
+		MaxMemory: values.MaxMemory,
+		CPU:       values.CPU,
+		Threads:   values.Threads,
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot marshal quota action: %v", err)
+	}
+
+	return client.doAsync("POST", "/v2/quotas", nil, nil, bytes.NewReader(data))
+}
+
+// RemoveQuota removes the quota group with the given name. It returns
+// the ID of the change doing so.
+func (client *Client) RemoveQuota(groupName string) (changeID string, err error) {
+	if groupName == "" {
+		return "", fmt.Errorf("cannot remove quota group without a name")
+	}
+	data, err := json.Marshal(&postQuotaData{
+		Action:    "remove",
+		GroupName: groupName,
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot marshal quota action: %v", err)
+	}
+
+	return client.doAsync("POST", "/v2/quotas", nil, nil, bytes.NewReader(data))
+}
+
+// Quotas lists the quota groups.
+func (client *Client) Quotas() ([]*QuotaGroupResult, error) {
+	var res []*QuotaGroupResult
+	_, err := client.doSync("GET", "/v2/quotas", nil, nil, nil, &res)
+	return res, err
+}
+
+// GetQuotaGroup returns the details about the quota group with the
+// given name.
+func (client *Client) GetQuotaGroup(groupName string) (*QuotaGroupResult, error) {
+	if groupName == "" {
+		return nil, fmt.Errorf("cannot get quota group without a name")
+	}
+	var res QuotaGroupResult
+	if _, err := client.doSync("GET", "/v2/quotas/"+url.PathEscape(groupName), nil, nil, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
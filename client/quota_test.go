@@ -0,0 +1,135 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+)
+
+func (cs *clientSuite) TestClientEnsureQuota(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{
+		"type": "async",
+		"status-code": 202,
+		"change": "42"
+	}`
+	chgID, err := cs.cli.EnsureQuota("foo", []string{"snap-a", "snap-b"}, &client.QuotaValues{
+		MaxMemory: 1001,
+		CPU:       50,
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(chgID, check.Equals, "42")
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/quotas")
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var req map[string]interface{}
+	err = json.Unmarshal(body, &req)
+	c.Assert(err, check.IsNil)
+	c.Check(req, check.DeepEquals, map[string]interface{}{
+		"action":     "ensure",
+		"group-name": "foo",
+		"snaps":      []interface{}{"snap-a", "snap-b"},
+		"max-memory": float64(1001),
+		"cpu":        float64(50),
+	})
+}
+
+func (cs *clientSuite) TestClientEnsureQuotaError(c *check.C) {
+	cs.status = 400
+	cs.rsp = `{
+		"type": "error",
+		"status-code": 400,
+		"result": {"message": "cannot add snap \"snap-a\" to quota group \"foo\": snap is not installed"}
+	}`
+	_, err := cs.cli.EnsureQuota("foo", []string{"snap-a"}, nil)
+	c.Check(err, check.ErrorMatches, `cannot add snap "snap-a" to quota group "foo": snap is not installed`)
+
+	_, err = cs.cli.EnsureQuota("", nil, nil)
+	c.Check(err, check.ErrorMatches, `cannot create or update quota group without a name`)
+}
+
+func (cs *clientSuite) TestClientRemoveQuota(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{
+		"type": "async",
+		"status-code": 202,
+		"change": "42"
+	}`
+	chgID, err := cs.cli.RemoveQuota("foo")
+	c.Assert(err, check.IsNil)
+	c.Check(chgID, check.Equals, "42")
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/quotas")
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var req map[string]interface{}
+	err = json.Unmarshal(body, &req)
+	c.Assert(err, check.IsNil)
+	c.Check(req, check.DeepEquals, map[string]interface{}{
+		"action":     "remove",
+		"group-name": "foo",
+	})
+
+	_, err = cs.cli.RemoveQuota("")
+	c.Check(err, check.ErrorMatches, `cannot remove quota group without a name`)
+}
+
+func (cs *clientSuite) TestClientQuotas(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": [
+			{"group-name": "bar", "snaps": ["snap-c"], "threads": 32, "current-threads": 5},
+			{"group-name": "foo", "snaps": ["snap-a", "snap-b"], "max-memory": 1048576, "cpu": 50, "current-memory": 1024}
+		]
+	}`
+	grps, err := cs.cli.Quotas()
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/quotas")
+	c.Check(grps, check.DeepEquals, []*client.QuotaGroupResult{
+		{GroupName: "bar", Snaps: []string{"snap-c"}, Threads: 32, CurrentThreads: 5},
+		{GroupName: "foo", Snaps: []string{"snap-a", "snap-b"}, MaxMemory: 1048576, CPU: 50, CurrentMemory: 1024},
+	})
+}
+
+func (cs *clientSuite) TestClientGetQuotaGroup(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {"group-name": "foo", "snaps": ["snap-a"], "max-memory": 1048576, "current-memory": 1024}
+	}`
+	grp, err := cs.cli.GetQuotaGroup("foo")
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/quotas/foo")
+	c.Check(grp, check.DeepEquals, &client.QuotaGroupResult{
+		GroupName: "foo", Snaps: []string{"snap-a"}, MaxMemory: 1048576, CurrentMemory: 1024,
+	})
+
+	_, err = cs.cli.GetQuotaGroup("")
+	c.Check(err, check.ErrorMatches, `cannot get quota group without a name`)
+}
@@ -27,6 +27,7 @@ import (
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type SnapOptions struct {
@@ -40,6 +41,7 @@ type SnapOptions struct {
 	Dangerous        bool   `json:"dangerous,omitempty"`
 	IgnoreValidation bool   `json:"ignore-validation,omitempty"`
 	Unaliased        bool   `json:"unaliased,omitempty"`
+	NoStart          bool   `json:"no-start,omitempty"`
 	Purge            bool   `json:"purge,omitempty"`
 	Amend            bool   `json:"amend,omitempty"`
 
@@ -73,7 +75,10 @@ func (opts *SnapOptions) writeModeFields(mw *multipart.Writer) error {
 }
 
 func (opts *SnapOptions) writeOptionFields(mw *multipart.Writer) error {
-	return writeFieldBool(mw, "unaliased", opts.Unaliased)
+	if err := writeFieldBool(mw, "unaliased", opts.Unaliased); err != nil {
+		return err
+	}
+	return writeFieldBool(mw, "no-start", opts.NoStart)
 }
 
 type actionData struct {
@@ -84,9 +89,10 @@ type actionData struct {
 }
 
 type multiActionData struct {
-	Action string   `json:"action"`
-	Snaps  []string `json:"snaps,omitempty"`
-	Users  []string `json:"users,omitempty"`
+	Action    string     `json:"action"`
+	Snaps     []string   `json:"snaps,omitempty"`
+	Users     []string   `json:"users,omitempty"`
+	HoldUntil *time.Time `json:"hold-until,omitempty"`
 }
 
 // Install adds the snap with the given name from the given channel (or
@@ -118,6 +124,27 @@ func (client *Client) RefreshMany(names []string, options *SnapOptions) (changeI
 	return client.doMultiSnapAction("refresh", names, options)
 }
 
+// HoldRefreshes holds the automatic refreshes of the given snaps, or of
+// all snaps if none are given, until the given time; if it is the zero
+// time, they are held indefinitely.
+func (client *Client) HoldRefreshes(names []string, until time.Time) (changeID string, err error) {
+	action := multiActionData{
+		Action: "hold",
+		Snaps:  names,
+	}
+	if !until.IsZero() {
+		action.HoldUntil = &until
+	}
+	_, changeID, err = client.doMultiSnapActionData(&action)
+	return changeID, err
+}
+
+// UnholdRefreshes removes the holds on the automatic refreshes of the
+// given snaps, or the system-wide one if none are given.
+func (client *Client) UnholdRefreshes(names []string) (changeID string, err error) {
+	return client.doMultiSnapAction("unhold", names, nil)
+}
+
 func (client *Client) Enable(name string, options *SnapOptions) (changeID string, err error) {
 	return client.doSnapAction("enable", name, options)
 }
@@ -194,7 +221,11 @@ func (client *Client) doMultiSnapActionFull(actionName string, snaps []string, o
 	if options != nil {
 		action.Users = options.Users
 	}
-	data, err := json.Marshal(&action)
+	return client.doMultiSnapActionData(&action)
+}
+
+func (client *Client) doMultiSnapActionData(action *multiActionData) (result json.RawMessage, changeID string, err error) {
+	data, err := json.Marshal(action)
 	if err != nil {
 		return nil, "", fmt.Errorf("cannot marshal multi-snap action: %s", err)
 	}
@@ -28,6 +28,7 @@ import (
 	"mime"
 	"mime/multipart"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/check.v1"
 
@@ -182,6 +183,62 @@ func (cs *clientSuite) TestClientMultiOpSnap(c *check.C) {
 	}
 }
 
+func (cs *clientSuite) TestClientHoldRefreshes(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{
+		"change": "d728",
+		"status-code": 202,
+		"type": "async"
+	}`
+	until := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	id, err := cs.cli.HoldRefreshes([]string{pkgName}, until)
+	c.Assert(err, check.IsNil)
+	c.Check(id, check.Equals, "d728")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snaps")
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var jsonBody map[string]interface{}
+	c.Assert(json.Unmarshal(body, &jsonBody), check.IsNil)
+	c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+		"action":     "hold",
+		"snaps":      []interface{}{pkgName},
+		"hold-until": "2030-01-02T03:04:05Z",
+	})
+
+	// held indefinitely
+	_, err = cs.cli.HoldRefreshes(nil, time.Time{})
+	c.Assert(err, check.IsNil)
+	body, err = ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	jsonBody = nil
+	c.Assert(json.Unmarshal(body, &jsonBody), check.IsNil)
+	c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+		"action": "hold",
+	})
+}
+
+func (cs *clientSuite) TestClientUnholdRefreshes(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{
+		"change": "d728",
+		"status-code": 202,
+		"type": "async"
+	}`
+	id, err := cs.cli.UnholdRefreshes([]string{pkgName})
+	c.Assert(err, check.IsNil)
+	c.Check(id, check.Equals, "d728")
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var jsonBody map[string]interface{}
+	c.Assert(json.Unmarshal(body, &jsonBody), check.IsNil)
+	c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+		"action": "unhold",
+		"snaps":  []interface{}{pkgName},
+	})
+}
+
 func (cs *clientSuite) TestClientMultiSnapshot(c *check.C) {
 	// Note body is essentially the same as TestClientMultiOpSnap; keep in sync
 	cs.status = 202
@@ -425,6 +482,7 @@ func (cs *clientSuite) TestSnapOptionsSerialises(c *check.C) {
 		`{"dangerous":true}`:         {Dangerous: true},
 		`{"ignore-validation":true}`: {IgnoreValidation: true},
 		`{"unaliased":true}`:         {Unaliased: true},
+		`{"no-start":true}`:          {NoStart: true},
 		`{"purge":true}`:             {Purge: true},
 		`{"amend":true}`:             {Amend: true},
 	}
@@ -40,6 +40,16 @@ type snapctlOutput struct {
 	Stderr string `json:"stderr"`
 }
 
+// UnsuccessfulError is returned by RunSnapctl when the snapctl
+// command ran but was unsuccessful, it carries the exit code.
+type UnsuccessfulError struct {
+	ExitCode int
+}
+
+func (e *UnsuccessfulError) Error() string {
+	return fmt.Sprintf("snapctl unsuccessful with exit code: %d", e.ExitCode)
+}
+
 // RunSnapctl requests a snapctl run for the given options.
 func (client *Client) RunSnapctl(options *SnapCtlOptions) (stdout, stderr []byte, err error) {
 	b, err := json.Marshal(options)
@@ -49,6 +59,13 @@ func (client *Client) RunSnapctl(options *SnapCtlOptions) (stdout, stderr []byte
 
 	var output snapctlOutput
 	_, err = client.doSync("POST", "/v2/snapctl", nil, nil, bytes.NewReader(b), &output)
+	if e, ok := err.(*Error); ok && e.Kind == ErrorKindUnsuccessful {
+		val, _ := e.Value.(map[string]interface{})
+		stdout, _ := val["stdout"].(string)
+		stderr, _ := val["stderr"].(string)
+		exitCode, _ := val["exit-code"].(float64)
+		return []byte(stdout), []byte(stderr), &UnsuccessfulError{ExitCode: int(exitCode)}
+	}
 	if err != nil {
 		return nil, nil, err
 	}
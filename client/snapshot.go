@@ -24,6 +24,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"strconv"
 	"strings"
@@ -32,6 +33,10 @@ import (
 	"github.com/snapcore/snapd/snap"
 )
 
+// SnapshotExportMediaType is the media type used to identify snapshot
+// set exports in the API.
+const SnapshotExportMediaType = "application/x.snapd.snapshot"
+
 var (
 	ErrSnapshotSetNotFound   = errors.New("no snapshot set with the given ID")
 	ErrSnapshotSnapsNotFound = errors.New("no snapshot for the requested snaps found in the set with the given ID")
@@ -66,15 +71,21 @@ type Snapshot struct {
 
 	// the hash of the archives' data, keyed by archive path
 	// (either 'archive.tgz' for the system archive, or
-	// user/<username>.tgz for each user)
+	// user/<username>.tgz for each user; 'archive.tar' and
+	// user/<username>.tar for chunked snapshots)
 	SHA3_384 map[string]string `json:"sha3-384"`
-	// the sum of the archive sizes
+	// the sum of the archive sizes (for chunked snapshots, the size
+	// of the chunks this snapshot added to the chunk store)
 	Size int64 `json:"size,omitempty"`
 	// if the snapshot failed to open this will be the reason why
 	Broken string `json:"broken,omitempty"`
 
 	// set if the snapshot was created automatically on snap removal
 	Auto bool `json:"auto,omitempty"`
+
+	// set if the archives' data is kept in the shared chunk store
+	// instead of the snapshot itself
+	Chunked bool `json:"chunked,omitempty"`
 }
 
 // IsValid checks whether the snapshot is missing information that
@@ -176,3 +187,43 @@ func (client *Client) snapshotAction(action *snapshotAction) (changeID string, e
 
 	return client.doAsync("POST", "/v2/snapshots", nil, headers, bytes.NewBuffer(data))
 }
+
+// SnapshotExport streams the requested snapshot set.
+//
+// The return value includes the length of the returned stream.
+func (client *Client) SnapshotExport(setID uint64) (stream io.ReadCloser, contentLength int64, err error) {
+	rsp, err := client.raw("GET", fmt.Sprintf("/v2/snapshots/%v/export", setID), nil, nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if rsp.StatusCode != 200 {
+		defer rsp.Body.Close()
+		return nil, 0, parseError(rsp)
+	}
+	if contentType := rsp.Header.Get("Content-Type"); contentType != SnapshotExportMediaType {
+		rsp.Body.Close()
+		return nil, 0, fmt.Errorf("unexpected snapshot export content type %q", contentType)
+	}
+
+	return rsp.Body, rsp.ContentLength, nil
+}
+
+// SnapshotImportSet is the result of importing a snapshot set.
+type SnapshotImportSet struct {
+	ID    uint64   `json:"set-id"`
+	Snaps []string `json:"snaps"`
+}
+
+// SnapshotImport imports an exported snapshot set, as a new snapshot set.
+func (client *Client) SnapshotImport(exportStream io.Reader) (SnapshotImportSet, error) {
+	headers := map[string]string{
+		"Content-Type": SnapshotExportMediaType,
+	}
+
+	var importSet SnapshotImportSet
+	if _, err := client.doSync("POST", "/v2/snapshots", nil, headers, exportStream, &importSet); err != nil {
+		return importSet, err
+	}
+
+	return importSet, nil
+}
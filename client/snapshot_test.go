@@ -20,7 +20,10 @@
 package client_test
 
 import (
+	"io/ioutil"
+	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"gopkg.in/check.v1"
@@ -137,3 +140,53 @@ func (cs *clientSuite) TestClientCheckSnapshots(c *check.C) {
 func (cs *clientSuite) TestClientRestoreSnapshots(c *check.C) {
 	cs.testClientSnapshotAction(c, "restore", cs.cli.RestoreSnapshots)
 }
+
+func (cs *clientSuite) TestClientExportSnapshot(c *check.C) {
+	cs.header = http.Header{"Content-Type": []string{client.SnapshotExportMediaType}}
+	cs.rsp = "export-stream"
+
+	stream, _, err := cs.cli.SnapshotExport(42)
+	c.Assert(err, check.IsNil)
+	defer stream.Close()
+	data, err := ioutil.ReadAll(stream)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, "export-stream")
+
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snapshots/42/export")
+}
+
+func (cs *clientSuite) TestClientExportSnapshotError(c *check.C) {
+	cs.status = 404
+	cs.header = http.Header{"Content-Type": []string{"application/json"}}
+	cs.rsp = `{"type": "error", "status-code": 404, "result": {"message": "no snapshot set with the given ID"}}`
+
+	_, _, err := cs.cli.SnapshotExport(42)
+	c.Check(err, check.ErrorMatches, "no snapshot set with the given ID")
+}
+
+func (cs *clientSuite) TestClientExportSnapshotBadContentType(c *check.C) {
+	cs.header = http.Header{"Content-Type": []string{"text/plain"}}
+	cs.rsp = "export-stream"
+
+	_, _, err := cs.cli.SnapshotExport(42)
+	c.Check(err, check.ErrorMatches, `unexpected snapshot export content type "text/plain"`)
+}
+
+func (cs *clientSuite) TestClientImportSnapshot(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": {"set-id": 42, "snaps": ["foo", "bar"]}
+	}`
+
+	importSet, err := cs.cli.SnapshotImport(strings.NewReader("export-stream"))
+	c.Assert(err, check.IsNil)
+	c.Check(importSet, check.DeepEquals, client.SnapshotImportSet{ID: 42, Snaps: []string{"foo", "bar"}})
+
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snapshots")
+	c.Check(cs.req.Header.Get("Content-Type"), check.Equals, client.SnapshotExportMediaType)
+	data, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, "export-stream")
+}
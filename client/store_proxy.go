@@ -0,0 +1,42 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+type storeProxyInstruction struct {
+	URL string `json:"url"`
+}
+
+// SetStoreProxy sets up the snap store proxy at the given URL as the store
+// of the device. The id of the store served by the proxy is available as
+// "store" in the data of the change.
+func (client *Client) SetStoreProxy(proxyURL string) (changeID string, err error) {
+	data, err := json.Marshal(&storeProxyInstruction{URL: proxyURL})
+	if err != nil {
+		return "", fmt.Errorf("cannot request store proxy: %v", err)
+	}
+
+	return client.doAsync("POST", "/v2/store-proxy", nil, nil, bytes.NewReader(data))
+}
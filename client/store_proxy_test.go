@@ -0,0 +1,63 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+)
+
+func (cs *clientSuite) TestClientSetStoreProxy(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{
+		"type": "async",
+		"status-code": 202,
+		"change": "42"
+	}`
+	changeID, err := cs.cli.SetStoreProxy("https://proxy.example.com")
+	c.Assert(err, check.IsNil)
+	c.Check(changeID, check.Equals, "42")
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/store-proxy")
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var jsonBody map[string]interface{}
+	err = json.Unmarshal(body, &jsonBody)
+	c.Assert(err, check.IsNil)
+	c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+		"url": "https://proxy.example.com",
+	})
+}
+
+func (cs *clientSuite) TestClientSetStoreProxyError(c *check.C) {
+	cs.rsp = `{
+		"type": "error",
+		"status-code": 400,
+		"result": {"message": "cannot set up store proxy: boom", "kind": "store-proxy-unreachable"}
+	}`
+	_, err := cs.cli.SetStoreProxy("https://proxy.example.com")
+	c.Check(err, check.ErrorMatches, "cannot set up store proxy: boom")
+	c.Check(err.(*client.Error).Kind, check.Equals, client.ErrorKindStoreProxyUnreachable)
+}
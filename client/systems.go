@@ -0,0 +1,120 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// SystemModelData holds the details of the model of a recovery
+// system.
+type SystemModelData struct {
+	Model       string `json:"model"`
+	BrandID     string `json:"brand-id"`
+	DisplayName string `json:"display-name,omitempty"`
+}
+
+// System holds the details of a recovery system.
+type System struct {
+	// Label of the recovery system.
+	Label string `json:"label"`
+	// Model the recovery system seeds.
+	Model SystemModelData `json:"model"`
+}
+
+// ListSystems lists the recovery systems available on the device.
+func (client *Client) ListSystems() ([]System, error) {
+	var res []System
+	_, err := client.doSync("GET", "/v2/systems", nil, nil, nil, &res)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list recovery systems: %v", err)
+	}
+	return res, nil
+}
+
+// CreateRecoverySystem creates a new recovery system with the given
+// label out of the snaps currently installed on the device.
+func (client *Client) CreateRecoverySystem(label string) (changeID string, err error) {
+	if label == "" {
+		return "", fmt.Errorf("cannot create a recovery system without a label")
+	}
+	data, err := json.Marshal(map[string]string{
+		"action": "create",
+		"label":  label,
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot marshal recovery system action: %v", err)
+	}
+	return client.doAsync("POST", "/v2/systems", nil, nil, bytes.NewReader(data))
+}
+
+// DoSystemAction requests the device to reboot into the recovery
+// system with the given label in the given mode, one of install,
+// recover or run.
+func (client *Client) DoSystemAction(label, mode string) error {
+	if label == "" {
+		return fmt.Errorf("cannot request a system action without a system label")
+	}
+	data, err := json.Marshal(map[string]string{
+		"action": "do",
+		"mode":   mode,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot marshal system action: %v", err)
+	}
+	_, err = client.doSync("POST", "/v2/systems/"+url.PathEscape(label), nil, nil, bytes.NewReader(data), nil)
+	if err != nil {
+		return fmt.Errorf("cannot request system action: %v", err)
+	}
+	return nil
+}
+
+// FactoryResetOptions holds the options for a factory reset.
+type FactoryResetOptions struct {
+	// KeepSerial preserves the serial assertion and the device key
+	// across the reset.
+	KeepSerial bool `json:"keep-serial,omitempty"`
+}
+
+// FactoryReset requests the device to reboot and return to the state
+// it was seeded in, wiping all writable data.
+func (client *Client) FactoryReset(opts *FactoryResetOptions) (changeID string, err error) {
+	if opts == nil {
+		opts = &FactoryResetOptions{}
+	}
+	data, err := json.Marshal(struct {
+		Action string `json:"action"`
+		*FactoryResetOptions
+	}{
+		Action:              "factory-reset",
+		FactoryResetOptions: opts,
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot marshal factory reset request: %v", err)
+	}
+	changeID, err = client.doAsync("POST", "/v2/systems", nil, nil, bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("cannot factory reset: %v", err)
+	}
+	return changeID, nil
+}
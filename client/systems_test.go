@@ -0,0 +1,162 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+)
+
+func (cs *clientSuite) TestListSystems(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": [
+			{"label": "20191119", "model": {"model": "my-model", "brand-id": "my-brand", "display-name": "My Model"}},
+			{"label": "20191120", "model": {"model": "my-model", "brand-id": "my-brand"}}
+		]
+	}`
+	systems, err := cs.cli.ListSystems()
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/systems")
+	c.Check(systems, check.DeepEquals, []client.System{
+		{
+			Label: "20191119",
+			Model: client.SystemModelData{Model: "my-model", BrandID: "my-brand", DisplayName: "My Model"},
+		}, {
+			Label: "20191120",
+			Model: client.SystemModelData{Model: "my-model", BrandID: "my-brand"},
+		},
+	})
+}
+
+func (cs *clientSuite) TestListSystemsError(c *check.C) {
+	cs.status = 500
+	cs.rsp = `{
+		"type": "error",
+		"status-code": 500,
+		"result": {"message": "boom"}
+	}`
+	_, err := cs.cli.ListSystems()
+	c.Check(err, check.ErrorMatches, "cannot list recovery systems: boom")
+}
+
+func (cs *clientSuite) TestCreateRecoverySystem(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{
+		"type": "async",
+		"status-code": 202,
+		"change": "42"
+	}`
+	id, err := cs.cli.CreateRecoverySystem("20191119")
+	c.Assert(err, check.IsNil)
+	c.Check(id, check.Equals, "42")
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/systems")
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var req map[string]interface{}
+	c.Assert(json.Unmarshal(body, &req), check.IsNil)
+	c.Check(req, check.DeepEquals, map[string]interface{}{
+		"action": "create",
+		"label":  "20191119",
+	})
+
+	_, err = cs.cli.CreateRecoverySystem("")
+	c.Check(err, check.ErrorMatches, "cannot create a recovery system without a label")
+}
+
+func (cs *clientSuite) TestDoSystemAction(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": null
+	}`
+	err := cs.cli.DoSystemAction("20191119", "install")
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/systems/20191119")
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var req map[string]interface{}
+	c.Assert(json.Unmarshal(body, &req), check.IsNil)
+	c.Check(req, check.DeepEquals, map[string]interface{}{
+		"action": "do",
+		"mode":   "install",
+	})
+}
+
+func (cs *clientSuite) TestDoSystemActionError(c *check.C) {
+	cs.status = 404
+	cs.rsp = `{
+		"type": "error",
+		"status-code": 404,
+		"result": {"message": "cannot find recovery system \"foo\""}
+	}`
+	err := cs.cli.DoSystemAction("foo", "install")
+	c.Check(err, check.ErrorMatches, `cannot request system action: cannot find recovery system "foo"`)
+
+	err = cs.cli.DoSystemAction("", "install")
+	c.Check(err, check.ErrorMatches, "cannot request a system action without a system label")
+}
+
+func (cs *clientSuite) TestFactoryReset(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{
+		"type": "async",
+		"status-code": 202,
+		"result": null,
+		"change": "42"
+	}`
+	for _, t := range []struct {
+		opts     *client.FactoryResetOptions
+		expected map[string]interface{}
+	}{
+		{nil, map[string]interface{}{"action": "factory-reset"}},
+		{&client.FactoryResetOptions{KeepSerial: true}, map[string]interface{}{"action": "factory-reset", "keep-serial": true}},
+	} {
+		changeID, err := cs.cli.FactoryReset(t.opts)
+		c.Assert(err, check.IsNil)
+		c.Check(changeID, check.Equals, "42")
+		c.Check(cs.req.Method, check.Equals, "POST")
+		c.Check(cs.req.URL.Path, check.Equals, "/v2/systems")
+		body, err := ioutil.ReadAll(cs.req.Body)
+		c.Assert(err, check.IsNil)
+		var req map[string]interface{}
+		c.Assert(json.Unmarshal(body, &req), check.IsNil)
+		c.Check(req, check.DeepEquals, t.expected)
+	}
+}
+
+func (cs *clientSuite) TestFactoryResetError(c *check.C) {
+	cs.status = 409
+	cs.rsp = `{
+		"type": "error",
+		"status-code": 409,
+		"result": {"message": "cannot factory reset while other changes are in progress"}
+	}`
+	_, err := cs.cli.FactoryReset(nil)
+	c.Assert(err, check.ErrorMatches, "cannot factory reset: cannot factory reset while other changes are in progress")
+}
@@ -0,0 +1,114 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// ValidationSetResult holds the details about a validation set
+// applied to the system.
+type ValidationSetResult struct {
+	AccountID string `json:"account-id"`
+	Name      string `json:"name"`
+	Mode      string `json:"mode"`
+	// PinnedAt is the sequence point the validation set is pinned
+	// to, 0 if it follows the latest one.
+	PinnedAt int `json:"pinned-at,omitempty"`
+	// Sequence is the sequence point currently in use.
+	Sequence int `json:"sequence"`
+	// Valid is whether the installed snaps satisfy the validation
+	// set.
+	Valid bool `json:"valid"`
+}
+
+// ValidationSetApplyOptions holds the options to apply a validation
+// set with.
+type ValidationSetApplyOptions struct {
+	// Mode is one of "monitor" or "enforce".
+	Mode string
+	// Sequence is the sequence point to pin the validation set to,
+	// 0 to follow the latest one.
+	Sequence int
+}
+
+type validationSetAction struct {
+	Action   string `json:"action"`
+	Mode     string `json:"mode,omitempty"`
+	Sequence int    `json:"sequence,omitempty"`
+}
+
+func validationSetPath(accountID, name string) string {
+	return fmt.Sprintf("/v2/validation-sets/%s/%s", url.PathEscape(accountID), url.PathEscape(name))
+}
+
+// ListValidationSets lists the validation sets applied to the system.
+func (client *Client) ListValidationSets() ([]*ValidationSetResult, error) {
+	var res []*ValidationSetResult
+	_, err := client.doSync("GET", "/v2/validation-sets", nil, nil, nil, &res)
+	return res, err
+}
+
+// ValidationSet returns the details about the validation set of the
+// given account with the given name.
+func (client *Client) ValidationSet(accountID, name string) (*ValidationSetResult, error) {
+	var res ValidationSetResult
+	if _, err := client.doSync("GET", validationSetPath(accountID, name), nil, nil, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ApplyValidationSet applies the validation set of the given account
+// with the given name to the system.
+func (client *Client) ApplyValidationSet(accountID, name string, opts *ValidationSetApplyOptions) (*ValidationSetResult, error) {
+	if opts == nil {
+		opts = &ValidationSetApplyOptions{}
+	}
+	data, err := json.Marshal(&validationSetAction{
+		Action:   "apply",
+		Mode:     opts.Mode,
+		Sequence: opts.Sequence,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal validation set action: %v", err)
+	}
+
+	var res ValidationSetResult
+	if _, err := client.doSync("POST", validationSetPath(accountID, name), nil, nil, bytes.NewReader(data), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ForgetValidationSet stops applying the validation set of the given
+// account with the given name to the system.
+func (client *Client) ForgetValidationSet(accountID, name string) error {
+	data, err := json.Marshal(&validationSetAction{Action: "forget"})
+	if err != nil {
+		return fmt.Errorf("cannot marshal validation set action: %v", err)
+	}
+
+	_, err = client.doSync("POST", validationSetPath(accountID, name), nil, nil, bytes.NewReader(data), nil)
+	return err
+}
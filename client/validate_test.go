@@ -0,0 +1,122 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+)
+
+func (cs *clientSuite) TestClientListValidationSets(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": [
+			{"account-id": "acme", "name": "one", "mode": "enforce", "pinned-at": 2, "sequence": 2, "valid": true},
+			{"account-id": "acme", "name": "two", "mode": "monitor", "sequence": 5, "valid": false}
+		]
+	}`
+	vsets, err := cs.cli.ListValidationSets()
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/validation-sets")
+	c.Check(vsets, check.DeepEquals, []*client.ValidationSetResult{
+		{AccountID: "acme", Name: "one", Mode: "enforce", PinnedAt: 2, Sequence: 2, Valid: true},
+		{AccountID: "acme", Name: "two", Mode: "monitor", Sequence: 5},
+	})
+}
+
+func (cs *clientSuite) TestClientValidationSet(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {"account-id": "acme", "name": "one", "mode": "monitor", "sequence": 3, "valid": true}
+	}`
+	vs, err := cs.cli.ValidationSet("acme", "one")
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/validation-sets/acme/one")
+	c.Check(vs, check.DeepEquals, &client.ValidationSetResult{
+		AccountID: "acme", Name: "one", Mode: "monitor", Sequence: 3, Valid: true,
+	})
+}
+
+func (cs *clientSuite) TestClientApplyValidationSet(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {"account-id": "acme", "name": "one", "mode": "enforce", "pinned-at": 3, "sequence": 3, "valid": true}
+	}`
+	vs, err := cs.cli.ApplyValidationSet("acme", "one", &client.ValidationSetApplyOptions{
+		Mode:     "enforce",
+		Sequence: 3,
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/validation-sets/acme/one")
+	c.Check(vs, check.DeepEquals, &client.ValidationSetResult{
+		AccountID: "acme", Name: "one", Mode: "enforce", PinnedAt: 3, Sequence: 3, Valid: true,
+	})
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var jsonBody map[string]interface{}
+	c.Assert(json.Unmarshal(body, &jsonBody), check.IsNil)
+	c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+		"action":   "apply",
+		"mode":     "enforce",
+		"sequence": 3.0,
+	})
+}
+
+func (cs *clientSuite) TestClientForgetValidationSet(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": null
+	}`
+	err := cs.cli.ForgetValidationSet("acme", "one")
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/validation-sets/acme/one")
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var jsonBody map[string]interface{}
+	c.Assert(json.Unmarshal(body, &jsonBody), check.IsNil)
+	c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+		"action": "forget",
+	})
+}
+
+func (cs *clientSuite) TestClientApplyValidationSetError(c *check.C) {
+	cs.status = 400
+	cs.rsp = `{
+		"type": "error",
+		"status-code": 400,
+		"result": {"message": "cannot enforce validation set: boom"}
+	}`
+	_, err := cs.cli.ApplyValidationSet("acme", "one", nil)
+	c.Check(err, check.ErrorMatches, "cannot enforce validation set: boom")
+}
@@ -0,0 +1,120 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/gadget"
+)
+
+type cmdGadgetVerify struct {
+	clientMixin
+	Positionals struct {
+		GadgetDir flags.Filename `positional-arg-name:"<gadget-dir>"`
+	} `positional-args:"true"`
+}
+
+var gadgetVerify = gadget.Verify
+
+func init() {
+	cmd := addDebugCommand("gadget-verify",
+		"(internal) verify on-disk gadget content",
+		"(internal) compare the content of the gadget volume structures with the installed gadget snap or the given gadget directory",
+		func() flags.Commander {
+			return &cmdGadgetVerify{}
+		}, nil, nil)
+	cmd.hidden = true
+}
+
+// installedGadgetDir returns the mount directory of the current revision of
+// the installed gadget snap.
+func (x *cmdGadgetVerify) installedGadgetDir() (string, error) {
+	snaps, err := x.client.List(nil, nil)
+	if err != nil {
+		return "", err
+	}
+	for _, sn := range snaps {
+		if sn.Type == client.TypeGadget {
+			return filepath.Join(dirs.SnapMountDir, sn.Name, "current"), nil
+		}
+	}
+	return "", errors.New("cannot find an installed gadget snap")
+}
+
+func (x *cmdGadgetVerify) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	gadgetDir := string(x.Positionals.GadgetDir)
+	if gadgetDir == "" {
+		var err error
+		gadgetDir, err = x.installedGadgetDir()
+		if err != nil {
+			return err
+		}
+	}
+
+	const onClassic = false
+	info, err := gadget.ReadInfo(gadgetDir, onClassic)
+	if err != nil {
+		return err
+	}
+	reports, err := gadgetVerify(gadget.GadgetData{Info: info, RootDir: gadgetDir})
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	fmt.Fprintln(w, "Structure\tStatus")
+	failed := false
+	for _, r := range reports {
+		switch {
+		case r.Err != nil:
+			fmt.Fprintf(w, "%v\terror: %v\n", r.Structure, r.Err)
+		case len(r.Mismatches) == 0:
+			fmt.Fprintf(w, "%v\tok\n", r.Structure)
+		default:
+			for i, m := range r.Mismatches {
+				name := ""
+				if i == 0 {
+					name = r.Structure.String()
+				}
+				fmt.Fprintf(w, "%s\t%s\n", name, m)
+			}
+		}
+		if !r.OK() {
+			failed = true
+		}
+	}
+	w.Flush()
+
+	if failed {
+		return errors.New("gadget content on the device does not match the gadget")
+	}
+	return nil
+}
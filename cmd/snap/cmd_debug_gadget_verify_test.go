@@ -0,0 +1,161 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/gadget"
+)
+
+const gadgetVerifyYaml = `
+volumes:
+  pc:
+    bootloader: grub
+`
+
+func makeGadgetVerifyDir(c *C, dir string) {
+	err := os.MkdirAll(filepath.Join(dir, "meta"), 0755)
+	c.Assert(err, IsNil)
+	f, err := os.Create(filepath.Join(dir, "meta/gadget.yaml"))
+	c.Assert(err, IsNil)
+	defer f.Close()
+	_, err = f.WriteString(gadgetVerifyYaml)
+	c.Assert(err, IsNil)
+}
+
+func gadgetVerifyStructure(index int, name string) *gadget.LaidOutStructure {
+	return &gadget.LaidOutStructure{
+		VolumeStructure: &gadget.VolumeStructure{Name: name},
+		Index:           index,
+	}
+}
+
+func (s *SnapSuite) TestDebugGadgetVerifyHappy(c *C) {
+	gadgetDir := c.MkDir()
+	makeGadgetVerifyDir(c, gadgetDir)
+
+	restore := snap.MockGadgetVerify(func(gd gadget.GadgetData) ([]gadget.StructureReport, error) {
+		c.Check(gd.RootDir, Equals, gadgetDir)
+		c.Check(gd.Info.Volumes, HasLen, 1)
+		return []gadget.StructureReport{
+			{Structure: gadgetVerifyStructure(0, "mbr")},
+			{Structure: gadgetVerifyStructure(1, "system-boot")},
+		}, nil
+	})
+	defer restore()
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "gadget-verify", gadgetDir})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+	c.Check(s.Stdout(), Equals, `Structure           Status
+#0 ("mbr")          ok
+#1 ("system-boot")  ok
+`)
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *SnapSuite) TestDebugGadgetVerifyMismatches(c *C) {
+	gadgetDir := c.MkDir()
+	makeGadgetVerifyDir(c, gadgetDir)
+
+	restore := snap.MockGadgetVerify(func(gd gadget.GadgetData) ([]gadget.StructureReport, error) {
+		return []gadget.StructureReport{
+			{Structure: gadgetVerifyStructure(0, "mbr")},
+			{
+				Structure:  gadgetVerifyStructure(1, "system-boot"),
+				Mismatches: []string{"grub.cfg: differs", "EFI/boot/grubx64.efi: missing"},
+			},
+			{
+				Structure: gadgetVerifyStructure(2, "raw"),
+				Err:       errors.New("cannot find device"),
+			},
+		}, nil
+	})
+	defer restore()
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "gadget-verify", gadgetDir})
+	c.Assert(err, ErrorMatches, "gadget content on the device does not match the gadget")
+	c.Check(s.Stdout(), Equals, `Structure           Status
+#0 ("mbr")          ok
+#1 ("system-boot")  grub.cfg: differs
+                    EFI/boot/grubx64.efi: missing
+#2 ("raw")          error: cannot find device
+`)
+}
+
+func (s *SnapSuite) TestDebugGadgetVerifyInstalledGadget(c *C) {
+	gadgetDir := filepath.Join(dirs.SnapMountDir, "pc", "current")
+	makeGadgetVerifyDir(c, gadgetDir)
+
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, Equals, "GET")
+			c.Check(r.URL.Path, Equals, "/v2/snaps")
+			fmt.Fprintln(w, `{"type": "sync", "result": [{"name": "core", "type": "os"}, {"name": "pc", "type": "gadget"}]}`)
+		default:
+			c.Fatalf("expected to get 1 requests, now on %d", n+1)
+		}
+		n++
+	})
+
+	restore := snap.MockGadgetVerify(func(gd gadget.GadgetData) ([]gadget.StructureReport, error) {
+		c.Check(gd.RootDir, Equals, gadgetDir)
+		return nil, nil
+	})
+	defer restore()
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "gadget-verify"})
+	c.Assert(err, IsNil)
+	c.Check(n, Equals, 1)
+	c.Check(s.Stdout(), Equals, "Structure  Status\n")
+}
+
+func (s *SnapSuite) TestDebugGadgetVerifyNoGadget(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "result": [{"name": "core", "type": "os"}]}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "gadget-verify"})
+	c.Assert(err, ErrorMatches, "cannot find an installed gadget snap")
+}
+
+func (s *SnapSuite) TestDebugGadgetVerifyError(c *C) {
+	gadgetDir := c.MkDir()
+	makeGadgetVerifyDir(c, gadgetDir)
+
+	restore := snap.MockGadgetVerify(func(gd gadget.GadgetData) ([]gadget.StructureReport, error) {
+		return nil, errors.New("cannot lay out the volume: boom")
+	})
+	defer restore()
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "gadget-verify", gadgetDir})
+	c.Assert(err, ErrorMatches, "cannot lay out the volume: boom")
+}
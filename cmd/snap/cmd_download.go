@@ -21,8 +21,10 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/jessevdk/go-flags"
@@ -32,6 +34,7 @@ import (
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/image"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snapbundle"
 )
 
 type cmdDownload struct {
@@ -39,6 +42,7 @@ type cmdDownload struct {
 	Revision  string `long:"revision"`
 	Basename  string `long:"basename"`
 	TargetDir string `long:"target-directory"`
+	Bundle    bool   `long:"bundle"`
 
 	CohortKey  string `long:"cohort"`
 	Positional struct {
@@ -50,6 +54,11 @@ var shortDownloadHelp = i18n.G("Download the given snap")
 var longDownloadHelp = i18n.G(`
 The download command downloads the given snap and its supporting assertions
 to the current directory with .snap and .assert file extensions, respectively.
+
+With --bundle the snap, its base and the default providers of its content
+plugs are downloaded together with all their assertions into a single .bundle
+file, that can be installed with 'snap install' on devices without network
+access.
 `)
 
 func init() {
@@ -64,6 +73,8 @@ func init() {
 		"basename": i18n.G("Use this basename for the snap and assertion files (defaults to <snap>_<revision>)"),
 		// TRANSLATORS: This should not start with a lowercase letter.
 		"target-directory": i18n.G("Download to this directory (defaults to the current directory)"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"bundle": i18n.G("Download the snap and the snaps it needs into one bundle for offline installation"),
 	}), []argDesc{{
 		name: "<snap>",
 		// TRANSLATORS: This should not start with a lowercase letter.
@@ -133,7 +144,6 @@ func (x *cmdDownload) Execute(args []string) error {
 		return err
 	}
 
-	fmt.Fprintf(Stdout, i18n.G("Fetching snap %q\n"), snapName)
 	dlOpts := image.DownloadOptions{
 		TargetDir: x.TargetDir,
 		Basename:  x.Basename,
@@ -143,6 +153,11 @@ func (x *cmdDownload) Execute(args []string) error {
 		// if something goes wrong, don't force it to start over again
 		LeavePartialOnError: true,
 	}
+	if x.Bundle {
+		return x.downloadBundle(tsto, snapName, dlOpts)
+	}
+
+	fmt.Fprintf(Stdout, i18n.G("Fetching snap %q\n"), snapName)
 	snapPath, snapInfo, err := tsto.DownloadSnap(snapName, dlOpts)
 	if err != nil {
 		return err
@@ -170,3 +185,141 @@ func (x *cmdDownload) Execute(args []string) error {
 
 	return nil
 }
+
+// bundleDependencies returns the names of the snaps the given snap needs
+// to be installed: the snapd snap, unless the snap uses the core snap that
+// carries snapd, its base and the default providers of its content plugs.
+func bundleDependencies(info *snap.Info) []string {
+	var deps []string
+	base := info.Base
+	if base == "" && info.GetType() == snap.TypeApp {
+		base = "core"
+	}
+	// the core snap carries snapd itself
+	usesCore := base == "core" || info.GetType() == snap.TypeOS
+	if !usesCore && info.GetType() != snap.TypeSnapd {
+		deps = append(deps, "snapd")
+	}
+	if info.GetType() == snap.TypeApp && base != "none" {
+		deps = append(deps, base)
+	}
+	var providers []string
+	for _, dprovider := range snap.NeededDefaultProviders(info) {
+		// the default-provider can be of the "snapname:slot" form
+		providers = append(providers, strings.SplitN(dprovider, ":", 2)[0])
+	}
+	sort.Strings(providers)
+	return append(deps, providers...)
+}
+
+func (x *cmdDownload) downloadBundle(tsto *image.ToolingStore, snapName string, dlOpts image.DownloadOptions) error {
+	targetDir := x.TargetDir
+	if targetDir == "" {
+		targetDir = "."
+	}
+	tmpDir, err := ioutil.TempDir(targetDir, ".snap-bundle-")
+	if err != nil {
+		return fmt.Errorf(i18n.G("cannot create temporary directory: %v"), err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{
+		Backstore: asserts.NewMemoryBackstore(),
+		Trusted:   sysdb.Trusted(),
+	})
+	if err != nil {
+		return err
+	}
+	// the fetcher saves assertions in prerequisite order
+	var as []asserts.Assertion
+	save := func(a asserts.Assertion) error {
+		as = append(as, a)
+		return nil
+	}
+	f := tsto.AssertionFetcher(db, save)
+
+	// snaps are added after the snaps they need, in install order
+	var snapPaths []string
+	var mainInfo *snap.Info
+	seen := make(map[string]bool)
+	var fetch func(name string, opts image.DownloadOptions) error
+	fetch = func(name string, opts image.DownloadOptions) error {
+		seen[name] = true
+		opts.TargetDir = tmpDir
+		opts.Basename = ""
+
+		fmt.Fprintf(Stdout, i18n.G("Fetching snap %q\n"), name)
+		snapPath, info, err := tsto.DownloadSnap(name, opts)
+		if err != nil {
+			return err
+		}
+		if mainInfo == nil {
+			mainInfo = info
+		}
+
+		fmt.Fprintf(Stdout, i18n.G("Fetching assertions for %q\n"), name)
+		if _, err := image.FetchAndCheckSnapAssertions(snapPath, info, f, db); err != nil {
+			return err
+		}
+
+		for _, dep := range bundleDependencies(info) {
+			if seen[dep] {
+				continue
+			}
+			if err := fetch(dep, image.DownloadOptions{LeavePartialOnError: true}); err != nil {
+				return err
+			}
+		}
+		snapPaths = append(snapPaths, snapPath)
+		return nil
+	}
+	if err := fetch(snapName, dlOpts); err != nil {
+		return err
+	}
+
+	basename := x.Basename
+	if basename == "" {
+		basename = fmt.Sprintf("%s_%s", mainInfo.SnapName(), mainInfo.Revision)
+	}
+	bundlePath := filepath.Join(x.TargetDir, basename+snapbundle.Extension)
+	if err := writeBundle(bundlePath, as, snapPaths); err != nil {
+		return fmt.Errorf(i18n.G("cannot write snap bundle: %v"), err)
+	}
+
+	// simplify path
+	wd, _ := os.Getwd()
+	if p, err := filepath.Rel(wd, bundlePath); err == nil {
+		bundlePath = p
+	}
+	fmt.Fprintf(Stdout, i18n.G(`Install the snap bundle with:
+   snap install %s
+`), bundlePath)
+
+	return nil
+}
+
+func writeBundle(bundlePath string, as []asserts.Assertion, snapPaths []string) (err error) {
+	f, err := os.Create(bundlePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(bundlePath)
+		}
+	}()
+
+	w := snapbundle.NewWriter(f)
+	if err := w.WriteAssertions(as); err != nil {
+		return err
+	}
+	for _, snapPath := range snapPaths {
+		if err := w.AddSnap(snapPath); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
@@ -20,9 +20,17 @@
 package main_test
 
 import (
+	"io/ioutil"
+	"path/filepath"
+
 	"gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
 	snap "github.com/snapcore/snapd/cmd/snap"
+	"github.com/snapcore/snapd/snap/snapbundle"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/testutil"
 )
 
 // these only cover errors that happen before hitting the network,
@@ -59,3 +67,62 @@ func (s *SnapSuite) TestDownloadChannelAndRevision(c *check.C) {
 
 	c.Check(err, check.ErrorMatches, "cannot specify both channel and revision")
 }
+
+func (s *SnapSuite) TestDownloadBundleDependencies(c *check.C) {
+	for _, t := range []struct {
+		yaml string
+		deps []string
+	}{
+		{"name: foo\nversion: 1\n", []string{"core"}},
+		{"name: foo\nversion: 1\nbase: core\n", []string{"core"}},
+		{"name: foo\nversion: 1\nbase: core20\n", []string{"snapd", "core20"}},
+		{"name: foo\nversion: 1\nbase: none\n", []string{"snapd"}},
+		{"name: core20\nversion: 1\ntype: base\n", []string{"snapd"}},
+		{"name: core\nversion: 1\ntype: os\n", nil},
+		{"name: snapd\nversion: 1\ntype: snapd\n", nil},
+		{`name: foo
+version: 1
+base: core20
+plugs:
+  gtk-3-themes:
+    interface: content
+    target: $SNAP/data-dir/themes
+    default-provider: gtk-common-themes
+  other:
+    interface: content
+    target: $SNAP/other
+    default-provider: other-provider:slot
+  network:
+`, []string{"snapd", "core20", "gtk-common-themes", "other-provider"}},
+	} {
+		info := snaptest.MockInfo(c, t.yaml, nil)
+		c.Check(snap.BundleDependencies(info), check.DeepEquals, t.deps, check.Commentf(t.yaml))
+	}
+}
+
+func (s *SnapSuite) TestDownloadWriteBundle(c *check.C) {
+	dir := c.MkDir()
+	storeSigning := assertstest.NewStoreStack("can0nical", nil)
+	as := []asserts.Assertion{storeSigning.StoreAccountKey("")}
+	var snapPaths []string
+	for _, name := range []string{"core20_1.snap", "foo_2.snap"} {
+		p := filepath.Join(dir, name)
+		c.Assert(ioutil.WriteFile(p, []byte(name), 0644), check.IsNil)
+		snapPaths = append(snapPaths, p)
+	}
+
+	bundlePath := filepath.Join(dir, "foo_2.bundle")
+	c.Assert(snap.WriteBundle(bundlePath, as, snapPaths), check.IsNil)
+
+	b, err := snapbundle.Unpack(bundlePath, c.MkDir(), "snap-")
+	c.Assert(err, check.IsNil)
+	c.Check(b.Assertions, check.DeepEquals, as)
+	c.Check(b.Names, check.DeepEquals, []string{"core20_1.snap", "foo_2.snap"})
+	c.Assert(b.Snaps, check.HasLen, 2)
+	c.Check(b.Snaps[1], testutil.FileEquals, "foo_2.snap")
+
+	// a failure leaves no bundle behind
+	err = snap.WriteBundle(bundlePath, as, []string{filepath.Join(dir, "missing.snap")})
+	c.Check(err, check.ErrorMatches, ".*no such file or directory")
+	c.Check(bundlePath, testutil.FileAbsent)
+}
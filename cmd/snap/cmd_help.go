@@ -192,7 +192,7 @@ var helpCategories = []helpCategory{
 	}, {
 		Label:       i18n.G("Daemons"),
 		Description: i18n.G("manage services"),
-		Commands:    []string{"services", "start", "stop", "restart", "logs"},
+		Commands:    []string{"services", "start", "stop", "restart", "logs", "set-quota", "remove-quota", "quotas", "quota"},
 	}, {
 		Label:       i18n.G("Commands"),
 		Description: i18n.G("manage aliases"),
@@ -200,7 +200,7 @@ var helpCategories = []helpCategory{
 	}, {
 		Label:       i18n.G("Configuration"),
 		Description: i18n.G("system administration and configuration"),
-		Commands:    []string{"get", "set", "unset", "wait"},
+		Commands:    []string{"get", "set", "unset", "wait", "set-store-proxy"},
 	}, {
 		Label:       i18n.G("Account"),
 		Description: i18n.G("authentication to snapd and the snap store"),
@@ -212,11 +212,11 @@ var helpCategories = []helpCategory{
 	}, {
 		Label:       i18n.G("Snapshots"),
 		Description: i18n.G("archives of snap data"),
-		Commands:    []string{"saved", "save", "check-snapshot", "restore", "forget"},
+		Commands:    []string{"saved", "save", "check-snapshot", "restore", "forget", "export-snapshot", "import-snapshot"},
 	}, {
 		Label:       i18n.G("Other"),
 		Description: i18n.G("miscellanea"),
-		Commands:    []string{"version", "warnings", "okay", "ack", "known", "model", "create-cohort"},
+		Commands:    []string{"version", "warnings", "okay", "ack", "known", "model", "create-cohort", "validate", "recovery", "reboot"},
 	}, {
 		Label:       i18n.G("Development"),
 		Description: i18n.G("developer-oriented features"),
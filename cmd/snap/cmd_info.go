@@ -358,6 +358,17 @@ func (iw *infoWriter) maybePrintInstallDate() {
 	fmt.Fprintf(iw, "refresh-date:\t%s\n", iw.fmtTime(iw.localSnap.InstallDate))
 }
 
+func (iw *infoWriter) maybePrintHold() {
+	if iw.localSnap == nil || iw.localSnap.Hold == nil {
+		return
+	}
+	if iw.localSnap.Hold.IsZero() {
+		fmt.Fprintf(iw, "hold:	%s\n", i18n.G("forever"))
+		return
+	}
+	fmt.Fprintf(iw, "hold:	%s\n", iw.fmtTime(*iw.localSnap.Hold))
+}
+
 func (iw *infoWriter) maybePrintChinfo() {
 	if iw.diskSnap != nil {
 		return
@@ -735,6 +746,7 @@ func (x *infoCmd) Execute([]string) error {
 		iw.maybePrintCohortKey()
 		iw.maybePrintTrackingChannel()
 		iw.maybePrintInstallDate()
+		iw.maybePrintHold()
 		iw.maybePrintChinfo()
 	}
 	w.Flush()
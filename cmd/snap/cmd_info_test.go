@@ -926,6 +926,25 @@ func (infoSuite) TestDescr(c *check.C) {
 	}
 }
 
+func (infoSuite) TestMaybePrintHold(c *check.C) {
+	until := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+	for i, t := range []struct {
+		snap     *client.Snap
+		expected string
+	}{
+		{snap: nil, expected: ""},
+		{snap: &client.Snap{}, expected: ""},
+		{snap: &client.Snap{Hold: &time.Time{}}, expected: "hold:\tforever\n"},
+		{snap: &client.Snap{Hold: &until}, expected: "hold:\t3:04PM\n"},
+	} {
+		var buf flushBuffer
+		iw := snap.NewInfoWriter(&buf)
+		snap.SetupSnap(iw, t.snap, nil, nil)
+		snap.MaybePrintHold(iw)
+		c.Check(buf.String(), check.Equals, t.expected, check.Commentf("%d", i))
+	}
+}
+
 func (infoSuite) TestMaybePrintCohortKey(c *check.C) {
 	type T struct {
 		snap     *client.Snap
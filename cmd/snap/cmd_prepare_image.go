@@ -20,13 +20,18 @@
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/jessevdk/go-flags"
 
+	"github.com/snapcore/snapd/gadget"
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/image"
+	"github.com/snapcore/snapd/osutil"
 )
 
 type cmdPrepareImage struct {
@@ -42,6 +47,8 @@ type cmdPrepareImage struct {
 	// TODO: introduce SnapWithChannel?
 	Snaps      []string `long:"snap" value-name:"<snap>[=<channel>]"`
 	ExtraSnaps []string `long:"extra-snaps" hidden:"yes"` // DEPRECATED
+
+	ImageFile string `long:"image-file" value-name:"<image-file>"`
 }
 
 func init() {
@@ -54,7 +61,10 @@ creating device images.
 For core images it is not invoked directly but usually via
 ubuntu-image.
 
-For preparing classic images it supports a --classic mode`),
+For preparing classic images it supports a --classic mode.
+
+With --image-file, a complete disk image is written to the given file for
+core models, laid out as described by the gadget.`),
 		func() flags.Commander { return &cmdPrepareImage{} },
 		map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
@@ -67,6 +77,8 @@ For preparing classic images it supports a --classic mode`),
 			"extra-snaps": i18n.G("Extra snaps to be installed (DEPRECATED)"),
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"channel": i18n.G("The channel to use"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"image-file": i18n.G("Write a disk image of the prepared core model to the given file"),
 		}, []argDesc{
 			{
 				// TRANSLATORS: This needs to begin with < and end with >
@@ -82,7 +94,17 @@ For preparing classic images it supports a --classic mode`),
 		})
 }
 
-var imagePrepare = image.Prepare
+var (
+	imagePrepare           = image.Prepare
+	gadgetWriteVolumeImage = gadget.WriteVolumeImage
+)
+
+// imageLayoutConstraints are the constraints used to lay out the volume of
+// the disk image, they match the ones used for gadget updates.
+var imageLayoutConstraints = gadget.LayoutConstraints{
+	NonMBRStartOffset: 1 * gadget.SizeMiB,
+	SectorSize:        512,
+}
 
 func (x *cmdPrepareImage) Execute(args []string) error {
 	opts := &image.Options{
@@ -112,6 +134,9 @@ func (x *cmdPrepareImage) Execute(args []string) error {
 	}
 
 	if x.Classic {
+		if x.ImageFile != "" {
+			return fmt.Errorf(i18n.G("cannot write an image file for a classic model"))
+		}
 		opts.Classic = true
 		opts.RootDir = x.Positional.Rootdir
 	} else {
@@ -119,5 +144,100 @@ func (x *cmdPrepareImage) Execute(args []string) error {
 		opts.GadgetUnpackDir = filepath.Join(x.Positional.Rootdir, "gadget")
 	}
 
-	return imagePrepare(opts)
+	if err := imagePrepare(opts); err != nil {
+		return err
+	}
+	if x.ImageFile != "" {
+		return writeImageFile(x.ImageFile, opts.GadgetUnpackDir, opts.RootDir)
+	}
+	return nil
+}
+
+// bootAssetsDirs maps the bootloader of a gadget volume to the directory
+// under <root>/boot holding its files, and to where those files live on the
+// system-boot structure.
+var bootAssetsDirs = map[string]struct{ src, dst string }{
+	"grub":         {"grub", "EFI/ubuntu"},
+	"u-boot":       {"uboot", ""},
+	"android-boot": {"androidboot", ""},
+	"lk":           {"lk", ""},
+}
+
+// copyDirContents copies the entries of srcDir into dstDir, skipping the
+// ones for which skip returns true.
+func copyDirContents(srcDir, dstDir string, skip func(name string) bool) error {
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return err
+	}
+	fis, err := ioutil.ReadDir(srcDir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		if skip != nil && skip(fi.Name()) {
+			continue
+		}
+		if err := osutil.CopySpecialFile(filepath.Join(srcDir, fi.Name()), dstDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeImageFile writes a disk image of the sole volume of the gadget
+// unpacked in gadgetDir. The system-boot structure is populated with the
+// bootloader files of the prepared rootDir, the system-data structure with
+// the rest of its contents.
+func writeImageFile(imageFile, gadgetDir, rootDir string) error {
+	info, err := gadget.ReadInfo(gadgetDir, false)
+	if err != nil {
+		return err
+	}
+	if len(info.Volumes) != 1 {
+		return fmt.Errorf(i18n.G("cannot write an image file for a gadget with %d volumes"), len(info.Volumes))
+	}
+	var lv *gadget.LaidOutVolume
+	var bootloader string
+	for _, vol := range info.Volumes {
+		lv, err = gadget.LayoutVolume(gadgetDir, &vol, imageLayoutConstraints)
+		if err != nil {
+			return err
+		}
+		bootloader = vol.Bootloader
+	}
+	bootDirs, hasBootDirs := bootAssetsDirs[bootloader]
+
+	populateStructure := func(stageDir string, ps *gadget.LaidOutStructure) error {
+		switch ps.EffectiveRole() {
+		case gadget.SystemBoot:
+			if !hasBootDirs {
+				return nil
+			}
+			src := filepath.Join(rootDir, "boot", bootDirs.src)
+			if !osutil.IsDirectory(src) {
+				return nil
+			}
+			return copyDirContents(src, filepath.Join(stageDir, bootDirs.dst), nil)
+		case gadget.SystemData:
+			// the writable partition of core devices carries the
+			// image tree under system-data, minus the bootloader
+			// files which live on system-boot
+			dst := filepath.Join(stageDir, "system-data")
+			skipBoot := func(name string) bool { return name == "boot" }
+			if err := copyDirContents(rootDir, dst, skipBoot); err != nil {
+				return err
+			}
+			bootDir := filepath.Join(rootDir, "boot")
+			if !osutil.IsDirectory(bootDir) {
+				return nil
+			}
+			skipBootloader := func(name string) bool { return hasBootDirs && name == bootDirs.src }
+			return copyDirContents(bootDir, filepath.Join(dst, "boot"), skipBootloader)
+		}
+		return nil
+	}
+	if err := gadgetWriteVolumeImage(lv, imageFile, populateStructure); err != nil {
+		return fmt.Errorf(i18n.G("cannot write image file: %v"), err)
+	}
+	return nil
 }
@@ -20,10 +20,17 @@
 package main_test
 
 import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
 	. "gopkg.in/check.v1"
 
 	snap "github.com/snapcore/snapd/cmd/snap"
+	"github.com/snapcore/snapd/gadget"
 	"github.com/snapcore/snapd/image"
+	"github.com/snapcore/snapd/testutil"
 )
 
 type SnapPrepareImageSuite struct {
@@ -118,3 +125,92 @@ func (s *SnapPrepareImageSuite) TestPrepareImageExtraSnaps(c *C) {
 		SnapChannels:    map[string]string{"bar": "t/edge"},
 	})
 }
+
+var prepareImageGadgetYaml = `
+volumes:
+  pc:
+    bootloader: grub
+    structure:
+      - name: ubuntu-boot
+        role: system-boot
+        type: EF,C12A7328-F81F-11D2-BA4B-00A0C93EC93B
+        filesystem: vfat
+        size: 5M
+      - name: ubuntu-data
+        role: system-data
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        filesystem: ext4
+        size: 10M
+`
+
+func (s *SnapPrepareImageSuite) TestPrepareImageImageFile(c *C) {
+	rootDir := filepath.Join(c.MkDir(), "root-dir")
+	prep := func(o *image.Options) error {
+		c.Assert(os.MkdirAll(filepath.Join(o.GadgetUnpackDir, "meta"), 0755), IsNil)
+		c.Assert(ioutil.WriteFile(filepath.Join(o.GadgetUnpackDir, "meta/gadget.yaml"), []byte(prepareImageGadgetYaml), 0644), IsNil)
+		c.Assert(os.MkdirAll(filepath.Join(o.RootDir, "var/lib/snapd/seed"), 0755), IsNil)
+		c.Assert(ioutil.WriteFile(filepath.Join(o.RootDir, "var/lib/snapd/seed/seed.yaml"), []byte("seed"), 0644), IsNil)
+		c.Assert(os.MkdirAll(filepath.Join(o.RootDir, "boot/grub"), 0755), IsNil)
+		c.Assert(ioutil.WriteFile(filepath.Join(o.RootDir, "boot/grub/grubenv"), []byte("grubenv"), 0644), IsNil)
+		return nil
+	}
+	r := snap.MockImagePrepare(prep)
+	defer r()
+
+	bootStageDir := c.MkDir()
+	dataStageDir := c.MkDir()
+	written := 0
+	r = snap.MockGadgetWriteVolumeImage(func(lv *gadget.LaidOutVolume, outPath string, postStage gadget.PostStageFunc) error {
+		written++
+		c.Check(outPath, Equals, "pc.img")
+		c.Check(lv.RootDir, Equals, filepath.Join(rootDir, "gadget"))
+		c.Check(lv.SectorSize, Equals, gadget.Size(512))
+		c.Assert(lv.LaidOutStructure, HasLen, 2)
+		boot := &lv.LaidOutStructure[0]
+		c.Check(boot.StartOffset, Equals, 1*gadget.SizeMiB)
+		// the bootloader files end up in system-boot
+		c.Assert(postStage(bootStageDir, boot), IsNil)
+		data := &lv.LaidOutStructure[1]
+		c.Check(data.StartOffset, Equals, 6*gadget.SizeMiB)
+		// the rest of the prepared image tree ends up in system-data
+		c.Assert(postStage(dataStageDir, data), IsNil)
+		return nil
+	})
+	defer r()
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"prepare-image", "--image-file", "pc.img", "model", rootDir})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+	c.Check(written, Equals, 1)
+	c.Check(filepath.Join(bootStageDir, "EFI/ubuntu/grubenv"), testutil.FileEquals, "grubenv")
+	c.Check(filepath.Join(bootStageDir, "system-data"), testutil.FileAbsent)
+	c.Check(filepath.Join(dataStageDir, "system-data/var/lib/snapd/seed/seed.yaml"), testutil.FileEquals, "seed")
+	c.Check(filepath.Join(dataStageDir, "system-data/boot/grub"), testutil.FileAbsent)
+}
+
+func (s *SnapPrepareImageSuite) TestPrepareImageImageFileError(c *C) {
+	prep := func(o *image.Options) error {
+		c.Assert(os.MkdirAll(filepath.Join(o.GadgetUnpackDir, "meta"), 0755), IsNil)
+		return ioutil.WriteFile(filepath.Join(o.GadgetUnpackDir, "meta/gadget.yaml"), []byte(prepareImageGadgetYaml), 0644)
+	}
+	r := snap.MockImagePrepare(prep)
+	defer r()
+	r = snap.MockGadgetWriteVolumeImage(func(lv *gadget.LaidOutVolume, outPath string, postStage gadget.PostStageFunc) error {
+		return errors.New("boom")
+	})
+	defer r()
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"prepare-image", "--image-file", "pc.img", "model", c.MkDir()})
+	c.Assert(err, ErrorMatches, "cannot write image file: boom")
+}
+
+func (s *SnapPrepareImageSuite) TestPrepareImageImageFileClassic(c *C) {
+	r := snap.MockImagePrepare(func(o *image.Options) error {
+		c.Fatalf("unexpected call")
+		return nil
+	})
+	defer r()
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"prepare-image", "--classic", "--image-file", "pc.img", "model", "root-dir"})
+	c.Assert(err, ErrorMatches, "cannot write an image file for a classic model")
+}
@@ -0,0 +1,281 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/strutil"
+)
+
+var shortSetQuotaHelp = i18n.G("Create or update a quota group")
+var longSetQuotaHelp = i18n.G(`
+The set-quota command creates or updates a quota group with the given
+resource limits and adds the given snaps to it. The services of the snaps in
+a quota group share the resource limits of the group, and are restarted if
+they are running when the snap is added to the group.
+
+The memory limit is given as a size, e.g. 512MB. The CPU limit is given as a
+percentage of the time of a single CPU, e.g. 50%, and can be over 100% on
+systems with more than one CPU. The thread limit is the maximum number of
+threads the services of the snaps in the group can have together.
+
+When updating an existing group, only the given limits are changed and the
+given snaps are added to the ones already in it.
+`)
+
+var shortRemoveQuotaHelp = i18n.G("Remove a quota group")
+var longRemoveQuotaHelp = i18n.G(`
+The remove-quota command removes the given quota group. The services of the
+snaps in the group are no longer limited by it, and are restarted if they are
+running.
+`)
+
+var shortQuotaHelp = i18n.G("Show quota group usage and limits")
+var longQuotaHelp = i18n.G(`
+The quota command shows the resource limits and the current usage of the
+given quota group, and the snaps in it.
+`)
+
+var shortQuotasHelp = i18n.G("List quota groups")
+var longQuotasHelp = i18n.G(`
+The quotas command lists the quota groups and their resource limits.
+`)
+
+type cmdSetQuota struct {
+	waitMixin
+
+	MemoryMax  string `long:"memory" optional:"true"`
+	CPUMax     string `long:"cpu" optional:"true"`
+	ThreadsMax string `long:"threads" optional:"true"`
+
+	Positional struct {
+		GroupName string              `positional-arg-name:"<group-name>" required:"true"`
+		Snaps     []installedSnapName `positional-arg-name:"<snap>" optional:"true"`
+	} `positional-args:"yes"`
+}
+
+type cmdRemoveQuota struct {
+	waitMixin
+
+	Positional struct {
+		GroupName string `positional-arg-name:"<group-name>" required:"true"`
+	} `positional-args:"yes"`
+}
+
+type cmdQuota struct {
+	clientMixin
+
+	Positional struct {
+		GroupName string `positional-arg-name:"<group-name>" required:"true"`
+	} `positional-args:"yes"`
+}
+
+type cmdQuotas struct {
+	clientMixin
+}
+
+func init() {
+	addCommand("set-quota", shortSetQuotaHelp, longSetQuotaHelp, func() flags.Commander { return &cmdSetQuota{} }, waitDescs.also(map[string]string{
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"memory": i18n.G("Memory limit for the quota group, e.g. 512MB"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"cpu": i18n.G("CPU limit for the quota group as a percentage of a single CPU, e.g. 50%"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"threads": i18n.G("Thread limit for the quota group"),
+	}), []argDesc{{
+		// TRANSLATORS: This needs to begin with < and end with >
+		name: i18n.G("<group-name>"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		desc: i18n.G("The quota group to create or update"),
+	}, {
+		// TRANSLATORS: This needs to begin with < and end with >
+		name: i18n.G("<snap>"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		desc: i18n.G("Snaps to add to the quota group"),
+	}})
+	addCommand("remove-quota", shortRemoveQuotaHelp, longRemoveQuotaHelp, func() flags.Commander { return &cmdRemoveQuota{} }, waitDescs, []argDesc{{
+		// TRANSLATORS: This needs to begin with < and end with >
+		name: i18n.G("<group-name>"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		desc: i18n.G("The quota group to remove"),
+	}})
+	addCommand("quota", shortQuotaHelp, longQuotaHelp, func() flags.Commander { return &cmdQuota{} }, nil, []argDesc{{
+		// TRANSLATORS: This needs to begin with < and end with >
+		name: i18n.G("<group-name>"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		desc: i18n.G("The quota group to show"),
+	}})
+	addCommand("quotas", shortQuotasHelp, longQuotasHelp, func() flags.Commander { return &cmdQuotas{} }, nil, nil)
+}
+
+func parseCPULimit(s string) (int, error) {
+	cpu, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+	if err != nil || cpu <= 0 {
+		return 0, fmt.Errorf(i18n.G("cannot parse cpu limit %q: must be a positive percentage"), s)
+	}
+	return cpu, nil
+}
+
+func (x *cmdSetQuota) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	var values client.QuotaValues
+	if x.MemoryMax != "" {
+		mem, err := strutil.ParseByteSize(x.MemoryMax)
+		if err != nil {
+			return fmt.Errorf(i18n.G("cannot parse memory limit %q: %v"), x.MemoryMax, err)
+		}
+		values.MaxMemory = mem
+	}
+	if x.CPUMax != "" {
+		cpu, err := parseCPULimit(x.CPUMax)
+		if err != nil {
+			return err
+		}
+		values.CPU = cpu
+	}
+	if x.ThreadsMax != "" {
+		threads, err := strconv.Atoi(x.ThreadsMax)
+		if err != nil || threads <= 0 {
+			return fmt.Errorf(i18n.G("cannot parse thread limit %q: must be a positive number"), x.ThreadsMax)
+		}
+		values.Threads = threads
+	}
+
+	snaps := installedSnapNames(x.Positional.Snaps)
+	changeID, err := x.client.EnsureQuota(x.Positional.GroupName, snaps, &values)
+	if err != nil {
+		return err
+	}
+	if _, err := x.wait(changeID); err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (x *cmdRemoveQuota) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	changeID, err := x.client.RemoveQuota(x.Positional.GroupName)
+	if err != nil {
+		return err
+	}
+	if _, err := x.wait(changeID); err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (x *cmdQuota) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	grp, err := x.client.GetQuotaGroup(x.Positional.GroupName)
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	fmt.Fprintf(w, "name:\t%s\n", grp.GroupName)
+	if grp.MaxMemory != 0 || grp.CPU != 0 || grp.Threads != 0 {
+		fmt.Fprintf(w, "constraints:\n")
+		if grp.MaxMemory != 0 {
+			fmt.Fprintf(w, "  memory:\t%s\n", strutil.SizeToStr(grp.MaxMemory))
+		}
+		if grp.CPU != 0 {
+			fmt.Fprintf(w, "  cpu:\t%d%%\n", grp.CPU)
+		}
+		if grp.Threads != 0 {
+			fmt.Fprintf(w, "  threads:\t%d\n", grp.Threads)
+		}
+	}
+	if grp.MaxMemory != 0 || grp.Threads != 0 {
+		fmt.Fprintf(w, "current:\n")
+		if grp.MaxMemory != 0 {
+			fmt.Fprintf(w, "  memory:\t%s\n", strutil.SizeToStr(int64(grp.CurrentMemory)))
+		}
+		if grp.Threads != 0 {
+			fmt.Fprintf(w, "  threads:\t%d\n", grp.CurrentThreads)
+		}
+	}
+	if len(grp.Snaps) > 0 {
+		fmt.Fprintf(w, "snaps:\n")
+		for _, snapName := range grp.Snaps {
+			fmt.Fprintf(w, "  - %s\n", snapName)
+		}
+	}
+	return nil
+}
+
+func (x *cmdQuotas) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	grps, err := x.client.Quotas()
+	if err != nil {
+		return err
+	}
+	if len(grps) == 0 {
+		fmt.Fprintln(Stderr, i18n.G("No quota groups defined."))
+		return nil
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+		i18n.G("Quota"),
+		i18n.G("Memory"),
+		i18n.G("CPU"),
+		i18n.G("Threads"),
+	)
+	for _, grp := range grps {
+		memory, cpu, threads := "-", "-", "-"
+		if grp.MaxMemory != 0 {
+			memory = strutil.SizeToStr(grp.MaxMemory)
+		}
+		if grp.CPU != 0 {
+			cpu = fmt.Sprintf("%d%%", grp.CPU)
+		}
+		if grp.Threads != 0 {
+			threads = strconv.Itoa(grp.Threads)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", grp.GroupName, memory, cpu, threads)
+	}
+	return nil
+}
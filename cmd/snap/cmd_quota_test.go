@@ -0,0 +1,176 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	main "github.com/snapcore/snapd/cmd/snap"
+)
+
+func (s *SnapSuite) mockQuotaPost(c *check.C, expectedBody map[string]interface{}) *int {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/quotas":
+			n++
+			c.Check(r.Method, check.Equals, "POST")
+			var body map[string]interface{}
+			c.Assert(json.NewDecoder(r.Body).Decode(&body), check.IsNil)
+			c.Check(body, check.DeepEquals, expectedBody)
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type": "async", "status-code": 202, "change": "42"}`)
+		case "/v2/changes/42":
+			c.Check(r.Method, check.Equals, "GET")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done", "data": {}}}`)
+		default:
+			c.Errorf("unexpected path %q", r.URL.Path)
+		}
+	})
+	return &n
+}
+
+func (s *SnapSuite) TestSetQuota(c *check.C) {
+	n := s.mockQuotaPost(c, map[string]interface{}{
+		"action":     "ensure",
+		"group-name": "foo",
+		"snaps":      []interface{}{"snap-a", "snap-b"},
+		"max-memory": float64(512 * 1000 * 1000),
+		"cpu":        float64(50),
+		"threads":    float64(64),
+	})
+
+	rest, err := main.Parser(main.Client()).ParseArgs([]string{"set-quota", "foo", "--memory=512MB", "--cpu=50%", "--threads=64", "snap-a", "snap-b"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(*n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestSetQuotaOnlyCPU(c *check.C) {
+	n := s.mockQuotaPost(c, map[string]interface{}{
+		"action":     "ensure",
+		"group-name": "foo",
+		"cpu":        float64(150),
+	})
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"set-quota", "foo", "--cpu=150"})
+	c.Assert(err, check.IsNil)
+	c.Check(*n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestSetQuotaInvalid(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request")
+	})
+
+	for _, t := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"set-quota", "foo", "--memory=lots"}, `cannot parse memory limit "lots": .*`},
+		{[]string{"set-quota", "foo", "--cpu=half"}, `cannot parse cpu limit "half": must be a positive percentage`},
+		{[]string{"set-quota", "foo", "--cpu=0%"}, `cannot parse cpu limit "0%": must be a positive percentage`},
+		{[]string{"set-quota", "foo", "--threads=-1"}, `cannot parse thread limit "-1": must be a positive number`},
+		{[]string{"set-quota"}, `the required argument .* was not provided`},
+	} {
+		_, err := main.Parser(main.Client()).ParseArgs(t.args)
+		c.Check(err, check.ErrorMatches, t.err, check.Commentf("%v", t.args))
+	}
+}
+
+func (s *SnapSuite) TestRemoveQuota(c *check.C) {
+	n := s.mockQuotaPost(c, map[string]interface{}{
+		"action":     "remove",
+		"group-name": "foo",
+	})
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"remove-quota", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(*n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestQuota(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/quotas/foo")
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": {
+			"group-name": "foo",
+			"snaps": ["snap-a", "snap-b"],
+			"max-memory": 512000000,
+			"cpu": 50,
+			"threads": 64,
+			"current-memory": 1500000,
+			"current-threads": 12
+		}}`)
+	})
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"quota", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, `name:  foo
+constraints:
+  memory:   512MB
+  cpu:      50%
+  threads:  64
+current:
+  memory:   1MB
+  threads:  12
+snaps:
+  - snap-a
+  - snap-b
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *SnapSuite) TestQuotas(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/quotas")
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": [
+			{"group-name": "bar", "snaps": ["snap-c"], "threads": 32},
+			{"group-name": "foo", "snaps": ["snap-a"], "max-memory": 512000000, "cpu": 50}
+		]}`)
+	})
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"quotas"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, `Quota  Memory  CPU  Threads
+bar    -       -    32
+foo    512MB   50%  -
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *SnapSuite) TestQuotasNone(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": []}`)
+	})
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"quotas"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "No quota groups defined.\n")
+}
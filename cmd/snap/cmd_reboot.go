@@ -0,0 +1,84 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+)
+
+var shortRebootHelp = i18n.G("Reboot the device, resetting it to its factory state")
+var longRebootHelp = i18n.G(`
+The reboot command with --factory-reset stops and unmounts the snaps that are
+not needed to boot the device, and reboots it. On the next boot all the
+writable data of the device is wiped: installed snaps, their data, snapshots
+and the system state. The device is then seeded again from its original seed,
+as if it was booted for the first time.
+
+With --keep-serial, the serial assertion and the device key are kept across
+the reset, so the device keeps its identity without registering again.
+`)
+
+type cmdReboot struct {
+	waitMixin
+
+	FactoryReset bool `long:"factory-reset"`
+	KeepSerial   bool `long:"keep-serial"`
+}
+
+func init() {
+	addCommand("reboot", shortRebootHelp, longRebootHelp, func() flags.Commander { return &cmdReboot{} },
+		waitDescs.also(map[string]string{
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"factory-reset": i18n.G("Wipe all writable data and seed the device again on reboot"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"keep-serial": i18n.G("Keep the serial assertion and device key across the factory reset"),
+		}), nil)
+}
+
+func (x *cmdReboot) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	if !x.FactoryReset {
+		return fmt.Errorf(i18n.G("the reboot command currently requires --factory-reset"))
+	}
+
+	opts := &client.FactoryResetOptions{KeepSerial: x.KeepSerial}
+	changeID, err := x.client.FactoryReset(opts)
+	if err != nil {
+		return err
+	}
+	if _, err := x.wait(changeID); err != nil {
+		if err == noWait {
+			return nil
+		}
+		// the device is already going down
+		if e, ok := err.(*client.Error); !ok || e.Kind != client.ErrorKindSystemRestart {
+			return err
+		}
+	}
+	fmt.Fprintln(Stdout, i18n.G("Rebooting to reset the device to its factory state"))
+	return nil
+}
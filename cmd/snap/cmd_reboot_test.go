@@ -0,0 +1,118 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	main "github.com/snapcore/snapd/cmd/snap"
+)
+
+func (s *SnapSuite) TestRebootFactoryReset(c *check.C) {
+	for _, t := range []struct {
+		args     []string
+		expected map[string]interface{}
+	}{
+		{[]string{"reboot", "--factory-reset"}, map[string]interface{}{"action": "factory-reset"}},
+		{[]string{"reboot", "--factory-reset", "--keep-serial"}, map[string]interface{}{"action": "factory-reset", "keep-serial": true}},
+	} {
+		s.ResetStdStreams()
+		n := 0
+		s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v2/systems":
+				n++
+				c.Check(r.Method, check.Equals, "POST")
+				var body map[string]interface{}
+				c.Check(json.NewDecoder(r.Body).Decode(&body), check.IsNil)
+				c.Check(body, check.DeepEquals, t.expected)
+				w.WriteHeader(202)
+				fmt.Fprintln(w, `{"type": "async", "status-code": 202, "change": "42"}`)
+			case "/v2/changes/42":
+				c.Check(r.Method, check.Equals, "GET")
+				fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done", "data": {}}}`)
+			default:
+				c.Errorf("unexpected path %q", r.URL.Path)
+			}
+		})
+
+		rest, err := main.Parser(main.Client()).ParseArgs(t.args)
+		c.Assert(err, check.IsNil)
+		c.Check(rest, check.HasLen, 0)
+		c.Check(s.Stdout(), check.Equals, "Rebooting to reset the device to its factory state\n")
+		c.Check(s.Stderr(), check.Equals, "")
+		c.Check(n, check.Equals, 1)
+	}
+}
+
+func (s *SnapSuite) TestRebootFactoryResetRestarting(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/systems":
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type": "async", "status-code": 202, "change": "42"}`)
+		case "/v2/changes/42":
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": false, "status": "Doing", "data": {}}, "maintenance": {"kind": "system-restart", "message": "system is restarting"}}`)
+		default:
+			c.Errorf("unexpected path %q", r.URL.Path)
+		}
+	})
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"reboot", "--factory-reset"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "Rebooting to reset the device to its factory state\n")
+}
+
+func (s *SnapSuite) TestRebootFactoryResetNoWait(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v2/systems")
+		w.WriteHeader(202)
+		fmt.Fprintln(w, `{"type": "async", "status-code": 202, "change": "42"}`)
+	})
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"reboot", "--factory-reset", "--no-wait"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "42\n")
+}
+
+func (s *SnapSuite) TestRebootFactoryResetError(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(409)
+		fmt.Fprintln(w, `{"type": "error", "status-code": 409, "result": {"message": "cannot factory reset while other changes are in progress"}}`)
+	})
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"reboot", "--factory-reset"})
+	c.Assert(err, check.ErrorMatches, "cannot factory reset: cannot factory reset while other changes are in progress")
+}
+
+func (s *SnapSuite) TestRebootErrors(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request")
+	})
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"reboot"})
+	c.Check(err, check.ErrorMatches, "the reboot command currently requires --factory-reset")
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"reboot", "--factory-reset", "extra"})
+	c.Check(err, check.ErrorMatches, "too many arguments for command")
+}
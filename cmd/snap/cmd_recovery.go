@@ -0,0 +1,165 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/i18n"
+)
+
+var shortRecoveryHelp = i18n.G("List, create or boot into recovery systems")
+var longRecoveryHelp = i18n.G(`
+The recovery command lists the recovery systems available on the device.
+
+With --create, a new recovery system with the given label is created out of
+the snaps currently installed on the device.
+
+With --install, --recover or --run, the device is rebooted into the recovery
+system with the given label, in the corresponding mode: install reinstalls
+the device from the recovery system, recover boots into the recovery system
+to repair the device, and run boots the installed system.
+`)
+
+type cmdRecovery struct {
+	waitMixin
+
+	Create  bool `long:"create"`
+	Install bool `long:"install"`
+	Recover bool `long:"recover"`
+	Run     bool `long:"run"`
+
+	Positional struct {
+		Label string `positional-arg-name:"<label>"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	addCommand("recovery", shortRecoveryHelp, longRecoveryHelp, func() flags.Commander { return &cmdRecovery{} },
+		waitDescs.also(map[string]string{
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"create": i18n.G("Create a recovery system with the given label"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"install": i18n.G("Reboot into the given recovery system to reinstall the device"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"recover": i18n.G("Reboot into the given recovery system to repair the device"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"run": i18n.G("Reboot into the installed system"),
+		}), []argDesc{{
+			// TRANSLATORS: This needs to begin with < and end with >
+			name: i18n.G("<label>"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			desc: i18n.G("The label of the recovery system"),
+		}})
+}
+
+func (x *cmdRecovery) mode() (mode string, err error) {
+	for _, m := range []struct {
+		set  bool
+		mode string
+	}{{x.Install, "install"}, {x.Recover, "recover"}, {x.Run, "run"}} {
+		if !m.set {
+			continue
+		}
+		if mode != "" {
+			return "", fmt.Errorf(i18n.G("cannot use --%s and --%s together"), mode, m.mode)
+		}
+		mode = m.mode
+	}
+	return mode, nil
+}
+
+func (x *cmdRecovery) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	mode, err := x.mode()
+	if err != nil {
+		return err
+	}
+	label := x.Positional.Label
+
+	switch {
+	case x.Create && mode != "":
+		return fmt.Errorf(i18n.G("cannot use --create and --%s together"), mode)
+	case x.Create:
+		return x.createRecoverySystem(label)
+	case mode != "":
+		return x.doSystemAction(label, mode)
+	case label != "":
+		return fmt.Errorf(i18n.G("a recovery system label can only be given with --create, --install, --recover or --run"))
+	}
+	return x.listSystems()
+}
+
+func (x *cmdRecovery) listSystems() error {
+	systems, err := x.client.ListSystems()
+	if err != nil {
+		return err
+	}
+	if len(systems) == 0 {
+		fmt.Fprintln(Stderr, i18n.G("No recovery systems found."))
+		return nil
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	fmt.Fprintln(w, i18n.G("Label\tBrand\tModel\tNotes"))
+	for _, system := range systems {
+		notes := "-"
+		if system.Model.DisplayName != "" {
+			notes = system.Model.DisplayName
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", system.Label, system.Model.BrandID, system.Model.Model, notes)
+	}
+	return nil
+}
+
+func (x *cmdRecovery) createRecoverySystem(label string) error {
+	if label == "" {
+		return fmt.Errorf(i18n.G("the label of the recovery system to create must be given"))
+	}
+	changeID, err := x.client.CreateRecoverySystem(label)
+	if err != nil {
+		return err
+	}
+	if _, err := x.wait(changeID); err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+	fmt.Fprintf(Stdout, i18n.G("Recovery system %q created\n"), label)
+	return nil
+}
+
+func (x *cmdRecovery) doSystemAction(label, mode string) error {
+	if label == "" {
+		return fmt.Errorf(i18n.G("the label of the recovery system to reboot into must be given"))
+	}
+	if err := x.client.DoSystemAction(label, mode); err != nil {
+		return err
+	}
+	fmt.Fprintf(Stdout, i18n.G("Rebooting into recovery system %q in %s mode\n"), label, mode)
+	return nil
+}
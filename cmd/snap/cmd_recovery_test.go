@@ -0,0 +1,137 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	main "github.com/snapcore/snapd/cmd/snap"
+)
+
+func (s *SnapSuite) TestRecoveryList(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/systems")
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": [
+			{"label": "20191119", "model": {"model": "my-model", "brand-id": "my-brand", "display-name": "My Model"}},
+			{"label": "20191120", "model": {"model": "other-model", "brand-id": "my-brand"}}
+		]}`)
+	})
+
+	rest, err := main.Parser(main.Client()).ParseArgs([]string{"recovery"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+Label     Brand     Model        Notes
+20191119  my-brand  my-model     My Model
+20191120  my-brand  other-model  -
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestRecoveryListNone(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": []}`)
+	})
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"recovery"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "No recovery systems found.\n")
+}
+
+func (s *SnapSuite) TestRecoveryCreate(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "POST")
+			c.Check(r.URL.Path, check.Equals, "/v2/systems")
+			var body map[string]interface{}
+			c.Assert(json.NewDecoder(r.Body).Decode(&body), check.IsNil)
+			c.Check(body, check.DeepEquals, map[string]interface{}{
+				"action": "create",
+				"label":  "20191119",
+			})
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type": "async", "change": "42", "status-code": 202}`)
+		case 1:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done"}}`)
+		default:
+			c.Fatalf("expected to get 2 requests, now on %d", n+1)
+		}
+		n++
+	})
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"recovery", "--create", "20191119"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "Recovery system \"20191119\" created\n")
+	c.Check(n, check.Equals, 2)
+}
+
+func (s *SnapSuite) TestRecoveryReboot(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v2/systems/20191119")
+		var body map[string]interface{}
+		c.Assert(json.NewDecoder(r.Body).Decode(&body), check.IsNil)
+		c.Check(body, check.DeepEquals, map[string]interface{}{
+			"action": "do",
+			"mode":   "recover",
+		})
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": null}`)
+	})
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"recovery", "--recover", "20191119"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "Rebooting into recovery system \"20191119\" in recover mode\n")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestRecoveryInvalid(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request")
+	})
+
+	for _, t := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"recovery", "--create"}, "the label of the recovery system to create must be given"},
+		{[]string{"recovery", "--install"}, "the label of the recovery system to reboot into must be given"},
+		{[]string{"recovery", "--install", "--recover", "foo"}, "cannot use --install and --recover together"},
+		{[]string{"recovery", "--create", "--run", "foo"}, "cannot use --create and --run together"},
+		{[]string{"recovery", "foo"}, "a recovery system label can only be given with --create, --install, --recover or --run"},
+	} {
+		_, err := main.Parser(main.Client()).ParseArgs(t.args)
+		c.Check(err, check.ErrorMatches, t.err, check.Commentf("%v", t.args))
+	}
+}
@@ -22,12 +22,14 @@ package main
 import (
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/jessevdk/go-flags"
 
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/cmd"
 	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/snap"
 )
 
 type svcStatus struct {
@@ -41,6 +43,9 @@ type svcLogs struct {
 	clientMixin
 	N          string `short:"n" default:"10"`
 	Follow     bool   `short:"f"`
+	Since      string `long:"since"`
+	Until      string `long:"until"`
+	Priority   string `long:"priority" choice:"emerg" choice:"alert" choice:"crit" choice:"err" choice:"warning" choice:"notice" choice:"info" choice:"debug"`
 	Positional struct {
 		ServiceNames []serviceName `required:"1"`
 	} `positional-args:"yes" required:"yes"`
@@ -56,6 +61,11 @@ the services in all currently installed snaps.
 	longLogsHelp  = i18n.G(`
 The logs command fetches logs of the given services and displays them in
 chronological order.
+
+The --since and --until options accept either a date and time in RFC3339
+format, a date like 2020-09-13, or a duration like 2h30m meaning that long
+ago. The --priority option shows only entries of the given priority or more
+important ones.
 `)
 	shortStartHelp = i18n.G("Start services")
 	longStartHelp  = i18n.G(`
@@ -88,6 +98,12 @@ func init() {
 			"n": i18n.G("Show only the given number of lines, or 'all'."),
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"f": i18n.G("Wait for new lines and print them as they come in."),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"since": i18n.G("Show only entries not older than the given time."),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"until": i18n.G("Show only entries not newer than the given time."),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"priority": i18n.G("Show only entries of the given priority or more important."),
 		}, argdescs)
 
 	addCommand("start", shortStartHelp, longStartHelp, func() flags.Commander { return &svcStart{} },
@@ -141,7 +157,10 @@ func (s *svcStatus) Execute(args []string) error {
 			startup = i18n.G("enabled")
 		}
 		current := i18n.G("inactive")
-		if svc.Active {
+		if svc.DaemonScope == string(snap.UserDaemon) {
+			// user services run in each user session
+			current = "-"
+		} else if svc.Active {
 			current = i18n.G("active")
 		}
 		fmt.Fprintf(w, "%s.%s\t%s\t%s\t%s\n", svc.Snap, svc.Name, startup, current, cmd.ClientAppInfoNotes(svc))
@@ -164,7 +183,23 @@ func (s *svcLogs) Execute(args []string) error {
 		sN = int(n)
 	}
 
-	logs, err := s.client.Logs(svcNames(s.Positional.ServiceNames), client.LogOptions{N: sN, Follow: s.Follow})
+	opts := client.LogOptions{N: sN, Follow: s.Follow, Priority: s.Priority}
+	for _, t := range []struct {
+		flag  string
+		value string
+		out   *time.Time
+	}{{"since", s.Since, &opts.Since}, {"until", s.Until, &opts.Until}} {
+		if t.value == "" {
+			continue
+		}
+		tm, err := parseLogTime(t.value)
+		if err != nil {
+			return fmt.Errorf(i18n.G("invalid argument for flag ‘--%s’: expected a time like 2006-01-02T15:04:05Z07:00, a date like 2006-01-02, or a duration like 2h30m"), t.flag)
+		}
+		*t.out = tm
+	}
+
+	logs, err := s.client.Logs(svcNames(s.Positional.ServiceNames), opts)
 	if err != nil {
 		return err
 	}
@@ -176,6 +211,22 @@ func (s *svcLogs) Execute(args []string) error {
 	return nil
 }
 
+// parseLogTime parses an absolute time in RFC3339 format, a date in
+// local time, or a duration counting back from now.
+func parseLogTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("cannot parse time %q", s)
+	}
+	return timeNow().Add(-d), nil
+}
+
 type svcStart struct {
 	waitMixin
 	Positional struct {
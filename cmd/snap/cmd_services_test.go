@@ -224,6 +224,44 @@ foo.zed  enabled  active    -
 	c.Check(n, check.Equals, 1)
 }
 
+func (s *appOpSuite) TestAppStatusUserDaemon(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.URL.Path, check.Equals, "/v2/apps")
+			c.Check(r.Method, check.Equals, "GET")
+			w.WriteHeader(200)
+			enc := json.NewEncoder(w)
+			enc.Encode(map[string]interface{}{
+				"type": "sync",
+				"result": []map[string]interface{}{
+					{"snap": "foo", "name": "bar", "daemon": "simple",
+						"daemon-scope": "user", "enabled": true,
+					}, {"snap": "foo", "name": "zed", "daemon": "simple",
+						"active": true, "enabled": true,
+					},
+				},
+				"status":      "OK",
+				"status-code": 200,
+			})
+		default:
+			c.Fatalf("expected to get 1 requests, now on %d", n+1)
+		}
+
+		n++
+	})
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"services"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(s.Stdout(), check.Equals, `Service  Startup  Current  Notes
+foo.bar  enabled  -        user
+foo.zed  enabled  active   -
+`)
+	c.Check(n, check.Equals, 1)
+}
+
 func (s *appOpSuite) TestServiceCompletion(c *check.C) {
 	n := 0
 	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
@@ -299,3 +337,45 @@ func (s *appOpSuite) TestAppStatusNoServices(c *check.C) {
 	// ensure that the fake server api was actually hit
 	c.Check(n, check.Equals, 1)
 }
+
+func (s *appOpSuite) TestLogsFilters(c *check.C) {
+	restore := snap.MockTimeNow(func() time.Time {
+		return time.Date(2020, 9, 13, 14, 26, 40, 0, time.UTC)
+	})
+	defer restore()
+
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/logs")
+		q := r.URL.Query()
+		c.Check(q.Get("names"), check.Equals, "foo.svc")
+		c.Check(q.Get("n"), check.Equals, "10")
+		c.Check(q.Get("since"), check.Equals, "2020-09-13T12:26:40Z")
+		c.Check(q.Get("until"), check.Equals, "2020-09-13T13:00:00Z")
+		c.Check(q.Get("priority"), check.Equals, "err")
+		w.Header().Set("Content-Type", "application/json-seq")
+		fmt.Fprintf(w, "\x1e%s\n", `{"timestamp":"2020-09-13T12:30:00Z","message":"oops","sid":"foo.svc","pid":"42"}`)
+		n++
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"logs", "--since=2h", "--until=2020-09-13T13:00:00Z", "--priority=err", "foo.svc"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(n, check.Equals, 1)
+	c.Check(s.Stdout(), check.Equals, "2020-09-13T12:30:00Z foo.svc[42]: oops\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *appOpSuite) TestLogsBadFilters(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request")
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"logs", "--since=yesterday", "foo"})
+	c.Check(err, check.ErrorMatches, `invalid argument for flag ‘--since’: .*`)
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"logs", "--until=-2h", "foo"})
+	c.Check(err, check.ErrorMatches, `invalid argument for flag ‘--until’: .*`)
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"logs", "--priority=loud", "foo"})
+	c.Check(err, check.ErrorMatches, `Invalid value .loud. for option .--priority.*`)
+}
@@ -0,0 +1,77 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/i18n"
+)
+
+var shortSetStoreProxyHelp = i18n.G("Use a snap store proxy as the store")
+var longSetStoreProxyHelp = i18n.G(`
+The set-store-proxy command configures the system to use the snap store proxy
+at the given URL.
+
+The store assertion served by the proxy is fetched and verified and
+connectivity to the store it describes is checked before the system is
+switched to it. If the proxy cannot be reached the previous store
+configuration is kept.
+`)
+
+type cmdSetStoreProxy struct {
+	waitMixin
+	Positional struct {
+		URL string `positional-arg-name:"<url>" required:"1"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func init() {
+	addCommand("set-store-proxy", shortSetStoreProxyHelp, longSetStoreProxyHelp, func() flags.Commander { return &cmdSetStoreProxy{} }, waitDescs, nil)
+}
+
+func (x *cmdSetStoreProxy) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	id, err := x.client.SetStoreProxy(x.Positional.URL)
+	if err != nil {
+		return err
+	}
+
+	chg, err := x.wait(id)
+	if err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+
+	var storeID string
+	if err := chg.Get("store", &storeID); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(Stdout, i18n.G("Store %q served by %s is now in use.\n"), storeID, x.Positional.URL)
+	return nil
+}
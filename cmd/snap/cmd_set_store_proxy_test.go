@@ -0,0 +1,97 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+func (s *SnapSuite) TestSetStoreProxy(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		switch n {
+		case 1:
+			c.Check(r.Method, check.Equals, "POST")
+			c.Check(r.URL.Path, check.Equals, "/v2/store-proxy")
+			var body map[string]interface{}
+			c.Assert(json.NewDecoder(r.Body).Decode(&body), check.IsNil)
+			c.Check(body, check.DeepEquals, map[string]interface{}{
+				"url": "https://proxy.example.com",
+			})
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type": "async", "status-code": 202, "change": "42"}`)
+		case 2:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done", "data": {"store": "proxy-store"}}}`)
+		default:
+			c.Fatalf("unexpected request %d", n)
+		}
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"set-store-proxy", "https://proxy.example.com"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "Store \"proxy-store\" served by https://proxy.example.com is now in use.\n")
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, 2)
+}
+
+func (s *SnapSuite) TestSetStoreProxyNoWait(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.URL.Path, check.Equals, "/v2/store-proxy")
+		w.WriteHeader(202)
+		fmt.Fprintln(w, `{"type": "async", "status-code": 202, "change": "42"}`)
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"set-store-proxy", "--no-wait", "https://proxy.example.com"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "42\n")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestSetStoreProxyNoURL(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		panic("shouldn't be called")
+	})
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"set-store-proxy"})
+	c.Check(err, check.ErrorMatches, "the required argument .* was not provided")
+}
+
+func (s *SnapSuite) TestSetStoreProxyError(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		fmt.Fprintln(w, `{"type": "error", "result": {"message": "cannot set up store proxy: connectivity check failed: cannot reach proxy.example.com", "kind": "store-proxy-unreachable"}, "status-code": 400}`)
+	})
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"set-store-proxy", "https://proxy.example.com"})
+	c.Check(err, check.ErrorMatches, "cannot set up store proxy: connectivity check failed: cannot reach proxy.example.com")
+	c.Check(n, check.Equals, 1)
+}
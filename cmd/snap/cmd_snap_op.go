@@ -36,6 +36,7 @@ import (
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/snap/channel"
+	"github.com/snapcore/snapd/snap/snapbundle"
 	"github.com/snapcore/snapd/strutil"
 )
 
@@ -87,6 +88,13 @@ have developer access to the snap, either directly or through the
 store's collaboration feature, and to be logged in (see 'snap help login').
 
 Note a later refresh will typically undo a revision override.
+
+The --hold option postpones the automatic refreshes of the specified snaps,
+for the given duration (e.g. --hold=72h) or indefinitely, while other snaps
+keep refreshing; if no snaps are specified all automatic refreshes are
+postponed, within the limits of the refresh.hold system option. Refreshes
+that are asked for explicitly are not affected. The --unhold option removes
+the hold.
 `)
 
 var longTryHelp = i18n.G(`
@@ -437,6 +445,7 @@ type cmdInstall struct {
 	ForceDangerous bool `long:"force-dangerous" hidden:"yes"`
 
 	Unaliased bool `long:"unaliased"`
+	NoStart   bool `long:"no-start"`
 
 	Name string `long:"name"`
 
@@ -446,13 +455,19 @@ type cmdInstall struct {
 	} `positional-args:"yes" required:"yes"`
 }
 
+// isLocalSnap returns whether the given name refers to a local snap file or
+// snap bundle, as opposed to a snap in the store.
+func isLocalSnap(nameOrPath string) bool {
+	return strings.Contains(nameOrPath, "/") || strings.HasSuffix(nameOrPath, ".snap") || strings.Contains(nameOrPath, ".snap.") || strings.HasSuffix(nameOrPath, snapbundle.Extension)
+}
+
 func (x *cmdInstall) installOne(nameOrPath, desiredName string, opts *client.SnapOptions) error {
 	var err error
 	var changeID string
 	var snapName string
 	var path string
 
-	if strings.Contains(nameOrPath, "/") || strings.HasSuffix(nameOrPath, ".snap") || strings.Contains(nameOrPath, ".snap.") {
+	if isLocalSnap(nameOrPath) {
 		path = nameOrPath
 		changeID, err = x.client.InstallPath(path, x.Name, opts)
 	} else {
@@ -493,7 +508,7 @@ func (x *cmdInstall) installOne(nameOrPath, desiredName string, opts *client.Sna
 func (x *cmdInstall) installMany(names []string, opts *client.SnapOptions) error {
 	// sanity check
 	for _, name := range names {
-		if strings.Contains(name, "/") || strings.HasSuffix(name, ".snap") || strings.Contains(name, ".snap.") {
+		if isLocalSnap(name) {
 			return fmt.Errorf("only one snap file can be installed at a time")
 		}
 	}
@@ -561,6 +576,7 @@ func (x *cmdInstall) Execute([]string) error {
 		Revision:  x.Revision,
 		Dangerous: dangerous,
 		Unaliased: x.Unaliased,
+		NoStart:   x.NoStart,
 		CohortKey: x.Cohort,
 	}
 	x.setModes(opts)
@@ -586,6 +602,9 @@ func (x *cmdInstall) Execute([]string) error {
 	if x.Name != "" {
 		return errors.New(i18n.G("cannot use instance name when installing multiple snaps"))
 	}
+	if x.NoStart {
+		return errors.New(i18n.G("a single snap name is needed to specify the no-start flag"))
+	}
 	return x.installMany(names, nil)
 }
 
@@ -603,6 +622,8 @@ type cmdRefresh struct {
 	List             bool   `long:"list"`
 	Time             bool   `long:"time"`
 	IgnoreValidation bool   `long:"ignore-validation"`
+	Hold             string `long:"hold" optional:"true" optional-value:"forever" default-mask:"-"`
+	Unhold           bool   `long:"unhold"`
 	Positional       struct {
 		Snaps []installedSnapName `positional-arg-name:"<snap>"`
 	} `positional-args:"yes"`
@@ -734,6 +755,65 @@ func (x *cmdRefresh) listRefresh() error {
 	return nil
 }
 
+func (x *cmdRefresh) holdRefreshes(names []string) error {
+	var until time.Time
+	if x.Hold != "forever" {
+		d, err := time.ParseDuration(x.Hold)
+		if err != nil || d <= 0 {
+			return fmt.Errorf(i18n.G("cannot hold refreshes: invalid duration %q"), x.Hold)
+		}
+		until = timeNow().Add(d)
+	}
+
+	changeID, err := x.client.HoldRefreshes(names, until)
+	if err != nil {
+		return err
+	}
+	if _, err := x.wait(changeID); err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+
+	switch {
+	case len(names) == 0 && until.IsZero():
+		fmt.Fprintf(Stdout, i18n.G("Auto-refresh of all snaps held for as long as allowed (see 'snap refresh --time')\n"))
+	case len(names) == 0:
+		fmt.Fprintf(Stdout, i18n.G("Auto-refresh of all snaps held until %s\n"), x.fmtTime(until))
+	case until.IsZero():
+		// TRANSLATORS: the %s is a comma-separated list of quoted snap names
+		fmt.Fprintf(Stdout, i18n.G("Auto-refresh of %s held indefinitely\n"), strutil.Quoted(names))
+	default:
+		// TRANSLATORS: the first %s is a comma-separated list of quoted snap names
+		fmt.Fprintf(Stdout, i18n.G("Auto-refresh of %s held until %s\n"), strutil.Quoted(names), x.fmtTime(until))
+	}
+
+	return nil
+}
+
+func (x *cmdRefresh) unholdRefreshes(names []string) error {
+	changeID, err := x.client.UnholdRefreshes(names)
+	if err != nil {
+		return err
+	}
+	if _, err := x.wait(changeID); err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+
+	if len(names) == 0 {
+		fmt.Fprintf(Stdout, i18n.G("Auto-refresh of all snaps no longer held\n"))
+	} else {
+		// TRANSLATORS: the %s is a comma-separated list of quoted snap names
+		fmt.Fprintf(Stdout, i18n.G("Auto-refresh of %s no longer held\n"), strutil.Quoted(names))
+	}
+
+	return nil
+}
+
 func (x *cmdRefresh) Execute([]string) error {
 	if err := x.setChannelFromCommandline(); err != nil {
 		return err
@@ -757,6 +837,20 @@ func (x *cmdRefresh) Execute([]string) error {
 		return x.listRefresh()
 	}
 
+	if x.Hold != "" || x.Unhold {
+		if x.Hold != "" && x.Unhold {
+			return errors.New(i18n.G("cannot use --hold and --unhold together"))
+		}
+		if x.asksForMode() || x.asksForChannel() || x.Amend || x.Revision != "" || x.Cohort != "" || x.LeaveCohort || x.IgnoreValidation {
+			return errors.New(i18n.G("--hold and --unhold do not accept other refresh options"))
+		}
+		names := installedSnapNames(x.Positional.Snaps)
+		if x.Unhold {
+			return x.unholdRefreshes(names)
+		}
+		return x.holdRefreshes(names)
+	}
+
 	if len(x.Positional.Snaps) == 0 && os.Getenv("SNAP_REFRESH_FROM_TIMER") == "1" {
 		fmt.Fprintf(Stdout, "Ignoring `snap refresh` from the systemd timer")
 		return nil
@@ -1058,6 +1152,8 @@ func init() {
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"unaliased": i18n.G("Install the given snap without enabling its automatic aliases"),
 			// TRANSLATORS: This should not start with a lowercase letter.
+			"no-start": i18n.G("Do not start the services of the given snap after installing it"),
+			// TRANSLATORS: This should not start with a lowercase letter.
 			"name": i18n.G("Install the snap file under the given instance name"),
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"cohort": i18n.G("Install the snap in the given cohort"),
@@ -1078,6 +1174,10 @@ func init() {
 			"cohort": i18n.G("Refresh the snap into the given cohort"),
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"leave-cohort": i18n.G("Refresh the snap out of its cohort"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"hold": i18n.G("Hold auto-refresh of the snaps for the given duration, or indefinitely"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"unhold": i18n.G("Remove the hold on auto-refresh of the snaps"),
 		}), nil)
 	addCommand("try", shortTryHelp, longTryHelp, func() flags.Commander { return &cmdTry{} }, waitDescs.also(modeDescs), nil)
 	addCommand("enable", shortEnableHelp, longEnableHelp, func() flags.Commander { return &cmdEnable{} }, waitDescs, nil)
@@ -416,6 +416,30 @@ func (s *SnapOpSuite) TestInstallUnaliased(c *check.C) {
 	c.Check(s.srv.n, check.Equals, s.srv.total)
 }
 
+func (s *SnapOpSuite) TestInstallNoStart(c *check.C) {
+	s.srv.checker = func(r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v2/snaps/foo")
+		c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+			"action":   "install",
+			"no-start": true,
+		})
+	}
+
+	s.RedirectClientToTestServer(s.srv.handle)
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"install", "--no-start", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Matches, `(?sm).*foo 1.0 from Bar installed`)
+	c.Check(s.Stderr(), check.Equals, "")
+	// ensure that the fake server api was actually hit
+	c.Check(s.srv.n, check.Equals, s.srv.total)
+}
+
+func (s *SnapOpSuite) TestInstallManyNoStart(c *check.C) {
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"install", "--no-start", "foo", "bar"})
+	c.Assert(err, check.ErrorMatches, `a single snap name is needed to specify the no-start flag`)
+}
+
 func (s *SnapOpSuite) TestInstallSnapNotFound(c *check.C) {
 	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintln(w, `{"type": "error", "result": {"message": "snap not found", "value": "foo", "kind": "snap-not-found"}, "status-code": 404}`)
@@ -787,6 +811,40 @@ func (s *SnapOpSuite) TestInstallPath(c *check.C) {
 	c.Check(s.srv.n, check.Equals, s.srv.total)
 }
 
+func (s *SnapOpSuite) TestInstallPathBundle(c *check.C) {
+	s.srv.checker = func(r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v2/snaps")
+
+		form := testForm(r, c)
+		defer form.RemoveAll()
+
+		c.Check(form.Value["action"], check.DeepEquals, []string{"install"})
+		c.Check(form.Value["snap-path"], check.NotNil)
+
+		name, filename, body := formFile(form, c)
+		c.Check(name, check.Equals, "snap")
+		c.Check(filename, check.Equals, "foo_1.bundle")
+		c.Check(string(body), check.Equals, "bundle-data")
+	}
+
+	s.RedirectClientToTestServer(s.srv.handle)
+	// no path separator, recognized by its extension
+	wd, err := os.Getwd()
+	c.Assert(err, check.IsNil)
+	defer os.Chdir(wd)
+	c.Assert(os.Chdir(c.MkDir()), check.IsNil)
+	err = ioutil.WriteFile("foo_1.bundle", []byte("bundle-data"), 0644)
+	c.Assert(err, check.IsNil)
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"install", "foo_1.bundle"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Matches, `(?sm).*foo 1.0 from Bar installed`)
+	c.Check(s.Stderr(), check.Equals, "")
+	// ensure that the fake server api was actually hit
+	c.Check(s.srv.n, check.Equals, s.srv.total)
+}
+
 func (s *SnapOpSuite) TestInstallPathDevMode(c *check.C) {
 	s.srv.checker = func(r *http.Request) {
 		c.Check(r.URL.Path, check.Equals, "/v2/snaps")
@@ -1337,6 +1395,96 @@ func (s *SnapOpSuite) TestRefreshAllModeFlags(c *check.C) {
 	c.Assert(err, check.ErrorMatches, `a single snap name is needed to specify mode or channel flags`)
 }
 
+func (s *SnapOpSuite) TestRefreshHold(c *check.C) {
+	now := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	defer snap.MockTimeNow(func() time.Time { return now })()
+
+	s.srv.total = 3
+	s.srv.checker = func(r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v2/snaps")
+		c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+			"action":     "hold",
+			"snaps":      []interface{}{"one", "two"},
+			"hold-until": "2030-01-05T03:04:05Z",
+		})
+	}
+
+	s.RedirectClientToTestServer(s.srv.handle)
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"refresh", "--abs-time", "--hold=72h", "one", "two"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Equals, "Auto-refresh of \"one\", \"two\" held until 2030-01-05T03:04:05Z\n")
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(s.srv.n, check.Equals, s.srv.total)
+}
+
+func (s *SnapOpSuite) TestRefreshHoldForever(c *check.C) {
+	s.srv.total = 3
+	s.srv.checker = func(r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v2/snaps")
+		c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+			"action": "hold",
+			"snaps":  []interface{}{"one"},
+		})
+	}
+
+	s.RedirectClientToTestServer(s.srv.handle)
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"refresh", "--hold", "one"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "Auto-refresh of \"one\" held indefinitely\n")
+	c.Check(s.srv.n, check.Equals, s.srv.total)
+}
+
+func (s *SnapOpSuite) TestRefreshHoldAll(c *check.C) {
+	s.srv.total = 3
+	s.srv.checker = func(r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v2/snaps")
+		c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+			"action": "hold",
+		})
+	}
+
+	s.RedirectClientToTestServer(s.srv.handle)
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"refresh", "--hold"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "Auto-refresh of all snaps held for as long as allowed (see 'snap refresh --time')\n")
+	c.Check(s.srv.n, check.Equals, s.srv.total)
+}
+
+func (s *SnapOpSuite) TestRefreshUnhold(c *check.C) {
+	s.srv.total = 3
+	s.srv.checker = func(r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v2/snaps")
+		c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+			"action": "unhold",
+			"snaps":  []interface{}{"one"},
+		})
+	}
+
+	s.RedirectClientToTestServer(s.srv.handle)
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"refresh", "--unhold", "one"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "Auto-refresh of \"one\" no longer held\n")
+	c.Check(s.srv.n, check.Equals, s.srv.total)
+}
+
+func (s *SnapOpSuite) TestRefreshHoldErrors(c *check.C) {
+	s.RedirectClientToTestServer(nil)
+	for _, t := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"refresh", "--hold", "--unhold", "one"}, `cannot use --hold and --unhold together`},
+		{[]string{"refresh", "--hold", "--beta", "one"}, `--hold and --unhold do not accept other refresh options`},
+		{[]string{"refresh", "--unhold", "--revision=2", "one"}, `--hold and --unhold do not accept other refresh options`},
+		{[]string{"refresh", "--hold=soon", "one"}, `cannot hold refreshes: invalid duration "soon"`},
+		{[]string{"refresh", "--hold=-1h", "one"}, `cannot hold refreshes: invalid duration "-1h"`},
+	} {
+		_, err := snap.Parser(snap.Client()).ParseArgs(t.args)
+		c.Check(err, check.ErrorMatches, t.err, check.Commentf("%v", t.args))
+	}
+}
+
 func (s *SnapOpSuite) TestRefreshOneAmend(c *check.C) {
 	s.RedirectClientToTestServer(s.srv.handle)
 	s.srv.checker = func(r *http.Request) {
@@ -21,12 +21,15 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"strconv"
 	"strings"
 
 	"github.com/jessevdk/go-flags"
 
 	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/strutil"
 	"github.com/snapcore/snapd/strutil/quantity"
 )
@@ -41,6 +44,8 @@ var (
 	shortForgetHelp  = i18n.G("Delete a snapshot")
 	shortCheckHelp   = i18n.G("Check a snapshot")
 	shortRestoreHelp = i18n.G("Restore a snapshot")
+	shortExportHelp  = i18n.G("Export a snapshot")
+	shortImportHelp  = i18n.G("Import a snapshot")
 )
 
 var longSavedHelp = i18n.G(`
@@ -98,6 +103,22 @@ configuration data from the restore is not currently possible. This
 restriction may be lifted in the future.
 `)
 
+var longExportHelp = i18n.G(`
+The export-snapshot command writes the given snapshot set, including
+the data of all the snaps and users in it, into a single file.
+
+The exported file can be brought back into this or another system with
+the 'import-snapshot' command.
+`)
+var longImportHelp = i18n.G(`
+The import-snapshot command adds a snapshot set, previously exported
+with the 'export-snapshot' command, to the snapshots known to the
+system. The imported set gets a new set id.
+
+The data in the snapshot is not restored by this command; use the
+'restore' command for that.
+`)
+
 type savedCmd struct {
 	clientMixin
 	durationMixin
@@ -305,6 +326,76 @@ func (x *restoreCmd) Execute([]string) error {
 	return nil
 }
 
+type exportSnapshotCmd struct {
+	clientMixin
+	Positional struct {
+		ID       snapshotID     `positional-arg-name:"<id>"`
+		Filename flags.Filename `positional-arg-name:"<filename>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (x *exportSnapshotCmd) Execute([]string) (err error) {
+	setID, err := x.Positional.ID.ToUint()
+	if err != nil {
+		return err
+	}
+
+	exportStream, size, err := x.client.SnapshotExport(setID)
+	if err != nil {
+		return err
+	}
+	defer exportStream.Close()
+
+	aw, err := osutil.NewAtomicFile(string(x.Positional.Filename), 0600, 0, osutil.NoChown, osutil.NoChown)
+	if err != nil {
+		return fmt.Errorf(i18n.G("cannot create file: %v"), err)
+	}
+	defer aw.Cancel()
+
+	n, err := io.Copy(aw, exportStream)
+	if err != nil {
+		return fmt.Errorf(i18n.G("cannot export snapshot #%s: %v"), x.Positional.ID, err)
+	}
+	if size >= 0 && n != size {
+		return fmt.Errorf(i18n.G("cannot export snapshot #%s: expected %d bytes but got %d"), x.Positional.ID, size, n)
+	}
+	if err := aw.Commit(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(Stdout, i18n.G("Exported snapshot #%s into %q\n"), x.Positional.ID, x.Positional.Filename)
+	return nil
+}
+
+type importSnapshotCmd struct {
+	clientMixin
+	durationMixin
+	Positional struct {
+		Filename flags.Filename `positional-arg-name:"<filename>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (x *importSnapshotCmd) Execute([]string) error {
+	f, err := os.Open(string(x.Positional.Filename))
+	if err != nil {
+		return fmt.Errorf(i18n.G("cannot read snapshot: %v"), err)
+	}
+	defer f.Close()
+
+	importSet, err := x.client.SnapshotImport(f)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(Stdout, i18n.G("Imported snapshot as #%d\n"), importSet.ID)
+	y := &savedCmd{
+		clientMixin:   x.clientMixin,
+		durationMixin: x.durationMixin,
+		ID:            snapshotID(strconv.FormatUint(importSet.ID, 10)),
+	}
+	return y.Execute(nil)
+}
+
 func init() {
 	addCommand("saved",
 		shortSavedHelp,
@@ -384,4 +475,34 @@ func init() {
 				desc: i18n.G("The snap for which data will be verified"),
 			},
 		})
+
+	addCommand("export-snapshot",
+		shortExportHelp,
+		longExportHelp,
+		func() flags.Commander {
+			return &exportSnapshotCmd{}
+		}, nil, []argDesc{
+			{
+				name: "<id>",
+				// TRANSLATORS: This should not start with a lowercase letter.
+				desc: i18n.G("Set id of snapshot to export (see 'snap help saved')"),
+			}, {
+				name: "<filename>",
+				// TRANSLATORS: This should not start with a lowercase letter.
+				desc: i18n.G("The filename to export the snapshot into"),
+			},
+		})
+
+	addCommand("import-snapshot",
+		shortImportHelp,
+		longImportHelp,
+		func() flags.Commander {
+			return &importSnapshotCmd{}
+		}, durationDescs, []argDesc{
+			{
+				name: "<filename>",
+				// TRANSLATORS: This should not start with a lowercase letter.
+				desc: i18n.G("The filename of the snapshot to import"),
+			},
+		})
 }
@@ -21,12 +21,15 @@ package main_test
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"path/filepath"
 	"strings"
 	"time"
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/cmd/snap"
 	"github.com/snapcore/snapd/testutil"
 )
@@ -112,3 +115,71 @@ func (s *SnapSuite) mockSnapshotsServer(c *C) {
 		}
 	})
 }
+
+func (s *SnapSuite) TestSnapshotExport(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, Equals, "GET")
+		c.Check(r.URL.Path, Equals, "/v2/snapshots/1/export")
+		w.Header().Set("Content-Type", client.SnapshotExportMediaType)
+		w.Header().Set("Content-Length", "13")
+		fmt.Fprint(w, "export-stream")
+	})
+
+	exportedFn := filepath.Join(c.MkDir(), "export.snapshot")
+	rest, err := main.Parser(main.Client()).ParseArgs([]string{"export-snapshot", "1", exportedFn})
+	c.Assert(err, IsNil)
+	c.Check(rest, HasLen, 0)
+	c.Check(s.Stdout(), Equals, fmt.Sprintf("Exported snapshot #1 into %q\n", exportedFn))
+	c.Check(exportedFn, testutil.FileEquals, "export-stream")
+}
+
+func (s *SnapSuite) TestSnapshotExportError(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(404)
+		fmt.Fprint(w, `{"type": "error", "status-code": 404, "result": {"message": "no snapshot set with the given ID"}}`)
+	})
+
+	exportedFn := filepath.Join(c.MkDir(), "export.snapshot")
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"export-snapshot", "1", exportedFn})
+	c.Assert(err, ErrorMatches, "no snapshot set with the given ID")
+	c.Check(exportedFn, testutil.FileAbsent)
+}
+
+func (s *SnapSuite) TestSnapshotExportBadID(c *C) {
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"export-snapshot", "x", "foo"})
+	c.Assert(err, ErrorMatches, `invalid argument for snapshot set id: expected a non-negative integer argument \(see 'snap help saved'\)`)
+}
+
+func (s *SnapSuite) TestSnapshotImport(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/v2/snapshots")
+		switch r.Method {
+		case "POST":
+			c.Check(r.Header.Get("Content-Type"), Equals, client.SnapshotExportMediaType)
+			data, err := ioutil.ReadAll(r.Body)
+			c.Assert(err, IsNil)
+			c.Check(string(data), Equals, "export-stream")
+			fmt.Fprint(w, `{"type": "sync", "result": {"set-id": 42, "snaps": ["htop"]}}`)
+		case "GET":
+			c.Check(r.URL.Query().Get("set"), Equals, "42")
+			snapshotTime := time.Now().AddDate(0, -1, 0).Format(time.RFC3339)
+			fmt.Fprintf(w, `{"type":"sync","status-code":200,"status":"OK","result":[{"id":42,"snapshots":[{"set":42,"time":%q,"snap":"htop","revision":"1168","snap-id":"Z","epoch":{"read":[0],"write":[0]},"summary":"","version":"2","sha3-384":{"archive.tgz":""},"size":1}]}]}`, snapshotTime)
+		default:
+			c.Errorf("unexpected method %q", r.Method)
+		}
+	})
+
+	exportedFn := filepath.Join(c.MkDir(), "export.snapshot")
+	c.Assert(ioutil.WriteFile(exportedFn, []byte("export-stream"), 0644), IsNil)
+
+	rest, err := main.Parser(main.Client()).ParseArgs([]string{"import-snapshot", exportedFn})
+	c.Assert(err, IsNil)
+	c.Check(rest, HasLen, 0)
+	c.Check(s.Stdout(), testutil.MatchesWrapped, "Imported snapshot as #42\nSet  Snap  Age    Version  Rev   Size    Notes\n42   htop  .*  2        1168      1B  -\n")
+}
+
+func (s *SnapSuite) TestSnapshotImportNoFile(c *C) {
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"import-snapshot", filepath.Join(c.MkDir(), "missing")})
+	c.Assert(err, ErrorMatches, "cannot read snapshot: open .*/missing: no such file or directory")
+}
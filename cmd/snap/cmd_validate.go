@@ -0,0 +1,186 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+)
+
+var shortValidateHelp = i18n.G("List or apply validation sets")
+var longValidateHelp = i18n.G(`
+The validate command lists or applies validation sets. A validation set
+states which snaps must or must not be installed on the system, possibly at
+specific revisions.
+
+Without arguments, it lists the validation sets applied to the system.
+Given a validation set it reports whether the installed snaps satisfy it.
+
+With --monitor the validation set is applied in monitor mode, where snapd only
+reports whether the installed snaps satisfy it. With --enforce the validation
+set is applied in enforce mode, where snapd refuses to install, refresh or
+remove snaps in a way that would break it; the installed snaps must already
+satisfy it. A validation set follows its latest sequence point unless one is
+given with account-id/name=sequence.
+
+With --forget the validation set is no longer applied.
+`)
+
+type cmdValidate struct {
+	clientMixin
+	Monitor    bool `long:"monitor"`
+	Enforce    bool `long:"enforce"`
+	Forget     bool `long:"forget"`
+	Positional struct {
+		ValidationSet string `positional-arg-name:"<validation-set>"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	addCommand("validate", shortValidateHelp, longValidateHelp, func() flags.Commander { return &cmdValidate{} }, map[string]string{
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"monitor": i18n.G("Monitor the given validation set"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"enforce": i18n.G("Enforce the given validation set"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"forget": i18n.G("Forget the given validation set"),
+	}, []argDesc{{
+		// TRANSLATORS: This needs to begin with < and end with >
+		name: i18n.G("<validation-set>"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		desc: i18n.G("Validation set with an optional pinned sequence point, i.e. account-id/name[=seq]"),
+	}})
+}
+
+func splitValidationSetArg(arg string) (accountID, name string, seq int, err error) {
+	parts := strings.SplitN(arg, "=", 2)
+	if len(parts) == 2 {
+		seq, err = strconv.Atoi(parts[1])
+		if err != nil || seq < 1 {
+			return "", "", 0, fmt.Errorf(i18n.G("invalid sequence point %q of validation set %q"), parts[1], arg)
+		}
+	}
+	nameParts := strings.Split(parts[0], "/")
+	if len(nameParts) != 2 || nameParts[0] == "" || nameParts[1] == "" {
+		return "", "", 0, fmt.Errorf(i18n.G("cannot parse validation set %q: expected account-id/name[=seq]"), arg)
+	}
+	return nameParts[0], nameParts[1], seq, nil
+}
+
+func fmtValidationSetName(res *client.ValidationSetResult) string {
+	if res.PinnedAt > 0 {
+		return fmt.Sprintf("%s/%s=%d", res.AccountID, res.Name, res.PinnedAt)
+	}
+	return fmt.Sprintf("%s/%s", res.AccountID, res.Name)
+}
+
+func fmtValid(res *client.ValidationSetResult) string {
+	if res.Valid {
+		return i18n.G("valid")
+	}
+	return i18n.G("invalid")
+}
+
+func (cmd *cmdValidate) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	var modes []string
+	if cmd.Monitor {
+		modes = append(modes, "monitor")
+	}
+	if cmd.Enforce {
+		modes = append(modes, "enforce")
+	}
+	if cmd.Forget {
+		modes = append(modes, "forget")
+	}
+	if len(modes) > 1 {
+		return fmt.Errorf(i18n.G("cannot use --%s and --%s at the same time"), modes[0], modes[1])
+	}
+
+	if cmd.Positional.ValidationSet == "" {
+		if len(modes) > 0 {
+			return fmt.Errorf(i18n.G("missing validation set argument"))
+		}
+		return cmd.list()
+	}
+
+	accountID, name, seq, err := splitValidationSetArg(cmd.Positional.ValidationSet)
+	if err != nil {
+		return err
+	}
+
+	var res *client.ValidationSetResult
+	switch {
+	case cmd.Forget:
+		if seq != 0 {
+			return fmt.Errorf(i18n.G("cannot specify a sequence point when forgetting a validation set"))
+		}
+		return cmd.client.ForgetValidationSet(accountID, name)
+	case cmd.Monitor, cmd.Enforce:
+		res, err = cmd.client.ApplyValidationSet(accountID, name, &client.ValidationSetApplyOptions{
+			Mode:     modes[0],
+			Sequence: seq,
+		})
+	default:
+		if seq != 0 {
+			return fmt.Errorf(i18n.G("cannot specify a sequence point without --monitor or --enforce"))
+		}
+		res, err = cmd.client.ValidationSet(accountID, name)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(Stdout, fmtValid(res))
+	return nil
+}
+
+func (cmd *cmdValidate) list() error {
+	vsets, err := cmd.client.ListValidationSets()
+	if err != nil {
+		return err
+	}
+	if len(vsets) == 0 {
+		fmt.Fprintln(Stderr, i18n.G("No validation sets are applied."))
+		return nil
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+		i18n.G("Validation"),
+		i18n.G("Mode"),
+		i18n.G("Seq"),
+		i18n.G("Status"),
+	)
+	for _, res := range vsets {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", fmtValidationSetName(res), res.Mode, res.Sequence, fmtValid(res))
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+func (s *SnapSuite) TestValidateList(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/validation-sets")
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": [
+			{"account-id": "acme", "name": "one", "mode": "enforce", "pinned-at": 2, "sequence": 2, "valid": true},
+			{"account-id": "acme", "name": "two", "mode": "monitor", "sequence": 5, "valid": false}
+		]}`)
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"validate"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `Validation  Mode     Seq  Status
+acme/one=2  enforce  2    valid
+acme/two    monitor  5    invalid
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestValidateListNone(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": []}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"validate"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "No validation sets are applied.\n")
+}
+
+func (s *SnapSuite) TestValidateOne(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/validation-sets/acme/two")
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": {"account-id": "acme", "name": "two", "mode": "monitor", "sequence": 5, "valid": false}}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"validate", "acme/two"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "invalid\n")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) testValidateApply(c *check.C, args []string, expectedBody map[string]interface{}) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v2/validation-sets/acme/one")
+		var body map[string]interface{}
+		c.Assert(json.NewDecoder(r.Body).Decode(&body), check.IsNil)
+		c.Check(body, check.DeepEquals, expectedBody)
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": {"account-id": "acme", "name": "one", "mode": "enforce", "sequence": 3, "valid": true}}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs(args)
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "valid\n")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestValidateMonitor(c *check.C) {
+	s.testValidateApply(c, []string{"validate", "--monitor", "acme/one"}, map[string]interface{}{
+		"action": "apply",
+		"mode":   "monitor",
+	})
+}
+
+func (s *SnapSuite) TestValidateEnforcePinned(c *check.C) {
+	s.testValidateApply(c, []string{"validate", "--enforce", "acme/one=3"}, map[string]interface{}{
+		"action":   "apply",
+		"mode":     "enforce",
+		"sequence": 3.0,
+	})
+}
+
+func (s *SnapSuite) TestValidateForget(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v2/validation-sets/acme/one")
+		var body map[string]interface{}
+		c.Assert(json.NewDecoder(r.Body).Decode(&body), check.IsNil)
+		c.Check(body, check.DeepEquals, map[string]interface{}{"action": "forget"})
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": null}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"validate", "--forget", "acme/one"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestValidateError(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "error", "status-code": 400, "result": {"message": "cannot enforce validation set: boom"}}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"validate", "--enforce", "acme/one"})
+	c.Assert(err, check.ErrorMatches, "cannot enforce validation set: boom")
+}
+
+func (s *SnapSuite) TestValidateInvalidArgs(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request")
+	})
+
+	for _, t := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"validate", "--monitor", "--enforce", "acme/one"}, "cannot use --monitor and --enforce at the same time"},
+		{[]string{"validate", "--enforce", "--forget", "acme/one"}, "cannot use --enforce and --forget at the same time"},
+		{[]string{"validate", "--monitor"}, "missing validation set argument"},
+		{[]string{"validate", "acme"}, `cannot parse validation set "acme": expected account-id/name\[=seq\]`},
+		{[]string{"validate", "acme/one/two"}, `cannot parse validation set "acme/one/two": expected account-id/name\[=seq\]`},
+		{[]string{"validate", "/one"}, `cannot parse validation set "/one": expected account-id/name\[=seq\]`},
+		{[]string{"validate", "--monitor", "acme/one=x"}, `invalid sequence point "x" of validation set "acme/one=x"`},
+		{[]string{"validate", "--monitor", "acme/one=0"}, `invalid sequence point "0" of validation set "acme/one=0"`},
+		{[]string{"validate", "acme/one=2"}, "cannot specify a sequence point without --monitor or --enforce"},
+		{[]string{"validate", "--forget", "acme/one=2"}, "cannot specify a sequence point when forgetting a validation set"},
+		{[]string{"validate", "acme/one", "extra"}, "too many arguments for command"},
+	} {
+		_, err := snap.Parser(snap.Client()).ParseArgs(t.args)
+		c.Check(err, check.ErrorMatches, t.err, check.Commentf("%v", t.args))
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/jessevdk/go-flags"
 
 	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/gadget"
 	"github.com/snapcore/snapd/image"
 	"github.com/snapcore/snapd/sandbox/selinux"
 	"github.com/snapcore/snapd/store"
@@ -80,6 +81,9 @@ var (
 	InterfacesDeprecationNotice = interfacesDeprecationNotice
 
 	SignalNotify = signalNotify
+
+	BundleDependencies = bundleDependencies
+	WriteBundle        = writeBundle
 )
 
 func NewInfoWriter(w writeflusher) *infoWriter {
@@ -113,6 +117,7 @@ var (
 	MaybePrintSum               = (*infoWriter).maybePrintSum
 	MaybePrintCohortKey         = (*infoWriter).maybePrintCohortKey
 	MaybePrintHealth            = (*infoWriter).maybePrintHealth
+	MaybePrintHold              = (*infoWriter).maybePrintHold
 )
 
 func MockPollTime(d time.Duration) (restore func()) {
@@ -307,3 +312,19 @@ func MockSignalNotify(newSignalNotify func(sig ...os.Signal) (chan os.Signal, fu
 }
 
 type ServiceName = serviceName
+
+func MockGadgetWriteVolumeImage(f func(lv *gadget.LaidOutVolume, outPath string, postStage gadget.PostStageFunc) error) (restore func()) {
+	old := gadgetWriteVolumeImage
+	gadgetWriteVolumeImage = f
+	return func() {
+		gadgetWriteVolumeImage = old
+	}
+}
+
+func MockGadgetVerify(f func(gd gadget.GadgetData) ([]gadget.StructureReport, error)) (restore func()) {
+	old := gadgetVerify
+	gadgetVerify = f
+	return func() {
+		gadgetVerify = old
+	}
+}
@@ -89,7 +89,10 @@ func ClientAppInfoNotes(app *client.AppInfo) string {
 		return "-"
 	}
 
-	var notes = make([]string, 0, 2)
+	var notes = make([]string, 0, 3)
+	if app.DaemonScope == string(snap.UserDaemon) {
+		notes = append(notes, "user")
+	}
 	var seenTimer, seenSocket bool
 	for _, act := range app.Activators {
 		switch act.Type {
@@ -142,11 +145,22 @@ func ClientAppInfosFromSnapAppInfos(apps []*snap.AppInfo) ([]client.AppInfo, err
 		}
 
 		appInfo.Daemon = app.Daemon
+		appInfo.DaemonScope = string(app.DaemonScope)
 		if !app.IsService() || !app.Snap.IsActive() {
 			out = append(out, appInfo)
 			continue
 		}
 
+		if app.DaemonScope == snap.UserDaemon {
+			// user services run in every user session, only
+			// report whether they are enabled
+			if err := userAppInfoEnableState(&appInfo, app); err != nil {
+				return nil, err
+			}
+			out = append(out, appInfo)
+			continue
+		}
+
 		// collect all services for a single call to systemctl
 		serviceNames := make([]string, 0, 1+len(app.Sockets)+1)
 		serviceNames = append(serviceNames, app.ServiceName())
@@ -197,3 +211,25 @@ func ClientAppInfosFromSnapAppInfos(apps []*snap.AppInfo) ([]client.AppInfo, err
 
 	return out, nil
 }
+
+func userAppInfoEnableState(appInfo *client.AppInfo, app *snap.AppInfo) error {
+	sysd := systemd.New(dirs.GlobalRootDir, systemd.GlobalUserMode, progress.Null)
+
+	enabled, err := sysd.IsEnabled(app.ServiceName())
+	if err != nil {
+		return fmt.Errorf("cannot get status of services of app %q: %v", app.Name, err)
+	}
+	appInfo.Enabled = enabled
+	if app.Timer != nil {
+		enabled, err := sysd.IsEnabled(filepath.Base(app.Timer.File()))
+		if err != nil {
+			return fmt.Errorf("cannot get status of services of app %q: %v", app.Name, err)
+		}
+		appInfo.Activators = append(appInfo.Activators, client.AppActivator{
+			Name:    app.Name,
+			Enabled: enabled,
+			Type:    "timer",
+		})
+	}
+	return nil
+}
@@ -79,4 +79,13 @@ func (*cmdSuite) TestAppStatusNotes(c *check.C) {
 		},
 	}
 	c.Check(cmd.ClientAppInfoNotes(&ai), check.Equals, "timer-activated,socket-activated")
+
+	ai = client.AppInfo{
+		Daemon:      "simple",
+		DaemonScope: "user",
+		Activators: []client.AppActivator{
+			{Type: "timer"},
+		},
+	}
+	c.Check(cmd.ClientAppInfoNotes(&ai), check.Equals, "user,timer-activated")
 }
@@ -51,6 +51,7 @@ import (
 	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/jsonutil"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/netutil"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/assertstate"
 	"github.com/snapcore/snapd/overlord/auth"
@@ -65,6 +66,7 @@ import (
 	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snapbundle"
 	"github.com/snapcore/snapd/store"
 	"github.com/snapcore/snapd/strutil"
 	"github.com/snapcore/snapd/systemd"
@@ -100,10 +102,18 @@ var api = []*Command{
 	debugPprofCmd,
 	debugCmd,
 	snapshotCmd,
+	snapshotExportCmd,
 	connectionsCmd,
 	modelCmd,
 	cohortsCmd,
 	serialModelCmd,
+	validationSetsListCmd,
+	validationSetsCmd,
+	storeProxyCmd,
+	quotaGroupsCmd,
+	quotaGroupInfoCmd,
+	systemsCmd,
+	systemsActionCmd,
 }
 
 var (
@@ -744,6 +754,7 @@ type snapInstruction struct {
 	Classic          bool          `json:"classic"`
 	IgnoreValidation bool          `json:"ignore-validation"`
 	Unaliased        bool          `json:"unaliased"`
+	NoStart          bool          `json:"no-start,omitempty"`
 	Purge            bool          `json:"purge,omitempty"`
 	// dropping support temporarely until flag confusion is sorted,
 	// this isn't supported by client atm anyway
@@ -751,6 +762,9 @@ type snapInstruction struct {
 	License  *licenseData `json:"license"`
 	Snaps    []string     `json:"snaps"`
 	Users    []string     `json:"users"`
+	// HoldUntil is the time until which to hold automatic refreshes,
+	// for the hold action; if unset they are held indefinitely.
+	HoldUntil *time.Time `json:"hold-until,omitempty"`
 
 	// The fields below should not be unmarshalled into. Do not export them.
 	userID int
@@ -778,6 +792,9 @@ func (inst *snapInstruction) installFlags() (snapstate.Flags, error) {
 	if inst.Unaliased {
 		flags.Unaliased = true
 	}
+	if inst.NoStart {
+		flags.NoStart = true
+	}
 	return flags, nil
 }
 
@@ -797,6 +814,8 @@ var (
 	snapstateUpdateMany        = snapstate.UpdateMany
 	snapstateInstallMany       = snapstate.InstallMany
 	snapstateRemoveMany        = snapstate.RemoveMany
+	snapstateHoldRefresh       = snapstate.HoldRefresh
+	snapstateUnholdRefresh     = snapstate.UnholdRefresh
 	snapstateRevert            = snapstate.Revert
 	snapstateRevertToRevision  = snapstate.RevertToRevision
 	snapstateSwitch            = snapstate.Switch
@@ -806,6 +825,8 @@ var (
 	snapshotForget  = snapshotstate.Forget
 	snapshotRestore = snapshotstate.Restore
 	snapshotSave    = snapshotstate.Save
+	snapshotExport  = snapshotstate.Export
+	snapshotImport  = snapshotstate.Import
 
 	assertstateRefreshSnapDeclarations = assertstate.RefreshSnapDeclarations
 )
@@ -893,6 +914,9 @@ func verifySnapInstructions(inst *snapInstruction) error {
 			return fmt.Errorf("leave-cohort can only be specified for refresh or switch")
 		}
 	}
+	if inst.HoldUntil != nil && inst.Action != "hold" {
+		return fmt.Errorf("hold-until can only be specified for hold")
+	}
 	switch inst.Action {
 	case "install":
 		for _, snapName := range inst.Snaps {
@@ -1131,6 +1155,48 @@ func snapshotMany(inst *snapInstruction, st *state.State) (*snapInstructionResul
 
 type snapActionFunc func(*snapInstruction, *state.State) (string, []*state.TaskSet, error)
 
+func snapHoldMany(inst *snapInstruction, st *state.State) (*snapInstructionResult, error) {
+	var until time.Time
+	if inst.HoldUntil != nil {
+		until = *inst.HoldUntil
+	}
+	if err := snapstateHoldRefresh(st, until, inst.Snaps...); err != nil {
+		return nil, err
+	}
+
+	var msg string
+	if len(inst.Snaps) == 0 {
+		msg = i18n.G("Hold auto-refresh of all snaps")
+	} else {
+		// TRANSLATORS: the %s is a comma-separated list of quoted snap names
+		msg = fmt.Sprintf(i18n.G("Hold auto-refresh of snaps %s"), strutil.Quoted(inst.Snaps))
+	}
+
+	return &snapInstructionResult{
+		Summary:  msg,
+		Affected: inst.Snaps,
+	}, nil
+}
+
+func snapUnholdMany(inst *snapInstruction, st *state.State) (*snapInstructionResult, error) {
+	if err := snapstateUnholdRefresh(st, inst.Snaps...); err != nil {
+		return nil, err
+	}
+
+	var msg string
+	if len(inst.Snaps) == 0 {
+		msg = i18n.G("Remove auto-refresh hold of all snaps")
+	} else {
+		// TRANSLATORS: the %s is a comma-separated list of quoted snap names
+		msg = fmt.Sprintf(i18n.G("Remove auto-refresh hold of snaps %s"), strutil.Quoted(inst.Snaps))
+	}
+
+	return &snapInstructionResult{
+		Summary:  msg,
+		Affected: inst.Snaps,
+	}, nil
+}
+
 var snapInstructionDispTable = map[string]snapActionFunc{
 	"install": snapInstall,
 	"refresh": snapUpdate,
@@ -1282,7 +1348,7 @@ func snapsOp(c *Command, r *http.Request, user *auth.UserState) Response {
 	}
 
 	// TODO: inst.Amend, etc?
-	if inst.Channel != "" || !inst.Revision.Unset() || inst.DevMode || inst.JailMode || inst.CohortKey != "" || inst.LeaveCohort {
+	if inst.Channel != "" || !inst.Revision.Unset() || inst.DevMode || inst.JailMode || inst.CohortKey != "" || inst.LeaveCohort || inst.NoStart {
 		return BadRequest("unsupported option provided for multi-snap operation")
 	}
 	if err := verifySnapInstructions(&inst); err != nil {
@@ -1308,6 +1374,10 @@ func snapsOp(c *Command, r *http.Request, user *auth.UserState) Response {
 		op = snapRemoveMany
 	case "snapshot":
 		op = snapshotMany
+	case "hold":
+		op = snapHoldMany
+	case "unhold":
+		op = snapUnholdMany
 	default:
 		return BadRequest("unsupported multi-snap operation %q", inst.Action)
 	}
@@ -1372,6 +1442,7 @@ func postSnaps(c *Command, r *http.Request, user *auth.UserState) Response {
 	flags.RemoveSnapPath = true
 
 	flags.Unaliased = isTrue(form, "unaliased")
+	flags.NoStart = isTrue(form, "no-start")
 
 	// find the file for the "snap" form field
 	var snapBody multipart.File
@@ -1424,6 +1495,13 @@ out:
 		origPath = form.Value["snap-path"][0]
 	}
 
+	if snapbundle.IsBundle(tempPath) {
+		if len(form.Value["name"]) > 0 {
+			return BadRequest("cannot use instance name when installing a snap bundle")
+		}
+		return sideloadBundle(c.d.overlord.State(), tempPath, origPath, flags, dangerousOK)
+	}
+
 	var instanceName string
 
 	if len(form.Value["name"]) > 0 {
@@ -2002,7 +2080,7 @@ func abortChange(c *Command, r *http.Request, user *auth.UserState) Response {
 }
 
 var (
-	runSnapctlUcrednetGet = ucrednetGet
+	runSnapctlUcrednetGet = netutil.UcrednetGet
 	ctlcmdRun             = ctlcmd.Run
 )
 
@@ -2106,6 +2184,9 @@ func runSnapctl(c *Command, r *http.Request, user *auth.UserState) Response {
 		if e, ok := err.(*ctlcmd.ForbiddenCommandError); ok {
 			return Forbidden(e.Error())
 		}
+		if e, ok := err.(*ctlcmd.UnsuccessfulError); ok {
+			return SnapctlUnsuccessful(stdout, stderr, e.ExitCode)
+		}
 		if e, ok := err.(*flags.Error); ok && e.Type == flags.ErrHelp {
 			stdout = []byte(e.Error())
 		} else {
@@ -2303,10 +2384,30 @@ func getLogs(c *Command, r *http.Request, user *auth.UserState) Response {
 		}
 		follow = f
 	}
+	var since, until time.Time
+	for _, t := range []struct {
+		param string
+		value *time.Time
+	}{{"since", &since}, {"until", &until}} {
+		s := query.Get(t.param)
+		if s == "" {
+			continue
+		}
+		tm, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return BadRequest(`invalid value for %s: %q: %v`, t.param, s, err)
+		}
+		*t.value = tm
+	}
+	priority := query.Get("priority")
+	if priority != "" && !validLogPriority(priority) {
+		return BadRequest(`invalid value for priority: %q`, priority)
+	}
 
 	// only services have logs for now
 	opts := appInfoOptions{service: true}
-	appInfos, rsp := appInfosFor(c.d.overlord.State(), strutil.CommaSeparatedList(query.Get("names")), opts)
+	st := c.d.overlord.State()
+	appInfos, rsp := appInfosFor(st, strutil.CommaSeparatedList(query.Get("names")), opts)
 	if rsp != nil {
 		return rsp
 	}
@@ -2319,8 +2420,31 @@ func getLogs(c *Command, r *http.Request, user *auth.UserState) Response {
 		serviceNames[i] = appInfo.ServiceName()
 	}
 
+	// services of snaps with their own journal log to a namespace
+	allNamespaces := false
+	st.Lock()
+	for _, appInfo := range appInfos {
+		namespace, err := servicestate.SnapJournalNamespace(st, appInfo.Snap.InstanceName())
+		if err != nil {
+			st.Unlock()
+			return InternalError("cannot get logs: %v", err)
+		}
+		if namespace != "" {
+			allNamespaces = true
+			break
+		}
+	}
+	st.Unlock()
+
 	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, progress.Null)
-	reader, err := sysd.LogReader(serviceNames, n, follow)
+	reader, err := sysd.LogReader(serviceNames, &systemd.LogOptions{
+		N:             n,
+		Follow:        follow,
+		Since:         since,
+		Until:         until,
+		Priority:      priority,
+		AllNamespaces: allNamespaces,
+	})
 	if err != nil {
 		return InternalError("cannot get logs: %v", err)
 	}
@@ -2331,6 +2455,19 @@ func getLogs(c *Command, r *http.Request, user *auth.UserState) Response {
 	}
 }
 
+var logPriorities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// validLogPriority returns whether the given priority is a syslog
+// priority name or number as understood by journalctl.
+func validLogPriority(priority string) bool {
+	for i, name := range logPriorities {
+		if priority == name || priority == strconv.Itoa(i) {
+			return true
+		}
+	}
+	return false
+}
+
 func postApps(c *Command, r *http.Request, user *auth.UserState) Response {
 	var inst servicestate.Instruction
 	decoder := json.NewDecoder(r.Body)
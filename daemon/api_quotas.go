@@ -0,0 +1,200 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/sandbox/cgroup"
+	"github.com/snapcore/snapd/snap/quota"
+)
+
+var (
+	quotaGroupsCmd = &Command{
+		Path: "/v2/quotas",
+		GET:  getQuotaGroups,
+		POST: postQuotaGroup,
+	}
+
+	quotaGroupInfoCmd = &Command{
+		Path: "/v2/quotas/{group}",
+		GET:  getQuotaGroupInfo,
+	}
+)
+
+var (
+	servicestateSetQuota    = servicestate.SetQuota
+	servicestateRemoveQuota = servicestate.RemoveQuota
+
+	cgroupMemoryUsage = cgroup.MemoryUsage
+	cgroupTasksCount  = cgroup.TasksCount
+)
+
+type postQuotaGroupData struct {
+	Action    string   `json:"action"`
+	GroupName string   `json:"group-name"`
+	Snaps     []string `json:"snaps,omitempty"`
+	MaxMemory int64    `json:"max-memory,omitempty"`
+	CPU       int      `json:"cpu,omitempty"`
+	Threads   int      `json:"threads,omitempty"`
+}
+
+// currentUsage returns the current usage of the given resource of the
+// slice of the quota group. A slice that is not active, because none of
+// the services in it are running, uses nothing.
+func currentUsage(usage func(group string) (uint64, error), grp *quota.Group) (uint64, error) {
+	value, err := usage(grp.SliceFileName())
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	return value, err
+}
+
+func quotaGroupResult(grp *quota.Group) (*client.QuotaGroupResult, error) {
+	res := &client.QuotaGroupResult{
+		GroupName: grp.Name,
+		Snaps:     grp.Snaps,
+		MaxMemory: grp.MemoryLimit,
+		CPU:       grp.CPULimit,
+		Threads:   grp.ThreadLimit,
+	}
+	var err error
+	if grp.MemoryLimit != 0 {
+		res.CurrentMemory, err = currentUsage(cgroupMemoryUsage, grp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if grp.ThreadLimit != 0 {
+		res.CurrentThreads, err = currentUsage(cgroupTasksCount, grp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func getQuotaGroups(c *Command, r *http.Request, _ *auth.UserState) Response {
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	quotas, err := servicestate.AllQuotas(st)
+	if err != nil {
+		return InternalError("cannot list quota groups: %v", err)
+	}
+	names := make([]string, 0, len(quotas))
+	for name := range quotas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]*client.QuotaGroupResult, 0, len(names))
+	for _, name := range names {
+		res, err := quotaGroupResult(quotas[name])
+		if err != nil {
+			return InternalError("cannot get usage of quota group %q: %v", name, err)
+		}
+		results = append(results, res)
+	}
+	return SyncResponse(results, nil)
+}
+
+func getQuotaGroupInfo(c *Command, r *http.Request, _ *auth.UserState) Response {
+	name := muxVars(r)["group"]
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	grp, err := servicestate.GetQuota(st, name)
+	if err == state.ErrNoState {
+		return NotFound("cannot find quota group %q", name)
+	}
+	if err != nil {
+		return InternalError("cannot get quota group %q: %v", name, err)
+	}
+	res, err := quotaGroupResult(grp)
+	if err != nil {
+		return InternalError("cannot get usage of quota group %q: %v", name, err)
+	}
+	return SyncResponse(res, nil)
+}
+
+func postQuotaGroup(c *Command, r *http.Request, _ *auth.UserState) Response {
+	var data postQuotaGroupData
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return BadRequest("cannot decode quota action from request body: %v", err)
+	}
+	if err := quota.ValidateGroupName(data.GroupName); err != nil {
+		return BadRequest("%v", err)
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var ts *state.TaskSet
+	var err error
+	var summary string
+	switch data.Action {
+	case "ensure":
+		ts, err = servicestateSetQuota(st, &quota.Group{
+			Name:        data.GroupName,
+			MemoryLimit: data.MaxMemory,
+			CPULimit:    data.CPU,
+			ThreadLimit: data.Threads,
+			Snaps:       data.Snaps,
+		})
+		summary = fmt.Sprintf("Set quota group %q", data.GroupName)
+	case "remove":
+		if len(data.Snaps) != 0 || data.MaxMemory != 0 || data.CPU != 0 || data.Threads != 0 {
+			return BadRequest("cannot remove quota group %q: unexpected snaps or limits", data.GroupName)
+		}
+		if _, err := servicestate.GetQuota(st, data.GroupName); err == state.ErrNoState {
+			return NotFound("cannot find quota group %q", data.GroupName)
+		}
+		ts, err = servicestateRemoveQuota(st, data.GroupName)
+		summary = fmt.Sprintf("Remove quota group %q", data.GroupName)
+	default:
+		return BadRequest("unknown quota action %q", data.Action)
+	}
+	if err != nil {
+		if cce, ok := err.(*snapstate.ChangeConflictError); ok {
+			return SnapChangeConflict(cce)
+		}
+		return BadRequest("%v", err)
+	}
+
+	chg := newChange(st, "quota-control", summary, []*state.TaskSet{ts}, data.Snaps)
+	ensureStateSoon(st)
+
+	return AsyncResponse(nil, &Meta{Change: chg.ID()})
+}
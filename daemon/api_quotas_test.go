@@ -0,0 +1,305 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"os"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/daemon"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap/quota"
+	"github.com/snapcore/snapd/testutil"
+)
+
+var _ = check.Suite(&apiQuotaSuite{})
+
+type apiQuotaSuite struct {
+	testutil.BaseTest
+
+	d  *daemon.Daemon
+	st *state.State
+}
+
+func (s *apiQuotaSuite) SetUpTest(c *check.C) {
+	s.BaseTest.SetUpTest(c)
+
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	o := overlord.Mock()
+	s.d = daemon.NewWithOverlord(o)
+	s.st = o.State()
+
+	s.AddCleanup(daemon.MockCgroupUsage(func(group string) (uint64, error) {
+		if group == `snap.foo.slice` {
+			return 1024, nil
+		}
+		return 0, os.ErrNotExist
+	}, func(group string) (uint64, error) {
+		if group == `snap.bar\x2dgroup.slice` {
+			return 5, nil
+		}
+		return 0, os.ErrNotExist
+	}))
+}
+
+func (s *apiQuotaSuite) mockQuotas() {
+	s.st.Lock()
+	defer s.st.Unlock()
+	s.st.Set("quotas", map[string]*quota.Group{
+		"foo": {
+			Name:        "foo",
+			MemoryLimit: 1048576,
+			CPULimit:    50,
+			Snaps:       []string{"snap-a", "snap-b"},
+		},
+		"bar-group": {
+			Name:        "bar-group",
+			MemoryLimit: 8192,
+			ThreadLimit: 32,
+			Snaps:       []string{"snap-c"},
+		},
+	})
+}
+
+func (s *apiQuotaSuite) TestListQuotasNone(c *check.C) {
+	req, err := http.NewRequest("GET", "/v2/quotas", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.QuotaGroupsCmd.GET(daemon.QuotaGroupsCmd, req, nil)
+	c.Check(rsp, check.DeepEquals, &daemon.Resp{
+		Status: 200,
+		Type:   "sync",
+		Result: []*client.QuotaGroupResult{},
+	})
+}
+
+func (s *apiQuotaSuite) TestListQuotas(c *check.C) {
+	s.mockQuotas()
+
+	req, err := http.NewRequest("GET", "/v2/quotas", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.QuotaGroupsCmd.GET(daemon.QuotaGroupsCmd, req, nil)
+	c.Check(rsp, check.DeepEquals, &daemon.Resp{
+		Status: 200,
+		Type:   "sync",
+		Result: []*client.QuotaGroupResult{
+			{
+				GroupName:      "bar-group",
+				Snaps:          []string{"snap-c"},
+				MaxMemory:      8192,
+				Threads:        32,
+				CurrentThreads: 5,
+			},
+			{
+				GroupName:     "foo",
+				Snaps:         []string{"snap-a", "snap-b"},
+				MaxMemory:     1048576,
+				CPU:           50,
+				CurrentMemory: 1024,
+			},
+		},
+	})
+}
+
+func (s *apiQuotaSuite) TestListQuotasUsageError(c *check.C) {
+	s.mockQuotas()
+	s.AddCleanup(daemon.MockCgroupUsage(func(group string) (uint64, error) {
+		return 0, errors.New("boom")
+	}, nil))
+
+	req, err := http.NewRequest("GET", "/v2/quotas", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.QuotaGroupsCmd.GET(daemon.QuotaGroupsCmd, req, nil)
+	c.Check(rsp, check.DeepEquals, &daemon.Resp{
+		Status: 500,
+		Type:   "error",
+		Result: &daemon.ErrorResult{Message: `cannot get usage of quota group "bar-group": boom`},
+	})
+}
+
+func (s *apiQuotaSuite) TestGetQuota(c *check.C) {
+	s.mockQuotas()
+	s.AddCleanup(daemon.MockMuxVars(func(*http.Request) map[string]string {
+		return map[string]string{"group": "foo"}
+	}))
+
+	req, err := http.NewRequest("GET", "/v2/quotas/foo", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.QuotaGroupInfoCmd.GET(daemon.QuotaGroupInfoCmd, req, nil)
+	c.Check(rsp, check.DeepEquals, &daemon.Resp{
+		Status: 200,
+		Type:   "sync",
+		Result: &client.QuotaGroupResult{
+			GroupName:     "foo",
+			Snaps:         []string{"snap-a", "snap-b"},
+			MaxMemory:     1048576,
+			CPU:           50,
+			CurrentMemory: 1024,
+		},
+	})
+}
+
+func (s *apiQuotaSuite) TestGetQuotaNotFound(c *check.C) {
+	s.AddCleanup(daemon.MockMuxVars(func(*http.Request) map[string]string {
+		return map[string]string{"group": "unknown"}
+	}))
+
+	req, err := http.NewRequest("GET", "/v2/quotas/unknown", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.QuotaGroupInfoCmd.GET(daemon.QuotaGroupInfoCmd, req, nil)
+	c.Check(rsp, check.DeepEquals, &daemon.Resp{
+		Status: 404,
+		Type:   "error",
+		Result: &daemon.ErrorResult{Message: `cannot find quota group "unknown"`},
+	})
+}
+
+func (s *apiQuotaSuite) TestPostEnsureQuota(c *check.C) {
+	var called int
+	s.AddCleanup(daemon.MockServicestateSetQuota(func(st *state.State, update *quota.Group) (*state.TaskSet, error) {
+		called++
+		c.Check(update, check.DeepEquals, &quota.Group{
+			Name:        "foo",
+			MemoryLimit: 1000,
+			CPULimit:    50,
+			ThreadLimit: 10,
+			Snaps:       []string{"snap-a"},
+		})
+		return state.NewTaskSet(st.NewTask("quota-control", "...")), nil
+	}))
+
+	body := bytes.NewBufferString(`{"action": "ensure", "group-name": "foo", "snaps": ["snap-a"], "max-memory": 1000, "cpu": 50, "threads": 10}`)
+	req, err := http.NewRequest("POST", "/v2/quotas", body)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.QuotaGroupsCmd.POST(daemon.QuotaGroupsCmd, req, nil).(*daemon.Resp)
+	c.Check(rsp.Status, check.Equals, 202)
+	c.Check(called, check.Equals, 1)
+
+	s.st.Lock()
+	defer s.st.Unlock()
+	chg := s.st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Kind(), check.Equals, "quota-control")
+	c.Check(chg.Summary(), check.Equals, `Set quota group "foo"`)
+	c.Check(chg.Tasks(), check.HasLen, 1)
+}
+
+func (s *apiQuotaSuite) TestPostEnsureQuotaErrors(c *check.C) {
+	s.AddCleanup(daemon.MockServicestateSetQuota(func(st *state.State, update *quota.Group) (*state.TaskSet, error) {
+		return nil, errors.New(`cannot add snap "snap-a" to quota group "foo": snap is not installed`)
+	}))
+
+	for _, t := range []struct {
+		body, err string
+	}{
+		{`{"action": "ensure", "group-name": "foo", "snaps": ["snap-a"]}`, `cannot add snap "snap-a" to quota group "foo": snap is not installed`},
+		{`{"action": "ensure", "group-name": "-foo"}`, `invalid quota group name "-foo": .*`},
+		{`{"action": "frobnicate", "group-name": "foo"}`, `unknown quota action "frobnicate"`},
+		{`{"action": "ensure"`, `cannot decode quota action from request body: .*`},
+	} {
+		req, err := http.NewRequest("POST", "/v2/quotas", bytes.NewBufferString(t.body))
+		c.Assert(err, check.IsNil)
+
+		rsp := daemon.QuotaGroupsCmd.POST(daemon.QuotaGroupsCmd, req, nil).(*daemon.Resp)
+		c.Check(rsp.Status, check.Equals, 400)
+		c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Matches, t.err)
+	}
+}
+
+func (s *apiQuotaSuite) TestPostEnsureQuotaConflict(c *check.C) {
+	s.AddCleanup(daemon.MockServicestateSetQuota(func(st *state.State, update *quota.Group) (*state.TaskSet, error) {
+		return nil, &snapstate.ChangeConflictError{Snap: "snap-a", ChangeKind: "install"}
+	}))
+
+	body := bytes.NewBufferString(`{"action": "ensure", "group-name": "foo", "snaps": ["snap-a"]}`)
+	req, err := http.NewRequest("POST", "/v2/quotas", body)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.QuotaGroupsCmd.POST(daemon.QuotaGroupsCmd, req, nil).(*daemon.Resp)
+	c.Check(rsp.Status, check.Equals, 409)
+}
+
+func (s *apiQuotaSuite) TestPostRemoveQuota(c *check.C) {
+	s.mockQuotas()
+	var called int
+	s.AddCleanup(daemon.MockServicestateRemoveQuota(func(st *state.State, name string) (*state.TaskSet, error) {
+		called++
+		c.Check(name, check.Equals, "foo")
+		return state.NewTaskSet(st.NewTask("quota-control", "...")), nil
+	}))
+
+	body := bytes.NewBufferString(`{"action": "remove", "group-name": "foo"}`)
+	req, err := http.NewRequest("POST", "/v2/quotas", body)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.QuotaGroupsCmd.POST(daemon.QuotaGroupsCmd, req, nil).(*daemon.Resp)
+	c.Check(rsp.Status, check.Equals, 202)
+	c.Check(called, check.Equals, 1)
+
+	s.st.Lock()
+	defer s.st.Unlock()
+	chg := s.st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Kind(), check.Equals, "quota-control")
+	c.Check(chg.Summary(), check.Equals, `Remove quota group "foo"`)
+}
+
+func (s *apiQuotaSuite) TestPostRemoveQuotaErrors(c *check.C) {
+	s.mockQuotas()
+	s.AddCleanup(daemon.MockServicestateRemoveQuota(func(st *state.State, name string) (*state.TaskSet, error) {
+		c.Fatalf("unexpected call")
+		return nil, nil
+	}))
+
+	body := bytes.NewBufferString(`{"action": "remove", "group-name": "unknown"}`)
+	req, err := http.NewRequest("POST", "/v2/quotas", body)
+	c.Assert(err, check.IsNil)
+	rsp := daemon.QuotaGroupsCmd.POST(daemon.QuotaGroupsCmd, req, nil)
+	c.Check(rsp, check.DeepEquals, &daemon.Resp{
+		Status: 404,
+		Type:   "error",
+		Result: &daemon.ErrorResult{Message: `cannot find quota group "unknown"`},
+	})
+
+	body = bytes.NewBufferString(`{"action": "remove", "group-name": "foo", "snaps": ["snap-a"]}`)
+	req, err = http.NewRequest("POST", "/v2/quotas", body)
+	c.Assert(err, check.IsNil)
+	rsp = daemon.QuotaGroupsCmd.POST(daemon.QuotaGroupsCmd, req, nil)
+	c.Check(rsp, check.DeepEquals, &daemon.Resp{
+		Status: 400,
+		Type:   "error",
+		Result: &daemon.ErrorResult{Message: `cannot remove quota group "foo": unexpected snaps or limits`},
+	})
+}
@@ -0,0 +1,163 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/snapasserts"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snapbundle"
+)
+
+// bundledRevisionNewer returns whether the bundled revision of a snap is a
+// newer store revision than the installed one.
+func bundledRevisionNewer(bundled, installed snap.Revision) bool {
+	return bundled.Store() && installed.Store() && bundled.N > installed.N
+}
+
+// sideloadBundle installs all the snaps of the snap bundle at bundlePath
+// in one change, adding the bundle assertions to the system database once
+// all the snaps were validated against them. The snaps of the bundle are
+// installed in order, the last one being the snap the bundle was created
+// for; flags only apply to it.
+func sideloadBundle(st *state.State, bundlePath, origPath string, flags snapstate.Flags, dangerousOK bool) Response {
+	bundle, err := snapbundle.Unpack(bundlePath, dirs.SnapBlobDir, dirs.LocalInstallBlobTempPrefix)
+	if err != nil {
+		return BadRequest(err.Error())
+	}
+
+	// we are in charge of the unpacked snaps until we hand them off
+	// to the change
+	changeTriggered := false
+	defer func() {
+		if !changeTriggered {
+			for _, p := range bundle.Snaps {
+				os.Remove(p)
+			}
+		}
+	}()
+
+	st.Lock()
+	defer st.Unlock()
+
+	batch := asserts.NewBatch(nil)
+	for _, a := range bundle.Assertions {
+		if err := batch.Add(a); err != nil {
+			return BadRequest("cannot add snap bundle assertions: %v", err)
+		}
+	}
+	// check the snaps against a throwaway view of the system database
+	// with the bundle assertions, these are committed only once all the
+	// snaps were validated and their tasks created
+	db := assertstate.TemporaryDB(st)
+	if err := batch.CommitTo(db, &asserts.CommitOptions{Precheck: true}); err != nil {
+		return BadRequest("cannot add snap bundle assertions: %v", err)
+	}
+
+	type bundledSnap struct {
+		si    *snap.SideInfo
+		path  string
+		flags snapstate.Flags
+	}
+	var toInstall []bundledSnap
+	var names []string
+	var snapName string
+	for i, snapPath := range bundle.Snaps {
+		main := i == len(bundle.Snaps)-1
+		si, err := snapasserts.DeriveSideInfo(snapPath, db)
+		switch {
+		case err == nil:
+		case asserts.IsNotFound(err) && dangerousOK:
+			info, err := unsafeReadSnapInfo(snapPath)
+			if err != nil {
+				return BadRequest("cannot read snap file %q from bundle: %v", bundle.Names[i], err)
+			}
+			si = &snap.SideInfo{RealName: info.SnapName()}
+		case asserts.IsNotFound(err):
+			return BadRequest("cannot find signatures with metadata for snap %q from bundle", bundle.Names[i])
+		default:
+			return BadRequest(err.Error())
+		}
+		snapName = si.RealName
+
+		snapFlags := snapstate.Flags{RemoveSnapPath: true}
+		if main {
+			snapFlags = flags
+		} else {
+			// leave alone what is already there, unless the bundle
+			// carries a newer revision from the store
+			var snapst snapstate.SnapState
+			if err := snapstate.Get(st, snapName, &snapst); err != nil && err != state.ErrNoState {
+				return InternalError("cannot consult state: %v", err)
+			}
+			if snapst.IsInstalled() && !bundledRevisionNewer(si.Revision, snapst.Current) {
+				os.Remove(snapPath)
+				continue
+			}
+		}
+
+		toInstall = append(toInstall, bundledSnap{si: si, path: snapPath, flags: snapFlags})
+		names = append(names, snapName)
+	}
+
+	// fail before any task is created if any of the snaps is busy
+	if err := snapstate.CheckChangeConflictMany(st, names, ""); err != nil {
+		return errToResponse(err, names, InternalError, "cannot install snap file: %v")
+	}
+
+	tss := make([]*state.TaskSet, 0, len(toInstall))
+	for _, sn := range toInstall {
+		ts, _, err := snapstateInstallPath(st, sn.si, sn.path, sn.si.RealName, "", sn.flags)
+		if err != nil {
+			return errToResponse(err, []string{sn.si.RealName}, InternalError, "cannot install snap file: %v")
+		}
+		// install in order so that bases and content providers are
+		// in place before the snaps using them
+		if len(tss) > 0 {
+			ts.WaitAll(tss[len(tss)-1])
+		}
+		tss = append(tss, ts)
+	}
+
+	if err := assertstate.AddBatch(st, batch, &asserts.CommitOptions{Precheck: true}); err != nil {
+		return BadRequest("cannot add snap bundle assertions: %v", err)
+	}
+
+	msg := fmt.Sprintf(i18n.G("Install %q snap from bundle"), snapName)
+	if origPath != "" {
+		msg = fmt.Sprintf(i18n.G("Install %q snap from bundle %q"), snapName, origPath)
+	}
+	chg := newChange(st, "install-snap", msg, tss, names)
+	chg.Set("api-data", map[string]interface{}{"snap-name": snapName, "snap-names": names})
+
+	ensureStateSoon(st)
+
+	changeTriggered = true
+
+	return AsyncResponse(nil, &Meta{Change: chg.ID()})
+}
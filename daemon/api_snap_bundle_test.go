@@ -0,0 +1,336 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snapbundle"
+)
+
+type bundleSnap struct {
+	name     string
+	id       string
+	revision string
+	content  string
+}
+
+func (s *apiSuite) bundleAssertions(c *check.C, snaps []bundleSnap) []asserts.Assertion {
+	dev1Acct := assertstest.NewAccount(s.storeSigning, "devel1", nil, "")
+	as := []asserts.Assertion{s.storeSigning.StoreAccountKey(""), dev1Acct}
+	for _, sn := range snaps {
+		snapDecl, err := s.storeSigning.Sign(asserts.SnapDeclarationType, map[string]interface{}{
+			"series":       "16",
+			"snap-id":      sn.id,
+			"snap-name":    sn.name,
+			"publisher-id": dev1Acct.AccountID(),
+			"timestamp":    time.Now().Format(time.RFC3339),
+		}, nil, "")
+		c.Assert(err, check.IsNil)
+		p := filepath.Join(c.MkDir(), "snap")
+		c.Assert(ioutil.WriteFile(p, []byte(sn.content), 0644), check.IsNil)
+		sha3_384, size, err := asserts.SnapFileSHA3_384(p)
+		c.Assert(err, check.IsNil)
+		snapRev, err := s.storeSigning.Sign(asserts.SnapRevisionType, map[string]interface{}{
+			"snap-sha3-384": sha3_384,
+			"snap-size":     fmt.Sprint(size),
+			"snap-id":       sn.id,
+			"snap-revision": sn.revision,
+			"developer-id":  dev1Acct.AccountID(),
+			"timestamp":     time.Now().Format(time.RFC3339),
+		}, nil, "")
+		c.Assert(err, check.IsNil)
+		as = append(as, snapDecl, snapRev)
+	}
+	return as
+}
+
+func (s *apiSuite) bundleRequest(c *check.C, as []asserts.Assertion, snaps []bundleSnap, fields map[string]string) *http.Request {
+	dir := c.MkDir()
+	bundle := bytes.NewBuffer(nil)
+	w := snapbundle.NewWriter(bundle)
+	c.Assert(w.WriteAssertions(as), check.IsNil)
+	for _, sn := range snaps {
+		p := filepath.Join(dir, sn.name+"_"+sn.revision+".snap")
+		c.Assert(ioutil.WriteFile(p, []byte(sn.content), 0644), check.IsNil)
+		c.Assert(w.AddSnap(p), check.IsNil)
+	}
+	c.Assert(w.Close(), check.IsNil)
+
+	body := bytes.NewBuffer(nil)
+	mw := multipart.NewWriter(body)
+	for k, v := range fields {
+		c.Assert(mw.WriteField(k, v), check.IsNil)
+	}
+	fw, err := mw.CreateFormFile("snap", "x_41.bundle")
+	c.Assert(err, check.IsNil)
+	_, err = fw.Write(bundle.Bytes())
+	c.Assert(err, check.IsNil)
+	c.Assert(mw.Close(), check.IsNil)
+
+	req, err := http.NewRequest("POST", "/v2/snaps", body)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+var bundleSnaps = []bundleSnap{
+	{name: "core20", id: "core20-id", revision: "7", content: "base"},
+	{name: "x", id: "x-id", revision: "41", content: "app"},
+}
+
+type installPathCall struct {
+	si      *snap.SideInfo
+	content string
+	flags   snapstate.Flags
+}
+
+func (s *apiSuite) mockInstallPathForBundle(c *check.C) *[]installPathCall {
+	var calls []installPathCall
+	snapstateInstallPath = func(st *state.State, si *snap.SideInfo, path, name, channel string, flags snapstate.Flags) (*state.TaskSet, *snap.Info, error) {
+		c.Check(name, check.Equals, si.RealName)
+		c.Check(path, check.Matches, filepath.Join(dirs.SnapBlobDir, dirs.LocalInstallBlobTempPrefix)+".*")
+		content, err := ioutil.ReadFile(path)
+		c.Assert(err, check.IsNil)
+		calls = append(calls, installPathCall{si: si, content: string(content), flags: flags})
+		t := st.NewTask("fake-install-snap", "Doing a fake install of "+name)
+		return state.NewTaskSet(t), &snap.Info{SuggestedName: name}, nil
+	}
+	return &calls
+}
+
+func (s *apiSuite) TestSideloadSnapBundle(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+	c.Assert(os.MkdirAll(dirs.SnapBlobDir, 0755), check.IsNil)
+	calls := s.mockInstallPathForBundle(c)
+
+	as := s.bundleAssertions(c, bundleSnaps)
+	req := s.bundleRequest(c, as, bundleSnaps, map[string]string{"unaliased": "true"})
+
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
+
+	c.Check(*calls, check.DeepEquals, []installPathCall{{
+		si:      &snap.SideInfo{RealName: "core20", SnapID: "core20-id", Revision: snap.R(7)},
+		content: "base",
+		flags:   snapstate.Flags{RemoveSnapPath: true},
+	}, {
+		si:      &snap.SideInfo{RealName: "x", SnapID: "x-id", Revision: snap.R(41)},
+		content: "app",
+		flags:   snapstate.Flags{RemoveSnapPath: true, Unaliased: true},
+	}})
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	// the assertions were added
+	for _, a := range as {
+		_, err := a.Ref().Resolve(assertstate.DB(st).Find)
+		c.Check(err, check.IsNil)
+	}
+
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Kind(), check.Equals, "install-snap")
+	c.Check(chg.Summary(), check.Equals, `Install "x" snap from bundle "x_41.bundle"`)
+	tasks := chg.Tasks()
+	c.Assert(tasks, check.HasLen, 2)
+	c.Check(tasks[1].WaitTasks(), check.DeepEquals, []*state.Task{tasks[0]})
+	var names []string
+	c.Assert(chg.Get("snap-names", &names), check.IsNil)
+	c.Check(names, check.DeepEquals, []string{"core20", "x"})
+	var apiData map[string]interface{}
+	c.Assert(chg.Get("api-data", &apiData), check.IsNil)
+	c.Check(apiData, check.DeepEquals, map[string]interface{}{
+		"snap-name":  "x",
+		"snap-names": []interface{}{"core20", "x"},
+	})
+}
+
+func (s *apiSuite) testSideloadSnapBundleInstalledDependency(c *check.C, installed snap.Revision) (installedNames []string) {
+	d := s.daemonWithOverlordMock(c)
+	c.Assert(os.MkdirAll(dirs.SnapBlobDir, 0755), check.IsNil)
+	calls := s.mockInstallPathForBundle(c)
+
+	st := d.overlord.State()
+	st.Lock()
+	snapstate.Set(st, "core20", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "core20", SnapID: "core20-id", Revision: installed},
+		},
+		Current:  installed,
+		SnapType: "base",
+	})
+	st.Unlock()
+
+	as := s.bundleAssertions(c, bundleSnaps)
+	rsp := postSnaps(snapsCmd, s.bundleRequest(c, as, bundleSnaps, nil), nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
+
+	for _, call := range *calls {
+		installedNames = append(installedNames, call.si.RealName)
+	}
+
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Tasks(), check.HasLen, len(installedNames))
+
+	// only the snaps handed over to the change are left
+	leftover, _ := filepath.Glob(filepath.Join(dirs.SnapBlobDir, dirs.LocalInstallBlobTempPrefix+"*"))
+	c.Check(leftover, check.HasLen, len(installedNames))
+	return installedNames
+}
+
+// the bundle carries revision 7 of core20
+
+func (s *apiSuite) TestSideloadSnapBundleSkipsInstalled(c *check.C) {
+	installed := s.testSideloadSnapBundleInstalledDependency(c, snap.R(7))
+	c.Check(installed, check.DeepEquals, []string{"x"})
+}
+
+func (s *apiSuite) TestSideloadSnapBundleSkipsNewerInstalled(c *check.C) {
+	installed := s.testSideloadSnapBundleInstalledDependency(c, snap.R(9))
+	c.Check(installed, check.DeepEquals, []string{"x"})
+}
+
+func (s *apiSuite) TestSideloadSnapBundleSkipsLocalInstalled(c *check.C) {
+	installed := s.testSideloadSnapBundleInstalledDependency(c, snap.R("x1"))
+	c.Check(installed, check.DeepEquals, []string{"x"})
+}
+
+func (s *apiSuite) TestSideloadSnapBundleRefreshesOlderInstalled(c *check.C) {
+	installed := s.testSideloadSnapBundleInstalledDependency(c, snap.R(5))
+	c.Check(installed, check.DeepEquals, []string{"core20", "x"})
+}
+
+func (s *apiSuite) TestSideloadSnapBundleNoSignatures(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+	st := d.overlord.State()
+	c.Assert(os.MkdirAll(dirs.SnapBlobDir, 0755), check.IsNil)
+	calls := s.mockInstallPathForBundle(c)
+
+	// only the base is signed
+	as := s.bundleAssertions(c, bundleSnaps[:1])
+	rsp := postSnaps(snapsCmd, s.bundleRequest(c, as, bundleSnaps, nil), nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `cannot find signatures with metadata for snap "x_41.snap" from bundle`)
+	// nothing was installed
+	c.Check(*calls, check.HasLen, 0)
+	s.checkSideloadBundleNothingDone(c, st, as)
+}
+
+// checkSideloadBundleNothingDone checks that a failed sideload of a bundle
+// left no trace.
+func (s *apiSuite) checkSideloadBundleNothingDone(c *check.C, st *state.State, as []asserts.Assertion) {
+	st.Lock()
+	defer st.Unlock()
+	c.Check(st.Tasks(), check.HasLen, 0)
+	// the bundle assertions were not committed, besides the pre-existing
+	// store account key
+	for _, a := range as[1:] {
+		_, err := a.Ref().Resolve(assertstate.DB(st).Find)
+		c.Check(asserts.IsNotFound(err), check.Equals, true, check.Commentf("%v", a.Ref()))
+	}
+
+	// the unpacked snaps were removed
+	leftover, _ := filepath.Glob(filepath.Join(dirs.SnapBlobDir, "*"))
+	c.Check(leftover, check.HasLen, 0)
+}
+
+func (s *apiSuite) TestSideloadSnapBundleChangeConflict(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+	c.Assert(os.MkdirAll(dirs.SnapBlobDir, 0755), check.IsNil)
+	calls := s.mockInstallPathForBundle(c)
+
+	simulateConflict(d.overlord, "x")
+	st := d.overlord.State()
+	st.Lock()
+	conflicting := st.Tasks()
+	st.Unlock()
+
+	as := s.bundleAssertions(c, bundleSnaps)
+	rsp := postSnaps(snapsCmd, s.bundleRequest(c, as, bundleSnaps, nil), nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Result.(*errorResult).Kind, check.Equals, errorKindSnapChangeConflict)
+	c.Check(*calls, check.HasLen, 0)
+
+	st.Lock()
+	c.Check(st.Tasks(), check.DeepEquals, conflicting)
+	for _, a := range as[1:] {
+		_, err := a.Ref().Resolve(assertstate.DB(st).Find)
+		c.Check(asserts.IsNotFound(err), check.Equals, true)
+	}
+	st.Unlock()
+}
+
+func (s *apiSuite) TestSideloadSnapBundleInstallPathError(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+	c.Assert(os.MkdirAll(dirs.SnapBlobDir, 0755), check.IsNil)
+	snapstateInstallPath = func(st *state.State, si *snap.SideInfo, path, name, channel string, flags snapstate.Flags) (*state.TaskSet, *snap.Info, error) {
+		return nil, nil, fmt.Errorf("boom")
+	}
+
+	as := s.bundleAssertions(c, bundleSnaps)
+	rsp := postSnaps(snapsCmd, s.bundleRequest(c, as, bundleSnaps, nil), nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, "cannot install snap file: boom")
+	s.checkSideloadBundleNothingDone(c, d.overlord.State(), as)
+}
+
+func (s *apiSuite) TestSideloadSnapBundleInstanceName(c *check.C) {
+	s.daemonWithOverlordMock(c)
+	c.Assert(os.MkdirAll(dirs.SnapBlobDir, 0755), check.IsNil)
+
+	as := s.bundleAssertions(c, bundleSnaps)
+	rsp := postSnaps(snapsCmd, s.bundleRequest(c, as, bundleSnaps, map[string]string{"name": "x_foo"}), nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `cannot use instance name when installing a snap bundle`)
+}
+
+func (s *apiSuite) TestSideloadSnapBundleBadAssertions(c *check.C) {
+	s.daemonWithOverlordMock(c)
+	c.Assert(os.MkdirAll(dirs.SnapBlobDir, 0755), check.IsNil)
+
+	// missing the account key of the store
+	as := s.bundleAssertions(c, bundleSnaps)[1:]
+	rsp := postSnaps(snapsCmd, s.bundleRequest(c, as, bundleSnaps, nil), nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Result.(*errorResult).Message, check.Matches, `cannot add snap bundle assertions: .*`)
+}
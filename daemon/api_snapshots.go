@@ -28,7 +28,9 @@ import (
 	"strings"
 
 	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/strutil"
 )
@@ -42,6 +44,12 @@ var snapshotCmd = &Command{
 	POST:     changeSnapshots,
 }
 
+var snapshotExportCmd = &Command{
+	Path:     "/v2/snapshots/{id}/export",
+	PolkitOK: "io.snapcraft.snapd.manage",
+	GET:      getSnapshotExport,
+}
+
 func listSnapshots(c *Command, r *http.Request, user *auth.UserState) Response {
 	query := r.URL.Query()
 	var setID uint64
@@ -83,6 +91,11 @@ func (action snapshotAction) String() string {
 }
 
 func changeSnapshots(c *Command, r *http.Request, user *auth.UserState) Response {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == client.SnapshotExportMediaType {
+		return doSnapshotImport(c, r, user)
+	}
+
 	var action snapshotAction
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&action); err != nil {
@@ -137,3 +150,56 @@ func changeSnapshots(c *Command, r *http.Request, user *auth.UserState) Response
 
 	return AsyncResponse(nil, &Meta{Change: chg.ID()})
 }
+
+func doSnapshotImport(c *Command, r *http.Request, user *auth.UserState) Response {
+	st := c.d.overlord.State()
+	setID, snapNames, err := snapshotImport(context.TODO(), st, r.Body)
+	if err != nil {
+		if _, ok := err.(*backend.InvalidImportError); ok {
+			return BadRequest("%v", err)
+		}
+		return InternalError("%v", err)
+	}
+
+	result := map[string]interface{}{"set-id": setID, "snaps": snapNames}
+	return SyncResponse(result, nil)
+}
+
+func getSnapshotExport(c *Command, r *http.Request, user *auth.UserState) Response {
+	vars := muxVars(r)
+	sid := vars["id"]
+	setID, err := strconv.ParseUint(sid, 10, 64)
+	if err != nil {
+		return BadRequest("'id' must be a positive base 10 number; got %q", sid)
+	}
+
+	st := c.d.overlord.State()
+	export, err := snapshotExport(context.TODO(), st, setID)
+	switch err {
+	case nil:
+		// woo
+	case client.ErrSnapshotSetNotFound:
+		return NotFound("%v", err)
+	default:
+		return InternalError("cannot export snapshot set #%d: %v", setID, err)
+	}
+
+	return &snapshotExportResponse{SnapshotExport: export}
+}
+
+// A snapshotExportResponse's ServeHTTP method streams the snapshot set
+// export, closing it when done.
+type snapshotExportResponse struct {
+	*backend.SnapshotExport
+}
+
+// ServeHTTP from the Response interface
+func (s snapshotExportResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer s.SnapshotExport.Close()
+
+	w.Header().Set("Content-Length", strconv.FormatInt(s.Size(), 10))
+	w.Header().Set("Content-Type", client.SnapshotExportMediaType)
+	if err := s.StreamTo(w); err != nil {
+		logger.Debugf("cannot export snapshot: %v", err)
+	}
+}
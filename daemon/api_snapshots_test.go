@@ -23,7 +23,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 
 	"gopkg.in/check.v1"
@@ -33,6 +36,7 @@ import (
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/overlord"
 	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/store/storetest"
@@ -321,3 +325,121 @@ func (s *snapshotSuite) TestChangeSnapshot(c *check.C) {
 
 	}
 }
+
+func (s *snapshotSuite) TestExportSnapshots(c *check.C) {
+	var exportedSetID uint64
+	defer daemon.MockSnapshotExport(func(_ context.Context, _ *state.State, setID uint64) (*backend.SnapshotExport, error) {
+		exportedSetID = setID
+		return &backend.SnapshotExport{}, nil
+	})()
+	defer daemon.MockMuxVars(func(*http.Request) map[string]string {
+		return map[string]string{"id": "42"}
+	})()
+
+	c.Check(daemon.SnapshotExportCmd.Path, check.Equals, "/v2/snapshots/{id}/export")
+	req, err := http.NewRequest("GET", "/v2/snapshots/42/export", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.GetSnapshotExport(daemon.SnapshotExportCmd, req, nil)
+	c.Check(exportedSetID, check.Equals, uint64(42))
+
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, 200)
+	c.Check(rec.HeaderMap.Get("Content-Type"), check.Equals, "application/x.snapd.snapshot")
+	c.Check(rec.HeaderMap.Get("Content-Length"), check.Equals, "0")
+}
+
+func (s *snapshotSuite) TestExportSnapshotsBadRequest(c *check.C) {
+	defer daemon.MockSnapshotExport(func(context.Context, *state.State, uint64) (*backend.SnapshotExport, error) {
+		c.Fatal("snapshotExport should not be reached")
+		return nil, nil
+	})()
+	defer daemon.MockMuxVars(func(*http.Request) map[string]string {
+		return map[string]string{"id": "foo"}
+	})()
+
+	req, err := http.NewRequest("GET", "/v2/snapshots/foo/export", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.GetSnapshotExport(daemon.SnapshotExportCmd, req, nil).(*daemon.Resp)
+	c.Check(rsp.Type, check.Equals, daemon.ResponseTypeError)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.ErrorResult().Message, check.Equals, `'id' must be a positive base 10 number; got "foo"`)
+}
+
+func (s *snapshotSuite) TestExportSnapshotsErrors(c *check.C) {
+	var exportErr error
+	defer daemon.MockSnapshotExport(func(context.Context, *state.State, uint64) (*backend.SnapshotExport, error) {
+		return nil, exportErr
+	})()
+	defer daemon.MockMuxVars(func(*http.Request) map[string]string {
+		return map[string]string{"id": "42"}
+	})()
+
+	req, err := http.NewRequest("GET", "/v2/snapshots/42/export", nil)
+	c.Assert(err, check.IsNil)
+
+	for _, t := range []struct {
+		err    error
+		status int
+		msg    string
+	}{
+		{client.ErrSnapshotSetNotFound, 404, client.ErrSnapshotSetNotFound.Error()},
+		{errors.New("bzzt"), 500, "cannot export snapshot set #42: bzzt"},
+	} {
+		exportErr = t.err
+		rsp := daemon.GetSnapshotExport(daemon.SnapshotExportCmd, req, nil).(*daemon.Resp)
+		c.Check(rsp.Type, check.Equals, daemon.ResponseTypeError)
+		c.Check(rsp.Status, check.Equals, t.status)
+		c.Check(rsp.ErrorResult().Message, check.Equals, t.msg)
+	}
+}
+
+func (s *snapshotSuite) TestImportSnapshot(c *check.C) {
+	defer daemon.MockSnapshotImport(func(_ context.Context, _ *state.State, r io.Reader) (uint64, []string, error) {
+		data, err := ioutil.ReadAll(r)
+		c.Assert(err, check.IsNil)
+		c.Check(string(data), check.Equals, "export-stream")
+		return 42, []string{"foo", "bar"}, nil
+	})()
+
+	req, err := http.NewRequest("POST", "/v2/snapshots", strings.NewReader("export-stream"))
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", client.SnapshotExportMediaType)
+
+	rsp := daemon.ChangeSnapshots(daemon.SnapshotCmd, req, nil)
+	c.Check(rsp.Type, check.Equals, daemon.ResponseTypeSync)
+	c.Check(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result, check.DeepEquals, map[string]interface{}{"set-id": uint64(42), "snaps": []string{"foo", "bar"}})
+}
+
+func (s *snapshotSuite) TestImportSnapshotError(c *check.C) {
+	defer daemon.MockSnapshotImport(func(context.Context, *state.State, io.Reader) (uint64, []string, error) {
+		return 0, nil, &backend.InvalidImportError{Message: "cannot import snapshot: bzzt"}
+	})()
+
+	req, err := http.NewRequest("POST", "/v2/snapshots", strings.NewReader(""))
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", client.SnapshotExportMediaType)
+
+	rsp := daemon.ChangeSnapshots(daemon.SnapshotCmd, req, nil)
+	c.Check(rsp.Type, check.Equals, daemon.ResponseTypeError)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.ErrorResult().Message, check.Equals, "cannot import snapshot: bzzt")
+}
+
+func (s *snapshotSuite) TestImportSnapshotInternalError(c *check.C) {
+	defer daemon.MockSnapshotImport(func(context.Context, *state.State, io.Reader) (uint64, []string, error) {
+		return 0, nil, errors.New("no space left on device")
+	})()
+
+	req, err := http.NewRequest("POST", "/v2/snapshots", strings.NewReader(""))
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", client.SnapshotExportMediaType)
+
+	rsp := daemon.ChangeSnapshots(daemon.SnapshotCmd, req, nil)
+	c.Check(rsp.Type, check.Equals, daemon.ResponseTypeError)
+	c.Check(rsp.Status, check.Equals, 500)
+	c.Check(rsp.ErrorResult().Message, check.Equals, "no space left on device")
+}
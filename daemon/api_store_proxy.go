@@ -0,0 +1,140 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/configstate"
+	"github.com/snapcore/snapd/overlord/configstate/proxyconf"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/store"
+)
+
+var storeProxyCmd = &Command{
+	Path: "/v2/store-proxy",
+	POST: postStoreProxy,
+}
+
+var assertstateFetchProxyStore = assertstate.FetchProxyStore
+
+type storeProxyInstruction struct {
+	URL string `json:"url"`
+}
+
+// storeProxyConnectivityCheck checks the connectivity to the store
+// described by storeAs as if it was the store of the device.
+var storeProxyConnectivityCheck = func(st *state.State, storeAs *asserts.Store) (map[string]bool, error) {
+	cfg := store.DefaultConfig()
+	cfg.StoreBaseURL = storeAs.URL()
+	cfg.AssertionsBaseURL = storeAs.URL()
+	cfg.Proxy = proxyconf.New(st).Conf
+	if deviceCtx, err := snapstate.DeviceCtxFromState(st, nil); err == nil {
+		cfg.StoreID = deviceCtx.Model().Store()
+	}
+	sto := store.New(cfg, nil)
+
+	st.Unlock()
+	defer st.Lock()
+	return sto.ConnectivityCheck()
+}
+
+func storeProxyUnreachable(format string, v ...interface{}) Response {
+	return SyncResponse(&resp{
+		Type:   ResponseTypeError,
+		Result: &errorResult{Message: fmt.Sprintf(format, v...), Kind: errorKindStoreProxyUnreachable},
+		Status: 400,
+	}, nil)
+}
+
+// postStoreProxy sets up the snap store proxy at the given URL as the
+// store of the device. The previous store is kept if the proxy cannot be
+// reached.
+func postStoreProxy(c *Command, r *http.Request, user *auth.UserState) Response {
+	var inst storeProxyInstruction
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(&inst); err != nil {
+		return BadRequest("cannot decode request body into store proxy instruction: %v", err)
+	}
+	proxyURL, err := url.Parse(inst.URL)
+	if err != nil {
+		return BadRequest("cannot parse store proxy URL: %v", err)
+	}
+	if (proxyURL.Scheme != "http" && proxyURL.Scheme != "https") || proxyURL.Host == "" {
+		return BadRequest("cannot use store proxy URL %q: only http and https URLs are supported", inst.URL)
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	storeAs, err := assertstateFetchProxyStore(st, proxyURL)
+	if _, ok := err.(*assertstate.ProxyStoreUnreachableError); ok {
+		return storeProxyUnreachable("cannot set up store proxy: %v", err)
+	}
+	if err != nil {
+		return InternalError("cannot set up store proxy: %v", err)
+	}
+	if storeAs.URL() == nil {
+		return InternalError("cannot set up store proxy: store assertion for %q has no url", storeAs.Store())
+	}
+
+	status, err := storeProxyConnectivityCheck(st, storeAs)
+	if err == nil {
+		var unreachable []string
+		for host, ok := range status {
+			if !ok {
+				unreachable = append(unreachable, host)
+			}
+		}
+		if len(unreachable) > 0 {
+			sort.Strings(unreachable)
+			err = fmt.Errorf("cannot reach %s", strings.Join(unreachable, ", "))
+		}
+	}
+	if err != nil {
+		return storeProxyUnreachable("cannot set up store proxy: connectivity check failed: %v", err)
+	}
+
+	// proxy.store is set like any other option so that it is
+	// validated and the configure hook runs
+	patch := map[string]interface{}{"proxy.store": storeAs.Store()}
+	ts, err := configstate.ConfigureInstalled(st, "core", patch, 0)
+	if err != nil {
+		return errToResponse(err, nil, InternalError, "cannot set up store proxy: %v")
+	}
+
+	summary := fmt.Sprintf("Use store %q served by %s", storeAs.Store(), inst.URL)
+	chg := newChange(st, "set-store-proxy", summary, []*state.TaskSet{ts}, nil)
+	chg.Set("api-data", map[string]string{"store": storeAs.Store()})
+
+	ensureStateSoon(st)
+
+	return AsyncResponse(nil, &Meta{Change: chg.ID()})
+}
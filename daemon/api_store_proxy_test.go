@@ -0,0 +1,238 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon_test
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/daemon"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/testutil"
+)
+
+var _ = check.Suite(&storeProxySuite{})
+
+type storeProxySuite struct {
+	testutil.BaseTest
+
+	o *overlord.Overlord
+	d *daemon.Daemon
+
+	storeAs *asserts.Store
+
+	fetchedURL *url.URL
+	fetchErr   error
+
+	// the store checked for connectivity
+	checkedStore *asserts.Store
+	status       map[string]bool
+	checkErr     error
+}
+
+func (s *storeProxySuite) SetUpTest(c *check.C) {
+	s.BaseTest.SetUpTest(c)
+
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	storeSigning := assertstest.NewStoreStack("can0nical", nil)
+	a, err := storeSigning.Sign(asserts.StoreType, map[string]interface{}{
+		"store":       "proxy-store",
+		"operator-id": "can0nical",
+		"url":         "https://proxy.example.com",
+		"timestamp":   time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, check.IsNil)
+	s.storeAs = a.(*asserts.Store)
+
+	s.fetchedURL = nil
+	s.fetchErr = nil
+	s.checkedStore = nil
+	s.status = map[string]bool{"proxy.example.com": true}
+	s.checkErr = nil
+
+	s.AddCleanup(daemon.MockAssertstateFetchProxyStore(func(st *state.State, proxyURL *url.URL) (*asserts.Store, error) {
+		s.fetchedURL = proxyURL
+		if s.fetchErr != nil {
+			return nil, s.fetchErr
+		}
+		return s.storeAs, nil
+	}))
+	s.AddCleanup(daemon.MockStoreProxyConnectivityCheck(func(st *state.State, storeAs *asserts.Store) (map[string]bool, error) {
+		s.checkedStore = storeAs
+		return s.status, s.checkErr
+	}))
+
+	s.o = overlord.Mock()
+	s.d = daemon.NewWithOverlord(s.o)
+}
+
+func (s *storeProxySuite) setProxyStore(storeID string) {
+	st := s.o.State()
+	st.Lock()
+	defer st.Unlock()
+	tr := config.NewTransaction(st)
+	tr.Set("core", "proxy.store", storeID)
+	tr.Commit()
+}
+
+func (s *storeProxySuite) proxyStore(c *check.C) string {
+	st := s.o.State()
+	st.Lock()
+	defer st.Unlock()
+	var storeID string
+	tr := config.NewTransaction(st)
+	c.Assert(tr.GetMaybe("core", "proxy.store", &storeID), check.IsNil)
+	return storeID
+}
+
+func (s *storeProxySuite) post(c *check.C, body string) *daemon.Resp {
+	req, err := http.NewRequest("POST", "/v2/store-proxy", strings.NewReader(body))
+	c.Assert(err, check.IsNil)
+	return daemon.StoreProxyCmd.POST(daemon.StoreProxyCmd, req, nil).(*daemon.Resp)
+}
+
+func (s *storeProxySuite) checkNoChanges(c *check.C) {
+	st := s.o.State()
+	st.Lock()
+	defer st.Unlock()
+	c.Check(st.Changes(), check.HasLen, 0)
+}
+
+func (s *storeProxySuite) TestSetStoreProxy(c *check.C) {
+	s.setProxyStore("old-store")
+
+	rsp := s.post(c, `{"url": "https://proxy.example.com"}`)
+	c.Assert(rsp.Status, check.Equals, 202)
+	c.Check(rsp.Type, check.Equals, daemon.ResponseTypeAsync)
+	c.Check(s.fetchedURL.String(), check.Equals, "https://proxy.example.com")
+	c.Check(s.checkedStore, check.Equals, s.storeAs)
+	// the store is switched by the change
+	c.Check(s.proxyStore(c), check.Equals, "old-store")
+
+	st := s.o.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Kind(), check.Equals, "set-store-proxy")
+	c.Check(chg.Summary(), check.Equals, `Use store "proxy-store" served by https://proxy.example.com`)
+	var data map[string]string
+	c.Assert(chg.Get("api-data", &data), check.IsNil)
+	c.Check(data, check.DeepEquals, map[string]string{"store": "proxy-store"})
+
+	// proxy.store is set through the configure hook of core
+	tasks := chg.Tasks()
+	c.Assert(tasks, check.HasLen, 1)
+	c.Check(tasks[0].Kind(), check.Equals, "run-hook")
+	var hooksup hookstate.HookSetup
+	c.Assert(tasks[0].Get("hook-setup", &hooksup), check.IsNil)
+	c.Check(hooksup.Snap, check.Equals, "core")
+	c.Check(hooksup.Hook, check.Equals, "configure")
+	var hookContext map[string]interface{}
+	c.Assert(tasks[0].Get("hook-context", &hookContext), check.IsNil)
+	c.Check(hookContext["patch"], check.DeepEquals, map[string]interface{}{"proxy.store": "proxy-store"})
+}
+
+func (s *storeProxySuite) TestSetStoreProxyBadURL(c *check.C) {
+	for _, body := range []string{
+		`{"url": "ftp://proxy.example.com"}`,
+		`{"url": "proxy.example.com"}`,
+		`{"url": "https://"}`,
+	} {
+		rsp := s.post(c, body)
+		c.Check(rsp.Status, check.Equals, 400, check.Commentf(body))
+		c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Matches, `cannot use store proxy URL ".*": only http and https URLs are supported`)
+	}
+	c.Check(s.fetchedURL, check.IsNil)
+
+	rsp := s.post(c, `{"url": 42}`)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Matches, `cannot decode request body into store proxy instruction: .*`)
+}
+
+func (s *storeProxySuite) TestSetStoreProxyFetchError(c *check.C) {
+	s.fetchErr = errors.New("boom")
+
+	rsp := s.post(c, `{"url": "https://proxy.example.com"}`)
+	c.Check(rsp.Status, check.Equals, 500)
+	c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Equals, "cannot set up store proxy: boom")
+	c.Check(s.checkedStore, check.IsNil)
+	s.checkNoChanges(c)
+}
+
+func (s *storeProxySuite) TestSetStoreProxyFetchUnreachable(c *check.C) {
+	proxyURL, err := url.Parse("https://proxy.example.com")
+	c.Assert(err, check.IsNil)
+	s.fetchErr = &assertstate.ProxyStoreUnreachableError{URL: proxyURL, Err: errors.New("no route to host")}
+
+	rsp := s.post(c, `{"url": "https://proxy.example.com"}`)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result, check.DeepEquals, &daemon.ErrorResult{
+		Message: "cannot set up store proxy: cannot reach snap store proxy at https://proxy.example.com: no route to host",
+		Kind:    "store-proxy-unreachable",
+	})
+	s.checkNoChanges(c)
+}
+
+func (s *storeProxySuite) TestSetStoreProxyUnreachableKeepsPrevious(c *check.C) {
+	s.setProxyStore("old-store")
+	s.status = map[string]bool{
+		"proxy.example.com":     false,
+		"api.proxy.example.com": false,
+		"other.example.com":     true,
+	}
+
+	rsp := s.post(c, `{"url": "https://proxy.example.com"}`)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result, check.DeepEquals, &daemon.ErrorResult{
+		Message: "cannot set up store proxy: connectivity check failed: cannot reach api.proxy.example.com, proxy.example.com",
+		Kind:    "store-proxy-unreachable",
+	})
+	c.Check(s.checkedStore, check.Equals, s.storeAs)
+	c.Check(s.proxyStore(c), check.Equals, "old-store")
+	s.checkNoChanges(c)
+}
+
+func (s *storeProxySuite) TestSetStoreProxyCheckErrorKeepsPrevious(c *check.C) {
+	s.checkErr = errors.New("no network")
+
+	rsp := s.post(c, `{"url": "https://proxy.example.com"}`)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result, check.DeepEquals, &daemon.ErrorResult{
+		Message: "cannot set up store proxy: connectivity check failed: no network",
+		Kind:    "store-proxy-unreachable",
+	})
+	c.Check(s.proxyStore(c), check.Equals, "")
+	s.checkNoChanges(c)
+}
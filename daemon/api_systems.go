@@ -0,0 +1,165 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/devicestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+)
+
+var (
+	systemsCmd = &Command{
+		Path: "/v2/systems",
+		GET:  getSystems,
+		POST: postSystems,
+	}
+
+	systemsActionCmd = &Command{
+		Path: "/v2/systems/{label}",
+		POST: postSystemAction,
+	}
+)
+
+var (
+	devicestateSystems              = devicestate.Systems
+	devicestateCreateRecoverySystem = devicestate.CreateRecoverySystem
+	devicestateRequestSystemAction  = devicestate.RequestSystemAction
+	devicestateFactoryReset         = devicestate.FactoryReset
+)
+
+func getSystems(c *Command, r *http.Request, _ *auth.UserState) Response {
+	systems, err := devicestateSystems()
+	if err != nil {
+		return InternalError("cannot list recovery systems: %v", err)
+	}
+
+	results := make([]client.System, len(systems))
+	for i, system := range systems {
+		results[i] = client.System{
+			Label: system.Label,
+			Model: client.SystemModelData{
+				Model:       system.Model.Model(),
+				BrandID:     system.Model.BrandID(),
+				DisplayName: system.Model.DisplayName(),
+			},
+		}
+	}
+	return SyncResponse(results, nil)
+}
+
+type postSystemsData struct {
+	Action     string `json:"action"`
+	Label      string `json:"label,omitempty"`
+	KeepSerial bool   `json:"keep-serial,omitempty"`
+}
+
+func postSystems(c *Command, r *http.Request, _ *auth.UserState) Response {
+	var data postSystemsData
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return BadRequest("cannot decode request body into recovery system action: %v", err)
+	}
+	switch data.Action {
+	case "create":
+		return createRecoverySystem(c, &data)
+	case "factory-reset":
+		return factoryReset(c, &data)
+	default:
+		return BadRequest("unsupported recovery system action %q", data.Action)
+	}
+}
+
+func createRecoverySystem(c *Command, data *postSystemsData) Response {
+	if data.Label == "" {
+		return BadRequest("recovery system label must be provided")
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	chg, err := devicestateCreateRecoverySystem(st, data.Label)
+	if err != nil {
+		if cce, ok := err.(*snapstate.ChangeConflictError); ok {
+			return SnapChangeConflict(cce)
+		}
+		return BadRequest("cannot create recovery system: %v", err)
+	}
+	ensureStateSoon(st)
+
+	return AsyncResponse(nil, &Meta{Change: chg.ID()})
+}
+
+func factoryReset(c *Command, data *postSystemsData) Response {
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	opts := &devicestate.FactoryResetOptions{KeepSerial: data.KeepSerial}
+	chg, err := devicestateFactoryReset(st, opts)
+	if err != nil {
+		if cce, ok := err.(*snapstate.ChangeConflictError); ok {
+			return SnapChangeConflict(cce)
+		}
+		return BadRequest("cannot factory reset: %v", err)
+	}
+	ensureStateSoon(st)
+
+	return AsyncResponse(nil, &Meta{Change: chg.ID()})
+}
+
+type postSystemActionData struct {
+	Action string `json:"action"`
+	Mode   string `json:"mode"`
+}
+
+func postSystemAction(c *Command, r *http.Request, _ *auth.UserState) Response {
+	label := muxVars(r)["label"]
+
+	var data postSystemActionData
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return BadRequest("cannot decode request body into system action: %v", err)
+	}
+	if data.Action != "do" {
+		return BadRequest("unsupported system action %q", data.Action)
+	}
+	if data.Mode == "" {
+		return BadRequest("system action requires the mode to be provided")
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	err := devicestateRequestSystemAction(st, label, data.Mode)
+	if err == devicestate.ErrNoSystem {
+		return NotFound("cannot find recovery system %q", label)
+	}
+	if err != nil {
+		return BadRequest("cannot request system action: %v", err)
+	}
+	return SyncResponse(nil, nil)
+}
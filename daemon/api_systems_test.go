@@ -0,0 +1,261 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/daemon"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord"
+	"github.com/snapcore/snapd/overlord/devicestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/testutil"
+)
+
+var _ = check.Suite(&apiSystemsSuite{})
+
+type apiSystemsSuite struct {
+	testutil.BaseTest
+
+	d  *daemon.Daemon
+	st *state.State
+}
+
+func (s *apiSystemsSuite) SetUpTest(c *check.C) {
+	s.BaseTest.SetUpTest(c)
+
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	o := overlord.Mock()
+	s.d = daemon.NewWithOverlord(o)
+	s.st = o.State()
+}
+
+func (s *apiSystemsSuite) TestListSystems(c *check.C) {
+	model := assertstest.FakeAssertion(map[string]interface{}{
+		"type":         "model",
+		"authority-id": "my-brand",
+		"series":       "16",
+		"brand-id":     "my-brand",
+		"model":        "my-model",
+		"display-name": "My Model",
+		"architecture": "amd64",
+		"gadget":       "pc",
+		"kernel":       "pc-kernel",
+	}).(*asserts.Model)
+	s.AddCleanup(daemon.MockDevicestateSystems(func() ([]*devicestate.System, error) {
+		return []*devicestate.System{
+			{Label: "20191119", Model: model},
+			{Label: "20191120", Model: model},
+		}, nil
+	}))
+
+	req, err := http.NewRequest("GET", "/v2/systems", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.SystemsCmd.GET(daemon.SystemsCmd, req, nil)
+	modelData := client.SystemModelData{
+		Model:       "my-model",
+		BrandID:     "my-brand",
+		DisplayName: "My Model",
+	}
+	c.Check(rsp, check.DeepEquals, &daemon.Resp{
+		Status: 200,
+		Type:   "sync",
+		Result: []client.System{
+			{Label: "20191119", Model: modelData},
+			{Label: "20191120", Model: modelData},
+		},
+	})
+}
+
+func (s *apiSystemsSuite) TestListSystemsError(c *check.C) {
+	s.AddCleanup(daemon.MockDevicestateSystems(func() ([]*devicestate.System, error) {
+		return nil, errors.New("boom")
+	}))
+
+	req, err := http.NewRequest("GET", "/v2/systems", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.SystemsCmd.GET(daemon.SystemsCmd, req, nil).(*daemon.Resp)
+	c.Check(rsp.Status, check.Equals, 500)
+	c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Equals, "cannot list recovery systems: boom")
+}
+
+func (s *apiSystemsSuite) TestCreateRecoverySystem(c *check.C) {
+	s.AddCleanup(daemon.MockDevicestateCreateRecoverySystem(func(st *state.State, label string) (*state.Change, error) {
+		c.Check(label, check.Equals, "20191119")
+		return st.NewChange("create-recovery-system", "..."), nil
+	}))
+
+	body := bytes.NewBufferString(`{"action": "create", "label": "20191119"}`)
+	req, err := http.NewRequest("POST", "/v2/systems", body)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.SystemsCmd.POST(daemon.SystemsCmd, req, nil).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 202)
+
+	s.st.Lock()
+	defer s.st.Unlock()
+	chg := s.st.Change(rsp.Meta.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Kind(), check.Equals, "create-recovery-system")
+}
+
+func (s *apiSystemsSuite) TestCreateRecoverySystemErrors(c *check.C) {
+	s.AddCleanup(daemon.MockDevicestateCreateRecoverySystem(func(st *state.State, label string) (*state.Change, error) {
+		if label == "busy" {
+			return nil, &snapstate.ChangeConflictError{Message: "cannot create a recovery system, another one is being created"}
+		}
+		return nil, errors.New(`recovery system "20191119" already exists`)
+	}))
+
+	for _, t := range []struct {
+		body   string
+		status int
+		err    string
+	}{
+		{`{"action": "create", "label": "20191119"}`, 400, `cannot create recovery system: recovery system "20191119" already exists`},
+		{`{"action": "create", "label": "busy"}`, 409, `cannot create a recovery system, another one is being created`},
+		{`{"action": "create"}`, 400, `recovery system label must be provided`},
+		{`{"action": "destroy", "label": "20191119"}`, 400, `unsupported recovery system action "destroy"`},
+		{`{"action": "create"`, 400, `cannot decode request body into recovery system action: .*`},
+	} {
+		req, err := http.NewRequest("POST", "/v2/systems", bytes.NewBufferString(t.body))
+		c.Assert(err, check.IsNil)
+
+		rsp := daemon.SystemsCmd.POST(daemon.SystemsCmd, req, nil).(*daemon.Resp)
+		c.Check(rsp.Status, check.Equals, t.status, check.Commentf(t.body))
+		c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Matches, t.err)
+	}
+}
+
+func (s *apiSystemsSuite) TestSystemAction(c *check.C) {
+	s.AddCleanup(daemon.MockMuxVars(func(*http.Request) map[string]string {
+		return map[string]string{"label": "20191119"}
+	}))
+	var called int
+	s.AddCleanup(daemon.MockDevicestateRequestSystemAction(func(st *state.State, label, mode string) error {
+		called++
+		c.Check(label, check.Equals, "20191119")
+		c.Check(mode, check.Equals, "recover")
+		return nil
+	}))
+
+	body := bytes.NewBufferString(`{"action": "do", "mode": "recover"}`)
+	req, err := http.NewRequest("POST", "/v2/systems/20191119", body)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.SystemsActionCmd.POST(daemon.SystemsActionCmd, req, nil)
+	c.Check(rsp, check.DeepEquals, &daemon.Resp{
+		Status: 200,
+		Type:   "sync",
+	})
+	c.Check(called, check.Equals, 1)
+}
+
+func (s *apiSystemsSuite) TestSystemActionErrors(c *check.C) {
+	s.AddCleanup(daemon.MockMuxVars(func(*http.Request) map[string]string {
+		return map[string]string{"label": "20191119"}
+	}))
+	s.AddCleanup(daemon.MockDevicestateRequestSystemAction(func(st *state.State, label, mode string) error {
+		if mode == "install" {
+			return devicestate.ErrNoSystem
+		}
+		return errors.New(`invalid system mode "reinstall"`)
+	}))
+
+	for _, t := range []struct {
+		body   string
+		status int
+		err    string
+	}{
+		{`{"action": "do", "mode": "install"}`, 404, `cannot find recovery system "20191119"`},
+		{`{"action": "do", "mode": "reinstall"}`, 400, `cannot request system action: invalid system mode "reinstall"`},
+		{`{"action": "do"}`, 400, `system action requires the mode to be provided`},
+		{`{"action": "undo", "mode": "run"}`, 400, `unsupported system action "undo"`},
+		{`{"action"`, 400, `cannot decode request body into system action: .*`},
+	} {
+		req, err := http.NewRequest("POST", "/v2/systems/20191119", bytes.NewBufferString(t.body))
+		c.Assert(err, check.IsNil)
+
+		rsp := daemon.SystemsActionCmd.POST(daemon.SystemsActionCmd, req, nil).(*daemon.Resp)
+		c.Check(rsp.Status, check.Equals, t.status, check.Commentf(t.body))
+		c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Matches, t.err)
+	}
+}
+
+func (s *apiSystemsSuite) TestFactoryReset(c *check.C) {
+	var called int
+	s.AddCleanup(daemon.MockDevicestateFactoryReset(func(st *state.State, opts *devicestate.FactoryResetOptions) (*state.Change, error) {
+		called++
+		c.Check(opts, check.DeepEquals, &devicestate.FactoryResetOptions{KeepSerial: true})
+		return st.NewChange("factory-reset", "..."), nil
+	}))
+
+	body := bytes.NewBufferString(`{"action": "factory-reset", "keep-serial": true}`)
+	req, err := http.NewRequest("POST", "/v2/systems", body)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.SystemsCmd.POST(daemon.SystemsCmd, req, nil).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 202)
+	c.Check(called, check.Equals, 1)
+
+	s.st.Lock()
+	defer s.st.Unlock()
+	chg := s.st.Change(rsp.Meta.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Kind(), check.Equals, "factory-reset")
+}
+
+func (s *apiSystemsSuite) TestFactoryResetErrors(c *check.C) {
+	s.AddCleanup(daemon.MockDevicestateFactoryReset(func(st *state.State, opts *devicestate.FactoryResetOptions) (*state.Change, error) {
+		if opts.KeepSerial {
+			return nil, errors.New("cannot keep the serial of a device that is not registered yet")
+		}
+		return nil, &snapstate.ChangeConflictError{Message: "cannot factory reset while other changes are in progress"}
+	}))
+
+	for _, t := range []struct {
+		body   string
+		status int
+		err    string
+	}{
+		{`{"action": "factory-reset", "keep-serial": true}`, 400, `cannot factory reset: cannot keep the serial of a device that is not registered yet`},
+		{`{"action": "factory-reset"}`, 409, `cannot factory reset while other changes are in progress`},
+	} {
+		req, err := http.NewRequest("POST", "/v2/systems", bytes.NewBufferString(t.body))
+		c.Assert(err, check.IsNil)
+
+		rsp := daemon.SystemsCmd.POST(daemon.SystemsCmd, req, nil).(*daemon.Resp)
+		c.Check(rsp.Status, check.Equals, t.status, check.Commentf(t.body))
+		c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Matches, t.err)
+	}
+}
@@ -55,6 +55,7 @@ import (
 	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/interfaces/builtin"
 	"github.com/snapcore/snapd/interfaces/ifacetest"
+	"github.com/snapcore/snapd/netutil"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord"
 	"github.com/snapcore/snapd/overlord/assertstate"
@@ -105,11 +106,13 @@ type apiBaseSuite struct {
 	sysctlArgses      [][]string
 	sysctlBufs        [][]byte
 	sysctlErrs        []error
+	sysctlVersion     string
 
 	journalctlRestorer func()
 	jctlSvcses         [][]string
 	jctlNs             []int
 	jctlFollows        []bool
+	jctlOpts           []*systemd.LogOptions
 	jctlRCs            []io.ReadCloser
 	jctlErrs           []error
 
@@ -228,7 +231,12 @@ func (s *apiBaseSuite) TearDownSuite(c *check.C) {
 func (s *apiBaseSuite) systemctl(args ...string) (buf []byte, err error) {
 	s.sysctlArgses = append(s.sysctlArgses, args)
 
-	if args[0] != "show" && args[0] != "start" && args[0] != "stop" && args[0] != "restart" {
+	if args[0] == "--version" {
+		return []byte(s.sysctlVersion), nil
+	}
+
+	// the enabled state of user services is queried via --user --global
+	if args[0] != "show" && args[0] != "start" && args[0] != "stop" && args[0] != "restart" && args[0] != "--user" {
 		panic(fmt.Sprintf("unexpected systemctl call: %v", args))
 	}
 
@@ -242,10 +250,11 @@ func (s *apiBaseSuite) systemctl(args ...string) (buf []byte, err error) {
 	return buf, err
 }
 
-func (s *apiBaseSuite) journalctl(svcs []string, n int, follow bool) (rc io.ReadCloser, err error) {
+func (s *apiBaseSuite) journalctl(svcs []string, opts *systemd.LogOptions) (rc io.ReadCloser, err error) {
 	s.jctlSvcses = append(s.jctlSvcses, svcs)
-	s.jctlNs = append(s.jctlNs, n)
-	s.jctlFollows = append(s.jctlFollows, follow)
+	s.jctlNs = append(s.jctlNs, opts.N)
+	s.jctlFollows = append(s.jctlFollows, opts.Follow)
+	s.jctlOpts = append(s.jctlOpts, opts)
 
 	if len(s.jctlErrs) > 0 {
 		err, s.jctlErrs = s.jctlErrs[0], s.jctlErrs[1:]
@@ -261,9 +270,11 @@ func (s *apiBaseSuite) SetUpTest(c *check.C) {
 	s.sysctlArgses = nil
 	s.sysctlBufs = nil
 	s.sysctlErrs = nil
+	s.sysctlVersion = "systemd 245 (245.4-4ubuntu3.11)\n"
 	s.jctlSvcses = nil
 	s.jctlNs = nil
 	s.jctlFollows = nil
+	s.jctlOpts = nil
 	s.jctlRCs = nil
 	s.jctlErrs = nil
 
@@ -300,6 +311,8 @@ func (s *apiBaseSuite) SetUpTest(c *check.C) {
 	snapstateInstallPath = nil
 	snapstateRefreshCandidates = nil
 	snapstateRemoveMany = nil
+	snapstateHoldRefresh = nil
+	snapstateUnholdRefresh = nil
 	snapstateRevert = nil
 	snapstateRevertToRevision = nil
 	snapstateTryPath = nil
@@ -325,6 +338,8 @@ func (s *apiBaseSuite) TearDownTest(c *check.C) {
 	snapstateInstallPath = snapstate.InstallPath
 	snapstateRefreshCandidates = snapstate.RefreshCandidates
 	snapstateRemoveMany = snapstate.RemoveMany
+	snapstateHoldRefresh = snapstate.HoldRefresh
+	snapstateUnholdRefresh = snapstate.UnholdRefresh
 	snapstateRevert = snapstate.Revert
 	snapstateRevertToRevision = snapstate.RevertToRevision
 	snapstateTryPath = snapstate.TryPath
@@ -1666,6 +1681,25 @@ func (s *apiSuite) TestSnapsInfoOnlyLocal(c *check.C) {
 	})
 }
 
+func (s *apiSuite) TestSnapsInfoOnlyLocalHeld(c *check.C) {
+	d := s.daemon(c)
+
+	s.mkInstalledInState(c, d, "local", "foo", "v1", snap.R(10), true, "")
+	st := s.d.overlord.State()
+	st.Lock()
+	c.Assert(snapstate.HoldRefresh(st, time.Time{}, "local"), check.IsNil)
+	st.Unlock()
+
+	req, err := http.NewRequest("GET", "/v2/snaps?sources=local", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := getSnapsInfo(snapsCmd, req, nil).(*resp)
+
+	snaps := snapList(rsp.Result)
+	c.Assert(snaps, check.HasLen, 1)
+	c.Check(snaps[0]["hold"], check.Equals, "0001-01-01T00:00:00Z")
+}
+
 func (s *apiSuite) TestSnapsInfoAllMixedPublishers(c *check.C) {
 	d := s.daemon(c)
 
@@ -2558,6 +2592,7 @@ func (s *apiSuite) TestPostSnapsNoWeirdses(c *check.C) {
 			"jailmode":     "true",
 			"cohort-key":   `"what"`,
 			"leave-cohort": "true",
+			"no-start":     "true",
 		} {
 			buf := strings.NewReader(fmt.Sprintf(`{"action": "%s","snaps":["foo","bar"], "%s": %s}`, action, weird, v))
 			req, err := http.NewRequest("POST", "/v2/snaps", buf)
@@ -4135,6 +4170,105 @@ func (s *apiSuite) TestRemoveMany(c *check.C) {
 	c.Check(res.Affected, check.DeepEquals, inst.Snaps)
 }
 
+func (s *apiSuite) TestPostSnapsOpHold(c *check.C) {
+	var holdUntil time.Time
+	var holdNames []string
+	snapstateHoldRefresh = func(_ *state.State, until time.Time, names ...string) error {
+		holdUntil = until
+		holdNames = names
+		return nil
+	}
+
+	d := s.daemonWithOverlordMock(c)
+
+	buf := bytes.NewBufferString(`{"action": "hold", "snaps": ["foo", "bar"], "hold-until": "2030-01-02T03:04:05Z"}`)
+	req, err := http.NewRequest("POST", "/v2/snaps", buf)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp, ok := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(ok, check.Equals, true)
+	c.Check(rsp.Type, check.Equals, ResponseTypeAsync)
+	c.Check(holdNames, check.DeepEquals, []string{"foo", "bar"})
+	c.Check(holdUntil.Equal(time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)), check.Equals, true)
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Check(chg.Summary(), check.Equals, `Hold auto-refresh of snaps "foo", "bar"`)
+	c.Check(chg.Status(), check.Equals, state.DoneStatus)
+}
+
+func (s *apiSuite) TestHoldManyForever(c *check.C) {
+	called := false
+	snapstateHoldRefresh = func(_ *state.State, until time.Time, names ...string) error {
+		called = true
+		c.Check(until.IsZero(), check.Equals, true)
+		c.Check(names, check.HasLen, 0)
+		return nil
+	}
+
+	d := s.daemon(c)
+	inst := &snapInstruction{Action: "hold"}
+	st := d.overlord.State()
+	st.Lock()
+	res, err := snapHoldMany(inst, st)
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+	c.Check(called, check.Equals, true)
+	c.Check(res.Summary, check.Equals, `Hold auto-refresh of all snaps`)
+	c.Check(res.Tasksets, check.HasLen, 0)
+}
+
+func (s *apiSuite) TestUnholdMany(c *check.C) {
+	snapstateUnholdRefresh = func(_ *state.State, names ...string) error {
+		c.Check(names, check.DeepEquals, []string{"foo"})
+		return nil
+	}
+
+	d := s.daemon(c)
+	inst := &snapInstruction{Action: "unhold", Snaps: []string{"foo"}}
+	st := d.overlord.State()
+	st.Lock()
+	res, err := snapUnholdMany(inst, st)
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+	c.Check(res.Summary, check.Equals, `Remove auto-refresh hold of snaps "foo"`)
+	c.Check(res.Affected, check.DeepEquals, []string{"foo"})
+}
+
+func (s *apiSuite) TestHoldManyNotInstalled(c *check.C) {
+	snapstateHoldRefresh = func(_ *state.State, until time.Time, names ...string) error {
+		return &snap.NotInstalledError{Snap: "foo"}
+	}
+
+	s.daemonWithOverlordMock(c)
+
+	buf := bytes.NewBufferString(`{"action": "hold", "snaps": ["foo"]}`)
+	req, err := http.NewRequest("POST", "/v2/snaps", buf)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Check(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Kind, check.Equals, errorKindSnapNotInstalled)
+}
+
+func (s *apiSuite) TestPostSnapsOpHoldUntilOnlyForHold(c *check.C) {
+	s.daemonWithOverlordMock(c)
+
+	buf := bytes.NewBufferString(`{"action": "unhold", "snaps": ["foo"], "hold-until": "2030-01-02T03:04:05Z"}`)
+	req, err := http.NewRequest("POST", "/v2/snaps", buf)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Check(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `hold-until can only be specified for hold`)
+}
+
 func (s *apiSuite) TestInstallFails(c *check.C) {
 	snapstateInstall = func(ctx context.Context, s *state.State, name string, opts *snapstate.RevisionOptions, userID int, flags snapstate.Flags) (*state.TaskSet, error) {
 		t := s.NewTask("fake-install-snap-error", "Install task")
@@ -6460,6 +6594,54 @@ func (s *apiSuite) TestInstallPathUnaliased(c *check.C) {
 	c.Check(chgSummary, check.Equals, `Install "local" snap from file "x"`)
 }
 
+func (s *apiSuite) TestInstallNoStart(c *check.C) {
+	var calledFlags snapstate.Flags
+
+	snapstateInstall = func(ctx context.Context, s *state.State, name string, opts *snapstate.RevisionOptions, userID int, flags snapstate.Flags) (*state.TaskSet, error) {
+		calledFlags = flags
+
+		t := s.NewTask("fake-install-snap", "Doing a fake install")
+		return state.NewTaskSet(t), nil
+	}
+
+	d := s.daemon(c)
+	inst := &snapInstruction{
+		Action:  "install",
+		NoStart: true,
+		Snaps:   []string{"fake"},
+	}
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	_, _, err := inst.dispatch()(inst, st)
+	c.Check(err, check.IsNil)
+
+	c.Check(calledFlags.NoStart, check.Equals, true)
+}
+
+func (s *apiSuite) TestInstallPathNoStart(c *check.C) {
+	body := "" +
+		"----hello--\r\n" +
+		"Content-Disposition: form-data; name=\"snap\"; filename=\"x\"\r\n" +
+		"\r\n" +
+		"xyzzy\r\n" +
+		"----hello--\r\n" +
+		"Content-Disposition: form-data; name=\"devmode\"\r\n" +
+		"\r\n" +
+		"true\r\n" +
+		"----hello--\r\n" +
+		"Content-Disposition: form-data; name=\"no-start\"\r\n" +
+		"\r\n" +
+		"true\r\n" +
+		"----hello--\r\n"
+	head := map[string]string{"Content-Type": "multipart/thing; boundary=--hello--"}
+	// try a multipart/form-data upload
+	flags := snapstate.Flags{NoStart: true, RemoveSnapPath: true, DevMode: true}
+	chgSummary := s.sideloadCheck(c, body, head, "local", flags)
+	c.Check(chgSummary, check.Equals, `Install "local" snap from file "x"`)
+}
+
 func (s *apiSuite) TestSnapctlGetNoUID(c *check.C) {
 	buf := bytes.NewBufferString(`{"context-id": "some-context", "args": ["get", "something"]}`)
 	req, err := http.NewRequest("POST", "/v2/snapctl", buf)
@@ -6474,7 +6656,7 @@ func (s *apiSuite) TestSnapctlForbiddenError(c *check.C) {
 	runSnapctlUcrednetGet = func(string) (int32, uint32, string, error) {
 		return 100, 9999, dirs.SnapSocket, nil
 	}
-	defer func() { runSnapctlUcrednetGet = ucrednetGet }()
+	defer func() { runSnapctlUcrednetGet = netutil.UcrednetGet }()
 	ctlcmdRun = func(ctx *hookstate.Context, arg []string, uid uint32) ([]byte, []byte, error) {
 		return nil, nil, &ctlcmd.ForbiddenCommandError{}
 	}
@@ -6487,6 +6669,35 @@ func (s *apiSuite) TestSnapctlForbiddenError(c *check.C) {
 	c.Assert(rsp.Status, check.Equals, 403)
 }
 
+func (s *apiSuite) TestSnapctlUnsuccessfulError(c *check.C) {
+	_ = s.daemon(c)
+
+	runSnapctlUcrednetGet = func(string) (int32, uint32, string, error) {
+		return 100, 9999, dirs.SnapSocket, nil
+	}
+	defer func() { runSnapctlUcrednetGet = netutil.UcrednetGet }()
+	ctlcmdRun = func(ctx *hookstate.Context, arg []string, uid uint32) ([]byte, []byte, error) {
+		return []byte("out"), []byte("err"), &ctlcmd.UnsuccessfulError{ExitCode: 123}
+	}
+	defer func() { ctlcmdRun = ctlcmd.Run }()
+
+	buf := bytes.NewBufferString(`{"context-id": "some-context", "args": ["is-connected", "plug"]}`)
+	req, err := http.NewRequest("POST", "/v2/snapctl", buf)
+	c.Assert(err, check.IsNil)
+	rsp := runSnapctl(snapctlCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Result, check.DeepEquals, &errorResult{
+		Message: "unsuccessful with exit code: 123",
+		Kind:    errorKindUnsuccessful,
+		Value: map[string]interface{}{
+			"stdout":    "out",
+			"stderr":    "err",
+			"exit-code": 123,
+		},
+	})
+}
+
 type appSuite struct {
 	apiBaseSuite
 	cmd *testutil.MockCmd
@@ -6908,6 +7119,99 @@ func (s *appSuite) TestLogsBadFollow(c *check.C) {
 	c.Assert(rsp.Type, check.Equals, ResponseTypeError)
 }
 
+func (s *appSuite) TestLogsFilters(c *check.C) {
+	s.jctlRCs = []io.ReadCloser{ioutil.NopCloser(strings.NewReader(""))}
+
+	req, err := http.NewRequest("GET", "/v2/logs?names=snap-a.svc2&since=2020-09-13T12:26:40Z&until=2020-09-13T13:26:40Z&priority=warning", nil)
+	c.Assert(err, check.IsNil)
+
+	rec := httptest.NewRecorder()
+	getLogs(logsCmd, req, nil).ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, 200)
+
+	c.Check(s.jctlSvcses, check.DeepEquals, [][]string{{"snap.snap-a.svc2.service"}})
+	c.Assert(s.jctlOpts, check.HasLen, 1)
+	opts := s.jctlOpts[0]
+	c.Check(opts.N, check.Equals, 10)
+	c.Check(opts.Since.Equal(time.Unix(1600000000, 0)), check.Equals, true)
+	c.Check(opts.Until.Equal(time.Unix(1600003600, 0)), check.Equals, true)
+	c.Check(opts.Priority, check.Equals, "warning")
+	c.Check(opts.AllNamespaces, check.Equals, false)
+}
+
+func (s *appSuite) TestLogsBadFilters(c *check.C) {
+	for _, t := range []struct {
+		query, err string
+	}{
+		{"since=yesterday", `invalid value for since: "yesterday": .*`},
+		{"until=2020-13-01T00:00:00Z", `invalid value for until: "2020-13-01T00:00:00Z": .*`},
+		{"priority=loud", `invalid value for priority: "loud"`},
+		{"priority=8", `invalid value for priority: "8"`},
+	} {
+		req, err := http.NewRequest("GET", "/v2/logs?"+t.query, nil)
+		c.Assert(err, check.IsNil)
+
+		rsp := getLogs(logsCmd, req, nil).(*resp)
+		c.Check(rsp.Status, check.Equals, 400)
+		c.Check(rsp.Result.(*errorResult).Message, check.Matches, t.err)
+	}
+	c.Check(s.jctlOpts, check.HasLen, 0)
+}
+
+func (s *appSuite) TestLogsJournalNamespace(c *check.C) {
+	s.jctlRCs = []io.ReadCloser{
+		ioutil.NopCloser(strings.NewReader("")),
+		ioutil.NopCloser(strings.NewReader("")),
+	}
+
+	st := s.d.overlord.State()
+	st.Lock()
+	tr := config.NewTransaction(st)
+	c.Assert(tr.Set("snap-a", "journal.size", "64MB"), check.IsNil)
+	tr.Commit()
+	st.Unlock()
+
+	for _, t := range []struct {
+		names         string
+		allNamespaces bool
+	}{
+		{"snap-a", true},
+		{"snap-b", false},
+	} {
+		s.jctlOpts = nil
+		req, err := http.NewRequest("GET", "/v2/logs?names="+t.names, nil)
+		c.Assert(err, check.IsNil)
+
+		rec := httptest.NewRecorder()
+		getLogs(logsCmd, req, nil).ServeHTTP(rec, req)
+		c.Check(rec.Code, check.Equals, 200)
+		c.Assert(s.jctlOpts, check.HasLen, 1)
+		c.Check(s.jctlOpts[0].AllNamespaces, check.Equals, t.allNamespaces, check.Commentf(t.names))
+	}
+}
+
+func (s *appSuite) TestLogsJournalNamespaceUnsupported(c *check.C) {
+	s.sysctlVersion = "systemd 237\n"
+	s.jctlRCs = []io.ReadCloser{ioutil.NopCloser(strings.NewReader(""))}
+
+	st := s.d.overlord.State()
+	st.Lock()
+	tr := config.NewTransaction(st)
+	c.Assert(tr.Set("snap-a", "journal.size", "64MB"), check.IsNil)
+	tr.Commit()
+	st.Unlock()
+
+	req, err := http.NewRequest("GET", "/v2/logs?names=snap-a", nil)
+	c.Assert(err, check.IsNil)
+
+	rec := httptest.NewRecorder()
+	getLogs(logsCmd, req, nil).ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, 200)
+	c.Assert(s.jctlOpts, check.HasLen, 1)
+	// journalctl of this systemd does not know about --namespace
+	c.Check(s.jctlOpts[0].AllNamespaces, check.Equals, false)
+}
+
 func (s *appSuite) TestLogsBadName(c *check.C) {
 	req, err := http.NewRequest("GET", "/v2/logs?names=hello", nil)
 	c.Assert(err, check.IsNil)
@@ -7060,6 +7364,49 @@ func (s *appSuite) TestPostAppsBadAction(c *check.C) {
 	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `unknown action "discombobulate"`)
 }
 
+func (s *appSuite) TestGetAppsInfoUserDaemon(c *check.C) {
+	s.mkInstalledInState(c, s.d, "snap-e", "dev", "v1", snap.R(1), true, "apps: {svc4: {daemon: simple, daemon-scope: user}}")
+
+	req, err := http.NewRequest("GET", "/v2/apps?names=snap-e", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := getAppsInfo(appsCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Assert(rsp.Result, check.FitsTypeOf, []client.AppInfo{})
+	c.Check(rsp.Result.([]client.AppInfo), check.DeepEquals, []client.AppInfo{{
+		Snap:        "snap-e",
+		Name:        "svc4",
+		Daemon:      "simple",
+		DaemonScope: "user",
+		Enabled:     true,
+	}})
+	// only the enabled state shared by all users is queried
+	c.Check(s.sysctlArgses, check.DeepEquals, [][]string{
+		{"--user", "--global", "--root", dirs.GlobalRootDir, "is-enabled", "snap.snap-e.svc4.service"},
+	})
+}
+
+func (s *appSuite) TestPostAppsUserDaemon(c *check.C) {
+	s.mkInstalledInState(c, s.d, "snap-e", "dev", "v1", snap.R(1), true, "apps: {svc4: {daemon: simple, daemon-scope: user}}")
+
+	req, err := http.NewRequest("POST", "/v2/apps", bytes.NewBufferString(`{"action": "start", "names": ["snap-e.svc4"]}`))
+	c.Assert(err, check.IsNil)
+	rsp := postApps(appsCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, check.Equals, 202)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
+
+	st := s.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	// user services are started through the session agents
+	tasks := chg.Tasks()
+	c.Assert(tasks, check.HasLen, 1)
+	c.Check(tasks[0].Kind(), check.Equals, "user-service-control")
+	c.Check(tasks[0].Summary(), check.Equals, "start of user services [snap-e.svc4]")
+}
+
 func (s *appSuite) TestPostAppsConflict(c *check.C) {
 	st := s.d.overlord.State()
 	st.Lock()
@@ -0,0 +1,193 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+var (
+	validationSetsListCmd = &Command{
+		Path:   "/v2/validation-sets",
+		GET:    listValidationSets,
+		UserOK: true,
+	}
+
+	validationSetsCmd = &Command{
+		Path:   "/v2/validation-sets/{account}/{name}",
+		GET:    getValidationSet,
+		POST:   applyValidationSet,
+		UserOK: true,
+	}
+)
+
+var (
+	assertstateValidationSet      = assertstate.ValidationSet
+	assertstateApplyValidationSet = assertstate.ApplyValidationSet
+)
+
+type validationSetAction struct {
+	Action   string `json:"action"`
+	Mode     string `json:"mode"`
+	Sequence int    `json:"sequence"`
+}
+
+func validationSetResult(st *state.State, tr *snapstate.ValidationSetTracking) (*client.ValidationSetResult, error) {
+	vs, err := assertstateValidationSet(st, tr.AccountID, tr.Name, tr.Current)
+	if err != nil {
+		return nil, err
+	}
+	valid := true
+	if err := snapstate.CheckValidationSet(st, vs); err != nil {
+		if _, ok := err.(*snapstate.ValidationSetError); !ok {
+			return nil, err
+		}
+		valid = false
+	}
+	return &client.ValidationSetResult{
+		AccountID: tr.AccountID,
+		Name:      tr.Name,
+		Mode:      tr.Mode.String(),
+		PinnedAt:  tr.PinnedAt,
+		Sequence:  tr.Current,
+		Valid:     valid,
+	}, nil
+}
+
+func listValidationSets(c *Command, r *http.Request, _ *auth.UserState) Response {
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	vsets, err := snapstate.ValidationSets(st)
+	if err != nil {
+		return InternalError("cannot list validation sets: %v", err)
+	}
+	keys := make([]string, 0, len(vsets))
+	for key := range vsets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	results := make([]*client.ValidationSetResult, 0, len(keys))
+	for _, key := range keys {
+		res, err := validationSetResult(st, vsets[key])
+		if err != nil {
+			return InternalError("cannot get validation set %s: %v", key, err)
+		}
+		results = append(results, res)
+	}
+	return SyncResponse(results, nil)
+}
+
+func getValidationSet(c *Command, r *http.Request, _ *auth.UserState) Response {
+	vars := muxVars(r)
+	accountID := vars["account"]
+	name := vars["name"]
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var tr snapstate.ValidationSetTracking
+	err := snapstate.GetValidationSet(st, accountID, name, &tr)
+	if err == state.ErrNoState {
+		return NotFound("validation set %s is not applied", snapstate.ValidationSetKey(accountID, name))
+	}
+	if err != nil {
+		return InternalError("cannot get validation set: %v", err)
+	}
+	res, err := validationSetResult(st, &tr)
+	if err != nil {
+		return InternalError("cannot get validation set: %v", err)
+	}
+	return SyncResponse(res, nil)
+}
+
+func applyValidationSet(c *Command, r *http.Request, user *auth.UserState) Response {
+	vars := muxVars(r)
+	accountID := vars["account"]
+	name := vars["name"]
+
+	var action validationSetAction
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&action); err != nil {
+		return BadRequest("cannot decode request body into validation set action: %v", err)
+	}
+	if action.Sequence < 0 {
+		return BadRequest("invalid sequence %d", action.Sequence)
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	switch action.Action {
+	case "forget":
+		err := snapstate.ForgetValidationSet(st, accountID, name)
+		if err == state.ErrNoState {
+			return NotFound("validation set %s is not applied", snapstate.ValidationSetKey(accountID, name))
+		}
+		if err != nil {
+			return InternalError("cannot forget validation set: %v", err)
+		}
+		return SyncResponse(nil, nil)
+	case "apply":
+		// handled below
+	default:
+		return BadRequest("unsupported validation set action %q", action.Action)
+	}
+
+	var mode snapstate.ValidationSetMode
+	switch action.Mode {
+	case "", "monitor":
+		mode = snapstate.Monitor
+	case "enforce":
+		mode = snapstate.Enforce
+	default:
+		return BadRequest("invalid validation set mode %q", action.Mode)
+	}
+
+	userID := 0
+	if user != nil {
+		userID = user.ID
+	}
+	tr, err := assertstateApplyValidationSet(st, accountID, name, action.Sequence, mode, userID)
+	if err != nil {
+		if _, ok := err.(*asserts.NotFoundError); ok {
+			return NotFound("%v", err)
+		}
+		return BadRequest("%v", err)
+	}
+	res, err := validationSetResult(st, tr)
+	if err != nil {
+		return InternalError("cannot get validation set: %v", err)
+	}
+	return SyncResponse(res, nil)
+}
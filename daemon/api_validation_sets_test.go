@@ -0,0 +1,281 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/daemon"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/testutil"
+)
+
+var _ = check.Suite(&validationSetsSuite{})
+
+type validationSetsSuite struct {
+	testutil.BaseTest
+
+	d  *daemon.Daemon
+	st *state.State
+}
+
+func (s *validationSetsSuite) SetUpTest(c *check.C) {
+	s.BaseTest.SetUpTest(c)
+
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	o := overlord.Mock()
+	s.d = daemon.NewWithOverlord(o)
+	s.st = o.State()
+
+	s.AddCleanup(daemon.MockAssertstateValidationSet(func(st *state.State, accountID, name string, sequence int) (*asserts.ValidationSet, error) {
+		c.Check(accountID, check.Equals, "acme")
+		return fakeValidationSet(c, name, sequence), nil
+	}))
+}
+
+func (s *validationSetsSuite) muxVars(account, name string) {
+	s.AddCleanup(daemon.MockMuxVars(func(*http.Request) map[string]string {
+		return map[string]string{"account": account, "name": name}
+	}))
+}
+
+// fakeValidationSet returns a validation set requiring snap foo.
+func fakeValidationSet(c *check.C, name string, sequence int) *asserts.ValidationSet {
+	a := assertstest.FakeAssertion(map[string]interface{}{
+		"type":         "validation-set",
+		"authority-id": "acme",
+		"series":       "16",
+		"account-id":   "acme",
+		"name":         name,
+		"sequence":     fmt.Sprintf("%d", sequence),
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name": "foo",
+				"id":   "fooididididididididididididididi",
+			},
+		},
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+	return a.(*asserts.ValidationSet)
+}
+
+func (s *validationSetsSuite) trackValidationSets() {
+	s.st.Lock()
+	defer s.st.Unlock()
+	snapstate.UpdateValidationSet(s.st, &snapstate.ValidationSetTracking{
+		AccountID: "acme",
+		Name:      "one",
+		Mode:      snapstate.Enforce,
+		PinnedAt:  2,
+		Current:   2,
+	})
+	snapstate.UpdateValidationSet(s.st, &snapstate.ValidationSetTracking{
+		AccountID: "acme",
+		Name:      "two",
+		Mode:      snapstate.Monitor,
+		Current:   5,
+	})
+	snapstate.Set(s.st, "foo", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "foo", SnapID: "fooididididididididididididididi", Revision: snap.R(1)}},
+		Current:  snap.R(1),
+	})
+}
+
+func (s *validationSetsSuite) TestListValidationSetsNone(c *check.C) {
+	req, err := http.NewRequest("GET", "/v2/validation-sets", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.ValidationSetsListCmd.GET(daemon.ValidationSetsListCmd, req, nil)
+	c.Check(rsp, check.DeepEquals, &daemon.Resp{
+		Status: 200,
+		Type:   "sync",
+		Result: []*client.ValidationSetResult{},
+	})
+}
+
+func (s *validationSetsSuite) TestListValidationSets(c *check.C) {
+	s.trackValidationSets()
+
+	req, err := http.NewRequest("GET", "/v2/validation-sets", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.ValidationSetsListCmd.GET(daemon.ValidationSetsListCmd, req, nil)
+	c.Check(rsp, check.DeepEquals, &daemon.Resp{
+		Status: 200,
+		Type:   "sync",
+		Result: []*client.ValidationSetResult{
+			{AccountID: "acme", Name: "one", Mode: "enforce", PinnedAt: 2, Sequence: 2, Valid: true},
+			{AccountID: "acme", Name: "two", Mode: "monitor", Sequence: 5, Valid: true},
+		},
+	})
+}
+
+func (s *validationSetsSuite) TestGetValidationSet(c *check.C) {
+	s.trackValidationSets()
+	s.muxVars("acme", "two")
+
+	req, err := http.NewRequest("GET", "/v2/validation-sets/acme/two", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.ValidationSetsCmd.GET(daemon.ValidationSetsCmd, req, nil)
+	c.Check(rsp, check.DeepEquals, &daemon.Resp{
+		Status: 200,
+		Type:   "sync",
+		Result: &client.ValidationSetResult{AccountID: "acme", Name: "two", Mode: "monitor", Sequence: 5, Valid: true},
+	})
+
+	// not valid anymore once foo is gone
+	s.st.Lock()
+	snapstate.Set(s.st, "foo", nil)
+	s.st.Unlock()
+
+	rsp = daemon.ValidationSetsCmd.GET(daemon.ValidationSetsCmd, req, nil)
+	c.Check(rsp, check.DeepEquals, &daemon.Resp{
+		Status: 200,
+		Type:   "sync",
+		Result: &client.ValidationSetResult{AccountID: "acme", Name: "two", Mode: "monitor", Sequence: 5, Valid: false},
+	})
+}
+
+func (s *validationSetsSuite) TestGetValidationSetNotApplied(c *check.C) {
+	s.muxVars("acme", "three")
+
+	req, err := http.NewRequest("GET", "/v2/validation-sets/acme/three", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.ValidationSetsCmd.GET(daemon.ValidationSetsCmd, req, nil)
+	c.Check(rsp, check.DeepEquals, &daemon.Resp{
+		Status: 404,
+		Type:   "error",
+		Result: &daemon.ErrorResult{Message: "validation set acme/three is not applied"},
+	})
+}
+
+func (s *validationSetsSuite) TestApplyValidationSet(c *check.C) {
+	s.muxVars("acme", "one")
+
+	var called int
+	s.AddCleanup(daemon.MockAssertstateApplyValidationSet(func(st *state.State, accountID, name string, sequence int, mode snapstate.ValidationSetMode, userID int) (*snapstate.ValidationSetTracking, error) {
+		called++
+		c.Check(accountID, check.Equals, "acme")
+		c.Check(name, check.Equals, "one")
+		c.Check(sequence, check.Equals, 3)
+		c.Check(mode, check.Equals, snapstate.Enforce)
+		c.Check(userID, check.Equals, 42)
+		return &snapstate.ValidationSetTracking{
+			AccountID: accountID,
+			Name:      name,
+			Mode:      mode,
+			PinnedAt:  sequence,
+			Current:   sequence,
+		}, nil
+	}))
+	s.st.Lock()
+	snapstate.Set(s.st, "foo", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "foo", SnapID: "fooididididididididididididididi", Revision: snap.R(1)}},
+		Current:  snap.R(1),
+	})
+	s.st.Unlock()
+
+	req, err := http.NewRequest("POST", "/v2/validation-sets/acme/one", strings.NewReader(`{"action": "apply", "mode": "enforce", "sequence": 3}`))
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.ValidationSetsCmd.POST(daemon.ValidationSetsCmd, req, &auth.UserState{ID: 42})
+	c.Check(rsp, check.DeepEquals, &daemon.Resp{
+		Status: 200,
+		Type:   "sync",
+		Result: &client.ValidationSetResult{AccountID: "acme", Name: "one", Mode: "enforce", PinnedAt: 3, Sequence: 3, Valid: true},
+	})
+	c.Check(called, check.Equals, 1)
+}
+
+func (s *validationSetsSuite) TestApplyValidationSetErrors(c *check.C) {
+	s.muxVars("acme", "one")
+
+	var applyErr error
+	s.AddCleanup(daemon.MockAssertstateApplyValidationSet(func(st *state.State, accountID, name string, sequence int, mode snapstate.ValidationSetMode, userID int) (*snapstate.ValidationSetTracking, error) {
+		return nil, applyErr
+	}))
+
+	for _, t := range []struct {
+		body    string
+		err     error
+		status  int
+		message string
+	}{
+		{`{"action": "apply"`, nil, 400, "cannot decode request body into validation set action: unexpected EOF"},
+		{`{"action": "frob"}`, nil, 400, `unsupported validation set action "frob"`},
+		{`{"action": "apply", "mode": "frob"}`, nil, 400, `invalid validation set mode "frob"`},
+		{`{"action": "apply", "sequence": -1}`, nil, 400, `invalid sequence -1`},
+		{`{"action": "apply", "mode": "enforce"}`, errors.New("cannot enforce validation set: boom"), 400, "cannot enforce validation set: boom"},
+		{`{"action": "apply"}`, &asserts.NotFoundError{Type: asserts.ValidationSetType}, 404, "validation-set assertion not found"},
+		{`{"action": "forget"}`, nil, 404, "validation set acme/one is not applied"},
+	} {
+		applyErr = t.err
+		req, err := http.NewRequest("POST", "/v2/validation-sets/acme/one", strings.NewReader(t.body))
+		c.Assert(err, check.IsNil)
+
+		rsp := daemon.ValidationSetsCmd.POST(daemon.ValidationSetsCmd, req, nil)
+		c.Check(rsp, check.DeepEquals, &daemon.Resp{
+			Status: t.status,
+			Type:   "error",
+			Result: &daemon.ErrorResult{Message: t.message},
+		}, check.Commentf(t.body))
+	}
+}
+
+func (s *validationSetsSuite) TestForgetValidationSet(c *check.C) {
+	s.trackValidationSets()
+	s.muxVars("acme", "one")
+
+	req, err := http.NewRequest("POST", "/v2/validation-sets/acme/one", strings.NewReader(`{"action": "forget"}`))
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.ValidationSetsCmd.POST(daemon.ValidationSetsCmd, req, nil)
+	c.Check(rsp, check.DeepEquals, &daemon.Resp{
+		Status: 200,
+		Type:   "sync",
+	})
+
+	s.st.Lock()
+	defer s.st.Unlock()
+	vsets, err := snapstate.ValidationSets(s.st)
+	c.Assert(err, check.IsNil)
+	c.Check(vsets, check.HasLen, 1)
+	c.Check(vsets["acme/two"], check.NotNil)
+}
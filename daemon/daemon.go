@@ -143,10 +143,10 @@ func (c *Command) canAccess(r *http.Request, user *auth.UserState) accessResult
 
 	// isUser means we have a UID for the request
 	isUser := false
-	pid, uid, socket, err := ucrednetGet(r.RemoteAddr)
+	pid, uid, socket, err := netutil.UcrednetGet(r.RemoteAddr)
 	if err == nil {
 		isUser = true
-	} else if err != errNoID {
+	} else if err != netutil.ErrNoID {
 		logger.Noticef("unexpected error when attempting to get UID: %s", err)
 		return accessForbidden
 	}
@@ -328,7 +328,7 @@ func (d *Daemon) Init() error {
 
 	// The SnapdSocket is required-- without it, die.
 	if listener, err := netutil.GetListener(dirs.SnapdSocket, listenerMap); err == nil {
-		d.snapdListener = &ucrednetListener{Listener: listener}
+		d.snapdListener = netutil.WrapUcrednetListener(listener)
 	} else {
 		return fmt.Errorf("when trying to listen on %s: %v", dirs.SnapdSocket, err)
 	}
@@ -336,7 +336,7 @@ func (d *Daemon) Init() error {
 	if listener, err := netutil.GetListener(dirs.SnapSocket, listenerMap); err == nil {
 		// This listener may also be nil if that socket wasn't among
 		// the listeners, so check it before using it.
-		d.snapListener = &ucrednetListener{Listener: listener}
+		d.snapListener = netutil.WrapUcrednetListener(listener)
 	} else {
 		logger.Debugf("cannot get listener for %q: %v", dirs.SnapSocket, err)
 	}
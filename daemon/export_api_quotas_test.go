@@ -0,0 +1,57 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap/quota"
+)
+
+var (
+	QuotaGroupsCmd    = quotaGroupsCmd
+	QuotaGroupInfoCmd = quotaGroupInfoCmd
+)
+
+func MockServicestateSetQuota(f func(st *state.State, update *quota.Group) (*state.TaskSet, error)) (restore func()) {
+	old := servicestateSetQuota
+	servicestateSetQuota = f
+	return func() {
+		servicestateSetQuota = old
+	}
+}
+
+func MockServicestateRemoveQuota(f func(st *state.State, name string) (*state.TaskSet, error)) (restore func()) {
+	old := servicestateRemoveQuota
+	servicestateRemoveQuota = f
+	return func() {
+		servicestateRemoveQuota = old
+	}
+}
+
+func MockCgroupUsage(memory, tasks func(group string) (uint64, error)) (restore func()) {
+	oldMemory := cgroupMemoryUsage
+	oldTasks := cgroupTasksCount
+	cgroupMemoryUsage = memory
+	cgroupTasksCount = tasks
+	return func() {
+		cgroupMemoryUsage = oldMemory
+		cgroupTasksCount = oldTasks
+	}
+}
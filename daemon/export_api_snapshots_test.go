@@ -22,12 +22,14 @@ package daemon
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 
 	"gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
 	"github.com/snapcore/snapd/overlord/state"
 )
 
@@ -71,6 +73,22 @@ func MockSnapshotForget(newForget func(*state.State, uint64, []string) ([]string
 	}
 }
 
+func MockSnapshotExport(newExport func(context.Context, *state.State, uint64) (*backend.SnapshotExport, error)) (restore func()) {
+	oldExport := snapshotExport
+	snapshotExport = newExport
+	return func() {
+		snapshotExport = oldExport
+	}
+}
+
+func MockSnapshotImport(newImport func(context.Context, *state.State, io.Reader) (uint64, []string, error)) (restore func()) {
+	oldImport := snapshotImport
+	snapshotImport = newImport
+	return func() {
+		snapshotImport = oldImport
+	}
+}
+
 func MustUnmarshalSnapInstruction(c *check.C, jinst string) *snapInstruction {
 	var inst snapInstruction
 	if err := json.Unmarshal([]byte(jinst), &inst); err != nil {
@@ -99,7 +117,12 @@ func ChangeSnapshots(c *Command, r *http.Request, user *auth.UserState) *resp {
 	return changeSnapshots(c, r, user).(*resp)
 }
 
+func GetSnapshotExport(c *Command, r *http.Request, user *auth.UserState) Response {
+	return getSnapshotExport(c, r, user)
+}
+
 var (
-	SnapshotMany = snapshotMany
-	SnapshotCmd  = snapshotCmd
+	SnapshotMany      = snapshotMany
+	SnapshotCmd       = snapshotCmd
+	SnapshotExportCmd = snapshotExportCmd
 )
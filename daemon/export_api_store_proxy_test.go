@@ -0,0 +1,47 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"net/url"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+var (
+	StoreProxyCmd = storeProxyCmd
+)
+
+func MockAssertstateFetchProxyStore(f func(st *state.State, proxyURL *url.URL) (*asserts.Store, error)) (restore func()) {
+	old := assertstateFetchProxyStore
+	assertstateFetchProxyStore = f
+	return func() {
+		assertstateFetchProxyStore = old
+	}
+}
+
+func MockStoreProxyConnectivityCheck(f func(st *state.State, storeAs *asserts.Store) (map[string]bool, error)) (restore func()) {
+	old := storeProxyConnectivityCheck
+	storeProxyConnectivityCheck = f
+	return func() {
+		storeProxyConnectivityCheck = old
+	}
+}
@@ -0,0 +1,62 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"github.com/snapcore/snapd/overlord/devicestate"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+var (
+	SystemsCmd       = systemsCmd
+	SystemsActionCmd = systemsActionCmd
+)
+
+func MockDevicestateSystems(f func() ([]*devicestate.System, error)) (restore func()) {
+	old := devicestateSystems
+	devicestateSystems = f
+	return func() {
+		devicestateSystems = old
+	}
+}
+
+func MockDevicestateCreateRecoverySystem(f func(st *state.State, label string) (*state.Change, error)) (restore func()) {
+	old := devicestateCreateRecoverySystem
+	devicestateCreateRecoverySystem = f
+	return func() {
+		devicestateCreateRecoverySystem = old
+	}
+}
+
+func MockDevicestateRequestSystemAction(f func(st *state.State, label, mode string) error) (restore func()) {
+	old := devicestateRequestSystemAction
+	devicestateRequestSystemAction = f
+	return func() {
+		devicestateRequestSystemAction = old
+	}
+}
+
+func MockDevicestateFactoryReset(f func(st *state.State, opts *devicestate.FactoryResetOptions) (*state.Change, error)) (restore func()) {
+	old := devicestateFactoryReset
+	devicestateFactoryReset = f
+	return func() {
+		devicestateFactoryReset = old
+	}
+}
@@ -0,0 +1,47 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+var (
+	ValidationSetsListCmd = validationSetsListCmd
+	ValidationSetsCmd     = validationSetsCmd
+)
+
+func MockAssertstateValidationSet(f func(s *state.State, accountID, name string, sequence int) (*asserts.ValidationSet, error)) (restore func()) {
+	old := assertstateValidationSet
+	assertstateValidationSet = f
+	return func() {
+		assertstateValidationSet = old
+	}
+}
+
+func MockAssertstateApplyValidationSet(f func(s *state.State, accountID, name string, sequence int, mode snapstate.ValidationSetMode, userID int) (*snapstate.ValidationSetTracking, error)) (restore func()) {
+	old := assertstateApplyValidationSet
+	assertstateApplyValidationSet = f
+	return func() {
+		assertstateApplyValidationSet = old
+	}
+}
@@ -190,6 +190,10 @@ const (
 	errorKindSystemRestart = errorKind("system-restart")
 
 	errorKindAssertionNotFound = errorKind("assertion-not-found")
+
+	errorKindUnsuccessful = errorKind("unsuccessful")
+
+	errorKindStoreProxyUnreachable = errorKind("store-proxy-unreachable")
 )
 
 type errorValue interface{}
@@ -485,6 +489,25 @@ func SnapChangeConflict(cce *snapstate.ChangeConflictError) Response {
 	}
 }
 
+// SnapctlUnsuccessful is an error responder used when a snapctl
+// command ran to completion but was unsuccessful, it carries the
+// output of the command and its exit code.
+func SnapctlUnsuccessful(stdout, stderr []byte, exitCode int) Response {
+	return &resp{
+		Type: ResponseTypeError,
+		Result: &errorResult{
+			Message: fmt.Sprintf("unsuccessful with exit code: %d", exitCode),
+			Kind:    errorKindUnsuccessful,
+			Value: map[string]interface{}{
+				"stdout":    string(stdout),
+				"stderr":    string(stderr),
+				"exit-code": exitCode,
+			},
+		},
+		Status: 200,
+	}
+}
+
 // AppNotFound is an error responder used when an operation is
 // requested on a app that doesn't exist.
 func AppNotFound(format string, v ...interface{}) Response {
@@ -66,8 +66,11 @@ var (
 	SnapAssertsSpoolDir   string
 	SnapSeqDir            string
 
-	SnapStateFile     string
-	SnapSystemKeyFile string
+	SnapdStoreSSLCertsDir string
+
+	SnapStateFile        string
+	SnapSystemKeyFile    string
+	SnapFactoryResetFile string
 
 	SnapRepairDir        string
 	SnapRepairStateFile  string
@@ -84,6 +87,7 @@ var (
 	SnapAuxStoreInfoDir string
 
 	SnapBinariesDir     string
+	SnapSystemdDir      string
 	SnapServicesDir     string
 	SnapUserServicesDir string
 	SnapSystemdConfDir  string
@@ -91,6 +95,9 @@ var (
 	SnapDesktopIconsDir string
 	SnapBusPolicyDir    string
 
+	SnapDBusSessionServicesDir string
+	SnapDBusSystemServicesDir  string
+
 	SystemApparmorDir      string
 	SystemApparmorCacheDir string
 
@@ -261,8 +268,11 @@ func SetRootDir(rootdir string) {
 	SnapAssertsSpoolDir = filepath.Join(rootdir, "run/snapd/auto-import")
 	SnapSeqDir = filepath.Join(rootdir, snappyDir, "sequence")
 
+	SnapdStoreSSLCertsDir = filepath.Join(rootdir, snappyDir, "ssl/store-certs")
+
 	SnapStateFile = filepath.Join(rootdir, snappyDir, "state.json")
 	SnapSystemKeyFile = filepath.Join(rootdir, snappyDir, "system-key")
+	SnapFactoryResetFile = filepath.Join(rootdir, snappyDir, "factory-reset")
 
 	SnapCacheDir = filepath.Join(rootdir, "/var/cache/snapd")
 	SnapNamesFile = filepath.Join(SnapCacheDir, "names")
@@ -282,10 +292,13 @@ func SetRootDir(rootdir string) {
 	SnapRollbackDir = filepath.Join(rootdir, snappyDir, "rollback")
 
 	SnapBinariesDir = filepath.Join(SnapMountDir, "bin")
+	SnapSystemdDir = filepath.Join(rootdir, "/etc/systemd")
 	SnapServicesDir = filepath.Join(rootdir, "/etc/systemd/system")
 	SnapUserServicesDir = filepath.Join(rootdir, "/etc/systemd/user")
 	SnapSystemdConfDir = filepath.Join(rootdir, "/etc/systemd/system.conf.d")
 	SnapBusPolicyDir = filepath.Join(rootdir, "/etc/dbus-1/system.d")
+	SnapDBusSessionServicesDir = filepath.Join(rootdir, snappyDir, "dbus-1", "services")
+	SnapDBusSystemServicesDir = filepath.Join(rootdir, snappyDir, "dbus-1", "system-services")
 
 	SystemApparmorDir = filepath.Join(rootdir, "/etc/apparmor.d")
 	SystemApparmorCacheDir = filepath.Join(rootdir, "/etc/apparmor.d/cache")
@@ -35,3 +35,7 @@ func FindDeviceForStructureWithFallback(ps *LaidOutStructure) (string, Size, err
 func FindMountPointForStructure(ps *LaidOutStructure) (string, error) {
 	return "", errNotImplemented
 }
+
+func findParentDeviceWithWritableFallback() (string, error) {
+	return "", errNotImplemented
+}
@@ -36,7 +36,8 @@ var (
 
 	RawContentBackupPath = rawContentBackupPath
 
-	UpdaterForStructure = updaterForStructure
+	UpdaterForStructure  = updaterForStructure
+	VerifierForStructure = verifierForStructure
 )
 
 func MockEvalSymlinks(mock func(path string) (string, error)) (restore func()) {
@@ -54,3 +55,31 @@ func MockMkfsHandlers(mock map[string]MkfsFunc) (restore func()) {
 		mkfsHandlers = old
 	}
 }
+
+func ResolveLayoutChange(from, to *LaidOutVolume) (grown *LaidOutStructure, added []*LaidOutStructure, err error) {
+	change, err := resolveLayoutChange(from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	return change.grown, change.added, nil
+}
+
+func MockLayoutDeviceLookup(mock func() (string, error)) (restore func()) {
+	old := layoutDeviceLookup
+	layoutDeviceLookup = mock
+	return func() {
+		layoutDeviceLookup = old
+	}
+}
+
+func MockVerifyLookups(deviceLookup func(ps *LaidOutStructure) (string, Size, error), mountLookup func(ps *LaidOutStructure) (string, error)) (restore func()) {
+	oldDevice, oldMount := verifyDeviceLookup, verifyMountLookup
+	verifyDeviceLookup, verifyMountLookup = deviceLookup, mountLookup
+	return func() {
+		verifyDeviceLookup, verifyMountLookup = oldDevice, oldMount
+	}
+}
+
+func StagedBootAssets(f *MountedFilesystemUpdater) []string {
+	return f.stagedBootAssets()
+}
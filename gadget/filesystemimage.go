@@ -87,7 +87,24 @@ func (f *FilesystemImageWriter) Write(fname string, postStage PostStageFunc) err
 	if sz := st.Size(); sz != int64(f.ps.Size) {
 		return fmt.Errorf("size of image file %v is different from declared structure size %v", sz, f.ps.Size)
 	}
+	return f.write(fname, postStage)
+}
+
+// WriteNode creates the filesystem directly on the given device node, which
+// must be the partition holding the structure, and populates it in the same
+// way as Write does for an image file.
+func (f *FilesystemImageWriter) WriteNode(node string, postStage PostStageFunc) error {
+	st, err := os.Stat(node)
+	if err != nil {
+		return fmt.Errorf("cannot stat device node: %v", err)
+	}
+	if st.Mode()&os.ModeDevice == 0 || st.Mode()&os.ModeCharDevice != 0 {
+		return fmt.Errorf("%s is not a block device", node)
+	}
+	return f.write(node, postStage)
+}
 
+func (f *FilesystemImageWriter) write(fname string, postStage PostStageFunc) error {
 	mkfsWithContent := mkfsHandlers[f.ps.Filesystem]
 	if mkfsWithContent == nil {
 		return fmt.Errorf("internal error: filesystem %q has no handler", f.ps.Filesystem)
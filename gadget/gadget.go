@@ -192,6 +192,9 @@ func (vc VolumeContent) String() string {
 type VolumeUpdate struct {
 	Edition  editionNumber `yaml:"edition"`
 	Preserve []string      `yaml:"preserve"`
+	// BootAssets lists files, such as bootloader binaries, that are
+	// booted in trial mode when updated, rather than being overwritten
+	BootAssets []string `yaml:"boot-assets"`
 }
 
 // GadgetConnect describes an interface connection requested by the gadget
@@ -487,7 +490,7 @@ func validateVolumeStructure(vs *VolumeStructure, vol *Volume) error {
 		}
 	}
 
-	if err := validateStructureUpdate(&vs.Update, vs); err != nil {
+	if err := validateStructureUpdate(&vs.Update, vs, vol); err != nil {
 		return err
 	}
 
@@ -621,7 +624,7 @@ func validateFilesystemContent(vc *VolumeContent) error {
 	return nil
 }
 
-func validateStructureUpdate(up *VolumeUpdate, vs *VolumeStructure) error {
+func validateStructureUpdate(up *VolumeUpdate, vs *VolumeStructure, vol *Volume) error {
 	if vs.IsBare() && len(vs.Update.Preserve) > 0 {
 		return errors.New("preserving files during update is not supported for non-filesystem structures")
 	}
@@ -633,6 +636,43 @@ func validateStructureUpdate(up *VolumeUpdate, vs *VolumeStructure) error {
 		}
 		names[n] = true
 	}
+
+	if len(vs.Update.BootAssets) == 0 {
+		return nil
+	}
+	if vs.IsBare() {
+		return errors.New("trial boot of boot assets is not supported for non-filesystem structures")
+	}
+	if vs.EffectiveRole() != SystemBoot {
+		// the bootloader only looks for the staged boot assets on the
+		// partition it booted from
+		return fmt.Errorf("trial boot of boot assets is only supported for the %v structure", SystemBoot)
+	}
+	if vol.Bootloader != "grub" {
+		return fmt.Errorf("trial boot of boot assets is not supported with bootloader %q", vol.Bootloader)
+	}
+	assets := make(map[string]bool, len(vs.Update.BootAssets))
+	dir := ""
+	for i, n := range vs.Update.BootAssets {
+		if assets[n] {
+			return fmt.Errorf(`duplicate "boot-assets" entry %q`, n)
+		}
+		if names[n] {
+			return fmt.Errorf(`boot asset %q cannot be preserved`, n)
+		}
+		if strings.ContainsAny(n, " \t\n") {
+			return fmt.Errorf(`invalid "boot-assets" entry %q: path contains whitespace`, n)
+		}
+		// boot assets load each other from the directory they run
+		// from, they are staged together for a trial boot
+		d := filepath.Dir(filepath.Clean(strings.TrimPrefix(n, "/")))
+		if i == 0 {
+			dir = d
+		} else if d != dir {
+			return fmt.Errorf(`invalid "boot-assets" entry %q: boot assets must be in the same directory`, n)
+		}
+		assets[n] = true
+	}
 	return nil
 }
 
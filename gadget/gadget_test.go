@@ -174,6 +174,11 @@ volumes:
             target: EFI/boot/bootx64.efi
           - source: grub.cfg
             target: EFI/ubuntu/grub.cfg
+        update:
+          edition: 1
+          boot-assets:
+            - EFI/boot/grubx64.efi
+            - EFI/boot/bootx64.efi
 `)
 
 var gadgetYamlRPi = []byte(`
@@ -607,8 +612,12 @@ func (s *gadgetYamlTestSuite) TestReadGadgetYamlPCHappy(c *C) {
 	err := ioutil.WriteFile(s.gadgetYamlPath, gadgetYamlPC, 0644)
 	c.Assert(err, IsNil)
 
-	_, err = gadget.ReadInfo(s.dir, false)
+	ginfo, err := gadget.ReadInfo(s.dir, false)
 	c.Assert(err, IsNil)
+	c.Check(ginfo.Volumes["pc"].Structure[2].Update.BootAssets, DeepEquals, []string{
+		"EFI/boot/grubx64.efi",
+		"EFI/boot/bootx64.efi",
+	})
 }
 
 func (s *gadgetYamlTestSuite) TestReadGadgetYamlRPiHappy(c *C) {
@@ -1109,6 +1118,75 @@ func (s *gadgetYamlTestSuite) TestValidateStructureUpdatePreserveDuplicates(c *C
 	c.Check(err, ErrorMatches, `duplicate "preserve" entry "foo"`)
 }
 
+func (s *gadgetYamlTestSuite) TestValidateStructureUpdateBootAssets(c *C) {
+	gv := &gadget.Volume{Bootloader: "grub"}
+
+	err := gadget.ValidateVolumeStructure(&gadget.VolumeStructure{
+		Type:       "C12A7328-F81F-11D2-BA4B-00A0C93EC93B",
+		Role:       gadget.SystemBoot,
+		Filesystem: "vfat",
+		Update: gadget.VolumeUpdate{
+			Edition:    1,
+			Preserve:   []string{"EFI/ubuntu/grubenv"},
+			BootAssets: []string{"EFI/boot/bootx64.efi", "EFI/boot/grubx64.efi"},
+		},
+		Size: 512,
+	}, gv)
+	c.Check(err, IsNil)
+
+	for _, tc := range []struct {
+		vs         gadget.VolumeStructure
+		bootloader string
+		err        string
+	}{{
+		vs:  gadget.VolumeStructure{Type: "bare", Role: "-"},
+		err: "trial boot of boot assets is not supported for non-filesystem structures",
+	}, {
+		vs:  gadget.VolumeStructure{Filesystem: "ext4", Role: gadget.SystemData, Label: "writable"},
+		err: "trial boot of boot assets is only supported for the system-boot structure",
+	}, {
+		vs:  gadget.VolumeStructure{Filesystem: "vfat", Role: "-"},
+		err: "trial boot of boot assets is only supported for the system-boot structure",
+	}, {
+		vs:         gadget.VolumeStructure{Filesystem: "vfat"},
+		bootloader: "u-boot",
+		err:        `trial boot of boot assets is not supported with bootloader "u-boot"`,
+	}, {
+		vs:  gadget.VolumeStructure{Filesystem: "vfat", Update: gadget.VolumeUpdate{BootAssets: []string{"foo", "foo"}}},
+		err: `duplicate "boot-assets" entry "foo"`,
+	}, {
+		vs:  gadget.VolumeStructure{Filesystem: "vfat", Update: gadget.VolumeUpdate{Preserve: []string{"foo"}, BootAssets: []string{"foo"}}},
+		err: `boot asset "foo" cannot be preserved`,
+	}, {
+		vs:  gadget.VolumeStructure{Filesystem: "vfat", Update: gadget.VolumeUpdate{BootAssets: []string{"foo bar"}}},
+		err: `invalid "boot-assets" entry "foo bar": path contains whitespace`,
+	}, {
+		vs:  gadget.VolumeStructure{Filesystem: "vfat", Update: gadget.VolumeUpdate{BootAssets: []string{"EFI/boot/bootx64.efi", "EFI/ubuntu/grubx64.efi"}}},
+		err: `invalid "boot-assets" entry "EFI/ubuntu/grubx64.efi": boot assets must be in the same directory`,
+	}} {
+		vs := tc.vs
+		if vs.Type == "" {
+			vs.Type = "C12A7328-F81F-11D2-BA4B-00A0C93EC93B"
+		}
+		switch vs.Role {
+		case "":
+			vs.Role = gadget.SystemBoot
+		case "-":
+			vs.Role = ""
+		}
+		if len(vs.Update.BootAssets) == 0 {
+			vs.Update.BootAssets = []string{"EFI/boot/grubx64.efi"}
+		}
+		vs.Size = 512
+		bootloader := tc.bootloader
+		if bootloader == "" {
+			bootloader = "grub"
+		}
+		err := gadget.ValidateVolumeStructure(&vs, &gadget.Volume{Bootloader: bootloader})
+		c.Check(err, ErrorMatches, tc.err)
+	}
+}
+
 func (s *gadgetYamlTestSuite) TestValidateStructureSizeRequired(c *C) {
 
 	gv := &gadget.Volume{}
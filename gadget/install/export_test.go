@@ -0,0 +1,50 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package install
+
+import (
+	"os"
+
+	"github.com/snapcore/snapd/gadget"
+)
+
+func MockGadgetWriteStructure(f func(out *os.File, lv *gadget.LaidOutVolume, ps *gadget.LaidOutStructure, workDir string, postStage gadget.PostStageFunc) error) (restore func()) {
+	old := gadgetWriteStructure
+	gadgetWriteStructure = f
+	return func() {
+		gadgetWriteStructure = old
+	}
+}
+
+func MockGadgetWriteFilesystemStructure(f func(node string, lv *gadget.LaidOutVolume, ps *gadget.LaidOutStructure, workDir string, postStage gadget.PostStageFunc) error) (restore func()) {
+	old := gadgetWriteFilesystemStructure
+	gadgetWriteFilesystemStructure = f
+	return func() {
+		gadgetWriteFilesystemStructure = old
+	}
+}
+
+func MockIsBlockDevice(f func(path string) bool) (restore func()) {
+	old := isBlockDevice
+	isBlockDevice = f
+	return func() {
+		isBlockDevice = old
+	}
+}
@@ -0,0 +1,189 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package install implements installing a system onto a block device, laid
+// out as described by the gadget.
+package install
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+)
+
+var (
+	gadgetWriteStructure           = gadget.WriteStructure
+	gadgetWriteFilesystemStructure = gadget.WriteFilesystemStructure
+
+	isBlockDevice = func(path string) bool {
+		st, err := os.Stat(path)
+		return err == nil && st.Mode()&os.ModeDevice != 0 && st.Mode()&os.ModeCharDevice == 0
+	}
+
+	installConstraints = gadget.LayoutConstraints{
+		NonMBRStartOffset: 1 * gadget.SizeMiB,
+		SectorSize:        512,
+	}
+)
+
+// Options describe how the system is installed onto the device.
+type Options struct {
+	// SeedDir is the directory with the seed, it is copied over to the
+	// system-data structure.
+	SeedDir string
+	// WorkDir is where filesystem contents are staged before being
+	// written to the device, the default temporary directory is used when
+	// unset.
+	WorkDir string
+}
+
+// Run installs the system onto the given block device, or a file backing a
+// loop device. The device is partitioned as described by the sole volume of
+// the gadget unpacked in gadgetRoot, with filesystems created and populated
+// with the gadget content, and the seed copied over to the system-data
+// structure. Partitions already present on the device are kept, together
+// with their content, as long as they match a structure of the volume by
+// name, offset and size. Any other partition present on the device is an
+// error. On block devices, filesystems are created directly on the partition
+// nodes, otherwise they are written sparsely into the file.
+func Run(gadgetRoot, device string, options *Options) error {
+	if options == nil {
+		options = &Options{}
+	}
+	if device == "" {
+		return fmt.Errorf("internal error: device path is unset")
+	}
+
+	info, err := gadget.ReadInfo(gadgetRoot, false)
+	if err != nil {
+		return err
+	}
+	if len(info.Volumes) != 1 {
+		return fmt.Errorf("cannot install a gadget with %d volumes", len(info.Volumes))
+	}
+	var lv *gadget.LaidOutVolume
+	for name := range info.Volumes {
+		vol := info.Volumes[name]
+		lv, err = gadget.LayoutVolume(gadgetRoot, &vol, installConstraints)
+		if err != nil {
+			return fmt.Errorf("cannot lay out volume %q: %v", name, err)
+		}
+	}
+
+	pt, err := gadget.ReadPartitionTable(device)
+	if err != nil {
+		return err
+	}
+	kept, missing, err := matchPartitions(lv, pt)
+	if err != nil {
+		return fmt.Errorf("cannot install onto %s: %v", device, err)
+	}
+	switch {
+	case len(kept) == 0:
+		if err := gadget.Partition(device, lv); err != nil {
+			return err
+		}
+	case len(missing) != 0:
+		if err := gadget.AddPartitions(device, lv, missing); err != nil {
+			return err
+		}
+	}
+
+	return writeContent(device, lv, kept, options)
+}
+
+func writeContent(device string, lv *gadget.LaidOutVolume, kept map[int]bool, options *Options) (err error) {
+	nodes, err := partitionNodes(device, lv)
+	if err != nil {
+		return err
+	}
+
+	workDir, err := ioutil.TempDir(options.WorkDir, "snap-install-")
+	if err != nil {
+		return fmt.Errorf("cannot create work directory: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	out, err := os.OpenFile(device, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("cannot open device: %v", err)
+	}
+	defer func() {
+		if cerr := out.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("cannot close device: %v", cerr)
+		}
+	}()
+
+	postStage := func(stageDir string, ps *gadget.LaidOutStructure) error {
+		if ps.EffectiveRole() != gadget.SystemData || options.SeedDir == "" {
+			return nil
+		}
+		return copySeed(options.SeedDir, stageDir)
+	}
+
+	for idx := range lv.LaidOutStructure {
+		ps := &lv.LaidOutStructure[idx]
+		if kept[ps.Index] {
+			logger.Debugf("keeping existing content of structure %v", ps)
+			continue
+		}
+		if node := nodes[ps.Index]; node != "" && !ps.IsBare() {
+			if err := gadgetWriteFilesystemStructure(node, lv, ps, workDir, postStage); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := gadgetWriteStructure(out, lv, ps, workDir, postStage); err != nil {
+			return err
+		}
+	}
+	for idx := range lv.LaidOutStructure {
+		ps := &lv.LaidOutStructure[idx]
+		ow, err := gadget.NewOffsetWriter(ps, lv.SectorSize)
+		if err != nil {
+			return err
+		}
+		if err := ow.Write(out); err != nil {
+			return fmt.Errorf("cannot write offsets of structure %v: %v", ps, err)
+		}
+	}
+
+	if err := out.Sync(); err != nil {
+		return fmt.Errorf("cannot sync device: %v", err)
+	}
+	return nil
+}
+
+// copySeed copies the seed to the location expected on the writable
+// partition of core devices.
+func copySeed(seedDir, stageDir string) error {
+	dst := filepath.Join(stageDir, "system-data/var/lib/snapd/seed")
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("cannot copy seed: %v", err)
+	}
+	if err := osutil.CopySpecialFile(seedDir, dst); err != nil {
+		return fmt.Errorf("cannot copy seed: %v", err)
+	}
+	return nil
+}
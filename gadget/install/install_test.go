@@ -0,0 +1,374 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package install_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/gadget/install"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func TestInstall(t *testing.T) { TestingT(t) }
+
+type installSuite struct {
+	testutil.BaseTest
+
+	dir       string
+	gadgetDir string
+	seedDir   string
+	device    string
+	sfdisk    *testutil.MockCmd
+
+	written []string
+}
+
+var _ = Suite(&installSuite{})
+
+const gadgetYaml = `
+volumes:
+  pc:
+    bootloader: grub
+    structure:
+      - name: mbr
+        type: mbr
+        size: 440
+        content:
+          - image: pc-boot.img
+      - name: BIOS Boot
+        type: DA,21686148-6449-6E6F-744E-656564454649
+        size: 1M
+        offset: 1M
+        offset-write: mbr+92
+        content:
+          - image: pc-core.img
+      - name: EFI System
+        type: C12A7328-F81F-11D2-BA4B-00A0C93EC93B
+        filesystem: vfat
+        filesystem-label: system-boot
+        size: 2M
+      - name: writable
+        role: system-data
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        filesystem: ext4
+        size: 4M
+`
+
+const partitionsDumpFmt = `{
+   "partitiontable": {
+      "label": "%s",
+      "id": "A1B2C3D4-0000-0000-0000-000000000000",
+      "device": "%s",
+      "unit": "sectors",
+      "firstlba": 34,
+      "lastlba": 16350,
+      "partitions": [%s]
+   }
+}
+`
+
+const biosBootPartition = `{"node": "/dev/node1", "start": 2048, "size": 2048, "type": "21686148-6449-6E6F-744E-656564454649", "uuid": "1", "name": "BIOS Boot"}`
+const efiSystemPartition = `{"node": "/dev/node2", "start": 4096, "size": 4096, "type": "C12A7328-F81F-11D2-BA4B-00A0C93EC93B", "uuid": "2", "name": "EFI System"}`
+const writablePartition = `{"node": "/dev/node3", "start": 8192, "size": 8192, "type": "0FC63DAF-8483-4772-8E79-3D69D8477DE4", "uuid": "3", "name": "writable"}`
+
+func (s *installSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+
+	s.dir = c.MkDir()
+	s.gadgetDir = filepath.Join(s.dir, "gadget")
+	s.writeFile(c, filepath.Join(s.gadgetDir, "meta/gadget.yaml"), gadgetYaml)
+	s.writeFile(c, filepath.Join(s.gadgetDir, "pc-boot.img"), string(make([]byte, 440)))
+	s.writeFile(c, filepath.Join(s.gadgetDir, "pc-core.img"), "core")
+
+	s.seedDir = filepath.Join(s.dir, "seed")
+	s.writeFile(c, filepath.Join(s.seedDir, "seed.yaml"), "seed")
+
+	s.device = filepath.Join(s.dir, "device.img")
+	f, err := os.Create(s.device)
+	c.Assert(err, IsNil)
+	c.Assert(f.Truncate(int64(8*gadget.SizeMiB)), IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	// sfdisk dumps the partition table from dump.json, if any
+	s.sfdisk = testutil.MockCommand(c, "sfdisk", fmt.Sprintf(`
+if [ "$1" = "--json" ]; then
+    if [ -e %[1]s/dump.json ]; then
+        cat %[1]s/dump.json
+        exit 0
+    fi
+    echo "sfdisk: $2: does not contain a recognized partition table" >&2
+    exit 1
+fi
+cat > %[1]s/input
+`, s.dir))
+	s.AddCleanup(s.sfdisk.Restore)
+
+	s.written = nil
+	s.AddCleanup(install.MockGadgetWriteStructure(func(out *os.File, lv *gadget.LaidOutVolume, ps *gadget.LaidOutStructure, workDir string, postStage gadget.PostStageFunc) error {
+		c.Check(out.Name(), Equals, s.device)
+		c.Check(lv.RootDir, Equals, s.gadgetDir)
+		c.Check(osutil.IsDirectory(workDir), Equals, true)
+		s.written = append(s.written, ps.Name)
+		if !ps.IsBare() {
+			stageDir := c.MkDir()
+			c.Assert(postStage(stageDir, ps), IsNil)
+			if ps.Role == gadget.SystemData {
+				c.Check(filepath.Join(stageDir, "system-data/var/lib/snapd/seed/seed.yaml"), testutil.FileEquals, "seed")
+			} else {
+				c.Check(filepath.Join(stageDir, "system-data"), testutil.FileAbsent)
+			}
+		}
+		return nil
+	}))
+}
+
+func (s *installSuite) writeFile(c *C, p, content string) {
+	c.Assert(os.MkdirAll(filepath.Dir(p), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(p, []byte(content), 0644), IsNil)
+}
+
+func (s *installSuite) mockPartitions(c *C, label string, partitions ...string) {
+	parts := ""
+	for i, p := range partitions {
+		if i > 0 {
+			parts += ", "
+		}
+		parts += p
+	}
+	s.writeFile(c, filepath.Join(s.dir, "dump.json"), fmt.Sprintf(partitionsDumpFmt, label, s.device, parts))
+}
+
+func (s *installSuite) checkOffsetWrite(c *C) {
+	data, err := ioutil.ReadFile(s.device)
+	c.Assert(err, IsNil)
+	c.Check(binary.LittleEndian.Uint32(data[92:96]), Equals, uint32(2048))
+}
+
+func (s *installSuite) TestInstallBlankDevice(c *C) {
+	err := install.Run(s.gadgetDir, s.device, &install.Options{
+		SeedDir: s.seedDir,
+		WorkDir: s.dir,
+	})
+	c.Assert(err, IsNil)
+
+	c.Check(s.sfdisk.Calls(), DeepEquals, [][]string{
+		{"sfdisk", "--json", s.device},
+		{"sfdisk", s.device},
+	})
+	c.Check(filepath.Join(s.dir, "input"), testutil.FileEquals, `unit: sectors
+label: gpt
+first-lba: 34
+
+start=2048, size=2048, type=21686148-6449-6E6F-744E-656564454649, name="BIOS Boot"
+start=4096, size=4096, type=C12A7328-F81F-11D2-BA4B-00A0C93EC93B, name="EFI System"
+start=8192, size=8192, type=0FC63DAF-8483-4772-8E79-3D69D8477DE4, name="writable"
+`)
+	c.Check(s.written, DeepEquals, []string{"mbr", "BIOS Boot", "EFI System", "writable"})
+	s.checkOffsetWrite(c)
+
+	// the work directory is cleaned up
+	matches, err := filepath.Glob(filepath.Join(s.dir, "snap-install-*"))
+	c.Assert(err, IsNil)
+	c.Check(matches, HasLen, 0)
+}
+
+func (s *installSuite) TestInstallBlockDeviceWritesPartitionNodes(c *C) {
+	s.AddCleanup(install.MockIsBlockDevice(func(path string) bool {
+		c.Check(path, Equals, s.device)
+		return true
+	}))
+	// the partitions show up once udev has settled
+	s.writeFile(c, filepath.Join(s.dir, "dump-after.json"), fmt.Sprintf(partitionsDumpFmt, "gpt", s.device,
+		biosBootPartition+", "+efiSystemPartition+", "+writablePartition))
+	udevadm := testutil.MockCommand(c, "udevadm", fmt.Sprintf("cp %[1]s/dump-after.json %[1]s/dump.json", s.dir))
+	defer udevadm.Restore()
+
+	var nodes []string
+	s.AddCleanup(install.MockGadgetWriteFilesystemStructure(func(node string, lv *gadget.LaidOutVolume, ps *gadget.LaidOutStructure, workDir string, postStage gadget.PostStageFunc) error {
+		c.Check(lv.RootDir, Equals, s.gadgetDir)
+		c.Check(osutil.IsDirectory(workDir), Equals, true)
+		nodes = append(nodes, fmt.Sprintf("%s:%s", ps.Name, node))
+		stageDir := c.MkDir()
+		c.Assert(postStage(stageDir, ps), IsNil)
+		if ps.Role == gadget.SystemData {
+			c.Check(filepath.Join(stageDir, "system-data/var/lib/snapd/seed/seed.yaml"), testutil.FileEquals, "seed")
+		}
+		return nil
+	}))
+
+	err := install.Run(s.gadgetDir, s.device, &install.Options{SeedDir: s.seedDir})
+	c.Assert(err, IsNil)
+
+	c.Check(s.sfdisk.Calls(), DeepEquals, [][]string{
+		{"sfdisk", "--json", s.device},
+		{"sfdisk", s.device},
+		{"sfdisk", "--json", s.device},
+	})
+	c.Check(udevadm.Calls(), DeepEquals, [][]string{{"udevadm", "settle"}})
+	// filesystems are created on the partitions directly
+	c.Check(nodes, DeepEquals, []string{"EFI System:/dev/node2", "writable:/dev/node3"})
+	c.Check(s.written, DeepEquals, []string{"mbr", "BIOS Boot"})
+	s.checkOffsetWrite(c)
+}
+
+func (s *installSuite) TestInstallBlockDeviceSettleError(c *C) {
+	s.AddCleanup(install.MockIsBlockDevice(func(path string) bool { return true }))
+	udevadm := testutil.MockCommand(c, "udevadm", "echo 'timeout'; exit 1")
+	defer udevadm.Restore()
+
+	err := install.Run(s.gadgetDir, s.device, nil)
+	c.Assert(err, ErrorMatches, `cannot wait for partitions of .*/device.img: timeout`)
+	c.Check(s.written, HasLen, 0)
+}
+
+func (s *installSuite) TestInstallReadsPartitionTableWithCLocale(c *C) {
+	os.Setenv("LC_ALL", "fr_FR.UTF-8")
+	defer os.Unsetenv("LC_ALL")
+	sfdisk := testutil.MockCommand(c, "sfdisk", `
+if [ "$1" = "--json" ]; then
+    if [ "$LC_ALL" != "C" ]; then
+        echo "sfdisk: $2: ne contient pas une table de partitions reconnue" >&2
+        exit 1
+    fi
+    echo "sfdisk: $2: does not contain a recognized partition table" >&2
+    exit 1
+fi
+`)
+	defer sfdisk.Restore()
+
+	err := install.Run(s.gadgetDir, s.device, nil)
+	c.Assert(err, IsNil)
+	c.Check(s.written, DeepEquals, []string{"mbr", "BIOS Boot", "EFI System", "writable"})
+}
+
+func (s *installSuite) TestInstallEmptyPartitionTable(c *C) {
+	s.mockPartitions(c, "dos")
+
+	err := install.Run(s.gadgetDir, s.device, nil)
+	c.Assert(err, IsNil)
+
+	c.Check(s.sfdisk.Calls(), DeepEquals, [][]string{
+		{"sfdisk", "--json", s.device},
+		{"sfdisk", s.device},
+	})
+	c.Check(s.written, DeepEquals, []string{"mbr", "BIOS Boot", "EFI System", "writable"})
+}
+
+func (s *installSuite) TestInstallKeepsMatchingPartitions(c *C) {
+	s.mockPartitions(c, "gpt", biosBootPartition, efiSystemPartition)
+
+	err := install.Run(s.gadgetDir, s.device, &install.Options{SeedDir: s.seedDir})
+	c.Assert(err, IsNil)
+
+	c.Check(s.sfdisk.Calls(), DeepEquals, [][]string{
+		{"sfdisk", "--json", s.device},
+		{"sfdisk", "--append", s.device},
+	})
+	c.Check(filepath.Join(s.dir, "input"), testutil.FileEquals, `unit: sectors
+
+start=8192, size=8192, type=0FC63DAF-8483-4772-8E79-3D69D8477DE4, name="writable"
+`)
+	c.Check(s.written, DeepEquals, []string{"mbr", "writable"})
+	s.checkOffsetWrite(c)
+}
+
+func (s *installSuite) TestInstallAllPartitionsPresent(c *C) {
+	s.mockPartitions(c, "gpt", writablePartition, biosBootPartition, efiSystemPartition)
+
+	err := install.Run(s.gadgetDir, s.device, nil)
+	c.Assert(err, IsNil)
+
+	c.Check(s.sfdisk.Calls(), DeepEquals, [][]string{
+		{"sfdisk", "--json", s.device},
+	})
+	c.Check(s.written, DeepEquals, []string{"mbr"})
+	s.checkOffsetWrite(c)
+}
+
+func (s *installSuite) TestInstallMismatchedPartition(c *C) {
+	s.mockPartitions(c, "gpt", biosBootPartition,
+		`{"node": "/dev/node2", "start": 4096, "size": 2048, "type": "C12A7328-F81F-11D2-BA4B-00A0C93EC93B", "uuid": "2", "name": "EFI System"}`)
+
+	err := install.Run(s.gadgetDir, s.device, nil)
+	c.Assert(err, ErrorMatches, `cannot install onto .*/device.img: partition /dev/node2 does not match any structure of the gadget`)
+	c.Check(s.sfdisk.Calls(), HasLen, 1)
+	c.Check(s.written, HasLen, 0)
+}
+
+func (s *installSuite) TestInstallRenamedPartition(c *C) {
+	s.mockPartitions(c, "gpt",
+		`{"node": "/dev/node1", "start": 2048, "size": 2048, "type": "21686148-6449-6E6F-744E-656564454649", "uuid": "1", "name": "other"}`)
+
+	err := install.Run(s.gadgetDir, s.device, nil)
+	c.Assert(err, ErrorMatches, `cannot install onto .*/device.img: partition /dev/node1 does not match any structure of the gadget`)
+}
+
+func (s *installSuite) TestInstallWrongPartitionTable(c *C) {
+	s.mockPartitions(c, "dos", biosBootPartition)
+
+	err := install.Run(s.gadgetDir, s.device, nil)
+	c.Assert(err, ErrorMatches, `cannot install onto .*/device.img: cannot use existing "dos" partition table for a volume with "gpt" schema`)
+	c.Check(s.written, HasLen, 0)
+}
+
+func (s *installSuite) TestInstallReadPartitionTableError(c *C) {
+	sfdisk := testutil.MockCommand(c, "sfdisk", "echo 'cannot open device'; exit 1")
+	defer sfdisk.Restore()
+
+	err := install.Run(s.gadgetDir, s.device, nil)
+	c.Assert(err, ErrorMatches, `cannot read partition table of .*/device.img: cannot open device`)
+}
+
+func (s *installSuite) TestInstallPartitionError(c *C) {
+	sfdisk := testutil.MockCommand(c, "sfdisk", `[ "$1" = "--json" ] && echo "{}" && exit 0; echo 'failed'; exit 1`)
+	defer sfdisk.Restore()
+
+	err := install.Run(s.gadgetDir, s.device, nil)
+	c.Assert(err, ErrorMatches, `cannot partition image using sfdisk: failed`)
+	c.Check(s.written, HasLen, 0)
+}
+
+func (s *installSuite) TestInstallMultipleVolumes(c *C) {
+	s.writeFile(c, filepath.Join(s.gadgetDir, "meta/gadget.yaml"), gadgetYaml+`
+  other:
+    structure:
+      - name: data
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        size: 1M
+`)
+
+	err := install.Run(s.gadgetDir, s.device, nil)
+	c.Assert(err, ErrorMatches, `cannot install a gadget with 2 volumes`)
+	c.Check(s.sfdisk.Calls(), HasLen, 0)
+}
+
+func (s *installSuite) TestInstallErrors(c *C) {
+	err := install.Run(s.gadgetDir, "", nil)
+	c.Assert(err, ErrorMatches, `internal error: device path is unset`)
+}
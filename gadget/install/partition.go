@@ -0,0 +1,117 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package install
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/osutil"
+)
+
+func sfdiskLabel(schema string) string {
+	if schema == gadget.MBR {
+		return "dos"
+	}
+	return "gpt"
+}
+
+func isPartition(ps *gadget.LaidOutStructure) bool {
+	return ps.Type != "bare" && ps.Type != "mbr"
+}
+
+// matchPartitions matches the partitions present on the device with the
+// structures of the volume, by name, offset and size. It returns the indices
+// of the structures with a matching partition and the structures for which
+// partitions are missing.
+func matchPartitions(lv *gadget.LaidOutVolume, pt *gadget.PartitionTable) (kept map[int]bool, missing []gadget.LaidOutStructure, err error) {
+	kept = make(map[int]bool)
+	var partitions []gadget.PartitionTableEntry
+	if pt != nil {
+		partitions = pt.Partitions
+	}
+	if len(partitions) != 0 && pt.Label != sfdiskLabel(lv.EffectiveSchema()) {
+		return nil, nil, fmt.Errorf("cannot use existing %q partition table for a volume with %q schema", pt.Label, lv.EffectiveSchema())
+	}
+
+	sectors := func(v gadget.Size) uint64 {
+		return uint64(v / lv.SectorSize)
+	}
+	for _, p := range partitions {
+		found := false
+		for idx := range lv.LaidOutStructure {
+			ps := &lv.LaidOutStructure[idx]
+			if !isPartition(ps) || kept[ps.Index] {
+				continue
+			}
+			if p.Start != sectors(ps.StartOffset) || p.Size != sectors(ps.Size) {
+				continue
+			}
+			// MBR partitions carry no names
+			if lv.EffectiveSchema() == gadget.GPT && p.Name != ps.Name {
+				continue
+			}
+			kept[ps.Index] = true
+			found = true
+			break
+		}
+		if !found {
+			return nil, nil, fmt.Errorf("partition %s does not match any structure of the gadget", p.Node)
+		}
+	}
+
+	for _, ps := range lv.LaidOutStructure {
+		if isPartition(&ps) && !kept[ps.Index] {
+			missing = append(missing, ps)
+		}
+	}
+	return kept, missing, nil
+}
+
+// partitionNodes returns the device nodes of the partitions holding the
+// structures of the volume, indexed by structure, when device is a block
+// device. It waits for udev to create the nodes of freshly added partitions.
+func partitionNodes(device string, lv *gadget.LaidOutVolume) (map[int]string, error) {
+	nodes := make(map[int]string)
+	if !isBlockDevice(device) {
+		return nodes, nil
+	}
+	if output, err := exec.Command("udevadm", "settle").CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("cannot wait for partitions of %s: %v", device, osutil.OutputErr(output, err))
+	}
+	pt, err := gadget.ReadPartitionTable(device)
+	if err != nil {
+		return nil, err
+	}
+	if pt == nil {
+		return nil, fmt.Errorf("cannot find partition table of %s", device)
+	}
+	for _, p := range pt.Partitions {
+		for idx := range lv.LaidOutStructure {
+			ps := &lv.LaidOutStructure[idx]
+			if isPartition(ps) && p.Start == uint64(ps.StartOffset/lv.SectorSize) {
+				nodes[ps.Index] = p.Node
+				break
+			}
+		}
+	}
+	return nodes, nil
+}
@@ -0,0 +1,596 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package gadget
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+)
+
+// layoutJournalName is the name of the journal of a layout change kept in the
+// rollback directory.
+const layoutJournalName = "layout-journal.json"
+
+const (
+	// opRelocateGPTBackup moves the backup GPT to the end of the device
+	opRelocateGPTBackup = "relocate-gpt-backup"
+	// opGrowPartition extends the partition table entry of a structure
+	opGrowPartition = "grow-partition"
+	// opGrowFilesystem resizes the filesystem to fill a grown partition
+	opGrowFilesystem = "grow-filesystem"
+	// opAddPartition adds a partition table entry for a new structure
+	opAddPartition = "add-partition"
+	// opWriteStructure writes the content of a new structure
+	opWriteStructure = "write-structure"
+)
+
+var (
+	// layoutDeviceLookup finds the device holding the volume
+	layoutDeviceLookup = findParentDeviceWithWritableFallback
+)
+
+// layoutChange describes the changes to the layout of a volume that can be
+// applied on a device.
+type layoutChange struct {
+	// grown is the structure of the new volume that has grown in size
+	grown *LaidOutStructure
+	// grownFrom is the size of the grown structure in the old volume
+	grownFrom Size
+	// added are the structures of the new volume that were appended
+	added []*LaidOutStructure
+}
+
+func (c *layoutChange) isEmpty() bool {
+	return c.grown == nil && len(c.added) == 0
+}
+
+func isPartition(ps *LaidOutStructure) bool {
+	return ps.Type != "bare" && ps.Type != MBR
+}
+
+// resolveLayoutChange finds the changes of layout between the old and the new
+// volume. Only a safe subset of changes is supported, namely growing the last
+// structure of the volume and appending new structures after it.
+func resolveLayoutChange(from *LaidOutVolume, to *LaidOutVolume) (*layoutChange, error) {
+	if len(to.LaidOutStructure) < len(from.LaidOutStructure) {
+		return nil, fmt.Errorf("cannot change the number of structures within volume from %v to %v", len(from.LaidOutStructure), len(to.LaidOutStructure))
+	}
+
+	change := &layoutChange{}
+	last := len(from.LaidOutStructure) - 1
+	for i := range from.LaidOutStructure {
+		f, t := &from.LaidOutStructure[i], &to.LaidOutStructure[i]
+		if f.StartOffset != t.StartOffset {
+			return nil, fmt.Errorf("cannot change structure %v start offset from %v to %v", t, f.StartOffset, t.StartOffset)
+		}
+		if f.Size == t.Size {
+			continue
+		}
+		if i != last || t.Size < f.Size {
+			return nil, fmt.Errorf("cannot change structure %v size from %v to %v", t, f.Size, t.Size)
+		}
+		if !isPartition(f) || !isPartition(t) {
+			return nil, fmt.Errorf("cannot grow structure %v without a partition table entry", t)
+		}
+		if !t.IsBare() && t.Filesystem != "ext4" {
+			return nil, fmt.Errorf("cannot grow structure %v with %q filesystem", t, t.Filesystem)
+		}
+		change.grown = t
+		change.grownFrom = f.Size
+	}
+
+	for i := len(from.LaidOutStructure); i < len(to.LaidOutStructure); i++ {
+		t := &to.LaidOutStructure[i]
+		if !isPartition(t) {
+			return nil, fmt.Errorf("cannot add structure %v without a partition table entry", t)
+		}
+		if t.Role != "" {
+			return nil, fmt.Errorf("cannot add structure %v with role %q", t, t.Role)
+		}
+		if t.AbsoluteOffsetWrite != nil {
+			return nil, fmt.Errorf("cannot add structure %v with offset-write", t)
+		}
+		for _, pc := range t.LaidOutContent {
+			if pc.AbsoluteOffsetWrite != nil {
+				return nil, fmt.Errorf("cannot add structure %v with offset-write", t)
+			}
+		}
+		change.added = append(change.added, t)
+	}
+	return change, nil
+}
+
+// layoutJournal records the steps of a layout change applied to a device, so
+// that an interrupted change can be resumed or reverted. The journal is kept
+// until the whole gadget update is done, so that the layout change can be
+// reverted should updating the structures fail.
+type layoutJournal struct {
+	Device string        `json:"device"`
+	Steps  []*layoutStep `json:"steps"`
+
+	path string
+}
+
+// layoutStep is a single step of a layout change, start and sizes are in
+// sectors.
+type layoutStep struct {
+	Op string `json:"op"`
+	// Structure is the index of the structure in the gadget volume
+	Structure int `json:"structure"`
+	// Partition is the number of the partition of the structure
+	Partition int    `json:"partition,omitempty"`
+	Node      string `json:"node,omitempty"`
+	Start     uint64 `json:"start,omitempty"`
+	Size      uint64 `json:"size,omitempty"`
+	OldSize   uint64 `json:"old-size,omitempty"`
+	Done      bool   `json:"done"`
+}
+
+func readLayoutJournal(path string) (*layoutJournal, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read layout change journal: %v", err)
+	}
+	j := layoutJournal{path: path}
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("cannot decode layout change journal: %v", err)
+	}
+	return &j, nil
+}
+
+func (j *layoutJournal) save() error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	if err := osutil.AtomicWriteFile(j.path, data, 0600, 0); err != nil {
+		return fmt.Errorf("cannot write layout change journal: %v", err)
+	}
+	return nil
+}
+
+func findStructure(lv *LaidOutVolume, index int) *LaidOutStructure {
+	for idx := range lv.LaidOutStructure {
+		if lv.LaidOutStructure[idx].Index == index {
+			return &lv.LaidOutStructure[idx]
+		}
+	}
+	return nil
+}
+
+// matches checks that the steps of the journal apply to the structures of the
+// given volume.
+func (j *layoutJournal) matches(lv *LaidOutVolume) error {
+	for _, step := range j.Steps {
+		if step.Op == opRelocateGPTBackup {
+			continue
+		}
+		ps := findStructure(lv, step.Structure)
+		if ps == nil {
+			return fmt.Errorf("no structure #%v in the volume", step.Structure)
+		}
+		if step.Start != uint64(ps.StartOffset/lv.SectorSize) {
+			return fmt.Errorf("structure %v has a different start offset", ps)
+		}
+		if (step.Op == opGrowPartition || step.Op == opAddPartition) && step.Size != uint64(ps.Size/lv.SectorSize) {
+			return fmt.Errorf("structure %v has a different size", ps)
+		}
+	}
+	return nil
+}
+
+// planLayoutChange returns the steps needed to apply the layout change to the
+// device with the given partition table. Changes that are already present on
+// the device are skipped.
+func planLayoutChange(lv *LaidOutVolume, change *layoutChange, pt *PartitionTable) ([]*layoutStep, error) {
+	sectors := func(v Size) uint64 {
+		return uint64(v / lv.SectorSize)
+	}
+	findEntry := func(ps *LaidOutStructure) *PartitionTableEntry {
+		for idx, p := range pt.Partitions {
+			if p.Start != sectors(ps.StartOffset) {
+				continue
+			}
+			// MBR partitions carry no names
+			if lv.EffectiveSchema() == GPT && p.Name != ps.Name {
+				continue
+			}
+			return &pt.Partitions[idx]
+		}
+		return nil
+	}
+
+	var steps []*layoutStep
+	if ps := change.grown; ps != nil {
+		p := findEntry(ps)
+		if p == nil {
+			return nil, fmt.Errorf("cannot find partition of structure %v", ps)
+		}
+		switch {
+		case p.Size >= sectors(ps.Size):
+			// already grown
+		case p.Size == sectors(change.grownFrom):
+			num, err := p.Number()
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, &layoutStep{
+				Op:        opGrowPartition,
+				Structure: ps.Index,
+				Partition: num,
+				Node:      p.Node,
+				Start:     p.Start,
+				Size:      sectors(ps.Size),
+				OldSize:   p.Size,
+			})
+			if !ps.IsBare() {
+				steps = append(steps, &layoutStep{
+					Op:        opGrowFilesystem,
+					Structure: ps.Index,
+					Partition: num,
+					Node:      p.Node,
+					Start:     p.Start,
+				})
+			}
+		default:
+			return nil, fmt.Errorf("cannot grow structure %v, partition %s has unexpected size %v", ps, p.Node, p.Size)
+		}
+	}
+
+	for _, ps := range change.added {
+		if p := findEntry(ps); p != nil {
+			if p.Size != sectors(ps.Size) {
+				return nil, fmt.Errorf("cannot add structure %v, partition %s has unexpected size %v", ps, p.Node, p.Size)
+			}
+			// already added
+			continue
+		}
+		// partitions on the device may extend past the structures
+		// of the volume
+		start, end := sectors(ps.StartOffset), sectors(ps.StartOffset+ps.Size)
+		for _, p := range pt.Partitions {
+			if p.Start < end && p.Start+p.Size > start {
+				return nil, fmt.Errorf("cannot add structure %v, it overlaps with partition %s", ps, p.Node)
+			}
+		}
+		steps = append(steps, &layoutStep{
+			Op:        opAddPartition,
+			Structure: ps.Index,
+			Start:     sectors(ps.StartOffset),
+			Size:      sectors(ps.Size),
+		}, &layoutStep{
+			Op:        opWriteStructure,
+			Structure: ps.Index,
+			Start:     sectors(ps.StartOffset),
+		})
+	}
+
+	if len(steps) != 0 && lv.EffectiveSchema() == GPT {
+		// the device may be larger than the image it was flashed
+		// with, move the backup GPT to the actual end of the device
+		steps = append([]*layoutStep{{Op: opRelocateGPTBackup}}, steps...)
+	}
+	return steps, nil
+}
+
+func deviceSize(device string) (Size, error) {
+	f, err := os.Open(device)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	return Size(size), nil
+}
+
+// checkLayoutFits checks that the volume fits the device.
+func checkLayoutFits(lv *LaidOutVolume, device string) error {
+	size, err := deviceSize(device)
+	if err != nil {
+		return fmt.Errorf("cannot determine size of device %s: %v", device, err)
+	}
+	if needed := volumeImageSize(lv); needed > size {
+		return fmt.Errorf("device %s is too small for the volume, %v bytes needed, %v available", device, needed, size)
+	}
+	return nil
+}
+
+func runLayoutCommand(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cannot run %s: %v", name, osutil.OutputErr(out, err))
+	}
+	return nil
+}
+
+// resizePartition changes the size of the partition table entry of the given
+// partition, the kernel is informed of the change as the device is in use.
+func resizePartition(device string, partition int, start, size uint64) error {
+	script := fmt.Sprintf("start=%v, size=%v\n", start, size)
+	if err := runSfdisk(device, script, "--no-reread", "-N", fmt.Sprint(partition)); err != nil {
+		return err
+	}
+	return runLayoutCommand("partx", "--update", "--nr", fmt.Sprint(partition), device)
+}
+
+func (j *layoutJournal) applyStep(lv *LaidOutVolume, step *layoutStep, workDir string) error {
+	switch step.Op {
+	case opRelocateGPTBackup:
+		return runLayoutCommand("sfdisk", "--no-reread", "--relocate", "gpt-bak-std", j.Device)
+	case opGrowPartition:
+		return resizePartition(j.Device, step.Partition, step.Start, step.Size)
+	case opGrowFilesystem:
+		return runLayoutCommand("resize2fs", step.Node)
+	}
+
+	ps := findStructure(lv, step.Structure)
+	if ps == nil {
+		return fmt.Errorf("internal error: no structure #%v in the volume", step.Structure)
+	}
+	switch step.Op {
+	case opAddPartition:
+		pt, err := ReadPartitionTable(j.Device)
+		if err != nil {
+			return err
+		}
+		if pt == nil {
+			return fmt.Errorf("cannot find partition table of %s", j.Device)
+		}
+		entry := func() *PartitionTableEntry {
+			for idx := range pt.Partitions {
+				if pt.Partitions[idx].Start == step.Start {
+					return &pt.Partitions[idx]
+				}
+			}
+			return nil
+		}
+		// the partition may have been added by an interrupted attempt
+		if entry() == nil {
+			script := &bytes.Buffer{}
+			fmt.Fprintf(script, "unit: sectors\n\n")
+			writePartitionEntries(script, lv, []LaidOutStructure{*ps})
+			if err := runSfdisk(j.Device, script.String(), "--append", "--no-reread"); err != nil {
+				return err
+			}
+			if pt, err = ReadPartitionTable(j.Device); err != nil {
+				return err
+			}
+		}
+		p := entry()
+		if p == nil {
+			return fmt.Errorf("cannot find partition of structure %v", ps)
+		}
+		num, err := p.Number()
+		if err != nil {
+			return err
+		}
+		step.Partition = num
+		step.Node = p.Node
+		return runLayoutCommand("partx", "--add", "--nr", fmt.Sprint(num), j.Device)
+	case opWriteStructure:
+		out, err := os.OpenFile(j.Device, os.O_RDWR, 0)
+		if err != nil {
+			return fmt.Errorf("cannot open device: %v", err)
+		}
+		defer out.Close()
+		if err := WriteStructure(out, lv, ps, workDir, nil); err != nil {
+			return err
+		}
+		return out.Sync()
+	}
+	return fmt.Errorf("internal error: unknown layout change step %q", step.Op)
+}
+
+func (j *layoutJournal) revertStep(step *layoutStep) error {
+	switch step.Op {
+	case opAddPartition:
+		if err := runLayoutCommand("sfdisk", "--no-reread", "--delete", j.Device, fmt.Sprint(step.Partition)); err != nil {
+			return err
+		}
+		if err := runLayoutCommand("partx", "--delete", "--nr", fmt.Sprint(step.Partition), j.Device); err != nil {
+			// the kernel may not have known the partition yet
+			logger.Noticef("cannot remove partition %v from the kernel: %v", step.Partition, err)
+		}
+	case opGrowPartition:
+		for _, other := range j.Steps {
+			if other.Op == opGrowFilesystem && other.Structure == step.Structure && other.Done {
+				// a grown filesystem does not fit the old
+				// partition, the partition stays grown
+				return nil
+			}
+		}
+		return resizePartition(j.Device, step.Partition, step.Start, step.OldSize)
+	}
+	// other steps need no revert
+	return nil
+}
+
+// run applies the steps of the journal that are not done yet, recording the
+// progress in the journal.
+func (j *layoutJournal) run(lv *LaidOutVolume, workDir string) error {
+	for _, step := range j.Steps {
+		if step.Done {
+			continue
+		}
+		if err := j.applyStep(lv, step, workDir); err != nil {
+			if step.Op == opAddPartition && step.Partition != 0 {
+				// the partition exists, revert it too
+				step.Done = true
+			}
+			return fmt.Errorf("cannot %s: %v", step.Op, err)
+		}
+		step.Done = true
+		if err := j.save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revert reverts the steps of the journal that are done, in reverse order.
+func (j *layoutJournal) revert() error {
+	for i := len(j.Steps) - 1; i >= 0; i-- {
+		step := j.Steps[i]
+		if !step.Done || step.Op == opGrowFilesystem {
+			// a grown filesystem cannot be shrunk back
+			continue
+		}
+		if err := j.revertStep(step); err != nil {
+			return fmt.Errorf("cannot revert %s: %v", step.Op, err)
+		}
+		step.Done = false
+		if err := j.save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit removes the journal of a complete layout change.
+func (j *layoutJournal) commit() error {
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove layout change journal: %v", err)
+	}
+	return nil
+}
+
+// abort reverts the layout change and removes the journal. Should reverting
+// fail, the journal is kept so that revert is attempted again.
+func (j *layoutJournal) abort() error {
+	if err := j.revert(); err != nil {
+		return err
+	}
+	return j.commit()
+}
+
+// runOrAbort runs the journal and aborts the layout change should that fail.
+func (j *layoutJournal) runOrAbort(lv *LaidOutVolume, workDir string) error {
+	err := j.run(lv, workDir)
+	if err != nil {
+		logger.Noticef("cannot change volume layout: %v", err)
+		if rerr := j.abort(); rerr != nil {
+			logger.Noticef("cannot revert volume layout change: %v", rerr)
+		}
+	}
+	return err
+}
+
+// applyLayoutChange applies the layout change to the device holding the
+// volume. A journal of the change is kept in the rollback directory. Should
+// the change be interrupted, the journal is picked up on the next attempt,
+// and the change is resumed, or reverted if it no longer applies to the
+// volume. The journal of the applied change is returned, the caller either
+// commits it once the update is complete, or aborts it to revert the layout
+// change. A nil journal is returned when the layout is unchanged.
+func applyLayoutChange(lv *LaidOutVolume, change *layoutChange, rollbackDir string) (*layoutJournal, error) {
+	journalPath := filepath.Join(rollbackDir, layoutJournalName)
+	workDir := filepath.Join(rollbackDir, "layout-work")
+	if err := os.MkdirAll(workDir, 0700); err != nil {
+		return nil, fmt.Errorf("cannot create work directory: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	j, err := readLayoutJournal(journalPath)
+	if err != nil {
+		return nil, err
+	}
+	if j != nil {
+		if err := j.matches(lv); err != nil {
+			logger.Noticef("reverting interrupted volume layout change: %v", err)
+			if err := j.abort(); err != nil {
+				return nil, fmt.Errorf("cannot revert interrupted layout change: %v", err)
+			}
+			j = nil
+		} else {
+			logger.Noticef("resuming interrupted volume layout change")
+			if err := j.runOrAbort(lv, workDir); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if change.isEmpty() {
+		return j, nil
+	}
+
+	device, err := layoutDeviceLookup()
+	if err == nil && j != nil && j.Device != device {
+		err = fmt.Errorf("interrupted layout change applies to %s", j.Device)
+	}
+	if err != nil {
+		return nil, abortOnError(j, fmt.Errorf("cannot find device of the volume: %v", err))
+	}
+	if err := checkLayoutFits(lv, device); err != nil {
+		return nil, abortOnError(j, err)
+	}
+	pt, err := ReadPartitionTable(device)
+	if err == nil && pt == nil {
+		err = fmt.Errorf("cannot find partition table of %s", device)
+	}
+	if err != nil {
+		return nil, abortOnError(j, err)
+	}
+	steps, err := planLayoutChange(lv, change, pt)
+	if err != nil {
+		return nil, abortOnError(j, err)
+	}
+	if len(steps) == 0 {
+		return j, nil
+	}
+
+	if j == nil {
+		j = &layoutJournal{Device: device, path: journalPath}
+	}
+	j.Steps = append(j.Steps, steps...)
+	if err := j.save(); err != nil {
+		return nil, abortOnError(j, err)
+	}
+	if err := j.runOrAbort(lv, workDir); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// abortOnError aborts the layout change recorded by the journal, if any,
+// and returns err.
+func abortOnError(j *layoutJournal, err error) error {
+	if j == nil {
+		return err
+	}
+	if rerr := j.abort(); rerr != nil {
+		logger.Noticef("cannot revert volume layout change: %v", rerr)
+	}
+	return err
+}
@@ -0,0 +1,589 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package gadget_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type layoutChangeTestSuite struct {
+	testutil.BaseTest
+
+	dir       string
+	device    string
+	sfdisk    *testutil.MockCmd
+	partx     *testutil.MockCmd
+	resize2fs *testutil.MockCmd
+}
+
+var _ = Suite(&layoutChangeTestSuite{})
+
+const (
+	biosBootType = "21686148-6449-6E6F-744E-656564454649"
+	linuxType    = "0FC63DAF-8483-4772-8E79-3D69D8477DE4"
+	basicType    = "EBD0A0A2-B9E5-4433-87C0-68B6B72699C7"
+)
+
+func (s *layoutChangeTestSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+
+	s.dir = c.MkDir()
+	s.device = filepath.Join(s.dir, "disk")
+	makeSizedFile(c, s.device, 16*gadget.SizeMiB, nil)
+	s.AddCleanup(gadget.MockLayoutDeviceLookup(func() (string, error) {
+		return s.device, nil
+	}))
+
+	// the partition table is dumped from table.json, appending partitions
+	// switches to table-added.json
+	s.sfdisk = testutil.MockCommand(c, "sfdisk", fmt.Sprintf(`
+if [ "$1" = "--json" ]; then
+    cat %[1]s/table.json
+    exit 0
+fi
+cat >> %[1]s/sfdisk-input
+if [ "$1" = "--append" ]; then
+    cp %[1]s/table-added.json %[1]s/table.json
+fi
+`, s.dir))
+	s.AddCleanup(s.sfdisk.Restore)
+	s.partx = testutil.MockCommand(c, "partx", "")
+	s.AddCleanup(s.partx.Restore)
+	s.resize2fs = testutil.MockCommand(c, "resize2fs", "")
+	s.AddCleanup(s.resize2fs.Restore)
+
+	s.AddCleanup(gadget.MockMkfsHandlers(map[string]gadget.MkfsFunc{
+		"vfat": func(imgFile, label, contentsRootDir string) error {
+			c.Check(filepath.Join(contentsRootDir, "extra-file"), testutil.FileEquals, "extra")
+			f, err := os.OpenFile(imgFile, os.O_RDWR, 0644)
+			c.Assert(err, IsNil)
+			defer f.Close()
+			_, err = f.WriteAt([]byte("extra-vfat"), 0)
+			return err
+		},
+	}))
+}
+
+type tableEntry struct {
+	node        string
+	start, size uint64
+	name        string
+}
+
+func (s *layoutChangeTestSuite) mockTable(c *C, fname string, entries ...tableEntry) {
+	var partitions []map[string]interface{}
+	for _, e := range entries {
+		partitions = append(partitions, map[string]interface{}{
+			"node":  e.node,
+			"start": e.start,
+			"size":  e.size,
+			"type":  linuxType,
+			"name":  e.name,
+		})
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"partitiontable": map[string]interface{}{
+			"label":      "gpt",
+			"device":     s.device,
+			"unit":       "sectors",
+			"lastlba":    20446,
+			"partitions": partitions,
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, fname), data, 0644), IsNil)
+}
+
+var (
+	firstEntry    = tableEntry{"/dev/fakedisk1", 2048, 2048, "first"}
+	writableEntry = tableEntry{"/dev/fakedisk2", 4096, 8192, "writable"}
+	grownEntry    = tableEntry{"/dev/fakedisk2", 4096, 12288, "writable"}
+	extraEntry    = tableEntry{"/dev/fakedisk3", 16384, 4096, "extra"}
+)
+
+func layoutChangeDataSet(c *C) (oldData gadget.GadgetData, newData gadget.GadgetData, rollbackDir string) {
+	first := gadget.VolumeStructure{
+		Name: "first",
+		Type: biosBootType,
+		Size: 1 * gadget.SizeMiB,
+		Content: []gadget.VolumeContent{
+			{Image: "first.img"},
+		},
+	}
+	writable := gadget.VolumeStructure{
+		Name:       "writable",
+		Role:       gadget.SystemData,
+		Type:       linuxType,
+		Filesystem: "ext4",
+		Size:       4 * gadget.SizeMiB,
+	}
+	grown := writable
+	grown.Size = 6 * gadget.SizeMiB
+	extra := gadget.VolumeStructure{
+		Name:       "extra",
+		Type:       basicType,
+		Filesystem: "vfat",
+		Size:       2 * gadget.SizeMiB,
+		Content: []gadget.VolumeContent{
+			{Source: "/extra-file", Target: "/"},
+		},
+	}
+
+	oldInfo := &gadget.Info{
+		Volumes: map[string]gadget.Volume{
+			"foo": {
+				Bootloader: "grub",
+				Schema:     gadget.GPT,
+				Structure:  []gadget.VolumeStructure{first, writable},
+			},
+		},
+	}
+	newInfo := &gadget.Info{
+		Volumes: map[string]gadget.Volume{
+			"foo": {
+				Bootloader: "grub",
+				Schema:     gadget.GPT,
+				Structure:  []gadget.VolumeStructure{first, grown, extra},
+			},
+		},
+	}
+
+	oldRootDir := c.MkDir()
+	makeSizedFile(c, filepath.Join(oldRootDir, "first.img"), gadget.SizeMiB, nil)
+	oldData = gadget.GadgetData{Info: oldInfo, RootDir: oldRootDir}
+
+	newRootDir := c.MkDir()
+	makeSizedFile(c, filepath.Join(newRootDir, "first.img"), gadget.SizeMiB, nil)
+	makeSizedFile(c, filepath.Join(newRootDir, "extra-file"), 0, []byte("extra"))
+	newData = gadget.GadgetData{Info: newInfo, RootDir: newRootDir}
+
+	rollbackDir = c.MkDir()
+	return oldData, newData, rollbackDir
+}
+
+func (s *layoutChangeTestSuite) sfdiskInput(c *C) string {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, "sfdisk-input"))
+	c.Assert(err, IsNil)
+	return string(data)
+}
+
+func (s *layoutChangeTestSuite) checkExtraWritten(c *C) {
+	data, err := ioutil.ReadFile(s.device)
+	c.Assert(err, IsNil)
+	c.Check(string(data[8*gadget.SizeMiB:8*gadget.SizeMiB+10]), Equals, "extra-vfat")
+}
+
+func (s *layoutChangeTestSuite) TestUpdateGrowAndAdd(c *C) {
+	s.mockTable(c, "table.json", firstEntry, writableEntry)
+	s.mockTable(c, "table-added.json", firstEntry, grownEntry, extraEntry)
+
+	oldData, newData, rollbackDir := layoutChangeDataSet(c)
+	err := gadget.Update(oldData, newData, rollbackDir)
+	c.Assert(err, IsNil)
+
+	c.Check(s.sfdisk.Calls(), DeepEquals, [][]string{
+		{"sfdisk", "--json", s.device},
+		{"sfdisk", "--no-reread", "--relocate", "gpt-bak-std", s.device},
+		{"sfdisk", "--no-reread", "-N", "2", s.device},
+		{"sfdisk", "--json", s.device},
+		{"sfdisk", "--append", "--no-reread", s.device},
+		{"sfdisk", "--json", s.device},
+	})
+	c.Check(s.sfdiskInput(c), Equals, `start=4096, size=12288
+unit: sectors
+
+start=16384, size=4096, type=EBD0A0A2-B9E5-4433-87C0-68B6B72699C7, name="extra"
+`)
+	c.Check(s.partx.Calls(), DeepEquals, [][]string{
+		{"partx", "--update", "--nr", "2", s.device},
+		{"partx", "--add", "--nr", "3", s.device},
+	})
+	c.Check(s.resize2fs.Calls(), DeepEquals, [][]string{
+		{"resize2fs", "/dev/fakedisk2"},
+	})
+	s.checkExtraWritten(c)
+
+	c.Check(filepath.Join(rollbackDir, "layout-journal.json"), testutil.FileAbsent)
+	c.Check(filepath.Join(rollbackDir, "layout-work"), testutil.FileAbsent)
+}
+
+func (s *layoutChangeTestSuite) TestUpdateLayoutAlreadyChanged(c *C) {
+	s.mockTable(c, "table.json", firstEntry, grownEntry, extraEntry)
+
+	oldData, newData, rollbackDir := layoutChangeDataSet(c)
+	err := gadget.Update(oldData, newData, rollbackDir)
+	c.Assert(err, IsNil)
+
+	c.Check(s.sfdisk.Calls(), DeepEquals, [][]string{
+		{"sfdisk", "--json", s.device},
+	})
+	c.Check(s.partx.Calls(), HasLen, 0)
+	c.Check(s.resize2fs.Calls(), HasLen, 0)
+}
+
+func (s *layoutChangeTestSuite) writeJournal(c *C, rollbackDir string, journal string) {
+	err := ioutil.WriteFile(filepath.Join(rollbackDir, "layout-journal.json"), []byte(journal), 0600)
+	c.Assert(err, IsNil)
+}
+
+func (s *layoutChangeTestSuite) TestUpdateResumesInterruptedChange(c *C) {
+	// the partition was grown already
+	s.mockTable(c, "table.json", firstEntry, grownEntry)
+	s.mockTable(c, "table-added.json", firstEntry, grownEntry, extraEntry)
+
+	oldData, newData, rollbackDir := layoutChangeDataSet(c)
+	s.writeJournal(c, rollbackDir, fmt.Sprintf(`{"device": %q, "steps": [
+{"op": "relocate-gpt-backup", "structure": 0, "done": true},
+{"op": "grow-partition", "structure": 1, "partition": 2, "node": "/dev/fakedisk2", "start": 4096, "size": 12288, "old-size": 8192, "done": true},
+{"op": "grow-filesystem", "structure": 1, "partition": 2, "node": "/dev/fakedisk2", "start": 4096, "done": false},
+{"op": "add-partition", "structure": 2, "start": 16384, "size": 4096, "done": false},
+{"op": "write-structure", "structure": 2, "start": 16384, "done": false}
+]}`, s.device))
+
+	err := gadget.Update(oldData, newData, rollbackDir)
+	c.Assert(err, IsNil)
+
+	c.Check(s.sfdisk.Calls(), DeepEquals, [][]string{
+		// adding the partition
+		{"sfdisk", "--json", s.device},
+		{"sfdisk", "--append", "--no-reread", s.device},
+		{"sfdisk", "--json", s.device},
+		// checking what is left to do
+		{"sfdisk", "--json", s.device},
+	})
+	c.Check(s.partx.Calls(), DeepEquals, [][]string{
+		{"partx", "--add", "--nr", "3", s.device},
+	})
+	c.Check(s.resize2fs.Calls(), DeepEquals, [][]string{
+		{"resize2fs", "/dev/fakedisk2"},
+	})
+	s.checkExtraWritten(c)
+	c.Check(filepath.Join(rollbackDir, "layout-journal.json"), testutil.FileAbsent)
+}
+
+func (s *layoutChangeTestSuite) TestUpdateRevertsStaleJournal(c *C) {
+	s.mockTable(c, "table.json", firstEntry, grownEntry, extraEntry)
+
+	oldData, newData, rollbackDir := layoutChangeDataSet(c)
+	// journal of a change to a structure that is no longer there
+	s.writeJournal(c, rollbackDir, fmt.Sprintf(`{"device": %q, "steps": [
+{"op": "add-partition", "structure": 5, "partition": 4, "node": "/dev/fakedisk4", "start": 30000, "size": 100, "done": true},
+{"op": "write-structure", "structure": 5, "start": 30000, "done": false}
+]}`, s.device))
+
+	err := gadget.Update(oldData, newData, rollbackDir)
+	c.Assert(err, IsNil)
+
+	c.Check(s.sfdisk.Calls(), DeepEquals, [][]string{
+		{"sfdisk", "--no-reread", "--delete", s.device, "4"},
+		{"sfdisk", "--json", s.device},
+	})
+	c.Check(s.partx.Calls(), DeepEquals, [][]string{
+		{"partx", "--delete", "--nr", "4", s.device},
+	})
+	c.Check(filepath.Join(rollbackDir, "layout-journal.json"), testutil.FileAbsent)
+}
+
+func (s *layoutChangeTestSuite) TestUpdateRevertsOnFailure(c *C) {
+	s.mockTable(c, "table.json", firstEntry, writableEntry)
+	s.mockTable(c, "table-added.json", firstEntry, grownEntry, extraEntry)
+	s.AddCleanup(gadget.MockMkfsHandlers(map[string]gadget.MkfsFunc{
+		"vfat": func(imgFile, label, contentsRootDir string) error {
+			return errors.New("boom")
+		},
+	}))
+
+	oldData, newData, rollbackDir := layoutChangeDataSet(c)
+	err := gadget.Update(oldData, newData, rollbackDir)
+	c.Assert(err, ErrorMatches, `cannot change volume layout: cannot write-structure: cannot create filesystem image of structure #2 \("extra"\): cannot create "vfat" filesystem: boom`)
+
+	c.Check(s.sfdisk.Calls(), DeepEquals, [][]string{
+		{"sfdisk", "--json", s.device},
+		{"sfdisk", "--no-reread", "--relocate", "gpt-bak-std", s.device},
+		{"sfdisk", "--no-reread", "-N", "2", s.device},
+		{"sfdisk", "--json", s.device},
+		{"sfdisk", "--append", "--no-reread", s.device},
+		{"sfdisk", "--json", s.device},
+		// the added partition is removed, the grown filesystem no
+		// longer fits the old partition size, so it is kept
+		{"sfdisk", "--no-reread", "--delete", s.device, "3"},
+	})
+	c.Check(s.partx.Calls(), DeepEquals, [][]string{
+		{"partx", "--update", "--nr", "2", s.device},
+		{"partx", "--add", "--nr", "3", s.device},
+		{"partx", "--delete", "--nr", "3", s.device},
+	})
+	c.Check(filepath.Join(rollbackDir, "layout-journal.json"), testutil.FileAbsent)
+}
+
+func (s *layoutChangeTestSuite) TestUpdateRevertsGrowOnFailure(c *C) {
+	s.mockTable(c, "table.json", firstEntry, writableEntry)
+	resize2fs := testutil.MockCommand(c, "resize2fs", "echo 'cannot resize'; exit 1")
+	defer resize2fs.Restore()
+
+	oldData, newData, rollbackDir := layoutChangeDataSet(c)
+	err := gadget.Update(oldData, newData, rollbackDir)
+	c.Assert(err, ErrorMatches, `cannot change volume layout: cannot grow-filesystem: cannot run resize2fs: cannot resize`)
+
+	c.Check(s.sfdisk.Calls(), DeepEquals, [][]string{
+		{"sfdisk", "--json", s.device},
+		{"sfdisk", "--no-reread", "--relocate", "gpt-bak-std", s.device},
+		{"sfdisk", "--no-reread", "-N", "2", s.device},
+		// reverted to the old size
+		{"sfdisk", "--no-reread", "-N", "2", s.device},
+	})
+	c.Check(s.sfdiskInput(c), Equals, "start=4096, size=12288\nstart=4096, size=8192\n")
+	c.Check(filepath.Join(rollbackDir, "layout-journal.json"), testutil.FileAbsent)
+}
+
+func (s *layoutChangeTestSuite) TestUpdateRevertFailureKeepsJournal(c *C) {
+	s.mockTable(c, "table.json", firstEntry, writableEntry)
+	resize2fs := testutil.MockCommand(c, "resize2fs", "echo 'cannot resize'; exit 1")
+	defer resize2fs.Restore()
+	partx := testutil.MockCommand(c, "partx", `[ "$1" = "--update" ] && [ -e `+s.dir+`/partx-once ] && { echo 'busy'; exit 1; }; touch `+s.dir+`/partx-once`)
+	defer partx.Restore()
+
+	oldData, newData, rollbackDir := layoutChangeDataSet(c)
+	err := gadget.Update(oldData, newData, rollbackDir)
+	c.Assert(err, ErrorMatches, `cannot change volume layout: cannot grow-filesystem: cannot run resize2fs: cannot resize`)
+
+	// the journal is kept so that the revert is attempted again
+	j, err := ioutil.ReadFile(filepath.Join(rollbackDir, "layout-journal.json"))
+	c.Assert(err, IsNil)
+	c.Check(string(j), testutil.Contains, `"op":"grow-partition","structure":1,"partition":2,"node":"/dev/fakedisk2","start":4096,"size":12288,"old-size":8192,"done":true`)
+}
+
+func (s *layoutChangeTestSuite) TestUpdateCommitsLayoutAfterStructureUpdates(c *C) {
+	s.mockTable(c, "table.json", firstEntry, writableEntry)
+	s.mockTable(c, "table-added.json", firstEntry, grownEntry, extraEntry)
+
+	oldData, newData, rollbackDir := layoutChangeDataSet(c)
+	newData.Info.Volumes["foo"].Structure[0].Update.Edition = 1
+	updated := false
+	s.AddCleanup(gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, psRootDir, psRollbackDir string) (gadget.Updater, error) {
+		c.Check(ps.Name, Equals, "first")
+		return &mockUpdater{
+			updateCb: func() error {
+				// the layout change is not committed yet
+				c.Check(filepath.Join(rollbackDir, "layout-journal.json"), testutil.FilePresent)
+				updated = true
+				return nil
+			},
+		}, nil
+	}))
+
+	err := gadget.Update(oldData, newData, rollbackDir)
+	c.Assert(err, IsNil)
+	c.Check(updated, Equals, true)
+	s.checkExtraWritten(c)
+	c.Check(filepath.Join(rollbackDir, "layout-journal.json"), testutil.FileAbsent)
+}
+
+func (s *layoutChangeTestSuite) TestUpdateRevertsLayoutOnStructureUpdateFailure(c *C) {
+	s.mockTable(c, "table.json", firstEntry, writableEntry)
+	s.mockTable(c, "table-added.json", firstEntry, grownEntry, extraEntry)
+
+	oldData, newData, rollbackDir := layoutChangeDataSet(c)
+	newData.Info.Volumes["foo"].Structure[0].Update.Edition = 1
+	rolledBack := false
+	s.AddCleanup(gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, psRootDir, psRollbackDir string) (gadget.Updater, error) {
+		return &mockUpdater{
+			updateCb: func() error {
+				return errors.New("boom")
+			},
+			rollbackCb: func() error {
+				rolledBack = true
+				return nil
+			},
+		}, nil
+	}))
+
+	err := gadget.Update(oldData, newData, rollbackDir)
+	c.Assert(err, ErrorMatches, `cannot update volume structure #0 \("first"\): boom`)
+	c.Check(rolledBack, Equals, true)
+
+	c.Check(s.sfdisk.Calls(), DeepEquals, [][]string{
+		{"sfdisk", "--json", s.device},
+		{"sfdisk", "--no-reread", "--relocate", "gpt-bak-std", s.device},
+		{"sfdisk", "--no-reread", "-N", "2", s.device},
+		{"sfdisk", "--json", s.device},
+		{"sfdisk", "--append", "--no-reread", s.device},
+		{"sfdisk", "--json", s.device},
+		// the added partition is removed, the grown filesystem is
+		// kept
+		{"sfdisk", "--no-reread", "--delete", s.device, "3"},
+	})
+	c.Check(s.partx.Calls(), DeepEquals, [][]string{
+		{"partx", "--update", "--nr", "2", s.device},
+		{"partx", "--add", "--nr", "3", s.device},
+		{"partx", "--delete", "--nr", "3", s.device},
+	})
+	c.Check(filepath.Join(rollbackDir, "layout-journal.json"), testutil.FileAbsent)
+}
+
+func (s *layoutChangeTestSuite) TestUpdatePartitionAlreadyLarger(c *C) {
+	// the partition was grown past the size in the gadget
+	s.mockTable(c, "table.json", firstEntry, tableEntry{"/dev/fakedisk2", 4096, 14336, "writable"})
+
+	oldData, newData, rollbackDir := layoutChangeDataSet(c)
+	vol := newData.Info.Volumes["foo"]
+	vol.Structure = vol.Structure[:2]
+	newData.Info.Volumes["foo"] = vol
+	err := gadget.Update(oldData, newData, rollbackDir)
+	c.Assert(err, IsNil)
+
+	c.Check(s.sfdisk.Calls(), DeepEquals, [][]string{
+		{"sfdisk", "--json", s.device},
+	})
+	c.Check(s.resize2fs.Calls(), HasLen, 0)
+}
+
+func (s *layoutChangeTestSuite) TestUpdateAddedStructureOverlapsPartition(c *C) {
+	s.mockTable(c, "table.json", firstEntry, tableEntry{"/dev/fakedisk2", 4096, 14336, "writable"})
+
+	oldData, newData, rollbackDir := layoutChangeDataSet(c)
+	err := gadget.Update(oldData, newData, rollbackDir)
+	c.Assert(err, ErrorMatches, `cannot change volume layout: cannot add structure #2 \("extra"\), it overlaps with partition /dev/fakedisk2`)
+	c.Check(s.partx.Calls(), HasLen, 0)
+	c.Check(filepath.Join(rollbackDir, "layout-journal.json"), testutil.FileAbsent)
+}
+
+func (s *layoutChangeTestSuite) TestUpdateUnexpectedPartition(c *C) {
+	s.mockTable(c, "table.json", firstEntry, writableEntry, tableEntry{"/dev/fakedisk3", 16384, 2048, "extra"})
+
+	oldData, newData, rollbackDir := layoutChangeDataSet(c)
+	err := gadget.Update(oldData, newData, rollbackDir)
+	c.Assert(err, ErrorMatches, `cannot change volume layout: cannot add structure #2 \("extra"\), partition /dev/fakedisk3 has unexpected size 2048`)
+	c.Check(s.partx.Calls(), HasLen, 0)
+	c.Check(filepath.Join(rollbackDir, "layout-journal.json"), testutil.FileAbsent)
+}
+
+func (s *layoutChangeTestSuite) TestUpdateDeviceTooSmall(c *C) {
+	makeSizedFile(c, s.device, 8*gadget.SizeMiB, nil)
+
+	oldData, newData, rollbackDir := layoutChangeDataSet(c)
+	err := gadget.Update(oldData, newData, rollbackDir)
+	c.Assert(err, ErrorMatches, `cannot change volume layout: device .*/disk is too small for the volume, 10502656 bytes needed, 8388608 available`)
+	c.Check(s.sfdisk.Calls(), HasLen, 0)
+}
+
+func (s *layoutChangeTestSuite) TestUpdateNoDevice(c *C) {
+	s.AddCleanup(gadget.MockLayoutDeviceLookup(func() (string, error) {
+		return "", gadget.ErrDeviceNotFound
+	}))
+
+	oldData, newData, rollbackDir := layoutChangeDataSet(c)
+	err := gadget.Update(oldData, newData, rollbackDir)
+	c.Assert(err, ErrorMatches, `cannot change volume layout: cannot find device of the volume: device not found`)
+}
+
+func (s *layoutChangeTestSuite) TestResolveLayoutChange(c *C) {
+	ps := func(name string, start, size gadget.Size, fs string) gadget.LaidOutStructure {
+		return gadget.LaidOutStructure{
+			VolumeStructure: &gadget.VolumeStructure{
+				Name:       name,
+				Type:       linuxType,
+				Size:       size,
+				Filesystem: fs,
+			},
+			StartOffset: start,
+		}
+	}
+	vol := func(structures ...gadget.LaidOutStructure) *gadget.LaidOutVolume {
+		return &gadget.LaidOutVolume{
+			Volume:           &gadget.Volume{},
+			LaidOutStructure: structures,
+		}
+	}
+	bare := ps("bare", 6*gadget.SizeMiB, gadget.SizeMiB, "")
+	bare.Type = "bare"
+	withRole := ps("role", 6*gadget.SizeMiB, gadget.SizeMiB, "")
+	withRole.Role = gadget.SystemBoot
+	withOffsetWrite := ps("offset-write", 6*gadget.SizeMiB, gadget.SizeMiB, "")
+	offs := gadget.Size(92)
+	withOffsetWrite.AbsoluteOffsetWrite = &offs
+
+	old := vol(ps("a", gadget.SizeMiB, gadget.SizeMiB, "vfat"), ps("b", 2*gadget.SizeMiB, 2*gadget.SizeMiB, "ext4"))
+
+	for idx, tc := range []struct {
+		to    *gadget.LaidOutVolume
+		grown string
+		added []string
+		err   string
+	}{{
+		to: vol(ps("a", gadget.SizeMiB, gadget.SizeMiB, "vfat"), ps("b", 2*gadget.SizeMiB, 2*gadget.SizeMiB, "ext4")),
+	}, {
+		to:    vol(ps("a", gadget.SizeMiB, gadget.SizeMiB, "vfat"), ps("b", 2*gadget.SizeMiB, 4*gadget.SizeMiB, "ext4"), ps("c", 6*gadget.SizeMiB, gadget.SizeMiB, "vfat")),
+		grown: "b",
+		added: []string{"c"},
+	}, {
+		to:  vol(ps("a", gadget.SizeMiB, gadget.SizeMiB, "vfat")),
+		err: "cannot change the number of structures within volume from 2 to 1",
+	}, {
+		to:  vol(ps("a", gadget.SizeMiB, 2*gadget.SizeMiB, "vfat"), ps("b", 3*gadget.SizeMiB, 2*gadget.SizeMiB, "ext4")),
+		err: `cannot change structure #0 \("a"\) size from 1048576 to 2097152`,
+	}, {
+		to:  vol(ps("a", gadget.SizeMiB, gadget.SizeMiB, "vfat"), ps("b", 2*gadget.SizeMiB, gadget.SizeMiB, "ext4")),
+		err: `cannot change structure #0 \("b"\) size from 2097152 to 1048576`,
+	}, {
+		to:  vol(ps("a", gadget.SizeMiB, gadget.SizeMiB, "vfat"), ps("b", 3*gadget.SizeMiB, 2*gadget.SizeMiB, "ext4")),
+		err: `cannot change structure #0 \("b"\) start offset from 2097152 to 3145728`,
+	}, {
+		to:  vol(ps("a", gadget.SizeMiB, gadget.SizeMiB, "vfat"), ps("b", 2*gadget.SizeMiB, 4*gadget.SizeMiB, "vfat")),
+		err: `cannot grow structure #0 \("b"\) with "vfat" filesystem`,
+	}, {
+		to:  vol(ps("a", gadget.SizeMiB, gadget.SizeMiB, "vfat"), ps("b", 2*gadget.SizeMiB, 2*gadget.SizeMiB, "ext4"), bare),
+		err: `cannot add structure #0 \("bare"\) without a partition table entry`,
+	}, {
+		to:  vol(ps("a", gadget.SizeMiB, gadget.SizeMiB, "vfat"), ps("b", 2*gadget.SizeMiB, 2*gadget.SizeMiB, "ext4"), withRole),
+		err: `cannot add structure #0 \("role"\) with role "system-boot"`,
+	}, {
+		to:  vol(ps("a", gadget.SizeMiB, gadget.SizeMiB, "vfat"), ps("b", 2*gadget.SizeMiB, 2*gadget.SizeMiB, "ext4"), withOffsetWrite),
+		err: `cannot add structure #0 \("offset-write"\) with offset-write`,
+	}} {
+		c.Logf("tc: %v", idx)
+		grown, added, err := gadget.ResolveLayoutChange(old, tc.to)
+		if tc.err != "" {
+			c.Check(err, ErrorMatches, tc.err)
+			continue
+		}
+		c.Assert(err, IsNil)
+		if tc.grown == "" {
+			c.Check(grown, IsNil)
+		} else {
+			c.Assert(grown, NotNil)
+			c.Check(grown.Name, Equals, tc.grown)
+		}
+		var addedNames []string
+		for _, ps := range added {
+			addedNames = append(addedNames, ps.Name)
+		}
+		c.Check(addedNames, DeepEquals, tc.added)
+	}
+}
@@ -30,6 +30,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/snapcore/snapd/bootloader"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/strutil"
@@ -262,6 +263,8 @@ type MountedFilesystemUpdater struct {
 	*MountedFilesystemWriter
 	backupDir   string
 	mountLookup mountLookupFunc
+	// staged lists boot assets written for a trial boot
+	staged []string
 }
 
 // NewMountedFilesystemUpdater returns an updater for given filesystem
@@ -342,7 +345,7 @@ func (f *MountedFilesystemUpdater) Update() error {
 		}
 	}
 
-	return nil
+	return f.stageRemainingBootAssets(mount)
 }
 
 func (f *MountedFilesystemUpdater) sourceDirectoryEntries(source string) ([]os.FileInfo, error) {
@@ -429,11 +432,79 @@ func (f *MountedFilesystemUpdater) updateOrSkipFile(dstRoot, source, target stri
 			// as there is no backup
 			return fmt.Errorf("missing backup file %q for %v", backupPath+".backup", target)
 		}
+		if asset, ok := f.bootAsset(dstRoot, dstPath); ok {
+			// keep the current boot asset in place, the update is
+			// booted in trial mode first
+			if err := writeFileOrSymlink(srcPath, filepath.Join(dstRoot, bootloader.TrialBootAssetPath(asset)), nil); err != nil {
+				return fmt.Errorf("cannot stage boot asset: %v", err)
+			}
+			f.staged = append(f.staged, asset)
+			return nil
+		}
 	}
 
 	return writeFileOrSymlink(srcPath, dstPath, preserveInDst)
 }
 
+// bootAsset returns the path of the destination file relative to the
+// filesystem root, and whether the file is a boot asset that is updated using
+// a trial boot.
+func (f *MountedFilesystemUpdater) bootAsset(dstRoot, dstPath string) (string, bool) {
+	for _, asset := range f.ps.Update.BootAssets {
+		if filepath.Join(dstRoot, asset) == dstPath {
+			return filepath.Clean(strings.TrimPrefix(asset, "/")), true
+		}
+	}
+	return "", false
+}
+
+// stageRemainingBootAssets copies the current versions of the boot assets
+// that were not updated next to the staged ones, as boot assets load each
+// other from the directory they run from. The staged assets are then listed
+// in the order of the structure declaration.
+func (f *MountedFilesystemUpdater) stageRemainingBootAssets(dstRoot string) error {
+	if len(f.staged) == 0 {
+		return nil
+	}
+	var staged []string
+	for _, asset := range f.ps.Update.BootAssets {
+		asset = filepath.Clean(strings.TrimPrefix(asset, "/"))
+		if !strutil.ListContains(f.staged, asset) {
+			current := filepath.Join(dstRoot, asset)
+			if !osutil.FileExists(current) {
+				continue
+			}
+			if err := writeFileOrSymlink(current, filepath.Join(dstRoot, bootloader.TrialBootAssetPath(asset)), nil); err != nil {
+				return fmt.Errorf("cannot stage boot asset: %v", err)
+			}
+		}
+		staged = append(staged, asset)
+	}
+	f.staged = staged
+	return nil
+}
+
+// removeStagedBootAssets removes all boot assets staged for a trial boot.
+func (f *MountedFilesystemUpdater) removeStagedBootAssets(dstRoot string) error {
+	for _, asset := range f.ps.Update.BootAssets {
+		staged := filepath.Join(dstRoot, bootloader.TrialBootAssetPath(asset))
+		if err := os.Remove(staged); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot remove staged boot asset: %v", err)
+		}
+		if err := os.Remove(filepath.Dir(staged)); err != nil && !os.IsNotExist(err) {
+			logger.Noticef("cannot remove trial boot directory %q: %v", filepath.Dir(staged), err)
+		}
+	}
+	f.staged = nil
+	return nil
+}
+
+// stagedBootAssets returns the boot assets staged for a trial boot during
+// Update(), the first one is booted first.
+func (f *MountedFilesystemUpdater) stagedBootAssets() []string {
+	return f.staged
+}
+
 func (f *MountedFilesystemUpdater) updateVolumeContent(volumeRoot string, content *VolumeContent, preserveInDst []string, backupDir string) error {
 	if err := checkContent(content); err != nil {
 		return err
@@ -703,7 +774,7 @@ func (f *MountedFilesystemUpdater) Rollback() error {
 		}
 	}
 
-	return nil
+	return f.removeStagedBootAssets(mount)
 }
 
 func (f *MountedFilesystemUpdater) rollbackPrefix(dstRoot, target string, backupDir string) error {
@@ -766,6 +837,12 @@ func (f *MountedFilesystemUpdater) rollbackFile(dstRoot, source, target string,
 		return nil
 	}
 
+	if _, ok := f.bootAsset(dstRoot, dstPath); ok && osutil.FileExists(backupName) {
+		// the original boot asset was kept, the staged one is removed
+		// with the others
+		return nil
+	}
+
 	if osutil.FileExists(backupName) {
 		// restore backup -> destination
 		return writeFileOrSymlink(backupName, dstPath, nil)
@@ -2425,3 +2425,126 @@ func (s *mountedfilesystemTestSuite) TestMountedUpdaterNonFilePreserveError(c *C
 	err = rw.Rollback()
 	c.Check(err, ErrorMatches, `cannot map preserve entries for mount location ".*/out-dir": preserved entry "foo" cannot be a directory`)
 }
+
+func (s *mountedfilesystemTestSuite) TestMountedUpdaterBootAssetsTrial(c *C) {
+	// some data for the gadget
+	gd := []gadgetData{
+		{name: "grubx64.efi", target: "EFI/boot/grubx64.efi", content: "new grub"},
+		{name: "shim.efi", target: "EFI/boot/bootx64.efi", content: "shim"},
+		{name: "mmx64.efi", target: "EFI/boot/mmx64.efi", content: "new mm"},
+		{name: "grub.cfg", target: "EFI/ubuntu/grub.cfg", content: "new config"},
+	}
+	makeGadgetData(c, s.dir, gd)
+
+	outDir := filepath.Join(c.MkDir(), "out-dir")
+	makeExistingData(c, outDir, []gadgetData{
+		{target: "EFI/boot/grubx64.efi", content: "old grub"},
+		// same as the update
+		{target: "EFI/boot/bootx64.efi", content: "shim"},
+		{target: "EFI/ubuntu/grub.cfg", content: "old config"},
+	})
+
+	ps := &gadget.LaidOutStructure{
+		VolumeStructure: &gadget.VolumeStructure{
+			Size:       2048,
+			Filesystem: "vfat",
+			Content: []gadget.VolumeContent{
+				{Source: "grubx64.efi", Target: "EFI/boot/grubx64.efi"},
+				{Source: "shim.efi", Target: "EFI/boot/bootx64.efi"},
+				{Source: "mmx64.efi", Target: "EFI/boot/mmx64.efi"},
+				{Source: "grub.cfg", Target: "EFI/ubuntu/grub.cfg"},
+			},
+			Update: gadget.VolumeUpdate{
+				Edition: 1,
+				BootAssets: []string{
+					"EFI/boot/grubx64.efi",
+					"/EFI/boot/bootx64.efi",
+					// not present before the update
+					"EFI/boot/mmx64.efi",
+				},
+			},
+		},
+	}
+
+	rw, err := gadget.NewMountedFilesystemUpdater(s.dir, ps, s.backup, func(to *gadget.LaidOutStructure) (string, error) {
+		return outDir, nil
+	})
+	c.Assert(err, IsNil)
+
+	err = rw.Backup()
+	c.Assert(err, IsNil)
+	err = rw.Update()
+	c.Assert(err, IsNil)
+
+	// the current boot asset is kept, the new one is staged in the trial
+	// boot directory, together with the other boot assets
+	verifyWrittenGadgetData(c, outDir, []gadgetData{
+		{target: "EFI/boot/grubx64.efi", content: "old grub"},
+		{target: "EFI/boot/try/grubx64.efi", content: "new grub"},
+		{target: "EFI/boot/bootx64.efi", content: "shim"},
+		{target: "EFI/boot/try/bootx64.efi", content: "shim"},
+		{target: "EFI/boot/mmx64.efi", content: "new mm"},
+		{target: "EFI/boot/try/mmx64.efi", content: "new mm"},
+		{target: "EFI/ubuntu/grub.cfg", content: "new config"},
+	})
+	c.Check(gadget.StagedBootAssets(rw), DeepEquals, []string{
+		"EFI/boot/grubx64.efi",
+		"EFI/boot/bootx64.efi",
+		"EFI/boot/mmx64.efi",
+	})
+
+	err = rw.Rollback()
+	c.Assert(err, IsNil)
+	verifyWrittenGadgetData(c, outDir, []gadgetData{
+		{target: "EFI/boot/grubx64.efi", content: "old grub"},
+		{target: "EFI/boot/bootx64.efi", content: "shim"},
+		{target: "EFI/ubuntu/grub.cfg", content: "old config"},
+	})
+	c.Check(filepath.Join(outDir, "EFI/boot/try"), testutil.FileAbsent)
+	c.Check(filepath.Join(outDir, "EFI/boot/mmx64.efi"), testutil.FileAbsent)
+	c.Check(gadget.StagedBootAssets(rw), HasLen, 0)
+}
+
+func (s *mountedfilesystemTestSuite) TestMountedUpdaterBootAssetsUnchanged(c *C) {
+	gd := []gadgetData{
+		{name: "grubx64.efi", target: "EFI/boot/grubx64.efi", content: "grub"},
+		{name: "grub.cfg", target: "EFI/ubuntu/grub.cfg", content: "new config"},
+	}
+	makeGadgetData(c, s.dir, gd)
+
+	outDir := filepath.Join(c.MkDir(), "out-dir")
+	makeExistingData(c, outDir, []gadgetData{
+		{target: "EFI/boot/grubx64.efi", content: "grub"},
+		{target: "EFI/ubuntu/grub.cfg", content: "old config"},
+	})
+
+	ps := &gadget.LaidOutStructure{
+		VolumeStructure: &gadget.VolumeStructure{
+			Size:       2048,
+			Filesystem: "vfat",
+			Content: []gadget.VolumeContent{
+				{Source: "grubx64.efi", Target: "EFI/boot/grubx64.efi"},
+				{Source: "grub.cfg", Target: "EFI/ubuntu/grub.cfg"},
+			},
+			Update: gadget.VolumeUpdate{
+				Edition:    1,
+				BootAssets: []string{"EFI/boot/grubx64.efi"},
+			},
+		},
+	}
+
+	rw, err := gadget.NewMountedFilesystemUpdater(s.dir, ps, s.backup, func(to *gadget.LaidOutStructure) (string, error) {
+		return outDir, nil
+	})
+	c.Assert(err, IsNil)
+
+	err = rw.Backup()
+	c.Assert(err, IsNil)
+	err = rw.Update()
+	c.Assert(err, IsNil)
+
+	// no trial boot is needed
+	c.Check(filepath.Join(outDir, "EFI/boot/try"), testutil.FileAbsent)
+	c.Check(gadget.StagedBootAssets(rw), HasLen, 0)
+	c.Check(filepath.Join(outDir, "EFI/ubuntu/grub.cfg"), testutil.FileEquals, "new config")
+}
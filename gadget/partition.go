@@ -20,8 +20,11 @@ package gadget
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 
 	"github.com/snapcore/snapd/logger"
@@ -54,10 +57,6 @@ func Partition(image string, pv *LaidOutVolume) error {
 		return fmt.Errorf("cannot use sector size %v", pv.SectorSize)
 	}
 
-	asSector := func(v Size) Size {
-		return v / pv.SectorSize
-	}
-
 	script := &bytes.Buffer{}
 	// only sector unit is supported
 	fmt.Fprintf(script, "unit: sectors\n")
@@ -73,7 +72,35 @@ func Partition(image string, pv *LaidOutVolume) error {
 	}
 	fmt.Fprintf(script, "\n")
 
-	for _, ps := range pv.LaidOutStructure {
+	writePartitionEntries(script, pv, pv.LaidOutStructure)
+	return runSfdisk(image, script.String())
+}
+
+// AddPartitions appends partition entries for the given structures of the
+// volume to the partition table that already exists on the image or device.
+func AddPartitions(image string, pv *LaidOutVolume, structures []LaidOutStructure) error {
+	if image == "" {
+		return fmt.Errorf("internal error: image path is unset")
+	}
+	if pv.SectorSize != 512 {
+		// check for unsupported sector size
+		return fmt.Errorf("cannot use sector size %v", pv.SectorSize)
+	}
+
+	script := &bytes.Buffer{}
+	// only sector unit is supported
+	fmt.Fprintf(script, "unit: sectors\n\n")
+
+	writePartitionEntries(script, pv, structures)
+	return runSfdisk(image, script.String(), "--append")
+}
+
+func writePartitionEntries(script *bytes.Buffer, pv *LaidOutVolume, structures []LaidOutStructure) {
+	asSector := func(v Size) Size {
+		return v / pv.SectorSize
+	}
+
+	for _, ps := range structures {
 		if ps.Type == "bare" || ps.Type == "mbr" {
 			continue
 		}
@@ -100,11 +127,77 @@ func Partition(image string, pv *LaidOutVolume) error {
 
 		fmt.Fprintf(script, "\n")
 	}
-	return runSfdisk(image, script.String())
 }
 
-func runSfdisk(image string, script string) error {
-	cmd := exec.Command("sfdisk", image)
+// PartitionTable describes the partition table of a device, as reported by
+// sfdisk.
+type PartitionTable struct {
+	// Label is the type of the partition table, either "gpt" or "dos"
+	Label string `json:"label"`
+	ID    string `json:"id"`
+	// Device is the path of the device or image
+	Device string `json:"device"`
+	// Unit of start and size of partitions, always "sectors"
+	Unit string `json:"unit"`
+	// LastLBA is the last sector usable by partitions of a GPT
+	LastLBA    uint64                `json:"lastlba"`
+	Partitions []PartitionTableEntry `json:"partitions"`
+}
+
+// PartitionTableEntry describes a single partition of a device.
+type PartitionTableEntry struct {
+	// Node is the device node of the partition
+	Node  string `json:"node"`
+	Start uint64 `json:"start"`
+	Size  uint64 `json:"size"`
+	Type  string `json:"type"`
+	UUID  string `json:"uuid"`
+	Name  string `json:"name"`
+}
+
+// Number returns the number of the partition, as derived from its device
+// node.
+func (p *PartitionTableEntry) Number() (int, error) {
+	idx := strings.LastIndexFunc(p.Node, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	n, err := strconv.Atoi(p.Node[idx+1:])
+	if err != nil {
+		return 0, fmt.Errorf("cannot determine number of partition %q", p.Node)
+	}
+	return n, nil
+}
+
+// sfdiskDeviceDump is the output of sfdisk --json.
+type sfdiskDeviceDump struct {
+	PartitionTable *PartitionTable `json:"partitiontable"`
+}
+
+// ReadPartitionTable returns the partition table of the given device or
+// image, or nil if there is none.
+func ReadPartitionTable(device string) (*PartitionTable, error) {
+	cmd := exec.Command("sfdisk", "--json", device)
+	// errors are matched below, make sure they are not localized
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(output), "does not contain a recognized partition table") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot read partition table of %s: %v", device, osutil.OutputErr(output, err))
+	}
+	var dump sfdiskDeviceDump
+	if err := json.Unmarshal(output, &dump); err != nil {
+		return nil, fmt.Errorf("cannot parse partition table of %s: %v", device, err)
+	}
+	if dump.PartitionTable != nil && dump.PartitionTable.Unit != "sectors" {
+		return nil, fmt.Errorf("cannot use partition table of %s with unit %q", device, dump.PartitionTable.Unit)
+	}
+	return dump.PartitionTable, nil
+}
+
+func runSfdisk(image string, script string, extraArgs ...string) error {
+	cmd := exec.Command("sfdisk", append(extraArgs, image)...)
 	cmd.Stdin = bytes.NewBufferString(script)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
@@ -271,3 +271,52 @@ func (s *partitionSuite) TestCommandError(c *C) {
 	c.Assert(err, ErrorMatches, "cannot partition image using sfdisk: failed")
 	c.Assert(s.sfdisk.Calls(), HasLen, 0)
 }
+
+func (s *partitionSuite) TestAddPartitionsHappy(c *C) {
+	pv := &gadget.LaidOutVolume{
+		Volume: &gadget.Volume{
+			Schema: "gpt",
+			ID:     "123-123",
+		},
+		Size:       17 * gadget.SizeMiB,
+		SectorSize: 512,
+	}
+	structures := []gadget.LaidOutStructure{
+		{
+			VolumeStructure: &gadget.VolumeStructure{
+				Size: 12 * gadget.SizeMiB,
+				Name: "bar",
+				Type: "21686148-6449-6E6F-744E-656564454650",
+				Role: "system-data",
+			},
+			StartOffset: 5 * gadget.SizeMiB,
+			Index:       2,
+		},
+	}
+	err := gadget.AddPartitions("foo", pv, structures)
+	c.Assert(err, IsNil)
+	// the existing partition table is kept
+	c.Assert(s.input(c), Equals, `unit: sectors
+
+start=10240, size=24576, type=21686148-6449-6E6F-744E-656564454650, name="bar"
+`)
+	c.Assert(s.sfdisk.Calls(), DeepEquals, [][]string{
+		{"sfdisk", "--append", "foo"},
+	})
+}
+
+func (s *partitionSuite) TestAddPartitionsErrors(c *C) {
+	pv := &gadget.LaidOutVolume{
+		Volume:     &gadget.Volume{},
+		Size:       3 * gadget.SizeMiB,
+		SectorSize: 512,
+	}
+
+	err := gadget.AddPartitions("", pv, nil)
+	c.Assert(err, ErrorMatches, "internal error: image path is unset")
+
+	pv.SectorSize = 384
+	err = gadget.AddPartitions("foo", pv, nil)
+	c.Assert(err, ErrorMatches, "cannot use sector size 384")
+	c.Assert(s.sfdisk.Calls(), HasLen, 0)
+}
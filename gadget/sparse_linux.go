@@ -0,0 +1,46 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package gadget
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/snapcore/snapd/logger"
+)
+
+const (
+	fallocFlKeepSize  = 0x01
+	fallocFlPunchHole = 0x02
+)
+
+// punchHole deallocates size bytes of the regular file f starting at offset,
+// so that they read back as zeros. It returns false if f is not a regular
+// file or its filesystem does not support deallocating.
+func punchHole(f *os.File, offset, size Size) bool {
+	st, err := f.Stat()
+	if err != nil || !st.Mode().IsRegular() {
+		return false
+	}
+	if err := syscall.Fallocate(int(f.Fd()), fallocFlKeepSize|fallocFlPunchHole, int64(offset), int64(size)); err != nil {
+		logger.Debugf("cannot deallocate %v bytes at offset %v of %s: %v", size, offset, f.Name(), err)
+		return false
+	}
+	return true
+}
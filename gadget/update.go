@@ -21,8 +21,14 @@ package gadget
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/snapcore/snapd/bootloader"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
 )
 
 var (
@@ -56,6 +62,13 @@ type GadgetData struct {
 // Data that would be modified during the update is first backed up inside the
 // rollback directory. Should the apply step fail, the modified data is
 // recovered.
+//
+// The layout of the volume may change in a limited way, by growing the last
+// structure or appending new structures in the free space at the end of the
+// device. Such changes are applied first, with a journal kept in the rollback
+// directory, so that an interrupted change is resumed, or reverted, when the
+// update is attempted again. The layout change is reverted too should
+// updating the structures fail.
 func Update(old, new GadgetData, rollbackDirPath string) error {
 	// TODO: support multi-volume gadgets. But for now we simply
 	//       do not do any gadget updates on those. We cannot error
@@ -87,24 +100,65 @@ func Update(old, new GadgetData, rollbackDirPath string) error {
 		return fmt.Errorf("cannot apply update to volume: %v", err)
 	}
 
+	change, err := resolveLayoutChange(pOld, pNew)
+	if err != nil {
+		return fmt.Errorf("cannot apply update to volume: %v", err)
+	}
+
 	// now we know which structure is which, find which ones need an update
 	updates, err := resolveUpdate(pOld, pNew)
 	if err != nil {
 		return err
 	}
-	if len(updates) == 0 {
+	if len(updates) == 0 && change.isEmpty() {
 		// nothing to update
 		return ErrNoUpdate
 	}
 
 	// can update old layout to new layout
 	for _, update := range updates {
-		if err := canUpdateStructure(update.from, update.to); err != nil {
+		from := update.from
+		if change.grown != nil && change.grown.Index == update.to.Index {
+			// the size has been checked already
+			from = resized(from, update.to.Size)
+		}
+		if err := canUpdateStructure(from, update.to); err != nil {
 			return fmt.Errorf("cannot update volume structure %v: %v", update.to, err)
 		}
+		if len(update.to.Update.BootAssets) != 0 && !update.to.IsBare() {
+			if err := checkTrialBootSupport(pNew); err != nil {
+				return fmt.Errorf("cannot update volume structure %v: %v", update.to, err)
+			}
+		}
+	}
+
+	journal, err := applyLayoutChange(pNew, change, rollbackDirPath)
+	if err != nil {
+		return fmt.Errorf("cannot change volume layout: %v", err)
+	}
+	if len(updates) != 0 {
+		err = applyUpdates(new, updates, rollbackDirPath)
+	}
+	if journal == nil {
+		return err
+	}
+	if err != nil {
+		// the structures were rolled back, so is the layout
+		if rerr := journal.abort(); rerr != nil {
+			logger.Noticef("cannot revert volume layout change: %v", rerr)
+		}
+		return err
 	}
+	return journal.commit()
+}
 
-	return applyUpdates(new, updates, rollbackDirPath)
+// resized returns a copy of the structure with the given size.
+func resized(ps *LaidOutStructure, size Size) *LaidOutStructure {
+	vs := *ps.VolumeStructure
+	vs.Size = size
+	resized := *ps
+	resized.VolumeStructure = &vs
+	return &resized
 }
 
 func resolveVolume(old *Info, new *Info) (oldVol, newVol *Volume, err error) {
@@ -207,7 +261,8 @@ func canUpdateVolume(from *LaidOutVolume, to *LaidOutVolume) error {
 	if from.EffectiveSchema() != to.EffectiveSchema() {
 		return fmt.Errorf("cannot change volume schema from %q to %q", from.EffectiveSchema(), to.EffectiveSchema())
 	}
-	if len(from.LaidOutStructure) != len(to.LaidOutStructure) {
+	// structures can only be appended
+	if len(from.LaidOutStructure) > len(to.LaidOutStructure) {
 		return fmt.Errorf("cannot change the number of structures within volume from %v to %v", len(from.LaidOutStructure), len(to.LaidOutStructure))
 	}
 	return nil
@@ -219,8 +274,8 @@ type updatePair struct {
 }
 
 func resolveUpdate(oldVol *LaidOutVolume, newVol *LaidOutVolume) (updates []updatePair, err error) {
-	if len(oldVol.LaidOutStructure) != len(newVol.LaidOutStructure) {
-		return nil, errors.New("internal error: the number of structures in new and old volume definitions is different")
+	if len(oldVol.LaidOutStructure) > len(newVol.LaidOutStructure) {
+		return nil, errors.New("internal error: the new volume definition has fewer structures than the old one")
 	}
 	for j, oldStruct := range oldVol.LaidOutStructure {
 		newStruct := newVol.LaidOutStructure[j]
@@ -276,7 +331,12 @@ func applyUpdates(new GadgetData, updates []updatePair, rollbackDir string) erro
 	}
 
 	if updateErr == nil {
-		// all good, updates applied successfully
+		// updates applied successfully, new boot assets are booted in
+		// trial mode first
+		updateErr = tryStagedBootAssets(updaters)
+	}
+	if updateErr == nil {
+		// all good
 		return nil
 	}
 
@@ -293,6 +353,96 @@ func applyUpdates(new GadgetData, updates []updatePair, rollbackDir string) erro
 	return updateErr
 }
 
+type bootAssetsStager interface {
+	stagedBootAssets() []string
+}
+
+// tryStagedBootAssets schedules a trial boot of boot assets staged by the
+// updaters.
+func tryStagedBootAssets(updaters []Updater) error {
+	var assets []string
+	for _, one := range updaters {
+		if stager, ok := one.(bootAssetsStager); ok {
+			assets = append(assets, stager.stagedBootAssets()...)
+		}
+	}
+	if len(assets) == 0 {
+		return nil
+	}
+
+	bl, err := bootloader.Find("", nil)
+	if err != nil {
+		return fmt.Errorf("cannot schedule a trial boot of boot assets: %v", err)
+	}
+	tbl, ok := bl.(bootloader.TrialBootAssetsBootloader)
+	if !ok {
+		return fmt.Errorf("cannot schedule a trial boot of boot assets: not supported by bootloader %q", bl.Name())
+	}
+	if err := tbl.TryBootAssets(assets); err != nil {
+		return fmt.Errorf("cannot schedule a trial boot of boot assets: %v", err)
+	}
+	return nil
+}
+
+// grubTrialBootMarker is the line looked for in the grub configuration of
+// gadgets declaring boot assets, it is run by the snippet implementing the
+// grub side of trial boot of boot assets, see data/grub/snap-boot-assets.cfg,
+// and carries the version of the protocol.
+const grubTrialBootMarker = "set snap_boot_assets_protocol=1"
+
+// checkTrialBootSupport checks that the grub configuration shipped with the
+// gadget, in any of the structures of the volume, handles a trial boot of
+// boot assets.
+func checkTrialBootSupport(lv *LaidOutVolume) error {
+	supported := false
+	checkConfig := func(path string) error {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.TrimSpace(line) == grubTrialBootMarker {
+				supported = true
+				break
+			}
+		}
+		return nil
+	}
+	for _, ps := range lv.LaidOutStructure {
+		for _, c := range ps.Content {
+			if c.Source == "" {
+				continue
+			}
+			src := filepath.Join(lv.RootDir, c.Source)
+			if !strings.HasSuffix(c.Source, "/") && !osutil.IsDirectory(src) {
+				target := c.Target
+				if strings.HasSuffix(target, "/") {
+					target = c.Source
+				}
+				if filepath.Base(target) == "grub.cfg" {
+					if err := checkConfig(src); err != nil {
+						return fmt.Errorf("cannot read grub configuration: %v", err)
+					}
+				}
+				continue
+			}
+			err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() || info.Name() != "grub.cfg" {
+					return err
+				}
+				return checkConfig(path)
+			})
+			if err != nil {
+				return fmt.Errorf("cannot read grub configuration: %v", err)
+			}
+		}
+	}
+	if !supported {
+		return fmt.Errorf("grub configuration of the gadget does not support trial boot of boot assets")
+	}
+	return nil
+}
+
 var updaterForStructure = updaterForStructureImpl
 
 func updaterForStructureImpl(ps *LaidOutStructure, newRootDir, rollbackDir string) (Updater, error) {
@@ -26,6 +26,8 @@ import (
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/bootloader"
+	"github.com/snapcore/snapd/bootloader/bootloadertest"
 	"github.com/snapcore/snapd/gadget"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/testutil"
@@ -843,7 +845,7 @@ func (u *updateTestSuite) TestUpdateApplyErrorIllegalVolumeUpdate(c *C) {
 			"foo": {
 				Bootloader: "grub",
 				Schema:     gadget.GPT,
-				Structure:  []gadget.VolumeStructure{bareStruct},
+				Structure:  []gadget.VolumeStructure{bareStruct, bareStructUpdate},
 			},
 		},
 	}
@@ -852,8 +854,8 @@ func (u *updateTestSuite) TestUpdateApplyErrorIllegalVolumeUpdate(c *C) {
 			"foo": {
 				Bootloader: "grub",
 				Schema:     gadget.GPT,
-				// more structures than old
-				Structure: []gadget.VolumeStructure{bareStruct, bareStructUpdate},
+				// fewer structures than old
+				Structure: []gadget.VolumeStructure{bareStruct},
 			},
 		},
 	}
@@ -870,7 +872,7 @@ func (u *updateTestSuite) TestUpdateApplyErrorIllegalVolumeUpdate(c *C) {
 	makeSizedFile(c, filepath.Join(newRootDir, "first.img"), 900*gadget.SizeKiB, nil)
 
 	err := gadget.Update(oldData, newData, rollbackDir)
-	c.Assert(err, ErrorMatches, `cannot apply update to volume: cannot change the number of structures within volume from 1 to 2`)
+	c.Assert(err, ErrorMatches, `cannot apply update to volume: cannot change the number of structures within volume from 2 to 1`)
 }
 
 func (u *updateTestSuite) TestUpdateApplyErrorIllegalStructureUpdate(c *C) {
@@ -1262,3 +1264,151 @@ func (u *updateTestSuite) TestUpdaterMultiVolumesDoesNotError(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(strings.Count(logbuf.String(), "WARNING: gadget assests cannot be updated yet when multiple volumes are used"), Equals, 2)
 }
+
+func (u *updateTestSuite) setupBootAssetsUpdate(c *C) (oldData, newData gadget.GadgetData, rollbackDir, mountDir string) {
+	fsStruct := gadget.VolumeStructure{
+		Name:       "EFI System",
+		Type:       "EF,C12A7328-F81F-11D2-BA4B-00A0C93EC93B",
+		Role:       gadget.SystemBoot,
+		Size:       10 * gadget.SizeMiB,
+		Filesystem: "vfat",
+		Content: []gadget.VolumeContent{
+			{Source: "grubx64.efi", Target: "EFI/boot/grubx64.efi"},
+			{Source: "grub.cfg", Target: "EFI/ubuntu/grub.cfg"},
+		},
+		Update: gadget.VolumeUpdate{
+			BootAssets: []string{"EFI/boot/grubx64.efi"},
+		},
+	}
+	fsStructUpdate := fsStruct
+	fsStructUpdate.Update.Edition = 1
+
+	oldInfo := &gadget.Info{
+		Volumes: map[string]gadget.Volume{
+			"foo": {
+				Bootloader: "grub",
+				Schema:     gadget.GPT,
+				Structure:  []gadget.VolumeStructure{fsStruct},
+			},
+		},
+	}
+	newInfo := &gadget.Info{
+		Volumes: map[string]gadget.Volume{
+			"foo": {
+				Bootloader: "grub",
+				Schema:     gadget.GPT,
+				Structure:  []gadget.VolumeStructure{fsStructUpdate},
+			},
+		},
+	}
+
+	oldRootDir := c.MkDir()
+	oldData = gadget.GadgetData{Info: oldInfo, RootDir: oldRootDir}
+	newRootDir := c.MkDir()
+	makeGadgetData(c, newRootDir, []gadgetData{
+		{name: "grubx64.efi", content: "new grub"},
+		{name: "grub.cfg", content: "new config\n    set snap_boot_assets_protocol=1\n"},
+	})
+	newData = gadget.GadgetData{Info: newInfo, RootDir: newRootDir}
+
+	mountDir = c.MkDir()
+	makeExistingData(c, mountDir, []gadgetData{
+		{target: "EFI/boot/grubx64.efi", content: "old grub"},
+		{target: "EFI/ubuntu/grub.cfg", content: "old config"},
+	})
+
+	return oldData, newData, c.MkDir(), mountDir
+}
+
+func (u *updateTestSuite) TestUpdateBootAssetsTrial(c *C) {
+	oldData, newData, rollbackDir, mountDir := u.setupBootAssetsUpdate(c)
+
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, rootDir, rollbackDir string) (gadget.Updater, error) {
+		return gadget.NewMountedFilesystemUpdater(rootDir, ps, rollbackDir, func(*gadget.LaidOutStructure) (string, error) {
+			return mountDir, nil
+		})
+	})
+	defer restore()
+
+	bl := bootloadertest.Mock("grub", c.MkDir()).WithTrialBootAssets()
+	bootloader.Force(bl)
+	defer bootloader.Force(nil)
+
+	err := gadget.Update(oldData, newData, rollbackDir)
+	c.Assert(err, IsNil)
+	c.Check(bl.TryBootAssetsCalls, DeepEquals, [][]string{{"EFI/boot/grubx64.efi"}})
+	verifyWrittenGadgetData(c, mountDir, []gadgetData{
+		{target: "EFI/boot/grubx64.efi", content: "old grub"},
+		{target: "EFI/boot/try/grubx64.efi", content: "new grub"},
+		{target: "EFI/ubuntu/grub.cfg", content: "new config\n    set snap_boot_assets_protocol=1\n"},
+	})
+}
+
+func (u *updateTestSuite) TestUpdateBootAssetsTrialErrorRollsBack(c *C) {
+	oldData, newData, rollbackDir, mountDir := u.setupBootAssetsUpdate(c)
+
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, rootDir, rollbackDir string) (gadget.Updater, error) {
+		return gadget.NewMountedFilesystemUpdater(rootDir, ps, rollbackDir, func(*gadget.LaidOutStructure) (string, error) {
+			return mountDir, nil
+		})
+	})
+	defer restore()
+
+	bl := bootloadertest.Mock("grub", c.MkDir()).WithTrialBootAssets()
+	bl.TryBootAssetsErr = errors.New("trial in progress")
+	bootloader.Force(bl)
+	defer bootloader.Force(nil)
+
+	err := gadget.Update(oldData, newData, rollbackDir)
+	c.Assert(err, ErrorMatches, "cannot schedule a trial boot of boot assets: trial in progress")
+	verifyWrittenGadgetData(c, mountDir, []gadgetData{
+		{target: "EFI/boot/grubx64.efi", content: "old grub"},
+		{target: "EFI/ubuntu/grub.cfg", content: "old config"},
+	})
+	c.Check(filepath.Join(mountDir, "EFI/boot/try"), testutil.FileAbsent)
+
+	// bootloader without support for trial boot of boot assets
+	bootloader.Force(bootloadertest.Mock("mock", c.MkDir()))
+	err = gadget.Update(oldData, newData, c.MkDir())
+	c.Assert(err, ErrorMatches, `cannot schedule a trial boot of boot assets: not supported by bootloader "mock"`)
+	c.Check(filepath.Join(mountDir, "EFI/boot/try"), testutil.FileAbsent)
+}
+
+func (u *updateTestSuite) TestUpdateBootAssetsNoTrialBootSupport(c *C) {
+	for _, cfg := range []string{
+		"new config",
+		// only mentioned
+		"new config\n# set snap_boot_assets_protocol=1\n",
+		"new config\nif [ $snap_boot_assets_mode = try ]; then\n",
+		// another version of the protocol
+		"new config\nset snap_boot_assets_protocol=2\n",
+	} {
+		u.testUpdateBootAssetsNoTrialBootSupport(c, cfg)
+	}
+}
+
+func (u *updateTestSuite) testUpdateBootAssetsNoTrialBootSupport(c *C, cfg string) {
+	oldData, newData, rollbackDir, mountDir := u.setupBootAssetsUpdate(c)
+	// grub configuration of the new gadget does not handle trial boots
+	makeGadgetData(c, newData.RootDir, []gadgetData{
+		{name: "grub.cfg", content: cfg},
+	})
+
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, rootDir, rollbackDir string) (gadget.Updater, error) {
+		c.Fatalf("unexpected call")
+		return nil, nil
+	})
+	defer restore()
+
+	bl := bootloadertest.Mock("grub", c.MkDir()).WithTrialBootAssets()
+	bootloader.Force(bl)
+	defer bootloader.Force(nil)
+
+	err := gadget.Update(oldData, newData, rollbackDir)
+	c.Assert(err, ErrorMatches, `cannot update volume structure #0 \("EFI System"\): grub configuration of the gadget does not support trial boot of boot assets`)
+	c.Check(bl.TryBootAssetsCalls, HasLen, 0)
+	verifyWrittenGadgetData(c, mountDir, []gadgetData{
+		{target: "EFI/boot/grubx64.efi", content: "old grub"},
+		{target: "EFI/ubuntu/grub.cfg", content: "old config"},
+	})
+}
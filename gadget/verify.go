@@ -0,0 +1,330 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package gadget
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/snapcore/snapd/bootloader"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/strutil"
+)
+
+// Verifier compares the content of a structure present on the device with the
+// content coming from the gadget.
+type Verifier interface {
+	// Verify returns a description of each content entry that is
+	// missing or different from the gadget data
+	Verify() (mismatches []string, err error)
+}
+
+// StructureReport holds the result of verification of a single structure.
+type StructureReport struct {
+	// Structure is the verified structure of the new gadget
+	Structure *LaidOutStructure
+	// Mismatches lists content entries that differ from the gadget data
+	Mismatches []string
+	// Err is set when the structure could not be verified
+	Err error
+}
+
+// OK returns true when the structure was verified and no mismatches were
+// found.
+func (r *StructureReport) OK() bool {
+	return r.Err == nil && len(r.Mismatches) == 0
+}
+
+// Verify compares the content of the structures of the gadget volume with the
+// data present on the device. A report is returned for each structure that
+// has content. Failures to verify a single structure are recorded in its
+// report, rather than returned as errors.
+func Verify(gd GadgetData) ([]StructureReport, error) {
+	if len(gd.Info.Volumes) != 1 {
+		return nil, fmt.Errorf("cannot verify a gadget with %v volumes", len(gd.Info.Volumes))
+	}
+	var vol *Volume
+	for name := range gd.Info.Volumes {
+		v := gd.Info.Volumes[name]
+		vol = &v
+	}
+	pv, err := LayoutVolume(gd.RootDir, vol, defaultConstraints)
+	if err != nil {
+		return nil, fmt.Errorf("cannot lay out the volume: %v", err)
+	}
+
+	structures := make([]*LaidOutStructure, 0, len(pv.LaidOutStructure))
+	for i := range pv.LaidOutStructure {
+		structures = append(structures, &pv.LaidOutStructure[i])
+	}
+	return verifyStructures(gd.RootDir, structures), nil
+}
+
+// VerifyUpdate verifies the structures that are updated when going from the
+// old to the new gadget, that is ones with a higher edition in the new gadget
+// definition. It is meant to be called after Update() was applied.
+func VerifyUpdate(old, new GadgetData) ([]StructureReport, error) {
+	if len(new.Info.Volumes) != 1 || len(old.Info.Volumes) != 1 {
+		// multi-volume gadgets are not updated
+		return nil, nil
+	}
+	oldVol, newVol, err := resolveVolume(old.Info, new.Info)
+	if err != nil {
+		return nil, err
+	}
+	pOld, err := LayoutVolume(old.RootDir, oldVol, defaultConstraints)
+	if err != nil {
+		return nil, fmt.Errorf("cannot lay out the old volume: %v", err)
+	}
+	pNew, err := LayoutVolume(new.RootDir, newVol, defaultConstraints)
+	if err != nil {
+		return nil, fmt.Errorf("cannot lay out the new volume: %v", err)
+	}
+	updates, err := resolveUpdate(pOld, pNew)
+	if err != nil {
+		return nil, err
+	}
+
+	structures := make([]*LaidOutStructure, 0, len(updates))
+	for _, update := range updates {
+		structures = append(structures, update.to)
+	}
+	return verifyStructures(new.RootDir, structures), nil
+}
+
+func verifyStructures(rootDir string, structures []*LaidOutStructure) []StructureReport {
+	var reports []StructureReport
+	for _, ps := range structures {
+		if len(ps.Content) == 0 {
+			// nothing that could have drifted
+			continue
+		}
+		report := StructureReport{Structure: ps}
+		verifier, err := verifierForStructure(ps, rootDir)
+		if err == nil {
+			report.Mismatches, err = verifier.Verify()
+		}
+		if err != nil {
+			report.Err = fmt.Errorf("cannot verify volume structure %v: %v", ps, err)
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+var (
+	verifierForStructure = verifierForStructureImpl
+
+	verifyDeviceLookup deviceLookupFunc = FindDeviceForStructureWithFallback
+	verifyMountLookup  mountLookupFunc  = FindMountPointForStructure
+)
+
+func verifierForStructureImpl(ps *LaidOutStructure, rootDir string) (Verifier, error) {
+	if ps.IsBare() {
+		rw, err := NewRawStructureWriter(rootDir, ps)
+		if err != nil {
+			return nil, err
+		}
+		return &RawStructureUpdater{
+			RawStructureWriter: rw,
+			deviceLookup:       verifyDeviceLookup,
+		}, nil
+	}
+	fw, err := NewMountedFilesystemWriter(rootDir, ps)
+	if err != nil {
+		return nil, err
+	}
+	return &MountedFilesystemUpdater{
+		MountedFilesystemWriter: fw,
+		mountLookup:             verifyMountLookup,
+	}, nil
+}
+
+// MockVerifierForStructure replace internal call with a mocked one, for use in tests only
+func MockVerifierForStructure(mock func(ps *LaidOutStructure, rootDir string) (Verifier, error)) (restore func()) {
+	old := verifierForStructure
+	verifierForStructure = mock
+	return func() {
+		verifierForStructure = old
+	}
+}
+
+// Verify compares each image of the raw structure with the data present at
+// the corresponding location of the device.
+func (r *RawStructureUpdater) Verify() (mismatches []string, err error) {
+	device, structForDevice, err := r.matchDevice()
+	if err != nil {
+		return nil, err
+	}
+
+	disk, err := os.OpenFile(device, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open device for reading: %v", err)
+	}
+	defer disk.Close()
+
+	for _, pc := range structForDevice.LaidOutContent {
+		same, err := r.sameContent(disk, &pc)
+		if err != nil {
+			return nil, fmt.Errorf("cannot verify image %v: %v", pc, err)
+		}
+		if !same {
+			mismatches = append(mismatches, fmt.Sprintf("image %v differs", pc))
+		}
+	}
+	return mismatches, nil
+}
+
+func (r *RawStructureUpdater) sameContent(disk io.ReadSeeker, pc *LaidOutContent) (bool, error) {
+	if _, err := disk.Seek(int64(pc.StartOffset), io.SeekStart); err != nil {
+		return false, fmt.Errorf("cannot seek to content start offset 0x%x: %v", pc.StartOffset, err)
+	}
+	onDiskHash := crypto.SHA1.New()
+	if _, err := io.CopyN(onDiskHash, disk, int64(pc.Size)); err != nil {
+		return false, fmt.Errorf("cannot checksum device data: %v", err)
+	}
+	imageDigest, _, err := osutil.FileDigest(filepath.Join(r.contentDir, pc.Image), crypto.SHA1)
+	if err != nil {
+		return false, fmt.Errorf("cannot checksum image: %v", err)
+	}
+	return bytes.Equal(onDiskHash.Sum(nil), imageDigest), nil
+}
+
+// Verify compares the files of the mounted filesystem with the ones listed in
+// the content of the structure. Files that are to be preserved are not
+// checked.
+func (f *MountedFilesystemUpdater) Verify() (mismatches []string, err error) {
+	mount, err := f.mountLookup(f.ps)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find mount location of structure %v: %v", f.ps, err)
+	}
+
+	preserveInDst, err := mapPreserve(mount, f.ps.Update.Preserve)
+	if err != nil {
+		return nil, fmt.Errorf("cannot map preserve entries for mount location %q: %v", mount, err)
+	}
+
+	for _, c := range f.ps.Content {
+		m, err := f.verifyVolumeContent(mount, &c, preserveInDst)
+		if err != nil {
+			return nil, fmt.Errorf("cannot verify content: %v", err)
+		}
+		mismatches = append(mismatches, m...)
+	}
+	return mismatches, nil
+}
+
+func (f *MountedFilesystemUpdater) verifyVolumeContent(volumeRoot string, content *VolumeContent, preserveInDst []string) ([]string, error) {
+	if err := checkContent(content); err != nil {
+		return nil, err
+	}
+
+	srcPath := f.entrySourcePath(content.Source)
+
+	if osutil.IsDirectory(srcPath) || strings.HasSuffix(content.Source, "/") {
+		return f.verifyDirectory(volumeRoot, content.Source, content.Target, preserveInDst)
+	} else {
+		return f.verifyFile(volumeRoot, content.Source, content.Target, preserveInDst)
+	}
+}
+
+func (f *MountedFilesystemUpdater) verifyDirectory(dstRoot, source, target string, preserveInDst []string) ([]string, error) {
+	fis, err := f.sourceDirectoryEntries(source)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list source directory %q: %v", source, err)
+	}
+
+	target = targetForSourceDir(source, target)
+
+	var mismatches []string
+	for _, fi := range fis {
+		pSrc := filepath.Join(source, fi.Name())
+		pDst := filepath.Join(target, fi.Name())
+
+		verify := f.verifyFile
+		if fi.IsDir() {
+			// continue verifying the contents of the directory
+			pSrc += "/"
+			pDst += "/"
+			verify = f.verifyDirectory
+		}
+		m, err := verify(dstRoot, pSrc, pDst, preserveInDst)
+		if err != nil {
+			return nil, err
+		}
+		mismatches = append(mismatches, m...)
+	}
+	return mismatches, nil
+}
+
+func (f *MountedFilesystemUpdater) verifyFile(dstRoot, source, target string, preserveInDst []string) ([]string, error) {
+	srcPath := f.entrySourcePath(source)
+	dstPath, _ := f.entryDestPaths(dstRoot, source, target, "")
+	relPath, err := filepath.Rel(dstRoot, dstPath)
+	if err != nil {
+		return nil, fmt.Errorf("internal error: %v", err)
+	}
+
+	// TODO: enable support for symlinks when needed
+	if osutil.IsSymlink(dstPath) {
+		return nil, fmt.Errorf("cannot verify file %s: symbolic links are not supported", target)
+	}
+
+	if strutil.SortedListContains(preserveInDst, dstPath) {
+		// preserved files are expected to be modified
+		return nil, nil
+	}
+
+	if !osutil.FileExists(dstPath) {
+		return []string{fmt.Sprintf("%s: missing", relPath)}, nil
+	}
+
+	srcDigest, _, err := osutil.FileDigest(srcPath, crypto.SHA1)
+	if err != nil {
+		return nil, fmt.Errorf("cannot checksum gadget file: %v", err)
+	}
+	dstDigest, _, err := osutil.FileDigest(dstPath, crypto.SHA1)
+	if err != nil {
+		return nil, fmt.Errorf("cannot checksum file: %v", err)
+	}
+	if bytes.Equal(srcDigest, dstDigest) {
+		return nil, nil
+	}
+	if asset, ok := f.bootAsset(dstRoot, dstPath); ok {
+		// the boot asset in use is what is verified, but point out
+		// when the gadget version awaits a trial boot
+		stagedPath := filepath.Join(dstRoot, bootloader.TrialBootAssetPath(asset))
+		if osutil.FileExists(stagedPath) {
+			stagedDigest, _, err := osutil.FileDigest(stagedPath, crypto.SHA1)
+			if err != nil {
+				return nil, fmt.Errorf("cannot checksum file: %v", err)
+			}
+			if bytes.Equal(srcDigest, stagedDigest) {
+				return []string{fmt.Sprintf("%s: differs, update staged for a trial boot", relPath)}, nil
+			}
+		}
+	}
+	return []string{fmt.Sprintf("%s: differs", relPath)}, nil
+}
@@ -0,0 +1,255 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package gadget_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/gadget"
+)
+
+type verifyTestSuite struct {
+	rootDir  string
+	disk     string
+	mountDir string
+}
+
+var _ = Suite(&verifyTestSuite{})
+
+const verifyGadgetYaml = `
+volumes:
+  pc:
+    bootloader: grub
+    structure:
+      - name: mbr
+        type: mbr
+        size: 440
+        update:
+          edition: 1
+        content:
+          - image: mbr.img
+      - name: foo
+        type: bare
+        size: 1M
+        content:
+          - image: foo.img
+      - name: system-boot
+        role: system-boot
+        type: 0C,C12A7328-F81F-11D2-BA4B-00A0C93EC93B
+        filesystem: vfat
+        size: 1M
+        update:
+          edition: 2
+          preserve: [config.txt]
+          boot-assets: [EFI/boot/grubx64.efi]
+        content:
+          - source: grubx64.efi
+            target: EFI/boot/grubx64.efi
+          - source: boot-dir/
+            target: /
+          - source: config.txt
+            target: config.txt
+      - name: writable
+        role: system-data
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        filesystem: ext4
+        size: 1M
+`
+
+func (s *verifyTestSuite) SetUpTest(c *C) {
+	s.rootDir = c.MkDir()
+	s.mountDir = c.MkDir()
+	s.disk = filepath.Join(c.MkDir(), "disk.img")
+
+	makeSizedFile(c, filepath.Join(s.rootDir, "meta/gadget.yaml"), 0, []byte(verifyGadgetYaml))
+	makeSizedFile(c, filepath.Join(s.rootDir, "mbr.img"), 440, []byte("mbr"))
+	makeSizedFile(c, filepath.Join(s.rootDir, "foo.img"), 128, []byte("foo"))
+	makeGadgetData(c, s.rootDir, []gadgetData{
+		{name: "grubx64.efi", content: "grub"},
+		{name: "config.txt", content: "config"},
+		{name: "boot-dir/grub.cfg", content: "grub.cfg"},
+		{name: "boot-dir/nested/data", content: "data"},
+	})
+
+	// the device and the mounted filesystem match the gadget
+	mutateFile(c, s.disk, 3*gadget.SizeMiB, []mutateWrite{
+		{[]byte("mbr"), 0},
+		{[]byte("foo"), int64(gadget.SizeMiB)},
+	})
+	makeExistingData(c, s.mountDir, []gadgetData{
+		{target: "EFI/boot/grubx64.efi", content: "grub"},
+		{target: "config.txt", content: "modified config"},
+		{target: "grub.cfg", content: "grub.cfg"},
+		{target: "nested/data", content: "data"},
+	})
+}
+
+func (s *verifyTestSuite) mockLookups(c *C) (restore func()) {
+	return gadget.MockVerifyLookups(func(ps *gadget.LaidOutStructure) (string, gadget.Size, error) {
+		c.Check(ps.IsBare(), Equals, true)
+		return s.disk, ps.StartOffset, nil
+	}, func(ps *gadget.LaidOutStructure) (string, error) {
+		c.Check(ps.Role, Equals, gadget.SystemBoot)
+		return s.mountDir, nil
+	})
+}
+
+func (s *verifyTestSuite) gadgetData(c *C) gadget.GadgetData {
+	info, err := gadget.ReadInfo(s.rootDir, false)
+	c.Assert(err, IsNil)
+	return gadget.GadgetData{Info: info, RootDir: s.rootDir}
+}
+
+func (s *verifyTestSuite) TestVerifyHappy(c *C) {
+	restore := s.mockLookups(c)
+	defer restore()
+
+	reports, err := gadget.Verify(s.gadgetData(c))
+	c.Assert(err, IsNil)
+	// writable has no content and is not verified
+	c.Assert(reports, HasLen, 3)
+	for i, name := range []string{"mbr", "foo", "system-boot"} {
+		c.Check(reports[i].Structure.Name, Equals, name)
+		c.Check(reports[i].Mismatches, HasLen, 0)
+		c.Check(reports[i].Err, IsNil)
+		c.Check(reports[i].OK(), Equals, true)
+	}
+}
+
+func (s *verifyTestSuite) TestVerifyMismatches(c *C) {
+	restore := s.mockLookups(c)
+	defer restore()
+
+	// the bare structure was overwritten
+	mutateFile(c, s.disk, 3*gadget.SizeMiB, []mutateWrite{
+		{[]byte("mbr"), 0},
+		{[]byte("bar"), int64(gadget.SizeMiB)},
+	})
+	// some files were modified or removed
+	err := ioutil.WriteFile(filepath.Join(s.mountDir, "grub.cfg"), []byte("tampered"), 0644)
+	c.Assert(err, IsNil)
+	err = os.Remove(filepath.Join(s.mountDir, "nested/data"))
+	c.Assert(err, IsNil)
+
+	reports, err := gadget.Verify(s.gadgetData(c))
+	c.Assert(err, IsNil)
+	c.Assert(reports, HasLen, 3)
+	c.Check(reports[0].OK(), Equals, true)
+	c.Check(reports[1].OK(), Equals, false)
+	c.Check(reports[1].Mismatches, DeepEquals, []string{
+		`image #0 ("foo.img"@0x100000{128}) differs`,
+	})
+	c.Check(reports[2].OK(), Equals, false)
+	c.Check(reports[2].Mismatches, DeepEquals, []string{
+		"grub.cfg: differs",
+		"nested/data: missing",
+	})
+}
+
+func (s *verifyTestSuite) TestVerifyStructureErrors(c *C) {
+	restore := gadget.MockVerifyLookups(func(ps *gadget.LaidOutStructure) (string, gadget.Size, error) {
+		return "", 0, errors.New("device fail")
+	}, func(ps *gadget.LaidOutStructure) (string, error) {
+		return "", errors.New("mount fail")
+	})
+	defer restore()
+
+	reports, err := gadget.Verify(s.gadgetData(c))
+	c.Assert(err, IsNil)
+	c.Assert(reports, HasLen, 3)
+	c.Check(reports[0].Err, ErrorMatches, `cannot verify volume structure #0 \("mbr"\): cannot find device matching structure #0 \("mbr"\): device fail`)
+	c.Check(reports[1].Err, ErrorMatches, `cannot verify volume structure #1 \("foo"\): cannot find device matching structure #1 \("foo"\): device fail`)
+	c.Check(reports[2].Err, ErrorMatches, `cannot verify volume structure #2 \("system-boot"\): cannot find mount location of structure #2 \("system-boot"\): mount fail`)
+	for _, r := range reports {
+		c.Check(r.OK(), Equals, false)
+	}
+}
+
+func (s *verifyTestSuite) TestVerifyUpdateOnlyUpdatedStructures(c *C) {
+	restore := s.mockLookups(c)
+	defer restore()
+
+	old := s.gadgetData(c)
+	new := s.gadgetData(c)
+	newVol := new.Info.Volumes["pc"]
+	// bump the edition of the bare structure only
+	newVol.Structure[1].Update.Edition = 1
+	newVol.Structure[2].Update.Edition = 2
+	new.Info.Volumes["pc"] = newVol
+
+	reports, err := gadget.VerifyUpdate(old, new)
+	c.Assert(err, IsNil)
+	c.Assert(reports, HasLen, 1)
+	c.Check(reports[0].Structure.Name, Equals, "foo")
+	c.Check(reports[0].OK(), Equals, true)
+}
+
+func (s *verifyTestSuite) TestVerifyUpdateNothingUpdated(c *C) {
+	verifierForStructure := func(ps *gadget.LaidOutStructure, rootDir string) (gadget.Verifier, error) {
+		c.Fatalf("unexpected call")
+		return nil, nil
+	}
+	restore := gadget.MockVerifierForStructure(verifierForStructure)
+	defer restore()
+
+	reports, err := gadget.VerifyUpdate(s.gadgetData(c), s.gadgetData(c))
+	c.Assert(err, IsNil)
+	c.Check(reports, HasLen, 0)
+}
+
+func (s *verifyTestSuite) TestVerifyErrors(c *C) {
+	gd := s.gadgetData(c)
+	gd.Info.Volumes["other"] = gd.Info.Volumes["pc"]
+	_, err := gadget.Verify(gd)
+	c.Assert(err, ErrorMatches, "cannot verify a gadget with 2 volumes")
+
+	gd = s.gadgetData(c)
+	err = os.Remove(filepath.Join(s.rootDir, "foo.img"))
+	c.Assert(err, IsNil)
+	_, err = gadget.Verify(gd)
+	c.Assert(err, ErrorMatches, `cannot lay out the volume: cannot lay out structure #1 \("foo"\): content "foo.img":.*`)
+}
+
+func (s *verifyTestSuite) TestVerifyStagedBootAsset(c *C) {
+	restore := s.mockLookups(c)
+	defer restore()
+
+	// the new boot asset is staged for a trial boot
+	makeExistingData(c, s.mountDir, []gadgetData{
+		{target: "EFI/boot/grubx64.efi", content: "old grub"},
+		{target: "EFI/boot/try/grubx64.efi", content: "grub"},
+	})
+
+	// the live boot asset is still reported as drifted
+	reports, err := gadget.Verify(s.gadgetData(c))
+	c.Assert(err, IsNil)
+	c.Assert(reports, HasLen, 3)
+	c.Check(reports[2].Mismatches, DeepEquals, []string{"EFI/boot/grubx64.efi: differs, update staged for a trial boot"})
+
+	err = os.Remove(filepath.Join(s.mountDir, "EFI/boot/try/grubx64.efi"))
+	c.Assert(err, IsNil)
+	reports, err = gadget.Verify(s.gadgetData(c))
+	c.Assert(err, IsNil)
+	c.Check(reports[2].Mismatches, DeepEquals, []string{"EFI/boot/grubx64.efi: differs"})
+}
@@ -0,0 +1,221 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package gadget
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/logger"
+)
+
+const (
+	// sizeGPTBackup is the number of sectors occupied by the backup GPT
+	// header and partition entries at the end of the disk
+	sizeGPTBackup = 33
+	// copyChunkSize is the size of chunks in which filesystem images are
+	// copied into the volume
+	copyChunkSize = 64 * SizeKiB
+)
+
+// volumeImageSize returns the size of the image file needed to hold the laid
+// out volume, including the space at the end of the volume used by the backup
+// GPT.
+func volumeImageSize(lv *LaidOutVolume) Size {
+	size := lv.Size
+	if rem := size % lv.SectorSize; rem != 0 {
+		size += lv.SectorSize - rem
+	}
+	if lv.EffectiveSchema() == GPT {
+		size += sizeGPTBackup * lv.SectorSize
+	}
+	return size
+}
+
+// WriteVolumeImage writes a complete, flashable image of the laid out volume
+// to the given path. The image is created as a sparse file, partitioned
+// according to the volume schema, and populated with the bare structures and
+// filesystem images of all the structures. The optional post-stage helper is
+// passed to the filesystem image writer of each structure with a filesystem.
+func WriteVolumeImage(lv *LaidOutVolume, outPath string, postStage PostStageFunc) (err error) {
+	if lv == nil {
+		return fmt.Errorf("internal error: *LaidOutVolume is nil")
+	}
+	if outPath == "" {
+		return fmt.Errorf("internal error: image path is unset")
+	}
+
+	workDir, err := ioutil.TempDir(filepath.Dir(outPath), ".snap-volume-image-")
+	if err != nil {
+		return fmt.Errorf("cannot create work directory: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	out, err := os.OpenFile(outPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot create image file: %v", err)
+	}
+	defer func() {
+		if cerr := out.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("cannot close image file: %v", cerr)
+		}
+		if err != nil {
+			os.Remove(outPath)
+		}
+	}()
+	if err := out.Truncate(int64(volumeImageSize(lv))); err != nil {
+		return fmt.Errorf("cannot resize image file: %v", err)
+	}
+
+	// the partition table is written first, bare structures such as the
+	// MBR boot code are written over it later on
+	if err := Partition(outPath, lv); err != nil {
+		return err
+	}
+
+	for idx := range lv.LaidOutStructure {
+		// the image file has just been created, zeros need not be written
+		if err := writeStructure(out, lv, &lv.LaidOutStructure[idx], workDir, postStage, true); err != nil {
+			return err
+		}
+	}
+
+	// offset-writes may point into any of the structures, apply them once
+	// all the content is in place
+	for idx := range lv.LaidOutStructure {
+		ps := &lv.LaidOutStructure[idx]
+		ow, err := NewOffsetWriter(ps, lv.SectorSize)
+		if err != nil {
+			return err
+		}
+		if err := ow.Write(out); err != nil {
+			return fmt.Errorf("cannot write offsets of structure %v: %v", ps, err)
+		}
+	}
+	return nil
+}
+
+// WriteStructure writes the content of the laid out structure to out, which
+// is either an image file or a block device holding the whole volume. Bare
+// structures are written as is, structures with a filesystem are first
+// created as a filesystem image in the work directory, using the optional
+// post-stage helper, and then copied over to out. When out is a regular
+// file, the area of the structure is deallocated first so that only the
+// non-zero parts of the filesystem image need to be written.
+func WriteStructure(out *os.File, lv *LaidOutVolume, ps *LaidOutStructure, workDir string, postStage PostStageFunc) error {
+	sparse := false
+	if !ps.IsBare() {
+		sparse = punchHole(out, ps.StartOffset, ps.Size)
+	}
+	return writeStructure(out, lv, ps, workDir, postStage, sparse)
+}
+
+// WriteFilesystemStructure creates the filesystem of the laid out structure
+// directly on node, the block device node of the partition holding it, and
+// populates it with the structure content using the optional post-stage
+// helper. Unlike WriteStructure, no filesystem image is staged in the work
+// directory.
+func WriteFilesystemStructure(node string, lv *LaidOutVolume, ps *LaidOutStructure, workDir string, postStage PostStageFunc) error {
+	fiw, err := NewFilesystemImageWriter(lv.RootDir, ps, workDir)
+	if err != nil {
+		return err
+	}
+	if err := fiw.WriteNode(node, postStage); err != nil {
+		return fmt.Errorf("cannot create filesystem of structure %v on %s: %v", ps, node, err)
+	}
+	return nil
+}
+
+func writeStructure(out *os.File, lv *LaidOutVolume, ps *LaidOutStructure, workDir string, postStage PostStageFunc, sparse bool) error {
+	if ps.IsBare() {
+		return writeBareStructureImage(out, lv, ps)
+	}
+	return writeFilesystemStructureImage(out, lv, ps, workDir, postStage, sparse)
+}
+
+func writeBareStructureImage(out io.WriteSeeker, lv *LaidOutVolume, ps *LaidOutStructure) error {
+	rw, err := NewRawStructureWriter(lv.RootDir, ps)
+	if err != nil {
+		return err
+	}
+	if err := rw.Write(out); err != nil {
+		return fmt.Errorf("cannot write structure %v: %v", ps, err)
+	}
+	return nil
+}
+
+func writeFilesystemStructureImage(out io.WriterAt, lv *LaidOutVolume, ps *LaidOutStructure, workDir string, postStage PostStageFunc, sparse bool) error {
+	fiw, err := NewFilesystemImageWriter(lv.RootDir, ps, workDir)
+	if err != nil {
+		return err
+	}
+
+	img := filepath.Join(workDir, fmt.Sprintf("part-%04d.img", ps.Index))
+	f, err := os.Create(img)
+	if err != nil {
+		return fmt.Errorf("cannot create filesystem image of structure %v: %v", ps, err)
+	}
+	defer func() {
+		f.Close()
+		if os.Getenv("SNAP_DEBUG_IMAGE_NO_CLEANUP") == "" {
+			if err := os.Remove(img); err != nil {
+				logger.Noticef("cannot remove filesystem image %q: %v", img, err)
+			}
+		}
+	}()
+	if err := f.Truncate(int64(ps.Size)); err != nil {
+		return fmt.Errorf("cannot create filesystem image of structure %v: %v", ps, err)
+	}
+
+	if err := fiw.Write(img, postStage); err != nil {
+		return fmt.Errorf("cannot create filesystem image of structure %v: %v", ps, err)
+	}
+	if err := copyImage(out, f, ps.StartOffset, ps.Size, sparse); err != nil {
+		return fmt.Errorf("cannot write structure %v: %v", ps, err)
+	}
+	return nil
+}
+
+// copyImage copies size bytes from in to out, starting at the given offset
+// of out. When sparse is set, chunks that are all zeros are skipped so that
+// out, which must be zeroed already, remains sparse.
+func copyImage(out io.WriterAt, in io.ReaderAt, offset, size Size, sparse bool) error {
+	buf := make([]byte, copyChunkSize)
+	zeros := make([]byte, copyChunkSize)
+	for pos := Size(0); pos < size; pos += copyChunkSize {
+		chunk := buf
+		if size-pos < copyChunkSize {
+			chunk = buf[:size-pos]
+		}
+		if _, err := in.ReadAt(chunk, int64(pos)); err != nil {
+			return fmt.Errorf("cannot read filesystem image: %v", err)
+		}
+		if sparse && bytes.Equal(chunk, zeros[:len(chunk)]) {
+			continue
+		}
+		if _, err := out.WriteAt(chunk, int64(offset+pos)); err != nil {
+			return fmt.Errorf("cannot write image: %v", err)
+		}
+	}
+	return nil
+}
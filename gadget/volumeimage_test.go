@@ -0,0 +1,276 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package gadget_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type volumeImageTestSuite struct {
+	testutil.BaseTest
+
+	dir     string
+	content string
+	sfdisk  *testutil.MockCmd
+}
+
+var _ = Suite(&volumeImageTestSuite{})
+
+const volumeImageGadgetYaml = `
+volumes:
+  pc:
+    bootloader: grub
+    schema: gpt
+    structure:
+      - name: mbr
+        type: mbr
+        size: 440
+        content:
+          - image: pc-boot.img
+      - name: BIOS Boot
+        type: DA,21686148-6449-6E6F-744E-656564454649
+        size: 1M
+        offset: 1M
+        offset-write: mbr+92
+        content:
+          - image: pc-core.img
+      - name: EFI System
+        type: C12A7328-F81F-11D2-BA4B-00A0C93EC93B
+        filesystem: vfat
+        filesystem-label: system-boot
+        size: 2M
+        content:
+          - source: grubx64.efi
+            target: EFI/boot/grubx64.efi
+`
+
+func (s *volumeImageTestSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+
+	s.dir = c.MkDir()
+	s.content = filepath.Join(s.dir, "content")
+	makeSizedFile(c, filepath.Join(s.content, "pc-boot.img"), 0, bytes.Repeat([]byte{'b'}, 440))
+	makeSizedFile(c, filepath.Join(s.content, "pc-core.img"), 0, bytes.Repeat([]byte{'c'}, 1024))
+	makeSizedFile(c, filepath.Join(s.content, "grubx64.efi"), 0, []byte("grub"))
+
+	s.sfdisk = testutil.MockCommand(c, "sfdisk", fmt.Sprintf("cat > %s/sfdisk-input", s.dir))
+	s.AddCleanup(s.sfdisk.Restore)
+}
+
+func (s *volumeImageTestSuite) layout(c *C) *gadget.LaidOutVolume {
+	vol := mustParseVolume(c, volumeImageGadgetYaml, "pc")
+	lv, err := gadget.LayoutVolume(s.content, vol, gadget.LayoutConstraints{
+		NonMBRStartOffset: 1 * gadget.SizeMiB,
+		SectorSize:        512,
+	})
+	c.Assert(err, IsNil)
+	return lv
+}
+
+func (s *volumeImageTestSuite) TestWriteVolumeImageHappy(c *C) {
+	var staged []string
+	s.AddCleanup(gadget.MockMkfsHandlers(map[string]gadget.MkfsFunc{
+		"vfat": func(imgFile, label, contentsRootDir string) error {
+			c.Check(label, Equals, "system-boot")
+			c.Check(filepath.Join(contentsRootDir, "EFI/boot/grubx64.efi"), testutil.FileEquals, "grub")
+			c.Check(filepath.Join(contentsRootDir, "extra"), testutil.FileEquals, "extra")
+			// mark the start and the end of the filesystem
+			f, err := os.OpenFile(imgFile, os.O_RDWR, 0644)
+			c.Assert(err, IsNil)
+			defer f.Close()
+			_, err = f.WriteAt([]byte("happyfs-start"), 0)
+			c.Assert(err, IsNil)
+			_, err = f.WriteAt([]byte("happyfs-end"), int64(2*gadget.SizeMiB)-11)
+			c.Assert(err, IsNil)
+			return nil
+		},
+	}))
+	postStage := func(rootDir string, ps *gadget.LaidOutStructure) error {
+		staged = append(staged, ps.Name)
+		return ioutil.WriteFile(filepath.Join(rootDir, "extra"), []byte("extra"), 0644)
+	}
+
+	imgPath := filepath.Join(s.dir, "pc.img")
+	err := gadget.WriteVolumeImage(s.layout(c), imgPath, postStage)
+	c.Assert(err, IsNil)
+	c.Check(staged, DeepEquals, []string{"EFI System"})
+
+	c.Check(s.sfdisk.Calls(), DeepEquals, [][]string{
+		{"sfdisk", imgPath},
+	})
+	c.Check(filepath.Join(s.dir, "sfdisk-input"), testutil.FileEquals, `unit: sectors
+label: gpt
+first-lba: 34
+
+start=2048, size=2048, type=21686148-6449-6E6F-744E-656564454649, name="BIOS Boot"
+start=4096, size=4096, type=C12A7328-F81F-11D2-BA4B-00A0C93EC93B, name="EFI System"
+`)
+
+	img, err := ioutil.ReadFile(imgPath)
+	c.Assert(err, IsNil)
+	// the volume with the backup GPT at the end
+	c.Assert(img, HasLen, int(4*gadget.SizeMiB+33*512))
+
+	// MBR boot code, with the LBA of the BIOS boot structure written at
+	// the requested offset
+	c.Check(img[:92], DeepEquals, bytes.Repeat([]byte{'b'}, 92))
+	c.Check(binary.LittleEndian.Uint32(img[92:96]), Equals, uint32(2048))
+	c.Check(img[96:440], DeepEquals, bytes.Repeat([]byte{'b'}, 440-96))
+	// raw content of the BIOS boot structure
+	c.Check(img[gadget.SizeMiB:gadget.SizeMiB+1024], DeepEquals, bytes.Repeat([]byte{'c'}, 1024))
+	c.Check(img[gadget.SizeMiB+1024:2*gadget.SizeMiB], DeepEquals, make([]byte, gadget.SizeMiB-1024))
+	// filesystem image
+	c.Check(string(img[2*gadget.SizeMiB:2*gadget.SizeMiB+13]), Equals, "happyfs-start")
+	c.Check(string(img[4*gadget.SizeMiB-11:4*gadget.SizeMiB]), Equals, "happyfs-end")
+
+	// work files are gone
+	matches, err := filepath.Glob(filepath.Join(s.dir, ".snap-volume-image-*"))
+	c.Assert(err, IsNil)
+	c.Check(matches, HasLen, 0)
+}
+
+func (s *volumeImageTestSuite) TestWriteVolumeImageMBRSize(c *C) {
+	lv := &gadget.LaidOutVolume{
+		Volume: &gadget.Volume{
+			Schema: "mbr",
+		},
+		Size:       1*gadget.SizeMiB + 100,
+		SectorSize: 512,
+		RootDir:    s.content,
+	}
+	imgPath := filepath.Join(s.dir, "pc.img")
+	err := gadget.WriteVolumeImage(lv, imgPath, nil)
+	c.Assert(err, IsNil)
+
+	// rounded up to a full sector, no backup GPT
+	st, err := os.Stat(imgPath)
+	c.Assert(err, IsNil)
+	c.Check(st.Size(), Equals, int64(1*gadget.SizeMiB+512))
+}
+
+func (s *volumeImageTestSuite) TestWriteVolumeImageErrors(c *C) {
+	err := gadget.WriteVolumeImage(nil, filepath.Join(s.dir, "pc.img"), nil)
+	c.Check(err, ErrorMatches, `internal error: \*LaidOutVolume is nil`)
+
+	err = gadget.WriteVolumeImage(s.layout(c), "", nil)
+	c.Check(err, ErrorMatches, "internal error: image path is unset")
+}
+
+func (s *volumeImageTestSuite) TestWriteVolumeImageMkfsError(c *C) {
+	s.AddCleanup(gadget.MockMkfsHandlers(map[string]gadget.MkfsFunc{
+		"vfat": func(imgFile, label, contentsRootDir string) error {
+			return errors.New("boom")
+		},
+	}))
+
+	imgPath := filepath.Join(s.dir, "pc.img")
+	err := gadget.WriteVolumeImage(s.layout(c), imgPath, nil)
+	c.Assert(err, ErrorMatches, `cannot create filesystem image of structure #2 \("EFI System"\): cannot create "vfat" filesystem: boom`)
+	// no partial image is left behind
+	c.Check(imgPath, testutil.FileAbsent)
+}
+
+func (s *volumeImageTestSuite) TestWriteVolumeImagePartitionError(c *C) {
+	sfdisk := testutil.MockCommand(c, "sfdisk", "echo 'failed'; false")
+	defer sfdisk.Restore()
+
+	imgPath := filepath.Join(s.dir, "pc.img")
+	err := gadget.WriteVolumeImage(s.layout(c), imgPath, nil)
+	c.Assert(err, ErrorMatches, "cannot partition image using sfdisk: failed")
+	c.Check(imgPath, testutil.FileAbsent)
+}
+
+func (s *volumeImageTestSuite) TestWriteStructureOverwritesStaleData(c *C) {
+	s.AddCleanup(gadget.MockMkfsHandlers(map[string]gadget.MkfsFunc{
+		"vfat": func(imgFile, label, contentsRootDir string) error {
+			f, err := os.OpenFile(imgFile, os.O_RDWR, 0644)
+			c.Assert(err, IsNil)
+			defer f.Close()
+			_, err = f.WriteAt([]byte("vfat"), 0)
+			return err
+		},
+	}))
+
+	lv := s.layout(c)
+	ps := &lv.LaidOutStructure[2]
+	c.Assert(ps.Name, Equals, "EFI System")
+
+	// a device with stale data all over
+	devPath := filepath.Join(s.dir, "device")
+	c.Assert(ioutil.WriteFile(devPath, bytes.Repeat([]byte{0xff}, int(4*gadget.SizeMiB)), 0644), IsNil)
+	dev, err := os.OpenFile(devPath, os.O_RDWR, 0)
+	c.Assert(err, IsNil)
+	defer dev.Close()
+
+	err = gadget.WriteStructure(dev, lv, ps, c.MkDir(), nil)
+	c.Assert(err, IsNil)
+
+	data, err := ioutil.ReadFile(devPath)
+	c.Assert(err, IsNil)
+	c.Check(string(data[2*gadget.SizeMiB:2*gadget.SizeMiB+4]), Equals, "vfat")
+	// the rest of the structure is zeroed
+	c.Check(data[2*gadget.SizeMiB+4:4*gadget.SizeMiB], DeepEquals, make([]byte, 2*gadget.SizeMiB-4))
+	// data outside of the structure is untouched
+	c.Check(data[2*gadget.SizeMiB-1], Equals, byte(0xff))
+}
+
+func (s *volumeImageTestSuite) TestWriteStructureKeepsImageSparse(c *C) {
+	s.AddCleanup(gadget.MockMkfsHandlers(map[string]gadget.MkfsFunc{
+		"vfat": func(imgFile, label, contentsRootDir string) error {
+			f, err := os.OpenFile(imgFile, os.O_RDWR, 0644)
+			c.Assert(err, IsNil)
+			defer f.Close()
+			_, err = f.WriteAt([]byte("vfat"), 0)
+			return err
+		},
+	}))
+
+	lv := s.layout(c)
+	ps := &lv.LaidOutStructure[2]
+	c.Assert(ps.Name, Equals, "EFI System")
+
+	devPath := filepath.Join(s.dir, "device")
+	c.Assert(ioutil.WriteFile(devPath, bytes.Repeat([]byte{0xff}, int(4*gadget.SizeMiB)), 0644), IsNil)
+	dev, err := os.OpenFile(devPath, os.O_RDWR, 0)
+	c.Assert(err, IsNil)
+	defer dev.Close()
+	if err := syscall.Fallocate(int(dev.Fd()), 0x03, 0, 4096); err != nil {
+		c.Skip(fmt.Sprintf("cannot deallocate file blocks: %v", err))
+	}
+
+	err = gadget.WriteStructure(dev, lv, ps, c.MkDir(), nil)
+	c.Assert(err, IsNil)
+
+	var st syscall.Stat_t
+	c.Assert(syscall.Stat(devPath, &st), IsNil)
+	// the zeros of the filesystem image were not written out
+	c.Check(st.Blocks*512 < int64(3*gadget.SizeMiB), Equals, true, Commentf("%v blocks allocated", st.Blocks))
+}
@@ -0,0 +1,119 @@
+// +build go1.8
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package httputil
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/snapcore/snapd/logger"
+)
+
+// extraCertsTransport is a http.RoundTripper that trusts extra SSL
+// certificates in addition to the system ones. Changes to the
+// certificates are picked up on the next request.
+type extraCertsTransport struct {
+	opts *ClientOptions
+
+	mu        sync.Mutex
+	transport *http.Transport
+	// stamp identifies the certificates trusted by transport
+	stamp string
+}
+
+func newExtraCertsTransport(opts *ClientOptions) http.RoundTripper {
+	return &extraCertsTransport{opts: opts}
+}
+
+func (t *extraCertsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport, err := t.currentTransport()
+	if err != nil {
+		return nil, err
+	}
+	return transport.RoundTrip(req)
+}
+
+func (t *extraCertsTransport) currentTransport() (*http.Transport, error) {
+	certFiles, err := t.opts.ExtraSSLCerts.CertFiles()
+	if err != nil {
+		return nil, fmt.Errorf("cannot find extra certificates: %v", err)
+	}
+	var stamp bytes.Buffer
+	for _, p := range certFiles {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&stamp, "%s %d %d\n", p, fi.Size(), fi.ModTime().UnixNano())
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.transport != nil && t.stamp == stamp.String() {
+		return t.transport, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, fmt.Errorf("cannot load system certificates: %v", err)
+	}
+	for _, p := range certFiles {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		// invalid certificates are refused when they are added,
+		// there is nothing more to do here if some slipped in
+		pool.AppendCertsFromPEM(data)
+	}
+	tlsConfig := &tls.Config{}
+	if t.opts.TLSConfig != nil {
+		tlsConfig = t.opts.TLSConfig.Clone()
+	}
+	tlsConfig.RootCAs = pool
+
+	if t.transport != nil {
+		t.transport.CloseIdleConnections()
+	}
+	t.transport = newTransport(t.opts, tlsConfig)
+	t.stamp = stamp.String()
+	return t.transport, nil
+}
+
+func baseTransport(tr http.RoundTripper) *http.Transport {
+	if t, ok := tr.(*extraCertsTransport); ok {
+		transport, err := t.currentTransport()
+		if err != nil {
+			// the extra certificates cannot be loaded, the
+			// transport trusting only the system ones is what
+			// is left
+			logger.Noticef("cannot use extra certificates: %v", err)
+			return newTransport(t.opts, t.opts.TLSConfig)
+		}
+		return transport
+	}
+	return tr.(*http.Transport)
+}
@@ -23,6 +23,7 @@ import (
 	"crypto/tls"
 	"net/http"
 	"net/url"
+	"path/filepath"
 	"time"
 )
 
@@ -31,6 +32,26 @@ type ClientOptions struct {
 	TLSConfig  *tls.Config
 	MayLogBody bool
 	Proxy      func(*http.Request) (*url.URL, error)
+
+	// ExtraSSLCerts are trusted in addition to the system certificates
+	ExtraSSLCerts ExtraSSLCerts
+}
+
+// ExtraSSLCerts provides SSL certificates to trust in addition to the
+// ones of the system.
+type ExtraSSLCerts interface {
+	// CertFiles returns the paths of the PEM encoded certificates.
+	CertFiles() ([]string, error)
+}
+
+// ExtraSSLCertsFromDir trusts the *.pem certificates in a directory.
+type ExtraSSLCertsFromDir struct {
+	Dir string
+}
+
+// CertFiles returns the *.pem files in the directory.
+func (e *ExtraSSLCertsFromDir) CertFiles() ([]string, error) {
+	return filepath.Glob(filepath.Join(e.Dir, "*.pem"))
 }
 
 // NewHTTPCLient returns a new http.Client with a LoggedTransport, a
@@ -40,10 +61,9 @@ func NewHTTPClient(opts *ClientOptions) *http.Client {
 		opts = &ClientOptions{}
 	}
 
-	transport := newDefaultTransport()
-	transport.TLSClientConfig = opts.TLSConfig
-	if opts.Proxy != nil {
-		transport.Proxy = opts.Proxy
+	var transport http.RoundTripper = newTransport(opts, opts.TLSConfig)
+	if opts.ExtraSSLCerts != nil {
+		transport = newExtraCertsTransport(opts)
 	}
 
 	return &http.Client{
@@ -56,3 +76,12 @@ func NewHTTPClient(opts *ClientOptions) *http.Client {
 		CheckRedirect: checkRedirect,
 	}
 }
+
+func newTransport(opts *ClientOptions, tlsConfig *tls.Config) *http.Transport {
+	transport := newDefaultTransport()
+	transport.TLSClientConfig = tlsConfig
+	if opts.Proxy != nil {
+		transport.Proxy = opts.Proxy
+	}
+	return transport
+}
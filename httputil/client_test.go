@@ -20,8 +20,15 @@
 package httputil_test
 
 import (
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"log"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"path/filepath"
 
 	"gopkg.in/check.v1"
 
@@ -60,3 +67,74 @@ func (s *clientSuite) TestClientOptionsWithProxy(c *check.C) {
 	c.Check(err, check.IsNil)
 	c.Check(url.String(), check.Equals, "http://some-proxy:3128")
 }
+
+func (s *clientSuite) TestClientOptionsWithExtraSSLCerts(c *check.C) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	// do not log the failing handshakes
+	srv.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	certsDir := c.MkDir()
+	cli := httputil.NewHTTPClient(&httputil.ClientOptions{
+		ExtraSSLCerts: &httputil.ExtraSSLCertsFromDir{Dir: certsDir},
+	})
+
+	// the self-signed certificate of the server is not trusted
+	_, err := cli.Get(srv.URL)
+	c.Assert(err, check.ErrorMatches, ".* certificate signed by unknown authority")
+
+	// until it is added to the extra certificates
+	cert := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: srv.TLS.Certificates[0].Certificate[0],
+	})
+	err = ioutil.WriteFile(filepath.Join(certsDir, "test.pem"), cert, 0644)
+	c.Assert(err, check.IsNil)
+
+	rsp, err := cli.Get(srv.URL)
+	c.Assert(err, check.IsNil)
+	rsp.Body.Close()
+	c.Check(rsp.StatusCode, check.Equals, 200)
+}
+
+type brokenExtraSSLCerts struct{}
+
+func (brokenExtraSSLCerts) CertFiles() ([]string, error) {
+	return nil, errors.New("boom")
+}
+
+func (s *clientSuite) TestBaseTransportExtraSSLCertsError(c *check.C) {
+	tlsConfig := &tls.Config{ServerName: "example.com"}
+	cli := httputil.NewHTTPClient(&httputil.ClientOptions{
+		TLSConfig:     tlsConfig,
+		ExtraSSLCerts: brokenExtraSSLCerts{},
+	})
+
+	// requests fail
+	_, err := cli.Get("https://example.com")
+	c.Assert(err, check.ErrorMatches, ".*cannot find extra certificates: boom")
+
+	// but the base transport falls back to the system certificates
+	tr := httputil.BaseTransport(cli)
+	c.Assert(tr, check.NotNil)
+	c.Check(tr.TLSClientConfig, check.Equals, tlsConfig)
+}
+
+func (s *clientSuite) TestExtraSSLCertsFromDir(c *check.C) {
+	certsDir := c.MkDir()
+	for _, name := range []string{"a.pem", "b.pem", "c.txt"} {
+		err := ioutil.WriteFile(filepath.Join(certsDir, name), nil, 0644)
+		c.Assert(err, check.IsNil)
+	}
+
+	extraCerts := &httputil.ExtraSSLCertsFromDir{Dir: certsDir}
+	certFiles, err := extraCerts.CertFiles()
+	c.Assert(err, check.IsNil)
+	c.Check(certFiles, check.DeepEquals, []string{
+		filepath.Join(certsDir, "a.pem"),
+		filepath.Join(certsDir, "b.pem"),
+	})
+}
@@ -102,5 +102,5 @@ func BaseTransport(cli *http.Client) *http.Transport {
 	if !ok {
 		panic("client must have been created with httputil.NewHTTPClient")
 	}
-	return tr.Transport.(*http.Transport)
+	return baseTransport(tr.Transport)
 }
@@ -17,7 +17,7 @@
  *
  */
 
-package daemon
+package netutil
 
 import (
 	"errors"
@@ -29,7 +29,9 @@ import (
 	sys "syscall"
 )
 
-var errNoID = errors.New("no pid/uid found")
+// ErrNoID is returned by UcrednetGet when the remote address carries no
+// pid and uid.
+var ErrNoID = errors.New("no pid/uid found")
 
 const (
 	ucrednetNoProcess = int32(0)
@@ -38,7 +40,10 @@ const (
 
 var raddrRegexp = regexp.MustCompile(`^pid=(\d+);uid=(\d+);socket=([^;]*);$`)
 
-func ucrednetGet(remoteAddr string) (pid int32, uid uint32, socket string, err error) {
+// UcrednetGet returns the pid, uid and socket of the peer from the remote
+// address of a connection accepted by a listener wrapped with
+// WrapUcrednetListener.
+func UcrednetGet(remoteAddr string) (pid int32, uid uint32, socket string, err error) {
 	// NOTE treat remoteAddr at one point included a user-controlled
 	// string. In case that happens again by accident, treat it as tainted,
 	// and be very suspicious of it.
@@ -55,7 +60,7 @@ func ucrednetGet(remoteAddr string) (pid int32, uid uint32, socket string, err e
 		socket = subs[3]
 	}
 	if pid == ucrednetNoProcess || uid == ucrednetNobody {
-		err = errNoID
+		err = ErrNoID
 	}
 
 	return pid, uid, socket, err
@@ -102,6 +107,12 @@ type ucrednetListener struct {
 	closeErr     error
 }
 
+// WrapUcrednetListener wraps the given listener so that the remote address of
+// the accepted unix socket connections carries the credentials of the peer.
+func WrapUcrednetListener(l net.Listener) net.Listener {
+	return &ucrednetListener{Listener: l}
+}
+
 var getUcred = sys.GetsockoptUcred
 
 func (wl *ucrednetListener) Accept() (net.Conn, error) {
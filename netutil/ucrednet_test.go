@@ -17,17 +17,20 @@
  *
  */
 
-package daemon
+package netutil
 
 import (
 	"errors"
 	"net"
 	"path/filepath"
 	sys "syscall"
+	"testing"
 
 	"gopkg.in/check.v1"
 )
 
+func Test(t *testing.T) { check.TestingT(t) }
+
 type ucrednetSuite struct {
 	ucred *sys.Ucred
 	err   error
@@ -74,7 +77,7 @@ func (s *ucrednetSuite) TestAcceptConnRemoteAddrString(c *check.C) {
 
 	remoteAddr := conn.RemoteAddr().String()
 	c.Check(remoteAddr, check.Matches, "pid=100;uid=42;.*")
-	pid, uid, _, err := ucrednetGet(remoteAddr)
+	pid, uid, _, err := UcrednetGet(remoteAddr)
 	c.Check(pid, check.Equals, int32(100))
 	c.Check(uid, check.Equals, uint32(42))
 	c.Check(err, check.IsNil)
@@ -101,10 +104,10 @@ func (s *ucrednetSuite) TestNonUnix(c *check.C) {
 
 	remoteAddr := conn.RemoteAddr().String()
 	c.Check(remoteAddr, check.Matches, "pid=;uid=;.*")
-	pid, uid, _, err := ucrednetGet(remoteAddr)
+	pid, uid, _, err := UcrednetGet(remoteAddr)
 	c.Check(pid, check.Equals, ucrednetNoProcess)
 	c.Check(uid, check.Equals, ucrednetNobody)
-	c.Check(err, check.Equals, errNoID)
+	c.Check(err, check.Equals, ErrNoID)
 }
 
 func (s *ucrednetSuite) TestAcceptErrors(c *check.C) {
@@ -157,35 +160,35 @@ func (s *ucrednetSuite) TestIdempotentClose(c *check.C) {
 }
 
 func (s *ucrednetSuite) TestGetNoUid(c *check.C) {
-	pid, uid, _, err := ucrednetGet("pid=100;uid=;socket=;")
-	c.Check(err, check.Equals, errNoID)
+	pid, uid, _, err := UcrednetGet("pid=100;uid=;socket=;")
+	c.Check(err, check.Equals, ErrNoID)
 	c.Check(pid, check.Equals, ucrednetNoProcess)
 	c.Check(uid, check.Equals, ucrednetNobody)
 }
 
 func (s *ucrednetSuite) TestGetBadUid(c *check.C) {
-	pid, uid, _, err := ucrednetGet("pid=100;uid=4294967296;socket=;")
+	pid, uid, _, err := UcrednetGet("pid=100;uid=4294967296;socket=;")
 	c.Check(err, check.NotNil)
 	c.Check(pid, check.Equals, int32(100))
 	c.Check(uid, check.Equals, ucrednetNobody)
 }
 
 func (s *ucrednetSuite) TestGetNonUcrednet(c *check.C) {
-	pid, uid, _, err := ucrednetGet("hello")
-	c.Check(err, check.Equals, errNoID)
+	pid, uid, _, err := UcrednetGet("hello")
+	c.Check(err, check.Equals, ErrNoID)
 	c.Check(pid, check.Equals, ucrednetNoProcess)
 	c.Check(uid, check.Equals, ucrednetNobody)
 }
 
 func (s *ucrednetSuite) TestGetNothing(c *check.C) {
-	pid, uid, _, err := ucrednetGet("")
-	c.Check(err, check.Equals, errNoID)
+	pid, uid, _, err := UcrednetGet("")
+	c.Check(err, check.Equals, ErrNoID)
 	c.Check(pid, check.Equals, ucrednetNoProcess)
 	c.Check(uid, check.Equals, ucrednetNobody)
 }
 
 func (s *ucrednetSuite) TestGet(c *check.C) {
-	pid, uid, socket, err := ucrednetGet("pid=100;uid=42;socket=/run/snap.socket;")
+	pid, uid, socket, err := UcrednetGet("pid=100;uid=42;socket=/run/snap.socket;")
 	c.Check(err, check.IsNil)
 	c.Check(pid, check.Equals, int32(100))
 	c.Check(uid, check.Equals, uint32(42))
@@ -193,8 +196,8 @@ func (s *ucrednetSuite) TestGet(c *check.C) {
 }
 
 func (s *ucrednetSuite) TestGetSneak(c *check.C) {
-	pid, uid, socket, err := ucrednetGet("pid=100;uid=42;socket=/run/snap.socket;pid=0;uid=0;socket=/tmp/my.socket")
-	c.Check(err, check.Equals, errNoID)
+	pid, uid, socket, err := UcrednetGet("pid=100;uid=42;socket=/run/snap.socket;pid=0;uid=0;socket=/tmp/my.socket")
+	c.Check(err, check.Equals, ErrNoID)
 	c.Check(pid, check.Equals, ucrednetNoProcess)
 	c.Check(uid, check.Equals, ucrednetNobody)
 	c.Check(socket, check.Equals, "")
@@ -80,6 +80,12 @@ func DB(s *state.State) asserts.RODatabase {
 	return cachedDB(s)
 }
 
+// TemporaryDB returns a temporary database stacked on top of the system
+// assertion database. Writing to it does not affect the system database.
+func TemporaryDB(s *state.State) *asserts.Database {
+	return cachedDB(s).WithStackedBackstore(asserts.NewMemoryBackstore())
+}
+
 // doValidateSnap fetches the relevant assertions for the snap being installed and cross checks them with the snap.
 func doValidateSnap(t *state.Task, _ *tomb.Tomb) error {
 	st := t.State()
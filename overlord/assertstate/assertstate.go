@@ -318,9 +318,14 @@ func delayedCrossMgrInit() {
 	snapstate.AutoRefreshAssertions = AutoRefreshAssertions
 	// hook retrieving auto-aliases into snapstate logic
 	snapstate.AutoAliases = AutoAliases
+	// hook enforcement of validation sets into snapstate logic
+	snapstate.EnforcedValidationSets = EnforcedValidationSets
 }
 
 // AutoRefreshAssertions tries to refresh all assertions
 func AutoRefreshAssertions(s *state.State, userID int) error {
-	return RefreshSnapDeclarations(s, userID)
+	if err := RefreshSnapDeclarations(s, userID); err != nil {
+		return err
+	}
+	return RefreshValidationSetAssertions(s, userID)
 }
@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 
@@ -93,6 +94,30 @@ func (sto *fakeStore) Assertion(assertType *asserts.AssertionType, key []string,
 	return ref.Resolve(sto.db.Find)
 }
 
+func (sto *fakeStore) SeqFormingAssertion(assertType *asserts.AssertionType, sequenceKey []string, sequence int, _ *auth.UserState) (asserts.Assertion, error) {
+	sto.pokeStateLock()
+
+	headers := make(map[string]string, len(sequenceKey)+1)
+	for i, k := range assertType.PrimaryKey[:len(sequenceKey)] {
+		headers[k] = sequenceKey[i]
+	}
+	if sequence > 0 {
+		headers["sequence"] = strconv.Itoa(sequence)
+		return sto.db.Find(assertType, headers)
+	}
+	as, err := sto.db.FindMany(assertType, headers)
+	if err != nil {
+		return nil, err
+	}
+	var latest asserts.Assertion
+	for _, a := range as {
+		if latest == nil || a.(*asserts.ValidationSet).Sequence() > latest.(*asserts.ValidationSet).Sequence() {
+			latest = a
+		}
+	}
+	return latest, nil
+}
+
 var (
 	dev1PrivKey, _ = assertstest.GenerateKey(752)
 )
@@ -142,6 +167,25 @@ func (s *assertMgrSuite) TestDB(c *C) {
 	c.Check(db, FitsTypeOf, (*asserts.Database)(nil))
 }
 
+func (s *assertMgrSuite) TestTemporaryDB(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	err := assertstate.Add(s.state, s.storeSigning.StoreAccountKey(""))
+	c.Assert(err, IsNil)
+
+	tmpDB := assertstate.TemporaryDB(s.state)
+	err = tmpDB.Add(s.dev1Acct)
+	c.Assert(err, IsNil)
+
+	headers := map[string]string{"account-id": s.dev1Acct.AccountID()}
+	_, err = tmpDB.Find(asserts.AccountType, headers)
+	c.Check(err, IsNil)
+	// the system database is unchanged
+	_, err = assertstate.DB(s.state).Find(asserts.AccountType, headers)
+	c.Check(asserts.IsNotFound(err), Equals, true)
+}
+
 func (s *assertMgrSuite) TestAdd(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -1582,3 +1626,172 @@ func (s *assertMgrSuite) TestStore(c *C) {
 	c.Assert(err, IsNil)
 	c.Check(store.Store(), Equals, "foo")
 }
+
+func (s *assertMgrSuite) validationSet(c *C, name string, sequence int, snaps ...interface{}) *asserts.ValidationSet {
+	headers := map[string]interface{}{
+		"authority-id": s.dev1Acct.AccountID(),
+		"series":       "16",
+		"account-id":   s.dev1Acct.AccountID(),
+		"name":         name,
+		"sequence":     strconv.Itoa(sequence),
+		"snaps":        snaps,
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}
+	a, err := s.dev1Signing.Sign(asserts.ValidationSetType, headers, nil, "")
+	c.Assert(err, IsNil)
+	return a.(*asserts.ValidationSet)
+}
+
+func (s *assertMgrSuite) addValidationSetsToStore(c *C) {
+	fooRequired := map[string]interface{}{
+		"name":     "foo",
+		"id":       "qOqKhntON3vR7kwEbVPsILm7bUViPDzz",
+		"revision": "7",
+	}
+	barInvalid := map[string]interface{}{
+		"name":     "bar",
+		"id":       "ididididididididididididididbar1",
+		"presence": "invalid",
+	}
+	dev1AcctKey := assertstest.NewAccountKey(s.storeSigning, s.dev1Acct, nil, dev1PrivKey.PublicKey(), "")
+	err := s.storeSigning.Add(dev1AcctKey)
+	if err != nil && !asserts.IsUnaccceptedUpdate(err) {
+		c.Assert(err, IsNil)
+	}
+	c.Assert(s.storeSigning.Add(s.validationSet(c, "my-set", 1, fooRequired)), IsNil)
+	c.Assert(s.storeSigning.Add(s.validationSet(c, "my-set", 2, fooRequired, barInvalid)), IsNil)
+}
+
+func (s *assertMgrSuite) mockInstalledSnap(name, snapID string, rev snap.Revision) {
+	snapstate.Set(s.state, name, &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: name, SnapID: snapID, Revision: rev},
+		},
+		Current: rev,
+	})
+}
+
+func (s *assertMgrSuite) TestApplyValidationSetMonitorLatest(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setModel(sysdb.GenericClassicModel())
+	s.addValidationSetsToStore(c)
+
+	tr, err := assertstate.ApplyValidationSet(s.state, s.dev1Acct.AccountID(), "my-set", 0, snapstate.Monitor, 0)
+	c.Assert(err, IsNil)
+	c.Check(tr, DeepEquals, &snapstate.ValidationSetTracking{
+		AccountID: s.dev1Acct.AccountID(),
+		Name:      "my-set",
+		Mode:      snapstate.Monitor,
+		Current:   2,
+	})
+
+	var stored snapstate.ValidationSetTracking
+	c.Assert(snapstate.GetValidationSet(s.state, s.dev1Acct.AccountID(), "my-set", &stored), IsNil)
+	c.Check(&stored, DeepEquals, tr)
+
+	vs, err := assertstate.ValidationSet(s.state, s.dev1Acct.AccountID(), "my-set", 0)
+	c.Assert(err, IsNil)
+	c.Check(vs.Sequence(), Equals, 2)
+
+	// not enforced
+	vsets, err := assertstate.EnforcedValidationSets(s.state)
+	c.Assert(err, IsNil)
+	c.Check(vsets, HasLen, 0)
+}
+
+func (s *assertMgrSuite) TestApplyValidationSetEnforcePinned(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setModel(sysdb.GenericClassicModel())
+	s.addValidationSetsToStore(c)
+	s.mockInstalledSnap("foo", "qOqKhntON3vR7kwEbVPsILm7bUViPDzz", snap.R(7))
+
+	tr, err := assertstate.ApplyValidationSet(s.state, s.dev1Acct.AccountID(), "my-set", 1, snapstate.Enforce, 0)
+	c.Assert(err, IsNil)
+	c.Check(tr, DeepEquals, &snapstate.ValidationSetTracking{
+		AccountID: s.dev1Acct.AccountID(),
+		Name:      "my-set",
+		Mode:      snapstate.Enforce,
+		PinnedAt:  1,
+		Current:   1,
+	})
+
+	vsets, err := assertstate.EnforcedValidationSets(s.state)
+	c.Assert(err, IsNil)
+	c.Assert(vsets, HasLen, 1)
+	c.Check(vsets[0].Name(), Equals, "my-set")
+	c.Check(vsets[0].Sequence(), Equals, 1)
+
+	// pinned sets are not refreshed
+	c.Assert(assertstate.RefreshValidationSetAssertions(s.state, 0), IsNil)
+	var stored snapstate.ValidationSetTracking
+	c.Assert(snapstate.GetValidationSet(s.state, s.dev1Acct.AccountID(), "my-set", &stored), IsNil)
+	c.Check(stored.Current, Equals, 1)
+}
+
+func (s *assertMgrSuite) TestApplyValidationSetEnforceNotSatisfied(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setModel(sysdb.GenericClassicModel())
+	s.addValidationSetsToStore(c)
+	s.mockInstalledSnap("foo", "qOqKhntON3vR7kwEbVPsILm7bUViPDzz", snap.R(3))
+	s.mockInstalledSnap("bar", "ididididididididididididididbar1", snap.R(1))
+
+	_, err := assertstate.ApplyValidationSet(s.state, s.dev1Acct.AccountID(), "my-set", 0, snapstate.Enforce, 0)
+	c.Assert(err, ErrorMatches, `cannot enforce validation set: validation set .*/my-set \(sequence 2\) is not satisfied:
+- invalid snap "bar" is installed
+- snap "foo" is not at required revision 7`)
+
+	var stored snapstate.ValidationSetTracking
+	c.Check(snapstate.GetValidationSet(s.state, s.dev1Acct.AccountID(), "my-set", &stored), Equals, state.ErrNoState)
+}
+
+func (s *assertMgrSuite) TestApplyValidationSetNotFound(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setModel(sysdb.GenericClassicModel())
+	s.addValidationSetsToStore(c)
+
+	_, err := assertstate.ApplyValidationSet(s.state, s.dev1Acct.AccountID(), "my-set", 3, snapstate.Monitor, 0)
+	c.Assert(err, ErrorMatches, `validation-set \(3; series:16 account-id:.* name:my-set\) not found`)
+}
+
+func (s *assertMgrSuite) TestRefreshValidationSetAssertions(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setModel(sysdb.GenericClassicModel())
+	s.addValidationSetsToStore(c)
+	s.mockInstalledSnap("foo", "qOqKhntON3vR7kwEbVPsILm7bUViPDzz", snap.R(7))
+	s.mockInstalledSnap("bar", "ididididididididididididididbar1", snap.R(1))
+
+	// applied when only sequence 1 was around
+	for _, name := range []string{"my-set", "other-set"} {
+		snapstate.UpdateValidationSet(s.state, &snapstate.ValidationSetTracking{
+			AccountID: s.dev1Acct.AccountID(),
+			Name:      name,
+			Mode:      snapstate.Enforce,
+			Current:   1,
+		})
+	}
+	c.Assert(s.storeSigning.Add(s.validationSet(c, "other-set", 2, map[string]interface{}{
+		"name": "foo",
+		"id":   "qOqKhntON3vR7kwEbVPsILm7bUViPDzz",
+	})), IsNil)
+
+	err := assertstate.RefreshValidationSetAssertions(s.state, 0)
+	c.Assert(err, IsNil)
+
+	// sequence 2 of my-set is not satisfied, it stays at 1
+	var tr snapstate.ValidationSetTracking
+	c.Assert(snapstate.GetValidationSet(s.state, s.dev1Acct.AccountID(), "my-set", &tr), IsNil)
+	c.Check(tr.Current, Equals, 1)
+	c.Assert(snapstate.GetValidationSet(s.state, s.dev1Acct.AccountID(), "other-set", &tr), IsNil)
+	c.Check(tr.Current, Equals, 2)
+}
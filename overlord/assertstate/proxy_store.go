@@ -0,0 +1,140 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package assertstate
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/httputil"
+	"github.com/snapcore/snapd/overlord/configstate/proxyconf"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+// proxyStoreAssertionsPath is where a snap store proxy serves its store
+// assertion together with its prerequisites.
+const proxyStoreAssertionsPath = "/v2/auth/store/assertions"
+
+func proxyStoreAssertions(st *state.State, proxyURL *url.URL) ([]asserts.Assertion, error) {
+	u := *proxyURL
+	u.Path = path.Join(u.Path, proxyStoreAssertionsPath)
+
+	cli := httputil.NewHTTPClient(&httputil.ClientOptions{
+		Timeout: 30 * time.Second,
+		Proxy:   proxyconf.New(st).Conf,
+		ExtraSSLCerts: &httputil.ExtraSSLCertsFromDir{
+			Dir: dirs.SnapdStoreSSLCertsDir,
+		},
+	})
+	resp, err := cli.Get(u.String())
+	if err != nil {
+		return nil, &ProxyStoreUnreachableError{URL: proxyURL, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, u.String())
+	}
+
+	var as []asserts.Assertion
+	dec := asserts.NewDecoder(resp.Body)
+	for {
+		a, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		as = append(as, a)
+	}
+	return as, nil
+}
+
+// ProxyStoreUnreachableError is returned when the snap store proxy
+// cannot be reached.
+type ProxyStoreUnreachableError struct {
+	URL *url.URL
+	Err error
+}
+
+func (e *ProxyStoreUnreachableError) Error() string {
+	return fmt.Sprintf("cannot reach snap store proxy at %s: %v", e.URL, e.Err)
+}
+
+// FetchProxyStore fetches the store assertion served by the snap store
+// proxy at proxyURL and adds it, once verified, together with its
+// prerequisites to the system assertion database. Prerequisites not
+// served by the proxy are fetched from the store.
+func FetchProxyStore(s *state.State, proxyURL *url.URL) (*asserts.Store, error) {
+	s.Unlock()
+	served, err := proxyStoreAssertions(s, proxyURL)
+	s.Lock()
+	if _, ok := err.(*ProxyStoreUnreachableError); ok {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot get store assertion from proxy: %v", err)
+	}
+
+	var storeAs *asserts.Store
+	byRef := make(map[string]asserts.Assertion, len(served))
+	for _, a := range served {
+		if sto, ok := a.(*asserts.Store); ok {
+			if storeAs != nil {
+				return nil, fmt.Errorf("cannot use proxy serving more than one store assertion")
+			}
+			storeAs = sto
+		}
+		byRef[a.Ref().Unique()] = a
+	}
+	if storeAs == nil {
+		return nil, fmt.Errorf("cannot find store assertion served by proxy")
+	}
+
+	db := cachedDB(s)
+	sto := snapstate.Store(s, nil)
+	retrieve := func(ref *asserts.Ref) (asserts.Assertion, error) {
+		if a, ok := byRef[ref.Unique()]; ok {
+			return a, nil
+		}
+		return sto.Assertion(ref.Type, ref.PrimaryKey, nil)
+	}
+	fetching := func(f asserts.Fetcher) error {
+		return f.Save(storeAs)
+	}
+
+	b := asserts.NewBatch(nil)
+	s.Unlock()
+	err = b.Fetch(db, retrieve, fetching)
+	s.Lock()
+	if err == nil {
+		err = b.CommitTo(db, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot verify store assertion served by proxy: %v", err)
+	}
+	return storeAs, nil
+}
@@ -0,0 +1,145 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package assertstate_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+)
+
+func (s *assertMgrSuite) mockStoreProxy(c *C, served ...asserts.Assertion) *url.URL {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/v2/auth/store/assertions")
+		w.Header().Set("Content-Type", asserts.MediaType)
+		enc := asserts.NewEncoder(w)
+		for _, a := range served {
+			c.Assert(enc.Encode(a), IsNil)
+		}
+	}))
+	s.AddCleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	c.Assert(err, IsNil)
+	return u
+}
+
+func (s *assertMgrSuite) proxyStoreAssertion(c *C) *asserts.Store {
+	storeHeaders := map[string]interface{}{
+		"store":       "my-proxy-store",
+		"operator-id": s.dev1Acct.AccountID(),
+		"url":         "https://proxy.example.com",
+		"timestamp":   time.Now().Format(time.RFC3339),
+	}
+	a, err := s.storeSigning.Sign(asserts.StoreType, storeHeaders, nil, "")
+	c.Assert(err, IsNil)
+	return a.(*asserts.Store)
+}
+
+func (s *assertMgrSuite) TestFetchProxyStore(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	snapstate.ReplaceStore(s.state, s.fakeStore)
+
+	storeAs := s.proxyStoreAssertion(c)
+	// the proxy serves the store and its operator account, the
+	// signing key comes from the store
+	proxyURL := s.mockStoreProxy(c, storeAs, s.dev1Acct)
+
+	fetched, err := assertstate.FetchProxyStore(s.state, proxyURL)
+	c.Assert(err, IsNil)
+	c.Check(fetched.Store(), Equals, "my-proxy-store")
+
+	stored, err := assertstate.Store(s.state, "my-proxy-store")
+	c.Assert(err, IsNil)
+	c.Check(stored.URL().String(), Equals, "https://proxy.example.com")
+}
+
+func (s *assertMgrSuite) TestFetchProxyStoreNoStoreAssertion(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	snapstate.ReplaceStore(s.state, s.fakeStore)
+
+	proxyURL := s.mockStoreProxy(c, s.dev1Acct)
+
+	_, err := assertstate.FetchProxyStore(s.state, proxyURL)
+	c.Assert(err, ErrorMatches, "cannot find store assertion served by proxy")
+}
+
+func (s *assertMgrSuite) TestFetchProxyStoreUnverified(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	snapstate.ReplaceStore(s.state, s.fakeStore)
+
+	// signed by a developer instead of the store
+	storeHeaders := map[string]interface{}{
+		"authority-id": s.dev1Acct.AccountID(),
+		"store":        "my-proxy-store",
+		"operator-id":  s.dev1Acct.AccountID(),
+		"url":          "https://proxy.example.com",
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}
+	storeAs, err := s.dev1Signing.Sign(asserts.StoreType, storeHeaders, nil, "")
+	c.Assert(err, IsNil)
+	proxyURL := s.mockStoreProxy(c, storeAs, s.dev1Acct)
+
+	_, err = assertstate.FetchProxyStore(s.state, proxyURL)
+	c.Assert(err, ErrorMatches, `(?s)cannot verify store assertion served by proxy: .* is not signed by a directly trusted authority.*`)
+
+	_, err = assertstate.Store(s.state, "my-proxy-store")
+	c.Check(asserts.IsNotFound(err), Equals, true)
+}
+
+func (s *assertMgrSuite) TestFetchProxyStoreHTTPError(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	}))
+	defer srv.Close()
+	proxyURL, err := url.Parse(srv.URL)
+	c.Assert(err, IsNil)
+
+	_, err = assertstate.FetchProxyStore(s.state, proxyURL)
+	c.Assert(err, ErrorMatches, `cannot get store assertion from proxy: unexpected status code 404 from http://.*/v2/auth/store/assertions`)
+}
+
+func (s *assertMgrSuite) TestFetchProxyStoreUnreachable(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	proxyURL, err := url.Parse(srv.URL)
+	c.Assert(err, IsNil)
+	// nothing is listening anymore
+	srv.Close()
+
+	_, err = assertstate.FetchProxyStore(s.state, proxyURL)
+	c.Assert(err, ErrorMatches, `cannot reach snap store proxy at http://.*: .*`)
+	c.Check(err, FitsTypeOf, &assertstate.ProxyStoreUnreachableError{})
+}
@@ -0,0 +1,196 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package assertstate
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+// ValidationSet returns the validation-set assertion of the given
+// account with the given name at the given sequence point, or the
+// latest one present in the system assertion database if sequence is
+// 0.
+func ValidationSet(s *state.State, accountID, name string, sequence int) (*asserts.ValidationSet, error) {
+	db := DB(s)
+	seqKey := snapstate.ValidationSetSequenceKey(accountID, name)
+	headers := map[string]string{
+		"series":     seqKey[0],
+		"account-id": accountID,
+		"name":       name,
+	}
+	if sequence > 0 {
+		headers["sequence"] = strconv.Itoa(sequence)
+		a, err := db.Find(asserts.ValidationSetType, headers)
+		if err != nil {
+			return nil, err
+		}
+		return a.(*asserts.ValidationSet), nil
+	}
+
+	as, err := db.FindMany(asserts.ValidationSetType, headers)
+	if err != nil {
+		return nil, err
+	}
+	var latest *asserts.ValidationSet
+	for _, a := range as {
+		vs := a.(*asserts.ValidationSet)
+		if latest == nil || vs.Sequence() > latest.Sequence() {
+			latest = vs
+		}
+	}
+	return latest, nil
+}
+
+// fetchValidationSet fetches from the store the validation-set
+// assertion of the given account with the given name at the given
+// sequence point, or the latest one if sequence is 0, together with
+// its prerequisites.
+func fetchValidationSet(s *state.State, accountID, name string, sequence int, userID int) (*asserts.ValidationSet, error) {
+	deviceCtx, err := snapstate.DevicePastSeeding(s, nil)
+	if err != nil {
+		return nil, err
+	}
+	user, err := userFromUserID(s, userID)
+	if err != nil {
+		return nil, err
+	}
+	sto := snapstate.Store(s, deviceCtx)
+
+	seqKey := snapstate.ValidationSetSequenceKey(accountID, name)
+	var fetched *asserts.ValidationSet
+	fetching := func(f asserts.Fetcher) error {
+		a, err := sto.SeqFormingAssertion(asserts.ValidationSetType, seqKey, sequence, user)
+		if err != nil {
+			return err
+		}
+		vs, ok := a.(*asserts.ValidationSet)
+		if !ok {
+			return fmt.Errorf("internal error: unexpected %q assertion instead of validation set", a.Type().Name)
+		}
+		fetched = vs
+		return f.Save(vs)
+	}
+	if err := doFetch(s, userID, deviceCtx, fetching); err != nil {
+		return nil, err
+	}
+	return fetched, nil
+}
+
+// ApplyValidationSet fetches the validation-set assertion of the given
+// account with the given name, at the given sequence point or the
+// latest one if sequence is 0, and applies it to the system in the
+// given mode. In enforce mode the installed snaps must already satisfy
+// the validation set.
+func ApplyValidationSet(s *state.State, accountID, name string, sequence int, mode snapstate.ValidationSetMode, userID int) (*snapstate.ValidationSetTracking, error) {
+	vs, err := fetchValidationSet(s, accountID, name, sequence, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode == snapstate.Enforce {
+		if err := snapstate.CheckValidationSet(s, vs); err != nil {
+			return nil, fmt.Errorf("cannot enforce validation set: %v", err)
+		}
+	}
+
+	tr := &snapstate.ValidationSetTracking{
+		AccountID: accountID,
+		Name:      name,
+		Mode:      mode,
+		PinnedAt:  sequence,
+		Current:   vs.Sequence(),
+	}
+	snapstate.UpdateValidationSet(s, tr)
+	return tr, nil
+}
+
+// RefreshValidationSetAssertions fetches the latest validation-set
+// assertions of the applied validation sets that are not pinned to a
+// sequence point, and moves to them. Validation sets applied in
+// enforce mode are only moved if the installed snaps satisfy the new
+// sequence point.
+func RefreshValidationSetAssertions(s *state.State, userID int) error {
+	vsets, err := snapstate.ValidationSets(s)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(vsets))
+	for key := range vsets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		tr := vsets[key]
+		if tr.PinnedAt > 0 {
+			continue
+		}
+		vs, err := fetchValidationSet(s, tr.AccountID, tr.Name, 0, userID)
+		if err != nil {
+			return fmt.Errorf("cannot refresh validation set %s: %v", key, err)
+		}
+		if vs.Sequence() == tr.Current {
+			continue
+		}
+		if tr.Mode == snapstate.Enforce {
+			if err := snapstate.CheckValidationSet(s, vs); err != nil {
+				logger.Noticef("Cannot move enforced validation set %s to sequence %d: %v", key, vs.Sequence(), err)
+				continue
+			}
+		}
+		tr.Current = vs.Sequence()
+		snapstate.UpdateValidationSet(s, tr)
+	}
+	return nil
+}
+
+// EnforcedValidationSets returns the validation-set assertions of the
+// validation sets applied in enforce mode.
+func EnforcedValidationSets(s *state.State) ([]*asserts.ValidationSet, error) {
+	vsets, err := snapstate.ValidationSets(s)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(vsets))
+	for key, tr := range vsets {
+		if tr.Mode == snapstate.Enforce {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	res := make([]*asserts.ValidationSet, 0, len(keys))
+	for _, key := range keys {
+		tr := vsets[key]
+		vs, err := ValidationSet(s, tr.AccountID, tr.Name, tr.Current)
+		if err != nil {
+			return nil, fmt.Errorf("internal error: cannot find assertion for enforced validation set %s: %v", key, err)
+		}
+		res = append(res, vs)
+	}
+	return res, nil
+}
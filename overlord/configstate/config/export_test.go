@@ -28,3 +28,11 @@ var PurgeNulls = purgeNulls
 func (t *Transaction) PristineConfig() map[string]map[string]*json.RawMessage {
 	return t.pristine
 }
+
+func MockExternalConfig(m map[string]map[string]ExternalCfgFunc) (restore func()) {
+	old := externalConfig
+	externalConfig = m
+	return func() {
+		externalConfig = old
+	}
+}
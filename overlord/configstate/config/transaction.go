@@ -31,6 +31,30 @@ import (
 	"github.com/snapcore/snapd/overlord/state"
 )
 
+// ExternalCfgFunc returns the value of the given configuration option as
+// currently used by the system, or nil if it cannot tell.
+type ExternalCfgFunc func(key string) (interface{}, error)
+
+var externalConfig = make(map[string]map[string]ExternalCfgFunc)
+
+// RegisterExternalConfig registers getter as the source of the value of the
+// given configuration option of the given snap. Getting the option, or any
+// of its parents, from a transaction returns the value read from the system
+// unless the transaction itself changes it.
+func RegisterExternalConfig(snapName, key string, getter ExternalCfgFunc) error {
+	if _, err := ParseKey(key); err != nil {
+		return err
+	}
+	if externalConfig[snapName] == nil {
+		externalConfig[snapName] = make(map[string]ExternalCfgFunc)
+	}
+	if _, ok := externalConfig[snapName][key]; ok {
+		return fmt.Errorf("cannot register external config for snap %q option %q: already registered", snapName, key)
+	}
+	externalConfig[snapName][key] = getter
+	return nil
+}
+
 // Transaction holds a copy of the configuration originally present in the
 // provided state which can be queried and mutated in isolation from
 // concurrent logic. All changes performed into it are persisted back into
@@ -177,11 +201,63 @@ func (t *Transaction) Get(snapName, key string, result interface{}) error {
 	// commit changes onto a copy of pristine configuration, so that get has a complete view of the config.
 	config := t.copyPristine(snapName)
 	applyChanges(config, t.changes[snapName])
+	if err := t.applyExternalConfig(snapName, key, config); err != nil {
+		return err
+	}
 
 	purgeNulls(config)
 	return getFromConfig(snapName, subkeys, 0, config, result)
 }
 
+// applyExternalConfig overrides in config the values of the external
+// options at or below the given key with the ones read from the system,
+// unless the transaction changes them.
+func (t *Transaction) applyExternalConfig(snapName, key string, config map[string]*json.RawMessage) error {
+	external := make(map[string]interface{})
+	for extKey, getter := range externalConfig[snapName] {
+		if key != "" && extKey != key && !strings.HasPrefix(extKey, key+".") {
+			continue
+		}
+		subkeys, err := ParseKey(extKey)
+		if err != nil {
+			return err
+		}
+		if isChanged(t.changes[snapName], subkeys) {
+			continue
+		}
+		value, err := getter(extKey)
+		if err != nil {
+			return fmt.Errorf("cannot get snap %q option %q from the system: %v", snapName, extKey, err)
+		}
+		if value == nil {
+			continue
+		}
+		if _, err := PatchConfig(snapName, subkeys, 0, external, jsonRaw(value)); err != nil {
+			return err
+		}
+	}
+	applyChanges(config, external)
+	return nil
+}
+
+// isChanged returns whether the given changes set the option with the given
+// subkeys or any of its parents.
+func isChanged(changes map[string]interface{}, subkeys []string) bool {
+	var change interface{} = changes
+	for _, subkey := range subkeys {
+		changem, ok := change.(map[string]interface{})
+		if !ok {
+			// a parent is replaced as a whole
+			return true
+		}
+		change, ok = changem[subkey]
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
 // GetMaybe unmarshals into result the cached value of the provided snap's configuration key.
 // If the key does not exist, no error is returned.
 //
@@ -490,3 +490,72 @@ func (s *transactionSuite) TestPristineIsNotTainted(c *C) {
 	c.Assert(json.Unmarshal([]byte(*pristine["test-snap"]["foo"]), &data), IsNil)
 	c.Assert(data, DeepEquals, map[string]interface{}{"a": map[string]interface{}{"a": "a"}})
 }
+
+func (s *transactionSuite) TestGetExternalConfig(c *C) {
+	restore := config.MockExternalConfig(make(map[string]map[string]config.ExternalCfgFunc))
+	defer restore()
+
+	current := "from-system"
+	err := config.RegisterExternalConfig("test-snap", "a.b", func(key string) (interface{}, error) {
+		c.Check(key, Equals, "a.b")
+		return current, nil
+	})
+	c.Assert(err, IsNil)
+	err = config.RegisterExternalConfig("test-snap", "a.b", nil)
+	c.Assert(err, ErrorMatches, `cannot register external config for snap "test-snap" option "a.b": already registered`)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Assert(s.transaction.Set("test-snap", "a.c", "c"), IsNil)
+	s.transaction.Commit()
+
+	tr := config.NewTransaction(s.state)
+	var value string
+	c.Assert(tr.Get("test-snap", "a.b", &value), IsNil)
+	c.Check(value, Equals, "from-system")
+	var parent map[string]interface{}
+	c.Assert(tr.Get("test-snap", "a", &parent), IsNil)
+	c.Check(parent, DeepEquals, map[string]interface{}{"b": "from-system", "c": "c"})
+
+	// the system value is read on every get
+	current = "changed"
+	c.Assert(tr.Get("test-snap", "a.b", &value), IsNil)
+	c.Check(value, Equals, "changed")
+
+	// unless the transaction changes the option
+	c.Assert(tr.Set("test-snap", "a.b", "from-transaction"), IsNil)
+	c.Assert(tr.Get("test-snap", "a.b", &value), IsNil)
+	c.Check(value, Equals, "from-transaction")
+
+	// or one of its parents
+	tr = config.NewTransaction(s.state)
+	c.Assert(tr.Set("test-snap", "a", map[string]interface{}{"b": "parent"}), IsNil)
+	c.Assert(tr.Get("test-snap", "a.b", &value), IsNil)
+	c.Check(value, Equals, "parent")
+
+	// the system value is not committed
+	tr = config.NewTransaction(s.state)
+	c.Assert(tr.Get("test-snap", "a.b", &value), IsNil)
+	tr.Commit()
+	var pristine map[string]map[string]interface{}
+	c.Assert(s.state.Get("config", &pristine), IsNil)
+	c.Check(pristine["test-snap"], DeepEquals, map[string]interface{}{"a": map[string]interface{}{"c": "c"}})
+}
+
+func (s *transactionSuite) TestGetExternalConfigError(c *C) {
+	restore := config.MockExternalConfig(map[string]map[string]config.ExternalCfgFunc{
+		"test-snap": {
+			"a": func(key string) (interface{}, error) {
+				return nil, fmt.Errorf("boom")
+			},
+		},
+	})
+	defer restore()
+
+	var value interface{}
+	err := s.transaction.Get("test-snap", "a", &value)
+	c.Assert(err, ErrorMatches, `cannot get snap "test-snap" option "a" from the system: boom`)
+	// unrelated options are not affected
+	err = s.transaction.Get("test-snap", "other", &value)
+	c.Assert(config.IsNoOption(err), Equals, true)
+}
@@ -0,0 +1,176 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+)
+
+// store-certs.<name> options are not listed in supportedConfigurations,
+// any name matching validCertName can be used.
+const certOptionPrefix = "core.store-certs."
+
+var validCertName = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+func validCertOption(option string) bool {
+	if option == "core.store-certs" {
+		return true
+	}
+	if !strings.HasPrefix(option, certOptionPrefix) {
+		return false
+	}
+	return validCertName.MatchString(strings.TrimPrefix(option, certOptionPrefix))
+}
+
+var timeNow = time.Now
+
+// parseCerts parses the PEM encoded certificates
+func parseCerts(data string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected %q block", block.Type)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found")
+	}
+	if len(strings.TrimSpace(string(rest))) > 0 {
+		return nil, fmt.Errorf("unexpected data after the certificates")
+	}
+	return certs, nil
+}
+
+func validateCertSettings(tr config.Conf) error {
+	changed := false
+	for _, option := range tr.Changes() {
+		if option == "core.store-certs" || strings.HasPrefix(option, certOptionPrefix) {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	// the whole map is validated as it can be set at once
+	var certsCfg interface{}
+	if err := tr.Get("core", "store-certs", &certsCfg); err != nil && !config.IsNoOption(err) {
+		return err
+	}
+	if certsCfg == nil {
+		return nil
+	}
+	certsMap, ok := certsCfg.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("cannot set store certificates: store-certs must be a map of certificates")
+	}
+	for name, v := range certsMap {
+		if !validCertName.MatchString(name) {
+			return fmt.Errorf("cannot set store certificate %q: name not valid", name)
+		}
+		// reset is fine
+		if v == nil {
+			continue
+		}
+		cert, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("cannot set store certificate %q: certificate must be a string", name)
+		}
+		if cert == "" {
+			continue
+		}
+		if _, err := parseCerts(cert); err != nil {
+			return fmt.Errorf("cannot decode pem certificate %q: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func handleCertConfiguration(tr config.Conf) error {
+	var certsCfg map[string]interface{}
+	if err := tr.Get("core", "store-certs", &certsCfg); err != nil && !config.IsNoOption(err) {
+		return err
+	}
+
+	dirContent := make(map[string]*osutil.FileState, len(certsCfg))
+	var expired []string
+	for name, v := range certsCfg {
+		cert, ok := v.(string)
+		if !ok || cert == "" {
+			continue
+		}
+		certs, err := parseCerts(cert)
+		if err != nil {
+			return fmt.Errorf("cannot decode pem certificate %q: %v", name, err)
+		}
+		for _, c := range certs {
+			if timeNow().After(c.NotAfter) {
+				expired = append(expired, name)
+				break
+			}
+		}
+		dirContent[name+".pem"] = &osutil.FileState{
+			Content: []byte(cert),
+			Mode:    0644,
+		}
+	}
+
+	dir := dirs.SnapdStoreSSLCertsDir
+	if len(dirContent) > 0 {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	if _, _, err := osutil.EnsureDirState(dir, "*.pem", dirContent); err != nil {
+		return err
+	}
+
+	if len(expired) > 0 {
+		st := tr.State()
+		st.Lock()
+		defer st.Unlock()
+		for _, name := range expired {
+			st.Warnf("store certificate %q has expired", name)
+		}
+	}
+	return nil
+}
@@ -65,7 +65,7 @@ func validateBoolFlag(tr config.Conf, flag string) error {
 func Run(tr config.Conf) error {
 	// check if the changes
 	for _, k := range tr.Changes() {
-		if !supportedConfigurations[k] {
+		if !supportedConfigurations[k] && !validCertOption(k) {
 			return fmt.Errorf("cannot set %q: unsupported system option", k)
 		}
 	}
@@ -91,6 +91,33 @@ func Run(tr config.Conf) error {
 	if err := validateAutomaticSnapshotsExpiration(tr); err != nil {
 		return err
 	}
+	if err := validateSnapshotsChunked(tr); err != nil {
+		return err
+	}
+	if err := validateSnapshotsSchedule(tr); err != nil {
+		return err
+	}
+	if err := validateHostnameSettings(tr); err != nil {
+		return err
+	}
+	if err := validateTimezoneSettings(tr); err != nil {
+		return err
+	}
+	if err := validateNTPServers(tr); err != nil {
+		return err
+	}
+	if err := validateJournalSettings(tr); err != nil {
+		return err
+	}
+	if err := validateSysctlSettings(tr); err != nil {
+		return err
+	}
+	if err := validateCertSettings(tr); err != nil {
+		return err
+	}
+	if err := validateStoreCacheSettings(tr); err != nil {
+		return err
+	}
 	// FIXME: ensure the user cannot set "core seed.loaded"
 
 	// capture cloud information
@@ -103,6 +130,11 @@ func Run(tr config.Conf) error {
 		return err
 	}
 
+	// store-certs.*, also used on classic
+	if err := handleCertConfiguration(tr); err != nil {
+		return err
+	}
+
 	// see if it makes sense to run at all
 	if release.OnClassic {
 		// nothing to do
@@ -136,6 +168,26 @@ func Run(tr config.Conf) error {
 	if err := handleNetworkConfiguration(tr); err != nil {
 		return err
 	}
+	// system.hostname
+	if err := handleHostnameConfiguration(tr); err != nil {
+		return err
+	}
+	// system.timezone
+	if err := handleTimezoneConfiguration(tr); err != nil {
+		return err
+	}
+	// system.time.ntp-servers
+	if err := handleNTPConfiguration(tr); err != nil {
+		return err
+	}
+	// system.journal.{persistent,max-size}
+	if err := handleJournalConfiguration(tr); err != nil {
+		return err
+	}
+	// system.kernel.printk.console-loglevel
+	if err := handleSysctlConfiguration(tr); err != nil {
+		return err
+	}
 
 	return nil
 }
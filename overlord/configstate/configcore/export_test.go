@@ -19,9 +19,21 @@
 
 package configcore
 
+import (
+	"time"
+)
+
 var (
 	UpdatePiConfig       = updatePiConfig
 	SwitchHandlePowerKey = switchHandlePowerKey
 	SwitchDisableService = switchDisableService
 	UpdateKeyValueStream = updateKeyValueStream
 )
+
+func MockTimeNow(f func() time.Time) (restore func()) {
+	old := timeNow
+	timeNow = f
+	return func() {
+		timeNow = old
+	}
+}
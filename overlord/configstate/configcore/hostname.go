@@ -0,0 +1,116 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+)
+
+func init() {
+	// add supported configuration of this module
+	supportedConfigurations["core.system.hostname"] = true
+	// getting the option reads the hostname currently used by the system
+	if err := config.RegisterExternalConfig("core", "system.hostname", getHostnameFromSystem); err != nil {
+		panic(err)
+	}
+}
+
+// validHostname matches dot separated labels of ASCII letters, digits and
+// dashes as accepted by hostnamed, labels cannot start or end with a dash
+var validHostname = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+// maxHostnameLen is HOST_NAME_MAX on Linux
+const maxHostnameLen = 64
+
+func validateHostname(hostname string) error {
+	if len(hostname) > maxHostnameLen || !validHostname.MatchString(hostname) {
+		return fmt.Errorf("cannot set hostname %q: name not valid", hostname)
+	}
+	return nil
+}
+
+func validateHostnameSettings(tr config.Conf) error {
+	hostname, err := coreCfg(tr, "system.hostname")
+	if err != nil {
+		return err
+	}
+	if hostname == "" {
+		return nil
+	}
+	// the value in use by the system is not validated, it is what
+	// getting the option returns
+	current, err := currentHostname()
+	if err != nil {
+		return err
+	}
+	if hostname == current {
+		return nil
+	}
+	return validateHostname(hostname)
+}
+
+func currentHostname() (string, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dirs.GlobalRootDir, "/etc/hostname"))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+func getHostnameFromSystem(key string) (interface{}, error) {
+	current, err := currentHostname()
+	if err != nil || current == "" {
+		return nil, err
+	}
+	return current, nil
+}
+
+func handleHostnameConfiguration(tr config.Conf) error {
+	hostname, err := coreCfg(tr, "system.hostname")
+	if err != nil {
+		return err
+	}
+	// an unset hostname keeps whatever the system uses
+	if hostname == "" {
+		return nil
+	}
+	current, err := currentHostname()
+	if err != nil {
+		return err
+	}
+	if hostname == current {
+		return nil
+	}
+	output, err := exec.Command("hostnamectl", "set-hostname", hostname).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cannot set hostname: %v", osutil.OutputErr(output, err))
+	}
+	return nil
+}
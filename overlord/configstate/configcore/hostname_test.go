@@ -0,0 +1,168 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type hostnameSuite struct {
+	configcoreSuite
+
+	mockedHostnamectl *testutil.MockCmd
+	restores          []func()
+}
+
+var _ = Suite(&hostnameSuite{})
+
+func (s *hostnameSuite) SetUpTest(c *C) {
+	s.configcoreSuite.SetUpTest(c)
+
+	s.restores = append(s.restores, release.MockOnClassic(false))
+
+	s.mockedHostnamectl = testutil.MockCommand(c, "hostnamectl", "")
+	s.restores = append(s.restores, s.mockedHostnamectl.Restore)
+
+	err := os.MkdirAll(filepath.Join(dirs.GlobalRootDir, "/etc"), 0755)
+	c.Assert(err, IsNil)
+	err = ioutil.WriteFile(filepath.Join(dirs.GlobalRootDir, "/etc/hostname"), []byte("localhost\n"), 0644)
+	c.Assert(err, IsNil)
+}
+
+func (s *hostnameSuite) TearDownTest(c *C) {
+	s.configcoreSuite.TearDownTest(c)
+	for _, f := range s.restores {
+		f()
+	}
+	s.restores = nil
+}
+
+func (s *hostnameSuite) TestConfigureHostnameInvalid(c *C) {
+	invalidHostnames := []string{
+		"-no-start-with-dash", "no-end-with-dash-", "no..double-dots",
+		"no_underscores", "no spaces", "no/slashes",
+		strings.Repeat("x", 64), strings.Repeat("x.", 32) + "x",
+	}
+
+	for _, name := range invalidHostnames {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"system.hostname": name,
+			},
+		})
+		c.Check(err, ErrorMatches, `cannot set hostname ".*": name not valid`, Commentf("%q", name))
+	}
+	c.Check(s.mockedHostnamectl.Calls(), HasLen, 0)
+}
+
+func (s *hostnameSuite) TestConfigureHostnameIntegration(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.hostname": "my-device.example.com",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.mockedHostnamectl.Calls(), DeepEquals, [][]string{
+		{"hostnamectl", "set-hostname", "my-device.example.com"},
+	})
+}
+
+func (s *hostnameSuite) TestConfigureHostnameUnchanged(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.hostname": "localhost",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.mockedHostnamectl.Calls(), HasLen, 0)
+}
+
+func (s *hostnameSuite) TestConfigureHostnameUnset(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf:  map[string]interface{}{},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.mockedHostnamectl.Calls(), HasLen, 0)
+}
+
+func (s *hostnameSuite) TestConfigureHostnameError(c *C) {
+	mockedHostnamectl := testutil.MockCommand(c, "hostnamectl", "echo boom; exit 1")
+	defer mockedHostnamectl.Restore()
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.hostname": "my-device",
+		},
+	})
+	c.Assert(err, ErrorMatches, "cannot set hostname: boom")
+}
+
+func (s *hostnameSuite) TestGetHostnameFromSystem(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	var hostname string
+	c.Assert(tr.Get("core", "system.hostname", &hostname), IsNil)
+	c.Check(hostname, Equals, "localhost")
+
+	// the system value is returned even if a different one was set before
+	tr.Set("core", "system.hostname", "my-device")
+	tr.Commit()
+	tr = config.NewTransaction(s.state)
+	c.Assert(tr.Get("core", "system.hostname", &hostname), IsNil)
+	c.Check(hostname, Equals, "localhost")
+
+	err := os.Remove(filepath.Join(dirs.GlobalRootDir, "/etc/hostname"))
+	c.Assert(err, IsNil)
+	// the set value is used when the system one cannot be read
+	c.Assert(tr.Get("core", "system.hostname", &hostname), IsNil)
+	c.Check(hostname, Equals, "my-device")
+}
+
+func (s *hostnameSuite) TestConfigureHostnameCurrentNotValidated(c *C) {
+	err := ioutil.WriteFile(filepath.Join(dirs.GlobalRootDir, "/etc/hostname"), []byte("my_host\n"), 0644)
+	c.Assert(err, IsNil)
+
+	err = configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.hostname": "my_host",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.mockedHostnamectl.Calls(), HasLen, 0)
+}
@@ -0,0 +1,108 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/systemd"
+)
+
+func init() {
+	// add supported configuration of this module
+	supportedConfigurations["core.system.journal.persistent"] = true
+	supportedConfigurations["core.system.journal.max-size"] = true
+}
+
+func validateJournalSettings(tr config.Conf) error {
+	if err := validateBoolFlag(tr, "system.journal.persistent"); err != nil {
+		return err
+	}
+	maxSize, err := coreCfg(tr, "system.journal.max-size")
+	if err != nil {
+		return err
+	}
+	// reset is fine
+	if maxSize == "" {
+		return nil
+	}
+	if _, err := strutil.ParseByteSize(maxSize); err != nil {
+		return err
+	}
+	return nil
+}
+
+func handleJournalConfiguration(tr config.Conf) error {
+	dir := filepath.Join(dirs.GlobalRootDir, "/etc/systemd/journald.conf.d")
+	name := "00-snap-core.conf"
+	dirContent := make(map[string]*osutil.FileState, 1)
+
+	persistent, err := coreCfg(tr, "system.journal.persistent")
+	if err != nil {
+		return err
+	}
+	maxSize, err := coreCfg(tr, "system.journal.max-size")
+	if err != nil {
+		return err
+	}
+
+	var configStr string
+	switch persistent {
+	case "true":
+		configStr += "Storage=persistent\n"
+	case "false":
+		configStr += "Storage=volatile\n"
+	}
+	if maxSize != "" {
+		size, err := strutil.ParseByteSize(maxSize)
+		if err != nil {
+			return err
+		}
+		configStr += fmt.Sprintf("SystemMaxUse=%d\n", size)
+	}
+	if configStr != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		dirContent[name] = &osutil.FileState{
+			Content: []byte("[Journal]\n" + configStr),
+			Mode:    0644,
+		}
+	}
+
+	// unset options remove the drop-in so journald uses its defaults again
+	changed, removed, err := osutil.EnsureDirState(dir, name, dirContent)
+	if err != nil {
+		return err
+	}
+	if len(changed) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, &sysdLogger{})
+	return sysd.Restart("systemd-journald.service", 5*time.Minute)
+}
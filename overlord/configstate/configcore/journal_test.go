@@ -0,0 +1,152 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type journalSuite struct {
+	configcoreSuite
+
+	mockJournaldConfPath string
+	restores             []func()
+}
+
+var _ = Suite(&journalSuite{})
+
+func (s *journalSuite) SetUpTest(c *C) {
+	s.configcoreSuite.SetUpTest(c)
+	s.systemctlArgs = nil
+
+	s.restores = append(s.restores, release.MockOnClassic(false))
+
+	s.mockJournaldConfPath = filepath.Join(dirs.GlobalRootDir, "/etc/systemd/journald.conf.d/00-snap-core.conf")
+}
+
+func (s *journalSuite) TearDownTest(c *C) {
+	s.configcoreSuite.TearDownTest(c)
+	for _, f := range s.restores {
+		f()
+	}
+	s.restores = nil
+}
+
+func (s *journalSuite) TestConfigureJournalPersistent(c *C) {
+	for _, t := range []struct {
+		persistent interface{}
+		storage    string
+	}{
+		{true, "persistent"},
+		{"true", "persistent"},
+		{false, "volatile"},
+		{"false", "volatile"},
+	} {
+		s.systemctlArgs = nil
+
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"system.journal.persistent": t.persistent,
+			},
+		})
+		c.Assert(err, IsNil)
+		c.Check(s.mockJournaldConfPath, testutil.FileEquals, "[Journal]\nStorage="+t.storage+"\n")
+	}
+}
+
+func (s *journalSuite) TestConfigureJournalMaxSize(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.journal.persistent": true,
+			"system.journal.max-size":   "50MB",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.mockJournaldConfPath, testutil.FileEquals, "[Journal]\nStorage=persistent\nSystemMaxUse=50000000\n")
+	c.Check(s.systemctlArgs, DeepEquals, [][]string{
+		{"stop", "systemd-journald.service"},
+		{"show", "--property=ActiveState", "systemd-journald.service"},
+		{"start", "systemd-journald.service"},
+	})
+	s.systemctlArgs = nil
+
+	// nothing changed, journald is not restarted
+	err = configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.journal.persistent": true,
+			"system.journal.max-size":   "50MB",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.systemctlArgs, HasLen, 0)
+}
+
+func (s *journalSuite) TestConfigureJournalUnset(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.journal.persistent": true,
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.mockJournaldConfPath, testutil.FilePresent)
+	s.systemctlArgs = nil
+
+	// unsetting the options goes back to the journald defaults
+	err = configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.journal.persistent": "",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.mockJournaldConfPath, testutil.FileAbsent)
+	c.Check(s.systemctlArgs, HasLen, 3)
+}
+
+func (s *journalSuite) TestConfigureJournalInvalid(c *C) {
+	for _, t := range []struct {
+		key, value, err string
+	}{
+		{"system.journal.persistent", "yes", `system.journal.persistent can only be set to 'true' or 'false'`},
+		{"system.journal.max-size", "lots", `cannot parse "lots": no numerical prefix`},
+		{"system.journal.max-size", "10", `cannot parse "10": need a number with a unit as input`},
+		{"system.journal.max-size", "-10MB", `cannot parse "-10MB": size cannot be negative`},
+	} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				t.key: t.value,
+			},
+		})
+		c.Check(err, ErrorMatches, t.err)
+	}
+	c.Check(s.mockJournaldConfPath, testutil.FileAbsent)
+}
@@ -0,0 +1,99 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+)
+
+func init() {
+	// add supported configuration of this module
+	supportedConfigurations["core.system.kernel.printk.console-loglevel"] = true
+}
+
+// defaultConsoleLoglevel is the console log level set by the base
+// snaps in /etc/sysctl.d/10-console-messages.conf
+const defaultConsoleLoglevel = "4"
+
+func validateSysctlSettings(tr config.Conf) error {
+	loglevel, err := coreCfg(tr, "system.kernel.printk.console-loglevel")
+	if err != nil {
+		return err
+	}
+	// reset is fine
+	if loglevel == "" {
+		return nil
+	}
+	if n, err := strconv.ParseUint(loglevel, 10, 8); err != nil || n > 7 {
+		return fmt.Errorf("console-loglevel must be a number between 0 and 7, not: %s", loglevel)
+	}
+	return nil
+}
+
+func handleSysctlConfiguration(tr config.Conf) error {
+	dir := filepath.Join(dirs.GlobalRootDir, "/etc/sysctl.d")
+	name := "99-snapd.conf"
+	dirContent := make(map[string]*osutil.FileState, 1)
+
+	loglevel, err := coreCfg(tr, "system.kernel.printk.console-loglevel")
+	if err != nil {
+		return err
+	}
+
+	sysctl := "kernel.printk=" + loglevel
+	if loglevel != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		dirContent[name] = &osutil.FileState{
+			Content: []byte(sysctl + "\n"),
+			Mode:    0644,
+		}
+	} else {
+		// Store the sysctl for the code below but don't write it to
+		// the directory so that the file setting this option gets
+		// removed.
+		sysctl = "kernel.printk=" + defaultConsoleLoglevel
+	}
+
+	changed, removed, err := osutil.EnsureDirState(dir, name, dirContent)
+	if err != nil {
+		return err
+	}
+
+	// load the new config into the kernel, writing a single value to
+	// kernel.printk changes only the console log level
+	if len(changed) > 0 || len(removed) > 0 {
+		output, err := exec.Command("sysctl", "-w", sysctl).CombinedOutput()
+		if err != nil {
+			return osutil.OutputErr(output, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type printkSuite struct {
+	configcoreSuite
+
+	mockSysctlConfPath string
+	mockSysctl         *testutil.MockCmd
+	restores           []func()
+}
+
+var _ = Suite(&printkSuite{})
+
+func (s *printkSuite) SetUpTest(c *C) {
+	s.configcoreSuite.SetUpTest(c)
+
+	s.restores = append(s.restores, release.MockOnClassic(false))
+
+	s.mockSysctl = testutil.MockCommand(c, "sysctl", "")
+	s.restores = append(s.restores, s.mockSysctl.Restore)
+
+	s.mockSysctlConfPath = filepath.Join(dirs.GlobalRootDir, "/etc/sysctl.d/99-snapd.conf")
+}
+
+func (s *printkSuite) TearDownTest(c *C) {
+	s.configcoreSuite.TearDownTest(c)
+	for _, f := range s.restores {
+		f()
+	}
+	s.restores = nil
+}
+
+func (s *printkSuite) TestConfigureConsoleLoglevel(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.kernel.printk.console-loglevel": "2",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.mockSysctlConfPath, testutil.FileEquals, "kernel.printk=2\n")
+	c.Check(s.mockSysctl.Calls(), DeepEquals, [][]string{
+		{"sysctl", "-w", "kernel.printk=2"},
+	})
+	s.mockSysctl.ForgetCalls()
+
+	// setting the same value again does not call sysctl
+	err = configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.kernel.printk.console-loglevel": "2",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.mockSysctl.Calls(), HasLen, 0)
+
+	// unsetting the value restores the default
+	err = configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.kernel.printk.console-loglevel": "",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.mockSysctlConfPath, testutil.FileAbsent)
+	c.Check(s.mockSysctl.Calls(), DeepEquals, [][]string{
+		{"sysctl", "-w", "kernel.printk=4"},
+	})
+}
+
+func (s *printkSuite) TestConfigureConsoleLoglevelInvalid(c *C) {
+	for _, loglevel := range []string{"8", "-1", "high"} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"system.kernel.printk.console-loglevel": loglevel,
+			},
+		})
+		c.Check(err, ErrorMatches, `console-loglevel must be a number between 0 and 7, not: .*`)
+	}
+	c.Check(s.mockSysctlConfPath, testutil.FileAbsent)
+	c.Check(s.mockSysctl.Calls(), HasLen, 0)
+}
@@ -21,14 +21,22 @@ package configcore
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/timeutil"
 )
 
 func init() {
 	// add supported configuration of this module
 	supportedConfigurations["core.snapshots.automatic.retention"] = true
+	supportedConfigurations["core.snapshots.chunked"] = true
+	supportedConfigurations["core.snapshots.schedule"] = true
+	supportedConfigurations["core.snapshots.retain"] = true
+	supportedConfigurations["core.snapshots.snaps"] = true
 }
 
 func validateAutomaticSnapshotsExpiration(tr config.Conf) error {
@@ -47,3 +55,43 @@ func validateAutomaticSnapshotsExpiration(tr config.Conf) error {
 	}
 	return nil
 }
+
+func validateSnapshotsChunked(tr config.Conf) error {
+	return validateBoolFlag(tr, "snapshots.chunked")
+}
+
+func validateSnapshotsSchedule(tr config.Conf) error {
+	scheduleStr, err := coreCfg(tr, "snapshots.schedule")
+	if err != nil {
+		return err
+	}
+	if scheduleStr != "" {
+		if _, err := timeutil.ParseSchedule(scheduleStr); err != nil {
+			return fmt.Errorf("snapshots.schedule cannot be parsed: %v", err)
+		}
+	}
+
+	retainStr, err := coreCfg(tr, "snapshots.retain")
+	if err != nil {
+		return err
+	}
+	if retainStr != "" {
+		if n, err := strconv.ParseUint(retainStr, 10, 8); err != nil || n < 1 {
+			return fmt.Errorf("snapshots.retain must be a number between 1 and 255, not %q", retainStr)
+		}
+	}
+
+	snapsStr, err := coreCfg(tr, "snapshots.snaps")
+	if err != nil {
+		return err
+	}
+	if snapsStr != "" {
+		for _, name := range strings.Split(snapsStr, ",") {
+			if err := snap.ValidateInstanceName(strings.TrimSpace(name)); err != nil {
+				return fmt.Errorf("snapshots.snaps is invalid: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -61,6 +61,58 @@ func (s *snapshotsSuite) TestConfigureAutomaticSnapshotsDisable(c *C) {
 	c.Assert(err, IsNil)
 }
 
+func (s *snapshotsSuite) TestConfigureChunkedSnapshots(c *C) {
+	for _, v := range []string{"true", "false"} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"snapshots.chunked": v,
+			},
+		})
+		c.Check(err, IsNil)
+	}
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"snapshots.chunked": "maybe",
+		},
+	})
+	c.Assert(err, ErrorMatches, `snapshots.chunked can only be set to 'true' or 'false'`)
+}
+
+func (s *snapshotsSuite) TestConfigureScheduledSnapshotsHappy(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"snapshots.schedule": "mon,03:00",
+			"snapshots.retain":   "5",
+			"snapshots.snaps":    "foo, bar_instance",
+		},
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *snapshotsSuite) TestConfigureScheduledSnapshotsInvalid(c *C) {
+	for _, t := range []struct {
+		key, value, errMsg string
+	}{
+		{"snapshots.schedule", "invalid", `snapshots.schedule cannot be parsed: .*`},
+		{"snapshots.retain", "0", `snapshots.retain must be a number between 1 and 255, not "0"`},
+		{"snapshots.retain", "many", `snapshots.retain must be a number between 1 and 255, not "many"`},
+		{"snapshots.snaps", "foo,,bar", `snapshots.snaps is invalid: .*`},
+		{"snapshots.snaps", "Foo", `snapshots.snaps is invalid: .*`},
+	} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				t.key: t.value,
+			},
+		})
+		c.Check(err, ErrorMatches, t.errMsg, Commentf("%s=%s", t.key, t.value))
+	}
+}
+
 func (s *refreshSuite) TestConfigureAutomaticSnapshotsExpirationInvalid(c *C) {
 	err := configcore.Run(&mockConf{
 		state: s.state,
@@ -0,0 +1,65 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+)
+
+type storeCacheSuite struct {
+	configcoreSuite
+}
+
+var _ = Suite(&storeCacheSuite{})
+
+func (s *storeCacheSuite) TestConfigureStoreCacheListen(c *C) {
+	for _, addr := range []string{"", ":8181", "0.0.0.0:8181", "[::]:8181", "localhost:8181"} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"store-cache.listen": addr,
+			},
+		})
+		c.Check(err, IsNil, Commentf(addr))
+	}
+}
+
+func (s *storeCacheSuite) TestConfigureStoreCacheListenInvalid(c *C) {
+	for _, t := range []struct {
+		addr string
+		err  string
+	}{
+		{"8181", `store-cache.listen must be of the form \[host\]:port, not "8181"`},
+		{"localhost", `store-cache.listen must be of the form \[host\]:port, not "localhost"`},
+		{":http", `store-cache.listen must use a port between 1 and 65535, not "http"`},
+		{":0", `store-cache.listen must use a port between 1 and 65535, not "0"`},
+		{":65536", `store-cache.listen must use a port between 1 and 65535, not "65536"`},
+	} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"store-cache.listen": t.addr,
+			},
+		})
+		c.Check(err, ErrorMatches, t.err, Commentf(t.addr))
+	}
+}
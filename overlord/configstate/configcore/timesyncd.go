@@ -0,0 +1,103 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/systemd"
+)
+
+func init() {
+	// add supported configuration of this module
+	supportedConfigurations["core.system.time.ntp-servers"] = true
+}
+
+// ntpServers returns the servers of the system.time.ntp-servers option,
+// they are separated by spaces or commas
+func ntpServers(tr config.Conf) ([]string, error) {
+	output, err := coreCfg(tr, "system.time.ntp-servers")
+	if err != nil {
+		return nil, err
+	}
+	return strings.FieldsFunc(output, func(r rune) bool {
+		return r == ',' || r == ' '
+	}), nil
+}
+
+func validateNTPServers(tr config.Conf) error {
+	servers, err := ntpServers(tr)
+	if err != nil {
+		return err
+	}
+	for _, server := range servers {
+		if net.ParseIP(server) != nil {
+			continue
+		}
+		if len(server) > maxHostnameLen || !validHostname.MatchString(server) {
+			return fmt.Errorf("cannot set NTP server %q: name not valid", server)
+		}
+	}
+	return nil
+}
+
+func handleNTPConfiguration(tr config.Conf) error {
+	servers, err := ntpServers(tr)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(dirs.GlobalRootDir, "/etc/systemd/timesyncd.conf.d")
+	name := "00-snap-core.conf"
+	dirContent := make(map[string]*osutil.FileState, 1)
+	if len(servers) > 0 {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		dirContent[name] = &osutil.FileState{
+			Content: []byte(fmt.Sprintf("[Time]\nNTP=%s\n", strings.Join(servers, " "))),
+			Mode:    0644,
+		}
+	}
+
+	changed, removed, err := osutil.EnsureDirState(dir, name, dirContent)
+	if err != nil {
+		return err
+	}
+	if len(changed) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	// pick up the new servers if timesyncd is in use
+	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, &sysdLogger{})
+	active, err := sysd.IsActive("systemd-timesyncd.service")
+	if err != nil || !active {
+		return err
+	}
+	return sysd.Restart("systemd-timesyncd.service", 5*time.Minute)
+}
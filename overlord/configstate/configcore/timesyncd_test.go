@@ -0,0 +1,109 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type timesyncdSuite struct {
+	configcoreSuite
+
+	mockTimesyncdConfPath string
+	restores              []func()
+}
+
+var _ = Suite(&timesyncdSuite{})
+
+func (s *timesyncdSuite) SetUpTest(c *C) {
+	s.configcoreSuite.SetUpTest(c)
+	s.systemctlArgs = nil
+
+	s.restores = append(s.restores, release.MockOnClassic(false))
+
+	s.mockTimesyncdConfPath = filepath.Join(dirs.GlobalRootDir, "/etc/systemd/timesyncd.conf.d/00-snap-core.conf")
+}
+
+func (s *timesyncdSuite) TearDownTest(c *C) {
+	s.configcoreSuite.TearDownTest(c)
+	for _, f := range s.restores {
+		f()
+	}
+	s.restores = nil
+}
+
+func (s *timesyncdSuite) TestConfigureNTPServersInvalid(c *C) {
+	for _, servers := range []string{"no_underscores", "ntp.example.com -bad-", "ntp.example.com,bad..name"} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"system.time.ntp-servers": servers,
+			},
+		})
+		c.Check(err, ErrorMatches, `cannot set NTP server ".*": name not valid`, Commentf("%q", servers))
+	}
+	c.Check(s.mockTimesyncdConfPath, testutil.FileAbsent)
+}
+
+func (s *timesyncdSuite) TestConfigureNTPServersIntegration(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.time.ntp-servers": "ntp.example.com, 10.0.0.1 fe80::1",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.mockTimesyncdConfPath, testutil.FileEquals, "[Time]\nNTP=ntp.example.com 10.0.0.1 fe80::1\n")
+	c.Check(s.systemctlArgs, DeepEquals, [][]string{
+		{"--root", dirs.GlobalRootDir, "is-active", "systemd-timesyncd.service"},
+		{"stop", "systemd-timesyncd.service"},
+		{"show", "--property=ActiveState", "systemd-timesyncd.service"},
+		{"start", "systemd-timesyncd.service"},
+	})
+	s.systemctlArgs = nil
+
+	// setting the same servers again does not restart timesyncd
+	err = configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.time.ntp-servers": "ntp.example.com 10.0.0.1 fe80::1",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.systemctlArgs, HasLen, 0)
+
+	// unsetting the servers removes the configuration
+	err = configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.time.ntp-servers": "",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.mockTimesyncdConfPath, testutil.FileAbsent)
+	c.Check(s.systemctlArgs, HasLen, 4)
+}
@@ -0,0 +1,109 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+)
+
+func init() {
+	// add supported configuration of this module
+	supportedConfigurations["core.system.timezone"] = true
+	// getting the option reads the timezone currently used by the system
+	if err := config.RegisterExternalConfig("core", "system.timezone", getTimezoneFromSystem); err != nil {
+		panic(err)
+	}
+}
+
+// validTimezone matches the names of the tz database, e.g. "UTC" or
+// "America/Argentina/Buenos_Aires"
+var validTimezone = regexp.MustCompile(`^[a-zA-Z0-9+_-]+(/[a-zA-Z0-9+_-]+)*$`)
+
+func validateTimezoneSettings(tr config.Conf) error {
+	timezone, err := coreCfg(tr, "system.timezone")
+	if err != nil {
+		return err
+	}
+	if timezone == "" {
+		return nil
+	}
+	// the value in use by the system is not validated, it is what
+	// getting the option returns
+	current, err := currentTimezone()
+	if err != nil {
+		return err
+	}
+	if timezone == current {
+		return nil
+	}
+	if !validTimezone.MatchString(timezone) {
+		return fmt.Errorf("cannot set timezone %q: name not valid", timezone)
+	}
+	return nil
+}
+
+func currentTimezone() (string, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dirs.GlobalRootDir, "/etc/timezone"))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+func getTimezoneFromSystem(key string) (interface{}, error) {
+	current, err := currentTimezone()
+	if err != nil || current == "" {
+		return nil, err
+	}
+	return current, nil
+}
+
+func handleTimezoneConfiguration(tr config.Conf) error {
+	timezone, err := coreCfg(tr, "system.timezone")
+	if err != nil {
+		return err
+	}
+	// an unset timezone keeps whatever the system uses
+	if timezone == "" {
+		return nil
+	}
+	current, err := currentTimezone()
+	if err != nil {
+		return err
+	}
+	if timezone == current {
+		return nil
+	}
+	output, err := exec.Command("timedatectl", "set-timezone", timezone).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cannot set timezone: %v", osutil.OutputErr(output, err))
+	}
+	return nil
+}
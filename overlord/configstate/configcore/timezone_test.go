@@ -0,0 +1,161 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type timezoneSuite struct {
+	configcoreSuite
+
+	mockedTimedatectl *testutil.MockCmd
+	restores          []func()
+}
+
+var _ = Suite(&timezoneSuite{})
+
+func (s *timezoneSuite) SetUpTest(c *C) {
+	s.configcoreSuite.SetUpTest(c)
+
+	s.restores = append(s.restores, release.MockOnClassic(false))
+
+	s.mockedTimedatectl = testutil.MockCommand(c, "timedatectl", "")
+	s.restores = append(s.restores, s.mockedTimedatectl.Restore)
+
+	err := os.MkdirAll(filepath.Join(dirs.GlobalRootDir, "/etc"), 0755)
+	c.Assert(err, IsNil)
+	err = ioutil.WriteFile(filepath.Join(dirs.GlobalRootDir, "/etc/timezone"), []byte("Etc/UTC\n"), 0644)
+	c.Assert(err, IsNil)
+}
+
+func (s *timezoneSuite) TearDownTest(c *C) {
+	s.configcoreSuite.TearDownTest(c)
+	for _, f := range s.restores {
+		f()
+	}
+	s.restores = nil
+}
+
+func (s *timezoneSuite) TestConfigureTimezoneInvalid(c *C) {
+	invalidTimezones := []string{
+		"no-#", "no spaces", "/no-leading-slash", "no-trailing-slash/",
+		"no//double-slashes", "../no-dots",
+	}
+
+	for _, tz := range invalidTimezones {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"system.timezone": tz,
+			},
+		})
+		c.Check(err, ErrorMatches, `cannot set timezone ".*": name not valid`, Commentf("%q", tz))
+	}
+	c.Check(s.mockedTimedatectl.Calls(), HasLen, 0)
+}
+
+func (s *timezoneSuite) TestConfigureTimezoneIntegration(c *C) {
+	for _, tz := range []string{"UTC", "Europe/Berlin", "America/Argentina/Buenos_Aires", "Etc/GMT+3"} {
+		s.mockedTimedatectl.ForgetCalls()
+
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"system.timezone": tz,
+			},
+		})
+		c.Assert(err, IsNil)
+		c.Check(s.mockedTimedatectl.Calls(), DeepEquals, [][]string{
+			{"timedatectl", "set-timezone", tz},
+		})
+	}
+}
+
+func (s *timezoneSuite) TestConfigureTimezoneUnchanged(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.timezone": "Etc/UTC",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.mockedTimedatectl.Calls(), HasLen, 0)
+}
+
+func (s *timezoneSuite) TestConfigureTimezoneError(c *C) {
+	mockedTimedatectl := testutil.MockCommand(c, "timedatectl", "echo boom; exit 1")
+	defer mockedTimedatectl.Restore()
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.timezone": "Europe/Berlin",
+		},
+	})
+	c.Assert(err, ErrorMatches, "cannot set timezone: boom")
+}
+
+func (s *timezoneSuite) TestGetTimezoneFromSystem(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	var timezone string
+	c.Assert(tr.Get("core", "system.timezone", &timezone), IsNil)
+	c.Check(timezone, Equals, "Etc/UTC")
+
+	// the system value is returned even if a different one was set before
+	tr.Set("core", "system.timezone", "Europe/Berlin")
+	tr.Commit()
+	tr = config.NewTransaction(s.state)
+	c.Assert(tr.Get("core", "system.timezone", &timezone), IsNil)
+	c.Check(timezone, Equals, "Etc/UTC")
+
+	err := os.Remove(filepath.Join(dirs.GlobalRootDir, "/etc/timezone"))
+	c.Assert(err, IsNil)
+	// the set value is used when the system one cannot be read
+	c.Assert(tr.Get("core", "system.timezone", &timezone), IsNil)
+	c.Check(timezone, Equals, "Europe/Berlin")
+}
+
+func (s *timezoneSuite) TestConfigureTimezoneCurrentNotValidated(c *C) {
+	err := ioutil.WriteFile(filepath.Join(dirs.GlobalRootDir, "/etc/timezone"), []byte("Etc/Not Valid\n"), 0644)
+	c.Assert(err, IsNil)
+
+	err = configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.timezone": "Etc/Not Valid",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.mockedTimedatectl.Calls(), HasLen, 0)
+}
@@ -28,6 +28,7 @@ import (
 
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/servicestate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
@@ -104,7 +105,7 @@ func Configure(st *state.State, snapName string, patch map[string]interface{}, f
 	hooksup := &hookstate.HookSetup{
 		Snap:        snapName,
 		Hook:        "configure",
-		Optional:    len(patch) == 0,
+		Optional:    len(patch) == 0 || onlyJournalOptions(patch),
 		IgnoreError: flags&snapstate.IgnoreHookError != 0,
 		TrackError:  flags&snapstate.TrackHookError != 0,
 		// all configure hooks must finish within this timeout
@@ -125,6 +126,18 @@ func Configure(st *state.State, snapName string, patch map[string]interface{}, f
 	return state.NewTaskSet(task)
 }
 
+// onlyJournalOptions returns whether the patch only touches the
+// journal options, which are handled by snapd itself and so can be
+// set for snaps without a configure hook.
+func onlyJournalOptions(patch map[string]interface{}) bool {
+	for key := range patch {
+		if !servicestate.IsJournalOption(key) {
+			return false
+		}
+	}
+	return true
+}
+
 // RemapSnapFromRequest renames a snap as received from an API request
 func RemapSnapFromRequest(snapName string) string {
 	if snapName == "system" {
@@ -63,6 +63,14 @@ var configureTests = []struct {
 	patch:       map[string]interface{}{"foo": "bar"},
 	optional:    false,
 	ignoreError: false,
+}, {
+	patch:       map[string]interface{}{"journal.size": "64MB"},
+	optional:    true,
+	ignoreError: false,
+}, {
+	patch:       map[string]interface{}{"journal.size": "64MB", "foo": "bar"},
+	optional:    false,
+	ignoreError: false,
 }, {
 	patch:       nil,
 	optional:    true,
@@ -19,5 +19,17 @@
 
 package configstate
 
+import (
+	"github.com/snapcore/snapd/overlord/configstate/config"
+)
+
 var NewConfigureHandler = newConfigureHandler
 var SortPatchKeysByDepth = sortPatchKeysByDepth
+
+func MockServicestateConfigureSnapJournal(f func(cfg config.Conf, instanceName string) error) (restore func()) {
+	old := servicestateConfigureSnapJournal
+	servicestateConfigureSnapJournal = f
+	return func() {
+		servicestateConfigureSnapJournal = old
+	}
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/snapcore/snapd/asserts/assertstest"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/overlord/configstate"
+	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/hookstate"
 	"github.com/snapcore/snapd/overlord/hookstate/hooktest"
 	"github.com/snapcore/snapd/overlord/snapstate"
@@ -38,6 +39,7 @@ import (
 	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/systemd"
 )
 
 func TestConfigState(t *testing.T) { TestingT(t) }
@@ -111,6 +113,76 @@ func (s *configureHandlerSuite) TestBeforeInitializesTransaction(c *C) {
 	c.Check(value, Equals, "bar")
 }
 
+func (s *configureHandlerSuite) TestBeforeInvalidJournalSize(c *C) {
+	s.context.Lock()
+	s.context.Set("patch", map[string]interface{}{
+		"journal.size": "lots",
+	})
+	s.context.Unlock()
+
+	c.Check(s.handler.Before(), ErrorMatches, `invalid journal size for snap "test-snap": cannot parse "lots": .*`)
+}
+
+func (s *configureHandlerSuite) TestDoneConfiguresJournal(c *C) {
+	var calls []string
+	restore := configstate.MockServicestateConfigureSnapJournal(func(cfg config.Conf, instanceName string) error {
+		var size string
+		c.Check(cfg.Get(instanceName, "journal.size", &size), IsNil)
+		calls = append(calls, instanceName+":"+size)
+		return nil
+	})
+	defer restore()
+	// journal namespaces need systemd 245
+	restore = systemd.MockSystemctl(func(args ...string) ([]byte, error) {
+		c.Check(args, DeepEquals, []string{"--version"})
+		return []byte("systemd 245 (245.4-4ubuntu3.11)\n"), nil
+	})
+	defer restore()
+
+	s.context.Lock()
+	s.context.Set("patch", map[string]interface{}{
+		"journal.size": "64MB",
+	})
+	s.context.Unlock()
+
+	c.Assert(s.handler.Before(), IsNil)
+	c.Assert(s.handler.Done(), IsNil)
+	c.Check(calls, DeepEquals, []string{"test-snap:64MB"})
+}
+
+func (s *configureHandlerSuite) TestBeforeJournalNamespacesUnsupported(c *C) {
+	restore := systemd.MockSystemctl(func(args ...string) ([]byte, error) {
+		return []byte("systemd 237\n"), nil
+	})
+	defer restore()
+
+	s.context.Lock()
+	s.context.Set("patch", map[string]interface{}{
+		"journal.size": "64MB",
+	})
+	s.context.Unlock()
+
+	c.Assert(s.handler.Before(), ErrorMatches, `cannot set journal size of snap "test-snap": journal namespaces are not supported: systemd version 237 is too old \(expected at least 245\)`)
+}
+
+func (s *configureHandlerSuite) TestDoneIgnoresOtherOptions(c *C) {
+	restore := configstate.MockServicestateConfigureSnapJournal(func(cfg config.Conf, instanceName string) error {
+		c.Fatalf("unexpected call")
+		return nil
+	})
+	defer restore()
+
+	s.context.Lock()
+	s.context.Set("patch", map[string]interface{}{
+		"journalist":  "yes",
+		"foo.journal": "no",
+	})
+	s.context.Unlock()
+
+	c.Assert(s.handler.Before(), IsNil)
+	c.Assert(s.handler.Done(), IsNil)
+}
+
 func makeModel(override map[string]interface{}) *asserts.Model {
 	model := map[string]interface{}{
 		"type":         "model",
@@ -21,13 +21,17 @@ package configstate
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/servicestate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 )
 
+var servicestateConfigureSnapJournal = servicestate.ConfigureSnapJournal
+
 // configureHandler is the handler for the configure hook.
 type configureHandler struct {
 	context *hookstate.Context
@@ -119,13 +123,46 @@ func (h *configureHandler) Before() error {
 		}
 	}
 
+	if instanceName != "core" {
+		// the journal options are handled by snapd itself
+		if err := servicestate.ValidateSnapJournal(tr, instanceName); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 // Done is called by the HookManager after the configure hook has exited
 // successfully.
 func (h *configureHandler) Done() error {
-	return nil
+	instanceName := h.context.InstanceName()
+	if instanceName == "core" {
+		return nil
+	}
+
+	h.context.Lock()
+	defer h.context.Unlock()
+
+	tr := ContextTransaction(h.context)
+	journalChanged := false
+	for _, change := range tr.Changes() {
+		if isJournalChange(instanceName, change) {
+			journalChanged = true
+			break
+		}
+	}
+	if !journalChanged {
+		return nil
+	}
+	return servicestateConfigureSnapJournal(tr, instanceName)
+}
+
+// isJournalChange returns whether the given change, as returned by
+// Transaction.Changes, is about the journal options of the given snap.
+func isJournalChange(instanceName, change string) bool {
+	prefix := instanceName + "."
+	return strings.HasPrefix(change, prefix) && servicestate.IsJournalOption(change[len(prefix):])
 }
 
 // Error is called by the HookManager after the configure hook has exited
@@ -104,6 +104,9 @@ func Manager(s *state.State, hookManager *hookstate.HookManager, runner *state.T
 	// or gadget snaps. There are no further changes to the boot assets,
 	// unless a new gadget update is deployed.
 	runner.AddHandler("update-gadget-assets", m.doUpdateGadgetAssets, nil)
+	runner.AddHandler("create-recovery-system", m.doCreateRecoverySystem, m.undoCreateRecoverySystem)
+	// the device restarts right away, there is nothing to undo
+	runner.AddHandler("factory-reset", m.doFactoryReset, nil)
 
 	runner.AddBlocked(gadgetUpdateBlocked)
 
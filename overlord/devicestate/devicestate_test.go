@@ -3531,6 +3531,76 @@ func (s *deviceMgrSuite) TestUpdateGadgetOnCoreSimple(c *C) {
 	c.Check(s.restartRequests, DeepEquals, []state.RestartType{state.RestartSystem})
 }
 
+func (s *deviceMgrSuite) TestUpdateGadgetOnCoreVerifyMismatch(c *C) {
+	restore := devicestate.MockGadgetUpdate(func(current, update gadget.GadgetData, path string) error {
+		return nil
+	})
+	defer restore()
+	var verifyCalled bool
+	restore = devicestate.MockGadgetVerifyUpdate(func(current, update gadget.GadgetData) ([]gadget.StructureReport, error) {
+		verifyCalled = true
+		c.Check(update.RootDir, Equals, filepath.Join(dirs.SnapMountDir, "foo-gadget/34"))
+		return []gadget.StructureReport{
+			{Structure: &gadget.LaidOutStructure{VolumeStructure: &gadget.VolumeStructure{Name: "ok"}}},
+			{
+				Structure:  &gadget.LaidOutStructure{VolumeStructure: &gadget.VolumeStructure{Name: "boot"}, Index: 1},
+				Mismatches: []string{"grub.cfg: differs", "EFI/boot/grubx64.efi: missing"},
+			},
+			{
+				Structure: &gadget.LaidOutStructure{VolumeStructure: &gadget.VolumeStructure{Name: "raw"}, Index: 2},
+				Err:       errors.New("cannot verify volume structure #2 (\"raw\"): boom"),
+			},
+		}, nil
+	})
+	defer restore()
+
+	chg, t := setupGadgetUpdate(c, s.state)
+
+	for i := 0; i < 6; i++ {
+		s.se.Ensure()
+		s.se.Wait()
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	// verification problems do not fail the update
+	c.Assert(chg.IsReady(), Equals, true)
+	c.Check(chg.Err(), IsNil)
+	c.Check(t.Status(), Equals, state.DoneStatus)
+	c.Check(verifyCalled, Equals, true)
+	c.Assert(t.Log(), HasLen, 2)
+	c.Check(t.Log()[0], Matches, `.* INFO Volume structure #1 \("boot"\) does not match the gadget after update: grub.cfg: differs, EFI/boot/grubx64.efi: missing`)
+	c.Check(t.Log()[1], Matches, `.* INFO Cannot verify gadget assets update: cannot verify volume structure #2 \("raw"\): boom`)
+	c.Check(s.restartRequests, DeepEquals, []state.RestartType{state.RestartSystem})
+}
+
+func (s *deviceMgrSuite) TestUpdateGadgetOnCoreVerifyError(c *C) {
+	restore := devicestate.MockGadgetUpdate(func(current, update gadget.GadgetData, path string) error {
+		return nil
+	})
+	defer restore()
+	restore = devicestate.MockGadgetVerifyUpdate(func(current, update gadget.GadgetData) ([]gadget.StructureReport, error) {
+		return nil, errors.New("cannot lay out the new volume: boom")
+	})
+	defer restore()
+
+	chg, t := setupGadgetUpdate(c, s.state)
+
+	for i := 0; i < 6; i++ {
+		s.se.Ensure()
+		s.se.Wait()
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Assert(chg.IsReady(), Equals, true)
+	c.Check(chg.Err(), IsNil)
+	c.Check(t.Status(), Equals, state.DoneStatus)
+	c.Assert(t.Log(), HasLen, 1)
+	c.Check(t.Log()[0], Matches, `.* INFO Cannot verify gadget assets update: cannot lay out the new volume: boom`)
+	c.Check(s.restartRequests, DeepEquals, []state.RestartType{state.RestartSystem})
+}
+
 func (s *deviceMgrSuite) TestUpdateGadgetOnCoreNoUpdateNeeded(c *C) {
 	var called bool
 	restore := devicestate.MockGadgetUpdate(func(current, update gadget.GadgetData, path string) error {
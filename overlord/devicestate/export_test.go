@@ -170,3 +170,13 @@ func MockGadgetUpdate(mock func(current, update gadget.GadgetData, path string)
 		gadgetUpdate = old
 	}
 }
+
+func MockGadgetVerifyUpdate(mock func(current, update gadget.GadgetData) ([]gadget.StructureReport, error)) (restore func()) {
+	old := gadgetVerifyUpdate
+	gadgetVerifyUpdate = mock
+	return func() {
+		gadgetVerifyUpdate = old
+	}
+}
+
+var RestoreSerialAfterFactoryReset = restoreSerialAfterFactoryReset
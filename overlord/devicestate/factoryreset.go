@@ -0,0 +1,389 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package devicestate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/devicestate/internal"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/progress"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/systemd"
+)
+
+// FactoryResetOptions holds the options of a factory reset.
+type FactoryResetOptions struct {
+	// KeepSerial keeps the serial assertion and the device key, so
+	// that the device does not need to register again.
+	KeepSerial bool
+}
+
+// factoryResetRequest is what is recorded in the factory reset marker
+// file for the wipe on the next boot.
+type factoryResetRequest struct {
+	KeepSerial bool `json:"keep-serial,omitempty"`
+	// Serial holds the serial assertion and its prerequisites.
+	Serial string `json:"serial,omitempty"`
+}
+
+// factoryResetSerialFile holds the serial assertion and its
+// prerequisites kept across a factory reset, until the device is
+// seeded again.
+func factoryResetSerialFile() string {
+	return filepath.Join(dirs.SnapDeviceDir, "factory-reset-serial")
+}
+
+// FactoryReset returns a change that brings the device back to its
+// as-seeded state. The services of the snaps that are not needed to
+// boot are stopped and the snaps are unmounted, then the device is
+// restarted and on the next boot its writable data is wiped so that it
+// gets seeded again from the original seed.
+func FactoryReset(st *state.State, opts *FactoryResetOptions) (*state.Change, error) {
+	if opts == nil {
+		opts = &FactoryResetOptions{}
+	}
+	if release.OnClassic {
+		return nil, fmt.Errorf("cannot factory reset a classic system")
+	}
+	var seeded bool
+	err := st.Get("seeded", &seeded)
+	if err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+	if !seeded {
+		return nil, fmt.Errorf("cannot factory reset until fully seeded")
+	}
+	for _, chg := range st.Changes() {
+		if !chg.IsReady() {
+			return nil, &snapstate.ChangeConflictError{Message: "cannot factory reset while other changes are in progress"}
+		}
+	}
+	if opts.KeepSerial {
+		_, err := findSerial(st, nil)
+		if err == state.ErrNoState {
+			return nil, fmt.Errorf("cannot keep the serial of a device that is not registered yet")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	snapStates, err := snapstate.All(st)
+	if err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+	names := make([]string, 0, len(snapStates))
+	for name := range snapStates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var tss []*state.TaskSet
+	for _, name := range names {
+		snapst := snapStates[name]
+		if !snapst.Active || factoryResetKeepsSnap(name, snapst) {
+			continue
+		}
+		ts, err := snapstate.Disable(st, name)
+		if err != nil {
+			return nil, err
+		}
+		tss = append(tss, ts)
+	}
+
+	reset := st.NewTask("factory-reset", i18n.G("Unmount snaps and restart for the factory reset"))
+	reset.Set("keep-serial", opts.KeepSerial)
+	for _, ts := range tss {
+		reset.WaitAll(ts)
+	}
+
+	chg := st.NewChange("factory-reset", i18n.G("Reset the device to its factory state"))
+	for _, ts := range tss {
+		chg.AddAll(ts)
+	}
+	chg.AddTask(reset)
+	return chg, nil
+}
+
+// factoryResetKeepsSnap returns whether the given snap stays active
+// and mounted until the device has been seeded again, because it is
+// needed to boot or to run snapd.
+func factoryResetKeepsSnap(name string, snapst *snapstate.SnapState) bool {
+	typ, err := snapst.Type()
+	if err != nil {
+		return false
+	}
+	switch typ {
+	case snap.TypeSnapd, snap.TypeOS, snap.TypeKernel, snap.TypeGadget:
+		return true
+	}
+	return boot.InUse(name, snapst.Current)
+}
+
+func (m *DeviceManager) doFactoryReset(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var keepSerial bool
+	if err := t.Get("keep-serial", &keepSerial); err != nil && err != state.ErrNoState {
+		return err
+	}
+	req := factoryResetRequest{KeepSerial: keepSerial}
+	if keepSerial {
+		serial, err := findSerial(st, nil)
+		if err != nil {
+			return fmt.Errorf("cannot keep the serial: %v", err)
+		}
+		req.Serial, err = encodeWithPrerequisites(assertstate.DB(st), serial)
+		if err != nil {
+			return fmt.Errorf("cannot keep the serial: %v", err)
+		}
+	}
+
+	snapStates, err := snapstate.All(st)
+	if err != nil && err != state.ErrNoState {
+		return err
+	}
+	// the snaps not needed to boot were disabled by the previous
+	// tasks, unmount them and the inactive revisions of the others so
+	// that nothing but what is kept is in use when the data is wiped
+	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, progress.Null)
+	for name, snapst := range snapStates {
+		keep := factoryResetKeepsSnap(name, snapst)
+		for _, si := range snapst.Sequence {
+			if keep && si.Revision == snapst.Current {
+				continue
+			}
+			if boot.InUse(name, si.Revision) {
+				continue
+			}
+			if err := sysd.RemoveMountUnitFile(snap.MountDir(name, si.Revision)); err != nil {
+				return fmt.Errorf("cannot unmount snap %q (%s): %v", name, si.Revision, err)
+			}
+		}
+	}
+
+	data, err := json.Marshal(&req)
+	if err != nil {
+		return err
+	}
+	if err := osutil.AtomicWriteFile(dirs.SnapFactoryResetFile, data, 0600, 0); err != nil {
+		return fmt.Errorf("cannot request factory reset: %v", err)
+	}
+	logger.Noticef("factory reset requested, restarting")
+	st.RequestRestart(state.RestartSystem)
+	return nil
+}
+
+// encodeWithPrerequisites encodes the given assertion together with
+// the ones it needs to be added to a database, prerequisites first.
+func encodeWithPrerequisites(db asserts.RODatabase, a asserts.Assertion) (string, error) {
+	var buf bytes.Buffer
+	enc := asserts.NewEncoder(&buf)
+	retrieve := func(ref *asserts.Ref) (asserts.Assertion, error) {
+		return ref.Resolve(db.Find)
+	}
+	f := asserts.NewFetcher(db, retrieve, enc.Encode)
+	if err := f.Save(a); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// keptBlob returns the name of the snap of the given blob and whether
+// the blob is kept by the wipe of a factory reset, which is the case
+// if it is still mounted or the boot environment refers to it.
+func keptBlob(fn string) (name string, keep bool) {
+	if !strings.HasSuffix(fn, ".snap") {
+		return "", false
+	}
+	base := strings.TrimSuffix(fn, ".snap")
+	idx := strings.LastIndex(base, "_")
+	if idx <= 0 {
+		return "", false
+	}
+	name = base[:idx]
+	rev, err := snap.ParseRevision(base[idx+1:])
+	if err != nil {
+		return "", false
+	}
+	mountUnit := systemd.MountUnitPath(dirs.StripRootDir(snap.MountDir(name, rev)))
+	if osutil.FileExists(mountUnit) || boot.InUse(name, rev) {
+		return name, true
+	}
+	return name, false
+}
+
+// removeContents removes the entries of the given directory, except
+// the ones keep returns true for.
+func removeContents(dir string, keep func(name string) bool) error {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, fi := range entries {
+		if keep != nil && keep(fi.Name()) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WipeForFactoryReset wipes the writable data of the device if a
+// factory reset was requested, so that it gets seeded again from the
+// original seed. It must be called before the state is loaded.
+//
+// The change that requested the reset stopped and unmounted the snaps
+// that are not needed to boot, the snaps that are still mounted or
+// that the boot environment refers to are kept together with their
+// mount units and data.
+func WipeForFactoryReset() error {
+	data, err := ioutil.ReadFile(dirs.SnapFactoryResetFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read factory reset request: %v", err)
+	}
+	var req factoryResetRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fmt.Errorf("cannot decode factory reset request: %v", err)
+	}
+
+	logger.Noticef("performing requested factory reset")
+	if err := os.Remove(dirs.SnapStateFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot factory reset: %v", err)
+	}
+	wipeDirs := []string{dirs.SnapAssertsDBDir, dirs.SnapshotsDir, dirs.SnapCacheDir}
+	if !req.KeepSerial {
+		wipeDirs = append(wipeDirs, dirs.SnapDeviceDir)
+	}
+	for _, dir := range wipeDirs {
+		if err := removeContents(dir, nil); err != nil {
+			return fmt.Errorf("cannot factory reset: %v", err)
+		}
+	}
+	keptSnaps := make(map[string]bool)
+	err = removeContents(dirs.SnapBlobDir, func(fn string) bool {
+		name, keep := keptBlob(fn)
+		if keep {
+			keptSnaps[name] = true
+		}
+		return keep
+	})
+	if err != nil {
+		return fmt.Errorf("cannot factory reset: %v", err)
+	}
+	err = removeContents(dirs.SnapDataDir, func(name string) bool {
+		return keptSnaps[name]
+	})
+	if err != nil {
+		return fmt.Errorf("cannot factory reset: %v", err)
+	}
+
+	if req.KeepSerial && req.Serial != "" {
+		if err := os.MkdirAll(dirs.SnapDeviceDir, 0700); err != nil {
+			return err
+		}
+		if err := osutil.AtomicWriteFile(factoryResetSerialFile(), []byte(req.Serial), 0600, 0); err != nil {
+			return fmt.Errorf("cannot keep serial across factory reset: %v", err)
+		}
+	}
+	// only now the wipe is complete
+	return os.Remove(dirs.SnapFactoryResetFile)
+}
+
+// restoreSerialAfterFactoryReset sets up the device with the serial
+// kept across a factory reset, if any and matching the given model.
+func restoreSerialAfterFactoryReset(st *state.State, device *auth.DeviceState, model *asserts.Model) error {
+	f, err := os.Open(factoryResetSerialFile())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	batch := asserts.NewBatch(nil)
+	var serial *asserts.Serial
+	dec := asserts.NewDecoder(f)
+	for {
+		a, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("cannot decode serial kept across factory reset: %v", err)
+		}
+		if s, ok := a.(*asserts.Serial); ok {
+			serial = s
+		}
+		if err := batch.Add(a); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case serial == nil:
+		logger.Noticef("no serial kept across factory reset")
+	case serial.BrandID() != model.BrandID() || serial.Model() != model.Model():
+		logger.Noticef("cannot restore serial for %s/%s kept across factory reset on a %s/%s device", serial.BrandID(), serial.Model(), model.BrandID(), model.Model())
+	default:
+		if err := assertstate.AddBatch(st, batch, nil); err != nil {
+			return fmt.Errorf("cannot restore serial kept across factory reset: %v", err)
+		}
+		device.KeyID = serial.DeviceKey().ID()
+		device.Serial = serial.Serial()
+		if err := internal.SetDevice(st, device); err != nil {
+			return err
+		}
+	}
+	f.Close()
+	return os.Remove(factoryResetSerialFile())
+}
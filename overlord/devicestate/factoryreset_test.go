@@ -0,0 +1,408 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package devicestate_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/assertstate/assertstatetest"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/devicestate"
+	"github.com/snapcore/snapd/overlord/devicestate/devicestatetest"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func (s *deviceMgrSuite) mockSnapForFactoryReset(c *C, name, typ string, active bool, revs ...int) {
+	var seq []*snap.SideInfo
+	for _, rev := range revs {
+		si := &snap.SideInfo{RealName: name, Revision: snap.R(rev)}
+		snaptest.MockSnap(c, fmt.Sprintf("name: %s\nversion: 1.0\ntype: %s\n", name, typ), si)
+		seq = append(seq, si)
+	}
+	snapstate.Set(s.state, name, &snapstate.SnapState{
+		SnapType: typ,
+		Active:   active,
+		Sequence: seq,
+		Current:  seq[len(seq)-1].Revision,
+	})
+}
+
+func (s *deviceMgrSuite) mockSnapsForFactoryReset(c *C) {
+	s.bootloader.SetBootVars(map[string]string{
+		"snap_core":   "core18_2.snap",
+		"snap_kernel": "pc-kernel_1.snap",
+	})
+	s.mockSnapForFactoryReset(c, "snapd", "snapd", true, 3)
+	s.mockSnapForFactoryReset(c, "core18", "base", true, 1, 2)
+	s.mockSnapForFactoryReset(c, "pc-kernel", "kernel", true, 1)
+	s.mockSnapForFactoryReset(c, "pc", "gadget", true, 1)
+	s.mockSnapForFactoryReset(c, "foo", "app", true, 1, 2)
+	s.mockSnapForFactoryReset(c, "bar", "app", false, 1)
+}
+
+func mountUnit(name string, rev int) string {
+	return systemd.MountUnitPath(dirs.StripRootDir(snap.MountDir(name, snap.R(rev))))
+}
+
+func (s *deviceMgrSuite) TestFactoryReset(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.state.Set("seeded", true)
+	s.mockSnapsForFactoryReset(c)
+
+	chg, err := devicestate.FactoryReset(s.state, nil)
+	c.Assert(err, IsNil)
+	c.Check(chg.Kind(), Equals, "factory-reset")
+
+	// only the active snaps not needed to boot or to run snapd are
+	// disabled, before the actual reset
+	tasks := chg.Tasks()
+	var kinds []string
+	for _, t := range tasks {
+		kinds = append(kinds, t.Kind())
+	}
+	c.Check(kinds, DeepEquals, []string{"stop-snap-services", "remove-aliases", "unlink-snap", "remove-profiles", "factory-reset"})
+	snapsup, err := snapstate.TaskSnapSetup(tasks[0])
+	c.Assert(err, IsNil)
+	c.Check(snapsup.InstanceName(), Equals, "foo")
+	reset := tasks[len(tasks)-1]
+	c.Check(reset.WaitTasks(), DeepEquals, tasks[:len(tasks)-1])
+	var keepSerial bool
+	c.Check(reset.Get("keep-serial", &keepSerial), IsNil)
+	c.Check(keepSerial, Equals, false)
+
+	// nothing happens until the change runs
+	c.Check(dirs.SnapFactoryResetFile, testutil.FileAbsent)
+	c.Check(s.restartRequests, HasLen, 0)
+}
+
+func (s *deviceMgrSuite) TestDoFactoryReset(c *C) {
+	var systemctlCalls [][]string
+	restore := systemd.MockSystemctl(func(args ...string) ([]byte, error) {
+		systemctlCalls = append(systemctlCalls, args)
+		return nil, nil
+	})
+	defer restore()
+
+	s.state.Lock()
+	s.state.Set("seeded", true)
+	s.mockSnapsForFactoryReset(c)
+	// foo was disabled by the earlier tasks of the change
+	s.mockSnapForFactoryReset(c, "foo", "app", false, 1, 2)
+	kept := []string{
+		mountUnit("snapd", 3),
+		mountUnit("core18", 2),
+		mountUnit("pc-kernel", 1),
+		mountUnit("pc", 1),
+	}
+	removed := []string{
+		mountUnit("core18", 1),
+		mountUnit("foo", 1),
+		mountUnit("foo", 2),
+		mountUnit("bar", 1),
+	}
+	for _, fn := range append(kept, removed...) {
+		c.Assert(os.MkdirAll(filepath.Dir(fn), 0755), IsNil)
+		c.Assert(ioutil.WriteFile(fn, nil, 0644), IsNil)
+	}
+
+	chg := s.state.NewChange("factory-reset", "...")
+	t := s.state.NewTask("factory-reset", "...")
+	t.Set("keep-serial", false)
+	chg.AddTask(t)
+	s.state.Unlock()
+
+	s.settle(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Assert(chg.Err(), IsNil)
+
+	for _, unit := range kept {
+		c.Check(unit, testutil.FilePresent)
+	}
+	for _, unit := range removed {
+		c.Check(unit, testutil.FileAbsent)
+	}
+	// systemd forgets about the removed units
+	c.Check(systemctlCalls, testutil.DeepContains, []string{"daemon-reload"})
+
+	c.Check(dirs.SnapFactoryResetFile, testutil.FileEquals, `{}`)
+	c.Check(s.restartRequests, DeepEquals, []state.RestartType{state.RestartSystem})
+}
+
+func (s *deviceMgrSuite) TestDoFactoryResetKeepSerial(c *C) {
+	s.state.Lock()
+	s.state.Set("seeded", true)
+	s.makeModelAssertionInState(c, "canonical", "pc", map[string]interface{}{
+		"architecture": "amd64",
+		"kernel":       "pc-kernel",
+		"gadget":       "pc",
+	})
+	devicestatetest.SetDevice(s.state, &auth.DeviceState{
+		Brand:  "canonical",
+		Model:  "pc",
+		Serial: "8989",
+	})
+	s.makeSerialAssertionInState(c, "canonical", "pc", "8989")
+
+	chg := s.state.NewChange("factory-reset", "...")
+	t := s.state.NewTask("factory-reset", "...")
+	t.Set("keep-serial", true)
+	chg.AddTask(t)
+	s.state.Unlock()
+
+	s.settle(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Assert(chg.Err(), IsNil)
+	c.Check(s.restartRequests, DeepEquals, []state.RestartType{state.RestartSystem})
+
+	data, err := ioutil.ReadFile(dirs.SnapFactoryResetFile)
+	c.Assert(err, IsNil)
+	var req map[string]interface{}
+	c.Assert(json.Unmarshal(data, &req), IsNil)
+	c.Check(req["keep-serial"], Equals, true)
+	c.Check(req["serial"], Matches, `(?s)type: serial\n.*serial: 8989\n.*`)
+}
+
+func (s *deviceMgrSuite) TestFactoryResetErrors(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	_, err := devicestate.FactoryReset(s.state, nil)
+	c.Check(err, ErrorMatches, "cannot factory reset until fully seeded")
+
+	s.state.Set("seeded", true)
+	_, err = devicestate.FactoryReset(s.state, &devicestate.FactoryResetOptions{KeepSerial: true})
+	c.Check(err, ErrorMatches, "cannot keep the serial of a device that is not registered yet")
+
+	chg := s.state.NewChange("install", "...")
+	chg.AddTask(s.state.NewTask("nop", "..."))
+	_, err = devicestate.FactoryReset(s.state, nil)
+	c.Check(err, FitsTypeOf, &snapstate.ChangeConflictError{})
+	chg.Abort()
+	chg.SetStatus(state.HoldStatus)
+
+	restore := release.MockOnClassic(true)
+	defer restore()
+	_, err = devicestate.FactoryReset(s.state, nil)
+	c.Check(err, ErrorMatches, "cannot factory reset a classic system")
+
+	c.Check(s.state.Changes(), HasLen, 1)
+}
+
+func (s *deviceMgrSuite) mockWritableData(c *C) {
+	s.bootloader.SetBootVars(map[string]string{
+		"snap_core":   "core18_2.snap",
+		"snap_kernel": "pc-kernel_1.snap",
+	})
+	for _, fn := range []string{
+		dirs.SnapStateFile,
+		filepath.Join(dirs.SnapAssertsDBDir, "asserts-v0", "model"),
+		filepath.Join(dirs.SnapBlobDir, "foo_1.snap"),
+		filepath.Join(dirs.SnapBlobDir, "snapd_3.snap"),
+		filepath.Join(dirs.SnapBlobDir, "core18_1.snap"),
+		filepath.Join(dirs.SnapBlobDir, "core18_2.snap"),
+		filepath.Join(dirs.SnapBlobDir, "pc-kernel_1.snap"),
+		filepath.Join(dirs.SnapBlobDir, ".partial", "bar_1.snap.partial"),
+		filepath.Join(dirs.SnapDataDir, "foo", "1", "data"),
+		filepath.Join(dirs.SnapDataDir, "snapd", "common", "data"),
+		filepath.Join(dirs.SnapshotsDir, "1_foo_1.zip"),
+		filepath.Join(dirs.SnapCacheDir, "names"),
+		filepath.Join(dirs.SnapDeviceDir, "private-keys-v1", "key"),
+		// left mounted by the change requesting the reset
+		mountUnit("snapd", 3),
+		mountUnit("core18", 2),
+		mountUnit("pc-kernel", 1),
+		filepath.Join(dirs.SnapServicesDir, "other.service"),
+		filepath.Join(dirs.SnapSeedDir, "seed.yaml"),
+	} {
+		c.Assert(os.MkdirAll(filepath.Dir(fn), 0755), IsNil)
+		c.Assert(ioutil.WriteFile(fn, nil, 0644), IsNil)
+	}
+}
+
+func (s *deviceMgrSuite) TestWipeForFactoryReset(c *C) {
+	s.mockWritableData(c)
+	c.Assert(ioutil.WriteFile(dirs.SnapFactoryResetFile, []byte(`{}`), 0600), IsNil)
+
+	err := devicestate.WipeForFactoryReset()
+	c.Assert(err, IsNil)
+
+	for _, fn := range []string{
+		dirs.SnapStateFile,
+		filepath.Join(dirs.SnapAssertsDBDir, "asserts-v0"),
+		filepath.Join(dirs.SnapBlobDir, "foo_1.snap"),
+		filepath.Join(dirs.SnapBlobDir, "core18_1.snap"),
+		filepath.Join(dirs.SnapBlobDir, ".partial"),
+		filepath.Join(dirs.SnapDataDir, "foo"),
+		filepath.Join(dirs.SnapshotsDir, "1_foo_1.zip"),
+		filepath.Join(dirs.SnapCacheDir, "names"),
+		filepath.Join(dirs.SnapDeviceDir, "private-keys-v1"),
+		dirs.SnapFactoryResetFile,
+	} {
+		c.Check(fn, testutil.FileAbsent)
+	}
+	// the snaps still mounted or used for booting, their data and
+	// units are kept, as well as the seed and other units
+	for _, fn := range []string{
+		filepath.Join(dirs.SnapBlobDir, "snapd_3.snap"),
+		filepath.Join(dirs.SnapBlobDir, "core18_2.snap"),
+		filepath.Join(dirs.SnapBlobDir, "pc-kernel_1.snap"),
+		filepath.Join(dirs.SnapDataDir, "snapd", "common", "data"),
+		mountUnit("snapd", 3),
+		mountUnit("core18", 2),
+		mountUnit("pc-kernel", 1),
+		filepath.Join(dirs.SnapServicesDir, "other.service"),
+		filepath.Join(dirs.SnapSeedDir, "seed.yaml"),
+	} {
+		c.Check(fn, testutil.FilePresent)
+	}
+}
+
+func (s *deviceMgrSuite) TestWipeForFactoryResetKeepSerial(c *C) {
+	s.mockWritableData(c)
+	c.Assert(ioutil.WriteFile(dirs.SnapFactoryResetFile, []byte(`{"keep-serial":true,"serial":"serial-assertions"}`), 0600), IsNil)
+
+	err := devicestate.WipeForFactoryReset()
+	c.Assert(err, IsNil)
+
+	c.Check(dirs.SnapStateFile, testutil.FileAbsent)
+	c.Check(dirs.SnapFactoryResetFile, testutil.FileAbsent)
+	c.Check(filepath.Join(dirs.SnapDeviceDir, "private-keys-v1", "key"), testutil.FilePresent)
+	c.Check(filepath.Join(dirs.SnapDeviceDir, "factory-reset-serial"), testutil.FileEquals, "serial-assertions")
+}
+
+func (s *deviceMgrSuite) TestWipeForFactoryResetNotRequested(c *C) {
+	s.mockWritableData(c)
+
+	err := devicestate.WipeForFactoryReset()
+	c.Assert(err, IsNil)
+	c.Check(dirs.SnapStateFile, testutil.FilePresent)
+	c.Check(filepath.Join(dirs.SnapBlobDir, "foo_1.snap"), testutil.FilePresent)
+}
+
+func (s *deviceMgrSuite) TestRestoreSerialAfterFactoryReset(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.state.Set("seeded", true)
+
+	s.makeModelAssertionInState(c, "my-brand", "my-model", map[string]interface{}{
+		"architecture": "amd64",
+		"kernel":       "pc-kernel",
+		"gadget":       "pc",
+	})
+	serial := s.makeSerialAssertionInState(c, "my-brand", "my-model", "8989")
+	devicestatetest.SetDevice(s.state, &auth.DeviceState{
+		Brand:  "my-brand",
+		Model:  "my-model",
+		Serial: "8989",
+		KeyID:  serial.DeviceKey().ID(),
+	})
+	chg := s.state.NewChange("factory-reset", "...")
+	t := s.state.NewTask("factory-reset", "...")
+	t.Set("keep-serial", true)
+	chg.AddTask(t)
+	s.state.Unlock()
+	s.settle(c)
+	s.state.Lock()
+	c.Assert(chg.Err(), IsNil)
+	c.Assert(devicestate.WipeForFactoryReset(), IsNil)
+
+	// seeding again starts from a fresh database with the assertions
+	// from the seed
+	db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{
+		Backstore:       asserts.NewMemoryBackstore(),
+		Trusted:         s.storeSigning.Trusted,
+		OtherPredefined: s.storeSigning.Generic,
+	})
+	c.Assert(err, IsNil)
+	assertstate.ReplaceDB(s.state, db)
+	c.Assert(db.Add(s.storeSigning.StoreAccountKey("")), IsNil)
+	model := s.brands.Model("my-brand", "my-model", map[string]interface{}{
+		"architecture": "amd64",
+		"kernel":       "pc-kernel",
+		"gadget":       "pc",
+	})
+	assertstatetest.AddMany(s.state, s.brands.AccountsAndKeys("my-brand")...)
+	assertstatetest.AddMany(s.state, model)
+	device := &auth.DeviceState{Brand: "my-brand", Model: "my-model"}
+	devicestatetest.SetDevice(s.state, device)
+
+	err = devicestate.RestoreSerialAfterFactoryReset(s.state, device, model)
+	c.Assert(err, IsNil)
+
+	device, err = devicestatetest.Device(s.state)
+	c.Assert(err, IsNil)
+	c.Check(device.Serial, Equals, "8989")
+	c.Check(device.KeyID, Equals, serial.DeviceKey().ID())
+	_, err = db.Find(asserts.SerialType, map[string]string{
+		"brand-id": "my-brand",
+		"model":    "my-model",
+		"serial":   "8989",
+	})
+	c.Check(err, IsNil)
+	c.Check(filepath.Join(dirs.SnapDeviceDir, "factory-reset-serial"), testutil.FileAbsent)
+}
+
+func (s *deviceMgrSuite) TestRestoreSerialAfterFactoryResetOtherModel(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.makeModelAssertionInState(c, "my-brand", "my-model", map[string]interface{}{
+		"architecture": "amd64",
+		"kernel":       "pc-kernel",
+		"gadget":       "pc",
+	})
+	serial := s.makeSerialAssertionInState(c, "my-brand", "my-model", "8989")
+	c.Assert(os.MkdirAll(dirs.SnapDeviceDir, 0700), IsNil)
+	serialFile := filepath.Join(dirs.SnapDeviceDir, "factory-reset-serial")
+	c.Assert(ioutil.WriteFile(serialFile, asserts.Encode(serial), 0600), IsNil)
+
+	model := s.brands.Model("my-brand", "other-model", map[string]interface{}{
+		"architecture": "amd64",
+		"kernel":       "pc-kernel",
+		"gadget":       "pc",
+	})
+	device := &auth.DeviceState{Brand: "my-brand", Model: "other-model"}
+	devicestatetest.SetDevice(s.state, device)
+
+	err := devicestate.RestoreSerialAfterFactoryReset(s.state, device, model)
+	c.Assert(err, IsNil)
+	c.Check(device.Serial, Equals, "")
+	c.Check(serialFile, testutil.FileAbsent)
+}
@@ -255,5 +255,10 @@ func importAssertionsFromSeed(st *state.State, deviceSeed seed.Seed) (*asserts.M
 		return nil, err
 	}
 
+	// reuse the serial if kept across a factory reset
+	if err := restoreSerialAfterFactoryReset(st, device, modelAssertion); err != nil {
+		return nil, err
+	}
+
 	return modelAssertion, nil
 }
@@ -563,6 +563,9 @@ func getSerial(t *state.Task, regCtx registrationContext, privKey asserts.Privat
 		Timeout:    30 * time.Second,
 		MayLogBody: true,
 		Proxy:      proxyConf.Conf,
+		ExtraSSLCerts: &httputil.ExtraSSLCertsFromDir{
+			Dir: dirs.SnapdStoreSSLCertsDir,
+		},
 	})
 
 	cfg, err := getSerialRequestConfig(t, regCtx, client)
@@ -984,9 +987,35 @@ func gadgetCurrentAndUpdate(st *state.State, snapsup *snapstate.SnapSetup) (curr
 }
 
 var (
-	gadgetUpdate = gadget.Update
+	gadgetUpdate       = gadget.Update
+	gadgetVerifyUpdate = gadget.VerifyUpdate
 )
 
+// verifyGadgetUpdate checks that the content of the updated structures
+// matches the new gadget. Any problems found are logged, but do not cause the
+// update to fail, as the update has been applied already.
+func verifyGadgetUpdate(t *state.Task, current, update gadget.GadgetData) {
+	st := t.State()
+	st.Unlock()
+	reports, err := gadgetVerifyUpdate(current, update)
+	st.Lock()
+	if err != nil {
+		t.Logf("Cannot verify gadget assets update: %v", err)
+		logger.Noticef("cannot verify gadget assets update: %v", err)
+		return
+	}
+	for _, r := range reports {
+		switch {
+		case r.Err != nil:
+			t.Logf("Cannot verify gadget assets update: %v", r.Err)
+			logger.Noticef("cannot verify gadget assets update: %v", r.Err)
+		case len(r.Mismatches) != 0:
+			t.Logf("Volume structure %v does not match the gadget after update: %v", r.Structure, strings.Join(r.Mismatches, ", "))
+			logger.Noticef("volume structure %v does not match the gadget after update: %v", r.Structure, strings.Join(r.Mismatches, ", "))
+		}
+	}
+}
+
 func (m *DeviceManager) doUpdateGadgetAssets(t *state.Task, _ *tomb.Tomb) error {
 	if release.OnClassic {
 		return fmt.Errorf("cannot run update gadget assets task on a classic system")
@@ -1027,6 +1056,8 @@ func (m *DeviceManager) doUpdateGadgetAssets(t *state.Task, _ *tomb.Tomb) error
 		return err
 	}
 
+	verifyGadgetUpdate(t, *currentData, *updateData)
+
 	t.SetStatus(state.DoneStatus)
 
 	if err := os.RemoveAll(snapRollbackDir); err != nil && !os.IsNotExist(err) {
@@ -0,0 +1,279 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package devicestate
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/seed"
+	"github.com/snapcore/snapd/seed/seedwriter"
+)
+
+// ErrNoSystem is returned when the requested recovery system does not
+// exist.
+var ErrNoSystem = errors.New("no such system")
+
+// System describes a recovery system found under the seed.
+type System struct {
+	// Label of the system, which is also the name of its directory.
+	Label string
+	// Model of the system.
+	Model *asserts.Model
+}
+
+// systemsDir returns the directory holding the recovery systems.
+func systemsDir() string {
+	return filepath.Join(dirs.SnapSeedDir, "systems")
+}
+
+var validSystemLabel = regexp.MustCompile(`^[a-zA-Z0-9](?:-?[a-zA-Z0-9])*$`)
+
+// ValidateSystemLabel checks that the given recovery system label is
+// made of letters, digits and dashes, and neither starts nor ends with
+// a dash.
+func ValidateSystemLabel(label string) error {
+	if !validSystemLabel.MatchString(label) {
+		return fmt.Errorf("invalid recovery system label %q", label)
+	}
+	return nil
+}
+
+func loadSystem(label string) (*System, error) {
+	sd, err := seed.Open(filepath.Join(systemsDir(), label))
+	if err != nil {
+		return nil, err
+	}
+	if err := sd.LoadAssertions(nil, nil); err != nil {
+		return nil, err
+	}
+	model, err := sd.Model()
+	if err != nil {
+		return nil, err
+	}
+	return &System{Label: label, Model: model}, nil
+}
+
+// Systems returns the recovery systems available in the seed, sorted
+// by label. Systems that cannot be loaded are skipped.
+func Systems() ([]*System, error) {
+	entries, err := ioutil.ReadDir(systemsDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var systems []*System
+	for _, fi := range entries {
+		if !fi.IsDir() || ValidateSystemLabel(fi.Name()) != nil {
+			continue
+		}
+		system, err := loadSystem(fi.Name())
+		if err != nil {
+			logger.Noticef("cannot load recovery system %q: %v", fi.Name(), err)
+			continue
+		}
+		systems = append(systems, system)
+	}
+	sort.Slice(systems, func(i, j int) bool {
+		return systems[i].Label < systems[j].Label
+	})
+	return systems, nil
+}
+
+// CreateRecoverySystem returns a change creating a new recovery system
+// with the given label out of the currently installed snaps of the
+// model.
+func CreateRecoverySystem(st *state.State, label string) (*state.Change, error) {
+	if release.OnClassic {
+		return nil, fmt.Errorf("cannot create recovery systems on classic")
+	}
+	if err := ValidateSystemLabel(label); err != nil {
+		return nil, err
+	}
+	if osutil.FileExists(filepath.Join(systemsDir(), label)) {
+		return nil, fmt.Errorf("recovery system %q already exists", label)
+	}
+	for _, chg := range st.Changes() {
+		if !chg.IsReady() && chg.Kind() == "create-recovery-system" {
+			return nil, &snapstate.ChangeConflictError{Message: "cannot create a recovery system, another one is being created"}
+		}
+	}
+	if _, err := findModel(st); err != nil {
+		return nil, fmt.Errorf("cannot create a recovery system without a model: %v", err)
+	}
+
+	msg := fmt.Sprintf(i18n.G("Create recovery system %q"), label)
+	create := st.NewTask("create-recovery-system", msg)
+	create.Set("recovery-system-label", label)
+
+	chg := st.NewChange("create-recovery-system", msg)
+	chg.AddTask(create)
+	return chg, nil
+}
+
+// RequestSystemAction arranges for the device to reboot into the
+// recovery system with the given label in the given mode.
+func RequestSystemAction(st *state.State, label, mode string) error {
+	if release.OnClassic {
+		return fmt.Errorf("cannot reboot into a recovery system on classic")
+	}
+	if err := boot.ValidateMode(mode); err != nil {
+		return err
+	}
+	if err := ValidateSystemLabel(label); err != nil {
+		return err
+	}
+	if !osutil.IsDirectory(filepath.Join(systemsDir(), label)) {
+		return ErrNoSystem
+	}
+	if err := boot.SetRecoveryBootSystemAndMode(label, mode); err != nil {
+		return fmt.Errorf("cannot set device to boot into recovery system %q in %s mode: %v", label, mode, err)
+	}
+	logger.Noticef("restarting into recovery system %q in %s mode", label, mode)
+	st.RequestRestart(state.RestartSystem)
+	return nil
+}
+
+func (m *DeviceManager) doCreateRecoverySystem(t *state.Task, _ *tomb.Tomb) (err error) {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var label string
+	if err := t.Get("recovery-system-label", &label); err != nil {
+		return err
+	}
+	systemDir := filepath.Join(systemsDir(), label)
+	if osutil.FileExists(systemDir) {
+		return fmt.Errorf("recovery system %q already exists", label)
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(systemDir)
+		}
+	}()
+
+	model, err := findModel(st)
+	if err != nil {
+		return fmt.Errorf("cannot find device model: %v", err)
+	}
+	db := assertstate.DB(st)
+	newFetcher := func(save func(asserts.Assertion) error) asserts.Fetcher {
+		retrieve := func(ref *asserts.Ref) (asserts.Assertion, error) {
+			return ref.Resolve(db.Find)
+		}
+		return asserts.NewFetcher(db, retrieve, save)
+	}
+
+	w, err := seedwriter.New(model, &seedwriter.Options{SeedDir: systemDir})
+	if err != nil {
+		return err
+	}
+	if err := w.SetOptionsSnaps(nil); err != nil {
+		return err
+	}
+	if err := w.Start(db, newFetcher); err != nil {
+		return err
+	}
+	seedSnaps, err := w.SnapsToDownload()
+	if err != nil {
+		return err
+	}
+
+	f := seedwriter.MakeRefAssertsFetcher(newFetcher)
+	blobs := make(map[string]string, len(seedSnaps))
+	for _, sn := range seedSnaps {
+		info, err := snapstate.CurrentInfo(st, sn.SnapName())
+		if err != nil {
+			return fmt.Errorf("cannot use snap %q for the recovery system: %v", sn.SnapName(), err)
+		}
+		if err := w.SetInfo(sn, info); err != nil {
+			return err
+		}
+		blobs[sn.Path] = info.MountFile()
+
+		sn.ARefs = []*asserts.Ref{}
+		if info.SnapID == "" {
+			continue
+		}
+		digest, _, err := asserts.SnapFileSHA3_384(info.MountFile())
+		if err != nil {
+			return fmt.Errorf("cannot compute digest of snap %q: %v", info.SnapName(), err)
+		}
+		f.ResetRefs()
+		for _, ref := range []*asserts.Ref{
+			{Type: asserts.SnapDeclarationType, PrimaryKey: []string{release.Series, info.SnapID}},
+			{Type: asserts.SnapRevisionType, PrimaryKey: []string{digest}},
+		} {
+			if err := f.Fetch(ref); err != nil {
+				return fmt.Errorf("cannot find assertions for snap %q: %v", info.SnapName(), err)
+			}
+		}
+		sn.ARefs = f.Refs()
+	}
+
+	// copying the snaps can take a while, do not hold the state lock
+	st.Unlock()
+	for dst, src := range blobs {
+		if err = osutil.CopyFile(src, dst, osutil.CopyFlagOverwrite); err != nil {
+			break
+		}
+	}
+	st.Lock()
+	if err != nil {
+		return fmt.Errorf("cannot copy snaps into the recovery system: %v", err)
+	}
+
+	if _, err := w.Downloaded(); err != nil {
+		return err
+	}
+	if err := w.SeedSnaps(); err != nil {
+		return err
+	}
+	return w.WriteMeta()
+}
+
+func (m *DeviceManager) undoCreateRecoverySystem(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var label string
+	if err := t.Get("recovery-system-label", &label); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(systemsDir(), label))
+}
@@ -0,0 +1,227 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package devicestate_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/assertstate/assertstatetest"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/devicestate"
+	"github.com/snapcore/snapd/overlord/devicestate/devicestatetest"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/seed"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func (s *deviceMgrSuite) setupRecoverySystemSnaps(c *C) {
+	c.Assert(os.MkdirAll(dirs.SnapBlobDir, 0755), IsNil)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.makeModelAssertionInState(c, "my-brand", "my-model", map[string]interface{}{
+		"architecture": "amd64",
+		"kernel":       "pc-kernel",
+		"gadget":       "pc",
+	})
+	devicestatetest.SetDevice(s.state, &auth.DeviceState{
+		Brand: "my-brand",
+		Model: "my-model",
+	})
+	s.makeInstalledSnap(c, "core", "os", 11)
+	s.makeInstalledSnap(c, "pc-kernel", "kernel", 12)
+	s.makeInstalledSnap(c, "pc", "gadget", 13)
+}
+
+func (s *deviceMgrSuite) makeInstalledSnap(c *C, name, typ string, rev int) {
+	snapID := name + strings.Repeat("id", 16)[len(name):]
+	si := &snap.SideInfo{RealName: name, Revision: snap.R(rev), SnapID: snapID}
+	snapstate.Set(s.state, name, &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+		SnapType: typ,
+	})
+	info := snaptest.MockSnap(c, fmt.Sprintf("name: %s\nversion: 1.0\ntype: %s\n", name, typ), si)
+	c.Assert(ioutil.WriteFile(info.MountFile(), []byte("blob of "+name), 0644), IsNil)
+
+	digest, size, err := asserts.SnapFileSHA3_384(info.MountFile())
+	c.Assert(err, IsNil)
+	snapDecl, err := s.storeSigning.Sign(asserts.SnapDeclarationType, map[string]interface{}{
+		"series":       "16",
+		"snap-name":    name,
+		"snap-id":      snapID,
+		"publisher-id": "canonical",
+		"timestamp":    time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	snapRev, err := s.storeSigning.Sign(asserts.SnapRevisionType, map[string]interface{}{
+		"snap-sha3-384": digest,
+		"snap-size":     fmt.Sprintf("%d", size),
+		"snap-id":       snapID,
+		"developer-id":  "canonical",
+		"snap-revision": fmt.Sprintf("%d", rev),
+		"timestamp":     time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	assertstatetest.AddMany(s.state, snapDecl, snapRev)
+}
+
+func (s *deviceMgrSuite) runRecoverySystemChange(c *C) {
+	s.state.Unlock()
+	defer s.state.Lock()
+	for i := 0; i < 6; i++ {
+		s.se.Ensure()
+		s.se.Wait()
+	}
+}
+
+func (s *deviceMgrSuite) TestValidateSystemLabel(c *C) {
+	for _, label := range []string{"20191119", "my-system-1", "a"} {
+		c.Check(devicestate.ValidateSystemLabel(label), IsNil, Commentf(label))
+	}
+	for _, label := range []string{"", "-a", "a-", "a--b", "a/b", "..", "a b"} {
+		c.Check(devicestate.ValidateSystemLabel(label), ErrorMatches, `invalid recovery system label ".*"`, Commentf(label))
+	}
+}
+
+func (s *deviceMgrSuite) TestRecoverySystemsNone(c *C) {
+	systems, err := devicestate.Systems()
+	c.Assert(err, IsNil)
+	c.Check(systems, HasLen, 0)
+}
+
+func (s *deviceMgrSuite) TestCreateRecoverySystemHappy(c *C) {
+	s.setupRecoverySystemSnaps(c)
+	restore := seed.MockTrusted(s.storeSigning.Trusted)
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	chg, err := devicestate.CreateRecoverySystem(s.state, "20191119")
+	c.Assert(err, IsNil)
+	c.Check(chg.Kind(), Equals, "create-recovery-system")
+	c.Check(chg.Summary(), Equals, `Create recovery system "20191119"`)
+
+	s.runRecoverySystemChange(c)
+	c.Assert(chg.IsReady(), Equals, true)
+	c.Assert(chg.Err(), IsNil)
+
+	systemDir := filepath.Join(dirs.SnapSeedDir, "systems", "20191119")
+	c.Check(filepath.Join(systemDir, "seed.yaml"), testutil.FilePresent)
+	c.Check(filepath.Join(systemDir, "assertions", "model"), testutil.FilePresent)
+	c.Check(filepath.Join(systemDir, "snaps", "core_11.snap"), testutil.FileEquals, "blob of core")
+	c.Check(filepath.Join(systemDir, "snaps", "pc-kernel_12.snap"), testutil.FileEquals, "blob of pc-kernel")
+	c.Check(filepath.Join(systemDir, "snaps", "pc_13.snap"), testutil.FileEquals, "blob of pc")
+
+	systems, err := devicestate.Systems()
+	c.Assert(err, IsNil)
+	c.Assert(systems, HasLen, 1)
+	c.Check(systems[0].Label, Equals, "20191119")
+	c.Check(systems[0].Model.BrandID(), Equals, "my-brand")
+	c.Check(systems[0].Model.Model(), Equals, "my-model")
+
+	_, err = devicestate.CreateRecoverySystem(s.state, "20191119")
+	c.Check(err, ErrorMatches, `recovery system "20191119" already exists`)
+}
+
+func (s *deviceMgrSuite) TestCreateRecoverySystemUndoOnError(c *C) {
+	s.setupRecoverySystemSnaps(c)
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// the installed pc-kernel blob went missing
+	c.Assert(os.Remove(filepath.Join(dirs.SnapBlobDir, "pc-kernel_12.snap")), IsNil)
+
+	chg, err := devicestate.CreateRecoverySystem(s.state, "broken")
+	c.Assert(err, IsNil)
+
+	s.runRecoverySystemChange(c)
+	c.Assert(chg.IsReady(), Equals, true)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*cannot compute digest of snap "pc-kernel".*`)
+	c.Check(filepath.Join(dirs.SnapSeedDir, "systems", "broken"), testutil.FileAbsent)
+}
+
+func (s *deviceMgrSuite) TestCreateRecoverySystemErrors(c *C) {
+	s.setupRecoverySystemSnaps(c)
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	_, err := devicestate.CreateRecoverySystem(s.state, "-bad")
+	c.Check(err, ErrorMatches, `invalid recovery system label "-bad"`)
+
+	chg, err := devicestate.CreateRecoverySystem(s.state, "20191119")
+	c.Assert(err, IsNil)
+	_, err = devicestate.CreateRecoverySystem(s.state, "20191120")
+	c.Check(err, FitsTypeOf, &snapstate.ChangeConflictError{})
+	chg.Abort()
+
+	restore := release.MockOnClassic(true)
+	defer restore()
+	_, err = devicestate.CreateRecoverySystem(s.state, "20191120")
+	c.Check(err, ErrorMatches, "cannot create recovery systems on classic")
+}
+
+func (s *deviceMgrSuite) TestRequestSystemAction(c *C) {
+	c.Assert(os.MkdirAll(filepath.Join(dirs.SnapSeedDir, "systems", "20191119"), 0755), IsNil)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	err := devicestate.RequestSystemAction(s.state, "20191119", "recover")
+	c.Assert(err, IsNil)
+	c.Check(s.bootloader.BootVars, DeepEquals, map[string]string{
+		"snapd_recovery_system": "20191119",
+		"snapd_recovery_mode":   "recover",
+	})
+	c.Check(s.restartRequests, DeepEquals, []state.RestartType{state.RestartSystem})
+}
+
+func (s *deviceMgrSuite) TestRequestSystemActionErrors(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	err := devicestate.RequestSystemAction(s.state, "20191119", "install")
+	c.Check(err, Equals, devicestate.ErrNoSystem)
+	err = devicestate.RequestSystemAction(s.state, "20191119", "reinstall")
+	c.Check(err, ErrorMatches, `invalid system mode "reinstall"`)
+
+	restore := release.MockOnClassic(true)
+	defer restore()
+	err = devicestate.RequestSystemAction(s.state, "20191119", "install")
+	c.Check(err, ErrorMatches, "cannot reboot into a recovery system on classic")
+
+	c.Check(s.bootloader.BootVars, HasLen, 0)
+	c.Check(s.restartRequests, HasLen, 0)
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/snapcore/snapd/overlord/configstate"
 	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/ifacestate/ifacerepo"
 	"github.com/snapcore/snapd/overlord/state"
 )
 
@@ -80,6 +81,10 @@ by explicitly requesting that via the --plug and --slot command line options:
     $ snapctl get :myplug --slot usb-vendor
 
 This requests the "usb-vendor" setting from the slot that is connected to "myplug".
+
+Outside of interface hooks, the settings are read from the current connection
+of the plug or slot. Reading the setting of the connected snap's endpoint then
+requires the plug or slot to have exactly one connection.
 `)
 
 func init() {
@@ -276,10 +281,18 @@ func attributesTask(context *hookstate.Context) (*state.Task, error) {
 }
 
 func (c *getCommand) getInterfaceSetting(context *hookstate.Context, plugOrSlot string) error {
-	// Make sure get :<plug|slot> is only supported during the execution of interface hooks
+	if c.ForcePlugSide && c.ForceSlotSide {
+		return fmt.Errorf("cannot use --plug and --slot together")
+	}
+
 	hookType, err := interfaceHookType(context.HookName())
 	if err != nil {
-		return fmt.Errorf(i18n.G("interface attributes can only be read during the execution of interface hooks"))
+		// not in an interface hook, use the current connections
+		staticAttrs, dynamicAttrs, err := c.connectedAttributes(context, plugOrSlot)
+		if err != nil {
+			return err
+		}
+		return c.printAttributes(context, staticAttrs, dynamicAttrs)
 	}
 
 	var attrsTask *state.Task
@@ -288,10 +301,6 @@ func (c *getCommand) getInterfaceSetting(context *hookstate.Context, plugOrSlot
 		return err
 	}
 
-	if c.ForcePlugSide && c.ForceSlotSide {
-		return fmt.Errorf("cannot use --plug and --slot together")
-	}
-
 	isPlugSide := (hookType == preparePlugHook || hookType == unpreparePlugHook || hookType == connectPlugHook || hookType == disconnectPlugHook)
 	if err = validatePlugOrSlot(attrsTask, isPlugSide, plugOrSlot); err != nil {
 		return err
@@ -316,6 +325,56 @@ func (c *getCommand) getInterfaceSetting(context *hookstate.Context, plugOrSlot
 		return fmt.Errorf(i18n.G("internal error: cannot get %s from appropriate task"), which)
 	}
 
+	return c.printAttributes(context, staticAttrs, dynamicAttrs)
+}
+
+// connectedAttributes returns the attributes of the given plug or slot
+// of the snap of the context, or of the other side of its connection,
+// from the interface repository.
+func (c *getCommand) connectedAttributes(context *hookstate.Context, plugOrSlot string) (staticAttrs, dynamicAttrs map[string]interface{}, err error) {
+	st := context.State()
+	st.Lock()
+	defer st.Unlock()
+
+	snapName := context.InstanceName()
+	repo := ifacerepo.Get(st)
+	plug := repo.Plug(snapName, plugOrSlot)
+	slot := repo.Slot(snapName, plugOrSlot)
+	if plug == nil && slot == nil {
+		return nil, nil, fmt.Errorf(i18n.G("unknown plug or slot %q"), plugOrSlot)
+	}
+	isPlugSide := plug != nil
+	plugSideWanted := c.ForcePlugSide || (isPlugSide && !c.ForceSlotSide)
+	otherSide := plugSideWanted != isPlugSide
+
+	conns, err := repo.Connected(snapName, plugOrSlot)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(conns) != 1 {
+		switch {
+		case !otherSide && isPlugSide:
+			return plug.Attrs, nil, nil
+		case !otherSide:
+			return slot.Attrs, nil, nil
+		case len(conns) == 0:
+			return nil, nil, fmt.Errorf(i18n.G("cannot get the attributes of the other side of %q, it is not connected"), plugOrSlot)
+		default:
+			return nil, nil, fmt.Errorf(i18n.G("cannot get the attributes of the other side of %q, it has multiple connections"), plugOrSlot)
+		}
+	}
+
+	conn, err := repo.Connection(conns[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	if plugSideWanted {
+		return conn.Plug.StaticAttrs(), conn.Plug.DynamicAttrs(), nil
+	}
+	return conn.Slot.StaticAttrs(), conn.Slot.DynamicAttrs(), nil
+}
+
+func (c *getCommand) printAttributes(context *hookstate.Context, staticAttrs, dynamicAttrs map[string]interface{}) error {
 	return c.printValues(func(key string) (interface{}, bool, error) {
 		subkeys, err := config.ParseKey(key)
 		if err != nil {
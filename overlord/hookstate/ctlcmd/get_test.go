@@ -21,13 +21,16 @@ package ctlcmd_test
 
 import (
 	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/ifacetest"
 	"github.com/snapcore/snapd/overlord/configstate"
 	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/hookstate"
 	"github.com/snapcore/snapd/overlord/hookstate/ctlcmd"
 	"github.com/snapcore/snapd/overlord/hookstate/hooktest"
+	"github.com/snapcore/snapd/overlord/ifacestate/ifacerepo"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
 
 	"strings"
 
@@ -85,7 +88,7 @@ var getTests = []struct {
 	error: ".*unknown flag.*foo.*",
 }, {
 	args:  "get :foo bar",
-	error: ".*interface attributes can only be read during the execution of interface hooks.*",
+	error: `unknown plug or slot "foo"`,
 }, {
 	args:   "get test-key1",
 	stdout: "test-value1\n",
@@ -137,6 +140,8 @@ func (s *getSuite) TestGetTests(c *C) {
 		tr.Set("test-snap", "test-key2", 2)
 		tr.Commit()
 
+		ifacerepo.Replace(state, interfaces.NewRepository())
+
 		state.Unlock()
 
 		stdout, stderr, err := ctlcmd.Run(mockContext, strings.Fields(test.args), 0)
@@ -436,3 +441,130 @@ func (s *getAttrSuite) TestSlotHookTests(c *C) {
 		}
 	}
 }
+
+type getConnectedAttrSuite struct {
+	mockContext *hookstate.Context
+	mockHandler *hooktest.MockHandler
+}
+
+var _ = Suite(&getConnectedAttrSuite{})
+
+const getConnectedPlugSnapYaml = `name: test-snap
+version: 1
+plugs:
+  aplug:
+    interface: iface
+    aattr: foo
+  unconnected:
+    interface: iface
+    uattr: bar
+  cplug:
+    interface: iface
+slots:
+  aslot:
+    interface: iface
+`
+
+const getConnectedSlotSnapYaml = `name: other-snap
+version: 1
+slots:
+  bslot:
+    interface: iface
+    battr: baz
+plugs:
+  bplug:
+    interface: iface
+`
+
+func (s *getConnectedAttrSuite) SetUpTest(c *C) {
+	s.mockHandler = hooktest.NewMockHandler()
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	repo := interfaces.NewRepository()
+	c.Assert(repo.AddInterface(&ifacetest.TestInterface{InterfaceName: "iface"}), IsNil)
+	c.Assert(repo.AddSnap(snaptest.MockInfo(c, getConnectedPlugSnapYaml, nil)), IsNil)
+	c.Assert(repo.AddSnap(snaptest.MockInfo(c, getConnectedSlotSnapYaml, nil)), IsNil)
+	ifacerepo.Replace(st, repo)
+
+	connRef := &interfaces.ConnRef{
+		PlugRef: interfaces.PlugRef{Snap: "test-snap", Name: "aplug"},
+		SlotRef: interfaces.SlotRef{Snap: "other-snap", Name: "bslot"},
+	}
+	_, err := repo.Connect(connRef, nil, map[string]interface{}{"dyn-plug-attr": "c"}, nil, map[string]interface{}{"dyn-slot-attr": "d"}, nil)
+	c.Assert(err, IsNil)
+	// aslot is connected twice
+	for _, plugRef := range []interfaces.PlugRef{{Snap: "test-snap", Name: "cplug"}, {Snap: "other-snap", Name: "bplug"}} {
+		connRef := &interfaces.ConnRef{
+			PlugRef: plugRef,
+			SlotRef: interfaces.SlotRef{Snap: "test-snap", Name: "aslot"},
+		}
+		_, err = repo.Connect(connRef, nil, nil, nil, nil, nil)
+		c.Assert(err, IsNil)
+	}
+
+	// an ephemeral context, as used by apps
+	setup := &hookstate.HookSetup{Snap: "test-snap", Revision: snap.R(1)}
+	s.mockContext, err = hookstate.NewContext(nil, st, setup, s.mockHandler, "")
+	c.Assert(err, IsNil)
+}
+
+var getConnectedAttributesTests = []struct {
+	args, stdout, error string
+}{{
+	args:   "get :aplug aattr",
+	stdout: "foo\n",
+}, {
+	args:   "get :aplug dyn-plug-attr",
+	stdout: "c\n",
+}, {
+	args:   "get --plug :aplug aattr",
+	stdout: "foo\n",
+}, {
+	args:   "get --slot :aplug battr",
+	stdout: "baz\n",
+}, {
+	args:   "get --slot :aplug dyn-slot-attr",
+	stdout: "d\n",
+}, {
+	args:   "get :unconnected uattr",
+	stdout: "bar\n",
+}, {
+	args:  "get --slot :unconnected battr",
+	error: `cannot get the attributes of the other side of "unconnected", it is not connected`,
+}, {
+	args:  "get --plug :aslot aattr",
+	error: `cannot get the attributes of the other side of "aslot", it has multiple connections`,
+}, {
+	args:  "get :aplug x",
+	error: `no "x" attribute`,
+}, {
+	args:  "get :bslot battr",
+	error: `unknown plug or slot "bslot"`,
+}, {
+	args:  "get --slot --plug :aplug aattr",
+	error: `cannot use --plug and --slot together`,
+}}
+
+func (s *getConnectedAttrSuite) TestConnectedAttributes(c *C) {
+	for _, test := range getConnectedAttributesTests {
+		c.Logf("Test: %s", test.args)
+
+		stdout, stderr, err := ctlcmd.Run(s.mockContext, strings.Fields(test.args), 0)
+		if test.error != "" {
+			c.Check(err, ErrorMatches, test.error)
+		} else {
+			c.Check(err, IsNil)
+			c.Check(string(stderr), Equals, "")
+			c.Check(string(stdout), Equals, test.stdout)
+		}
+	}
+}
+
+func (s *getConnectedAttrSuite) TestConnectedAttributesRegularUser(c *C) {
+	stdout, _, err := ctlcmd.Run(s.mockContext, []string{"get", "--slot", ":aplug", "battr"}, 1000)
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, "baz\n")
+}
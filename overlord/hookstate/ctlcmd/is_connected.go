@@ -0,0 +1,84 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ctlcmd
+
+import (
+	"fmt"
+
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/overlord/ifacestate/ifacerepo"
+)
+
+var (
+	shortIsConnectedHelp = i18n.G(`Return success if the given plug or slot is connected, and failure otherwise`)
+	longIsConnectedHelp  = i18n.G(`
+The is-connected command returns success if the given plug or slot of the
+calling snap is connected, and failure otherwise.
+
+$ snapctl is-connected plug
+$ echo $?
+1
+
+Snaps can only query their own plugs and slots - snap name is implicit and
+implied by the snapctl execution context.
+`)
+)
+
+type isConnectedCommand struct {
+	baseCommand
+
+	Positional struct {
+		PlugOrSlotSpec string `positional-arg-name:"<plug|slot>"`
+	} `positional-args:"true" required:"true"`
+}
+
+func init() {
+	addCommand("is-connected", shortIsConnectedHelp, longIsConnectedHelp, func() command {
+		return &isConnectedCommand{}
+	})
+}
+
+func (c *isConnectedCommand) Execute(args []string) error {
+	plugOrSlot := c.Positional.PlugOrSlotSpec
+
+	context := c.context()
+	if context == nil {
+		return fmt.Errorf("cannot check connection status without a context")
+	}
+	snapName := context.InstanceName()
+
+	st := context.State()
+	st.Lock()
+	defer st.Unlock()
+
+	repo := ifacerepo.Get(st)
+	if repo.Plug(snapName, plugOrSlot) == nil && repo.Slot(snapName, plugOrSlot) == nil {
+		return fmt.Errorf("snap %q has no plug or slot named %q", snapName, plugOrSlot)
+	}
+
+	conns, err := repo.Connected(snapName, plugOrSlot)
+	if err != nil {
+		return err
+	}
+	if len(conns) > 0 {
+		return nil
+	}
+	return &UnsuccessfulError{ExitCode: 1}
+}
@@ -0,0 +1,127 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ctlcmd_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/ifacetest"
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/hookstate/ctlcmd"
+	"github.com/snapcore/snapd/overlord/hookstate/hooktest"
+	"github.com/snapcore/snapd/overlord/ifacestate/ifacerepo"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+)
+
+type isConnectedSuite struct {
+	mockContext *hookstate.Context
+	mockHandler *hooktest.MockHandler
+}
+
+var _ = Suite(&isConnectedSuite{})
+
+const isConnectedPlugSnapYaml = `name: snap1
+version: 1
+plugs:
+  plug1:
+    interface: x11
+  plug2:
+    interface: x11
+`
+
+const isConnectedSlotSnapYaml = `name: snap2
+version: 1
+slots:
+  slot1:
+    interface: x11
+  slot2:
+    interface: x11
+`
+
+func (s *isConnectedSuite) SetUpTest(c *C) {
+	s.mockHandler = hooktest.NewMockHandler()
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	repo := interfaces.NewRepository()
+	c.Assert(repo.AddInterface(&ifacetest.TestInterface{InterfaceName: "x11"}), IsNil)
+	c.Assert(repo.AddSnap(snaptest.MockInfo(c, isConnectedPlugSnapYaml, nil)), IsNil)
+	c.Assert(repo.AddSnap(snaptest.MockInfo(c, isConnectedSlotSnapYaml, nil)), IsNil)
+	ifacerepo.Replace(st, repo)
+
+	connRef := &interfaces.ConnRef{
+		PlugRef: interfaces.PlugRef{Snap: "snap1", Name: "plug1"},
+		SlotRef: interfaces.SlotRef{Snap: "snap2", Name: "slot1"},
+	}
+	_, err := repo.Connect(connRef, nil, nil, nil, nil, nil)
+	c.Assert(err, IsNil)
+
+	setup := &hookstate.HookSetup{Snap: "snap1", Revision: snap.R(1)}
+	s.mockContext, err = hookstate.NewContext(nil, st, setup, s.mockHandler, "")
+	c.Assert(err, IsNil)
+}
+
+func (s *isConnectedSuite) TestIsConnected(c *C) {
+	for _, t := range []struct {
+		args     []string
+		exitCode int
+		err      string
+	}{
+		{[]string{"is-connected", "plug1"}, 0, ""},
+		{[]string{"is-connected", "plug2"}, 1, ""},
+		{[]string{"is-connected", "foo"}, 0, `snap "snap1" has no plug or slot named "foo"`},
+		{[]string{"is-connected"}, 0, "the required argument `<plug|slot>` was not provided"},
+	} {
+		stdout, stderr, err := ctlcmd.Run(s.mockContext, t.args, 0)
+		comment := Commentf("%s", t.args)
+		switch {
+		case t.err != "":
+			c.Check(err, ErrorMatches, t.err, comment)
+		case t.exitCode > 0:
+			c.Assert(err, FitsTypeOf, &ctlcmd.UnsuccessfulError{}, comment)
+			c.Check(err.(*ctlcmd.UnsuccessfulError).ExitCode, Equals, t.exitCode, comment)
+		default:
+			c.Check(err, IsNil, comment)
+		}
+		c.Check(string(stdout), Equals, "", comment)
+		c.Check(string(stderr), Equals, "", comment)
+	}
+}
+
+func (s *isConnectedSuite) TestIsConnectedSlotSide(c *C) {
+	setup := &hookstate.HookSetup{Snap: "snap2", Revision: snap.R(1)}
+	mockContext, err := hookstate.NewContext(nil, s.mockContext.State(), setup, s.mockHandler, "")
+	c.Assert(err, IsNil)
+
+	_, _, err = ctlcmd.Run(mockContext, []string{"is-connected", "slot1"}, 1000)
+	c.Check(err, IsNil)
+	_, _, err = ctlcmd.Run(mockContext, []string{"is-connected", "slot2"}, 1000)
+	c.Check(err, DeepEquals, &ctlcmd.UnsuccessfulError{ExitCode: 1})
+}
+
+func (s *isConnectedSuite) TestIsConnectedWithoutContext(c *C) {
+	_, _, err := ctlcmd.Run(nil, []string{"is-connected", "plug1"}, 0)
+	c.Check(err, ErrorMatches, "cannot check connection status without a context")
+}
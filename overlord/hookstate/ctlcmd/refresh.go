@@ -0,0 +1,108 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ctlcmd
+
+import (
+	"fmt"
+
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+var (
+	shortRefreshHelp = i18n.G("Hold or proceed with the pending auto-refresh")
+	longRefreshHelp  = i18n.G(`
+The refresh command is called from the gate-auto-refresh hook of a snap, which
+is run before an auto-refresh of the snap itself, of its base, or of the
+providers of its content plugs, to decide whether that refresh can go ahead.
+
+--pending lists the snaps whose refresh is pending.
+
+--hold holds the refresh of these snaps until the next auto-refresh, when the
+hook is run again. A refresh cannot be held this way forever: once it has been
+held for long enough, --hold fails and the refresh goes ahead.
+
+--proceed lets the refresh go ahead. This is also what happens if the hook
+calls neither --hold nor --proceed, whether it succeeds or fails. A --hold or
+--proceed issued by the hook stands even if the hook fails afterwards.
+`)
+)
+
+func init() {
+	addCommand("refresh", shortRefreshHelp, longRefreshHelp, func() command { return &refreshCommand{} })
+}
+
+type refreshCommand struct {
+	baseCommand
+
+	Pending bool `long:"pending" description:"List the snaps whose refresh is pending"`
+	Hold    bool `long:"hold" description:"Hold the pending refresh"`
+	Proceed bool `long:"proceed" description:"Proceed with the pending refresh"`
+}
+
+func (c *refreshCommand) Execute(args []string) error {
+	ctx := c.context()
+	if ctx == nil {
+		return fmt.Errorf(i18n.G("cannot %s without a context"), "refresh")
+	}
+	if ctx.IsEphemeral() || ctx.HookName() != "gate-auto-refresh" {
+		return fmt.Errorf("can only be used from gate-auto-refresh hook")
+	}
+
+	n := 0
+	for _, opt := range []bool{c.Pending, c.Hold, c.Proceed} {
+		if opt {
+			n++
+		}
+	}
+	if n != 1 {
+		return fmt.Errorf("exactly one of --pending, --hold or --proceed is required")
+	}
+
+	ctx.Lock()
+	defer ctx.Unlock()
+
+	var affecting []string
+	if err := ctx.Get("affecting-snaps", &affecting); err != nil && err != state.ErrNoState {
+		return err
+	}
+
+	st := ctx.State()
+	switch {
+	case c.Pending:
+		for _, name := range affecting {
+			c.printf("%s\n", name)
+		}
+		return nil
+	case c.Hold:
+		if err := snapstate.HoldRefreshesBy(st, ctx.InstanceName(), affecting); err != nil {
+			return err
+		}
+		ctx.Set("refresh-gating-action", "hold")
+	case c.Proceed:
+		if err := snapstate.ProceedWithRefresh(st, ctx.InstanceName()); err != nil {
+			return err
+		}
+		ctx.Set("refresh-gating-action", "proceed")
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ctlcmd_test
+
+import (
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/hookstate/ctlcmd"
+	"github.com/snapcore/snapd/overlord/hookstate/hooktest"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+type refreshSuite struct {
+	state       *state.State
+	mockContext *hookstate.Context
+	mockHandler *hooktest.MockHandler
+}
+
+var _ = check.Suite(&refreshSuite{})
+
+func (s *refreshSuite) SetUpTest(c *check.C) {
+	s.mockHandler = hooktest.NewMockHandler()
+
+	s.state = state.New(nil)
+	s.state.Lock()
+	defer s.state.Unlock()
+	task := s.state.NewTask("test-task", "my test task")
+	task.Set("hook-context", map[string]interface{}{
+		"affecting-snaps": []string{"some-base", "test-snap"},
+	})
+	setup := &hookstate.HookSetup{Snap: "test-snap", Revision: snap.R(1), Hook: "gate-auto-refresh"}
+
+	ctx, err := hookstate.NewContext(task, s.state, setup, s.mockHandler, "")
+	c.Assert(err, check.IsNil)
+	s.mockContext = ctx
+}
+
+func (s *refreshSuite) TestBadArgs(c *check.C) {
+	for _, args := range [][]string{
+		{"refresh"},
+		{"refresh", "--hold", "--proceed"},
+		{"refresh", "--pending", "--hold"},
+	} {
+		_, _, err := ctlcmd.Run(s.mockContext, args, 0)
+		c.Check(err, check.ErrorMatches, "exactly one of --pending, --hold or --proceed is required", check.Commentf("%v", args))
+	}
+}
+
+func (s *refreshSuite) TestNotFromGateAutoRefreshHook(c *check.C) {
+	s.state.Lock()
+	task := s.state.NewTask("test-task", "my test task")
+	setup := &hookstate.HookSetup{Snap: "test-snap", Revision: snap.R(1), Hook: "configure"}
+	s.state.Unlock()
+	ctx, err := hookstate.NewContext(task, s.state, setup, s.mockHandler, "")
+	c.Assert(err, check.IsNil)
+
+	_, _, err = ctlcmd.Run(ctx, []string{"refresh", "--hold"}, 0)
+	c.Check(err, check.ErrorMatches, "can only be used from gate-auto-refresh hook")
+
+	_, _, err = ctlcmd.Run(nil, []string{"refresh", "--hold"}, 0)
+	c.Check(err, check.ErrorMatches, "cannot refresh without a context")
+}
+
+func (s *refreshSuite) TestPending(c *check.C) {
+	stdout, stderr, err := ctlcmd.Run(s.mockContext, []string{"refresh", "--pending"}, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(string(stdout), check.Equals, "some-base\ntest-snap\n")
+	c.Check(string(stderr), check.Equals, "")
+}
+
+func (s *refreshSuite) TestHold(c *check.C) {
+	_, _, err := ctlcmd.Run(s.mockContext, []string{"refresh", "--hold"}, 0)
+	c.Assert(err, check.IsNil)
+
+	s.mockContext.Lock()
+	defer s.mockContext.Unlock()
+
+	var holds map[string]map[string]interface{}
+	c.Assert(s.state.Get("refresh-gating-holds", &holds), check.IsNil)
+	c.Check(holds, check.HasLen, 2)
+	c.Check(holds["some-base"]["held-by"], check.DeepEquals, []interface{}{"test-snap"})
+	c.Check(holds["test-snap"]["held-by"], check.DeepEquals, []interface{}{"test-snap"})
+
+	var action string
+	c.Assert(s.mockContext.Get("refresh-gating-action", &action), check.IsNil)
+	c.Check(action, check.Equals, "hold")
+}
+
+func (s *refreshSuite) TestProceed(c *check.C) {
+	_, _, err := ctlcmd.Run(s.mockContext, []string{"refresh", "--hold"}, 0)
+	c.Assert(err, check.IsNil)
+	_, _, err = ctlcmd.Run(s.mockContext, []string{"refresh", "--proceed"}, 0)
+	c.Assert(err, check.IsNil)
+
+	s.mockContext.Lock()
+	defer s.mockContext.Unlock()
+
+	var holds map[string]map[string]interface{}
+	c.Assert(s.state.Get("refresh-gating-holds", &holds), check.IsNil)
+	// when the refresh was first held is kept until it happens
+	c.Check(holds, check.HasLen, 2)
+	c.Check(holds["some-base"]["held-by"], check.IsNil)
+	c.Check(holds["test-snap"]["held-by"], check.IsNil)
+
+	var action string
+	c.Assert(s.mockContext.Get("refresh-gating-action", &action), check.IsNil)
+	c.Check(action, check.Equals, "proceed")
+}
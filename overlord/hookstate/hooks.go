@@ -31,6 +31,7 @@ func init() {
 	snapstate.SetupPreRefreshHook = SetupPreRefreshHook
 	snapstate.SetupPostRefreshHook = SetupPostRefreshHook
 	snapstate.SetupRemoveHook = SetupRemoveHook
+	snapstate.SetupGateAutoRefreshHook = SetupGateAutoRefreshHook
 }
 
 func SetupInstallHook(st *state.State, snapName string) *state.Task {
@@ -99,6 +100,46 @@ func SetupRemoveHook(st *state.State, snapName string) *state.Task {
 	return task
 }
 
+// SetupGateAutoRefreshHook sets up the gate-auto-refresh hook of the
+// given snap, which is affected by the auto-refresh of the given snaps.
+func SetupGateAutoRefreshHook(st *state.State, snapName string, affecting []string) *state.Task {
+	hooksup := &HookSetup{
+		Snap:        snapName,
+		Hook:        "gate-auto-refresh",
+		Optional:    true,
+		IgnoreError: true,
+	}
+
+	summary := fmt.Sprintf(i18n.G("Run gate-auto-refresh hook of %q snap if present"), hooksup.Snap)
+	contextData := map[string]interface{}{
+		"affecting-snaps": affecting,
+	}
+	return HookTask(st, summary, hooksup, contextData)
+}
+
+// gateAutoRefreshHookHandler lets the refresh proceed if the hook did not
+// hold it (or explicitly let it proceed) using snapctl refresh. As the
+// hook's errors are ignored this also runs when the hook fails, in which
+// case whatever it asked for before failing stands.
+type gateAutoRefreshHookHandler struct {
+	snapHookHandler
+	context *Context
+}
+
+func (h *gateAutoRefreshHookHandler) Done() error {
+	h.context.Lock()
+	defer h.context.Unlock()
+
+	var action string
+	if err := h.context.Get("refresh-gating-action", &action); err != nil && err != state.ErrNoState {
+		return err
+	}
+	if action != "" {
+		return nil
+	}
+	return snapstate.ProceedWithRefresh(h.context.State(), h.context.InstanceName())
+}
+
 func setupHooks(hookMgr *HookManager) {
 	handlerGenerator := func(context *Context) Handler {
 		return &snapHookHandler{}
@@ -108,4 +149,7 @@ func setupHooks(hookMgr *HookManager) {
 	hookMgr.Register(regexp.MustCompile("^post-refresh$"), handlerGenerator)
 	hookMgr.Register(regexp.MustCompile("^pre-refresh$"), handlerGenerator)
 	hookMgr.Register(regexp.MustCompile("^remove$"), handlerGenerator)
+	hookMgr.Register(regexp.MustCompile("^gate-auto-refresh$"), func(context *Context) Handler {
+		return &gateAutoRefreshHookHandler{context: context}
+	})
 }
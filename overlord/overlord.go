@@ -45,9 +45,11 @@ import (
 	"github.com/snapcore/snapd/overlord/hookstate"
 	"github.com/snapcore/snapd/overlord/ifacestate"
 	"github.com/snapcore/snapd/overlord/patch"
+	"github.com/snapcore/snapd/overlord/servicestate"
 	"github.com/snapcore/snapd/overlord/snapshotstate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/overlord/storecachestate"
 	"github.com/snapcore/snapd/overlord/storecontext"
 	"github.com/snapcore/snapd/store"
 	"github.com/snapcore/snapd/timings"
@@ -122,6 +124,12 @@ func New(restartBehavior RestartBehavior) (*Overlord, error) {
 		ensureBefore:   o.ensureBefore,
 		requestRestart: o.requestRestart,
 	}
+	// a requested factory reset wipes the state, it needs to
+	// happen before loading it
+	if err := devicestate.WipeForFactoryReset(); err != nil {
+		return nil, err
+	}
+
 	s, err := loadState(backend, restartBehavior)
 	if err != nil {
 		return nil, err
@@ -168,6 +176,8 @@ func New(restartBehavior RestartBehavior) (*Overlord, error) {
 
 	o.addManager(cmdstate.Manager(s, o.runner))
 	o.addManager(snapshotstate.Manager(s, o.runner))
+	o.addManager(servicestate.Manager(s, o.runner))
+	o.addManager(storecachestate.Manager(s))
 
 	if err := configstateInit(s, hookMgr); err != nil {
 		return nil, err
@@ -71,12 +71,12 @@ func patch5(st *state.State) error {
 			return err
 		}
 
-		err = wrappers.AddSnapServices(info, log)
+		err = wrappers.AddSnapServices(info, nil, log)
 		if err != nil {
 			return err
 		}
 
-		err = wrappers.StartServices(svcs, log, tm)
+		err = wrappers.StartServices(svcs, nil, log, tm)
 		if err != nil {
 			return err
 		}
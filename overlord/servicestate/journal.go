@@ -0,0 +1,177 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/progress"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/wrappers"
+)
+
+// MinJournalSize is the smallest journal size a snap can be given.
+const MinJournalSize = 1000 * 1000
+
+// journal namespaces (LogNamespace= and journalctl --namespace) are
+// supported from this version of systemd
+const journalNamespaceMinSystemdVersion = 245
+
+var systemdEnsureAtLeast = systemd.EnsureAtLeast
+
+func checkJournalNamespacesSupported() error {
+	if err := systemdEnsureAtLeast(journalNamespaceMinSystemdVersion); err != nil {
+		return fmt.Errorf("journal namespaces are not supported: %v", err)
+	}
+	return nil
+}
+
+// JournalNamespace returns the name of the journal namespace the
+// output of the services of the given snap goes to when the snap has
+// its own journal size limit.
+func JournalNamespace(instanceName string) string {
+	return "snap-" + instanceName
+}
+
+// IsJournalOption returns whether the given snap option, or any of its
+// sub-options, is a journal option handled by snapd.
+func IsJournalOption(key string) bool {
+	return key == "journal" || strings.HasPrefix(key, "journal.")
+}
+
+func snapJournalSize(cfg config.Conf, instanceName string) (int64, error) {
+	var value interface{}
+	if err := cfg.Get(instanceName, "journal.size", &value); err != nil {
+		if config.IsNoOption(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if value == nil {
+		return 0, nil
+	}
+	str, ok := value.(string)
+	if !ok {
+		return 0, fmt.Errorf("invalid journal size for snap %q: must be a size like 64MB", instanceName)
+	}
+	size, err := strutil.ParseByteSize(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid journal size for snap %q: %v", instanceName, err)
+	}
+	if size < MinJournalSize {
+		return 0, fmt.Errorf("invalid journal size for snap %q: must be at least %s", instanceName, strutil.SizeToStr(MinJournalSize))
+	}
+	return size, nil
+}
+
+// SnapJournalSize returns the size the journal of the given snap is
+// limited to, or 0 if its services log to the default journal.
+func SnapJournalSize(st *state.State, instanceName string) (int64, error) {
+	return snapJournalSize(config.NewTransaction(st), instanceName)
+}
+
+// SnapJournalNamespace returns the journal namespace the services of
+// the given snap log to, or "" if they log to the default journal,
+// which is also the case when systemd does not support namespaces.
+func SnapJournalNamespace(st *state.State, instanceName string) (string, error) {
+	size, err := SnapJournalSize(st, instanceName)
+	if err != nil || size == 0 {
+		return "", err
+	}
+	if err := checkJournalNamespacesSupported(); err != nil {
+		logger.Noticef("Cannot use the journal of snap %q: %v", instanceName, err)
+		return "", nil
+	}
+	return JournalNamespace(instanceName), nil
+}
+
+// ValidateSnapJournal checks the journal options of the given snap in
+// the given configuration.
+func ValidateSnapJournal(cfg config.Conf, instanceName string) error {
+	size, err := snapJournalSize(cfg, instanceName)
+	if err != nil {
+		return err
+	}
+	if size != 0 {
+		if err := checkJournalNamespacesSupported(); err != nil {
+			return fmt.Errorf("cannot set journal size of snap %q: %v", instanceName, err)
+		}
+	}
+	return nil
+}
+
+// RemoveSnapJournal removes the journal configuration of the given snap,
+// which is being removed. Its journal files are left alone.
+func RemoveSnapJournal(instanceName string) error {
+	if err := wrappers.RemoveJournalNamespace(JournalNamespace(instanceName), progress.Null); err != nil {
+		return fmt.Errorf("cannot remove journal configuration of snap %q: %v", instanceName, err)
+	}
+	return nil
+}
+
+// ConfigureSnapJournal applies the journal options of the given snap
+// found in the given configuration, which is usually not committed
+// yet. When a journal size is set the output of the services of the
+// snap goes to its own journal namespace limited to that size,
+// otherwise it goes back to the default journal. The services that are
+// running are restarted when they move between journals. It must be
+// called with the state locked but unlocks it while restarting
+// services.
+func ConfigureSnapJournal(cfg config.Conf, instanceName string) error {
+	size, err := snapJournalSize(cfg, instanceName)
+	if err != nil {
+		return err
+	}
+
+	namespace := JournalNamespace(instanceName)
+	if size != 0 {
+		if err := checkJournalNamespacesSupported(); err != nil {
+			return fmt.Errorf("cannot configure journal of snap %q: %v", instanceName, err)
+		}
+		if err := wrappers.EnsureJournalNamespace(namespace, size, progress.Null); err != nil {
+			return fmt.Errorf("cannot configure journal of snap %q: %v", instanceName, err)
+		}
+	}
+
+	restart, err := ensureSnapServices(cfg.State(), []string{instanceName}, func(opts *wrappers.AddSnapServicesOptions) {
+		opts.JournalNamespace = ""
+		if size != 0 {
+			opts.JournalNamespace = namespace
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if err := restartServices(cfg.State(), restart); err != nil {
+		return err
+	}
+
+	if size == 0 {
+		if err := wrappers.RemoveJournalNamespace(namespace, progress.Null); err != nil {
+			return fmt.Errorf("cannot remove journal configuration of snap %q: %v", instanceName, err)
+		}
+	}
+	return nil
+}
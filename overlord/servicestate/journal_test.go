@@ -0,0 +1,214 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type journalSuite struct {
+	quotaControlSuite
+}
+
+var _ = Suite(&journalSuite{})
+
+func (s *journalSuite) TestSnapJournalSize(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	size, err := servicestate.SnapJournalSize(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(size, Equals, int64(0))
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("test-snap", "journal.size", "64MB"), IsNil)
+	tr.Commit()
+
+	size, err = servicestate.SnapJournalSize(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(size, Equals, int64(64*1000*1000))
+
+	namespace, err := servicestate.SnapJournalNamespace(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(namespace, Equals, "snap-test-snap")
+
+	opts, err := servicestate.SnapServiceOptions(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(opts.JournalNamespace, Equals, "snap-test-snap")
+	c.Check(opts.QuotaGroup, IsNil)
+
+	opts, err = servicestate.SnapServiceOptions(s.state, "other-snap")
+	c.Assert(err, IsNil)
+	c.Check(opts.JournalNamespace, Equals, "")
+}
+
+func (s *journalSuite) TestValidateSnapJournal(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	for _, t := range []struct {
+		value interface{}
+		err   string
+	}{
+		{"64MB", ""},
+		{nil, ""},
+		{"1MB", ""},
+		{"999kB", `invalid journal size for snap "test-snap": must be at least 1MB`},
+		{"lots", `invalid journal size for snap "test-snap": cannot parse "lots": .*`},
+		{"1000", `invalid journal size for snap "test-snap": cannot parse "1000": need a number with a unit as input`},
+		{1000, `invalid journal size for snap "test-snap": must be a size like 64MB`},
+	} {
+		tr := config.NewTransaction(s.state)
+		c.Assert(tr.Set("test-snap", "journal.size", t.value), IsNil)
+		err := servicestate.ValidateSnapJournal(tr, "test-snap")
+		if t.err == "" {
+			c.Check(err, IsNil, Commentf("%v", t.value))
+		} else {
+			c.Check(err, ErrorMatches, t.err, Commentf("%v", t.value))
+		}
+	}
+}
+
+func (s *journalSuite) TestJournalNamespacesUnsupported(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	var required int
+	restore := servicestate.MockSystemdEnsureAtLeast(func(requiredVersion int) error {
+		required = requiredVersion
+		return errors.New("systemd version 237 is too old (expected at least 245)")
+	})
+	defer restore()
+
+	s.mockSnap(c, "test-snap", "app")
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("test-snap", "journal.size", "64MB"), IsNil)
+	err := servicestate.ValidateSnapJournal(tr, "test-snap")
+	c.Check(err, ErrorMatches, `cannot set journal size of snap "test-snap": journal namespaces are not supported: systemd version 237 is too old \(expected at least 245\)`)
+	c.Check(required, Equals, 245)
+	err = servicestate.ConfigureSnapJournal(tr, "test-snap")
+	c.Check(err, ErrorMatches, `cannot configure journal of snap "test-snap": journal namespaces are not supported: .*`)
+	c.Check(filepath.Join(dirs.SnapSystemdDir, "journald@snap-test-snap.conf"), testutil.FileAbsent)
+	c.Check(s.systemctlLog, HasLen, 0)
+	tr.Commit()
+
+	// a size set before systemd was downgraded is ignored
+	namespace, err := servicestate.SnapJournalNamespace(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(namespace, Equals, "")
+	opts, err := servicestate.SnapServiceOptions(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(opts.JournalNamespace, Equals, "")
+
+	// the default journal needs no support
+	tr = config.NewTransaction(s.state)
+	c.Assert(tr.Set("test-snap", "journal.size", nil), IsNil)
+	c.Check(servicestate.ValidateSnapJournal(tr, "test-snap"), IsNil)
+}
+
+func (s *journalSuite) TestRemoveSnapJournal(c *C) {
+	confPath := filepath.Join(dirs.SnapSystemdDir, "journald@snap-test-snap.conf")
+	c.Assert(os.MkdirAll(dirs.SnapSystemdDir, 0755), IsNil)
+	c.Assert(ioutil.WriteFile(confPath, []byte("[Journal]\n"), 0644), IsNil)
+
+	c.Assert(servicestate.RemoveSnapJournal("test-snap"), IsNil)
+	c.Check(confPath, testutil.FileAbsent)
+
+	// nothing to remove
+	c.Assert(servicestate.RemoveSnapJournal("test-snap"), IsNil)
+}
+
+func (s *journalSuite) TestConfigureSnapJournal(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockSnap(c, "test-snap", "app")
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("test-snap", "journal.size", "64MB"), IsNil)
+	err := servicestate.ConfigureSnapJournal(tr, "test-snap")
+	c.Assert(err, IsNil)
+
+	confPath := filepath.Join(dirs.SnapSystemdDir, "journald@snap-test-snap.conf")
+	c.Check(confPath, testutil.FileEquals, `# Auto-generated, DO NOT EDIT
+[Journal]
+SystemMaxUse=64000000
+RuntimeMaxUse=64000000
+`)
+	c.Check(s.serviceFile("test-snap"), testutil.FileContains, "\nLogNamespace=snap-test-snap\n")
+	c.Check(s.systemctlLog, DeepEquals, [][]string{
+		// the journald instance of the namespace picks up the new limit
+		{"show", "--property=Id,ActiveState,UnitFileState,Type", "systemd-journald@snap-test-snap.service"},
+		{"stop", "systemd-journald@snap-test-snap.service"},
+		{"show", "--property=ActiveState", "systemd-journald@snap-test-snap.service"},
+		{"start", "systemd-journald@snap-test-snap.service"},
+		// the service moves to the namespace
+		{"daemon-reload"},
+		{"show", "--property=Id,ActiveState,UnitFileState,Type", "snap.test-snap.svc.service"},
+		{"stop", "snap.test-snap.svc.service"},
+		{"show", "--property=ActiveState", "snap.test-snap.svc.service"},
+		{"start", "snap.test-snap.svc.service"},
+	})
+	tr.Commit()
+
+	// back to the default journal
+	s.systemctlLog = nil
+	tr = config.NewTransaction(s.state)
+	c.Assert(tr.Set("test-snap", "journal.size", nil), IsNil)
+	err = servicestate.ConfigureSnapJournal(tr, "test-snap")
+	c.Assert(err, IsNil)
+
+	c.Check(confPath, testutil.FileAbsent)
+	c.Check(s.serviceFile("test-snap"), Not(testutil.FileContains), "LogNamespace=")
+	c.Check(s.systemctlLog, DeepEquals, [][]string{
+		{"daemon-reload"},
+		{"show", "--property=Id,ActiveState,UnitFileState,Type", "snap.test-snap.svc.service"},
+		{"stop", "snap.test-snap.svc.service"},
+		{"show", "--property=ActiveState", "snap.test-snap.svc.service"},
+		{"start", "snap.test-snap.svc.service"},
+		{"show", "--property=Id,ActiveState,UnitFileState,Type", "systemd-journald@snap-test-snap.service"},
+		{"stop", "systemd-journald@snap-test-snap.service"},
+		{"show", "--property=ActiveState", "systemd-journald@snap-test-snap.service"},
+	})
+}
+
+func (s *journalSuite) TestConfigureSnapJournalInvalid(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockSnap(c, "test-snap", "app")
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("test-snap", "journal.size", "1kB"), IsNil)
+	err := servicestate.ConfigureSnapJournal(tr, "test-snap")
+	c.Assert(err, ErrorMatches, `invalid journal size for snap "test-snap": must be at least 1MB`)
+	c.Check(s.systemctlLog, HasLen, 0)
+}
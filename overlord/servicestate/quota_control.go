@@ -0,0 +1,462 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/progress"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/quota"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/timings"
+	"github.com/snapcore/snapd/wrappers"
+)
+
+func init() {
+	snapstate.SnapServiceOptions = SnapServiceOptions
+	snapstate.EnsureSnapAbsentFromQuotaGroup = EnsureSnapAbsentFromQuotaGroup
+	snapstate.RemoveSnapJournal = RemoveSnapJournal
+}
+
+// AllQuotas returns all the quota groups, keyed by name.
+func AllQuotas(st *state.State) (map[string]*quota.Group, error) {
+	var quotas map[string]*quota.Group
+	err := st.Get("quotas", &quotas)
+	if err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+	if quotas == nil {
+		quotas = make(map[string]*quota.Group)
+	}
+	return quotas, nil
+}
+
+// GetQuota returns the quota group with the given name. It returns
+// state.ErrNoState if there is no such group.
+func GetQuota(st *state.State, name string) (*quota.Group, error) {
+	quotas, err := AllQuotas(st)
+	if err != nil {
+		return nil, err
+	}
+	grp := quotas[name]
+	if grp == nil {
+		return nil, state.ErrNoState
+	}
+	return grp, nil
+}
+
+func quotaGroupForSnap(quotas map[string]*quota.Group, instanceName string) *quota.Group {
+	for _, grp := range quotas {
+		if strutil.ListContains(grp.Snaps, instanceName) {
+			return grp
+		}
+	}
+	return nil
+}
+
+// SnapServiceOptions returns the options for generating the services of
+// the given snap, placing them in the slice of the quota group the snap
+// belongs to, if any, and sending their output to the journal
+// namespace of the snap, if it has one.
+func SnapServiceOptions(st *state.State, instanceName string) (*wrappers.AddSnapServicesOptions, error) {
+	quotas, err := AllQuotas(st)
+	if err != nil {
+		return nil, err
+	}
+	namespace, err := SnapJournalNamespace(st, instanceName)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappers.AddSnapServicesOptions{
+		QuotaGroup:       quotaGroupForSnap(quotas, instanceName),
+		JournalNamespace: namespace,
+	}, nil
+}
+
+// quotaControlAction is the action of a quota-control task.
+type quotaControlAction struct {
+	// Action is either "set" or "remove".
+	Action    string `json:"action"`
+	QuotaName string `json:"quota-name"`
+	// Update holds the limits and snaps to set on the group, for
+	// "set".
+	Update *quota.Group `json:"update,omitempty"`
+	// AffectedSnaps are the snaps whose services are moved in or
+	// out of the group, for conflict detection.
+	AffectedSnaps []string `json:"affected-snaps,omitempty"`
+}
+
+// updatedQuotaGroup returns the quota group with the name of the given
+// one, as it is once the given update is applied to it. The non-zero
+// limits of the update replace the existing ones and its snaps are
+// added to the existing ones.
+func updatedQuotaGroup(st *state.State, quotas map[string]*quota.Group, update *quota.Group) (grp *quota.Group, added []string, err error) {
+	grp = quotas[update.Name]
+	if grp == nil {
+		grp = &quota.Group{Name: update.Name}
+	} else {
+		// work on a copy, the state is only updated once the
+		// group is in place
+		cpy := *grp
+		cpy.Snaps = append([]string(nil), grp.Snaps...)
+		grp = &cpy
+	}
+	if update.MemoryLimit != 0 {
+		grp.MemoryLimit = update.MemoryLimit
+	}
+	if update.CPULimit != 0 {
+		grp.CPULimit = update.CPULimit
+	}
+	if update.ThreadLimit != 0 {
+		grp.ThreadLimit = update.ThreadLimit
+	}
+
+	for _, snapName := range update.Snaps {
+		if strutil.ListContains(grp.Snaps, snapName) || strutil.ListContains(added, snapName) {
+			continue
+		}
+		added = append(added, snapName)
+	}
+	grp.Snaps = append(grp.Snaps, added...)
+
+	if err := grp.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	for _, snapName := range added {
+		if other := quotaGroupForSnap(quotas, snapName); other != nil && other.Name != grp.Name {
+			return nil, nil, fmt.Errorf("cannot add snap %q to quota group %q: snap already in quota group %q", snapName, grp.Name, other.Name)
+		}
+		var snapst snapstate.SnapState
+		if err := snapstate.Get(st, snapName, &snapst); err != nil {
+			if err == state.ErrNoState {
+				return nil, nil, fmt.Errorf("cannot add snap %q to quota group %q: snap is not installed", snapName, grp.Name)
+			}
+			return nil, nil, err
+		}
+		typ, err := snapst.Type()
+		if err != nil {
+			return nil, nil, err
+		}
+		if typ != snap.TypeApp {
+			return nil, nil, fmt.Errorf("cannot add snap %q to quota group %q: snaps of type %q are not supported", snapName, grp.Name, typ)
+		}
+	}
+	return grp, added, nil
+}
+
+// checkQuotaControlConflict checks that no other change is operating on
+// the given quota group, nor on the given snaps.
+func checkQuotaControlConflict(st *state.State, name string, snapNames []string) error {
+	for _, t := range st.Tasks() {
+		if t.Kind() != "quota-control" || t.Status().Ready() {
+			continue
+		}
+		var action quotaControlAction
+		if err := t.Get("quota-control-action", &action); err != nil {
+			return err
+		}
+		if action.QuotaName == name {
+			return &snapstate.ChangeConflictError{
+				ChangeKind: t.Change().Kind(),
+				Message:    fmt.Sprintf("quota group %q has %q change in progress", name, t.Change().Kind()),
+			}
+		}
+	}
+	return snapstate.CheckChangeConflictMany(st, snapNames, "")
+}
+
+func quotaControlTaskSet(st *state.State, summary string, action *quotaControlAction) *state.TaskSet {
+	t := st.NewTask("quota-control", summary)
+	t.Set("quota-control-action", action)
+	return state.NewTaskSet(t)
+}
+
+// SetQuota returns the tasks to create the quota group with the name of
+// the given one, or to update it if it exists already. When updating,
+// the non-zero limits of the given group replace the existing ones and
+// its snaps are added to the existing ones. The services of the snaps
+// in the group are then placed in the slice of the group, restarting
+// those that are running.
+func SetQuota(st *state.State, update *quota.Group) (*state.TaskSet, error) {
+	quotas, err := AllQuotas(st)
+	if err != nil {
+		return nil, err
+	}
+	grp, _, err := updatedQuotaGroup(st, quotas, update)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkQuotaControlConflict(st, grp.Name, grp.Snaps); err != nil {
+		return nil, err
+	}
+
+	summary := fmt.Sprintf(i18n.G("Set quota group %q"), grp.Name)
+	return quotaControlTaskSet(st, summary, &quotaControlAction{
+		Action:        "set",
+		QuotaName:     grp.Name,
+		Update:        update,
+		AffectedSnaps: grp.Snaps,
+	}), nil
+}
+
+// RemoveQuota returns the tasks to remove the quota group with the
+// given name, moving the services of its snaps out of the slice of the
+// group.
+func RemoveQuota(st *state.State, name string) (*state.TaskSet, error) {
+	quotas, err := AllQuotas(st)
+	if err != nil {
+		return nil, err
+	}
+	grp := quotas[name]
+	if grp == nil {
+		return nil, fmt.Errorf("cannot remove quota group %q: no such group", name)
+	}
+	if err := checkQuotaControlConflict(st, name, grp.Snaps); err != nil {
+		return nil, err
+	}
+
+	summary := fmt.Sprintf(i18n.G("Remove quota group %q"), name)
+	return quotaControlTaskSet(st, summary, &quotaControlAction{
+		Action:        "remove",
+		QuotaName:     name,
+		AffectedSnaps: grp.Snaps,
+	}), nil
+}
+
+func quotaControlAffectedSnaps(t *state.Task) ([]string, error) {
+	var action quotaControlAction
+	if err := t.Get("quota-control-action", &action); err != nil {
+		return nil, err
+	}
+	return action.AffectedSnaps, nil
+}
+
+func setQuotaGroupState(st *state.State, name string, grp *quota.Group) error {
+	quotas, err := AllQuotas(st)
+	if err != nil {
+		return err
+	}
+	if grp != nil {
+		quotas[name] = grp
+	} else {
+		delete(quotas, name)
+	}
+	if len(quotas) == 0 {
+		st.Set("quotas", nil)
+	} else {
+		st.Set("quotas", quotas)
+	}
+	return nil
+}
+
+// applyQuotaGroup moves the quota group with the given name from the
+// given state to the given one, either of which can be nil for no
+// group, in the state and on disk. If that fails, what was done is put
+// back as it was. It must be called with the state locked but unlocks
+// it while restarting services.
+func applyQuotaGroup(st *state.State, name string, from, to *quota.Group) (err error) {
+	if err := setQuotaGroupState(st, name, to); err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if e := setQuotaGroupState(st, name, from); e != nil {
+			logger.Noticef("Cannot restore the state of quota group %q: %v", name, e)
+			return
+		}
+		if e := writeQuotaGroup(st, to, from); e != nil {
+			logger.Noticef("Cannot restore quota group %q: %v", name, e)
+		}
+	}()
+	return writeQuotaGroup(st, from, to)
+}
+
+// writeQuotaGroup writes the slice of the given quota group and the
+// services of its snaps, as per the quota groups in the state, and
+// removes the slice of the group it replaces if it is gone.
+func writeQuotaGroup(st *state.State, from, to *quota.Group) error {
+	var snapNames []string
+	if from != nil {
+		snapNames = append(snapNames, from.Snaps...)
+	}
+	if to != nil {
+		if err := wrappers.EnsureQuotaGroupSlice(to, progress.Null); err != nil {
+			return fmt.Errorf("cannot write slice of quota group %q: %v", to.Name, err)
+		}
+		for _, snapName := range to.Snaps {
+			if !strutil.ListContains(snapNames, snapName) {
+				snapNames = append(snapNames, snapName)
+			}
+		}
+	}
+
+	restart, err := ensureSnapServices(st, snapNames, nil)
+	if err != nil {
+		return err
+	}
+	if err := restartServices(st, restart); err != nil {
+		return err
+	}
+
+	if to == nil && from != nil {
+		if err := wrappers.RemoveQuotaGroupSlice(from, progress.Null); err != nil {
+			return fmt.Errorf("cannot remove slice of quota group %q: %v", from.Name, err)
+		}
+	}
+	return nil
+}
+
+func (m *ServiceManager) doQuotaControl(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var action quotaControlAction
+	if err := t.Get("quota-control-action", &action); err != nil {
+		return err
+	}
+	quotas, err := AllQuotas(st)
+	if err != nil {
+		return err
+	}
+	old := quotas[action.QuotaName]
+
+	var grp *quota.Group
+	switch action.Action {
+	case "set":
+		if action.Update == nil {
+			return fmt.Errorf("internal error: no update for quota group %q", action.QuotaName)
+		}
+		grp, _, err = updatedQuotaGroup(st, quotas, action.Update)
+		if err != nil {
+			return err
+		}
+	case "remove":
+		if old == nil {
+			return fmt.Errorf("cannot remove quota group %q: no such group", action.QuotaName)
+		}
+	default:
+		return fmt.Errorf("internal error: unknown quota action %q", action.Action)
+	}
+
+	// remember the group as it was, to put it back on undo
+	t.Set("old-quota-group", old)
+	return applyQuotaGroup(st, action.QuotaName, old, grp)
+}
+
+func (m *ServiceManager) undoQuotaControl(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var action quotaControlAction
+	if err := t.Get("quota-control-action", &action); err != nil {
+		return err
+	}
+	var old *quota.Group
+	if err := t.Get("old-quota-group", &old); err != nil && err != state.ErrNoState {
+		return err
+	}
+	current, err := GetQuota(st, action.QuotaName)
+	if err != nil && err != state.ErrNoState {
+		return err
+	}
+	return applyQuotaGroup(st, action.QuotaName, current, old)
+}
+
+// EnsureSnapAbsentFromQuotaGroup drops the given snap, which is being
+// removed, from the quota group it belongs to, if any.
+func EnsureSnapAbsentFromQuotaGroup(st *state.State, instanceName string) error {
+	quotas, err := AllQuotas(st)
+	if err != nil {
+		return err
+	}
+	grp := quotaGroupForSnap(quotas, instanceName)
+	if grp == nil {
+		return nil
+	}
+	snaps := make([]string, 0, len(grp.Snaps)-1)
+	for _, snapName := range grp.Snaps {
+		if snapName != instanceName {
+			snaps = append(snaps, snapName)
+		}
+	}
+	grp.Snaps = snaps
+	return setQuotaGroupState(st, grp.Name, grp)
+}
+
+// ensureSnapServices rewrites the services of the given snaps as per
+// their current options, adjusted by the given function if not nil. It
+// returns the services that were rewritten and need restarting if they
+// are running.
+func ensureSnapServices(st *state.State, snapNames []string, adjust func(opts *wrappers.AddSnapServicesOptions)) ([]*snap.AppInfo, error) {
+	sorted := append([]string(nil), snapNames...)
+	sort.Strings(sorted)
+
+	var restart []*snap.AppInfo
+	for _, snapName := range sorted {
+		info, err := snapstate.CurrentInfo(st, snapName)
+		if err != nil {
+			if _, ok := err.(*snap.NotInstalledError); ok {
+				// removed since it was added to the group
+				continue
+			}
+			return nil, err
+		}
+		opts, err := SnapServiceOptions(st, snapName)
+		if err != nil {
+			return nil, err
+		}
+		if adjust != nil {
+			adjust(opts)
+		}
+		changed, err := wrappers.EnsureSnapServices(info, opts, progress.Null)
+		if err != nil {
+			return nil, fmt.Errorf("cannot update services of snap %q: %v", snapName, err)
+		}
+		if changed {
+			restart = append(restart, info.Services()...)
+		}
+	}
+	return restart, nil
+}
+
+// restartServices restarts those of the given services that are
+// running. It must be called with the state locked but unlocks it while
+// restarting services.
+func restartServices(st *state.State, svcs []*snap.AppInfo) error {
+	if len(svcs) == 0 {
+		return nil
+	}
+	st.Unlock()
+	defer st.Lock()
+	return wrappers.RestartServices(svcs, progress.Null, timings.New(nil))
+}
@@ -0,0 +1,476 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/quota"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type quotaControlSuite struct {
+	testutil.BaseTest
+
+	state        *state.State
+	runner       *state.TaskRunner
+	systemctlLog [][]string
+}
+
+var _ = Suite(&quotaControlSuite{})
+
+const testYaml = `name: test-snap
+version: 1
+apps:
+  svc:
+    command: bin/svc
+    daemon: simple
+  cmd:
+    command: bin/cmd
+`
+
+func (s *quotaControlSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	s.AddCleanup(snap.MockSanitizePlugsSlots(func(*snap.Info) {}))
+	s.AddCleanup(servicestate.MockSystemdEnsureAtLeast(func(int) error { return nil }))
+
+	s.state = state.New(nil)
+	s.runner = state.NewTaskRunner(s.state)
+	servicestate.Manager(s.state, s.runner)
+	s.AddCleanup(s.runner.Stop)
+	s.systemctlLog = nil
+	s.AddCleanup(systemd.MockSystemctl(func(args ...string) ([]byte, error) {
+		s.systemctlLog = append(s.systemctlLog, args)
+		if len(args) > 2 && args[1] == "--property=Id,ActiveState,UnitFileState,Type" {
+			var blocks []string
+			for _, unit := range args[2:] {
+				blocks = append(blocks, fmt.Sprintf("Id=%s\nType=simple\nActiveState=active\nUnitFileState=enabled\n", unit))
+			}
+			return []byte(strings.Join(blocks, "\n")), nil
+		}
+		if len(args) > 1 && args[0] == "show" {
+			return []byte("ActiveState=inactive\n"), nil
+		}
+		return nil, nil
+	}))
+	s.AddCleanup(systemd.MockStopDelays(time.Millisecond, 25*time.Second))
+}
+
+func (s *quotaControlSuite) mockSnap(c *C, name, typ string) {
+	yaml := testYaml
+	yaml = "name: " + name + "\n" + yaml[len("name: test-snap\n"):]
+	if typ != "app" {
+		yaml += "type: " + typ + "\n"
+	}
+	si := &snap.SideInfo{RealName: name, Revision: snap.R(1)}
+	snaptest.MockSnap(c, yaml, si)
+	snapstate.Set(s.state, name, &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+		SnapType: typ,
+	})
+}
+
+// runChange runs the given tasks in a change to completion. It must be
+// called with the state locked.
+func (s *quotaControlSuite) runChange(c *C, ts *state.TaskSet) *state.Change {
+	chg := s.state.NewChange("quota-control", "...")
+	chg.AddAll(ts)
+	s.settle(c, chg)
+	return chg
+}
+
+// settle runs the given change to completion. It must be called with
+// the state locked.
+func (s *quotaControlSuite) settle(c *C, chg *state.Change) {
+	s.state.Unlock()
+	defer s.state.Lock()
+	for i := 0; i < 10; i++ {
+		s.runner.Ensure()
+		s.runner.Wait()
+		s.state.Lock()
+		ready := chg.IsReady()
+		s.state.Unlock()
+		if ready {
+			return
+		}
+	}
+	c.Fatalf("change did not complete")
+}
+
+func (s *quotaControlSuite) setQuota(c *C, update *quota.Group) *quota.Group {
+	ts, err := servicestate.SetQuota(s.state, update)
+	c.Assert(err, IsNil)
+	chg := s.runChange(c, ts)
+	c.Assert(chg.Err(), IsNil)
+	grp, err := servicestate.GetQuota(s.state, update.Name)
+	c.Assert(err, IsNil)
+	return grp
+}
+
+func (s *quotaControlSuite) serviceFile(name string) string {
+	return filepath.Join(dirs.SnapServicesDir, "snap."+name+".svc.service")
+}
+
+func (s *quotaControlSuite) TestSetQuotaCreateAndUpdate(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockSnap(c, "test-snap", "app")
+	s.mockSnap(c, "other-snap", "app")
+
+	ts, err := servicestate.SetQuota(s.state, &quota.Group{
+		Name:        "foo-group",
+		MemoryLimit: 1024 * 1024,
+		Snaps:       []string{"test-snap"},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(ts.Tasks(), HasLen, 1)
+	c.Check(ts.Tasks()[0].Kind(), Equals, "quota-control")
+	c.Check(ts.Tasks()[0].Summary(), Equals, `Set quota group "foo-group"`)
+
+	// nothing happens until the change runs
+	_, err = servicestate.GetQuota(s.state, "foo-group")
+	c.Check(err, Equals, state.ErrNoState)
+	c.Check(s.systemctlLog, HasLen, 0)
+
+	chg := s.runChange(c, ts)
+	c.Assert(chg.Err(), IsNil)
+	grp, err := servicestate.GetQuota(s.state, "foo-group")
+	c.Assert(err, IsNil)
+	c.Check(grp, DeepEquals, &quota.Group{
+		Name:        "foo-group",
+		MemoryLimit: 1024 * 1024,
+		Snaps:       []string{"test-snap"},
+	})
+
+	slicePath := filepath.Join(dirs.SnapServicesDir, `snap.foo\x2dgroup.slice`)
+	c.Check(slicePath, testutil.FileEquals, `[Unit]
+# Auto-generated, DO NOT EDIT
+Description=Slice for snap quota group foo-group
+Before=slices.target
+X-Snappy=yes
+
+[Slice]
+MemoryAccounting=true
+MemoryMax=1048576
+MemoryLimit=1048576
+`)
+	c.Check(s.serviceFile("test-snap"), testutil.FileContains, "\nSlice=snap.foo\\x2dgroup.slice\n")
+	c.Check(s.systemctlLog, DeepEquals, [][]string{
+		{"daemon-reload"},
+		{"daemon-reload"},
+		{"show", "--property=Id,ActiveState,UnitFileState,Type", "snap.test-snap.svc.service"},
+		{"stop", "snap.test-snap.svc.service"},
+		{"show", "--property=ActiveState", "snap.test-snap.svc.service"},
+		{"start", "snap.test-snap.svc.service"},
+	})
+
+	quotas, err := servicestate.AllQuotas(s.state)
+	c.Assert(err, IsNil)
+	c.Check(quotas, DeepEquals, map[string]*quota.Group{"foo-group": grp})
+
+	opts, err := servicestate.SnapServiceOptions(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(opts.QuotaGroup, DeepEquals, grp)
+	opts, err = servicestate.SnapServiceOptions(s.state, "other-snap")
+	c.Assert(err, IsNil)
+	c.Check(opts.QuotaGroup, IsNil)
+
+	// update the limits and add a snap, the existing snap services
+	// are already in place
+	s.systemctlLog = nil
+	grp = s.setQuota(c, &quota.Group{
+		Name:        "foo-group",
+		CPULimit:    50,
+		ThreadLimit: 32,
+		Snaps:       []string{"other-snap", "test-snap"},
+	})
+	c.Check(grp, DeepEquals, &quota.Group{
+		Name:        "foo-group",
+		MemoryLimit: 1024 * 1024,
+		CPULimit:    50,
+		ThreadLimit: 32,
+		Snaps:       []string{"test-snap", "other-snap"},
+	})
+	c.Check(slicePath, testutil.FileContains, "CPUAccounting=true\nCPUQuota=50%\nTasksAccounting=true\nTasksMax=32\n")
+	c.Check(s.serviceFile("other-snap"), testutil.FileContains, "\nSlice=snap.foo\\x2dgroup.slice\n")
+	c.Check(s.systemctlLog, DeepEquals, [][]string{
+		{"daemon-reload"},
+		{"daemon-reload"},
+		{"show", "--property=Id,ActiveState,UnitFileState,Type", "snap.other-snap.svc.service"},
+		{"stop", "snap.other-snap.svc.service"},
+		{"show", "--property=ActiveState", "snap.other-snap.svc.service"},
+		{"start", "snap.other-snap.svc.service"},
+	})
+
+	grp1, err := servicestate.GetQuota(s.state, "foo-group")
+	c.Assert(err, IsNil)
+	c.Check(grp1, DeepEquals, grp)
+	_, err = servicestate.GetQuota(s.state, "bar-group")
+	c.Check(err, Equals, state.ErrNoState)
+}
+
+func (s *quotaControlSuite) TestSetQuotaErrors(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockSnap(c, "test-snap", "app")
+	s.mockSnap(c, "some-base", "base")
+
+	s.setQuota(c, &quota.Group{Name: "foo", CPULimit: 10, Snaps: []string{"test-snap"}})
+
+	for _, t := range []struct {
+		grp *quota.Group
+		err string
+	}{
+		{&quota.Group{Name: "bar", Snaps: []string{"test-snap"}}, `quota group "bar" must have at least one limit`},
+		{&quota.Group{Name: "bar", CPULimit: 10, Snaps: []string{"test-snap"}}, `cannot add snap "test-snap" to quota group "bar": snap already in quota group "foo"`},
+		{&quota.Group{Name: "bar", CPULimit: 10, Snaps: []string{"missing-snap"}}, `cannot add snap "missing-snap" to quota group "bar": snap is not installed`},
+		{&quota.Group{Name: "bar", CPULimit: 10, Snaps: []string{"some-base"}}, `cannot add snap "some-base" to quota group "bar": snaps of type "base" are not supported`},
+		{&quota.Group{Name: "foo", MemoryLimit: 10}, `memory limit 10 of quota group "foo" is too small: must be at least 4096 bytes`},
+	} {
+		_, err := servicestate.SetQuota(s.state, t.grp)
+		c.Check(err, ErrorMatches, t.err)
+	}
+
+	// nothing changed
+	quotas, err := servicestate.AllQuotas(s.state)
+	c.Assert(err, IsNil)
+	c.Check(quotas, DeepEquals, map[string]*quota.Group{
+		"foo": {Name: "foo", CPULimit: 10, Snaps: []string{"test-snap"}},
+	})
+}
+
+func (s *quotaControlSuite) TestSetQuotaConflict(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockSnap(c, "test-snap", "app")
+	s.mockSnap(c, "other-snap", "app")
+
+	chg := s.state.NewChange("refresh", "...")
+	t := s.state.NewTask("link-snap", "...")
+	t.Set("snap-setup", &snapstate.SnapSetup{SideInfo: &snap.SideInfo{RealName: "test-snap"}})
+	chg.AddTask(t)
+
+	_, err := servicestate.SetQuota(s.state, &quota.Group{Name: "foo", CPULimit: 10, Snaps: []string{"test-snap"}})
+	c.Check(err, ErrorMatches, `snap "test-snap" has "refresh" change in progress`)
+
+	// a pending change to the group conflicts with other changes to
+	// it, and with changes to its snaps
+	ts, err := servicestate.SetQuota(s.state, &quota.Group{Name: "bar", CPULimit: 10, Snaps: []string{"other-snap"}})
+	c.Assert(err, IsNil)
+	chg = s.state.NewChange("quota-control", "...")
+	chg.AddAll(ts)
+
+	_, err = servicestate.SetQuota(s.state, &quota.Group{Name: "bar", CPULimit: 20})
+	c.Check(err, ErrorMatches, `quota group "bar" has "quota-control" change in progress`)
+	c.Check(err, FitsTypeOf, &snapstate.ChangeConflictError{})
+
+	err = snapstate.CheckChangeConflict(s.state, "other-snap", nil)
+	c.Check(err, ErrorMatches, `snap "other-snap" has "quota-control" change in progress`)
+}
+
+func (s *quotaControlSuite) TestRemoveQuota(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockSnap(c, "test-snap", "app")
+
+	s.setQuota(c, &quota.Group{Name: "foo", ThreadLimit: 10, Snaps: []string{"test-snap"}})
+	slicePath := filepath.Join(dirs.SnapServicesDir, "snap.foo.slice")
+	c.Check(slicePath, testutil.FilePresent)
+
+	s.systemctlLog = nil
+	ts, err := servicestate.RemoveQuota(s.state, "foo")
+	c.Assert(err, IsNil)
+	c.Check(ts.Tasks()[0].Summary(), Equals, `Remove quota group "foo"`)
+	chg := s.runChange(c, ts)
+	c.Assert(chg.Err(), IsNil)
+	c.Check(slicePath, testutil.FileAbsent)
+	content, err := ioutil.ReadFile(s.serviceFile("test-snap"))
+	c.Assert(err, IsNil)
+	c.Check(string(content), Not(testutil.Contains), "Slice=")
+	c.Check(s.systemctlLog, DeepEquals, [][]string{
+		{"daemon-reload"},
+		{"show", "--property=Id,ActiveState,UnitFileState,Type", "snap.test-snap.svc.service"},
+		{"stop", "snap.test-snap.svc.service"},
+		{"show", "--property=ActiveState", "snap.test-snap.svc.service"},
+		{"start", "snap.test-snap.svc.service"},
+		{"daemon-reload"},
+	})
+
+	quotas, err := servicestate.AllQuotas(s.state)
+	c.Assert(err, IsNil)
+	c.Check(quotas, HasLen, 0)
+
+	_, err = servicestate.RemoveQuota(s.state, "foo")
+	c.Check(err, ErrorMatches, `cannot remove quota group "foo": no such group`)
+}
+
+func (s *quotaControlSuite) addErrorTask(chg *state.Change) {
+	s.runner.AddHandler("error-trigger", func(*state.Task, *tomb.Tomb) error {
+		return errors.New("boom")
+	}, nil)
+	t := s.state.NewTask("error-trigger", "...")
+	for _, other := range chg.Tasks() {
+		t.WaitFor(other)
+	}
+	chg.AddTask(t)
+}
+
+func (s *quotaControlSuite) TestSetQuotaUndo(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockSnap(c, "test-snap", "app")
+	s.mockSnap(c, "other-snap", "app")
+	s.setQuota(c, &quota.Group{Name: "foo", ThreadLimit: 10, Snaps: []string{"test-snap"}})
+
+	// updating the group is undone
+	ts, err := servicestate.SetQuota(s.state, &quota.Group{Name: "foo", ThreadLimit: 20, Snaps: []string{"other-snap"}})
+	c.Assert(err, IsNil)
+	chg := s.state.NewChange("quota-control", "...")
+	chg.AddAll(ts)
+	s.addErrorTask(chg)
+	s.settle(c, chg)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*boom.*`)
+	c.Check(ts.Tasks()[0].Status(), Equals, state.UndoneStatus)
+
+	grp, err := servicestate.GetQuota(s.state, "foo")
+	c.Assert(err, IsNil)
+	c.Check(grp, DeepEquals, &quota.Group{Name: "foo", ThreadLimit: 10, Snaps: []string{"test-snap"}})
+	slicePath := filepath.Join(dirs.SnapServicesDir, "snap.foo.slice")
+	c.Check(slicePath, testutil.FileContains, "\nTasksMax=10\n")
+	c.Check(s.serviceFile("test-snap"), testutil.FileContains, "\nSlice=snap.foo.slice\n")
+	content, err := ioutil.ReadFile(s.serviceFile("other-snap"))
+	c.Assert(err, IsNil)
+	c.Check(string(content), Not(testutil.Contains), "Slice=")
+
+	// creating a group is undone
+	ts, err = servicestate.SetQuota(s.state, &quota.Group{Name: "bar", CPULimit: 10, Snaps: []string{"other-snap"}})
+	c.Assert(err, IsNil)
+	chg = s.state.NewChange("quota-control", "...")
+	chg.AddAll(ts)
+	s.addErrorTask(chg)
+	s.settle(c, chg)
+	c.Check(chg.Err(), NotNil)
+
+	_, err = servicestate.GetQuota(s.state, "bar")
+	c.Check(err, Equals, state.ErrNoState)
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.bar.slice"), testutil.FileAbsent)
+	content, err = ioutil.ReadFile(s.serviceFile("other-snap"))
+	c.Assert(err, IsNil)
+	c.Check(string(content), Not(testutil.Contains), "Slice=")
+}
+
+func (s *quotaControlSuite) TestRemoveQuotaUndo(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockSnap(c, "test-snap", "app")
+	s.setQuota(c, &quota.Group{Name: "foo", ThreadLimit: 10, Snaps: []string{"test-snap"}})
+
+	ts, err := servicestate.RemoveQuota(s.state, "foo")
+	c.Assert(err, IsNil)
+	chg := s.state.NewChange("quota-control", "...")
+	chg.AddAll(ts)
+	s.addErrorTask(chg)
+	s.settle(c, chg)
+	c.Check(chg.Err(), NotNil)
+
+	grp, err := servicestate.GetQuota(s.state, "foo")
+	c.Assert(err, IsNil)
+	c.Check(grp, DeepEquals, &quota.Group{Name: "foo", ThreadLimit: 10, Snaps: []string{"test-snap"}})
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.foo.slice"), testutil.FilePresent)
+	c.Check(s.serviceFile("test-snap"), testutil.FileContains, "\nSlice=snap.foo.slice\n")
+}
+
+func (s *quotaControlSuite) TestSetQuotaFailureRestores(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockSnap(c, "test-snap", "app")
+	s.setQuota(c, &quota.Group{Name: "foo", ThreadLimit: 10, Snaps: []string{"test-snap"}})
+
+	ts, err := servicestate.SetQuota(s.state, &quota.Group{Name: "foo", ThreadLimit: 20})
+	c.Assert(err, IsNil)
+
+	// writing the services of the snaps fails
+	c.Assert(os.Remove(s.serviceFile("test-snap")), IsNil)
+	c.Assert(os.Mkdir(s.serviceFile("test-snap"), 0755), IsNil)
+
+	chg := s.runChange(c, ts)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*cannot update services of snap "test-snap": .*`)
+
+	// the group is as it was
+	grp, err := servicestate.GetQuota(s.state, "foo")
+	c.Assert(err, IsNil)
+	c.Check(grp, DeepEquals, &quota.Group{Name: "foo", ThreadLimit: 10, Snaps: []string{"test-snap"}})
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.foo.slice"), testutil.FileContains, "\nTasksMax=10\n")
+}
+
+func (s *quotaControlSuite) TestEnsureSnapAbsentFromQuotaGroup(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockSnap(c, "test-snap", "app")
+	s.mockSnap(c, "other-snap", "app")
+	s.setQuota(c, &quota.Group{Name: "foo", ThreadLimit: 10, Snaps: []string{"test-snap", "other-snap"}})
+
+	c.Assert(servicestate.EnsureSnapAbsentFromQuotaGroup(s.state, "test-snap"), IsNil)
+	grp, err := servicestate.GetQuota(s.state, "foo")
+	c.Assert(err, IsNil)
+	c.Check(grp.Snaps, DeepEquals, []string{"other-snap"})
+
+	// snaps in no group are left alone
+	c.Assert(servicestate.EnsureSnapAbsentFromQuotaGroup(s.state, "test-snap"), IsNil)
+	grp, err = servicestate.GetQuota(s.state, "foo")
+	c.Assert(err, IsNil)
+	c.Check(grp.Snaps, DeepEquals, []string{"other-snap"})
+
+	// the hook is in place
+	c.Check(snapstate.EnsureSnapAbsentFromQuotaGroup, NotNil)
+}
@@ -0,0 +1,48 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate
+
+import (
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+// ServiceManager is responsible for the quota groups of the services
+// of snaps and for relaying actions on user services to the sessions
+// of the users.
+type ServiceManager struct {
+	state *state.State
+}
+
+// Manager returns a new service manager.
+func Manager(st *state.State, runner *state.TaskRunner) *ServiceManager {
+	m := &ServiceManager{state: st}
+
+	runner.AddHandler("quota-control", m.doQuotaControl, m.undoQuotaControl)
+	snapstate.AddAffectedSnapsByKind("quota-control", quotaControlAffectedSnaps)
+	runner.AddHandler("user-service-control", m.doUserServiceControl, nil)
+
+	return m
+}
+
+// Ensure is part of the overlord.StateManager interface.
+func (m *ServiceManager) Ensure() error {
+	return nil
+}
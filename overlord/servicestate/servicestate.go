@@ -20,15 +20,22 @@
 package servicestate
 
 import (
+	"context"
 	"fmt"
 	"time"
 
+	"gopkg.in/tomb.v2"
+
 	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/overlord/cmdstate"
 	"github.com/snapcore/snapd/overlord/hookstate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/systemd"
+	userclient "github.com/snapcore/snapd/usersession/client"
 )
 
 type Instruction struct {
@@ -76,11 +83,16 @@ func Control(st *state.State, appInfos []*snap.AppInfo, inst *Instruction, conte
 	svcs := make([]string, 0, len(appInfos))
 	snapNames := make([]string, 0, len(appInfos))
 	lastName := ""
-	names := make([]string, len(appInfos))
-	for i, svc := range appInfos {
-		svcs = append(svcs, svc.ServiceName())
+	var names, userSvcs, userNames []string
+	for _, svc := range appInfos {
 		snapName := svc.Snap.InstanceName()
-		names[i] = snapName + "." + svc.Name
+		if svc.DaemonScope == snap.UserDaemon {
+			userSvcs = append(userSvcs, svc.ServiceName())
+			userNames = append(userNames, snapName+"."+svc.Name)
+		} else {
+			svcs = append(svcs, svc.ServiceName())
+			names = append(names, snapName+"."+svc.Name)
+		}
 		if snapName != lastName {
 			snapNames = append(snapNames, snapName)
 			lastName = snapName
@@ -100,6 +112,9 @@ func Control(st *state.State, appInfos []*snap.AppInfo, inst *Instruction, conte
 		return nil, &ServiceActionConflictError{err}
 	}
 
+	if len(svcs) == 0 {
+		ctlcmds = nil
+	}
 	for _, cmd := range ctlcmds {
 		argv := append([]string{"systemctl", cmd}, svcs...)
 		desc := fmt.Sprintf("%s of %v", cmd, names)
@@ -112,6 +127,19 @@ func Control(st *state.State, appInfos []*snap.AppInfo, inst *Instruction, conte
 		tts = append(tts, ts)
 	}
 
+	if len(userSvcs) > 0 {
+		// user services run in the sessions of the users, the
+		// action is relayed to their session agents
+		t := st.NewTask("user-service-control", fmt.Sprintf("%s of user services %v", inst.Action, userNames))
+		t.Set("user-service-action", &userServiceAction{
+			Action:   inst.Action,
+			Enable:   inst.Enable,
+			Disable:  inst.Disable,
+			Services: userSvcs,
+		})
+		tts = append(tts, state.NewTaskSet(t))
+	}
+
 	// make a taskset wait for its predecessor
 	for i := 1; i < len(tts); i++ {
 		tts[i].WaitAll(tts[i-1])
@@ -119,3 +147,56 @@ func Control(st *state.State, appInfos []*snap.AppInfo, inst *Instruction, conte
 
 	return tts, nil
 }
+
+// userServiceAction is the action on user services carried out by a
+// user-service-control task.
+type userServiceAction struct {
+	Action   string   `json:"action"`
+	Enable   bool     `json:"enable,omitempty"`
+	Disable  bool     `json:"disable,omitempty"`
+	Services []string `json:"services"`
+}
+
+func (m *ServiceManager) doUserServiceControl(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	var action userServiceAction
+	err := t.Get("user-service-action", &action)
+	st.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// the enabled state is shared by all the users
+	sysd := systemd.New(dirs.GlobalRootDir, systemd.GlobalUserMode, progress.Null)
+	ctx, cancel := context.WithTimeout(context.Background(), userclient.ServicesTimeout)
+	defer cancel()
+	cli := userclient.New()
+
+	switch action.Action {
+	case "start":
+		if action.Enable {
+			for _, svc := range action.Services {
+				if err := sysd.Enable(svc); err != nil {
+					return err
+				}
+			}
+		}
+		return cli.ServicesStart(ctx, action.Services)
+	case "stop":
+		if action.Disable {
+			for _, svc := range action.Services {
+				if err := sysd.Disable(svc); err != nil {
+					return err
+				}
+			}
+		}
+		return cli.ServicesStop(ctx, action.Services)
+	case "restart":
+		// the session agents restart the services that are running,
+		// reloading them is not supported
+		return cli.ServicesRestart(ctx, action.Services)
+	default:
+		return fmt.Errorf("internal error: unknown user service action %q", action.Action)
+	}
+}
@@ -0,0 +1,170 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+)
+
+type userServicesSuite struct {
+	quotaControlSuite
+
+	server *http.Server
+
+	mu       sync.Mutex
+	requests []string
+}
+
+var _ = Suite(&userServicesSuite{})
+
+const userServicesYaml = `name: test-snap
+version: 1
+apps:
+  svc:
+    command: bin/svc
+    daemon: simple
+  user-svc:
+    command: bin/svc
+    daemon: simple
+    daemon-scope: user
+`
+
+func (s *userServicesSuite) SetUpTest(c *C) {
+	s.quotaControlSuite.SetUpTest(c)
+
+	s.requests = nil
+	s.server = &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		c.Check(err, IsNil)
+		s.mu.Lock()
+		s.requests = append(s.requests, fmt.Sprintf("%s %s %s", r.Method, r.URL.Path, body))
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write([]byte(`{"type": "sync", "result": null}`))
+	})}
+	// the session agent of a logged in user
+	sock := filepath.Join(dirs.XdgRuntimeDirBase, "1000", "snapd-session-agent.socket")
+	c.Assert(os.MkdirAll(filepath.Dir(sock), 0755), IsNil)
+	l, err := net.Listen("unix", sock)
+	c.Assert(err, IsNil)
+	go s.server.Serve(l)
+	s.AddCleanup(func() { s.server.Close() })
+}
+
+func (s *userServicesSuite) apps(c *C) []*snap.AppInfo {
+	info := snaptest.MockInfo(c, userServicesYaml, &snap.SideInfo{Revision: snap.R(1)})
+	return []*snap.AppInfo{info.Apps["svc"], info.Apps["user-svc"]}
+}
+
+func (s *userServicesSuite) TestControlUserServices(c *C) {
+	for _, t := range []struct {
+		inst     *servicestate.Instruction
+		ctlcmds  []string
+		request  string
+		enabling []string
+	}{{
+		inst:    &servicestate.Instruction{Action: "start"},
+		ctlcmds: []string{"start"},
+		request: `POST /v1/service-control {"action":"start","services":["snap.test-snap.user-svc.service"]}`,
+	}, {
+		inst:     &servicestate.Instruction{Action: "start", StartOptions: client.StartOptions{Enable: true}},
+		ctlcmds:  []string{"enable", "start"},
+		request:  `POST /v1/service-control {"action":"start","services":["snap.test-snap.user-svc.service"]}`,
+		enabling: []string{"--user", "--global", "--root", dirs.GlobalRootDir, "enable", "snap.test-snap.user-svc.service"},
+	}, {
+		inst:     &servicestate.Instruction{Action: "stop", StopOptions: client.StopOptions{Disable: true}},
+		ctlcmds:  []string{"disable", "stop"},
+		request:  `POST /v1/service-control {"action":"stop","services":["snap.test-snap.user-svc.service"]}`,
+		enabling: []string{"--user", "--global", "--root", dirs.GlobalRootDir, "disable", "snap.test-snap.user-svc.service"},
+	}, {
+		inst:    &servicestate.Instruction{Action: "restart", RestartOptions: client.RestartOptions{Reload: true}},
+		ctlcmds: []string{"reload-or-restart"},
+		request: `POST /v1/service-control {"action":"restart","services":["snap.test-snap.user-svc.service"]}`,
+	}} {
+		s.requests = nil
+		s.systemctlLog = nil
+
+		tss, err := servicestate.Control(s.state, s.apps(c), t.inst, nil)
+		c.Assert(err, IsNil)
+
+		s.state.Lock()
+		// the system service is controlled with systemctl, the user
+		// service through the session agents
+		c.Assert(tss, HasLen, len(t.ctlcmds)+1)
+		for i, cmd := range t.ctlcmds {
+			tasks := tss[i].Tasks()
+			c.Assert(tasks, HasLen, 1)
+			c.Check(tasks[0].Kind(), Equals, "exec-command")
+			c.Check(tasks[0].Summary(), Equals, fmt.Sprintf("%s of [test-snap.svc]", cmd))
+		}
+		userTasks := tss[len(tss)-1].Tasks()
+		c.Assert(userTasks, HasLen, 1)
+		c.Check(userTasks[0].Kind(), Equals, "user-service-control")
+		c.Check(userTasks[0].Summary(), Equals, fmt.Sprintf("%s of user services [test-snap.user-svc]", t.inst.Action))
+
+		// run only the user service task, after the systemctl ones
+		chg := s.state.NewChange("service-control", "...")
+		chg.AddTask(userTasks[0])
+		for _, ts := range tss[:len(tss)-1] {
+			for _, t := range ts.Tasks() {
+				t.SetStatus(state.DoneStatus)
+			}
+		}
+		s.settle(c, chg)
+		c.Check(chg.Err(), IsNil)
+		s.state.Unlock()
+
+		c.Check(s.requests, DeepEquals, []string{t.request}, Commentf("%v", t.inst))
+		if t.enabling != nil {
+			c.Check(s.systemctlLog, DeepEquals, [][]string{t.enabling})
+		} else {
+			c.Check(s.systemctlLog, HasLen, 0)
+		}
+	}
+}
+
+func (s *userServicesSuite) TestControlOnlyUserServices(c *C) {
+	apps := s.apps(c)[1:]
+	tss, err := servicestate.Control(s.state, apps, &servicestate.Instruction{Action: "start"}, nil)
+	c.Assert(err, IsNil)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Assert(tss, HasLen, 1)
+	tasks := tss[0].Tasks()
+	c.Assert(tasks, HasLen, 1)
+	c.Check(tasks[0].Kind(), Equals, "user-service-control")
+}
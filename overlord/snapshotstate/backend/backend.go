@@ -20,6 +20,7 @@
 package backend
 
 import (
+	"archive/tar"
 	"archive/zip"
 	"context"
 	"crypto"
@@ -30,6 +31,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/snapcore/snapd/client"
@@ -47,6 +49,11 @@ const (
 
 	userArchivePrefix = "user/"
 	userArchiveSuffix = ".tgz"
+
+	// the archives of chunked snapshots are uncompressed tar streams
+	// (the chunks themselves are compressed)
+	chunkedArchiveName       = "archive.tar"
+	chunkedUserArchiveSuffix = ".tar"
 )
 
 var (
@@ -61,6 +68,9 @@ var (
 // Flags encompasses extra flags for snapshots backend Save.
 type Flags struct {
 	Auto bool
+	// Chunked asks for the data to be stored in the shared,
+	// deduplicated chunk store.
+	Chunked bool
 }
 
 // Iter loops over all snapshots in the snapshots directory, applying the given
@@ -91,6 +101,10 @@ func Iter(ctx context.Context, f func(*Reader) error) error {
 			if err = ctx.Err(); err != nil {
 				break
 			}
+			if strings.HasPrefix(name, ".") {
+				// work in progress, e.g. an import
+				continue
+			}
 
 			filename := filepath.Join(dirs.SnapshotsDir, name)
 			reader, openError := backendOpen(filename)
@@ -162,9 +176,10 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 		return nil, err
 	}
 
-	var auto bool
+	var auto, chunked bool
 	if flags != nil {
 		auto = flags.Auto
+		chunked = flags.Chunked
 	}
 
 	snapshot := &client.Snapshot{
@@ -179,6 +194,7 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 		Size:     0,
 		Conf:     cfg,
 		Auto:     auto,
+		Chunked:  chunked,
 	}
 
 	aw, err := osutil.NewAtomicFile(Filename(snapshot), 0600, 0, osutil.NoChown, osutil.NoChown)
@@ -190,7 +206,7 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 
 	w := zip.NewWriter(aw)
 	defer w.Close() // note this does not close the file descriptor (that's done by hand on the atomic writer, above)
-	if err := addDirToZip(ctx, snapshot, w, "root", archiveName, si.DataDir()); err != nil {
+	if err := addDirToZip(ctx, snapshot, w, "root", systemArchiveName(snapshot), si.DataDir()); err != nil {
 		return nil, err
 	}
 
@@ -200,27 +216,14 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 	}
 
 	for _, usr := range users {
-		if err := addDirToZip(ctx, snapshot, w, usr.Username, userArchiveName(usr), si.UserDataDir(usr.HomeDir)); err != nil {
+		if err := addDirToZip(ctx, snapshot, w, usr.Username, userArchiveName(snapshot, usr), si.UserDataDir(usr.HomeDir)); err != nil {
 			return nil, err
 		}
 	}
 
-	metaWriter, err := w.Create(metadataName)
-	if err != nil {
-		return nil, err
-	}
-
-	hasher := crypto.SHA3_384.New()
-	enc := json.NewEncoder(io.MultiWriter(metaWriter, hasher))
-	if err := enc.Encode(snapshot); err != nil {
-		return nil, err
-	}
-
-	hashWriter, err := w.Create(metaHashName)
-	if err != nil {
+	if err := addMetaToZip(snapshot, w); err != nil {
 		return nil, err
 	}
-	fmt.Fprintf(hashWriter, "%x\n", hasher.Sum(nil))
 	if err := w.Close(); err != nil {
 		return nil, err
 	}
@@ -236,6 +239,27 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 	return snapshot, nil
 }
 
+// addMetaToZip writes the snapshot metadata, and its hash, into the zip.
+func addMetaToZip(snapshot *client.Snapshot, w *zip.Writer) error {
+	metaWriter, err := w.Create(metadataName)
+	if err != nil {
+		return err
+	}
+
+	hasher := crypto.SHA3_384.New()
+	enc := json.NewEncoder(io.MultiWriter(metaWriter, hasher))
+	if err := enc.Encode(snapshot); err != nil {
+		return err
+	}
+
+	hashWriter, err := w.Create(metaHashName)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(hashWriter, "%x\n", hasher.Sum(nil))
+	return err
+}
+
 var isTesting = osutil.GetenvBool("SNAPPY_TESTING")
 
 func addDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer, username string, entry, dir string) error {
@@ -254,9 +278,12 @@ func addDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer,
 	}
 	tarArgs := []string{
 		"--create",
-		"--sparse", "--gzip",
+		"--sparse",
 		"--directory", parent,
 	}
+	if !snapshot.Chunked {
+		tarArgs = append(tarArgs, "--gzip")
+	}
 
 	noRev, noCommon := true, true
 
@@ -301,8 +328,16 @@ func addDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer,
 	var sz sizer
 	hasher := crypto.SHA3_384.New()
 
+	var cw *chunkWriter
+	out := archiveWriter
+	if snapshot.Chunked {
+		// the archive member only gets the chunk index
+		cw = newChunkWriter()
+		out = cw
+	}
+
 	cmd := tarAsUser(username, tarArgs...)
-	cmd.Stdout = io.MultiWriter(archiveWriter, hasher, &sz)
+	cmd.Stdout = io.MultiWriter(out, hasher, &sz)
 	matchCounter := &strutil.MatchCounter{N: 1}
 	cmd.Stderr = matchCounter
 	if isTesting {
@@ -318,7 +353,220 @@ func addDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer,
 	}
 
 	snapshot.SHA3_384[entry] = fmt.Sprintf("%x", hasher.Sum(nil))
-	snapshot.Size += sz.size
+	if cw == nil {
+		snapshot.Size += sz.size
+		return nil
+	}
+
+	if err := cw.Close(); err != nil {
+		return err
+	}
+	if err := json.NewEncoder(archiveWriter).Encode(cw.refs); err != nil {
+		return err
+	}
+	// what's already in the chunk store doesn't cost anything
+	snapshot.Size += cw.diskSize
 
 	return nil
 }
+
+const (
+	exportManifestName = "export.json"
+	exportFormat       = 1
+	exportChunkPrefix  = "chunks/"
+
+	// tar pads everything to this size
+	tarBlockSize = 512
+)
+
+var timeNow = time.Now
+
+// exportManifest is the description of an exported snapshot set. It
+// is the last member of the export stream, and lists every snapshot
+// file that came before it, together with its size and hash.
+type exportManifest struct {
+	Format int                     `json:"format"`
+	SetID  uint64                  `json:"set-id"`
+	Date   time.Time               `json:"date"`
+	Files  map[string]exportedFile `json:"files"`
+}
+
+type exportedFile struct {
+	Size     int64  `json:"size"`
+	SHA3_384 string `json:"sha3-384"`
+}
+
+// A SnapshotExport is a snapshot set that has been opened for
+// exporting as a single stream.
+type SnapshotExport struct {
+	setID uint64
+	// the files to export, and the name of their entry in the export
+	files    []*os.File
+	names    []string
+	manifest []byte
+	size     int64
+}
+
+// NewSnapshotExport opens the files of the given snapshot set and
+// prepares them for streaming. The chunks used by chunked snapshots in
+// the set are exported along with them.
+//
+// If the returned error is nil, the caller must call Close on the
+// returned SnapshotExport when done with it.
+func NewSnapshotExport(ctx context.Context, setID uint64) (se *SnapshotExport, err error) {
+	var filenames []string
+	chunks := make(map[string]bool)
+	err = Iter(ctx, func(r *Reader) error {
+		if r.SetID != setID {
+			return nil
+		}
+		if r.Broken != "" {
+			return fmt.Errorf("cannot export snapshot set #%d: snapshot %q is broken: %s", setID, r.Name(), r.Broken)
+		}
+		filenames = append(filenames, r.Name())
+		if !r.Chunked {
+			return nil
+		}
+		for entry := range r.SHA3_384 {
+			refs, err := r.chunkIndex(entry)
+			if err != nil {
+				return fmt.Errorf("cannot export snapshot set #%d: snapshot %q: %v", setID, r.Name(), err)
+			}
+			for _, ref := range refs {
+				chunks[ref.SHA3_384] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(filenames) == 0 {
+		return nil, client.ErrSnapshotSetNotFound
+	}
+	sort.Strings(filenames)
+	names := make([]string, len(filenames), len(filenames)+len(chunks))
+	for i, fn := range filenames {
+		names[i] = filepath.Base(fn)
+	}
+	sums := make([]string, 0, len(chunks))
+	for sum := range chunks {
+		sums = append(sums, sum)
+	}
+	sort.Strings(sums)
+	for _, sum := range sums {
+		filenames = append(filenames, chunkPath(sum))
+		names = append(names, exportChunkPrefix+sum)
+	}
+
+	se = &SnapshotExport{setID: setID}
+	defer func() {
+		if err != nil {
+			se.Close()
+			se = nil
+		}
+	}()
+
+	manifest := &exportManifest{
+		Format: exportFormat,
+		SetID:  setID,
+		Date:   timeNow().UTC().Truncate(time.Second),
+		Files:  make(map[string]exportedFile, len(filenames)),
+	}
+
+	hasher := crypto.SHA3_384.New()
+	for i, fn := range filenames {
+		f, err := os.Open(fn)
+		if err != nil {
+			return nil, err
+		}
+		se.files = append(se.files, f)
+		se.names = append(se.names, names[i])
+
+		var sz sizer
+		if _, err := io.Copy(io.MultiWriter(osutil.ContextWriter(ctx), hasher, &sz), f); err != nil {
+			return nil, err
+		}
+		manifest.Files[names[i]] = exportedFile{
+			Size:     sz.size,
+			SHA3_384: fmt.Sprintf("%x", hasher.Sum(nil)),
+		}
+		se.size += tarEntrySize(sz.size)
+		hasher.Reset()
+	}
+
+	se.manifest, err = json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	se.size += tarEntrySize(int64(len(se.manifest)))
+	// the end of a tar stream is marked by two empty blocks
+	se.size += 2 * tarBlockSize
+
+	return se, nil
+}
+
+func tarEntrySize(size int64) int64 {
+	blocks := (size + tarBlockSize - 1) / tarBlockSize
+	// one extra block for the header
+	return (blocks + 1) * tarBlockSize
+}
+
+// Size of the stream that StreamTo will write.
+func (se *SnapshotExport) Size() int64 {
+	return se.size
+}
+
+// StreamTo writes the snapshot set, followed by the manifest that
+// describes it, as a tar stream into the given writer.
+func (se *SnapshotExport) StreamTo(w io.Writer) error {
+	tw := tar.NewWriter(w)
+	modTime := timeNow().Truncate(time.Second)
+
+	for i, f := range se.files {
+		if _, err := f.Seek(0, 0); err != nil {
+			return err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{
+			Name:     se.names[i],
+			Mode:     0600,
+			Size:     fi.Size(),
+			ModTime:  fi.ModTime().Truncate(time.Second),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, f); err != nil {
+			return fmt.Errorf("cannot export %q: %v", hdr.Name, err)
+		}
+	}
+
+	hdr := &tar.Header{
+		Name:     exportManifestName,
+		Mode:     0600,
+		Size:     int64(len(se.manifest)),
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(se.manifest); err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// Close the files of the snapshot set.
+func (se *SnapshotExport) Close() {
+	for _, f := range se.files {
+		f.Close()
+	}
+	se.files = nil
+}
@@ -0,0 +1,405 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+)
+
+// Chunked snapshots don't keep the archives in the snapshot file
+// itself; instead, the (uncompressed) tar stream of each archive is
+// split into content-defined chunks, which are stored compressed in a
+// content-addressed store shared by all snapshots. The snapshot file
+// then only holds, for each archive, the list of chunks to concatenate
+// to get the archive back. As the chunk boundaries depend only on the
+// data around them, data that did not change between snapshots ends
+// up in the same chunks, and is stored only once.
+
+const chunksDirName = ".chunks"
+
+var (
+	// sizes of the chunks, with the average size given by the mask
+	chunkMinSize int    = 256 * 1024
+	chunkMaxSize int    = 4 * 1024 * 1024
+	chunkMask    uint64 = 1<<20 - 1
+
+	// chunks that are younger than this are never pruned, as they
+	// might belong to a snapshot that is still being written
+	chunkPruneGracePeriod = time.Hour
+)
+
+// gearTable is the table used by the rolling hash that determines the
+// chunk boundaries. It needs to be stable across versions of snapd,
+// otherwise deduplication against older snapshots stops working.
+var gearTable [256]uint64
+
+func init() {
+	// splitmix64, with a fixed seed
+	x := uint64(0x736e617073686f74)
+	for i := range gearTable {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gearTable[i] = z ^ (z >> 31)
+	}
+}
+
+// A chunkRef is an entry in the index of a chunked archive.
+type chunkRef struct {
+	SHA3_384 string `json:"sha3-384"`
+	Size     int64  `json:"size"`
+}
+
+func chunksDir() string {
+	return filepath.Join(dirs.SnapshotsDir, chunksDirName)
+}
+
+func chunkPath(sum string) string {
+	return filepath.Join(chunksDir(), sum[:2], sum)
+}
+
+// storeChunk adds the given data to the chunk store, if it's not
+// already there. It returns the reference to the chunk, and how much
+// disk space storing it took.
+func storeChunk(data []byte, hasher hash.Hash) (ref chunkRef, diskSize int64, err error) {
+	hasher.Reset()
+	hasher.Write(data)
+	ref = chunkRef{
+		SHA3_384: fmt.Sprintf("%x", hasher.Sum(nil)),
+		Size:     int64(len(data)),
+	}
+	fn := chunkPath(ref.SHA3_384)
+
+	if osutil.FileExists(fn) {
+		// mark it as in use, so it's not pruned under our feet
+		now := time.Now()
+		if err := os.Chtimes(fn, now, now); err != nil {
+			return ref, 0, err
+		}
+		return ref, 0, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fn), 0700); err != nil {
+		return ref, 0, err
+	}
+	aw, err := osutil.NewAtomicFile(fn, 0600, 0, osutil.NoChown, osutil.NoChown)
+	if err != nil {
+		return ref, 0, err
+	}
+	defer aw.Cancel()
+
+	gz := gzip.NewWriter(aw)
+	if _, err := gz.Write(data); err != nil {
+		return ref, 0, err
+	}
+	if err := gz.Close(); err != nil {
+		return ref, 0, err
+	}
+	if err := aw.Commit(); err != nil {
+		return ref, 0, err
+	}
+
+	fi, err := os.Stat(fn)
+	if err != nil {
+		return ref, 0, err
+	}
+
+	return ref, diskSizeOf(fi), nil
+}
+
+// A chunkWriter splits what is written to it into chunks, and stores
+// them in the chunk store.
+type chunkWriter struct {
+	buf    []byte
+	fp     uint64
+	hasher hash.Hash
+
+	refs []chunkRef
+	// how much disk space the newly stored chunks took
+	diskSize int64
+}
+
+func newChunkWriter() *chunkWriter {
+	return &chunkWriter{
+		buf:    make([]byte, 0, chunkMinSize),
+		hasher: crypto.SHA3_384.New(),
+	}
+}
+
+// boundary returns how much of the given data needs to be added to the
+// current chunk to complete it, or -1 if all of it fits.
+func (cw *chunkWriter) boundary(data []byte) int {
+	size := len(cw.buf)
+	for i, b := range data {
+		size++
+		cw.fp = (cw.fp << 1) + gearTable[b]
+		if size < chunkMinSize {
+			continue
+		}
+		if cw.fp&chunkMask == 0 || size >= chunkMaxSize {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+func (cw *chunkWriter) Write(data []byte) (n int, err error) {
+	n = len(data)
+	for len(data) > 0 {
+		cut := cw.boundary(data)
+		if cut < 0 {
+			cw.buf = append(cw.buf, data...)
+			break
+		}
+		cw.buf = append(cw.buf, data[:cut]...)
+		data = data[cut:]
+		if err := cw.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+func (cw *chunkWriter) flush() error {
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	ref, diskSize, err := storeChunk(cw.buf, cw.hasher)
+	if err != nil {
+		return fmt.Errorf("cannot store chunk: %v", err)
+	}
+	cw.refs = append(cw.refs, ref)
+	cw.diskSize += diskSize
+	cw.buf = cw.buf[:0]
+	cw.fp = 0
+	return nil
+}
+
+// Close stores whatever is left as the last chunk.
+func (cw *chunkWriter) Close() error {
+	return cw.flush()
+}
+
+// A chunkReader reads the chunks of a chunked archive back, in order,
+// checking each one against its reference on the way.
+type chunkReader struct {
+	refs   []chunkRef
+	hasher hash.Hash
+
+	f   *os.File
+	gz  *gzip.Reader
+	cur chunkRef
+	sz  sizer
+}
+
+func newChunkReader(refs []chunkRef) *chunkReader {
+	return &chunkReader{
+		refs:   refs,
+		hasher: crypto.SHA3_384.New(),
+	}
+}
+
+func (cr *chunkReader) next() error {
+	if err := cr.closeCurrent(); err != nil {
+		return err
+	}
+	if len(cr.refs) == 0 {
+		return io.EOF
+	}
+	cr.cur, cr.refs = cr.refs[0], cr.refs[1:]
+
+	f, err := os.Open(chunkPath(cr.cur.SHA3_384))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("missing chunk %.7s…", cr.cur.SHA3_384)
+		}
+		return err
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("cannot read chunk %.7s…: %v", cr.cur.SHA3_384, err)
+	}
+	cr.f = f
+	cr.gz = gz
+	cr.hasher.Reset()
+	cr.sz.Reset()
+
+	return nil
+}
+
+// checkCurrent checks that the current chunk matched its reference.
+func (cr *chunkReader) checkCurrent() error {
+	if cr.sz.size != cr.cur.Size {
+		return fmt.Errorf("chunk %.7s… expected size (%d) does not match actual (%d)", cr.cur.SHA3_384, cr.cur.Size, cr.sz.size)
+	}
+	if actualHash := fmt.Sprintf("%x", cr.hasher.Sum(nil)); actualHash != cr.cur.SHA3_384 {
+		return fmt.Errorf("chunk %.7s… does not match its hash (%.7s…)", cr.cur.SHA3_384, actualHash)
+	}
+	return nil
+}
+
+func (cr *chunkReader) closeCurrent() error {
+	if cr.f == nil {
+		return nil
+	}
+	cr.gz.Close()
+	err := cr.f.Close()
+	cr.f = nil
+	cr.gz = nil
+	return err
+}
+
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if cr.gz == nil {
+			if err := cr.next(); err != nil {
+				return 0, err
+			}
+		}
+		n, err := cr.gz.Read(p)
+		cr.hasher.Write(p[:n])
+		cr.sz.Write(p[:n])
+		if err == io.EOF {
+			if err := cr.checkCurrent(); err != nil {
+				return n, err
+			}
+			if err := cr.closeCurrent(); err != nil {
+				return n, err
+			}
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("cannot read chunk %.7s…: %v", cr.cur.SHA3_384, err)
+		}
+		return n, nil
+	}
+}
+
+func (cr *chunkReader) Close() error {
+	return cr.closeCurrent()
+}
+
+func readChunkIndex(r io.Reader) ([]chunkRef, error) {
+	var refs []chunkRef
+	if err := json.NewDecoder(r).Decode(&refs); err != nil {
+		return nil, fmt.Errorf("cannot read chunk index: %v", err)
+	}
+	return refs, nil
+}
+
+// keepBrokenSnapshotChunks marks the chunks the given broken snapshot
+// refers to as in use, as far as its chunk indexes can still be read.
+func keepBrokenSnapshotChunks(r *Reader, inUse map[string]bool) {
+	// the file of a broken snapshot is closed by Open
+	f, err := os.Open(r.Name())
+	if err != nil {
+		logger.Noticef("Cannot read chunks of broken snapshot %q: %v.", r.Name(), err)
+		return
+	}
+	defer f.Close()
+	br := &Reader{File: f}
+	for entry := range r.SHA3_384 {
+		refs, err := br.chunkIndex(entry)
+		if err != nil {
+			logger.Noticef("Cannot read chunks of broken snapshot %q: %v.", r.Name(), err)
+			continue
+		}
+		for _, ref := range refs {
+			inUse[ref.SHA3_384] = true
+		}
+	}
+}
+
+// PruneChunks removes the chunks that no snapshot uses anymore.
+//
+// Chunks that were stored or reused recently are kept, as they could
+// belong to a snapshot that is still being saved. Broken snapshots are
+// skipped, keeping the chunks they still refer to.
+func PruneChunks(ctx context.Context) error {
+	if !osutil.IsDirectory(chunksDir()) {
+		// no chunked snapshot was ever taken
+		return nil
+	}
+
+	inUse := make(map[string]bool)
+	err := Iter(ctx, func(r *Reader) error {
+		if !r.Chunked {
+			return nil
+		}
+		if r.Broken != "" {
+			// a broken snapshot must not stop pruning for good, but
+			// whatever chunks it still refers to are kept
+			keepBrokenSnapshotChunks(r, inUse)
+			return nil
+		}
+		for entry := range r.SHA3_384 {
+			refs, err := r.chunkIndex(entry)
+			if err != nil {
+				return fmt.Errorf("cannot prune snapshot chunks: snapshot %q: %v", r.Name(), err)
+			}
+			for _, ref := range refs {
+				inUse[ref.SHA3_384] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-chunkPruneGracePeriod)
+	return filepath.Walk(chunksDir(), func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		if inUse[fi.Name()] || fi.ModTime().After(cutoff) {
+			return nil
+		}
+		logger.Debugf("Pruning unused snapshot chunk %q.", fi.Name())
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("cannot prune snapshot chunk: %v", err)
+		}
+		return nil
+	})
+}
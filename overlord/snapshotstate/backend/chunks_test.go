@@ -0,0 +1,226 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+	"github.com/snapcore/snapd/snap"
+)
+
+var chunkyInfo = &snap.Info{SideInfo: snap.SideInfo{RealName: "chunky-snap", Revision: snap.R(7), SnapID: "chunky-id"}, Version: "v1"}
+
+// writeChunkyData puts some incompressible data in the snap's data
+// dir, so that it spans many chunks.
+func writeChunkyData(c *check.C, seed int64) []byte {
+	data := make([]byte, 64*1024)
+	rand.New(rand.NewSource(seed)).Read(data)
+	c.Assert(os.MkdirAll(chunkyInfo.DataDir(), 0755), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(chunkyInfo.DataDir(), "blob"), data, 0644), check.IsNil)
+	return data
+}
+
+func (s *snapshotSuite) saveChunky(c *check.C, setID uint64) *client.Snapshot {
+	shw, err := backend.Save(context.TODO(), setID, chunkyInfo, nil, []string{"snapuser"}, &backend.Flags{Chunked: true})
+	c.Assert(err, check.IsNil)
+	return shw
+}
+
+func storedChunks(c *check.C) []string {
+	chunks, err := filepath.Glob(filepath.Join(dirs.SnapshotsDir, ".chunks", "*", "*"))
+	c.Assert(err, check.IsNil)
+	return chunks
+}
+
+func (s *snapshotSuite) mockSmallChunks() {
+	s.restore = append(s.restore, backend.MockChunkSizes(512, 8*1024, 1<<11-1))
+}
+
+func (s *snapshotSuite) TestChunkedSaveDeduplicates(c *check.C) {
+	s.mockSmallChunks()
+	data := writeChunkyData(c, 1)
+
+	shw := s.saveChunky(c, 1)
+	c.Check(shw.Chunked, check.Equals, true)
+	c.Check(hashkeys(shw), check.DeepEquals, []string{"archive.tar"})
+	c.Check(shw.Size > int64(len(data)), check.Equals, true)
+	chunks := storedChunks(c)
+	c.Check(len(chunks) > 1, check.Equals, true)
+
+	// nothing changed, nothing new is stored
+	shw = s.saveChunky(c, 2)
+	c.Check(shw.Size, check.Equals, int64(0))
+	c.Check(storedChunks(c), check.HasLen, len(chunks))
+
+	// a small change only costs the chunks around it
+	data[len(data)/2] ^= 0xff
+	c.Assert(ioutil.WriteFile(filepath.Join(chunkyInfo.DataDir(), "blob"), data, 0644), check.IsNil)
+	shw = s.saveChunky(c, 3)
+	c.Check(shw.Size > 0, check.Equals, true)
+	c.Check(shw.Size < int64(len(data)/2), check.Equals, true)
+	c.Check(len(storedChunks(c)) < 2*len(chunks), check.Equals, true)
+}
+
+func (s *snapshotSuite) TestChunkedCheckAndRestore(c *check.C) {
+	s.mockSmallChunks()
+	data := writeChunkyData(c, 2)
+	shw := s.saveChunky(c, 1)
+
+	r, err := backend.Open(backend.Filename(shw))
+	c.Assert(err, check.IsNil)
+	defer r.Close()
+	c.Check(r.Chunked, check.Equals, true)
+	c.Check(r.Check(context.TODO(), nil), check.IsNil)
+
+	c.Assert(os.RemoveAll(chunkyInfo.DataDir()), check.IsNil)
+	logf := func(format string, args ...interface{}) {}
+	rs, err := r.Restore(context.TODO(), snap.R(0), []string{"snapuser"}, logf)
+	c.Assert(err, check.IsNil)
+	rs.Cleanup()
+
+	restored, err := ioutil.ReadFile(filepath.Join(chunkyInfo.DataDir(), "blob"))
+	c.Assert(err, check.IsNil)
+	c.Check(bytes.Equal(restored, data), check.Equals, true)
+}
+
+func (s *snapshotSuite) TestChunkedCheckFailures(c *check.C) {
+	s.mockSmallChunks()
+	writeChunkyData(c, 3)
+	shw := s.saveChunky(c, 1)
+
+	r, err := backend.Open(backend.Filename(shw))
+	c.Assert(err, check.IsNil)
+	defer r.Close()
+
+	chunks := storedChunks(c)
+	c.Assert(len(chunks) > 0, check.Equals, true)
+	// replace a chunk with another one
+	c.Assert(os.Rename(chunks[1], chunks[0]), check.IsNil)
+	c.Check(r.Check(context.TODO(), nil), check.ErrorMatches, `(missing chunk|chunk) .*`)
+
+	c.Assert(os.RemoveAll(filepath.Join(dirs.SnapshotsDir, ".chunks")), check.IsNil)
+	c.Check(r.Check(context.TODO(), nil), check.ErrorMatches, `missing chunk .*`)
+}
+
+func (s *snapshotSuite) TestPruneChunks(c *check.C) {
+	s.mockSmallChunks()
+	s.restore = append(s.restore, backend.MockChunkPruneGracePeriod(0))
+
+	// no chunk store, nothing to do
+	c.Check(backend.PruneChunks(context.TODO()), check.IsNil)
+
+	writeChunkyData(c, 4)
+	shw1 := s.saveChunky(c, 1)
+	n1 := len(storedChunks(c))
+	writeChunkyData(c, 5)
+	shw2 := s.saveChunky(c, 2)
+	n2 := len(storedChunks(c))
+	c.Assert(n2 > n1, check.Equals, true)
+
+	// everything is in use
+	c.Check(backend.PruneChunks(context.TODO()), check.IsNil)
+	c.Check(storedChunks(c), check.HasLen, n2)
+
+	c.Assert(os.Remove(backend.Filename(shw1)), check.IsNil)
+	c.Check(backend.PruneChunks(context.TODO()), check.IsNil)
+	c.Check(storedChunks(c), check.HasLen, n2-n1)
+
+	r, err := backend.Open(backend.Filename(shw2))
+	c.Assert(err, check.IsNil)
+	defer r.Close()
+	c.Check(r.Check(context.TODO(), nil), check.IsNil)
+}
+
+func (s *snapshotSuite) TestPruneChunksKeepsRecent(c *check.C) {
+	s.mockSmallChunks()
+	writeChunkyData(c, 6)
+	shw := s.saveChunky(c, 1)
+	n := len(storedChunks(c))
+
+	c.Assert(os.Remove(backend.Filename(shw)), check.IsNil)
+	c.Check(backend.PruneChunks(context.TODO()), check.IsNil)
+	c.Check(storedChunks(c), check.HasLen, n)
+}
+
+func (s *snapshotSuite) TestPruneChunksSkipsBroken(c *check.C) {
+	s.mockSmallChunks()
+	s.restore = append(s.restore, backend.MockChunkPruneGracePeriod(0))
+
+	writeChunkyData(c, 8)
+	shw1 := s.saveChunky(c, 1)
+	n1 := len(storedChunks(c))
+	writeChunkyData(c, 9)
+	shw2 := s.saveChunky(c, 2)
+	n2 := len(storedChunks(c))
+	c.Assert(n2 > n1, check.Equals, true)
+
+	// break the first snapshot
+	fn := backend.Filename(shw1)
+	data, err := ioutil.ReadFile(fn)
+	c.Assert(err, check.IsNil)
+	data = withSnapshotMeta(c, data, func(sn *client.Snapshot) {
+		sn.SetID = 0
+	})
+	c.Assert(ioutil.WriteFile(fn, data, 0600), check.IsNil)
+	r, err := backend.Open(fn)
+	c.Assert(err, check.ErrorMatches, "invalid snapshot")
+	c.Assert(r.Broken, check.Not(check.Equals), "")
+
+	// pruning carries on, and keeps the chunks of the broken snapshot
+	c.Assert(os.Remove(backend.Filename(shw2)), check.IsNil)
+	c.Check(backend.PruneChunks(context.TODO()), check.IsNil)
+	c.Check(storedChunks(c), check.HasLen, n1)
+}
+
+func (s *snapshotSuite) TestChunkedExportImportRoundtrip(c *check.C) {
+	s.mockSmallChunks()
+	writeChunkyData(c, 7)
+	orig := s.saveChunky(c, 1)
+	n := len(storedChunks(c))
+
+	data := s.exportSet(c, 1)
+	entries := tarEntries(c, data)
+	// the snapshot, its chunks, and the manifest
+	c.Check(entries, check.HasLen, 1+n+1)
+
+	c.Assert(os.RemoveAll(dirs.SnapshotsDir), check.IsNil)
+
+	snapNames, err := backend.Import(context.TODO(), 5, bytes.NewReader(data))
+	c.Assert(err, check.IsNil)
+	c.Check(snapNames, check.DeepEquals, []string{"chunky-snap"})
+	c.Check(storedChunks(c), check.HasLen, n)
+
+	r, err := backend.Open(filepath.Join(dirs.SnapshotsDir, "5_chunky-snap_v1_7.zip"))
+	c.Assert(err, check.IsNil)
+	defer r.Close()
+	c.Check(r.Chunked, check.Equals, true)
+	c.Check(r.SHA3_384, check.DeepEquals, orig.SHA3_384)
+	c.Check(r.Check(context.TODO(), nil), check.IsNil)
+}
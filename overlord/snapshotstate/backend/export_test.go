@@ -22,6 +22,7 @@ package backend
 import (
 	"os"
 	"os/user"
+	"time"
 
 	"github.com/snapcore/snapd/osutil/sys"
 )
@@ -95,3 +96,19 @@ func SetUserWrapper(newUserWrapper string) (restore func()) {
 		userWrapper = oldUserWrapper
 	}
 }
+
+func MockChunkSizes(min, max int, mask uint64) (restore func()) {
+	oldMin, oldMax, oldMask := chunkMinSize, chunkMaxSize, chunkMask
+	chunkMinSize, chunkMaxSize, chunkMask = min, max, mask
+	return func() {
+		chunkMinSize, chunkMaxSize, chunkMask = oldMin, oldMax, oldMask
+	}
+}
+
+func MockChunkPruneGracePeriod(d time.Duration) (restore func()) {
+	old := chunkPruneGracePeriod
+	chunkPruneGracePeriod = d
+	return func() {
+		chunkPruneGracePeriod = old
+	}
+}
@@ -64,16 +64,28 @@ func zipMember(f *os.File, member string) (r io.ReadCloser, sz int64, err error)
 	return nil, -1, fmt.Errorf("missing archive member %q", member)
 }
 
-func userArchiveName(usr *user.User) string {
-	return filepath.Join(userArchivePrefix, usr.Username+userArchiveSuffix)
+func systemArchiveName(snapshot *client.Snapshot) string {
+	if snapshot.Chunked {
+		return chunkedArchiveName
+	}
+	return archiveName
+}
+
+func userArchiveName(snapshot *client.Snapshot, usr *user.User) string {
+	suffix := userArchiveSuffix
+	if snapshot.Chunked {
+		suffix = chunkedUserArchiveSuffix
+	}
+	return filepath.Join(userArchivePrefix, usr.Username+suffix)
 }
 
 func isUserArchive(entry string) bool {
-	return strings.HasPrefix(entry, userArchivePrefix) && strings.HasSuffix(entry, userArchiveSuffix)
+	return strings.HasPrefix(entry, userArchivePrefix) && (strings.HasSuffix(entry, userArchiveSuffix) || strings.HasSuffix(entry, chunkedUserArchiveSuffix))
 }
 
 func entryUsername(entry string) string {
 	// this _will_ panic if !isUserArchive(entry)
+	// (both suffixes are the same length)
 	return entry[len(userArchivePrefix) : len(entry)-len(userArchiveSuffix)]
 }
 
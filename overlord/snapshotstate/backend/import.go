@@ -0,0 +1,343 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+)
+
+// Import the snapshot set in the given export stream (as produced by
+// SnapshotExport's StreamTo) into a new snapshot set with the given
+// ID. The data is checked against the export manifest before anything
+// is made visible; on error nothing is left behind.
+//
+// It returns the names of the snaps in the imported set.
+func Import(ctx context.Context, id uint64, r io.Reader) (snapNames []string, err error) {
+	if err := os.MkdirAll(dirs.SnapshotsDir, 0700); err != nil {
+		return nil, err
+	}
+	// Iter skips hidden entries, so nothing in here is seen until
+	// it's moved into place
+	tempdir, err := ioutil.TempDir(dirs.SnapshotsDir, ".import-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempdir)
+
+	var manifest *exportManifest
+	found := make(map[string]exportedFile)
+	tr := tar.NewReader(r)
+	hasher := crypto.SHA3_384.New()
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, invalidImport("cannot read snapshot export: %v", err)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if hdr.Name == exportManifestName {
+			if manifest != nil {
+				return nil, invalidImport("cannot import snapshot: duplicate %q", exportManifestName)
+			}
+			manifest = &exportManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, invalidImport("cannot import snapshot: invalid %q: %v", exportManifestName, err)
+			}
+			continue
+		}
+
+		name := hdr.Name
+		if hdr.Typeflag != tar.TypeReg || !(isExportedSnapshot(name) || isExportedChunk(name)) {
+			return nil, invalidImport("cannot import snapshot: unexpected entry %q", name)
+		}
+		if _, ok := found[name]; ok {
+			return nil, invalidImport("cannot import snapshot: duplicate entry %q", name)
+		}
+
+		var sz sizer
+		if err := func() error {
+			f, err := os.OpenFile(filepath.Join(tempdir, filepath.Base(name)), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if _, err := io.Copy(io.MultiWriter(f, hasher, &sz), tr); err != nil {
+				return err
+			}
+			return f.Close()
+		}(); err != nil {
+			return nil, importEntryError(name, err)
+		}
+		found[name] = exportedFile{
+			Size:     sz.size,
+			SHA3_384: fmt.Sprintf("%x", hasher.Sum(nil)),
+		}
+		hasher.Reset()
+	}
+
+	if manifest == nil {
+		return nil, invalidImport("cannot import snapshot: missing %q", exportManifestName)
+	}
+	if manifest.Format != exportFormat {
+		return nil, invalidImport("cannot import snapshot: unsupported export format %d", manifest.Format)
+	}
+	if len(manifest.Files) == 0 {
+		return nil, invalidImport("cannot import snapshot: export is empty")
+	}
+	for name, expected := range manifest.Files {
+		actual, ok := found[name]
+		if !ok {
+			return nil, invalidImport("cannot import snapshot: missing entry %q", name)
+		}
+		if actual.Size != expected.Size {
+			return nil, invalidImport("cannot import snapshot: entry %q expected size (%d) does not match actual (%d)", name, expected.Size, actual.Size)
+		}
+		if actual.SHA3_384 != expected.SHA3_384 {
+			return nil, invalidImport("cannot import snapshot: entry %q expected hash (%.7s…) does not match actual (%.7s…)", name, expected.SHA3_384, actual.SHA3_384)
+		}
+	}
+	for name := range found {
+		if _, ok := manifest.Files[name]; !ok {
+			return nil, invalidImport("cannot import snapshot: unexpected entry %q", name)
+		}
+	}
+
+	// chunks go in first, so the snapshots using them are complete
+	// as soon as they are visible; chunks that end up unused because
+	// of a failure further down get pruned eventually
+	for name := range found {
+		if !isExportedChunk(name) {
+			continue
+		}
+		if err := importChunk(filepath.Join(tempdir, filepath.Base(name))); err != nil {
+			return nil, importEntryError(name, err)
+		}
+	}
+
+	var imported []string
+	defer func() {
+		if err != nil {
+			for _, fn := range imported {
+				os.Remove(fn)
+			}
+		}
+	}()
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		if isExportedSnapshot(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		fn, snapName, err := importOne(id, filepath.Join(tempdir, name))
+		if err != nil {
+			return nil, importEntryError(name, err)
+		}
+		imported = append(imported, fn)
+		snapNames = append(snapNames, snapName)
+	}
+	sort.Strings(snapNames)
+
+	return snapNames, nil
+}
+
+// InvalidImportError is returned by Import when the data being imported is
+// not a valid snapshot export, as opposed to a failure to import it.
+type InvalidImportError struct {
+	Message string
+}
+
+func (e *InvalidImportError) Error() string {
+	return e.Message
+}
+
+func invalidImport(format string, v ...interface{}) error {
+	return &InvalidImportError{Message: fmt.Sprintf(format, v...)}
+}
+
+func importEntryError(name string, err error) error {
+	if _, ok := err.(*InvalidImportError); ok {
+		return invalidImport("cannot import snapshot entry %q: %v", name, err)
+	}
+	return fmt.Errorf("cannot import snapshot entry %q: %v", name, err)
+}
+
+func isExportedSnapshot(name string) bool {
+	return filepath.Base(name) == name && !strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".zip")
+}
+
+func isExportedChunk(name string) bool {
+	if !strings.HasPrefix(name, exportChunkPrefix) {
+		return false
+	}
+	sum := name[len(exportChunkPrefix):]
+	if len(sum) != 2*crypto.SHA3_384.Size() {
+		return false
+	}
+	for _, c := range sum {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// importChunk moves the given chunk into the chunk store, after
+// checking that its content matches its name (as the store is shared
+// with other snapshots, a bad chunk would corrupt those as well).
+func importChunk(fn string) error {
+	sum := filepath.Base(fn)
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return invalidImport("%v", err)
+	}
+	hasher := crypto.SHA3_384.New()
+	if _, err := io.Copy(hasher, gz); err != nil {
+		return invalidImport("%v", err)
+	}
+	if actualHash := fmt.Sprintf("%x", hasher.Sum(nil)); actualHash != sum {
+		return invalidImport("chunk does not match its hash (%.7s…)", actualHash)
+	}
+
+	target := chunkPath(sum)
+	if osutil.FileExists(target) {
+		now := time.Now()
+		return os.Chtimes(target, now, now)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+	return os.Rename(fn, target)
+}
+
+// importOne copies the snapshot in the given file into the snapshots
+// directory, under the given set ID.
+func importOne(id uint64, fn string) (filename string, snapName string, err error) {
+	r, err := backendOpen(fn)
+	if err != nil {
+		return "", "", invalidImport("%v", err)
+	}
+	defer r.Close()
+
+	snapshot := r.Snapshot
+	snapshot.SetID = id
+	// the metadata comes from the archive, and ends up in the name
+	// of the imported snapshot
+	if err := snap.ValidateInstanceName(snapshot.Snap); err != nil {
+		return "", "", invalidImport("%v", err)
+	}
+	if err := snap.ValidateVersion(snapshot.Version); err != nil {
+		return "", "", invalidImport("%v", err)
+	}
+	filename = Filename(&snapshot)
+	if filepath.Dir(filename) != dirs.SnapshotsDir {
+		return "", "", invalidImport("invalid snapshot file name %q", filepath.Base(filename))
+	}
+	if osutil.FileExists(filename) {
+		return "", "", fmt.Errorf("%q already exists", filename)
+	}
+
+	fi, err := r.Stat()
+	if err != nil {
+		return "", "", err
+	}
+	arch, err := zip.NewReader(r.File, fi.Size())
+	if err != nil {
+		return "", "", invalidImport("%v", err)
+	}
+
+	aw, err := osutil.NewAtomicFile(filename, 0600, 0, osutil.NoChown, osutil.NoChown)
+	if err != nil {
+		return "", "", err
+	}
+	defer aw.Cancel()
+
+	w := zip.NewWriter(aw)
+	defer w.Close()
+	for _, member := range arch.File {
+		if member.Name == metadataName || member.Name == metaHashName {
+			continue
+		}
+		if _, ok := snapshot.SHA3_384[member.Name]; !ok {
+			return "", "", invalidImport("unexpected archive member %q", member.Name)
+		}
+		if err := copyZipMember(w, member); err != nil {
+			return "", "", err
+		}
+	}
+	if err := addMetaToZip(&snapshot, w); err != nil {
+		return "", "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", "", err
+	}
+	if err := aw.Commit(); err != nil {
+		return "", "", err
+	}
+
+	return filename, snapshot.Snap, nil
+}
+
+func copyZipMember(w *zip.Writer, member *zip.File) error {
+	body, err := member.Open()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	dst, err := w.CreateHeader(&zip.FileHeader{Name: member.Name, Method: member.Method})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, body)
+	return err
+}
@@ -0,0 +1,304 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+	"github.com/snapcore/snapd/snap"
+)
+
+func (s *snapshotSuite) saveForExport(c *check.C, setID uint64, name string) *client.Snapshot {
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: name, Revision: snap.R(42), SnapID: name + "-id"}, Version: "v1.33"}
+	c.Assert(os.MkdirAll(info.DataDir(), 0755), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(info.DataDir(), "canary"), []byte(name+" canary\n"), 0644), check.IsNil)
+
+	shw, err := backend.Save(context.TODO(), setID, info, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	return shw
+}
+
+func (s *snapshotSuite) exportSet(c *check.C, setID uint64) []byte {
+	se, err := backend.NewSnapshotExport(context.TODO(), setID)
+	c.Assert(err, check.IsNil)
+	defer se.Close()
+
+	var buf bytes.Buffer
+	c.Assert(se.StreamTo(&buf), check.IsNil)
+	c.Check(int64(buf.Len()), check.Equals, se.Size())
+
+	return buf.Bytes()
+}
+
+func tarEntries(c *check.C, data []byte) map[string][]byte {
+	entries := make(map[string][]byte)
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, check.IsNil)
+		content, err := ioutil.ReadAll(tr)
+		c.Assert(err, check.IsNil)
+		entries[hdr.Name] = content
+	}
+	return entries
+}
+
+func (s *snapshotSuite) TestExport(c *check.C) {
+	s.saveForExport(c, 1, "hello-snap")
+	s.saveForExport(c, 1, "other-snap")
+	s.saveForExport(c, 2, "hello-snap")
+
+	entries := tarEntries(c, s.exportSet(c, 1))
+	c.Assert(entries, check.HasLen, 3)
+
+	for _, name := range []string{"1_hello-snap_v1.33_42.zip", "1_other-snap_v1.33_42.zip"} {
+		onDisk, err := ioutil.ReadFile(filepath.Join(dirs.SnapshotsDir, name))
+		c.Assert(err, check.IsNil)
+		c.Check(entries[name], check.DeepEquals, onDisk)
+	}
+
+	var manifest map[string]interface{}
+	c.Assert(json.Unmarshal(entries["export.json"], &manifest), check.IsNil)
+	c.Check(manifest["format"], check.Equals, 1.0)
+	c.Check(manifest["set-id"], check.Equals, 1.0)
+	files := manifest["files"].(map[string]interface{})
+	c.Check(files, check.HasLen, 2)
+	hello := files["1_hello-snap_v1.33_42.zip"].(map[string]interface{})
+	c.Check(hello["size"], check.Equals, float64(len(entries["1_hello-snap_v1.33_42.zip"])))
+	c.Check(hello["sha3-384"], check.Matches, "[0-9a-f]{96}")
+}
+
+func (s *snapshotSuite) TestExportNotFound(c *check.C) {
+	s.saveForExport(c, 1, "hello-snap")
+
+	_, err := backend.NewSnapshotExport(context.TODO(), 2)
+	c.Check(err, check.Equals, client.ErrSnapshotSetNotFound)
+}
+
+func (s *snapshotSuite) TestExportImportRoundtrip(c *check.C) {
+	orig := s.saveForExport(c, 1, "hello-snap")
+	s.saveForExport(c, 1, "other-snap")
+
+	data := s.exportSet(c, 1)
+
+	snapNames, err := backend.Import(context.TODO(), 5, bytes.NewReader(data))
+	c.Assert(err, check.IsNil)
+	c.Check(snapNames, check.DeepEquals, []string{"hello-snap", "other-snap"})
+
+	sets, err := backend.List(context.TODO(), 5, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(sets, check.HasLen, 1)
+	c.Assert(sets[0].Snapshots, check.HasLen, 2)
+
+	imported := sets[0].Snapshots[0]
+	c.Check(imported.SetID, check.Equals, uint64(5))
+	c.Check(imported.Snap, check.Equals, "hello-snap")
+	c.Check(imported.SHA3_384, check.DeepEquals, orig.SHA3_384)
+	c.Check(imported.Broken, check.Equals, "")
+
+	r, err := backend.Open(filepath.Join(dirs.SnapshotsDir, "5_hello-snap_v1.33_42.zip"))
+	c.Assert(err, check.IsNil)
+	defer r.Close()
+	c.Check(r.Check(context.TODO(), nil), check.IsNil)
+
+	// nothing is left behind
+	leftovers, err := filepath.Glob(filepath.Join(dirs.SnapshotsDir, ".*"))
+	c.Assert(err, check.IsNil)
+	c.Check(leftovers, check.HasLen, 0)
+}
+
+func (s *snapshotSuite) TestImportErrors(c *check.C) {
+	s.saveForExport(c, 1, "hello-snap")
+	data := s.exportSet(c, 1)
+	entries := tarEntries(c, data)
+
+	mkTar := func(entries map[string][]byte, order ...string) []byte {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, name := range order {
+			content := entries[name]
+			c.Assert(tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg}), check.IsNil)
+			_, err := tw.Write(content)
+			c.Assert(err, check.IsNil)
+		}
+		c.Assert(tw.Close(), check.IsNil)
+		return buf.Bytes()
+	}
+	zipName := "1_hello-snap_v1.33_42.zip"
+
+	corrupted := make([]byte, len(entries[zipName]))
+	copy(corrupted, entries[zipName])
+	corrupted[0] ^= 0xff
+
+	for _, t := range []struct {
+		data   []byte
+		errMsg string
+	}{
+		{[]byte("garbage"), `cannot read snapshot export: .*`},
+		{mkTar(entries, zipName), `cannot import snapshot: missing "export.json"`},
+		{mkTar(map[string][]byte{"export.json": []byte(`{"format": 2}`)}, "export.json"), `cannot import snapshot: unsupported export format 2`},
+		{mkTar(map[string][]byte{"export.json": []byte(`{"format": 1}`)}, "export.json"), `cannot import snapshot: export is empty`},
+		{mkTar(map[string][]byte{"export.json": []byte(`}`)}, "export.json"), `cannot import snapshot: invalid "export.json": .*`},
+		{mkTar(entries, "export.json"), `cannot import snapshot: missing entry "1_hello-snap_v1.33_42.zip"`},
+		{mkTar(map[string][]byte{zipName: corrupted, "export.json": entries["export.json"]}, zipName, "export.json"),
+			`cannot import snapshot: entry "1_hello-snap_v1.33_42.zip" expected hash \(.*\) does not match actual \(.*\)`},
+		{mkTar(map[string][]byte{zipName: entries[zipName][1:], "export.json": entries["export.json"]}, zipName, "export.json"),
+			`cannot import snapshot: entry "1_hello-snap_v1.33_42.zip" expected size \(\d+\) does not match actual \(\d+\)`},
+		{mkTar(map[string][]byte{"../foo.zip": nil}, "../foo.zip"), `cannot import snapshot: unexpected entry "../foo.zip"`},
+		{mkTar(map[string][]byte{"foo": nil}, "foo"), `cannot import snapshot: unexpected entry "foo"`},
+		{mkTar(map[string][]byte{"2_foo.zip": nil, zipName: entries[zipName], "export.json": entries["export.json"]}, "2_foo.zip", zipName, "export.json"),
+			`cannot import snapshot: unexpected entry "2_foo.zip"`},
+	} {
+		_, err := backend.Import(context.TODO(), 5, bytes.NewReader(t.data))
+		c.Check(err, check.ErrorMatches, t.errMsg)
+
+		sets, err := backend.List(context.TODO(), 5, nil)
+		c.Assert(err, check.IsNil)
+		c.Check(sets, check.HasLen, 0)
+		leftovers, err := filepath.Glob(filepath.Join(dirs.SnapshotsDir, ".*"))
+		c.Assert(err, check.IsNil)
+		c.Check(leftovers, check.HasLen, 0)
+	}
+}
+
+// withSnapshotMeta returns a copy of the snapshot zip with its metadata
+// altered by the given function.
+func withSnapshotMeta(c *check.C, data []byte, mutate func(sn *client.Snapshot)) []byte {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	c.Assert(err, check.IsNil)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	var sn client.Snapshot
+	for _, member := range zr.File {
+		r, err := member.Open()
+		c.Assert(err, check.IsNil)
+		content, err := ioutil.ReadAll(r)
+		c.Assert(err, check.IsNil)
+		r.Close()
+		switch member.Name {
+		case "meta.json":
+			c.Assert(json.Unmarshal(content, &sn), check.IsNil)
+			continue
+		case "meta.sha3_384":
+			continue
+		}
+		w, err := zw.CreateHeader(&member.FileHeader)
+		c.Assert(err, check.IsNil)
+		_, err = w.Write(content)
+		c.Assert(err, check.IsNil)
+	}
+	mutate(&sn)
+	meta, err := json.Marshal(&sn)
+	c.Assert(err, check.IsNil)
+	w, err := zw.Create("meta.json")
+	c.Assert(err, check.IsNil)
+	_, err = w.Write(meta)
+	c.Assert(err, check.IsNil)
+	w, err = zw.Create("meta.sha3_384")
+	c.Assert(err, check.IsNil)
+	h := crypto.SHA3_384.New()
+	h.Write(meta)
+	fmt.Fprintf(w, "%x\n", h.Sum(nil))
+	c.Assert(zw.Close(), check.IsNil)
+	return buf.Bytes()
+}
+
+func (s *snapshotSuite) TestImportRejectsBadMetadata(c *check.C) {
+	s.saveForExport(c, 1, "hello-snap")
+	zipName := "1_hello-snap_v1.33_42.zip"
+	entries := tarEntries(c, s.exportSet(c, 1))
+
+	for _, t := range []struct {
+		mutate func(sn *client.Snapshot)
+		errMsg string
+	}{
+		{func(sn *client.Snapshot) { sn.Version = "../../../../etc/cron.d/x" }, `.*invalid snap version.*`},
+		{func(sn *client.Snapshot) { sn.Snap = "../other-snap" }, `.*invalid snap name.*`},
+		{func(sn *client.Snapshot) { sn.Snap = "hello-snap/../other" }, `.*invalid snap name.*`},
+	} {
+		data := withSnapshotMeta(c, entries[zipName], t.mutate)
+		h := crypto.SHA3_384.New()
+		h.Write(data)
+		manifest, err := json.Marshal(map[string]interface{}{
+			"format": 1,
+			"set-id": 1,
+			"files": map[string]interface{}{
+				zipName: map[string]interface{}{"size": len(data), "sha3-384": fmt.Sprintf("%x", h.Sum(nil))},
+			},
+		})
+		c.Assert(err, check.IsNil)
+
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, e := range []struct {
+			name    string
+			content []byte
+		}{{zipName, data}, {"export.json", manifest}} {
+			c.Assert(tw.WriteHeader(&tar.Header{Name: e.name, Mode: 0600, Size: int64(len(e.content)), Typeflag: tar.TypeReg}), check.IsNil)
+			_, err := tw.Write(e.content)
+			c.Assert(err, check.IsNil)
+		}
+		c.Assert(tw.Close(), check.IsNil)
+
+		_, err = backend.Import(context.TODO(), 5, &buf)
+		c.Check(err, check.ErrorMatches, `cannot import snapshot entry "1_hello-snap_v1.33_42.zip": `+t.errMsg)
+		c.Check(err, check.FitsTypeOf, &backend.InvalidImportError{})
+
+		// nothing was written anywhere
+		outside, err := filepath.Glob(filepath.Join(dirs.GlobalRootDir, "etc/cron.d/*"))
+		c.Assert(err, check.IsNil)
+		c.Check(outside, check.HasLen, 0)
+		sets, err := backend.List(context.TODO(), 5, nil)
+		c.Assert(err, check.IsNil)
+		c.Check(sets, check.HasLen, 0)
+	}
+}
+
+func (s *snapshotSuite) TestIterSkipsHidden(c *check.C) {
+	s.saveForExport(c, 1, "hello-snap")
+	c.Assert(os.MkdirAll(filepath.Join(dirs.SnapshotsDir, ".import-1234"), 0700), check.IsNil)
+
+	var seen []string
+	err := backend.Iter(context.TODO(), func(r *backend.Reader) error {
+		seen = append(seen, filepath.Base(r.Name()))
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(seen, check.DeepEquals, []string{"1_hello-snap_v1.33_42.zip"})
+}
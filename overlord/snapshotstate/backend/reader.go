@@ -122,8 +122,39 @@ func Open(fn string) (reader *Reader, e error) {
 	return reader, nil
 }
 
+// chunkIndex returns the list of chunks that make up the given entry
+// of a chunked snapshot.
+func (r *Reader) chunkIndex(entry string) ([]chunkRef, error) {
+	body, _, err := zipMember(r.File, entry)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return readChunkIndex(body)
+}
+
+// entryReader returns a reader for the archive data of the given
+// entry, together with its expected size. For chunked snapshots the
+// data is put back together from the chunk store.
+func (r *Reader) entryReader(entry string) (body io.ReadCloser, size int64, err error) {
+	if !r.Chunked {
+		return zipMember(r.File, entry)
+	}
+
+	refs, err := r.chunkIndex(entry)
+	if err != nil {
+		return nil, -1, err
+	}
+	for _, ref := range refs {
+		size += ref.Size
+	}
+
+	return newChunkReader(refs), size, nil
+}
+
 func (r *Reader) checkOne(ctx context.Context, entry string, hasher hash.Hash) error {
-	body, reportedSize, err := zipMember(r.File, entry)
+	body, reportedSize, err := r.entryReader(entry)
 	if err != nil {
 		return err
 	}
@@ -209,7 +240,7 @@ func (r *Reader) Restore(ctx context.Context, current snap.Revision, usernames [
 		gid := sys.GroupID(osutil.NoChown)
 
 		if !isUser {
-			if entry != archiveName {
+			if entry != archiveName && entry != chunkedArchiveName {
 				// hmmm
 				logf("Skipping restore of unknown entry %q.", entry)
 				continue
@@ -290,10 +321,11 @@ func (r *Reader) Restore(ctx context.Context, current snap.Revision, usernames [
 
 		logger.Debugf("Restoring %q from %q into %q.", entry, r.Name(), tempdir)
 
-		body, expectedSize, err := zipMember(r.File, entry)
+		body, expectedSize, err := r.entryReader(entry)
 		if err != nil {
 			return rs, err
 		}
+		defer body.Close()
 
 		expectedHash := r.SHA3_384[entry]
 
@@ -302,10 +334,15 @@ func (r *Reader) Restore(ctx context.Context, current snap.Revision, usernames [
 		// resist the temptation of using archive/tar unless it's proven
 		// that calling out to tar has issues -- there are a lot of
 		// special cases we'd need to consider otherwise
-		cmd := tarAsUser(username,
+		tarArgs := []string{
 			"--extract",
-			"--preserve-permissions", "--preserve-order", "--gunzip",
-			"--directory", tempdir)
+			"--preserve-permissions", "--preserve-order",
+			"--directory", tempdir,
+		}
+		if !r.Chunked {
+			tarArgs = append(tarArgs, "--gunzip")
+		}
+		cmd := tarAsUser(username, tarArgs...)
 		cmd.Env = []string{}
 		cmd.Stdin = tr
 		matchCounter := &strutil.MatchCounter{N: 1}
@@ -19,6 +19,11 @@
 
 package backend
 
+import (
+	"os"
+	"syscall"
+)
+
 type sizer struct {
 	size int64
 }
@@ -32,3 +37,14 @@ func (sz *sizer) Write(data []byte) (n int, err error) {
 func (sz *sizer) Reset() {
 	sz.size = 0
 }
+
+// diskSizeOf returns how much disk space the given file actually
+// takes, which for compressed or sparse files can be quite different
+// from its apparent size.
+func diskSizeOf(fi os.FileInfo) int64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		// st_blocks is always in 512-byte units
+		return st.Blocks * 512
+	}
+	return fi.Size()
+}
@@ -0,0 +1,308 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapshotstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/timeutil"
+)
+
+var (
+	// scheduled snapshots are taken at least this often, whatever
+	// the schedule says
+	maxScheduledSnapshotDelay = 60 * 24 * time.Hour
+
+	// how many scheduled snapshot sets are kept, if not set by the user
+	defaultScheduledSnapshotsRetain = 3
+)
+
+// ensureScheduledSnapshot takes a snapshot of the snaps in
+// snapshots.snaps (or all of them) as per snapshots.schedule, and
+// forgets the scheduled snapshots that go beyond snapshots.retain.
+func (mgr *SnapshotManager) ensureScheduledSnapshot() error {
+	st := mgr.state
+	st.Lock()
+	defer st.Unlock()
+
+	tr := config.NewTransaction(st)
+	var scheduleStr string
+	if err := tr.Get("core", "snapshots.schedule", &scheduleStr); err != nil && !config.IsNoOption(err) {
+		return err
+	}
+
+	if scheduledSnapshotInFlight(st) {
+		return nil
+	}
+	if err := mgr.processScheduledSnapshots(); err != nil {
+		return err
+	}
+
+	if scheduleStr == "" {
+		mgr.nextScheduledSnapshot = time.Time{}
+		return nil
+	}
+	if scheduleStr != mgr.lastSnapshotSchedule {
+		// the schedule has changed (or we just started)
+		mgr.nextScheduledSnapshot = time.Time{}
+		mgr.lastSnapshotSchedule = scheduleStr
+	}
+	schedule, err := timeutil.ParseSchedule(scheduleStr)
+	if err != nil {
+		// validated when set, so this should not happen
+		return fmt.Errorf("cannot parse snapshots.schedule: %v", err)
+	}
+
+	now := time.Now()
+	if mgr.nextScheduledSnapshot.IsZero() {
+		var last time.Time
+		if err := st.Get("last-scheduled-snapshot", &last); err != nil && err != state.ErrNoState {
+			return err
+		}
+		if last.IsZero() {
+			// don't take one right away when the schedule is
+			// first set; wait for the first scheduled time
+			last = now
+			st.Set("last-scheduled-snapshot", last)
+		}
+		mgr.nextScheduledSnapshot = now.Add(timeutil.Next(schedule, last, maxScheduledSnapshotDelay))
+		logger.Debugf("Next scheduled snapshot at %s.", mgr.nextScheduledSnapshot.Format(time.RFC3339))
+	}
+	if mgr.nextScheduledSnapshot.After(now) {
+		return nil
+	}
+
+	// whatever happens, the next attempt is at the next scheduled time
+	mgr.nextScheduledSnapshot = time.Time{}
+	st.Set("last-scheduled-snapshot", now)
+
+	if err := launchScheduledSnapshot(st); err != nil {
+		st.Warnf("cannot take scheduled snapshot: %v", err)
+	}
+
+	return nil
+}
+
+func scheduledSnapshotInFlight(st *state.State) bool {
+	for _, chg := range st.Changes() {
+		if chg.Kind() == "scheduled-snapshot" && !chg.Status().Ready() {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduledSnapNames returns the snaps to take scheduled snapshots of,
+// or nil for all of them.
+func scheduledSnapNames(st *state.State) ([]string, error) {
+	tr := config.NewTransaction(st)
+	var snapsStr string
+	if err := tr.Get("core", "snapshots.snaps", &snapsStr); err != nil && !config.IsNoOption(err) {
+		return nil, err
+	}
+	if snapsStr == "" {
+		return nil, nil
+	}
+
+	active, err := allActiveSnapNames(st)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range strings.Split(snapsStr, ",") {
+		name = strings.TrimSpace(name)
+		if !strutil.SortedListContains(active, name) {
+			logger.Noticef("Not including %q in scheduled snapshot: snap is not installed or not active.", name)
+			continue
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("none of the snaps in snapshots.snaps (%s) is installed", snapsStr)
+	}
+
+	return names, nil
+}
+
+func launchScheduledSnapshot(st *state.State) error {
+	names, err := scheduledSnapNames(st)
+	if err != nil {
+		return err
+	}
+	setID, saved, ts, err := Save(st, names, nil)
+	if err != nil {
+		return err
+	}
+	if err := saveScheduled(st, setID); err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("Save scheduled snapshot #%d of %s", setID, strutil.Quoted(saved))
+	chg := st.NewChange("scheduled-snapshot", msg)
+	chg.AddAll(ts)
+	chg.Set("snapshot-set-id", setID)
+	st.EnsureBefore(0)
+
+	return nil
+}
+
+// processScheduledSnapshots warns about the scheduled snapshots that
+// failed and drops what is left of them, and forgets the scheduled
+// snapshot sets beyond the ones to be retained. The state needs to be
+// locked by the caller.
+func (mgr *SnapshotManager) processScheduledSnapshots() error {
+	st := mgr.state
+	failed := make(map[uint64]bool)
+	for _, chg := range st.Changes() {
+		if chg.Kind() != "scheduled-snapshot" || !chg.Status().Ready() {
+			continue
+		}
+		var processed bool
+		if err := chg.Get("processed", &processed); err != nil && err != state.ErrNoState {
+			return err
+		}
+		if processed {
+			continue
+		}
+		chg.Set("processed", true)
+		if err := chg.Err(); err != nil {
+			st.Warnf("cannot take scheduled snapshot: %v", err)
+			var setID uint64
+			if err := chg.Get("snapshot-set-id", &setID); err == nil {
+				failed[setID] = true
+			}
+		}
+	}
+
+	// a failed set must not count towards snapshots.retain, or it
+	// would push out the good ones
+	if len(failed) > 0 {
+		setIDs := make([]uint64, 0, len(failed))
+		for setID := range failed {
+			setIDs = append(setIDs, setID)
+		}
+		// whatever the undo left behind goes as well
+		if err := mgr.forgetSnapshotSets(failed); err != nil {
+			return fmt.Errorf("cannot forget failed scheduled snapshots: %v", err)
+		}
+		if err := removeSnapshotState(st, setIDs...); err != nil {
+			return err
+		}
+	}
+
+	retain, err := scheduledSnapshotsRetain(st)
+	if err != nil {
+		return err
+	}
+	setIDs, err := scheduledSnapshotSets(st)
+	if err != nil {
+		return err
+	}
+	if len(setIDs) <= retain {
+		return nil
+	}
+
+	sets := make(map[uint64]bool, len(setIDs)-retain)
+	for _, setID := range setIDs[:len(setIDs)-retain] {
+		sets[setID] = true
+	}
+	if err := mgr.forgetSnapshotSets(sets); err != nil {
+		return fmt.Errorf("cannot forget old scheduled snapshots: %v", err)
+	}
+
+	return nil
+}
+
+func scheduledSnapshotsRetain(st *state.State) (int, error) {
+	var retainValue interface{}
+	tr := config.NewTransaction(st)
+	err := tr.Get("core", "snapshots.retain", &retainValue)
+	if err != nil && !config.IsNoOption(err) {
+		return 0, err
+	}
+	if retainValue == nil {
+		return defaultScheduledSnapshotsRetain, nil
+	}
+	// configcore accepts both the number and its string form
+	retain, err := strconv.Atoi(fmt.Sprintf("%v", retainValue))
+	if err != nil || retain < 1 {
+		// validated when set, so this should not happen
+		return defaultScheduledSnapshotsRetain, nil
+	}
+	return retain, nil
+}
+
+// saveScheduled marks the given snapshot set as a scheduled one, in the
+// state. The state needs to be locked by the caller.
+func saveScheduled(st *state.State, setID uint64) error {
+	var snapshots map[uint64]*json.RawMessage
+	err := st.Get("snapshots", &snapshots)
+	if err != nil && err != state.ErrNoState {
+		return err
+	}
+	if snapshots == nil {
+		snapshots = make(map[uint64]*json.RawMessage)
+	}
+	data, err := json.Marshal(&snapshotState{
+		Scheduled: true,
+	})
+	if err != nil {
+		return err
+	}
+	raw := json.RawMessage(data)
+	snapshots[setID] = &raw
+	st.Set("snapshots", snapshots)
+	return nil
+}
+
+// scheduledSnapshotSets returns the IDs of the scheduled snapshot sets
+// in the state, oldest first. Failed scheduled snapshots are dropped
+// from the state by processScheduledSnapshots, so these are the ones
+// that were taken successfully. The state needs to be locked by the
+// caller.
+func scheduledSnapshotSets(st *state.State) ([]uint64, error) {
+	var snapshots map[uint64]*snapshotState
+	err := st.Get("snapshots", &snapshots)
+	if err != nil {
+		if err != state.ErrNoState {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	var setIDs []uint64
+	for setID, snapshotSet := range snapshots {
+		if snapshotSet.Scheduled {
+			setIDs = append(setIDs, setID)
+		}
+	}
+	sort.Slice(setIDs, func(i, j int) bool { return setIDs[i] < setIDs[j] })
+
+	return setIDs, nil
+}
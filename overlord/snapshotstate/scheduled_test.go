@@ -0,0 +1,335 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapshotstate_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/snapshotstate"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+type scheduledSuite struct {
+	st      *state.State
+	mgr     *snapshotstate.SnapshotManager
+	restore []func()
+}
+
+var _ = check.Suite(&scheduledSuite{})
+
+func (s *scheduledSuite) SetUpTest(c *check.C) {
+	dirs.SetRootDir(c.MkDir())
+
+	s.st = state.New(nil)
+	s.mgr = snapshotstate.Manager(s.st, state.NewTaskRunner(s.st))
+
+	s.restore = []func(){
+		snapshotstate.MockSnapstateAll(func(*state.State) (map[string]*snapstate.SnapState, error) {
+			return map[string]*snapstate.SnapState{
+				"a-snap": {Active: true},
+				"b-snap": {},
+				"c-snap": {Active: true},
+			}, nil
+		}),
+		snapshotstate.MockSnapstateCheckChangeConflictMany(func(*state.State, []string, string) error {
+			return nil
+		}),
+		snapshotstate.MockBackendPruneChunks(func(context.Context) error {
+			return nil
+		}),
+	}
+}
+
+func (s *scheduledSuite) TearDownTest(c *check.C) {
+	for _, f := range s.restore {
+		f()
+	}
+	dirs.SetRootDir("/")
+}
+
+func (s *scheduledSuite) setConfig(c *check.C, conf map[string]interface{}) {
+	s.st.Lock()
+	defer s.st.Unlock()
+	tr := config.NewTransaction(s.st)
+	for k, v := range conf {
+		c.Assert(tr.Set("core", k, v), check.IsNil)
+	}
+	tr.Commit()
+}
+
+func (s *scheduledSuite) scheduledChanges() []*state.Change {
+	s.st.Lock()
+	defer s.st.Unlock()
+	var chgs []*state.Change
+	for _, chg := range s.st.Changes() {
+		if chg.Kind() == "scheduled-snapshot" {
+			chgs = append(chgs, chg)
+		}
+	}
+	return chgs
+}
+
+func (s *scheduledSuite) pretendLastScheduledSnapshotWasLongAgo() {
+	s.st.Lock()
+	defer s.st.Unlock()
+	s.st.Set("last-scheduled-snapshot", time.Now().Add(-90*24*time.Hour))
+}
+
+func (s *scheduledSuite) TestNoSchedule(c *check.C) {
+	s.pretendLastScheduledSnapshotWasLongAgo()
+
+	c.Assert(s.mgr.Ensure(), check.IsNil)
+	c.Check(s.scheduledChanges(), check.HasLen, 0)
+}
+
+func (s *scheduledSuite) TestFirstScheduleWaits(c *check.C) {
+	s.setConfig(c, map[string]interface{}{"snapshots.schedule": "00:00-24:00"})
+
+	c.Assert(s.mgr.Ensure(), check.IsNil)
+	c.Check(s.scheduledChanges(), check.HasLen, 0)
+
+	s.st.Lock()
+	defer s.st.Unlock()
+	var last time.Time
+	c.Assert(s.st.Get("last-scheduled-snapshot", &last), check.IsNil)
+	c.Check(time.Since(last) < time.Minute, check.Equals, true)
+}
+
+func (s *scheduledSuite) TestScheduledSnapshot(c *check.C) {
+	s.setConfig(c, map[string]interface{}{"snapshots.schedule": "00:00-24:00"})
+	s.pretendLastScheduledSnapshotWasLongAgo()
+
+	c.Assert(s.mgr.Ensure(), check.IsNil)
+	chgs := s.scheduledChanges()
+	c.Assert(chgs, check.HasLen, 1)
+
+	s.st.Lock()
+	chg := chgs[0]
+	c.Check(chg.Summary(), check.Equals, `Save scheduled snapshot #1 of "a-snap", "c-snap"`)
+	var snaps []string
+	for _, t := range chg.Tasks() {
+		c.Check(t.Kind(), check.Equals, "save-snapshot")
+		var setup map[string]interface{}
+		c.Assert(t.Get("snapshot-setup", &setup), check.IsNil)
+		snaps = append(snaps, setup["snap"].(string))
+	}
+	sort.Strings(snaps)
+	c.Check(snaps, check.DeepEquals, []string{"a-snap", "c-snap"})
+
+	var snapshots map[string]map[string]interface{}
+	c.Assert(s.st.Get("snapshots", &snapshots), check.IsNil)
+	c.Check(snapshots["1"]["scheduled"], check.Equals, true)
+	s.st.Unlock()
+
+	// nothing new before the next scheduled time
+	s.st.Lock()
+	chg.SetStatus(state.DoneStatus)
+	s.st.Unlock()
+	c.Assert(s.mgr.Ensure(), check.IsNil)
+	c.Check(s.scheduledChanges(), check.HasLen, 1)
+}
+
+func (s *scheduledSuite) TestScheduledSnapshotInFlight(c *check.C) {
+	s.setConfig(c, map[string]interface{}{"snapshots.schedule": "00:00-24:00"})
+	s.pretendLastScheduledSnapshotWasLongAgo()
+
+	c.Assert(s.mgr.Ensure(), check.IsNil)
+	chgs := s.scheduledChanges()
+	c.Assert(chgs, check.HasLen, 1)
+
+	// nothing new while one is in flight
+	s.pretendLastScheduledSnapshotWasLongAgo()
+	c.Assert(s.mgr.Ensure(), check.IsNil)
+	c.Check(s.scheduledChanges(), check.HasLen, 1)
+
+	s.st.Lock()
+	chgs[0].SetStatus(state.DoneStatus)
+	s.st.Unlock()
+	c.Assert(s.mgr.Ensure(), check.IsNil)
+	c.Check(s.scheduledChanges(), check.HasLen, 2)
+}
+
+func (s *scheduledSuite) TestScheduledSnapshotSelectedSnaps(c *check.C) {
+	s.setConfig(c, map[string]interface{}{
+		"snapshots.schedule": "00:00-24:00",
+		"snapshots.snaps":    "c-snap,gone-snap",
+	})
+	s.pretendLastScheduledSnapshotWasLongAgo()
+
+	c.Assert(s.mgr.Ensure(), check.IsNil)
+	chgs := s.scheduledChanges()
+	c.Assert(chgs, check.HasLen, 1)
+	s.st.Lock()
+	defer s.st.Unlock()
+	c.Check(chgs[0].Summary(), check.Equals, `Save scheduled snapshot #1 of "c-snap"`)
+}
+
+func (s *scheduledSuite) TestScheduledSnapshotCannotStartWarns(c *check.C) {
+	s.setConfig(c, map[string]interface{}{
+		"snapshots.schedule": "00:00-24:00",
+		"snapshots.snaps":    "b-snap",
+	})
+	s.pretendLastScheduledSnapshotWasLongAgo()
+
+	c.Assert(s.mgr.Ensure(), check.IsNil)
+	c.Check(s.scheduledChanges(), check.HasLen, 0)
+
+	s.st.Lock()
+	defer s.st.Unlock()
+	warnings := s.st.AllWarnings()
+	c.Assert(warnings, check.HasLen, 1)
+	c.Check(warnings[0].String(), check.Equals, `cannot take scheduled snapshot: none of the snaps in snapshots.snaps (b-snap) is installed`)
+}
+
+func (s *scheduledSuite) TestScheduledSnapshotFailureWarns(c *check.C) {
+	s.st.Lock()
+	chg := s.st.NewChange("scheduled-snapshot", "...")
+	t := s.st.NewTask("save-snapshot", "...")
+	t.Errorf("boom")
+	t.SetStatus(state.ErrorStatus)
+	chg.AddTask(t)
+	s.st.Unlock()
+
+	c.Assert(s.mgr.Ensure(), check.IsNil)
+	// and only once
+	c.Assert(s.mgr.Ensure(), check.IsNil)
+
+	s.st.Lock()
+	defer s.st.Unlock()
+	warnings := s.st.AllWarnings()
+	c.Assert(warnings, check.HasLen, 1)
+	c.Check(warnings[0].String(), check.Matches, `(?s)cannot take scheduled snapshot: .*boom.*`)
+}
+
+func (s *scheduledSuite) TestScheduledSnapshotsRetain(c *check.C) {
+	s.testScheduledSnapshotsRetain(c, 2)
+}
+
+func (s *scheduledSuite) TestScheduledSnapshotsRetainString(c *check.C) {
+	s.testScheduledSnapshotsRetain(c, "2")
+}
+
+func (s *scheduledSuite) testScheduledSnapshotsRetain(c *check.C, retain interface{}) {
+	s.setConfig(c, map[string]interface{}{"snapshots.retain": retain})
+
+	dir := c.MkDir()
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for i := 1; i <= 5; i++ {
+		// two snapshots per set
+		for _, name := range []string{"a-snap", "c-snap"} {
+			f, err := os.Create(filepath.Join(dir, fmt.Sprintf("%d_%s.zip", i, name)))
+			c.Assert(err, check.IsNil)
+			files = append(files, f)
+		}
+	}
+	defer snapshotstate.MockBackendIter(func(_ context.Context, f func(*backend.Reader) error) error {
+		for _, file := range files {
+			var setID uint64
+			var name string
+			fmt.Sscanf(filepath.Base(file.Name()), "%d_%s", &setID, &name)
+			if err := f(&backend.Reader{Snapshot: client.Snapshot{SetID: setID}, File: file}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})()
+	var removed []string
+	defer snapshotstate.MockOsRemove(func(fn string) error {
+		removed = append(removed, filepath.Base(fn))
+		return nil
+	})()
+
+	s.st.Lock()
+	s.st.Set("snapshots", map[uint64]interface{}{
+		1: map[string]interface{}{"scheduled": true},
+		2: map[string]interface{}{"scheduled": true},
+		3: map[string]interface{}{"expiry-time": "2037-02-12T12:50:00Z"},
+		4: map[string]interface{}{"scheduled": true},
+		5: map[string]interface{}{"scheduled": true},
+	})
+	s.st.Unlock()
+
+	c.Assert(s.mgr.Ensure(), check.IsNil)
+
+	c.Check(removed, check.DeepEquals, []string{"1_a-snap.zip", "1_c-snap.zip", "2_a-snap.zip", "2_c-snap.zip"})
+	s.st.Lock()
+	defer s.st.Unlock()
+	var snapshots map[uint64]interface{}
+	c.Assert(s.st.Get("snapshots", &snapshots), check.IsNil)
+	c.Check(snapshots, check.HasLen, 3)
+	c.Check(snapshots[3], check.NotNil)
+	c.Check(snapshots[4], check.NotNil)
+	c.Check(snapshots[5], check.NotNil)
+}
+
+func (s *scheduledSuite) TestScheduledSnapshotsRetainSkipsFailed(c *check.C) {
+	s.setConfig(c, map[string]interface{}{"snapshots.retain": 2})
+
+	var iterated int
+	defer snapshotstate.MockBackendIter(func(context.Context, func(*backend.Reader) error) error {
+		// nothing was left on disk by the failed set
+		iterated++
+		return nil
+	})()
+
+	s.st.Lock()
+	s.st.Set("snapshots", map[uint64]interface{}{
+		4: map[string]interface{}{"scheduled": true},
+		5: map[string]interface{}{"scheduled": true},
+		6: map[string]interface{}{"scheduled": true},
+	})
+	chg := s.st.NewChange("scheduled-snapshot", "...")
+	chg.Set("snapshot-set-id", 6)
+	t := s.st.NewTask("save-snapshot", "...")
+	t.Errorf("boom")
+	t.SetStatus(state.ErrorStatus)
+	chg.AddTask(t)
+	s.st.Unlock()
+
+	c.Assert(s.mgr.Ensure(), check.IsNil)
+	// only the failed set was looked for
+	c.Check(iterated, check.Equals, 1)
+
+	s.st.Lock()
+	defer s.st.Unlock()
+	var snapshots map[uint64]interface{}
+	c.Assert(s.st.Get("snapshots", &snapshots), check.IsNil)
+	// the failed set didn't push out set 4
+	c.Check(snapshots, check.HasLen, 2)
+	c.Check(snapshots[4], check.NotNil)
+	c.Check(snapshots[5], check.NotNil)
+}
@@ -48,8 +48,10 @@ var (
 	backendCheck         = (*backend.Reader).Check
 	backendRevert        = (*backend.RestoreState).Revert // ditto
 	backendCleanup       = (*backend.RestoreState).Cleanup
+	backendPruneChunks   = backend.PruneChunks
 
 	autoExpirationInterval = time.Hour * 24 // interval between forgetExpiredSnapshots runs as part of Ensure()
+	pruneChunksInterval    = time.Hour * 24 // interval between pruneChunks runs as part of Ensure()
 )
 
 // SnapshotManager takes snapshots of active snaps
@@ -57,6 +59,10 @@ type SnapshotManager struct {
 	state *state.State
 
 	lastForgetExpiredSnapshotTime time.Time
+	lastPruneChunksTime           time.Time
+
+	lastSnapshotSchedule  string
+	nextScheduledSnapshot time.Time
 }
 
 // Manager returns a new SnapshotManager
@@ -81,11 +87,42 @@ func Manager(st *state.State, runner *state.TaskRunner) *SnapshotManager {
 func (mgr *SnapshotManager) Ensure() error {
 	// process expired snapshots once a day.
 	if time.Now().After(mgr.lastForgetExpiredSnapshotTime.Add(autoExpirationInterval)) {
-		return mgr.forgetExpiredSnapshots()
+		if err := mgr.forgetExpiredSnapshots(); err != nil {
+			return err
+		}
+	}
+	if err := mgr.ensureScheduledSnapshot(); err != nil {
+		return err
+	}
+	// and then drop the chunks that are no longer used, also once a day.
+	if time.Now().After(mgr.lastPruneChunksTime.Add(pruneChunksInterval)) {
+		return mgr.pruneChunks()
 	}
 	return nil
 }
 
+func (mgr *SnapshotManager) pruneChunks() error {
+	mgr.state.Lock()
+	for _, t := range mgr.state.Tasks() {
+		if t.Kind() == "save-snapshot" && !t.Status().Ready() {
+			// the snapshot being saved could be using chunks no
+			// other snapshot uses yet; try again on next Ensure()
+			mgr.state.Unlock()
+			return nil
+		}
+	}
+	mgr.state.Unlock()
+
+	// record the attempt even if it fails, so that a persistent
+	// failure doesn't make every Ensure() walk the snapshots again
+	mgr.lastPruneChunksTime = time.Now()
+	if err := backendPruneChunks(context.TODO()); err != nil {
+		return fmt.Errorf("cannot prune snapshot chunks: %v", err)
+	}
+
+	return nil
+}
+
 func (mgr *SnapshotManager) forgetExpiredSnapshots() error {
 	mgr.state.Lock()
 	defer mgr.state.Unlock()
@@ -99,14 +136,40 @@ func (mgr *SnapshotManager) forgetExpiredSnapshots() error {
 		return nil
 	}
 
-	err = backendIter(context.TODO(), func(r *backend.Reader) error {
+	if err := mgr.forgetSnapshotSets(sets); err != nil {
+		return fmt.Errorf("cannot process expired snapshots: %v", err)
+	}
+
+	// only reset time if there are no sets left because of conflicts
+	if len(sets) == 0 {
+		mgr.lastForgetExpiredSnapshotTime = time.Now()
+	}
+
+	return nil
+}
+
+// forgetSnapshotSets removes the files and the state of the given
+// snapshot sets, skipping those that are being checked or restored.
+// The sets that were forgotten are removed from the given map.
+// The state needs to be locked by the caller.
+func (mgr *SnapshotManager) forgetSnapshotSets(sets map[uint64]bool) error {
+	// a set can have more than one snapshot, so only drop the sets
+	// from the map once all their snapshots have been seen
+	forgotten := make(map[uint64]bool)
+	defer func() {
+		for setID := range forgotten {
+			delete(sets, setID)
+		}
+	}()
+
+	return backendIter(context.TODO(), func(r *backend.Reader) error {
 		// forget needs to conflict with check and restore
 		if err := checkSnapshotTaskConflict(mgr.state, r.SetID, "check-snapshot", "restore-snapshot"); err != nil {
 			// there is a conflict, do nothing and we will retry this set on next Ensure().
 			return nil
 		}
 		if sets[r.SetID] {
-			delete(sets, r.SetID)
+			forgotten[r.SetID] = true
 			// remove from state first: in case removeSnapshotState succeeds but osRemove fails we will never attempt
 			// to automatically remove this snapshot again and will leave it on the disk (so the user can still try to remove it manually);
 			// this is better than the other way around where a failing osRemove would be retried forever because snapshot would never
@@ -120,17 +183,6 @@ func (mgr *SnapshotManager) forgetExpiredSnapshots() error {
 		}
 		return nil
 	})
-
-	if err != nil {
-		return fmt.Errorf("cannot process expired snapshots: %v", err)
-	}
-
-	// only reset time if there are no sets left because of conflicts
-	if len(sets) == 0 {
-		mgr.lastForgetExpiredSnapshotTime = time.Now()
-	}
-
-	return nil
 }
 
 func (SnapshotManager) affectedSnaps(t *state.Task) ([]string, error) {
@@ -154,6 +206,7 @@ type snapshotSetup struct {
 	Filename string        `json:"filename,omitempty"`
 	Current  snap.Revision `json:"current"`
 	Auto     bool          `json:"auto,omitempty"`
+	Chunked  bool          `json:"chunked,omitempty"`
 }
 
 func filename(setID uint64, si *snap.Info) string {
@@ -180,6 +233,10 @@ func prepareSave(task *state.Task) (snapshot *snapshotSetup, cur *snap.Info, cfg
 	if err != nil {
 		return nil, nil, nil, err
 	}
+	snapshot.Chunked, err = chunkedSnapshots(st)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	// updating snapshot-setup with the filename, for use in undo
 	snapshot.Filename = filename(snapshot.SetID, cur)
 	task.Set("snapshot-setup", &snapshot)
@@ -213,7 +270,7 @@ func doSave(task *state.Task, tomb *tomb.Tomb) error {
 	if err != nil {
 		return err
 	}
-	_, err = backendSave(tomb.Context(nil), snapshot.SetID, cur, cfg, snapshot.Users, &backend.Flags{Auto: snapshot.Auto})
+	_, err = backendSave(tomb.Context(nil), snapshot.SetID, cur, cfg, snapshot.Users, &backend.Flags{Auto: snapshot.Auto, Chunked: snapshot.Chunked})
 	if err != nil {
 		st := task.State()
 		st.Lock()
@@ -33,6 +33,7 @@ import (
 
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/snapshotstate"
 	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
 	"github.com/snapcore/snapd/overlord/state"
@@ -164,6 +165,63 @@ func (snapshotSuite) TestEnsureForgetsSnapshotsRunsRegularly(c *check.C) {
 	c.Check(backendIterCalls, check.Equals, 2)
 }
 
+func (snapshotSuite) TestEnsurePrunesChunks(c *check.C) {
+	pruneCalls := 0
+	defer snapshotstate.MockBackendPruneChunks(func(context.Context) error {
+		pruneCalls++
+		return nil
+	})()
+
+	st := state.New(nil)
+	runner := state.NewTaskRunner(st)
+	mgr := snapshotstate.Manager(st, runner)
+
+	// a snapshot being saved blocks pruning
+	st.Lock()
+	chg := st.NewChange("snapshot-change", "...")
+	tsk := st.NewTask("save-snapshot", "...")
+	tsk.SetStatus(state.DoingStatus)
+	chg.AddTask(tsk)
+	st.Unlock()
+
+	c.Assert(mgr.Ensure(), check.IsNil)
+	c.Check(pruneCalls, check.Equals, 0)
+
+	st.Lock()
+	tsk.SetStatus(state.DoneStatus)
+	st.Unlock()
+
+	// consecutive runs of Ensure prune just once
+	for i := 0; i < 3; i++ {
+		c.Assert(mgr.Ensure(), check.IsNil)
+		c.Check(pruneCalls, check.Equals, 1)
+	}
+
+	// pretend we haven't run for a while
+	mgr.SetLastPruneChunksTime(time.Now().Add(-48 * time.Hour))
+	c.Assert(mgr.Ensure(), check.IsNil)
+	c.Check(pruneCalls, check.Equals, 2)
+}
+
+func (snapshotSuite) TestEnsurePruneChunksError(c *check.C) {
+	pruneCalls := 0
+	defer snapshotstate.MockBackendPruneChunks(func(context.Context) error {
+		pruneCalls++
+		return errors.New("boom")
+	})()
+
+	st := state.New(nil)
+	runner := state.NewTaskRunner(st)
+	mgr := snapshotstate.Manager(st, runner)
+
+	c.Check(mgr.Ensure(), check.ErrorMatches, "cannot prune snapshot chunks: boom")
+	c.Check(pruneCalls, check.Equals, 1)
+
+	// the failed attempt isn't retried on every Ensure
+	c.Check(mgr.Ensure(), check.IsNil)
+	c.Check(pruneCalls, check.Equals, 1)
+}
+
 func (snapshotSuite) testEnsureForgetSnapshotsConflict(c *check.C, snapshotTaskKind string) {
 	removeCalled := 0
 	restoreOsRemove := snapshotstate.MockOsRemove(func(string) error {
@@ -282,6 +340,48 @@ func (snapshotSuite) TestDoSave(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+func (snapshotSuite) TestDoSaveChunked(c *check.C) {
+	defer snapshotstate.MockSnapstateCurrentInfo(func(_ *state.State, snapname string) (*snap.Info, error) {
+		return &snap.Info{SideInfo: snap.SideInfo{RealName: "a-snap", Revision: snap.R(1)}, Version: "1.33"}, nil
+	})()
+	defer snapshotstate.MockConfigGetSnapConfig(func(*state.State, string) (*json.RawMessage, error) {
+		return nil, nil
+	})()
+
+	for _, t := range []struct {
+		value   interface{}
+		chunked bool
+	}{
+		{true, true},
+		{"true", true},
+		{false, false},
+		{"false", false},
+	} {
+		saved := 0
+		restore := snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, flags *backend.Flags) (*client.Snapshot, error) {
+			c.Check(flags.Chunked, check.Equals, t.chunked, check.Commentf("%#v", t.value))
+			saved++
+			return nil, nil
+		})
+
+		st := state.New(nil)
+		st.Lock()
+		tr := config.NewTransaction(st)
+		tr.Set("core", "snapshots.chunked", t.value)
+		tr.Commit()
+		task := st.NewTask("save-snapshot", "...")
+		task.Set("snapshot-setup", map[string]interface{}{
+			"set-id": 42,
+			"snap":   "a-snap",
+		})
+		st.Unlock()
+		err := snapshotstate.DoSave(task, &tomb.Tomb{})
+		c.Assert(err, check.IsNil)
+		c.Check(saved, check.Equals, 1)
+		restore()
+	}
+}
+
 func (snapshotSuite) TestDoSaveFailsWithNoSnap(c *check.C) {
 	defer snapshotstate.MockSnapstateCurrentInfo(func(*state.State, string) (*snap.Info, error) {
 		return nil, errors.New("bzzt")
@@ -23,6 +23,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"sort"
 	"time"
 
@@ -41,6 +42,8 @@ var (
 	snapstateAll                     = snapstate.All
 	snapstateCheckChangeConflictMany = snapstate.CheckChangeConflictMany
 	backendIter                      = backend.Iter
+	backendNewSnapshotExport         = backend.NewSnapshotExport
+	backendImport                    = backend.Import
 
 	// Default expiration time for automatic snapshots, if not set by the user
 	defaultAutomaticSnapshotExpiration = time.Hour * 24 * 31
@@ -48,6 +51,8 @@ var (
 
 type snapshotState struct {
 	ExpiryTime time.Time `json:"expiry-time"`
+	// Scheduled is set for snapshot sets taken as per snapshots.schedule
+	Scheduled bool `json:"scheduled,omitempty"`
 }
 
 func newSnapshotSetID(st *state.State) (uint64, error) {
@@ -81,6 +86,26 @@ func allActiveSnapNames(st *state.State) ([]string, error) {
 	return names, nil
 }
 
+// chunkedSnapshots returns whether new snapshots should be saved into
+// the deduplicated chunk store, as set via snapshots.chunked.
+// The state needs to be locked by the caller.
+func chunkedSnapshots(st *state.State) (bool, error) {
+	var chunked interface{}
+	tr := config.NewTransaction(st)
+	err := tr.Get("core", "snapshots.chunked", &chunked)
+	if err != nil && !config.IsNoOption(err) {
+		return false, err
+	}
+	// configcore accepts both the boolean and its string form
+	switch chunked {
+	case true, "true":
+		return true, nil
+	case nil, false, "false", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("snapshots.chunked can only be set to 'true' or 'false', got %q", chunked)
+}
+
 func AutomaticSnapshotExpiration(st *state.State) (time.Duration, error) {
 	var expirationStr string
 	tr := config.NewTransaction(st)
@@ -162,6 +187,11 @@ func expiredSnapshotSets(st *state.State, cutoffTime time.Time) (map[uint64]bool
 
 	expired := make(map[uint64]bool)
 	for setID, snapshotSet := range snapshots {
+		if snapshotSet.ExpiryTime.IsZero() {
+			// never expires (e.g. scheduled snapshots, which are
+			// pruned by count instead)
+			continue
+		}
 		if snapshotSet.ExpiryTime.Before(cutoffTime) {
 			expired[setID] = true
 		}
@@ -451,3 +481,37 @@ func Forget(st *state.State, setID uint64, snapNames []string) (snapsFound []str
 
 	return summaries.snapNames(), ts, nil
 }
+
+// Export opens the given snapshot set for exporting as a single stream.
+// Note that the state must not be locked by the caller, as reading the
+// snapshot set can take a while.
+func Export(ctx context.Context, st *state.State, setID uint64) (*backend.SnapshotExport, error) {
+	st.Lock()
+	// export needs to conflict with forget of itself
+	err := checkSnapshotTaskConflict(st, setID, "forget-snapshot")
+	st.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return backendNewSnapshotExport(ctx, setID)
+}
+
+// Import a snapshot set from an export stream, as a new snapshot set.
+// Note that the state must not be locked by the caller, as reading the
+// stream can take a while.
+func Import(ctx context.Context, st *state.State, r io.Reader) (setID uint64, snapNames []string, err error) {
+	st.Lock()
+	setID, err = newSnapshotSetID(st)
+	st.Unlock()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	snapNames, err = backendImport(ctx, setID, r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return setID, snapNames, nil
+}
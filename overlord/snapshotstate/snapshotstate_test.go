@@ -23,6 +23,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"os/user"
@@ -1477,3 +1479,68 @@ func (snapshotSuite) TestAutomaticSnapshotDefaultUbuntuCore(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(du, check.Equals, time.Duration(0))
 }
+
+func (snapshotSuite) TestExportChecksForgetConflicts(c *check.C) {
+	defer snapshotstate.MockBackendNewSnapshotExport(func(context.Context, uint64) (*backend.SnapshotExport, error) {
+		c.Fatal("should not be reached")
+		return nil, nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	chg := st.NewChange("forget-snapshot-change", "...")
+	tsk := st.NewTask("forget-snapshot", "...")
+	tsk.SetStatus(state.DoingStatus)
+	tsk.Set("snapshot-setup", map[string]int{"set-id": 42})
+	chg.AddTask(tsk)
+	st.Unlock()
+
+	_, err := snapshotstate.Export(context.TODO(), st, 42)
+	c.Assert(err, check.ErrorMatches, `cannot operate on snapshot set #42 while change \"1\" is in progress`)
+}
+
+func (snapshotSuite) TestExport(c *check.C) {
+	var exportedSetID uint64
+	defer snapshotstate.MockBackendNewSnapshotExport(func(_ context.Context, setID uint64) (*backend.SnapshotExport, error) {
+		exportedSetID = setID
+		return &backend.SnapshotExport{}, nil
+	})()
+
+	st := state.New(nil)
+	se, err := snapshotstate.Export(context.TODO(), st, 42)
+	c.Assert(err, check.IsNil)
+	c.Check(se, check.NotNil)
+	c.Check(exportedSetID, check.Equals, uint64(42))
+}
+
+func (snapshotSuite) TestImport(c *check.C) {
+	var importedSetID uint64
+	defer snapshotstate.MockBackendImport(func(_ context.Context, setID uint64, r io.Reader) ([]string, error) {
+		importedSetID = setID
+		data, err := ioutil.ReadAll(r)
+		c.Assert(err, check.IsNil)
+		c.Check(string(data), check.Equals, "export-stream")
+		return []string{"a-snap", "b-snap"}, nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	st.Set("last-snapshot-set-id", 41)
+	st.Unlock()
+
+	setID, snapNames, err := snapshotstate.Import(context.TODO(), st, strings.NewReader("export-stream"))
+	c.Assert(err, check.IsNil)
+	c.Check(setID, check.Equals, uint64(42))
+	c.Check(importedSetID, check.Equals, uint64(42))
+	c.Check(snapNames, check.DeepEquals, []string{"a-snap", "b-snap"})
+}
+
+func (snapshotSuite) TestImportError(c *check.C) {
+	defer snapshotstate.MockBackendImport(func(context.Context, uint64, io.Reader) ([]string, error) {
+		return nil, errors.New("bzzt")
+	})()
+
+	st := state.New(nil)
+	_, _, err := snapshotstate.Import(context.TODO(), st, strings.NewReader(""))
+	c.Assert(err, check.ErrorMatches, "bzzt")
+}
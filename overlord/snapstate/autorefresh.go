@@ -134,6 +134,89 @@ func (m *autoRefresh) clearRefreshHold() {
 	tr.Commit()
 }
 
+// HoldRefresh holds the automatic refreshes of the given snaps until
+// the given time, or indefinitely if it is the zero time. Manual
+// refreshes of the snaps are not affected.
+//
+// If no snaps are given, all automatic refreshes are held, as with the
+// refresh.hold option; as such, they are held for at most
+// maxPostponement since the last refresh.
+// Note that the state must be locked by the caller.
+func HoldRefresh(st *state.State, until time.Time, instanceNames ...string) error {
+	if len(instanceNames) == 0 {
+		if until.IsZero() {
+			until = time.Now().Add(maxPostponement)
+		}
+		tr := config.NewTransaction(st)
+		if err := tr.Set("core", "refresh.hold", until); err != nil {
+			return err
+		}
+		tr.Commit()
+		return nil
+	}
+
+	if !until.IsZero() && !until.After(time.Now()) {
+		return fmt.Errorf("cannot hold refreshes until %s: time is in the past", until.Format(time.RFC3339))
+	}
+
+	snapStates, err := snapStatesForHold(st, instanceNames)
+	if err != nil {
+		return err
+	}
+	for i, name := range instanceNames {
+		snapst := snapStates[i]
+		hold := until
+		snapst.RefreshHold = &hold
+		Set(st, name, snapst)
+	}
+
+	return nil
+}
+
+// UnholdRefresh removes the holds on automatic refreshes of the given
+// snaps, or the system-wide one if no snaps are given.
+// Note that the state must be locked by the caller.
+func UnholdRefresh(st *state.State, instanceNames ...string) error {
+	if len(instanceNames) == 0 {
+		tr := config.NewTransaction(st)
+		if err := tr.Set("core", "refresh.hold", nil); err != nil {
+			return err
+		}
+		tr.Commit()
+		return nil
+	}
+
+	snapStates, err := snapStatesForHold(st, instanceNames)
+	if err != nil {
+		return err
+	}
+	for i, name := range instanceNames {
+		snapst := snapStates[i]
+		snapst.RefreshHold = nil
+		Set(st, name, snapst)
+	}
+
+	return nil
+}
+
+// snapStatesForHold gets the state of all the given snaps, so that
+// holding or unholding is all or nothing.
+func snapStatesForHold(st *state.State, instanceNames []string) ([]*SnapState, error) {
+	snapStates := make([]*SnapState, len(instanceNames))
+	for i, name := range instanceNames {
+		var snapst SnapState
+		err := Get(st, name, &snapst)
+		if err == state.ErrNoState {
+			return nil, &snap.NotInstalledError{Snap: name}
+		}
+		if err != nil {
+			return nil, err
+		}
+		snapStates[i] = &snapst
+	}
+	return snapStates, nil
+}
+
 // AtSeed configures refresh policies at end of seeding.
 func (m *autoRefresh) AtSeed() error {
 	// on classic hold refreshes for 2h after seeding
@@ -380,7 +463,13 @@ func (m *autoRefresh) launchAutoRefresh() error {
 	}()
 
 	m.lastRefreshAttempt = time.Now()
-	updated, tasksets, err := AutoRefresh(auth.EnsureContextTODO(), m.state)
+	var updated []string
+	var tasksets []*state.TaskSet
+	// snaps with a gate-auto-refresh hook get a say first
+	gatedChg, err := launchGatedAutoRefresh(auth.EnsureContextTODO(), m.state)
+	if err == nil && gatedChg == nil {
+		updated, tasksets, err = AutoRefresh(auth.EnsureContextTODO(), m.state)
+	}
 	if _, ok := err.(*httputil.PerstistentNetworkError); ok {
 		logger.Noticef("Cannot prepare auto-refresh change due to a permanent network error: %s", err)
 		return err
@@ -390,6 +479,13 @@ func (m *autoRefresh) launchAutoRefresh() error {
 		logger.Noticef("Cannot prepare auto-refresh change: %s", err)
 		return err
 	}
+	if gatedChg != nil {
+		perfTimings.AddTag("change-id", gatedChg.ID())
+		return nil
+	}
+	if err := forgetGatingHolds(m.state, updated); err != nil {
+		logger.Noticef("Cannot forget auto-refresh gating holds: %v", err)
+	}
 
 	var msg string
 	switch len(updated) {
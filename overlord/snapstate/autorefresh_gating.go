@@ -0,0 +1,412 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/store"
+	"github.com/snapcore/snapd/strutil"
+)
+
+// Snaps with a gate-auto-refresh hook get to run it before an
+// auto-refresh of themselves, of their base, or of the providers of
+// their content plugs, and can hold that refresh from the hook (see
+// snapctl refresh --hold). Holds are only kept for so long: a snap
+// cannot be kept from refreshing this way for more than
+// maxPostponement.
+
+const gateAutoRefreshHookName = "gate-auto-refresh"
+
+// gatingHold records the holds put on the auto-refresh of a snap by
+// the gate-auto-refresh hooks of other snaps (or its own).
+type gatingHold struct {
+	// FirstHeld is when the refresh was first held, since the snap
+	// was last refreshed.
+	FirstHeld time.Time `json:"first-held"`
+	// HeldBy are the snaps currently holding the refresh.
+	HeldBy []string `json:"held-by,omitempty"`
+}
+
+func gatingHolds(st *state.State) (map[string]*gatingHold, error) {
+	var holds map[string]*gatingHold
+	if err := st.Get("refresh-gating-holds", &holds); err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+	if holds == nil {
+		holds = make(map[string]*gatingHold)
+	}
+	return holds, nil
+}
+
+// HoldRefreshesBy records that the gating snap holds the auto-refresh
+// of the given snaps. It fails if any of them was held for too long
+// already.
+// Note that the state must be locked by the caller.
+func HoldRefreshesBy(st *state.State, gatingSnap string, instanceNames []string) error {
+	holds, err := gatingHolds(st)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, name := range instanceNames {
+		if hold := holds[name]; hold != nil && now.Sub(hold.FirstHeld) >= maxPostponement {
+			return fmt.Errorf("cannot hold refresh of %q any longer: it has been held since %s", name, hold.FirstHeld.Format(time.RFC3339))
+		}
+	}
+	for _, name := range instanceNames {
+		hold := holds[name]
+		if hold == nil {
+			hold = &gatingHold{FirstHeld: now}
+			holds[name] = hold
+		}
+		if !strutil.ListContains(hold.HeldBy, gatingSnap) {
+			hold.HeldBy = append(hold.HeldBy, gatingSnap)
+		}
+	}
+	st.Set("refresh-gating-holds", holds)
+
+	return nil
+}
+
+// ProceedWithRefresh removes the holds put by the gating snap on
+// auto-refreshes.
+// Note that the state must be locked by the caller.
+func ProceedWithRefresh(st *state.State, gatingSnap string) error {
+	holds, err := gatingHolds(st)
+	if err != nil {
+		return err
+	}
+	for _, hold := range holds {
+		heldBy := hold.HeldBy[:0]
+		for _, name := range hold.HeldBy {
+			if name != gatingSnap {
+				heldBy = append(heldBy, name)
+			}
+		}
+		hold.HeldBy = heldBy
+	}
+	st.Set("refresh-gating-holds", holds)
+
+	return nil
+}
+
+// held returns whether the auto-refresh of the snap is held by a
+// gate-auto-refresh hook, and the hold has not gone on for too long.
+func (hold *gatingHold) held(now time.Time) bool {
+	return hold != nil && len(hold.HeldBy) > 0 && now.Sub(hold.FirstHeld) < maxPostponement
+}
+
+// forgetGatingHolds drops the gating holds on the refreshed snaps, as
+// well as the ones no snap holds anymore.
+func forgetGatingHolds(st *state.State, refreshed []string) error {
+	holds, err := gatingHolds(st)
+	if err != nil {
+		return err
+	}
+	if len(holds) == 0 {
+		return nil
+	}
+	for name, hold := range holds {
+		if len(hold.HeldBy) == 0 || strutil.ListContains(refreshed, name) {
+			delete(holds, name)
+		}
+	}
+	if len(holds) == 0 {
+		st.Set("refresh-gating-holds", nil)
+	} else {
+		st.Set("refresh-gating-holds", holds)
+	}
+	return nil
+}
+
+// autoRefreshFilter returns the filter for auto-refreshes, that skips
+// the snaps whose refreshes are held by the user or by gating snaps.
+func autoRefreshFilter(st *state.State) (updateFilter, error) {
+	holds, err := gatingHolds(st)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return func(update *snap.Info, snapst *SnapState) bool {
+		if snapst.RefreshHeld(now) {
+			logger.Debugf("Auto-refresh of %q is held.", update.InstanceName())
+			return false
+		}
+		if hold := holds[update.InstanceName()]; hold.held(now) {
+			logger.Debugf("Auto-refresh of %q is held by %s.", update.InstanceName(), strutil.Quoted(hold.HeldBy))
+			return false
+		}
+		return true
+	}, nil
+}
+
+// contentProviders returns the default providers of the content plugs
+// of the snap.
+func contentProviders(info *snap.Info) []string {
+	var providers []string
+	for _, plug := range info.Plugs {
+		if plug.Interface != "content" {
+			continue
+		}
+		var dprovider string
+		if err := plug.Attr("default-provider", &dprovider); err != nil || dprovider == "" {
+			continue
+		}
+		name := strings.SplitN(dprovider, ":", 2)[0]
+		if !strutil.ListContains(providers, name) {
+			providers = append(providers, name)
+		}
+	}
+	return providers
+}
+
+// gatingSnaps returns which of the installed snaps with a
+// gate-auto-refresh hook are affected by the refresh of the given
+// snaps, and by the refresh of which of them.
+func gatingSnaps(st *state.State, refreshed []string) (map[string][]string, error) {
+	snapStates, err := All(st)
+	if err != nil {
+		return nil, err
+	}
+
+	gating := make(map[string][]string)
+	for name, snapst := range snapStates {
+		if !snapst.Active {
+			continue
+		}
+		info, err := snapst.CurrentInfo()
+		if err != nil {
+			return nil, err
+		}
+		if info.Hooks[gateAutoRefreshHookName] == nil {
+			continue
+		}
+		var affecting []string
+		if strutil.ListContains(refreshed, name) {
+			affecting = append(affecting, name)
+		}
+		if info.Base != "" && strutil.ListContains(refreshed, info.Base) {
+			affecting = append(affecting, info.Base)
+		}
+		for _, provider := range contentProviders(info) {
+			if strutil.ListContains(refreshed, provider) && !strutil.ListContains(affecting, provider) {
+				affecting = append(affecting, provider)
+			}
+		}
+		if len(affecting) > 0 {
+			gating[name] = affecting
+		}
+	}
+
+	return gating, nil
+}
+
+// hasGatingSnaps returns whether any of the installed snaps has a
+// gate-auto-refresh hook.
+func hasGatingSnaps(st *state.State) (bool, error) {
+	snapStates, err := All(st)
+	if err != nil {
+		return false, err
+	}
+	for _, snapst := range snapStates {
+		if !snapst.Active {
+			continue
+		}
+		info, err := snapst.CurrentInfo()
+		if err != nil {
+			return false, err
+		}
+		if info.Hooks[gateAutoRefreshHookName] != nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// autoRefreshCandidates returns the snaps an auto-refresh would
+// refresh, without setting up the refresh.
+func autoRefreshCandidates(ctx context.Context, st *state.State) ([]string, error) {
+	user, err := userFromUserID(st, 0)
+	if err != nil {
+		return nil, err
+	}
+	// need to have a model set before trying to talk the store
+	if _, err := DevicePastSeeding(st, nil); err != nil {
+		return nil, err
+	}
+	filter, err := autoRefreshFilter(st)
+	if err != nil {
+		return nil, err
+	}
+
+	updates, stateByInstanceName, _, err := refreshCandidates(ctx, st, nil, user, &store.RefreshOptions{IsAutoRefresh: true})
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, update := range updates {
+		if filter(update, stateByInstanceName[update.InstanceName()]) {
+			names = append(names, update.InstanceName())
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// launchGatedAutoRefresh sets up an auto-refresh change that runs the
+// gate-auto-refresh hooks of the affected snaps first, if there are
+// any such snaps; otherwise it returns nil.
+func launchGatedAutoRefresh(ctx context.Context, st *state.State) (*state.Change, error) {
+	gated, err := hasGatingSnaps(st)
+	if err != nil || !gated {
+		return nil, err
+	}
+
+	if AutoRefreshAssertions != nil {
+		if err := AutoRefreshAssertions(st, 0); err != nil {
+			return nil, err
+		}
+	}
+	candidates, err := autoRefreshCandidates(ctx, st)
+	if err != nil || len(candidates) == 0 {
+		return nil, err
+	}
+
+	return autoRefreshGatedChange(st, candidates)
+}
+
+// autoRefreshGatedChange sets up an auto-refresh change that first runs
+// the gate-auto-refresh hooks of the given gating snaps, and then
+// refreshes those of the candidates that were not held. It returns nil
+// if no snap needs to gate the refresh of the candidates.
+func autoRefreshGatedChange(st *state.State, candidates []string) (*state.Change, error) {
+	gating, err := gatingSnaps(st, candidates)
+	if err != nil {
+		return nil, err
+	}
+	if len(gating) == 0 {
+		return nil, nil
+	}
+
+	gatingNames := make([]string, 0, len(gating))
+	for name := range gating {
+		gatingNames = append(gatingNames, name)
+	}
+	sort.Strings(gatingNames)
+
+	var msg string
+	switch len(candidates) {
+	case 1:
+		msg = fmt.Sprintf(i18n.G("Auto-refresh snap %q"), candidates[0])
+	case 2, 3:
+		// TRANSLATORS: the %s is a comma-separated list of quoted snap names
+		msg = fmt.Sprintf(i18n.G("Auto-refresh snaps %s"), strutil.Quoted(candidates))
+	default:
+		msg = fmt.Sprintf(i18n.G("Auto-refresh %d snaps"), len(candidates))
+	}
+	chg := st.NewChange("auto-refresh", msg)
+
+	summary := fmt.Sprintf(i18n.G("Auto-refresh snaps not held by %s"), strutil.Quoted(gatingNames))
+	conditional := st.NewTask("conditional-auto-refresh", summary)
+	conditional.Set("snaps", candidates)
+	for _, name := range gatingNames {
+		hook := SetupGateAutoRefreshHook(st, name, gating[name])
+		conditional.WaitFor(hook)
+		chg.AddTask(hook)
+	}
+	chg.AddTask(conditional)
+	chg.Set("snap-names", candidates)
+	chg.Set("api-data", map[string]interface{}{"snap-names": candidates})
+
+	return chg, nil
+}
+
+// SetupGateAutoRefreshHook sets up the task that runs the
+// gate-auto-refresh hook of the given snap, which is affected by the
+// refresh of the given snaps.
+var SetupGateAutoRefreshHook = func(st *state.State, snapName string, affecting []string) *state.Task {
+	panic("internal error: snapstate.SetupGateAutoRefreshHook is unset")
+}
+
+// conditionalAutoRefreshUpdateMany exists just to make testing simpler
+var conditionalAutoRefreshUpdateMany = updateManyFiltered
+
+func (m *SnapManager) doConditionalAutoRefresh(t *state.Task, tomb *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var candidates []string
+	if err := t.Get("snaps", &candidates); err != nil {
+		return err
+	}
+	filter, err := autoRefreshFilter(st)
+	if err != nil {
+		return err
+	}
+	candidatesFilter := func(update *snap.Info, snapst *SnapState) bool {
+		return strutil.ListContains(candidates, update.InstanceName()) && filter(update, snapst)
+	}
+
+	chg := t.Change()
+	updated, tasksets, err := conditionalAutoRefreshUpdateMany(auth.EnsureContextTODO(), st, nil, 0, candidatesFilter, &Flags{IsAutoRefresh: true}, chg.ID())
+	if err != nil {
+		return err
+	}
+	if err := forgetGatingHolds(st, updated); err != nil {
+		return err
+	}
+
+	var held []string
+	for _, name := range candidates {
+		if !strutil.ListContains(updated, name) {
+			held = append(held, name)
+		}
+	}
+	if len(held) > 0 {
+		t.Logf("Not auto-refreshing %s.", strutil.Quoted(held))
+	}
+	if len(updated) > 0 {
+		for _, ts := range tasksets {
+			chg.AddAll(ts)
+		}
+		st.EnsureBefore(0)
+	}
+	chg.Set("snap-names", updated)
+	chg.Set("api-data", map[string]interface{}{"snap-names": updated})
+	t.SetStatus(state.DoneStatus)
+
+	return nil
+}
@@ -0,0 +1,326 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/snapstate/snapstatetest"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/store"
+	"github.com/snapcore/snapd/store/storetest"
+	"github.com/snapcore/snapd/strutil"
+)
+
+type gatingStore struct {
+	storetest.Store
+
+	// the snaps that have an update
+	updates []string
+}
+
+func (r *gatingStore) SnapAction(ctx context.Context, currentSnaps []*store.CurrentSnap, actions []*store.SnapAction, user *auth.UserState, opts *store.RefreshOptions) ([]*snap.Info, error) {
+	var infos []*snap.Info
+	for _, cur := range currentSnaps {
+		if !strutil.ListContains(r.updates, cur.InstanceName) {
+			continue
+		}
+		infos = append(infos, &snap.Info{SideInfo: snap.SideInfo{
+			RealName: cur.InstanceName,
+			SnapID:   cur.SnapID,
+			Revision: snap.R(cur.Revision.N + 1),
+		}})
+	}
+	return infos, nil
+}
+
+type refreshGatingSuite struct {
+	state *state.State
+	store *gatingStore
+	infos map[string]*snap.Info
+
+	restore []func()
+}
+
+var _ = Suite(&refreshGatingSuite{})
+
+func (s *refreshGatingSuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+
+	s.state = state.New(nil)
+	s.store = &gatingStore{}
+	s.infos = make(map[string]*snap.Info)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	snapstate.ReplaceStore(s.state, s.store)
+	s.state.Set("seeded", true)
+	s.state.Set("seed-time", time.Now())
+	s.state.Set("refresh-privacy-key", "privacy-key")
+
+	var hookSnaps []string
+	s.restore = []func(){
+		snap.MockSanitizePlugsSlots(func(snapInfo *snap.Info) {}),
+		snapstatetest.MockDeviceModel(DefaultModel()),
+		snapstate.MockSnapReadInfo(func(name string, si *snap.SideInfo) (*snap.Info, error) {
+			info := s.infos[name]
+			if info == nil {
+				return nil, fmt.Errorf("unexpected snap %q", name)
+			}
+			info.SideInfo = *si
+			return info, nil
+		}),
+	}
+	oldSetupGateAutoRefreshHook := snapstate.SetupGateAutoRefreshHook
+	snapstate.SetupGateAutoRefreshHook = func(st *state.State, snapName string, affecting []string) *state.Task {
+		hookSnaps = append(hookSnaps, snapName)
+		t := st.NewTask("run-hook", fmt.Sprintf("gate-auto-refresh hook of %q", snapName))
+		t.Set("affecting-snaps", affecting)
+		return t
+	}
+	s.restore = append(s.restore, func() {
+		snapstate.SetupGateAutoRefreshHook = oldSetupGateAutoRefreshHook
+	})
+}
+
+func (s *refreshGatingSuite) TearDownTest(c *C) {
+	for _, f := range s.restore {
+		f()
+	}
+	dirs.SetRootDir("/")
+}
+
+func (s *refreshGatingSuite) mockInstalled(c *C, snapYaml string) {
+	info, err := snap.InfoFromSnapYaml([]byte(snapYaml))
+	c.Assert(err, IsNil)
+	name := info.InstanceName()
+	s.infos[name] = info
+	snapstate.Set(s.state, name, &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: name, Revision: snap.R(1), SnapID: name + "-id"},
+		},
+		Current:  snap.R(1),
+		SnapType: string(info.GetType()),
+	})
+}
+
+const gatingSnapYaml = `name: gating-snap
+base: some-base
+hooks:
+  gate-auto-refresh:
+plugs:
+  content:
+    interface: content
+    content: some-content
+    default-provider: content-provider
+`
+
+func (s *refreshGatingSuite) mockSnaps(c *C) {
+	s.mockInstalled(c, gatingSnapYaml)
+	s.mockInstalled(c, "name: some-base\ntype: base\n")
+	s.mockInstalled(c, "name: content-provider\n")
+	s.mockInstalled(c, "name: other-snap\n")
+}
+
+func (s *refreshGatingSuite) TestGatingSnaps(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.mockSnaps(c)
+
+	for _, t := range []struct {
+		refreshed []string
+		gating    map[string][]string
+	}{
+		{nil, map[string][]string{}},
+		{[]string{"other-snap"}, map[string][]string{}},
+		{[]string{"gating-snap"}, map[string][]string{"gating-snap": {"gating-snap"}}},
+		{[]string{"some-base", "other-snap"}, map[string][]string{"gating-snap": {"some-base"}}},
+		{[]string{"content-provider", "gating-snap", "some-base"}, map[string][]string{"gating-snap": {"gating-snap", "some-base", "content-provider"}}},
+	} {
+		gating, err := snapstate.GatingSnaps(s.state, t.refreshed)
+		c.Assert(err, IsNil)
+		c.Check(gating, DeepEquals, t.gating, Commentf("%v", t.refreshed))
+	}
+}
+
+func (s *refreshGatingSuite) TestHoldRefreshesByAndProceed(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Assert(snapstate.HoldRefreshesBy(s.state, "gating-snap", []string{"some-base", "content-provider"}), IsNil)
+	c.Assert(snapstate.HoldRefreshesBy(s.state, "other-gating-snap", []string{"some-base"}), IsNil)
+
+	var holds map[string]map[string]interface{}
+	c.Assert(s.state.Get("refresh-gating-holds", &holds), IsNil)
+	c.Check(holds, HasLen, 2)
+	c.Check(holds["some-base"]["held-by"], DeepEquals, []interface{}{"gating-snap", "other-gating-snap"})
+	c.Check(holds["content-provider"]["held-by"], DeepEquals, []interface{}{"gating-snap"})
+
+	c.Assert(snapstate.ProceedWithRefresh(s.state, "gating-snap"), IsNil)
+	holds = nil
+	c.Assert(s.state.Get("refresh-gating-holds", &holds), IsNil)
+	c.Check(holds["some-base"]["held-by"], DeepEquals, []interface{}{"other-gating-snap"})
+	c.Check(holds["content-provider"]["held-by"], IsNil)
+}
+
+func (s *refreshGatingSuite) TestHoldRefreshesByTooLong(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	firstHeld := time.Now().Add(-61 * 24 * time.Hour)
+	s.state.Set("refresh-gating-holds", map[string]interface{}{
+		"some-base": map[string]interface{}{
+			"first-held": firstHeld,
+			"held-by":    []string{"gating-snap"},
+		},
+	})
+
+	err := snapstate.HoldRefreshesBy(s.state, "gating-snap", []string{"content-provider", "some-base"})
+	c.Check(err, ErrorMatches, `cannot hold refresh of "some-base" any longer: it has been held since .*`)
+}
+
+func (s *refreshGatingSuite) TestLaunchGatedAutoRefreshNoGatingSnaps(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.mockInstalled(c, "name: other-snap\n")
+	s.store.updates = []string{"other-snap"}
+
+	chg, err := snapstate.LaunchGatedAutoRefresh(auth.EnsureContextTODO(), s.state)
+	c.Assert(err, IsNil)
+	c.Check(chg, IsNil)
+}
+
+func (s *refreshGatingSuite) TestLaunchGatedAutoRefreshNotAffected(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.mockSnaps(c)
+	s.store.updates = []string{"other-snap"}
+
+	chg, err := snapstate.LaunchGatedAutoRefresh(auth.EnsureContextTODO(), s.state)
+	c.Assert(err, IsNil)
+	c.Check(chg, IsNil)
+}
+
+func (s *refreshGatingSuite) TestLaunchGatedAutoRefresh(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.mockSnaps(c)
+	s.store.updates = []string{"other-snap", "some-base"}
+
+	chg, err := snapstate.LaunchGatedAutoRefresh(auth.EnsureContextTODO(), s.state)
+	c.Assert(err, IsNil)
+	c.Assert(chg, NotNil)
+	c.Check(chg.Kind(), Equals, "auto-refresh")
+	c.Check(chg.Summary(), Equals, `Auto-refresh snaps "other-snap", "some-base"`)
+
+	tasks := chg.Tasks()
+	c.Assert(tasks, HasLen, 2)
+	c.Check(tasks[0].Kind(), Equals, "run-hook")
+	var affecting []string
+	c.Assert(tasks[0].Get("affecting-snaps", &affecting), IsNil)
+	c.Check(affecting, DeepEquals, []string{"some-base"})
+
+	c.Check(tasks[1].Kind(), Equals, "conditional-auto-refresh")
+	c.Check(tasks[1].WaitTasks(), DeepEquals, []*state.Task{tasks[0]})
+	var snaps []string
+	c.Assert(tasks[1].Get("snaps", &snaps), IsNil)
+	c.Check(snaps, DeepEquals, []string{"other-snap", "some-base"})
+}
+
+func (s *refreshGatingSuite) TestLaunchGatedAutoRefreshSkipsHeld(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.mockSnaps(c)
+	s.store.updates = []string{"other-snap", "some-base"}
+	c.Assert(snapstate.HoldRefresh(s.state, time.Time{}, "some-base"), IsNil)
+
+	// the only candidate does not affect the gating snap
+	chg, err := snapstate.LaunchGatedAutoRefresh(auth.EnsureContextTODO(), s.state)
+	c.Assert(err, IsNil)
+	c.Check(chg, IsNil)
+}
+
+type conditionalAutoRefreshSuite struct {
+	baseHandlerSuite
+}
+
+var _ = Suite(&conditionalAutoRefreshSuite{})
+
+func (s *conditionalAutoRefreshSuite) SetUpTest(c *C) {
+	s.setup(c, nil)
+}
+
+func (s *conditionalAutoRefreshSuite) TestDoConditionalAutoRefresh(c *C) {
+	var filtered []string
+	defer snapstate.MockConditionalAutoRefreshUpdateMany(func(_ context.Context, st *state.State, names []string, userID int, filter snapstate.UpdateFilter, flags *snapstate.Flags, fromChange string) ([]string, []*state.TaskSet, error) {
+		c.Check(names, HasLen, 0)
+		c.Check(flags.IsAutoRefresh, Equals, true)
+		for _, name := range []string{"some-snap", "held-snap", "not-a-candidate"} {
+			if filter(&snap.Info{SideInfo: snap.SideInfo{RealName: name}}, &snapstate.SnapState{}) {
+				filtered = append(filtered, name)
+			}
+		}
+		t := st.NewTask("fake-refresh", "refresh")
+		return filtered, []*state.TaskSet{state.NewTaskSet(t)}, nil
+	})()
+
+	s.state.Lock()
+	c.Assert(snapstate.HoldRefreshesBy(s.state, "gating-snap", []string{"held-snap"}), IsNil)
+	c.Assert(snapstate.HoldRefreshesBy(s.state, "gating-snap", []string{"some-snap"}), IsNil)
+	// the gating snap changed its mind about this one
+	c.Assert(snapstate.ProceedWithRefresh(s.state, "gating-snap"), IsNil)
+	c.Assert(snapstate.HoldRefreshesBy(s.state, "gating-snap", []string{"held-snap"}), IsNil)
+
+	chg := s.state.NewChange("auto-refresh", "...")
+	t := s.state.NewTask("conditional-auto-refresh", "...")
+	t.Set("snaps", []string{"held-snap", "some-snap"})
+	chg.AddTask(t)
+	s.state.Unlock()
+
+	s.se.Ensure()
+	s.se.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Check(t.Status(), Equals, state.DoneStatus)
+	c.Check(filtered, DeepEquals, []string{"some-snap"})
+	c.Check(logstr(t), Matches, `(?s).*Not auto-refreshing "held-snap".*`)
+	var snapNames []string
+	c.Assert(chg.Get("snap-names", &snapNames), IsNil)
+	c.Check(snapNames, DeepEquals, []string{"some-snap"})
+	c.Assert(chg.Tasks(), HasLen, 2)
+	c.Check(chg.Tasks()[1].Kind(), Equals, "fake-refresh")
+
+	// only the hold on the held snap remains
+	var holds map[string]interface{}
+	c.Assert(s.state.Get("refresh-gating-holds", &holds), IsNil)
+	c.Check(holds, HasLen, 1)
+	c.Check(holds["held-snap"], NotNil)
+}
@@ -649,3 +649,77 @@ func (s *autoRefreshTestSuite) TestRefreshOnMeteredConnNotMetered(c *C) {
 	c.Check(err, IsNil)
 	c.Check(s.store.ops, DeepEquals, []string{"list-refresh"})
 }
+
+func (s *autoRefreshTestSuite) TestHoldRefresh(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	until := time.Now().Add(24 * time.Hour)
+	err := snapstate.HoldRefresh(s.state, until, "some-snap")
+	c.Assert(err, IsNil)
+
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "some-snap", &snapst), IsNil)
+	c.Assert(snapst.RefreshHold, NotNil)
+	c.Check(snapst.RefreshHold.Equal(until), Equals, true)
+	c.Check(snapst.RefreshHeld(time.Now()), Equals, true)
+	c.Check(snapst.RefreshHeld(until.Add(time.Second)), Equals, false)
+
+	// held forever
+	err = snapstate.HoldRefresh(s.state, time.Time{}, "some-snap")
+	c.Assert(err, IsNil)
+	c.Assert(snapstate.Get(s.state, "some-snap", &snapst), IsNil)
+	c.Assert(snapst.RefreshHold, NotNil)
+	c.Check(snapst.RefreshHold.IsZero(), Equals, true)
+	c.Check(snapst.RefreshHeld(until.Add(365*24*time.Hour)), Equals, true)
+
+	err = snapstate.UnholdRefresh(s.state, "some-snap")
+	c.Assert(err, IsNil)
+	c.Assert(snapstate.Get(s.state, "some-snap", &snapst), IsNil)
+	c.Check(snapst.RefreshHold, IsNil)
+	c.Check(snapst.RefreshHeld(time.Now()), Equals, false)
+}
+
+func (s *autoRefreshTestSuite) TestHoldRefreshErrors(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	err := snapstate.HoldRefresh(s.state, time.Now().Add(-time.Hour), "some-snap")
+	c.Check(err, ErrorMatches, `cannot hold refreshes until .*: time is in the past`)
+
+	err = snapstate.HoldRefresh(s.state, time.Time{}, "some-snap", "other-snap")
+	c.Check(err, ErrorMatches, `snap "other-snap" is not installed`)
+	err = snapstate.UnholdRefresh(s.state, "other-snap")
+	c.Check(err, ErrorMatches, `snap "other-snap" is not installed`)
+
+	// all or nothing
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "some-snap", &snapst), IsNil)
+	c.Check(snapst.RefreshHold, IsNil)
+}
+
+func (s *autoRefreshTestSuite) TestHoldRefreshSystemWide(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	until := time.Now().Add(24 * time.Hour)
+	err := snapstate.HoldRefresh(s.state, until)
+	c.Assert(err, IsNil)
+
+	var holdTime time.Time
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Get("core", "refresh.hold", &holdTime), IsNil)
+	c.Check(holdTime.Equal(until), Equals, true)
+
+	// forever is capped
+	err = snapstate.HoldRefresh(s.state, time.Time{})
+	c.Assert(err, IsNil)
+	tr = config.NewTransaction(s.state)
+	c.Assert(tr.Get("core", "refresh.hold", &holdTime), IsNil)
+	c.Check(holdTime.After(time.Now().Add(59*24*time.Hour)), Equals, true)
+
+	err = snapstate.UnholdRefresh(s.state)
+	c.Assert(err, IsNil)
+	tr = config.NewTransaction(s.state)
+	c.Check(config.IsNoOption(tr.Get("core", "refresh.hold", &holdTime)), Equals, true)
+}
@@ -49,6 +49,7 @@ type StoreService interface {
 	DownloadStream(context.Context, string, *snap.DownloadInfo, *auth.UserState) (io.ReadCloser, error)
 
 	Assertion(assertType *asserts.AssertionType, primaryKey []string, user *auth.UserState) (asserts.Assertion, error)
+	SeqFormingAssertion(assertType *asserts.AssertionType, sequenceKey []string, sequence int, user *auth.UserState) (asserts.Assertion, error)
 
 	SuggestedCurrency() string
 	Buy(options *client.BuyOptions, user *auth.UserState) (*client.BuyResult, error)
@@ -64,9 +65,10 @@ type managerBackend interface {
 	// install related
 	SetupSnap(snapFilePath, instanceName string, si *snap.SideInfo, meter progress.Meter) (snap.Type, error)
 	CopySnapData(newSnap, oldSnap *snap.Info, meter progress.Meter) error
-	LinkSnap(info *snap.Info, model *asserts.Model, tm timings.Measurer) error
-	StartServices(svcs []*snap.AppInfo, meter progress.Meter, tm timings.Measurer) error
+	LinkSnap(info *snap.Info, model *asserts.Model, linkCtx backend.LinkContext, tm timings.Measurer) error
+	StartServices(svcs []*snap.AppInfo, disabledSvcs []string, meter progress.Meter, tm timings.Measurer) error
 	StopServices(svcs []*snap.AppInfo, reason snap.ServiceStopReason, meter progress.Meter, tm timings.Measurer) error
+	ServicesEnableState(info *snap.Info, meter progress.Meter) (map[string]bool, error)
 
 	// the undoers for install
 	UndoSetupSnap(s snap.PlaceInfo, typ snap.Type, meter progress.Meter) error
@@ -79,14 +79,21 @@ func hasFontConfigCache(info *snap.Info) bool {
 }
 
 // LinkSnap makes the snap available by generating wrappers and setting the current symlinks.
-func (b Backend) LinkSnap(info *snap.Info, model *asserts.Model, tm timings.Measurer) (e error) {
+// LinkContext carries additional information about the current snap link
+// operation.
+type LinkContext struct {
+	// ServiceOptions is used to configure the services of the snap.
+	ServiceOptions *wrappers.AddSnapServicesOptions
+}
+
+func (b Backend) LinkSnap(info *snap.Info, model *asserts.Model, linkCtx LinkContext, tm timings.Measurer) (e error) {
 	if info.Revision.Unset() {
 		return fmt.Errorf("cannot link snap %q with unset revision", info.InstanceName())
 	}
 
 	var err error
 	timings.Run(tm, "generate-wrappers", fmt.Sprintf("generate wrappers for snap %s", info.InstanceName()), func(timings.Measurer) {
-		err = generateWrappers(info)
+		err = generateWrappers(info, linkCtx)
 	})
 	if err != nil {
 		return err
@@ -135,15 +142,19 @@ func (b Backend) LinkSnap(info *snap.Info, model *asserts.Model, tm timings.Meas
 	return nil
 }
 
-func (b Backend) StartServices(apps []*snap.AppInfo, meter progress.Meter, tm timings.Measurer) error {
-	return wrappers.StartServices(apps, meter, tm)
+func (b Backend) StartServices(apps []*snap.AppInfo, disabledSvcs []string, meter progress.Meter, tm timings.Measurer) error {
+	return wrappers.StartServices(apps, disabledSvcs, meter, tm)
+}
+
+func (b Backend) ServicesEnableState(info *snap.Info, meter progress.Meter) (map[string]bool, error) {
+	return wrappers.ServicesEnableState(info, meter)
 }
 
 func (b Backend) StopServices(apps []*snap.AppInfo, reason snap.ServiceStopReason, meter progress.Meter, tm timings.Measurer) error {
 	return wrappers.StopServices(apps, reason, meter, tm)
 }
 
-func generateWrappers(s *snap.Info) (err error) {
+func generateWrappers(s *snap.Info, linkCtx LinkContext) (err error) {
 	var cleanupFuncs []func(*snap.Info) error
 	defer func() {
 		if err != nil {
@@ -160,13 +171,19 @@ func generateWrappers(s *snap.Info) (err error) {
 	cleanupFuncs = append(cleanupFuncs, wrappers.RemoveSnapBinaries)
 
 	// add the daemons from the snap.yaml
-	if err = wrappers.AddSnapServices(s, progress.Null); err != nil {
+	if err = wrappers.AddSnapServices(s, linkCtx.ServiceOptions, progress.Null); err != nil {
 		return err
 	}
 	cleanupFuncs = append(cleanupFuncs, func(s *snap.Info) error {
 		return wrappers.RemoveSnapServices(s, progress.Null)
 	})
 
+	// add D-Bus service activation files
+	if err = wrappers.AddSnapDBusActivationFiles(s); err != nil {
+		return err
+	}
+	cleanupFuncs = append(cleanupFuncs, wrappers.RemoveSnapDBusActivationFiles)
+
 	// add the desktop files
 	if err = wrappers.AddSnapDesktopFiles(s); err != nil {
 		return err
@@ -193,17 +210,22 @@ func removeGeneratedWrappers(s *snap.Info, meter progress.Meter) error {
 		logger.Noticef("Cannot remove services for %q: %v", s.InstanceName(), err2)
 	}
 
-	err3 := wrappers.RemoveSnapDesktopFiles(s)
+	err3 := wrappers.RemoveSnapDBusActivationFiles(s)
 	if err3 != nil {
-		logger.Noticef("Cannot remove desktop files for %q: %v", s.InstanceName(), err3)
+		logger.Noticef("Cannot remove D-Bus activation for %q: %v", s.InstanceName(), err3)
 	}
 
-	err4 := wrappers.RemoveSnapIcons(s)
+	err4 := wrappers.RemoveSnapDesktopFiles(s)
 	if err4 != nil {
-		logger.Noticef("Cannot remove desktop icons for %q: %v", s.InstanceName(), err4)
+		logger.Noticef("Cannot remove desktop files for %q: %v", s.InstanceName(), err4)
+	}
+
+	err5 := wrappers.RemoveSnapIcons(s)
+	if err5 != nil {
+		logger.Noticef("Cannot remove desktop icons for %q: %v", s.InstanceName(), err5)
 	}
 
-	return firstErr(err1, err2, err3, err4)
+	return firstErr(err1, err2, err3, err4, err5)
 }
 
 // UnlinkSnap makes the snap unavailable to the system removing wrappers and symlinks.
@@ -39,6 +39,7 @@ import (
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/store"
 	"github.com/snapcore/snapd/store/storetest"
+	"github.com/snapcore/snapd/strutil"
 	"github.com/snapcore/snapd/timings"
 )
 
@@ -64,7 +65,8 @@ type fakeOp struct {
 
 	otherInstances bool
 
-	services []string
+	services         []string
+	disabledServices []string
 }
 
 type fakeOps []fakeOp
@@ -605,6 +607,9 @@ type fakeSnappyBackend struct {
 	linkSnapFailTrigger     string
 	copySnapDataFailTrigger string
 	emptyContainer          snap.Container
+
+	// servicesDisabled are the services reported as disabled
+	servicesDisabled []string
 }
 
 func (f *fakeSnappyBackend) OpenSnapFile(snapFilePath string, si *snap.SideInfo) (*snap.Info, snap.Container, error) {
@@ -728,6 +733,20 @@ apps:
   svc3:
     daemon: simple
     before: [svc2]
+`))
+		if err != nil {
+			panic(err)
+		}
+		info.SideInfo = *si
+	case "install-mode-snap":
+		var err error
+		info, err = snap.InfoFromSnapYaml([]byte(`name: install-mode-snap
+apps:
+  svc1:
+    daemon: simple
+  svc2:
+    daemon: simple
+    install-mode: disable
 `))
 		if err != nil {
 			panic(err)
@@ -793,7 +812,7 @@ func (f *fakeSnappyBackend) CopySnapData(newInfo, oldInfo *snap.Info, p progress
 	return nil
 }
 
-func (f *fakeSnappyBackend) LinkSnap(info *snap.Info, model *asserts.Model, tm timings.Measurer) error {
+func (f *fakeSnappyBackend) LinkSnap(info *snap.Info, model *asserts.Model, linkCtx backend.LinkContext, tm timings.Measurer) error {
 	if info.MountDir() == f.linkSnapWaitTrigger {
 		f.linkSnapWaitCh <- 1
 		<-f.linkSnapWaitCh
@@ -807,10 +826,14 @@ func (f *fakeSnappyBackend) LinkSnap(info *snap.Info, model *asserts.Model, tm t
 		return errors.New("fail")
 	}
 
-	f.appendOp(&fakeOp{
+	op := &fakeOp{
 		op:   "link-snap",
 		path: info.MountDir(),
-	})
+	}
+	if linkCtx.ServiceOptions != nil {
+		op.disabledServices = linkCtx.ServiceOptions.DisabledServices
+	}
+	f.appendOp(op)
 	return nil
 }
 
@@ -824,19 +847,28 @@ func svcSnapMountDir(svcs []*snap.AppInfo) string {
 	return svcs[0].Snap.MountDir()
 }
 
-func (f *fakeSnappyBackend) StartServices(svcs []*snap.AppInfo, meter progress.Meter, tm timings.Measurer) error {
+func (f *fakeSnappyBackend) StartServices(svcs []*snap.AppInfo, disabledSvcs []string, meter progress.Meter, tm timings.Measurer) error {
 	services := make([]string, 0, len(svcs))
 	for _, svc := range svcs {
 		services = append(services, svc.Name)
 	}
 	f.appendOp(&fakeOp{
-		op:       "start-snap-services",
-		path:     svcSnapMountDir(svcs),
-		services: services,
+		op:               "start-snap-services",
+		path:             svcSnapMountDir(svcs),
+		services:         services,
+		disabledServices: disabledSvcs,
 	})
 	return nil
 }
 
+func (f *fakeSnappyBackend) ServicesEnableState(info *snap.Info, meter progress.Meter) (map[string]bool, error) {
+	state := make(map[string]bool)
+	for _, app := range info.Services() {
+		state[app.Name] = !strutil.ListContains(f.servicesDisabled, app.Name)
+	}
+	return state, nil
+}
+
 func (f *fakeSnappyBackend) StopServices(svcs []*snap.AppInfo, reason snap.ServiceStopReason, meter progress.Meter, tm timings.Measurer) error {
 	f.appendOp(&fakeOp{
 		op:   fmt.Sprintf("stop-snap-services:%s", reason),
@@ -207,3 +207,23 @@ var (
 )
 
 type AuxStoreInfo = auxStoreInfo
+
+// refresh gating related
+var (
+	LaunchGatedAutoRefresh = launchGatedAutoRefresh
+	GatingSnaps            = gatingSnaps
+)
+
+func MockConditionalAutoRefreshUpdateMany(f func(context.Context, *state.State, []string, int, UpdateFilter, *Flags, string) ([]string, []*state.TaskSet, error)) (restore func()) {
+	old := conditionalAutoRefreshUpdateMany
+	conditionalAutoRefreshUpdateMany = f
+	return func() {
+		conditionalAutoRefreshUpdateMany = old
+	}
+}
+
+// validation sets related
+var (
+	CheckValidationSetsForInstall = checkValidationSetsForInstall
+	CheckValidationSetsForRemove  = checkValidationSetsForRemove
+)
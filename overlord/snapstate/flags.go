@@ -68,6 +68,10 @@ type Flags struct {
 
 	// RequireTypeBase is set to mark that a snap needs to be of type: base, otherwise installation fails.
 	RequireTypeBase bool `json:"require-base-type,omitempty"`
+
+	// NoStart is set to request that the services of the snap are
+	// not started after installing it.
+	NoStart bool `json:"no-start,omitempty"`
 }
 
 // DevModeAllowed returns whether a snap can be installed with devmode confinement (either set or overridden)
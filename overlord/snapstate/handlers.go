@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -47,6 +48,7 @@ import (
 	"github.com/snapcore/snapd/store"
 	"github.com/snapcore/snapd/strutil"
 	"github.com/snapcore/snapd/timings"
+	"github.com/snapcore/snapd/wrappers"
 )
 
 // TaskSnapSetup returns the SnapSetup with task params hold by or referred to by the task.
@@ -77,6 +79,31 @@ func TaskSnapSetup(t *state.Task) (*SnapSetup, error) {
 	return &snapsup, nil
 }
 
+// linkContext returns the context for linking the snap, the services
+// listed in disabledSvcs are not enabled.
+func linkContext(st *state.State, instanceName string, disabledSvcs []string) (backend.LinkContext, error) {
+	var linkCtx backend.LinkContext
+	var opts *wrappers.AddSnapServicesOptions
+	if SnapServiceOptions != nil {
+		var err error
+		opts, err = SnapServiceOptions(st, instanceName)
+		if err != nil {
+			return linkCtx, err
+		}
+	}
+	if len(disabledSvcs) > 0 {
+		if opts == nil {
+			opts = &wrappers.AddSnapServicesOptions{}
+		} else {
+			optsCopy := *opts
+			opts = &optsCopy
+		}
+		opts.DisabledServices = disabledSvcs
+	}
+	linkCtx.ServiceOptions = opts
+	return linkCtx, nil
+}
+
 func snapSetupAndState(t *state.Task) (*SnapSetup, *SnapState, error) {
 	snapsup, err := TaskSnapSetup(t)
 	if err != nil {
@@ -807,8 +834,13 @@ func (m *SnapManager) undoUnlinkCurrentSnap(t *state.Task, _ *tomb.Tomb) error {
 		return err
 	}
 
+	linkCtx, err := linkContext(st, snapsup.InstanceName(), snapst.LastActiveDisabledServices)
+	if err != nil {
+		return err
+	}
+
 	snapst.Active = true
-	err = m.backend.LinkSnap(oldInfo, model, perfTimings)
+	err = m.backend.LinkSnap(oldInfo, model, linkCtx, perfTimings)
 	if err != nil {
 		return err
 	}
@@ -1040,9 +1072,34 @@ func (m *SnapManager) doLinkSnap(t *state.Task, _ *tomb.Tomb) (err error) {
 	// record type
 	snapst.SetType(newInfo.GetType())
 
+	oldLastActiveDisabledServices := snapst.LastActiveDisabledServices
+	if !isInstalled {
+		// services with install-mode: disable are not enabled when
+		// the snap is first installed
+		for _, app := range newInfo.Services() {
+			if app.InstallMode == "disable" && !strutil.ListContains(snapst.LastActiveDisabledServices, app.Name) {
+				snapst.LastActiveDisabledServices = append(snapst.LastActiveDisabledServices, app.Name)
+			}
+		}
+	}
+
+	disabledSvcs := snapst.LastActiveDisabledServices
+	if snapsup.NoStart {
+		// the services are neither started nor enabled
+		disabledSvcs = nil
+		for _, app := range newInfo.Services() {
+			disabledSvcs = append(disabledSvcs, app.Name)
+		}
+		sort.Strings(disabledSvcs)
+	}
+
 	// XXX: this block is slightly ugly, find a pattern when we have more examples
 	model, _ := ModelFromTask(t)
-	err = m.backend.LinkSnap(newInfo, model, perfTimings)
+	linkCtx, err := linkContext(st, snapsup.InstanceName(), disabledSvcs)
+	if err != nil {
+		return err
+	}
+	err = m.backend.LinkSnap(newInfo, model, linkCtx, perfTimings)
 	if err != nil {
 		pb := NewTaskProgressAdapterLocked(t)
 		err := m.backend.UnlinkSnap(newInfo, pb)
@@ -1085,6 +1142,7 @@ func (m *SnapManager) doLinkSnap(t *state.Task, _ *tomb.Tomb) (err error) {
 	t.Set("old-candidate-index", oldCandidateIndex)
 	t.Set("old-refresh-inhibited-time", oldRefreshInhibitedTime)
 	t.Set("old-cohort-key", oldCohortKey)
+	t.Set("old-last-active-disabled-services", oldLastActiveDisabledServices)
 
 	// Record the fact that the snap was refreshed successfully.
 	snapst.RefreshInhibitedTime = nil
@@ -1266,6 +1324,10 @@ func (m *SnapManager) undoLinkSnap(t *state.Task, _ *tomb.Tomb) error {
 	if err := t.Get("old-cohort-key", &oldCohortKey); err != nil && err != state.ErrNoState {
 		return err
 	}
+	var oldLastActiveDisabledServices []string
+	if err := t.Get("old-last-active-disabled-services", &oldLastActiveDisabledServices); err != nil && err != state.ErrNoState {
+		return err
+	}
 
 	if len(snapst.Sequence) == 1 {
 		// XXX: shouldn't these two just log and carry on? this is an undo handler...
@@ -1300,6 +1362,7 @@ func (m *SnapManager) undoLinkSnap(t *state.Task, _ *tomb.Tomb) error {
 		copy(snapst.Sequence[oldCandidateIndex+1:], snapst.Sequence[oldCandidateIndex:])
 		snapst.Sequence[oldCandidateIndex] = oldCand
 	}
+	snapst.LastActiveDisabledServices = oldLastActiveDisabledServices
 	snapst.Current = oldCurrent
 	snapst.Active = false
 	snapst.Channel = oldChannel
@@ -1417,11 +1480,16 @@ func (m *SnapManager) startSnapServices(t *state.Task, _ *tomb.Tomb) error {
 	perfTimings := timings.NewForTask(t)
 	defer perfTimings.Save(st)
 
-	_, snapst, err := snapSetupAndState(t)
+	snapsup, snapst, err := snapSetupAndState(t)
 	if err != nil {
 		return err
 	}
 
+	if snapsup.NoStart {
+		t.Logf("Not starting services as requested.")
+		return nil
+	}
+
 	currentInfo, err := snapst.CurrentInfo()
 	if err != nil {
 		return err
@@ -1438,9 +1506,23 @@ func (m *SnapManager) startSnapServices(t *state.Task, _ *tomb.Tomb) error {
 
 	pb := NewTaskProgressAdapterUnlocked(t)
 	st.Unlock()
-	err = m.backend.StartServices(startupOrdered, pb, perfTimings)
-	st.Lock()
-	return err
+	defer st.Lock()
+
+	var disabledSvcs []string
+	if len(snapst.LastActiveDisabledServices) > 0 {
+		// services explicitly enabled meanwhile, e.g. by the install
+		// hook, are started too
+		enabled, err := m.backend.ServicesEnableState(currentInfo, pb)
+		if err != nil {
+			return err
+		}
+		for _, name := range snapst.LastActiveDisabledServices {
+			if !enabled[name] {
+				disabledSvcs = append(disabledSvcs, name)
+			}
+		}
+	}
+	return m.backend.StartServices(startupOrdered, disabledSvcs, pb, perfTimings)
 }
 
 func (m *SnapManager) stopSnapServices(t *state.Task, _ *tomb.Tomb) error {
@@ -1451,7 +1533,7 @@ func (m *SnapManager) stopSnapServices(t *state.Task, _ *tomb.Tomb) error {
 	perfTimings := timings.NewForTask(t)
 	defer perfTimings.Save(st)
 
-	_, snapst, err := snapSetupAndState(t)
+	snapsup, snapst, err := snapSetupAndState(t)
 	if err != nil {
 		return err
 	}
@@ -1472,9 +1554,39 @@ func (m *SnapManager) stopSnapServices(t *state.Task, _ *tomb.Tomb) error {
 
 	pb := NewTaskProgressAdapterUnlocked(t)
 	st.Unlock()
-	err = m.backend.StopServices(svcs, stopReason, pb, perfTimings)
+	var enabled map[string]bool
+	if stopReason != snap.StopReasonRemove {
+		// remember the disabled services so that they are kept
+		// disabled by the next revision of the snap
+		enabled, err = m.backend.ServicesEnableState(currentInfo, pb)
+	}
+	if err == nil {
+		err = m.backend.StopServices(svcs, stopReason, pb, perfTimings)
+	}
 	st.Lock()
-	return err
+	if err != nil {
+		return err
+	}
+
+	if enabled != nil {
+		var disabled []string
+		for _, name := range snapst.LastActiveDisabledServices {
+			// keep the disabled services the current revision does
+			// not have, a later one might
+			if _, ok := enabled[name]; !ok {
+				disabled = append(disabled, name)
+			}
+		}
+		for name, isEnabled := range enabled {
+			if !isEnabled {
+				disabled = append(disabled, name)
+			}
+		}
+		sort.Strings(disabled)
+		snapst.LastActiveDisabledServices = disabled
+		Set(st, snapsup.InstanceName(), snapst)
+	}
+	return nil
 }
 
 func (m *SnapManager) doUnlinkSnap(t *state.Task, _ *tomb.Tomb) error {
@@ -1591,6 +1703,16 @@ func (m *SnapManager) doDiscardSnap(t *state.Task, _ *tomb.Tomb) error {
 		return &state.Retry{After: 3 * time.Minute}
 	}
 	if len(snapst.Sequence) == 0 {
+		if EnsureSnapAbsentFromQuotaGroup != nil {
+			if err := EnsureSnapAbsentFromQuotaGroup(st, snapsup.InstanceName()); err != nil {
+				return err
+			}
+		}
+		if RemoveSnapJournal != nil {
+			if err := RemoveSnapJournal(snapsup.InstanceName()); err != nil {
+				return err
+			}
+		}
 		// Remove configuration associated with this snap.
 		err = config.DeleteSnapConfig(st, snapsup.InstanceName())
 		if err != nil {
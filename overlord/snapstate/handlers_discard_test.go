@@ -98,6 +98,59 @@ func (s *discardSnapSuite) TestDoDiscardSnapToEmpty(c *C) {
 	c.Assert(err, Equals, state.ErrNoState)
 }
 
+func (s *discardSnapSuite) TestDoDiscardSnapToEmptyDropsQuotaGroupAndJournal(c *C) {
+	var dropped, removedJournals []string
+	old := snapstate.EnsureSnapAbsentFromQuotaGroup
+	snapstate.EnsureSnapAbsentFromQuotaGroup = func(st *state.State, instanceName string) error {
+		dropped = append(dropped, instanceName)
+		return nil
+	}
+	defer func() { snapstate.EnsureSnapAbsentFromQuotaGroup = old }()
+	oldRemoveSnapJournal := snapstate.RemoveSnapJournal
+	snapstate.RemoveSnapJournal = func(instanceName string) error {
+		removedJournals = append(removedJournals, instanceName)
+		return nil
+	}
+	defer func() { snapstate.RemoveSnapJournal = oldRemoveSnapJournal }()
+
+	s.state.Lock()
+	snapstate.Set(s.state, "foo", &snapstate.SnapState{
+		Sequence: []*snap.SideInfo{
+			{RealName: "foo", Revision: snap.R(3)},
+			{RealName: "foo", Revision: snap.R(33)},
+		},
+		Current:  snap.R(33),
+		SnapType: "app",
+	})
+	chg := s.state.NewChange("dummy", "...")
+	for _, rev := range []snap.Revision{snap.R(3), snap.R(33)} {
+		t := s.state.NewTask("discard-snap", "test")
+		t.Set("snap-setup", &snapstate.SnapSetup{
+			SideInfo: &snap.SideInfo{
+				RealName: "foo",
+				Revision: rev,
+			},
+		})
+		if tasks := chg.Tasks(); len(tasks) > 0 {
+			t.WaitFor(tasks[0])
+		}
+		chg.AddTask(t)
+	}
+	s.state.Unlock()
+
+	for i := 0; i < 2; i++ {
+		s.se.Ensure()
+		s.se.Wait()
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Assert(chg.Err(), IsNil)
+	// only once the last revision is gone
+	c.Check(dropped, DeepEquals, []string{"foo"})
+	c.Check(removedJournals, DeepEquals, []string{"foo"})
+}
+
 func (s *discardSnapSuite) TestDoDiscardSnapErrorsForActive(c *C) {
 	s.state.Lock()
 	snapstate.Set(s.state, "foo", &snapstate.SnapState{
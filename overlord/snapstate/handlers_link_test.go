@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"strings"
 	"time"
 
 	. "gopkg.in/check.v1"
@@ -935,6 +936,179 @@ func (s *linkSnapSuite) TestDoUndoLinkSnapRestoresRefreshInhibitedTime(c *C) {
 	c.Check(snapst.RefreshInhibitedTime.Equal(instant), Equals, true)
 }
 
+func (s *linkSnapSuite) TestDoLinkSnapInstallModeDisable(c *C) {
+	s.state.Lock()
+	t := s.state.NewTask("link-snap", "test")
+	t.Set("snap-setup", &snapstate.SnapSetup{
+		SideInfo: &snap.SideInfo{
+			RealName: "install-mode-snap",
+			Revision: snap.R(1),
+		},
+	})
+	s.state.NewChange("dummy", "...").AddTask(t)
+	s.state.Unlock()
+
+	s.se.Ensure()
+	s.se.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(t.Status(), Equals, state.DoneStatus)
+
+	var snapst snapstate.SnapState
+	err := snapstate.Get(s.state, "install-mode-snap", &snapst)
+	c.Assert(err, IsNil)
+	c.Check(snapst.LastActiveDisabledServices, DeepEquals, []string{"svc2"})
+
+	c.Assert(s.fakeBackend.ops, HasLen, 2)
+	c.Check(s.fakeBackend.ops[1].op, Equals, "link-snap")
+	c.Check(s.fakeBackend.ops[1].disabledServices, DeepEquals, []string{"svc2"})
+}
+
+func (s *linkSnapSuite) TestDoLinkSnapNoStartKeepsServicesDisabled(c *C) {
+	s.state.Lock()
+	t := s.state.NewTask("link-snap", "test")
+	t.Set("snap-setup", &snapstate.SnapSetup{
+		SideInfo: &snap.SideInfo{
+			RealName: "install-mode-snap",
+			Revision: snap.R(1),
+		},
+		Flags: snapstate.Flags{NoStart: true},
+	})
+	s.state.NewChange("dummy", "...").AddTask(t)
+	s.state.Unlock()
+
+	s.se.Ensure()
+	s.se.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(t.Status(), Equals, state.DoneStatus)
+
+	c.Assert(s.fakeBackend.ops, HasLen, 2)
+	c.Check(s.fakeBackend.ops[1].op, Equals, "link-snap")
+	c.Check(s.fakeBackend.ops[1].disabledServices, DeepEquals, []string{"svc1", "svc2"})
+}
+
+func (s *linkSnapSuite) TestDoLinkSnapRefreshKeepsDisabledServices(c *C) {
+	s.state.Lock()
+	si1 := &snap.SideInfo{RealName: "install-mode-snap", Revision: snap.R(1)}
+	si2 := &snap.SideInfo{RealName: "install-mode-snap", Revision: snap.R(2)}
+	snapstate.Set(s.state, "install-mode-snap", &snapstate.SnapState{
+		Sequence: []*snap.SideInfo{si1},
+		Current:  si1.Revision,
+		// svc2 was enabled by the user after the install
+		LastActiveDisabledServices: []string{"svc1"},
+	})
+	t := s.state.NewTask("link-snap", "test")
+	t.Set("snap-setup", &snapstate.SnapSetup{SideInfo: si2})
+	s.state.NewChange("dummy", "...").AddTask(t)
+	s.state.Unlock()
+
+	s.se.Ensure()
+	s.se.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(t.Status(), Equals, state.DoneStatus)
+
+	var snapst snapstate.SnapState
+	err := snapstate.Get(s.state, "install-mode-snap", &snapst)
+	c.Assert(err, IsNil)
+	c.Check(snapst.LastActiveDisabledServices, DeepEquals, []string{"svc1"})
+
+	c.Assert(s.fakeBackend.ops, HasLen, 2)
+	c.Check(s.fakeBackend.ops[1].op, Equals, "link-snap")
+	c.Check(s.fakeBackend.ops[1].disabledServices, DeepEquals, []string{"svc1"})
+}
+
+func (s *linkSnapSuite) TestDoStopSnapServicesRecordsDisabledServices(c *C) {
+	s.fakeBackend.servicesDisabled = []string{"svc1"}
+
+	s.state.Lock()
+	si := &snap.SideInfo{RealName: "install-mode-snap", Revision: snap.R(1)}
+	snapstate.Set(s.state, "install-mode-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+		// svc3 is not known to the current revision
+		LastActiveDisabledServices: []string{"svc2", "svc3"},
+	})
+	t := s.state.NewTask("stop-snap-services", "test")
+	t.Set("snap-setup", &snapstate.SnapSetup{SideInfo: si})
+	t.Set("stop-reason", snap.StopReasonRefresh)
+	s.state.NewChange("dummy", "...").AddTask(t)
+	s.state.Unlock()
+
+	s.se.Ensure()
+	s.se.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(t.Status(), Equals, state.DoneStatus)
+
+	var snapst snapstate.SnapState
+	err := snapstate.Get(s.state, "install-mode-snap", &snapst)
+	c.Assert(err, IsNil)
+	c.Check(snapst.LastActiveDisabledServices, DeepEquals, []string{"svc1", "svc3"})
+}
+
+func (s *linkSnapSuite) TestDoStartSnapServicesDisabled(c *C) {
+	s.fakeBackend.servicesDisabled = []string{"svc2"}
+
+	s.state.Lock()
+	si := &snap.SideInfo{RealName: "install-mode-snap", Revision: snap.R(1)}
+	snapstate.Set(s.state, "install-mode-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+		// svc1 was enabled meanwhile, e.g. by a hook
+		LastActiveDisabledServices: []string{"svc1", "svc2"},
+	})
+	t := s.state.NewTask("start-snap-services", "test")
+	t.Set("snap-setup", &snapstate.SnapSetup{SideInfo: si})
+	s.state.NewChange("dummy", "...").AddTask(t)
+	s.state.Unlock()
+
+	s.se.Ensure()
+	s.se.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(t.Status(), Equals, state.DoneStatus)
+
+	c.Assert(s.fakeBackend.ops, HasLen, 1)
+	c.Check(s.fakeBackend.ops[0].op, Equals, "start-snap-services")
+	c.Check(s.fakeBackend.ops[0].services, HasLen, 2)
+	c.Check(s.fakeBackend.ops[0].disabledServices, DeepEquals, []string{"svc2"})
+}
+
+func (s *linkSnapSuite) TestDoStartSnapServicesNoStart(c *C) {
+	s.state.Lock()
+	si := &snap.SideInfo{RealName: "install-mode-snap", Revision: snap.R(1)}
+	snapstate.Set(s.state, "install-mode-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+	})
+	t := s.state.NewTask("start-snap-services", "test")
+	t.Set("snap-setup", &snapstate.SnapSetup{
+		SideInfo: si,
+		Flags:    snapstate.Flags{NoStart: true},
+	})
+	s.state.NewChange("dummy", "...").AddTask(t)
+	s.state.Unlock()
+
+	s.se.Ensure()
+	s.se.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(t.Status(), Equals, state.DoneStatus)
+	c.Check(s.fakeBackend.ops, HasLen, 0)
+	c.Check(strings.Join(t.Log(), ""), Matches, `.*Not starting services as requested\.`)
+}
+
 func (s *linkSnapSuite) TestDoUnlinkSnapRefreshAwarenessHardCheck(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -153,6 +153,26 @@ type SnapState struct {
 	// attempted but inhibited because the snap was busy. This value is
 	// reset on each successful refresh.
 	RefreshInhibitedTime *time.Time `json:"refresh-inhibited-time,omitempty"`
+
+	// RefreshHold is set when automatic refreshes of the snap are
+	// held, to the time until which they are held; the zero time
+	// means they are held indefinitely.
+	RefreshHold *time.Time `json:"refresh-hold,omitempty"`
+
+	// LastActiveDisabledServices are the services of the snap that were
+	// disabled when its current revision was last active, or that are
+	// disabled by their install-mode on first install. They are kept
+	// disabled by new revisions of the snap.
+	LastActiveDisabledServices []string `json:"last-active-disabled-services,omitempty"`
+}
+
+// RefreshHeld returns whether automatic refreshes of the snap are held
+// at the given time.
+func (snapst *SnapState) RefreshHeld(now time.Time) bool {
+	if snapst.RefreshHold == nil {
+		return false
+	}
+	return snapst.RefreshHold.IsZero() || snapst.RefreshHold.After(now)
 }
 
 // Type returns the type of the snap or an error.
@@ -391,6 +411,7 @@ func Manager(st *state.State, runner *state.TaskRunner) (*SnapManager, error) {
 	runner.AddHandler("switch-snap-channel", m.doSwitchSnapChannel, nil)
 	runner.AddHandler("toggle-snap-flags", m.doToggleSnapFlags, nil)
 	runner.AddHandler("check-rerefresh", m.doCheckReRefresh, nil)
+	runner.AddHandler("conditional-auto-refresh", m.doConditionalAutoRefresh, nil)
 
 	// FIXME: drop the task entirely after a while
 	// (having this wart here avoids yet-another-patch)
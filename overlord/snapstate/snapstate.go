@@ -48,6 +48,7 @@ import (
 	"github.com/snapcore/snapd/snap/channel"
 	"github.com/snapcore/snapd/store"
 	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/wrappers"
 )
 
 // control flags for doInstall
@@ -398,6 +399,18 @@ var CheckHealthHook = func(st *state.State, snapName string, rev snap.Revision)
 	panic("internal error: snapstate.CheckHealthHook is unset")
 }
 
+// SnapServiceOptions allows to hook getting the options for generating
+// the services of the given snap, like the quota group it belongs to.
+var SnapServiceOptions func(st *state.State, instanceName string) (*wrappers.AddSnapServicesOptions, error)
+
+// EnsureSnapAbsentFromQuotaGroup allows to hook dropping a snap that is
+// being removed from the quota group it belongs to.
+var EnsureSnapAbsentFromQuotaGroup func(st *state.State, instanceName string) error
+
+// RemoveSnapJournal allows to hook removing the journal configuration of
+// a snap that is being removed.
+var RemoveSnapJournal func(instanceName string) error
+
 // WaitRestart will return a Retry error if there is a pending restart
 // and a real error if anything went wrong (like a rollback across
 // restarts)
@@ -558,6 +571,9 @@ func checkInstallPreconditions(st *state.State, info *snap.Info, flags Flags, sn
 	if err := validateFeatureFlags(st, info); err != nil {
 		return err
 	}
+	if err := checkValidationSetsForInstall(st, info); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -1549,7 +1565,12 @@ func AutoRefresh(ctx context.Context, st *state.State) ([]string, []*state.TaskS
 		}
 	}
 
-	return UpdateMany(ctx, st, nil, userID, &Flags{IsAutoRefresh: true})
+	filter, err := autoRefreshFilter(st)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return updateManyFiltered(ctx, st, nil, userID, filter, &Flags{IsAutoRefresh: true}, "")
 }
 
 // Enable sets a snap to the active state
@@ -1851,6 +1872,11 @@ func Remove(st *state.State, name string, revision snap.Revision, flags *RemoveF
 	if !canRemove(st, info, &snapst, removeAll, deviceCtx) {
 		return nil, fmt.Errorf("snap %q is not removable", name)
 	}
+	if removeAll {
+		if err := checkValidationSetsForRemove(st, name, info.SnapID); err != nil {
+			return nil, err
+		}
+	}
 
 	// main/current SnapSetup
 	snapsup := SnapSetup{
@@ -2049,6 +2075,9 @@ func RevertToRevision(st *state.State, name string, rev snap.Revision, flags Fla
 	if err != nil {
 		return nil, err
 	}
+	if err := checkValidationSetsForInstall(st, info); err != nil {
+		return nil, err
+	}
 
 	snapsup := &SnapSetup{
 		SideInfo:    snapst.Sequence[i],
@@ -111,10 +111,12 @@ func (s *snapmgrTestSuite) SetUpTest(c *C) {
 	oldSetupPreRefreshHook := snapstate.SetupPreRefreshHook
 	oldSetupPostRefreshHook := snapstate.SetupPostRefreshHook
 	oldSetupRemoveHook := snapstate.SetupRemoveHook
+	oldSetupGateAutoRefreshHook := snapstate.SetupGateAutoRefreshHook
 	snapstate.SetupInstallHook = hookstate.SetupInstallHook
 	snapstate.SetupPreRefreshHook = hookstate.SetupPreRefreshHook
 	snapstate.SetupPostRefreshHook = hookstate.SetupPostRefreshHook
 	snapstate.SetupRemoveHook = hookstate.SetupRemoveHook
+	snapstate.SetupGateAutoRefreshHook = hookstate.SetupGateAutoRefreshHook
 
 	var err error
 	s.snapmgr, err = snapstate.Manager(s.state, s.o.TaskRunner())
@@ -145,6 +147,7 @@ func (s *snapmgrTestSuite) SetUpTest(c *C) {
 		snapstate.SetupPreRefreshHook = oldSetupPreRefreshHook
 		snapstate.SetupPostRefreshHook = oldSetupPostRefreshHook
 		snapstate.SetupRemoveHook = oldSetupRemoveHook
+		snapstate.SetupGateAutoRefreshHook = oldSetupGateAutoRefreshHook
 
 		dirs.SetRootDir("/")
 	})
@@ -1079,6 +1082,33 @@ func (s *snapmgrTestSuite) TestUpdateMany(c *C) {
 	checkIsAutoRefresh(c, ts.Tasks(), false)
 }
 
+func (s *snapmgrTestSuite) TestAutoRefreshSkipsHeld(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	for _, name := range []string{"producer", "consumer"} {
+		snapstate.Set(s.state, name, &snapstate.SnapState{
+			Active: true,
+			Sequence: []*snap.SideInfo{
+				{RealName: name, SnapID: name + "-id", Revision: snap.R(1)},
+			},
+			Current:  snap.R(1),
+			SnapType: "app",
+		})
+	}
+	c.Assert(snapstate.HoldRefresh(s.state, time.Time{}, "consumer"), IsNil)
+
+	updates, _, err := snapstate.AutoRefresh(context.Background(), s.state)
+	c.Assert(err, IsNil)
+	c.Check(updates, DeepEquals, []string{"producer"})
+
+	// manual refreshes are not affected
+	updates, _, err = snapstate.UpdateMany(context.Background(), s.state, nil, 0, nil)
+	c.Assert(err, IsNil)
+	sort.Strings(updates)
+	c.Check(updates, DeepEquals, []string{"consumer", "producer"})
+}
+
 func (s *snapmgrTestSuite) TestParallelInstanceUpdateMany(c *C) {
 	restore := release.MockOnClassic(false)
 	defer restore()
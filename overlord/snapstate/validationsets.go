@@ -0,0 +1,335 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/snap"
+)
+
+// ValidationSetMode is the mode in which a validation set is applied
+// to the system.
+type ValidationSetMode int
+
+const (
+	// Monitor mode only reports whether the installed snaps
+	// satisfy the validation set.
+	Monitor ValidationSetMode = iota
+	// Enforce mode refuses operations that would make the
+	// installed snaps not satisfy the validation set.
+	Enforce
+)
+
+func (m ValidationSetMode) String() string {
+	switch m {
+	case Monitor:
+		return "monitor"
+	case Enforce:
+		return "enforce"
+	}
+	return fmt.Sprintf("unknown(%d)", int(m))
+}
+
+// ValidationSetTracking holds the details about a validation set
+// applied to the system.
+type ValidationSetTracking struct {
+	AccountID string            `json:"account-id"`
+	Name      string            `json:"name"`
+	Mode      ValidationSetMode `json:"mode"`
+	// PinnedAt is the sequence point the validation set is pinned
+	// to, 0 if it follows the latest one.
+	PinnedAt int `json:"pinned-at,omitempty"`
+	// Current is the sequence point currently in use.
+	Current int `json:"current"`
+}
+
+// ValidationSetKey returns the key identifying the validation set of
+// the given account with the given name.
+func ValidationSetKey(accountID, name string) string {
+	return accountID + "/" + name
+}
+
+// ValidationSetSequenceKey returns the sequence key of the
+// validation-set assertions of the given account with the given name.
+func ValidationSetSequenceKey(accountID, name string) []string {
+	return []string{release.Series, accountID, name}
+}
+
+func validationSetsState(st *state.State) (map[string]*json.RawMessage, error) {
+	var vsets map[string]*json.RawMessage
+	err := st.Get("validation-sets", &vsets)
+	if err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+	if vsets == nil {
+		vsets = make(map[string]*json.RawMessage)
+	}
+	return vsets, nil
+}
+
+// GetValidationSet retrieves the tracking details of the validation set
+// of the given account with the given name. It returns
+// state.ErrNoState if the validation set is not applied.
+func GetValidationSet(st *state.State, accountID, name string, tr *ValidationSetTracking) error {
+	vsets, err := validationSetsState(st)
+	if err != nil {
+		return err
+	}
+	raw := vsets[ValidationSetKey(accountID, name)]
+	if raw == nil {
+		return state.ErrNoState
+	}
+	if err := json.Unmarshal([]byte(*raw), tr); err != nil {
+		return fmt.Errorf("cannot unmarshal validation set tracking state: %v", err)
+	}
+	return nil
+}
+
+// UpdateValidationSet sets or updates the tracking details of a
+// validation set.
+func UpdateValidationSet(st *state.State, tr *ValidationSetTracking) {
+	var vsets map[string]*json.RawMessage
+	err := st.Get("validation-sets", &vsets)
+	if err != nil && err != state.ErrNoState {
+		panic("internal error: cannot unmarshal validation sets state: " + err.Error())
+	}
+	if vsets == nil {
+		vsets = make(map[string]*json.RawMessage)
+	}
+	data, err := json.Marshal(tr)
+	if err != nil {
+		panic("internal error: cannot marshal validation set tracking state: " + err.Error())
+	}
+	raw := json.RawMessage(data)
+	vsets[ValidationSetKey(tr.AccountID, tr.Name)] = &raw
+	st.Set("validation-sets", vsets)
+}
+
+// ForgetValidationSet stops tracking the validation set of the given
+// account with the given name.
+func ForgetValidationSet(st *state.State, accountID, name string) error {
+	vsets, err := validationSetsState(st)
+	if err != nil {
+		return err
+	}
+	key := ValidationSetKey(accountID, name)
+	if vsets[key] == nil {
+		return state.ErrNoState
+	}
+	delete(vsets, key)
+	if len(vsets) == 0 {
+		st.Set("validation-sets", nil)
+		return nil
+	}
+	st.Set("validation-sets", vsets)
+	return nil
+}
+
+// ValidationSets returns the tracking details of all the validation
+// sets applied to the system, keyed by ValidationSetKey.
+func ValidationSets(st *state.State) (map[string]*ValidationSetTracking, error) {
+	vsets, err := validationSetsState(st)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]*ValidationSetTracking, len(vsets))
+	for key, raw := range vsets {
+		var tr ValidationSetTracking
+		if err := json.Unmarshal([]byte(*raw), &tr); err != nil {
+			return nil, fmt.Errorf("cannot unmarshal validation set tracking state: %v", err)
+		}
+		res[key] = &tr
+	}
+	return res, nil
+}
+
+// EnforcedValidationSets allows to hook getting the validation-set
+// assertions of the validation sets applied in enforce mode.
+var EnforcedValidationSets func(st *state.State) ([]*asserts.ValidationSet, error)
+
+func enforcedValidationSets(st *state.State) ([]*asserts.ValidationSet, error) {
+	if EnforcedValidationSets == nil {
+		return nil, nil
+	}
+	return EnforcedValidationSets(st)
+}
+
+func validationSetName(vs *asserts.ValidationSet) string {
+	return fmt.Sprintf("%s/%s", vs.AccountID(), vs.Name())
+}
+
+// validationSetSnap returns the constraints of the validation set
+// about the given snap, if any.
+func validationSetSnap(vs *asserts.ValidationSet, snapName, snapID string) *asserts.ValidationSetSnap {
+	for _, sn := range vs.Snaps() {
+		if snapID != "" && sn.SnapID == snapID {
+			return sn
+		}
+		if snapID == "" && sn.Name == snapName {
+			return sn
+		}
+	}
+	return nil
+}
+
+// checkValidationSetsForInstall checks that installing or refreshing
+// to the given snap revision does not break any of the validation sets
+// applied in enforce mode.
+func checkValidationSetsForInstall(st *state.State, info *snap.Info) error {
+	vsets, err := enforcedValidationSets(st)
+	if err != nil {
+		return err
+	}
+	for _, vs := range vsets {
+		sn := validationSetSnap(vs, info.SnapName(), info.SnapID)
+		if sn == nil {
+			continue
+		}
+		if sn.Presence == asserts.PresenceInvalid {
+			return fmt.Errorf("cannot install snap %q: it is invalid in validation set %s", info.InstanceName(), validationSetName(vs))
+		}
+		if sn.Revision != 0 && info.Revision != snap.R(sn.Revision) {
+			return fmt.Errorf("cannot install snap %q at revision %s: validation set %s requires revision %d", info.InstanceName(), info.Revision, validationSetName(vs), sn.Revision)
+		}
+	}
+	return nil
+}
+
+// checkValidationSetsForRemove checks that removing the given snap
+// does not break any of the validation sets applied in enforce mode.
+func checkValidationSetsForRemove(st *state.State, instanceName, snapID string) error {
+	vsets, err := enforcedValidationSets(st)
+	if err != nil {
+		return err
+	}
+	for _, vs := range vsets {
+		sn := validationSetSnap(vs, snap.InstanceSnap(instanceName), snapID)
+		if sn != nil && sn.Presence == asserts.PresenceRequired {
+			return fmt.Errorf("cannot remove snap %q: it is required by validation set %s", instanceName, validationSetName(vs))
+		}
+	}
+	return nil
+}
+
+// ValidationSetError describes how the installed snaps do not satisfy
+// a validation set.
+type ValidationSetError struct {
+	AccountID string
+	Name      string
+	Sequence  int
+	// MissingSnaps are the required snaps that are not installed.
+	MissingSnaps []string
+	// InvalidSnaps are the invalid snaps that are installed.
+	InvalidSnaps []string
+	// WrongRevisionSnaps maps installed snaps not at the required
+	// revision to the required revision.
+	WrongRevisionSnaps map[string]snap.Revision
+}
+
+func (e *ValidationSetError) Error() string {
+	var problems []string
+	for _, name := range e.MissingSnaps {
+		problems = append(problems, fmt.Sprintf("missing required snap %q", name))
+	}
+	for _, name := range e.InvalidSnaps {
+		problems = append(problems, fmt.Sprintf("invalid snap %q is installed", name))
+	}
+	wrongRev := make([]string, 0, len(e.WrongRevisionSnaps))
+	for name := range e.WrongRevisionSnaps {
+		wrongRev = append(wrongRev, name)
+	}
+	sort.Strings(wrongRev)
+	for _, name := range wrongRev {
+		problems = append(problems, fmt.Sprintf("snap %q is not at required revision %s", name, e.WrongRevisionSnaps[name]))
+	}
+	prefix := fmt.Sprintf("validation set %s/%s (sequence %d) is not satisfied", e.AccountID, e.Name, e.Sequence)
+	if len(problems) == 1 {
+		return prefix + ": " + problems[0]
+	}
+	return prefix + ":\n- " + strings.Join(problems, "\n- ")
+}
+
+// CheckValidationSet checks whether the installed snaps satisfy the
+// given validation set, returning a *ValidationSetError if they don't.
+func CheckValidationSet(st *state.State, vs *asserts.ValidationSet) error {
+	snapStates, err := All(st)
+	if err != nil {
+		return err
+	}
+
+	e := &ValidationSetError{
+		AccountID: vs.AccountID(),
+		Name:      vs.Name(),
+		Sequence:  vs.Sequence(),
+	}
+	failed := false
+	for _, sn := range vs.Snaps() {
+		var installed []string
+		var revs []snap.Revision
+		for instanceName, snapst := range snapStates {
+			si := snapst.CurrentSideInfo()
+			if si == nil {
+				continue
+			}
+			if si.SnapID != "" && si.SnapID == sn.SnapID || si.SnapID == "" && si.RealName == sn.Name {
+				installed = append(installed, instanceName)
+				revs = append(revs, snapst.Current)
+			}
+		}
+		switch sn.Presence {
+		case asserts.PresenceRequired:
+			if len(installed) == 0 {
+				e.MissingSnaps = append(e.MissingSnaps, sn.Name)
+				failed = true
+				continue
+			}
+		case asserts.PresenceInvalid:
+			if len(installed) != 0 {
+				sort.Strings(installed)
+				e.InvalidSnaps = append(e.InvalidSnaps, installed...)
+				failed = true
+			}
+			continue
+		}
+		if sn.Revision == 0 {
+			continue
+		}
+		for i, instanceName := range installed {
+			if revs[i] != snap.R(sn.Revision) {
+				if e.WrongRevisionSnaps == nil {
+					e.WrongRevisionSnaps = make(map[string]snap.Revision)
+				}
+				e.WrongRevisionSnaps[instanceName] = snap.R(sn.Revision)
+				failed = true
+			}
+		}
+	}
+	if failed {
+		return e
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate_test
+
+import (
+	"context"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+func fakeValidationSet(name string, snaps ...interface{}) *asserts.ValidationSet {
+	a := assertstest.FakeAssertion(map[string]interface{}{
+		"type":         "validation-set",
+		"authority-id": "acme",
+		"series":       "16",
+		"account-id":   "acme",
+		"name":         name,
+		"sequence":     "1",
+		"snaps":        snaps,
+		"timestamp":    time.Now().Format(time.RFC3339),
+	})
+	return a.(*asserts.ValidationSet)
+}
+
+func (s *snapmgrTestSuite) mockEnforcedValidationSets(vsets ...*asserts.ValidationSet) {
+	old := snapstate.EnforcedValidationSets
+	snapstate.EnforcedValidationSets = func(st *state.State) ([]*asserts.ValidationSet, error) {
+		return vsets, nil
+	}
+	s.AddCleanup(func() { snapstate.EnforcedValidationSets = old })
+}
+
+func (s *snapmgrTestSuite) TestValidationSetTracking(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	vsets, err := snapstate.ValidationSets(s.state)
+	c.Assert(err, IsNil)
+	c.Check(vsets, HasLen, 0)
+
+	tr1 := &snapstate.ValidationSetTracking{
+		AccountID: "acme",
+		Name:      "one",
+		Mode:      snapstate.Enforce,
+		PinnedAt:  2,
+		Current:   2,
+	}
+	tr2 := &snapstate.ValidationSetTracking{
+		AccountID: "acme",
+		Name:      "two",
+		Mode:      snapstate.Monitor,
+		Current:   5,
+	}
+	snapstate.UpdateValidationSet(s.state, tr1)
+	snapstate.UpdateValidationSet(s.state, tr2)
+
+	var tr snapstate.ValidationSetTracking
+	c.Assert(snapstate.GetValidationSet(s.state, "acme", "one", &tr), IsNil)
+	c.Check(&tr, DeepEquals, tr1)
+
+	vsets, err = snapstate.ValidationSets(s.state)
+	c.Assert(err, IsNil)
+	c.Check(vsets, DeepEquals, map[string]*snapstate.ValidationSetTracking{
+		"acme/one": tr1,
+		"acme/two": tr2,
+	})
+
+	c.Assert(snapstate.ForgetValidationSet(s.state, "acme", "one"), IsNil)
+	c.Check(snapstate.GetValidationSet(s.state, "acme", "one", &tr), Equals, state.ErrNoState)
+	c.Check(snapstate.ForgetValidationSet(s.state, "acme", "one"), Equals, state.ErrNoState)
+	c.Assert(snapstate.ForgetValidationSet(s.state, "acme", "two"), IsNil)
+
+	vsets, err = snapstate.ValidationSets(s.state)
+	c.Assert(err, IsNil)
+	c.Check(vsets, HasLen, 0)
+
+	c.Check(snapstate.Monitor.String(), Equals, "monitor")
+	c.Check(snapstate.Enforce.String(), Equals, "enforce")
+}
+
+func (s *snapmgrTestSuite) TestCheckValidationSet(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	vs := fakeValidationSet("my-set",
+		map[string]interface{}{
+			"name":     "some-snap",
+			"id":       "somesnapidididididididididididid",
+			"revision": "7",
+		},
+		map[string]interface{}{
+			"name": "other-snap",
+			"id":   "othersnapidididididididididididi",
+		},
+		map[string]interface{}{
+			"name":     "bad-snap",
+			"id":       "badsnapididididididididididididi",
+			"presence": "invalid",
+		},
+		map[string]interface{}{
+			"name":     "maybe-snap",
+			"id":       "maybesnapidididididididididididi",
+			"presence": "optional",
+		},
+	)
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "some-snap", SnapID: "somesnapidididididididididididid", Revision: snap.R(3)}},
+		Current:  snap.R(3),
+	})
+	snapstate.Set(s.state, "bad-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "bad-snap", SnapID: "badsnapididididididididididididi", Revision: snap.R(1)}},
+		Current:  snap.R(1),
+	})
+
+	err := snapstate.CheckValidationSet(s.state, vs)
+	c.Assert(err, FitsTypeOf, &snapstate.ValidationSetError{})
+	c.Check(err, DeepEquals, &snapstate.ValidationSetError{
+		AccountID:          "acme",
+		Name:               "my-set",
+		Sequence:           1,
+		MissingSnaps:       []string{"other-snap"},
+		InvalidSnaps:       []string{"bad-snap"},
+		WrongRevisionSnaps: map[string]snap.Revision{"some-snap": snap.R(7)},
+	})
+	c.Check(err, ErrorMatches, `validation set acme/my-set \(sequence 1\) is not satisfied:
+- missing required snap "other-snap"
+- invalid snap "bad-snap" is installed
+- snap "some-snap" is not at required revision 7`)
+
+	// fix things up, a local install of the required snap is fine too
+	snapstate.Set(s.state, "bad-snap", nil)
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "some-snap", SnapID: "somesnapidididididididididididid", Revision: snap.R(7)}},
+		Current:  snap.R(7),
+	})
+	snapstate.Set(s.state, "other-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "other-snap", Revision: snap.R(-1)}},
+		Current:  snap.R(-1),
+	})
+	c.Check(snapstate.CheckValidationSet(s.state, vs), IsNil)
+
+	snapstate.Set(s.state, "other-snap", nil)
+	err = snapstate.CheckValidationSet(s.state, vs)
+	c.Check(err, ErrorMatches, `validation set acme/my-set \(sequence 1\) is not satisfied: missing required snap "other-snap"`)
+}
+
+func (s *snapmgrTestSuite) TestInstallInvalidInEnforcedValidationSet(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockEnforcedValidationSets(fakeValidationSet("my-set", map[string]interface{}{
+		"name":     "some-snap",
+		"id":       "somesnapidididididididididididid",
+		"presence": "invalid",
+	}))
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "some-snap", SnapID: "somesnapidididididididididididid", Revision: snap.R(11)}}
+	err := snapstate.CheckValidationSetsForInstall(s.state, info)
+	c.Check(err, ErrorMatches, `cannot install snap "some-snap": it is invalid in validation set acme/my-set`)
+
+	// other snaps are not affected
+	info = &snap.Info{SideInfo: snap.SideInfo{RealName: "other-snap", SnapID: "othersnapidididididididididididi", Revision: snap.R(1)}}
+	c.Check(snapstate.CheckValidationSetsForInstall(s.state, info), IsNil)
+}
+
+func (s *snapmgrTestSuite) TestInstallNotAffectedByMonitoredValidationSets(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockEnforcedValidationSets()
+
+	_, err := snapstate.Install(context.Background(), s.state, "some-snap", nil, s.user.ID, snapstate.Flags{})
+	c.Check(err, IsNil)
+}
+
+func (s *snapmgrTestSuite) TestRemoveRequiredInEnforcedValidationSet(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockEnforcedValidationSets(fakeValidationSet("my-set", map[string]interface{}{
+		"name": "some-snap",
+		"id":   "somesnapidididididididididididid",
+	}))
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "some-snap", SnapID: "somesnapidididididididididididid", Revision: snap.R(7)}},
+		Current:  snap.R(7),
+		SnapType: "app",
+	})
+
+	_, err := snapstate.Remove(s.state, "some-snap", snap.R(0), nil)
+	c.Check(err, ErrorMatches, `cannot remove snap "some-snap": it is required by validation set acme/my-set`)
+
+	// other snaps are not affected
+	c.Check(snapstate.CheckValidationSetsForRemove(s.state, "other-snap", "othersnapidididididididididididi"), IsNil)
+}
+
+func (s *snapmgrTestSuite) TestInstallWrongRevisionInEnforcedValidationSet(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	vs := fakeValidationSet("my-set", map[string]interface{}{
+		"name":     "some-snap",
+		"id":       "somesnapidididididididididididid",
+		"revision": "7",
+	})
+	s.mockEnforcedValidationSets(vs)
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "some-snap", SnapID: "somesnapidididididididididididid", Revision: snap.R(11)}}
+	err := snapstate.CheckValidationSetsForInstall(s.state, info)
+	c.Check(err, ErrorMatches, `cannot install snap "some-snap" at revision 11: validation set acme/my-set requires revision 7`)
+
+	info.Revision = snap.R(7)
+	c.Check(snapstate.CheckValidationSetsForInstall(s.state, info), IsNil)
+}
@@ -0,0 +1,117 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package storecachestate implements the manager serving the store
+// download cache of the device to other devices.
+package storecachestate
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/store"
+)
+
+// overridden in the unit tests
+var netListen = net.Listen
+
+// StoreCacheManager serves, when configured via store-cache.listen, the
+// snaps in the store download cache together with the system
+// assertions, so that other devices can use this one as their store.
+type StoreCacheManager struct {
+	state *state.State
+
+	addr     string
+	listener net.Listener
+	server   *http.Server
+}
+
+// Manager returns a new store cache manager.
+func Manager(st *state.State) *StoreCacheManager {
+	return &StoreCacheManager{state: st}
+}
+
+func listenAddress(st *state.State) (string, error) {
+	var addr string
+	tr := config.NewTransaction(st)
+	if err := tr.GetMaybe("core", "store-cache.listen", &addr); err != nil {
+		return "", err
+	}
+	return addr, nil
+}
+
+func (m *StoreCacheManager) withDB(f func(db asserts.RODatabase) error) error {
+	m.state.Lock()
+	defer m.state.Unlock()
+	return f(assertstate.DB(m.state))
+}
+
+// Ensure implements StateManager.Ensure, it starts, stops or moves the
+// store cache server to follow store-cache.listen.
+func (m *StoreCacheManager) Ensure() error {
+	m.state.Lock()
+	addr, err := listenAddress(m.state)
+	m.state.Unlock()
+	if err != nil {
+		return err
+	}
+	if addr == m.addr {
+		return nil
+	}
+
+	m.stopServer()
+	if addr == "" {
+		return nil
+	}
+
+	l, err := netListen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("cannot serve store cache on %q: %v", addr, err)
+	}
+	m.addr = addr
+	m.listener = l
+	m.server = &http.Server{Handler: store.NewCacheServer(dirs.SnapDownloadCacheDir, m.withDB)}
+	go m.server.Serve(l)
+	logger.Noticef("Serving store cache on %s", l.Addr())
+
+	return nil
+}
+
+func (m *StoreCacheManager) stopServer() {
+	if m.server == nil {
+		return
+	}
+	logger.Noticef("Stopping serving store cache on %s", m.listener.Addr())
+	m.server.Close()
+	m.server = nil
+	m.listener = nil
+	m.addr = ""
+}
+
+// Stop implements StateStopper, it stops the store cache server.
+func (m *StoreCacheManager) Stop() {
+	m.stopServer()
+}
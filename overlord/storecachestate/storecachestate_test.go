@@ -0,0 +1,163 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package storecachestate_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/overlord/storecachestate"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type storeCacheSuite struct {
+	testutil.BaseTest
+
+	state *state.State
+	mgr   *storecachestate.StoreCacheManager
+
+	storeSigning *assertstest.StoreStack
+}
+
+var _ = Suite(&storeCacheSuite{})
+
+func (s *storeCacheSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	s.storeSigning = assertstest.NewStoreStack("can0nical", nil)
+	db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{
+		Backstore: asserts.NewMemoryBackstore(),
+		Trusted:   s.storeSigning.Trusted,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(db.Add(s.storeSigning.StoreAccountKey("")), IsNil)
+
+	s.state = state.New(nil)
+	s.state.Lock()
+	assertstate.ReplaceDB(s.state, db)
+	s.state.Unlock()
+
+	s.mgr = storecachestate.Manager(s.state)
+	s.AddCleanup(s.mgr.Stop)
+}
+
+func (s *storeCacheSuite) setListen(addr string) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	tr := config.NewTransaction(s.state)
+	tr.Set("core", "store-cache.listen", addr)
+	tr.Commit()
+}
+
+func (s *storeCacheSuite) get(c *C, p string) (*http.Response, error) {
+	addr := s.mgr.ListenerAddr()
+	c.Assert(addr, NotNil)
+	resp, err := http.Get(fmt.Sprintf("http://%s%s", addr, p))
+	if err == nil {
+		resp.Body.Close()
+	}
+	return resp, err
+}
+
+func (s *storeCacheSuite) TestEnsureNotConfigured(c *C) {
+	c.Assert(s.mgr.Ensure(), IsNil)
+	c.Check(s.mgr.ListenerAddr(), IsNil)
+}
+
+func (s *storeCacheSuite) TestEnsureServes(c *C) {
+	s.setListen("127.0.0.1:0")
+	c.Assert(s.mgr.Ensure(), IsNil)
+	addr := s.mgr.ListenerAddr()
+	c.Assert(addr, NotNil)
+
+	// assertions of the system are served
+	resp, err := s.get(c, "/api/v1/snaps/assertions/account/can0nical")
+	c.Assert(err, IsNil)
+	c.Check(resp.StatusCode, Equals, 200)
+	c.Check(resp.Header.Get("Content-Type"), Equals, asserts.MediaType)
+
+	resp, err = s.get(c, "/api/v1/snaps/assertions/account/other")
+	c.Assert(err, IsNil)
+	c.Check(resp.StatusCode, Equals, 404)
+
+	// nothing changes on the next ensure
+	c.Assert(s.mgr.Ensure(), IsNil)
+	c.Check(s.mgr.ListenerAddr(), Equals, addr)
+
+	// unsetting stops serving
+	s.setListen("")
+	c.Assert(s.mgr.Ensure(), IsNil)
+	c.Check(s.mgr.ListenerAddr(), IsNil)
+	_, err = http.Get(fmt.Sprintf("http://%s/", addr))
+	c.Check(err, NotNil)
+}
+
+func (s *storeCacheSuite) TestEnsureMoves(c *C) {
+	var listened []string
+	s.AddCleanup(storecachestate.MockNetListen(func(network, address string) (net.Listener, error) {
+		c.Check(network, Equals, "tcp")
+		listened = append(listened, address)
+		return net.Listen("tcp", "127.0.0.1:0")
+	}))
+
+	s.setListen(":8181")
+	c.Assert(s.mgr.Ensure(), IsNil)
+	first := s.mgr.ListenerAddr()
+
+	s.setListen(":8282")
+	c.Assert(s.mgr.Ensure(), IsNil)
+	c.Check(s.mgr.ListenerAddr(), Not(Equals), first)
+	c.Check(listened, DeepEquals, []string{":8181", ":8282"})
+
+	// the first listener is gone
+	_, err := http.Get(fmt.Sprintf("http://%s/", first))
+	c.Check(err, NotNil)
+}
+
+func (s *storeCacheSuite) TestEnsureListenError(c *C) {
+	n := 0
+	s.AddCleanup(storecachestate.MockNetListen(func(network, address string) (net.Listener, error) {
+		n++
+		return nil, errors.New("address already in use")
+	}))
+
+	s.setListen(":8181")
+	c.Check(s.mgr.Ensure(), ErrorMatches, `cannot serve store cache on ":8181": address already in use`)
+	c.Check(s.mgr.ListenerAddr(), IsNil)
+
+	// tried again on the next ensure
+	c.Check(s.mgr.Ensure(), NotNil)
+	c.Check(n, Equals, 2)
+}
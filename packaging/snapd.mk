@@ -105,6 +105,8 @@ install::
 	install -m 755 -d $(DESTDIR)/$(sharedstatedir)/snapd/cache
 	install -m 755 -d $(DESTDIR)/$(sharedstatedir)/snapd/cookie
 	install -m 755 -d $(DESTDIR)/$(sharedstatedir)/snapd/desktop/applications
+	install -m 755 -d $(DESTDIR)/$(sharedstatedir)/snapd/dbus-1/services
+	install -m 755 -d $(DESTDIR)/$(sharedstatedir)/snapd/dbus-1/system-services
 	install -m 755 -d $(DESTDIR)/$(sharedstatedir)/snapd/device
 	install -m 755 -d $(DESTDIR)/$(sharedstatedir)/snapd/hostfs
 	install -m 755 -d $(DESTDIR)/$(sharedstatedir)/snapd/lib/gl
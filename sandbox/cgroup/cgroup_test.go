@@ -213,3 +213,51 @@ func (s *cgroupSuite) TestProgGroupConfusingCpu(c *C) {
 	c.Assert(err, IsNil)
 	c.Check(group, Equals, "/foo.many-cpu")
 }
+
+func (s *cgroupSuite) TestUsageV2(c *C) {
+	restore := cgroup.MockVersion(cgroup.V2, nil)
+	defer restore()
+	dirs.SetRootDir(c.MkDir())
+
+	grpDir := filepath.Join(dirs.GlobalRootDir, "/sys/fs/cgroup/snap.foo.slice")
+	c.Assert(os.MkdirAll(grpDir, 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(grpDir, "memory.current"), []byte("12345\n"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(grpDir, "pids.current"), []byte("7\n"), 0644), IsNil)
+
+	mem, err := cgroup.MemoryUsage("snap.foo.slice")
+	c.Assert(err, IsNil)
+	c.Check(mem, Equals, uint64(12345))
+	tasks, err := cgroup.TasksCount("snap.foo.slice")
+	c.Assert(err, IsNil)
+	c.Check(tasks, Equals, uint64(7))
+
+	_, err = cgroup.MemoryUsage("snap.bar.slice")
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *cgroupSuite) TestUsageV1(c *C) {
+	restore := cgroup.MockVersion(cgroup.V1, nil)
+	defer restore()
+	dirs.SetRootDir(c.MkDir())
+
+	memDir := filepath.Join(dirs.GlobalRootDir, "/sys/fs/cgroup/memory/snap.foo.slice")
+	pidsDir := filepath.Join(dirs.GlobalRootDir, "/sys/fs/cgroup/pids/snap.foo.slice")
+	c.Assert(os.MkdirAll(memDir, 0755), IsNil)
+	c.Assert(os.MkdirAll(pidsDir, 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(memDir, "memory.usage_in_bytes"), []byte("4096\n"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(pidsDir, "pids.current"), []byte("garbage\n"), 0644), IsNil)
+
+	mem, err := cgroup.MemoryUsage("snap.foo.slice")
+	c.Assert(err, IsNil)
+	c.Check(mem, Equals, uint64(4096))
+	_, err = cgroup.TasksCount("snap.foo.slice")
+	c.Check(err, ErrorMatches, `cannot parse .*/pids.current: .*invalid syntax`)
+}
+
+func (s *cgroupSuite) TestUsageUnknownVersion(c *C) {
+	restore := cgroup.MockVersion(cgroup.Unknown, errors.New("boom"))
+	defer restore()
+
+	_, err := cgroup.MemoryUsage("snap.foo.slice")
+	c.Check(err, ErrorMatches, "boom")
+}
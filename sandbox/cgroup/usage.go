@@ -0,0 +1,80 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cgroup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/snapcore/snapd/dirs"
+)
+
+// usagePath returns the path of the given accounting file of a cgroup.
+// The group is given relative to the root of the hierarchy, e.g. a
+// top level slice is just the name of the slice.
+func usagePath(group, controllerV1, fileV1, fileV2 string) (string, error) {
+	version, err := Version()
+	if err != nil {
+		return "", err
+	}
+	switch version {
+	case V2:
+		return filepath.Join(dirs.GlobalRootDir, expectedMountPoint, group, fileV2), nil
+	case V1:
+		return filepath.Join(ControllerPathV1(controllerV1), group, fileV1), nil
+	}
+	return "", fmt.Errorf("cannot use unknown cgroup version")
+}
+
+func readUsage(path string) (uint64, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse %s: %v", path, err)
+	}
+	return value, nil
+}
+
+// MemoryUsage returns the amount of memory in bytes currently used by
+// the processes of the given cgroup, given relative to the root of the
+// hierarchy.
+func MemoryUsage(group string) (uint64, error) {
+	path, err := usagePath(group, "memory", "memory.usage_in_bytes", "memory.current")
+	if err != nil {
+		return 0, err
+	}
+	return readUsage(path)
+}
+
+// TasksCount returns the number of tasks (threads) currently in the
+// given cgroup, given relative to the root of the hierarchy.
+func TasksCount(group string) (uint64, error) {
+	path, err := usagePath(group, "pids", "pids.current", "pids.current")
+	if err != nil {
+		return 0, err
+	}
+	return readUsage(path)
+}
@@ -35,6 +35,7 @@ var supportedHooks = []*HookType{
 	NewHookType(regexp.MustCompile("^connect-(?:plug|slot)-[-a-z0-9]+$")),
 	NewHookType(regexp.MustCompile("^disconnect-(?:plug|slot)-[-a-z0-9]+$")),
 	NewHookType(regexp.MustCompile("^check-health$")),
+	NewHookType(regexp.MustCompile("^gate-auto-refresh$")),
 }
 
 // HookType represents a pattern of supported hook names.
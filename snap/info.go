@@ -716,6 +716,28 @@ func (st StopModeType) Validate() error {
 	return fmt.Errorf(`"stop-mode" field contains invalid value %q`, st)
 }
 
+// DaemonScope is the type for the "daemon-scope:" of a snap app,
+// whether the daemon runs system wide or in each user session.
+type DaemonScope string
+
+const (
+	// SystemDaemon is a daemon run by the system instance of
+	// systemd, the default.
+	SystemDaemon DaemonScope = "system"
+	// UserDaemon is a daemon run by the systemd instance of each
+	// logged in user.
+	UserDaemon DaemonScope = "user"
+)
+
+// Validate checks that the daemon scope is one of the known ones.
+func (ds DaemonScope) Validate() error {
+	switch ds {
+	case "", SystemDaemon, UserDaemon:
+		return nil
+	}
+	return fmt.Errorf(`"daemon-scope" field contains invalid value %q`, ds)
+}
+
 // AppInfo provides information about an app.
 type AppInfo struct {
 	Snap *Info
@@ -727,6 +749,7 @@ type AppInfo struct {
 	CommonID      string
 
 	Daemon          string
+	DaemonScope     DaemonScope
 	StopTimeout     timeout.Timeout
 	StartTimeout    timeout.Timeout
 	WatchdogTimeout timeout.Timeout
@@ -738,6 +761,7 @@ type AppInfo struct {
 	Completer       string
 	RefreshMode     string
 	StopMode        StopModeType
+	InstallMode     string
 
 	// TODO: this should go away once we have more plumbing and can change
 	// things vs refactor
@@ -758,6 +782,10 @@ type AppInfo struct {
 	Timer *TimerInfo
 
 	Autostart string
+
+	// ActivatesOn are the D-Bus slots of the snap whose bus names
+	// activate this service on demand
+	ActivatesOn []*SlotInfo
 }
 
 // ScreenshotInfo provides information about a screenshot.
@@ -823,12 +851,12 @@ type SystemUsernameInfo struct {
 
 // File returns the path to the *.socket file
 func (socket *SocketInfo) File() string {
-	return filepath.Join(dirs.SnapServicesDir, socket.App.SecurityTag()+"."+socket.Name+".socket")
+	return filepath.Join(socket.App.serviceDir(), socket.App.SecurityTag()+"."+socket.Name+".socket")
 }
 
 // File returns the path to the *.timer file
 func (timer *TimerInfo) File() string {
-	return filepath.Join(dirs.SnapServicesDir, timer.App.SecurityTag()+".timer")
+	return filepath.Join(timer.App.serviceDir(), timer.App.SecurityTag()+".timer")
 }
 
 func (app *AppInfo) String() string {
@@ -896,9 +924,18 @@ func (app *AppInfo) ServiceName() string {
 	return app.SecurityTag() + ".service"
 }
 
+// serviceDir returns the directory of the systemd units of the app,
+// user daemons are started by the systemd instance of each user.
+func (app *AppInfo) serviceDir() string {
+	if app.DaemonScope == UserDaemon {
+		return dirs.SnapUserServicesDir
+	}
+	return dirs.SnapServicesDir
+}
+
 // ServiceFile returns the systemd service file path for the daemon app.
 func (app *AppInfo) ServiceFile() string {
-	return filepath.Join(dirs.SnapServicesDir, app.ServiceName())
+	return filepath.Join(app.serviceDir(), app.ServiceName())
 }
 
 // Env returns the app specific environment overrides
@@ -72,7 +72,8 @@ type appYaml struct {
 	Command      string   `yaml:"command"`
 	CommandChain []string `yaml:"command-chain,omitempty"`
 
-	Daemon string `yaml:"daemon"`
+	Daemon      string      `yaml:"daemon"`
+	DaemonScope DaemonScope `yaml:"daemon-scope,omitempty"`
 
 	StopCommand     string          `yaml:"stop-command,omitempty"`
 	ReloadCommand   string          `yaml:"reload-command,omitempty"`
@@ -83,6 +84,7 @@ type appYaml struct {
 	Completer       string          `yaml:"completer,omitempty"`
 	RefreshMode     string          `yaml:"refresh-mode,omitempty"`
 	StopMode        StopModeType    `yaml:"stop-mode,omitempty"`
+	InstallMode     string          `yaml:"install-mode,omitempty"`
 
 	RestartCond  RestartCondition `yaml:"restart-condition,omitempty"`
 	RestartDelay timeout.Timeout  `yaml:"restart-delay,omitempty"`
@@ -102,6 +104,8 @@ type appYaml struct {
 	Timer string `yaml:"timer,omitempty"`
 
 	Autostart string `yaml:"autostart,omitempty"`
+
+	ActivatesOn []string `yaml:"activates-on,omitempty"`
 }
 
 type hookYaml struct {
@@ -349,6 +353,7 @@ func setAppsFromSnapYaml(y snapYaml, snap *Info, strk *scopedTracker) error {
 			CommandChain:    yApp.CommandChain,
 			StartTimeout:    yApp.StartTimeout,
 			Daemon:          yApp.Daemon,
+			DaemonScope:     yApp.DaemonScope,
 			StopTimeout:     yApp.StopTimeout,
 			StopCommand:     yApp.StopCommand,
 			ReloadCommand:   yApp.ReloadCommand,
@@ -361,6 +366,7 @@ func setAppsFromSnapYaml(y snapYaml, snap *Info, strk *scopedTracker) error {
 			Completer:       yApp.Completer,
 			StopMode:        yApp.StopMode,
 			RefreshMode:     yApp.RefreshMode,
+			InstallMode:     yApp.InstallMode,
 			Before:          yApp.Before,
 			After:           yApp.After,
 			Autostart:       yApp.Autostart,
@@ -369,7 +375,7 @@ func setAppsFromSnapYaml(y snapYaml, snap *Info, strk *scopedTracker) error {
 		if len(y.Plugs) > 0 || len(yApp.PlugNames) > 0 {
 			app.Plugs = make(map[string]*PlugInfo)
 		}
-		if len(y.Slots) > 0 || len(yApp.SlotNames) > 0 {
+		if len(y.Slots) > 0 || len(yApp.SlotNames) > 0 || len(yApp.ActivatesOn) > 0 {
 			app.Slots = make(map[string]*SlotInfo)
 		}
 		if len(yApp.Sockets) > 0 {
@@ -417,6 +423,17 @@ func setAppsFromSnapYaml(y snapYaml, snap *Info, strk *scopedTracker) error {
 			app.Slots[slotName] = slot
 			slot.Apps[appName] = app
 		}
+		for _, slotName := range yApp.ActivatesOn {
+			slot, ok := snap.Slots[slotName]
+			if !ok {
+				return fmt.Errorf("invalid activates-on value %q on app %q: slot not found", slotName, appName)
+			}
+			app.ActivatesOn = append(app.ActivatesOn, slot)
+			// the activating slot is implicitly bound to the app
+			strk.markSlot(slot)
+			app.Slots[slotName] = slot
+			slot.Apps[appName] = app
+		}
 		for name, data := range yApp.Sockets {
 			app.Sockets[name] = &SocketInfo{
 				App:          app,
@@ -1686,6 +1686,87 @@ apps:
 	c.Check(info.Apps["foo"].WatchdogTimeout, Equals, timeout.Timeout(12*time.Second))
 }
 
+func (s *YamlSuite) TestSnapYamlDaemonScope(c *C) {
+	y := []byte(`
+name: foo
+version: 1.0
+apps:
+  foo:
+    daemon: simple
+    daemon-scope: user
+  bar:
+    daemon: simple
+    daemon-scope: system
+  baz:
+    daemon: simple
+`)
+	info, err := snap.InfoFromSnapYaml(y)
+	c.Assert(err, IsNil)
+
+	c.Check(info.Apps["foo"].DaemonScope, Equals, snap.UserDaemon)
+	c.Check(info.Apps["bar"].DaemonScope, Equals, snap.SystemDaemon)
+	c.Check(info.Apps["baz"].DaemonScope, Equals, snap.DaemonScope(""))
+}
+
+func (s *YamlSuite) TestSnapYamlInstallMode(c *C) {
+	y := []byte(`
+name: foo
+version: 1.0
+apps:
+  foo:
+    daemon: simple
+    install-mode: disable
+  bar:
+    daemon: simple
+`)
+	info, err := snap.InfoFromSnapYaml(y)
+	c.Assert(err, IsNil)
+
+	c.Check(info.Apps["foo"].InstallMode, Equals, "disable")
+	c.Check(info.Apps["bar"].InstallMode, Equals, "")
+}
+
+func (s *YamlSuite) TestSnapYamlActivatesOn(c *C) {
+	y := []byte(`
+name: foo
+version: 1.0
+slots:
+  dbus-slot:
+    interface: dbus
+    bus: system
+    name: org.example.Foo
+apps:
+  daemon:
+    daemon: simple
+    activates-on: [dbus-slot]
+  other:
+    command: bin/other
+`)
+	info, err := snap.InfoFromSnapYaml(y)
+	c.Assert(err, IsNil)
+
+	app := info.Apps["daemon"]
+	slot := info.Slots["dbus-slot"]
+	c.Check(app.ActivatesOn, DeepEquals, []*snap.SlotInfo{slot})
+	// the slot is implicitly bound to the activated app only
+	c.Check(app.Slots["dbus-slot"], Equals, slot)
+	c.Check(slot.Apps, DeepEquals, map[string]*snap.AppInfo{"daemon": app})
+	c.Check(info.Apps["other"].Slots, HasLen, 0)
+}
+
+func (s *YamlSuite) TestSnapYamlActivatesOnUnknownSlot(c *C) {
+	y := []byte(`
+name: foo
+version: 1.0
+apps:
+  daemon:
+    daemon: simple
+    activates-on: [dbus-slot]
+`)
+	_, err := snap.InfoFromSnapYaml(y)
+	c.Check(err, ErrorMatches, `invalid activates-on value "dbus-slot" on app "daemon": slot not found`)
+}
+
 func (s *YamlSuite) TestLayout(c *C) {
 	y := []byte(`
 name: foo
@@ -1181,6 +1181,22 @@ apps:
 	c.Check(svc.ServiceFile(), Equals, dirs.GlobalRootDir+"/etc/systemd/system/snap.pans_instance.svc1.service")
 }
 
+func (s *infoSuite) TestAppInfoUserServiceFiles(c *C) {
+	info, err := snap.InfoFromSnapYaml([]byte(`name: pans
+apps:
+  svc1:
+    daemon: simple
+    daemon-scope: user
+    timer: mon,10:00-12:00
+`))
+	c.Assert(err, IsNil)
+
+	svc := info.Apps["svc1"]
+	c.Check(svc.ServiceName(), Equals, "snap.pans.svc1.service")
+	c.Check(svc.ServiceFile(), Equals, dirs.GlobalRootDir+"/etc/systemd/user/snap.pans.svc1.service")
+	c.Check(svc.Timer.File(), Equals, dirs.GlobalRootDir+"/etc/systemd/user/snap.pans.svc1.timer")
+}
+
 func (s *infoSuite) TestAppInfoStringer(c *C) {
 	info, err := snap.InfoFromSnapYaml([]byte(`name: asnap
 apps:
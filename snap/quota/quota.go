@@ -0,0 +1,113 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package quota defines the quota groups used to limit the resources
+// used by the services of snaps.
+package quota
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/snapcore/snapd/snap/naming"
+	"github.com/snapcore/snapd/systemd"
+)
+
+// MinMemoryLimit is the smallest memory limit a quota group can have.
+const MinMemoryLimit = 4 * 1024
+
+var validGroupName = regexp.MustCompile(`^[a-z0-9](?:-?[a-z0-9])*$`)
+
+// ValidateGroupName checks whether the given name is a valid quota
+// group name.
+func ValidateGroupName(name string) error {
+	if name == "" {
+		return fmt.Errorf("quota group name must not be empty")
+	}
+	if len(name) > 40 {
+		return fmt.Errorf("quota group name %q is too long", name)
+	}
+	if !validGroupName.MatchString(name) {
+		return fmt.Errorf("invalid quota group name %q: must contain only lowercase letters, digits and dashes, and cannot start or end with a dash or have consecutive dashes", name)
+	}
+	return nil
+}
+
+// Group is a named set of snaps whose services are confined together
+// to the given resource limits.
+type Group struct {
+	Name string `json:"name"`
+	// MemoryLimit is the maximum amount of memory in bytes the
+	// services of the snaps in the group can use together, 0 for no
+	// limit.
+	MemoryLimit int64 `json:"memory-limit,omitempty"`
+	// CPULimit is the maximum CPU time the services of the snaps in
+	// the group can use together, as a percentage of the time of a
+	// single CPU, 0 for no limit.
+	CPULimit int `json:"cpu-limit,omitempty"`
+	// ThreadLimit is the maximum number of threads (tasks) the
+	// services of the snaps in the group can have together, 0 for no
+	// limit.
+	ThreadLimit int `json:"thread-limit,omitempty"`
+	// Snaps are the instance names of the snaps in the group.
+	Snaps []string `json:"snaps,omitempty"`
+}
+
+// HasLimits returns whether the group has any resource limit set.
+func (grp *Group) HasLimits() bool {
+	return grp.MemoryLimit != 0 || grp.CPULimit != 0 || grp.ThreadLimit != 0
+}
+
+// Validate checks that the group is well formed.
+func (grp *Group) Validate() error {
+	if err := ValidateGroupName(grp.Name); err != nil {
+		return err
+	}
+	if !grp.HasLimits() {
+		return fmt.Errorf("quota group %q must have at least one limit", grp.Name)
+	}
+	if grp.MemoryLimit < 0 || grp.MemoryLimit != 0 && grp.MemoryLimit < MinMemoryLimit {
+		return fmt.Errorf("memory limit %d of quota group %q is too small: must be at least %d bytes", grp.MemoryLimit, grp.Name, MinMemoryLimit)
+	}
+	if grp.CPULimit < 0 {
+		return fmt.Errorf("cpu limit %d of quota group %q must be a positive percentage", grp.CPULimit, grp.Name)
+	}
+	if grp.ThreadLimit < 0 {
+		return fmt.Errorf("thread limit %d of quota group %q must be a positive number", grp.ThreadLimit, grp.Name)
+	}
+	seen := make(map[string]bool, len(grp.Snaps))
+	for _, snapName := range grp.Snaps {
+		if err := naming.ValidateInstance(snapName); err != nil {
+			return fmt.Errorf("invalid snap in quota group %q: %v", grp.Name, err)
+		}
+		if seen[snapName] {
+			return fmt.Errorf("snap %q is listed more than once in quota group %q", snapName, grp.Name)
+		}
+		seen[snapName] = true
+	}
+	return nil
+}
+
+// SliceFileName returns the name of the systemd slice unit of the
+// group.
+func (grp *Group) SliceFileName() string {
+	// dashes in slice names denote the slice hierarchy, so they
+	// must be escaped
+	return "snap." + systemd.EscapeUnitNamePath(grp.Name) + ".slice"
+}
@@ -0,0 +1,84 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package quota_test
+
+import (
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/snap/quota"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type quotaTestSuite struct{}
+
+var _ = Suite(&quotaTestSuite{})
+
+func (ts *quotaTestSuite) TestValidateGroupName(c *C) {
+	for _, name := range []string{"foo", "foo-bar", "a", "f00", "1-2-3"} {
+		c.Check(quota.ValidateGroupName(name), IsNil, Commentf(name))
+	}
+	for name, err := range map[string]string{
+		"":         `quota group name must not be empty`,
+		"Foo":      `invalid quota group name "Foo": .*`,
+		"-foo":     `invalid quota group name "-foo": .*`,
+		"foo-":     `invalid quota group name "foo-": .*`,
+		"foo--bar": `invalid quota group name "foo--bar": .*`,
+		"foo_bar":  `invalid quota group name "foo_bar": .*`,
+		"foo.bar":  `invalid quota group name "foo.bar": .*`,
+		"snap/foo": `invalid quota group name "snap/foo": .*`,
+		"a123456789a123456789a123456789a1234567890": `quota group name ".*" is too long`,
+	} {
+		c.Check(quota.ValidateGroupName(name), ErrorMatches, err, Commentf(name))
+	}
+}
+
+func (ts *quotaTestSuite) TestValidate(c *C) {
+	grp := &quota.Group{
+		Name:        "foo",
+		MemoryLimit: 1024 * 1024,
+		Snaps:       []string{"some-snap", "other-snap_instance"},
+	}
+	c.Check(grp.Validate(), IsNil)
+	c.Check(grp.HasLimits(), Equals, true)
+
+	for _, t := range []struct {
+		grp *quota.Group
+		err string
+	}{
+		{&quota.Group{Name: "Foo", ThreadLimit: 1}, `invalid quota group name "Foo": .*`},
+		{&quota.Group{Name: "foo"}, `quota group "foo" must have at least one limit`},
+		{&quota.Group{Name: "foo", MemoryLimit: 1}, `memory limit 1 of quota group "foo" is too small: must be at least 4096 bytes`},
+		{&quota.Group{Name: "foo", MemoryLimit: -1}, `memory limit -1 of quota group "foo" is too small: must be at least 4096 bytes`},
+		{&quota.Group{Name: "foo", CPULimit: -5}, `cpu limit -5 of quota group "foo" must be a positive percentage`},
+		{&quota.Group{Name: "foo", ThreadLimit: -1}, `thread limit -1 of quota group "foo" must be a positive number`},
+		{&quota.Group{Name: "foo", CPULimit: 50, Snaps: []string{"Bad"}}, `invalid snap in quota group "foo": .*`},
+		{&quota.Group{Name: "foo", CPULimit: 50, Snaps: []string{"a-snap", "a-snap"}}, `snap "a-snap" is listed more than once in quota group "foo"`},
+	} {
+		c.Check(t.grp.Validate(), ErrorMatches, t.err)
+	}
+}
+
+func (ts *quotaTestSuite) TestSliceFileName(c *C) {
+	c.Check((&quota.Group{Name: "foo"}).SliceFileName(), Equals, "snap.foo.slice")
+	c.Check((&quota.Group{Name: "foo-bar"}).SliceFileName(), Equals, `snap.foo\x2dbar.slice`)
+}
@@ -0,0 +1,230 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package snapbundle implements snap bundles: single archives carrying a
+// set of snaps together with all the assertions needed to install them
+// on devices without network access.
+//
+// A bundle is a tar archive whose first entry holds the assertions in
+// prerequisite order, followed by the snap files in the order they need
+// to be installed.
+package snapbundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/snapcore/snapd/asserts"
+)
+
+// Extension is the conventional file extension of snap bundles.
+const Extension = ".bundle"
+
+const assertionsEntry = "bundle.assert"
+
+// Writer writes a snap bundle.
+type Writer struct {
+	tw              *tar.Writer
+	wroteAssertions bool
+}
+
+// NewWriter returns a Writer writing a bundle to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{tw: tar.NewWriter(w)}
+}
+
+func (w *Writer) writeEntry(name string, size int64, r io.Reader) error {
+	hdr := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := io.Copy(w.tw, r)
+	return err
+}
+
+// WriteAssertions writes the given assertions to the bundle, they need
+// to be in prerequisite order. It must be called once, before any snap
+// is added.
+func (w *Writer) WriteAssertions(as []asserts.Assertion) error {
+	if w.wroteAssertions {
+		return fmt.Errorf("internal error: bundle assertions already written")
+	}
+	buf := bytes.NewBuffer(nil)
+	enc := asserts.NewEncoder(buf)
+	for _, a := range as {
+		if err := enc.Encode(a); err != nil {
+			return err
+		}
+	}
+	if err := w.writeEntry(assertionsEntry, int64(buf.Len()), buf); err != nil {
+		return err
+	}
+	w.wroteAssertions = true
+	return nil
+}
+
+// AddSnap adds the snap file at snapPath to the bundle. Snaps are
+// installed in the order they were added.
+func (w *Writer) AddSnap(snapPath string) error {
+	if !w.wroteAssertions {
+		return fmt.Errorf("internal error: bundle assertions must be written before snaps")
+	}
+	f, err := os.Open(snapPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return w.writeEntry(filepath.Base(snapPath), st.Size(), f)
+}
+
+// Close finishes writing the bundle.
+func (w *Writer) Close() error {
+	return w.tw.Close()
+}
+
+// Bundle is an unpacked snap bundle.
+type Bundle struct {
+	// Assertions holds the assertions of the bundle in prerequisite order.
+	Assertions []asserts.Assertion
+	// Snaps holds the paths of the unpacked snap files in install order.
+	Snaps []string
+	// Names holds the original file names of the snaps.
+	Names []string
+}
+
+// IsBundle returns whether the file at path is a snap bundle.
+func IsBundle(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	hdr, err := tar.NewReader(f).Next()
+	if err != nil {
+		return false
+	}
+	return hdr.Name == assertionsEntry
+}
+
+// Unpack unpacks the bundle at path, writing the snaps it contains to
+// temporary files in dir whose names start with prefix. The caller is in
+// charge of the unpacked snaps; on error they are removed.
+func Unpack(path, dir, prefix string) (bundle *Bundle, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b := &Bundle{}
+	defer func() {
+		if err != nil {
+			for _, p := range b.Snaps {
+				os.Remove(p)
+			}
+		}
+	}()
+
+	tr := tar.NewReader(f)
+	for first := true; ; first = false {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			if first {
+				return nil, fmt.Errorf("cannot unpack snap bundle: empty bundle")
+			}
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot unpack snap bundle: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("cannot unpack snap bundle: unexpected entry %q", hdr.Name)
+		}
+		if first {
+			if hdr.Name != assertionsEntry {
+				return nil, fmt.Errorf("cannot unpack snap bundle: expected %q as first entry, got %q", assertionsEntry, hdr.Name)
+			}
+			if err := b.readAssertions(tr); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if strings.ContainsRune(hdr.Name, '/') || !strings.HasSuffix(hdr.Name, ".snap") {
+			return nil, fmt.Errorf("cannot unpack snap bundle: unexpected entry %q", hdr.Name)
+		}
+		snapPath, err := unpackSnap(tr, dir, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("cannot unpack snap %q from bundle: %v", hdr.Name, err)
+		}
+		b.Snaps = append(b.Snaps, snapPath)
+		b.Names = append(b.Names, hdr.Name)
+	}
+	if len(b.Snaps) == 0 {
+		return nil, fmt.Errorf("cannot unpack snap bundle: no snaps in bundle")
+	}
+	return b, nil
+}
+
+func (b *Bundle) readAssertions(r io.Reader) error {
+	dec := asserts.NewDecoder(r)
+	for {
+		a, err := dec.Decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read snap bundle assertions: %v", err)
+		}
+		b.Assertions = append(b.Assertions, a)
+	}
+}
+
+func unpackSnap(r io.Reader, dir, prefix string) (string, error) {
+	tmpf, err := ioutil.TempFile(dir, prefix)
+	if err != nil {
+		return "", err
+	}
+	defer tmpf.Close()
+	if _, err := io.Copy(tmpf, r); err != nil {
+		os.Remove(tmpf.Name())
+		return "", err
+	}
+	if err := tmpf.Sync(); err != nil {
+		os.Remove(tmpf.Name())
+		return "", err
+	}
+	return tmpf.Name(), nil
+}
@@ -0,0 +1,143 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapbundle_test
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/snap/snapbundle"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type bundleSuite struct {
+	storeSigning *assertstest.StoreStack
+	dir          string
+}
+
+var _ = Suite(&bundleSuite{})
+
+func (s *bundleSuite) SetUpTest(c *C) {
+	s.storeSigning = assertstest.NewStoreStack("can0nical", nil)
+	s.dir = c.MkDir()
+}
+
+func (s *bundleSuite) writeFile(c *C, name, content string) string {
+	p := filepath.Join(s.dir, name)
+	c.Assert(ioutil.WriteFile(p, []byte(content), 0644), IsNil)
+	return p
+}
+
+func (s *bundleSuite) writeBundle(c *C, as []asserts.Assertion, snaps ...string) string {
+	bundlePath := filepath.Join(s.dir, "foo_1.bundle")
+	f, err := os.Create(bundlePath)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	w := snapbundle.NewWriter(f)
+	c.Assert(w.WriteAssertions(as), IsNil)
+	for _, snapPath := range snaps {
+		c.Assert(w.AddSnap(snapPath), IsNil)
+	}
+	c.Assert(w.Close(), IsNil)
+	return bundlePath
+}
+
+func (s *bundleSuite) TestRoundTrip(c *C) {
+	dev1Acct := assertstest.NewAccount(s.storeSigning, "devel1", nil, "")
+	as := []asserts.Assertion{s.storeSigning.StoreAccountKey(""), dev1Acct}
+	base := s.writeFile(c, "core20_1.snap", "base")
+	app := s.writeFile(c, "foo_1.snap", "app")
+
+	bundlePath := s.writeBundle(c, as, base, app)
+	c.Check(snapbundle.IsBundle(bundlePath), Equals, true)
+	c.Check(snapbundle.IsBundle(app), Equals, false)
+
+	target := c.MkDir()
+	b, err := snapbundle.Unpack(bundlePath, target, "prefix-")
+	c.Assert(err, IsNil)
+	c.Assert(b.Assertions, HasLen, 2)
+	c.Check(b.Assertions[0].Type(), Equals, asserts.AccountKeyType)
+	c.Check(b.Assertions[1], DeepEquals, asserts.Assertion(dev1Acct))
+	c.Check(b.Names, DeepEquals, []string{"core20_1.snap", "foo_1.snap"})
+	c.Assert(b.Snaps, HasLen, 2)
+	c.Check(b.Snaps[0], Matches, filepath.Join(target, "prefix-")+".*")
+	c.Check(b.Snaps[0], testutil.FileEquals, "base")
+	c.Check(b.Snaps[1], testutil.FileEquals, "app")
+}
+
+func (s *bundleSuite) TestWriterOrder(c *C) {
+	w := snapbundle.NewWriter(ioutil.Discard)
+	c.Check(w.AddSnap(s.writeFile(c, "foo_1.snap", "app")), ErrorMatches, "internal error: bundle assertions must be written before snaps")
+	c.Assert(w.WriteAssertions(nil), IsNil)
+	c.Check(w.WriteAssertions(nil), ErrorMatches, "internal error: bundle assertions already written")
+}
+
+func (s *bundleSuite) writeTar(c *C, entries ...[2]string) string {
+	p := filepath.Join(s.dir, "bad.bundle")
+	f, err := os.Create(p)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	for _, e := range entries {
+		c.Assert(tw.WriteHeader(&tar.Header{
+			Name:     e[0],
+			Mode:     0644,
+			Size:     int64(len(e[1])),
+			ModTime:  time.Now(),
+			Typeflag: tar.TypeReg,
+		}), IsNil)
+		_, err := tw.Write([]byte(e[1]))
+		c.Assert(err, IsNil)
+	}
+	c.Assert(tw.Close(), IsNil)
+	return p
+}
+
+func (s *bundleSuite) TestUnpackErrors(c *C) {
+	for _, t := range []struct {
+		entries [][2]string
+		err     string
+	}{
+		{nil, `cannot unpack snap bundle: empty bundle`},
+		{[][2]string{{"foo_1.snap", "app"}}, `cannot unpack snap bundle: expected "bundle.assert" as first entry, got "foo_1.snap"`},
+		{[][2]string{{"bundle.assert", ""}}, `cannot unpack snap bundle: no snaps in bundle`},
+		{[][2]string{{"bundle.assert", "garbage"}}, `cannot read snap bundle assertions: .*`},
+		{[][2]string{{"bundle.assert", ""}, {"foo_1.snap", "app"}, {"../bar_1.snap", "app"}}, `cannot unpack snap bundle: unexpected entry "../bar_1.snap"`},
+		{[][2]string{{"bundle.assert", ""}, {"foo_1.snap", "app"}, {"README", "hi"}}, `cannot unpack snap bundle: unexpected entry "README"`},
+	} {
+		target := c.MkDir()
+		_, err := snapbundle.Unpack(s.writeTar(c, t.entries...), target, "prefix-")
+		c.Check(err, ErrorMatches, t.err)
+		// nothing is left behind
+		leftover, _ := filepath.Glob(filepath.Join(target, "*"))
+		c.Check(leftover, HasLen, 0)
+	}
+}
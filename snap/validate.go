@@ -513,6 +513,10 @@ func validateAppOrderNames(app *AppInfo, dependencies []string) error {
 		if !other.IsService() {
 			return fmt.Errorf("before/after references a non-service application %q", dep)
 		}
+
+		if (other.DaemonScope == UserDaemon) != (app.DaemonScope == UserDaemon) {
+			return fmt.Errorf("before/after references service with different daemon-scope %q", dep)
+		}
 	}
 	return nil
 }
@@ -556,6 +560,53 @@ func validateAppTimer(app *AppInfo) error {
 	return nil
 }
 
+// validDBusBusName matches well-known D-Bus bus names, which are also used
+// as the names of the D-Bus service activation files.
+var validDBusBusName = regexp.MustCompile(`^[A-Za-z_-][A-Za-z0-9_-]*(\.[A-Za-z_-][A-Za-z0-9_-]*)+$`)
+
+func validateAppActivatesOn(app *AppInfo) error {
+	if len(app.ActivatesOn) == 0 {
+		return nil
+	}
+
+	if !app.IsService() {
+		return errors.New("activates-on is only applicable to services")
+	}
+
+	for _, slot := range app.ActivatesOn {
+		if slot.Interface != "dbus" {
+			return fmt.Errorf("invalid activates-on value %q: slot does not use dbus interface", slot.Name)
+		}
+
+		scope, expectedBus := SystemDaemon, "system"
+		if app.DaemonScope == UserDaemon {
+			scope, expectedBus = UserDaemon, "session"
+		}
+		bus, _ := slot.Attrs["bus"].(string)
+		if bus != expectedBus {
+			return fmt.Errorf("invalid activates-on value %q: bus %q does not match daemon-scope %q", slot.Name, bus, scope)
+		}
+
+		name, _ := slot.Attrs["name"].(string)
+		if len(name) > 255 || !validDBusBusName.MatchString(name) {
+			return fmt.Errorf("invalid activates-on value %q: invalid bus name %q", slot.Name, name)
+		}
+
+		// the bus name can only activate a single service
+		for _, other := range slot.Apps {
+			if other == app {
+				continue
+			}
+			for _, otherSlot := range other.ActivatesOn {
+				if otherSlot == slot {
+					return fmt.Errorf("invalid activates-on value %q: slot is also activatable on app %q", slot.Name, other.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
 func validateAppRestart(app *AppInfo) error {
 	// app.RestartCond value is validated when unmarshalling
 
@@ -602,6 +653,13 @@ func ValidateApp(app *AppInfo) error {
 		return fmt.Errorf(`"daemon" field contains invalid value %q`, app.Daemon)
 	}
 
+	if err := app.DaemonScope.Validate(); err != nil {
+		return err
+	}
+	if app.DaemonScope != "" && app.Daemon == "" {
+		return fmt.Errorf(`"daemon-scope" cannot be used for %q, only for services`, app.Name)
+	}
+
 	// Validate app name
 	if !ValidAppName(app.Name) {
 		return fmt.Errorf("cannot have %q as app name - use letters, digits, and dash as separator", app.Name)
@@ -629,6 +687,10 @@ func ValidateApp(app *AppInfo) error {
 		}
 	}
 
+	if len(app.Sockets) > 0 && app.DaemonScope == UserDaemon {
+		return fmt.Errorf(`"sockets" cannot be used for %q, sockets are not supported for user daemons`, app.Name)
+	}
+
 	// Socket activation requires the "network-bind" plug
 	if len(app.Sockets) > 0 {
 		if _, ok := app.Plugs["network-bind"]; !ok {
@@ -656,6 +718,10 @@ func ValidateApp(app *AppInfo) error {
 		return err
 	}
 
+	if err := validateAppActivatesOn(app); err != nil {
+		return err
+	}
+
 	// validate stop-mode
 	if err := app.StopMode.Validate(); err != nil {
 		return err
@@ -673,6 +739,16 @@ func ValidateApp(app *AppInfo) error {
 	if app.RefreshMode != "" && app.Daemon == "" {
 		return fmt.Errorf(`"refresh-mode" cannot be used for %q, only for services`, app.Name)
 	}
+	// validate install-mode
+	switch app.InstallMode {
+	case "", "enable", "disable":
+		// valid
+	default:
+		return fmt.Errorf(`"install-mode" field contains invalid value %q`, app.InstallMode)
+	}
+	if app.InstallMode != "" && app.Daemon == "" {
+		return fmt.Errorf(`"install-mode" cannot be used for %q, only for services`, app.Name)
+	}
 
 	return validateAppTimer(app)
 }
@@ -434,6 +434,137 @@ func (s *ValidateSuite) TestAppRefreshMode(c *C) {
 	c.Check(err, ErrorMatches, `"refresh-mode" cannot be used for "foo", only for services`)
 }
 
+func (s *ValidateSuite) TestAppInstallMode(c *C) {
+	// check services
+	for _, t := range []struct {
+		installMode string
+		ok          bool
+	}{
+		// good
+		{"", true},
+		{"enable", true},
+		{"disable", true},
+		// bad
+		{"invalid-thing", false},
+	} {
+		if t.ok {
+			c.Check(ValidateApp(&AppInfo{Name: "foo", Daemon: "simple", InstallMode: t.installMode}), IsNil)
+		} else {
+			c.Check(ValidateApp(&AppInfo{Name: "foo", Daemon: "simple", InstallMode: t.installMode}), ErrorMatches, fmt.Sprintf(`"install-mode" field contains invalid value %q`, t.installMode))
+		}
+	}
+
+	// non-services cannot have a install-mode
+	err := ValidateApp(&AppInfo{Name: "foo", Daemon: "", InstallMode: "disable"})
+	c.Check(err, ErrorMatches, `"install-mode" cannot be used for "foo", only for services`)
+}
+
+func (s *ValidateSuite) TestAppDaemonScope(c *C) {
+	for _, t := range []struct {
+		daemonScope DaemonScope
+		ok          bool
+	}{
+		// good
+		{"", true},
+		{SystemDaemon, true},
+		{UserDaemon, true},
+		// bad
+		{"invalid-thing", false},
+	} {
+		if t.ok {
+			c.Check(ValidateApp(&AppInfo{Name: "foo", Daemon: "simple", DaemonScope: t.daemonScope}), IsNil)
+		} else {
+			c.Check(ValidateApp(&AppInfo{Name: "foo", Daemon: "simple", DaemonScope: t.daemonScope}), ErrorMatches, fmt.Sprintf(`"daemon-scope" field contains invalid value %q`, t.daemonScope))
+		}
+	}
+
+	// non-services cannot have a daemon-scope
+	err := ValidateApp(&AppInfo{Name: "foo", DaemonScope: UserDaemon})
+	c.Check(err, ErrorMatches, `"daemon-scope" cannot be used for "foo", only for services`)
+
+	// user daemons cannot be socket activated
+	app := &AppInfo{Name: "foo", Daemon: "simple", DaemonScope: UserDaemon}
+	app.Sockets = map[string]*SocketInfo{"sock": {App: app, Name: "sock", ListenStream: "$SNAP_DATA/sock"}}
+	err = ValidateApp(app)
+	c.Check(err, ErrorMatches, `"sockets" cannot be used for "foo", sockets are not supported for user daemons`)
+}
+
+func (s *ValidateSuite) TestAppOrderingAcrossDaemonScopes(c *C) {
+	info, err := InfoFromSnapYaml([]byte(`name: foo
+version: 1.0
+apps:
+ foo:
+   daemon: simple
+   daemon-scope: user
+   after: [bar]
+ bar:
+   daemon: simple
+`))
+	c.Assert(err, IsNil)
+	err = Validate(info)
+	c.Check(err, ErrorMatches, `invalid definition of application "foo": before/after references service with different daemon-scope "bar"`)
+}
+
+func (s *ValidateSuite) TestAppActivatesOn(c *C) {
+	const yamlTemplate = `name: foo
+version: 1.0
+slots:
+  dbus-slot:
+    interface: %s
+    bus: %s
+    name: %s
+apps:
+  foo:
+    %s
+    activates-on: [dbus-slot]
+`
+	for _, t := range []struct {
+		iface, bus, name, app string
+		err                   string
+	}{
+		// good
+		{"dbus", "system", "org.example.Foo", "daemon: simple", ""},
+		{"dbus", "session", "org.example.Foo", "daemon: simple\n    daemon-scope: user", ""},
+		// bad
+		{"dbus", "system", "org.example.Foo", "command: foo", `activates-on is only applicable to services`},
+		{"dbus-other", "system", "org.example.Foo", "daemon: simple", `invalid activates-on value "dbus-slot": slot does not use dbus interface`},
+		{"dbus", "session", "org.example.Foo", "daemon: simple", `invalid activates-on value "dbus-slot": bus "session" does not match daemon-scope "system"`},
+		{"dbus", "system", "org.example.Foo", "daemon: simple\n    daemon-scope: user", `invalid activates-on value "dbus-slot": bus "system" does not match daemon-scope "user"`},
+		{"dbus", "system", "org/example", "daemon: simple", `invalid activates-on value "dbus-slot": invalid bus name "org/example"`},
+		{"dbus", "system", "foo", "daemon: simple", `invalid activates-on value "dbus-slot": invalid bus name "foo"`},
+	} {
+		info, err := InfoFromSnapYaml([]byte(fmt.Sprintf(yamlTemplate, t.iface, t.bus, t.name, t.app)))
+		c.Assert(err, IsNil)
+		err = ValidateApp(info.Apps["foo"])
+		if t.err == "" {
+			c.Check(err, IsNil, Commentf("%v", t))
+		} else {
+			c.Check(err, ErrorMatches, t.err, Commentf("%v", t))
+		}
+	}
+}
+
+func (s *ValidateSuite) TestAppActivatesOnMultipleApps(c *C) {
+	info, err := InfoFromSnapYaml([]byte(`name: foo
+version: 1.0
+slots:
+  dbus-slot:
+    interface: dbus
+    bus: system
+    name: org.example.Foo
+apps:
+  foo:
+    daemon: simple
+    activates-on: [dbus-slot]
+  bar:
+    daemon: simple
+    activates-on: [dbus-slot]
+`))
+	c.Assert(err, IsNil)
+	err = ValidateApp(info.Apps["foo"])
+	c.Check(err, ErrorMatches, `invalid activates-on value "dbus-slot": slot is also activatable on app "bar"`)
+}
+
 func (s *ValidateSuite) TestAppWhitelistError(c *C) {
 	err := ValidateApp(&AppInfo{Name: "foo", Command: "x\n"})
 	c.Assert(err, NotNil)
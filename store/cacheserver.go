@@ -0,0 +1,487 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/snap"
+)
+
+const cacheServerDownloadPath = "download"
+
+// CacheServer serves the snaps of a store download cache and the
+// assertions known to the system over the subset of the store API used
+// by SnapAction, Assertion, SeqFormingAssertion and snap downloads. It
+// lets other devices use a machine as their store to avoid downloading
+// again the revisions it already has.
+//
+// The download cache carries no channel information, installs and
+// refreshes get the highest revision available in the cache unless a
+// specific revision is asked for.
+type CacheServer struct {
+	cacheDir string
+	withDB   func(func(db asserts.RODatabase) error) error
+}
+
+// NewCacheServer returns a CacheServer serving the snaps in cacheDir.
+// withDB must call the given function with the system assertion
+// database, holding any lock needed to access it.
+func NewCacheServer(cacheDir string, withDB func(f func(db asserts.RODatabase) error) error) *CacheServer {
+	return &CacheServer{
+		cacheDir: cacheDir,
+		withDB:   withDB,
+	}
+}
+
+func (srv *CacheServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+	switch {
+	case p == snapActionEndpPath && r.Method == "POST":
+		srv.snapAction(w, r)
+	case strings.HasPrefix(p, assertionsPath+"/") && r.Method == "GET":
+		srv.assertion(w, r, strings.TrimPrefix(p, assertionsPath+"/"))
+	case strings.HasPrefix(p, cacheServerDownloadPath+"/") && (r.Method == "GET" || r.Method == "HEAD"):
+		srv.download(w, r, strings.TrimPrefix(p, cacheServerDownloadPath+"/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// cache keys are hex encoded digests
+var validCacheKey = regexp.MustCompile(`^[a-f0-9]+$`)
+
+// cacheKey returns the key of the snap file of snapRev in the download
+// cache, which like the store uses hex encoded digests.
+func cacheKey(snapRev *asserts.SnapRevision) string {
+	digest, err := base64.RawURLEncoding.DecodeString(snapRev.SnapSHA3_384())
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(digest)
+}
+
+func (srv *CacheServer) cachePath(cacheKey string) string {
+	if !validCacheKey.MatchString(cacheKey) {
+		return ""
+	}
+	p := filepath.Join(srv.cacheDir, cacheKey)
+	if _, err := os.Stat(p); err != nil {
+		return ""
+	}
+	return p
+}
+
+func (srv *CacheServer) download(w http.ResponseWriter, r *http.Request, name string) {
+	p := srv.cachePath(strings.TrimSuffix(name, ".snap"))
+	if p == "" {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "", st.ModTime(), f)
+}
+
+func writeAssertionSvcError(w http.ResponseWriter, status int, title, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&assertionSvcError{
+		Status: status,
+		Title:  title,
+		Detail: detail,
+	})
+}
+
+type sequenceMember interface {
+	Sequence() int
+}
+
+func findAssertion(db asserts.RODatabase, assertType *asserts.AssertionType, primaryKey []string, sequence string) (asserts.Assertion, error) {
+	if sequence == "" {
+		headers, err := asserts.HeadersFromPrimaryKey(assertType, primaryKey)
+		if err != nil {
+			return nil, &asserts.NotFoundError{Type: assertType}
+		}
+		return db.Find(assertType, headers)
+	}
+
+	n := len(assertType.PrimaryKey)
+	if n == 0 || assertType.PrimaryKey[n-1] != "sequence" || len(primaryKey) != n-1 {
+		return nil, &asserts.NotFoundError{Type: assertType}
+	}
+	headers := make(map[string]string, n)
+	for i, k := range assertType.PrimaryKey[:n-1] {
+		headers[k] = primaryKey[i]
+	}
+	if sequence != "latest" {
+		headers["sequence"] = sequence
+	}
+	as, err := db.FindMany(assertType, headers)
+	if err != nil {
+		return nil, err
+	}
+	var latest asserts.Assertion
+	for _, a := range as {
+		seqa, ok := a.(sequenceMember)
+		if !ok {
+			continue
+		}
+		if latest == nil || seqa.Sequence() > latest.(sequenceMember).Sequence() {
+			latest = a
+		}
+	}
+	if latest == nil {
+		return nil, &asserts.NotFoundError{Type: assertType, Headers: headers}
+	}
+	return latest, nil
+}
+
+// cacheServerAssertionTypes are the types of the assertions served, the
+// ones needed to install snaps from the cache; others, like serials or
+// system-users, are kept private.
+var cacheServerAssertionTypes = map[*asserts.AssertionType]bool{
+	asserts.SnapDeclarationType: true,
+	asserts.SnapRevisionType:    true,
+	asserts.AccountType:         true,
+	asserts.AccountKeyType:      true,
+	asserts.StoreType:           true,
+	asserts.ValidationSetType:   true,
+}
+
+func (srv *CacheServer) assertion(w http.ResponseWriter, r *http.Request, p string) {
+	comps := strings.Split(p, "/")
+	assertType := asserts.Type(comps[0])
+	if assertType == nil || !cacheServerAssertionTypes[assertType] {
+		writeAssertionSvcError(w, 404, "not found", fmt.Sprintf("unknown assertion type %q", comps[0]))
+		return
+	}
+
+	var a asserts.Assertion
+	err := srv.withDB(func(db asserts.RODatabase) error {
+		var err error
+		a, err = findAssertion(db, assertType, comps[1:], r.URL.Query().Get("sequence"))
+		return err
+	})
+	if asserts.IsNotFound(err) {
+		writeAssertionSvcError(w, 404, "not found", "assertion not found")
+		return
+	}
+	if err != nil {
+		writeAssertionSvcError(w, 500, "internal error", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", asserts.MediaType)
+	if err := asserts.NewEncoder(w).Encode(a); err != nil {
+		logger.Noticef("cannot send assertion: %v", err)
+	}
+}
+
+// cacheServerSnap is the subset of storeSnap served by the cache server.
+type cacheServerSnap struct {
+	Architectures []string          `json:"architectures"`
+	Base          string            `json:"base"`
+	Confinement   string            `json:"confinement"`
+	CreatedAt     string            `json:"created-at"`
+	Description   string            `json:"description"`
+	Download      storeSnapDownload `json:"download"`
+	Epoch         snap.Epoch        `json:"epoch"`
+	License       string            `json:"license"`
+	Name          string            `json:"name"`
+	Publisher     snap.StoreAccount `json:"publisher"`
+	Revision      int               `json:"revision"`
+	SnapID        string            `json:"snap-id"`
+	SnapYAML      string            `json:"snap-yaml"`
+	Summary       string            `json:"summary"`
+	Title         string            `json:"title"`
+	Type          snap.Type         `json:"type"`
+	Version       string            `json:"version"`
+}
+
+type cacheServerError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type cacheServerActionResult struct {
+	Result           string            `json:"result"`
+	InstanceKey      string            `json:"instance-key"`
+	SnapID           string            `json:"snap-id,omitempty"`
+	Name             string            `json:"name,omitempty"`
+	Snap             *cacheServerSnap  `json:"snap,omitempty"`
+	EffectiveChannel string            `json:"effective-channel,omitempty"`
+	Error            *cacheServerError `json:"error,omitempty"`
+}
+
+// overridden in the unit tests
+var cacheServerReadSnapYaml = func(snapPath string) ([]byte, error) {
+	snapf, err := snap.Open(snapPath)
+	if err != nil {
+		return nil, err
+	}
+	return snapf.ReadFile("meta/snap.yaml")
+}
+
+// cachedRevisions returns the snap-revisions for the given snap whose
+// snap files are in the cache, highest revision first.
+func (srv *CacheServer) cachedRevisions(db asserts.RODatabase, snapID string) ([]*asserts.SnapRevision, error) {
+	as, err := db.FindMany(asserts.SnapRevisionType, map[string]string{
+		"snap-id": snapID,
+	})
+	if err != nil && !asserts.IsNotFound(err) {
+		return nil, err
+	}
+	var revs []*asserts.SnapRevision
+	for _, a := range as {
+		snapRev := a.(*asserts.SnapRevision)
+		if srv.cachePath(cacheKey(snapRev)) != "" {
+			revs = append(revs, snapRev)
+		}
+	}
+	sort.Slice(revs, func(i, j int) bool {
+		return revs[i].SnapRevision() > revs[j].SnapRevision()
+	})
+	return revs, nil
+}
+
+func findSnapDeclaration(db asserts.RODatabase, snapID, name string) (*asserts.SnapDeclaration, error) {
+	headers := map[string]string{
+		"series": release.Series,
+	}
+	if snapID != "" {
+		headers["snap-id"] = snapID
+	} else {
+		headers["snap-name"] = name
+	}
+	as, err := db.FindMany(asserts.SnapDeclarationType, headers)
+	if err != nil {
+		return nil, err
+	}
+	return as[0].(*asserts.SnapDeclaration), nil
+}
+
+func (srv *CacheServer) cachedSnap(snapRev *asserts.SnapRevision, snapDecl *asserts.SnapDeclaration, baseURL string) (*cacheServerSnap, error) {
+	key := cacheKey(snapRev)
+	snapPath := srv.cachePath(key)
+	snapYaml, err := cacheServerReadSnapYaml(snapPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := snap.InfoFromSnapYaml(snapYaml)
+	if err != nil {
+		return nil, err
+	}
+	return &cacheServerSnap{
+		Architectures: info.Architectures,
+		Base:          info.Base,
+		Confinement:   string(info.Confinement),
+		CreatedAt:     snapRev.Timestamp().Format(time.RFC3339),
+		Description:   info.OriginalDescription,
+		Download: storeSnapDownload{
+			Sha3_384: key,
+			Size:     int64(snapRev.SnapSize()),
+			URL:      baseURL + path.Join(cacheServerDownloadPath, key+".snap"),
+		},
+		Epoch:     info.Epoch,
+		License:   info.License,
+		Name:      snapDecl.SnapName(),
+		Publisher: snap.StoreAccount{ID: snapDecl.PublisherID()},
+		Revision:  snapRev.SnapRevision(),
+		SnapID:    snapDecl.SnapID(),
+		SnapYAML:  string(snapYaml),
+		Summary:   info.OriginalSummary,
+		Title:     info.OriginalTitle,
+		Type:      info.SnapType,
+		Version:   info.Version,
+	}, nil
+}
+
+// snapActionResult resolves the given action, returning the snap-revision
+// and snap-declaration of the snap to send, if any.
+func (srv *CacheServer) snapActionResult(db asserts.RODatabase, a *snapActionJSON, cur *currentSnapV2JSON) (*cacheServerActionResult, *asserts.SnapRevision, *asserts.SnapDeclaration) {
+	res := &cacheServerActionResult{
+		InstanceKey: a.InstanceKey,
+		SnapID:      a.SnapID,
+		Name:        a.Name,
+	}
+	fail := func(code, format string, v ...interface{}) (*cacheServerActionResult, *asserts.SnapRevision, *asserts.SnapDeclaration) {
+		res.Result = "error"
+		res.Error = &cacheServerError{Code: code, Message: fmt.Sprintf(format, v...)}
+		return res, nil, nil
+	}
+
+	snapID := a.SnapID
+	if snapID == "" && cur != nil {
+		snapID = cur.SnapID
+	}
+	snapDecl, err := findSnapDeclaration(db, snapID, a.Name)
+	if asserts.IsNotFound(err) {
+		if snapID != "" {
+			return fail("id-not-found", "No snap with id %q in the cache", snapID)
+		}
+		return fail("name-not-found", "No snap named %q in the cache", a.Name)
+	}
+	if err != nil {
+		return fail("internal-error", "%v", err)
+	}
+	res.SnapID = snapDecl.SnapID()
+	res.Name = snapDecl.SnapName()
+
+	revs, err := srv.cachedRevisions(db, snapDecl.SnapID())
+	if err != nil {
+		return fail("internal-error", "%v", err)
+	}
+	var snapRev *asserts.SnapRevision
+	for _, rev := range revs {
+		if a.Revision == 0 || rev.SnapRevision() == a.Revision {
+			snapRev = rev
+			break
+		}
+	}
+	if snapRev == nil {
+		return fail("revision-not-found", "No revision of snap %q in the cache", snapDecl.SnapName())
+	}
+
+	res.Result = a.Action
+	res.EffectiveChannel = a.Channel
+	if res.EffectiveChannel == "" && cur != nil {
+		res.EffectiveChannel = cur.TrackingChannel
+	}
+	return res, snapRev, snapDecl
+}
+
+// cacheServerAction is a snap action resolved against the assertion
+// database, the details of its snap are read from the cache once the
+// database is released.
+type cacheServerAction struct {
+	res      *cacheServerActionResult
+	cur      *currentSnapV2JSON
+	snapRev  *asserts.SnapRevision
+	snapDecl *asserts.SnapDeclaration
+}
+
+func (srv *CacheServer) addSnap(act *cacheServerAction, baseURL string) {
+	snapName := act.snapDecl.SnapName()
+	cached, err := srv.cachedSnap(act.snapRev, act.snapDecl, baseURL)
+	if err != nil {
+		act.res.Result = "error"
+		act.res.EffectiveChannel = ""
+		act.res.Error = &cacheServerError{
+			Code:    "internal-error",
+			Message: fmt.Sprintf("cannot read snap %q from the cache: %v", snapName, err),
+		}
+		return
+	}
+	if act.res.Result == "refresh" && act.snapRev.SnapRevision() <= act.cur.Revision {
+		// nothing newer, the client sees the current revision
+		// as no update being available
+		cached.Revision = act.cur.Revision
+	}
+	act.res.Snap = cached
+}
+
+func (srv *CacheServer) snapAction(w http.ResponseWriter, r *http.Request) {
+	var req snapActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("cannot decode snap action request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	baseURL := fmt.Sprintf("%s://%s/", scheme, r.Host)
+
+	curSnaps := make(map[string]*currentSnapV2JSON, len(req.Context))
+	for _, cur := range req.Context {
+		curSnaps[cur.InstanceKey] = cur
+	}
+
+	acts := make([]*cacheServerAction, 0, len(req.Actions))
+	err := srv.withDB(func(db asserts.RODatabase) error {
+		for _, a := range req.Actions {
+			cur := curSnaps[a.InstanceKey]
+			if a.Action == "refresh" && cur == nil {
+				acts = append(acts, &cacheServerAction{res: &cacheServerActionResult{
+					Result:      "error",
+					InstanceKey: a.InstanceKey,
+					SnapID:      a.SnapID,
+					Error: &cacheServerError{
+						Code:    "invalid-request",
+						Message: "refresh action without context",
+					},
+				}})
+				continue
+			}
+			res, snapRev, snapDecl := srv.snapActionResult(db, a, cur)
+			acts = append(acts, &cacheServerAction{
+				res:      res,
+				cur:      cur,
+				snapRev:  snapRev,
+				snapDecl: snapDecl,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the snap files are read without holding the database
+	results := make([]*cacheServerActionResult, 0, len(acts))
+	for _, act := range acts {
+		if act.snapRev != nil {
+			srv.addSnap(act, baseURL)
+		}
+		results = append(results, act.res)
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results": results,
+	})
+}
@@ -0,0 +1,310 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/store"
+	"github.com/snapcore/snapd/testutil"
+)
+
+// hexDigest returns the download cache key for the given snap digest.
+func hexDigest(c *C, sha3_384 string) string {
+	digest, err := base64.RawURLEncoding.DecodeString(sha3_384)
+	c.Assert(err, IsNil)
+	return hex.EncodeToString(digest)
+}
+
+type cacheServerSuite struct {
+	testutil.BaseTest
+
+	storeSigning *assertstest.StoreStack
+	db           *asserts.Database
+	cacheDir     string
+	srv          *httptest.Server
+	sto          *store.Store
+
+	snapRevs map[int]*asserts.SnapRevision
+	snapDecl asserts.Assertion
+
+	// whether the assertion database is in use
+	inDB bool
+}
+
+var _ = Suite(&cacheServerSuite{})
+
+func (s *cacheServerSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+	s.AddCleanup(snap.MockSanitizePlugsSlots(func(snapInfo *snap.Info) {}))
+
+	s.storeSigning = assertstest.NewStoreStack("can0nical", nil)
+	db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{
+		Backstore: asserts.NewMemoryBackstore(),
+		Trusted:   s.storeSigning.Trusted,
+	})
+	c.Assert(err, IsNil)
+	s.db = db
+	c.Assert(db.Add(s.storeSigning.StoreAccountKey("")), IsNil)
+
+	devAcct := assertstest.NewAccount(s.storeSigning, "devel1", nil, "")
+	c.Assert(db.Add(devAcct), IsNil)
+	s.snapDecl, err = s.storeSigning.Sign(asserts.SnapDeclarationType, map[string]interface{}{
+		"series":       "16",
+		"snap-id":      "foo-id",
+		"snap-name":    "foo",
+		"publisher-id": devAcct.AccountID(),
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	c.Assert(db.Add(s.snapDecl), IsNil)
+
+	s.cacheDir = c.MkDir()
+	s.snapRevs = make(map[int]*asserts.SnapRevision)
+	for _, rev := range []int{1, 2, 3} {
+		content := fmt.Sprintf("foo-rev-%d", rev)
+		p := filepath.Join(c.MkDir(), "snap")
+		c.Assert(ioutil.WriteFile(p, []byte(content), 0644), IsNil)
+		sha3_384, size, err := asserts.SnapFileSHA3_384(p)
+		c.Assert(err, IsNil)
+		a, err := s.storeSigning.Sign(asserts.SnapRevisionType, map[string]interface{}{
+			"snap-sha3-384": sha3_384,
+			"snap-size":     fmt.Sprint(size),
+			"snap-id":       "foo-id",
+			"snap-revision": fmt.Sprint(rev),
+			"developer-id":  devAcct.AccountID(),
+			"timestamp":     time.Now().Format(time.RFC3339),
+		}, nil, "")
+		c.Assert(err, IsNil)
+		c.Assert(db.Add(a), IsNil)
+		s.snapRevs[rev] = a.(*asserts.SnapRevision)
+		// revision 3 is known but not in the cache
+		if rev != 3 {
+			c.Assert(os.Rename(p, filepath.Join(s.cacheDir, hexDigest(c, sha3_384))), IsNil)
+		}
+	}
+
+	s.AddCleanup(store.MockCacheServerReadSnapYaml(func(snapPath string) ([]byte, error) {
+		c.Check(filepath.Dir(snapPath), Equals, s.cacheDir)
+		// the snap files are not read while holding the database
+		c.Check(s.inDB, Equals, false)
+		return []byte("name: foo\nversion: 1.0\nbase: core20\nsummary: a foo\n"), nil
+	}))
+
+	withDB := func(f func(db asserts.RODatabase) error) error {
+		s.inDB = true
+		defer func() { s.inDB = false }()
+		return f(s.db)
+	}
+	s.srv = httptest.NewServer(store.NewCacheServer(s.cacheDir, withDB))
+	s.AddCleanup(s.srv.Close)
+
+	u, err := url.Parse(s.srv.URL)
+	c.Assert(err, IsNil)
+	s.sto = store.New(&store.Config{
+		StoreBaseURL:      u,
+		AssertionsBaseURL: u,
+	}, nil)
+}
+
+func (s *cacheServerSuite) TestInstall(c *C) {
+	results, err := s.sto.SnapAction(context.TODO(), nil, []*store.SnapAction{{
+		Action:       "install",
+		InstanceName: "foo",
+		Channel:      "stable",
+	}}, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 1)
+	info := results[0]
+	c.Check(info.SnapName(), Equals, "foo")
+	c.Check(info.SnapID, Equals, "foo-id")
+	// the highest revision in the cache
+	c.Check(info.Revision, Equals, snap.R(2))
+	c.Check(info.Version, Equals, "1.0")
+	c.Check(info.Base, Equals, "core20")
+	c.Check(info.SnapType, Equals, snap.TypeApp)
+	c.Check(info.Summary(), Equals, "a foo")
+	c.Check(info.Channel, Equals, "stable")
+	key := hexDigest(c, s.snapRevs[2].SnapSHA3_384())
+	c.Check(info.Sha3_384, Equals, key)
+	c.Check(info.DownloadURL, Equals, s.srv.URL+"/download/"+key+".snap")
+
+	// and the snap can be downloaded from there
+	target := filepath.Join(c.MkDir(), "foo_2.snap")
+	err = s.sto.Download(context.TODO(), "foo", target, &info.DownloadInfo, nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(target, testutil.FileEquals, "foo-rev-2")
+}
+
+func (s *cacheServerSuite) TestInstallRevision(c *C) {
+	results, err := s.sto.SnapAction(context.TODO(), nil, []*store.SnapAction{{
+		Action:       "download",
+		InstanceName: "foo",
+		Revision:     snap.R(1),
+	}}, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 1)
+	c.Check(results[0].Revision, Equals, snap.R(1))
+
+	// revision 3 is not in the cache
+	_, err = s.sto.SnapAction(context.TODO(), nil, []*store.SnapAction{{
+		Action:       "install",
+		InstanceName: "foo",
+		Revision:     snap.R(3),
+	}}, nil, nil)
+	c.Assert(err, FitsTypeOf, &store.SnapActionError{})
+	c.Check(err.(*store.SnapActionError).Install["foo"], FitsTypeOf, &store.RevisionNotAvailableError{})
+}
+
+func (s *cacheServerSuite) TestInstallNotFound(c *C) {
+	_, err := s.sto.SnapAction(context.TODO(), nil, []*store.SnapAction{{
+		Action:       "install",
+		InstanceName: "bar",
+	}}, nil, nil)
+	c.Assert(err, FitsTypeOf, &store.SnapActionError{})
+	c.Check(err.(*store.SnapActionError).Install["bar"], Equals, store.ErrSnapNotFound)
+}
+
+func (s *cacheServerSuite) TestRefresh(c *C) {
+	current := []*store.CurrentSnap{{
+		InstanceName:    "foo",
+		SnapID:          "foo-id",
+		Revision:        snap.R(1),
+		TrackingChannel: "stable",
+	}}
+	results, err := s.sto.SnapAction(context.TODO(), current, []*store.SnapAction{{
+		Action:       "refresh",
+		InstanceName: "foo",
+		SnapID:       "foo-id",
+	}}, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 1)
+	c.Check(results[0].Revision, Equals, snap.R(2))
+
+	// nothing newer in the cache
+	current[0].Revision = snap.R(2)
+	_, err = s.sto.SnapAction(context.TODO(), current, []*store.SnapAction{{
+		Action:       "refresh",
+		InstanceName: "foo",
+		SnapID:       "foo-id",
+	}}, nil, nil)
+	c.Assert(err, FitsTypeOf, &store.SnapActionError{})
+	c.Check(err.(*store.SnapActionError).Refresh["foo"], Equals, store.ErrNoUpdateAvailable)
+}
+
+func (s *cacheServerSuite) TestAssertion(c *C) {
+	a, err := s.sto.Assertion(asserts.SnapDeclarationType, []string{"16", "foo-id"}, nil)
+	c.Assert(err, IsNil)
+	c.Check(a, DeepEquals, s.snapDecl)
+
+	a, err = s.sto.Assertion(asserts.SnapRevisionType, []string{s.snapRevs[3].SnapSHA3_384()}, nil)
+	c.Assert(err, IsNil)
+	c.Check(a, DeepEquals, asserts.Assertion(s.snapRevs[3]))
+
+	_, err = s.sto.Assertion(asserts.SnapDeclarationType, []string{"16", "bar-id"}, nil)
+	c.Check(asserts.IsNotFound(err), Equals, true)
+}
+
+func (s *cacheServerSuite) TestAssertionTypeNotServed(c *C) {
+	model, err := s.storeSigning.Sign(asserts.ModelType, map[string]interface{}{
+		"series":       "16",
+		"brand-id":     "can0nical",
+		"model":        "pc",
+		"architecture": "amd64",
+		"gadget":       "pc",
+		"kernel":       "pc-kernel",
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	c.Assert(s.db.Add(model), IsNil)
+
+	resp, err := http.Get(s.srv.URL + "/v2/assertions/model/16/can0nical/pc")
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Check(resp.StatusCode, Equals, 404)
+
+	_, err = s.sto.Assertion(asserts.ModelType, []string{"16", "can0nical", "pc"}, nil)
+	c.Check(asserts.IsNotFound(err), Equals, true)
+}
+
+func (s *cacheServerSuite) TestSeqFormingAssertion(c *C) {
+	for _, seq := range []int{1, 2} {
+		vs, err := s.storeSigning.Sign(asserts.ValidationSetType, map[string]interface{}{
+			"series":       "16",
+			"account-id":   "can0nical",
+			"authority-id": "can0nical",
+			"name":         "base-set",
+			"sequence":     fmt.Sprint(seq),
+			"snaps": []interface{}{
+				map[string]interface{}{
+					"name":     "foo",
+					"id":       "foosnapidxxxxxxxxxxxxxxxxxxxxxxx",
+					"presence": "required",
+				},
+			},
+			"timestamp": time.Now().Format(time.RFC3339),
+		}, nil, "")
+		c.Assert(err, IsNil)
+		c.Assert(s.db.Add(vs), IsNil)
+	}
+
+	a, err := s.sto.SeqFormingAssertion(asserts.ValidationSetType, []string{"16", "can0nical", "base-set"}, 0, nil)
+	c.Assert(err, IsNil)
+	c.Check(a.(*asserts.ValidationSet).Sequence(), Equals, 2)
+
+	a, err = s.sto.SeqFormingAssertion(asserts.ValidationSetType, []string{"16", "can0nical", "base-set"}, 1, nil)
+	c.Assert(err, IsNil)
+	c.Check(a.(*asserts.ValidationSet).Sequence(), Equals, 1)
+
+	_, err = s.sto.SeqFormingAssertion(asserts.ValidationSetType, []string{"16", "can0nical", "base-set"}, 3, nil)
+	c.Check(asserts.IsNotFound(err), Equals, true)
+}
+
+func (s *cacheServerSuite) TestDownloadOnlyFromCache(c *C) {
+	for _, p := range []string{
+		"/download/" + hexDigest(c, s.snapRevs[3].SnapSHA3_384()) + ".snap",
+		"/download/..%2F..%2Fetc%2Fpasswd",
+		"/download/",
+		"/v2/snaps/info/foo",
+	} {
+		resp, err := http.Get(s.srv.URL + p)
+		c.Assert(err, IsNil)
+		resp.Body.Close()
+		c.Check(resp.StatusCode, Equals, 404, Commentf(p))
+	}
+}
@@ -191,3 +191,11 @@ func MockRatelimitReader(f func(r io.Reader, bucket *ratelimit.Bucket) io.Reader
 		ratelimitReader = oldRatelimitReader
 	}
 }
+
+func MockCacheServerReadSnapYaml(f func(snapPath string) ([]byte, error)) (restore func()) {
+	old := cacheServerReadSnapYaml
+	cacheServerReadSnapYaml = f
+	return func() {
+		cacheServerReadSnapYaml = old
+	}
+}
@@ -373,7 +373,7 @@ func New(cfg *Config, dauthCtx DeviceAndAuthContext) *Store {
 		deltaFormat:     deltaFormat,
 		proxy:           cfg.Proxy,
 
-		client: httputil.NewHTTPClient(&httputil.ClientOptions{
+		client: newHTTPClient(&httputil.ClientOptions{
 			Timeout:    10 * time.Second,
 			MayLogBody: true,
 			Proxy:      cfg.Proxy,
@@ -384,6 +384,18 @@ func New(cfg *Config, dauthCtx DeviceAndAuthContext) *Store {
 	return store
 }
 
+// newHTTPClient returns a new http.Client that trusts in addition to
+// the system certificates the ones configured via store-certs.<name>.
+func newHTTPClient(opts *httputil.ClientOptions) *http.Client {
+	if opts == nil {
+		opts = &httputil.ClientOptions{}
+	}
+	opts.ExtraSSLCerts = &httputil.ExtraSSLCertsFromDir{
+		Dir: dirs.SnapdStoreSSLCertsDir,
+	}
+	return httputil.NewHTTPClient(opts)
+}
+
 // API endpoint paths
 const (
 	// see https://wiki.ubuntu.com/AppStore/Interfaces/ClickPackageIndex
@@ -1291,7 +1303,7 @@ func (s *Store) WriteCatalogs(ctx context.Context, names io.Writer, adder SnapAd
 	}
 
 	// do not log body for catalog updates (its huge)
-	client := httputil.NewHTTPClient(&httputil.ClientOptions{
+	client := newHTTPClient(&httputil.ClientOptions{
 		MayLogBody: false,
 		Timeout:    10 * time.Second,
 		Proxy:      s.proxy,
@@ -1522,7 +1534,7 @@ func downloadImpl(ctx context.Context, name, sha3_384, downloadURL string, user
 			return fmt.Errorf("The download has been cancelled: %s", ctx.Err())
 		}
 		var resp *http.Response
-		resp, finalErr = s.doRequest(ctx, httputil.NewHTTPClient(&httputil.ClientOptions{Proxy: s.proxy}), reqOptions, user)
+		resp, finalErr = s.doRequest(ctx, newHTTPClient(&httputil.ClientOptions{Proxy: s.proxy}), reqOptions, user)
 
 		if cancelled(ctx) {
 			return fmt.Errorf("The download has been cancelled: %s", ctx.Err())
@@ -1646,7 +1658,7 @@ var doDownloadReq = doDowloadReqImpl
 
 func doDowloadReqImpl(ctx context.Context, storeURL *url.URL, cdnHeader string, s *Store, user *auth.UserState) (*http.Response, error) {
 	reqOptions := downloadReqOpts(storeURL, cdnHeader, nil)
-	return s.doRequest(ctx, httputil.NewHTTPClient(&httputil.ClientOptions{Proxy: s.proxy}), reqOptions, user)
+	return s.doRequest(ctx, newHTTPClient(&httputil.ClientOptions{Proxy: s.proxy}), reqOptions, user)
 }
 
 // downloadDelta downloads the delta for the preferred format, returning the path.
@@ -1781,6 +1793,56 @@ func (s *Store) Assertion(assertType *asserts.AssertionType, primaryKey []string
 	v.Set("max-format", strconv.Itoa(assertType.MaxSupportedFormat()))
 	u := s.assertionsEndpointURL(path.Join(assertType.Name, path.Join(primaryKey...)), v)
 
+	notFound := func() error {
+		// best-effort
+		headers, _ := asserts.HeadersFromPrimaryKey(assertType, primaryKey)
+		return &asserts.NotFoundError{
+			Type:    assertType,
+			Headers: headers,
+		}
+	}
+	return s.assertion(u, notFound, user)
+}
+
+// SeqFormingAssertion retrieves the sequence-forming assertion of
+// the given type with the given sequence key (its primary key
+// without the sequence) at the given sequence point, or the latest
+// one if sequence is 0.
+func (s *Store) SeqFormingAssertion(assertType *asserts.AssertionType, sequenceKey []string, sequence int, user *auth.UserState) (asserts.Assertion, error) {
+	n := len(assertType.PrimaryKey)
+	if n == 0 || assertType.PrimaryKey[n-1] != "sequence" || len(sequenceKey) != n-1 {
+		return nil, fmt.Errorf("internal error: %q assertion cannot be retrieved by sequence key %v", assertType.Name, sequenceKey)
+	}
+	if sequence < 0 {
+		return nil, fmt.Errorf("internal error: invalid sequence %d for %q assertion", sequence, assertType.Name)
+	}
+
+	v := url.Values{}
+	v.Set("max-format", strconv.Itoa(assertType.MaxSupportedFormat()))
+	if sequence == 0 {
+		v.Set("sequence", "latest")
+	} else {
+		v.Set("sequence", strconv.Itoa(sequence))
+	}
+	u := s.assertionsEndpointURL(path.Join(assertType.Name, path.Join(sequenceKey...)), v)
+
+	notFound := func() error {
+		headers := make(map[string]string, n)
+		for i, k := range assertType.PrimaryKey[:n-1] {
+			headers[k] = sequenceKey[i]
+		}
+		if sequence > 0 {
+			headers["sequence"] = strconv.Itoa(sequence)
+		}
+		return &asserts.NotFoundError{
+			Type:    assertType,
+			Headers: headers,
+		}
+	}
+	return s.assertion(u, notFound, user)
+}
+
+func (s *Store) assertion(u *url.URL, notFound func() error, user *auth.UserState) (asserts.Assertion, error) {
 	reqOptions := &requestOptions{
 		Method: "GET",
 		URL:    u,
@@ -1806,12 +1868,7 @@ func (s *Store) Assertion(assertType *asserts.AssertionType, primaryKey []string
 					return fmt.Errorf("cannot decode assertion service error with HTTP status code %d: %v", resp.StatusCode, e)
 				}
 				if svcErr.Status == 404 {
-					// best-effort
-					headers, _ := asserts.HeadersFromPrimaryKey(assertType, primaryKey)
-					return &asserts.NotFoundError{
-						Type:    assertType,
-						Headers: headers,
-					}
+					return notFound()
 				}
 				return fmt.Errorf("assertion service error: [%s] %q", svcErr.Title, svcErr.Detail)
 			}
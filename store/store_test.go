@@ -3575,6 +3575,105 @@ func (s *storeTestSuite) TestAssertionNotFound(c *C) {
 	})
 }
 
+const testValidationSetAssertion = `type: validation-set
+authority-id: foo
+series: 16
+account-id: foo
+name: bar
+sequence: 3
+snaps:
+  -
+    name: baz
+    id: bazididididididididididididididi
+timestamp: 2020-11-06T09:16:26Z
+sign-key-sha3-384: Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij
+
+AXNpZw==
+`
+
+func (s *storeTestSuite) TestSeqFormingAssertion(c *C) {
+	var sequence string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assertRequest(c, r, "GET", "/api/v1/snaps/assertions/.*")
+		c.Check(r.Header.Get("Accept"), Equals, "application/x.ubuntu.assertion")
+		c.Check(r.URL.Path, Matches, ".*/validation-set/16/foo/bar")
+		c.Check(r.URL.Query().Get("max-format"), Equals, "0")
+		c.Check(r.URL.Query().Get("sequence"), Equals, sequence)
+		io.WriteString(w, testValidationSetAssertion)
+	}))
+
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	mockServerURL, _ := url.Parse(mockServer.URL)
+	cfg := store.Config{
+		AssertionsBaseURL: mockServerURL,
+	}
+	sto := store.New(&cfg, nil)
+
+	sequence = "latest"
+	a, err := sto.SeqFormingAssertion(asserts.ValidationSetType, []string{"16", "foo", "bar"}, 0, nil)
+	c.Assert(err, IsNil)
+	c.Check(a.Type(), Equals, asserts.ValidationSetType)
+	c.Check(a.(*asserts.ValidationSet).Sequence(), Equals, 3)
+
+	sequence = "3"
+	a, err = sto.SeqFormingAssertion(asserts.ValidationSetType, []string{"16", "foo", "bar"}, 3, nil)
+	c.Assert(err, IsNil)
+	c.Check(a.(*asserts.ValidationSet).Sequence(), Equals, 3)
+}
+
+func (s *storeTestSuite) TestSeqFormingAssertionNotFound(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assertRequest(c, r, "GET", "/api/v1/snaps/assertions/.*")
+		c.Check(r.URL.Path, Matches, ".*/validation-set/16/foo/bar")
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(404)
+		io.WriteString(w, `{"status": 404,"title": "not found"}`)
+	}))
+
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	mockServerURL, _ := url.Parse(mockServer.URL)
+	cfg := store.Config{
+		AssertionsBaseURL: mockServerURL,
+	}
+	sto := store.New(&cfg, nil)
+
+	_, err := sto.SeqFormingAssertion(asserts.ValidationSetType, []string{"16", "foo", "bar"}, 0, nil)
+	c.Check(err, DeepEquals, &asserts.NotFoundError{
+		Type: asserts.ValidationSetType,
+		Headers: map[string]string{
+			"series":     "16",
+			"account-id": "foo",
+			"name":       "bar",
+		},
+	})
+
+	_, err = sto.SeqFormingAssertion(asserts.ValidationSetType, []string{"16", "foo", "bar"}, 2, nil)
+	c.Check(err, DeepEquals, &asserts.NotFoundError{
+		Type: asserts.ValidationSetType,
+		Headers: map[string]string{
+			"series":     "16",
+			"account-id": "foo",
+			"name":       "bar",
+			"sequence":   "2",
+		},
+	})
+}
+
+func (s *storeTestSuite) TestSeqFormingAssertionErrors(c *C) {
+	sto := store.New(&store.Config{}, nil)
+
+	_, err := sto.SeqFormingAssertion(asserts.SnapDeclarationType, []string{"16"}, 0, nil)
+	c.Check(err, ErrorMatches, `internal error: "snap-declaration" assertion cannot be retrieved by sequence key \[16\]`)
+	_, err = sto.SeqFormingAssertion(asserts.ValidationSetType, []string{"16", "foo"}, 0, nil)
+	c.Check(err, ErrorMatches, `internal error: "validation-set" assertion cannot be retrieved by sequence key \[16 foo\]`)
+	_, err = sto.SeqFormingAssertion(asserts.ValidationSetType, []string{"16", "foo", "bar"}, -1, nil)
+	c.Check(err, ErrorMatches, `internal error: invalid sequence -1 for "validation-set" assertion`)
+}
+
 func (s *storeTestSuite) TestAssertion500(c *C) {
 	var n = 0
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
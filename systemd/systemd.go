@@ -128,22 +128,94 @@ func Available() error {
 	return err
 }
 
+// Version returns the version of systemd, as reported by systemctl.
+func Version() (int, error) {
+	out, err := systemctlCmd("--version")
+	if err != nil {
+		return 0, err
+	}
+	// the first line is like "systemd 245 (245.4-4ubuntu3.4)"
+	fields := strings.Fields(string(out))
+	if len(fields) < 2 || fields[0] != "systemd" {
+		return 0, fmt.Errorf("cannot parse systemd version from %q", string(out))
+	}
+	version, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse systemd version %q: %v", fields[1], err)
+	}
+	return version, nil
+}
+
+// EnsureAtLeast checks that the version of systemd is at least the
+// given one.
+func EnsureAtLeast(requiredVersion int) error {
+	version, err := Version()
+	if err != nil {
+		return err
+	}
+	if version < requiredVersion {
+		return fmt.Errorf("systemd version %d is too old (expected at least %d)", version, requiredVersion)
+	}
+	return nil
+}
+
 var osutilStreamCommand = osutil.StreamCommand
 
+// LogOptions holds the options for reading logs from the journal.
+type LogOptions struct {
+	// N is the maximum number of lines to read initially, all of them
+	// if negative.
+	N int
+	// Follow is whether to keep reading new lines as they appear.
+	Follow bool
+	// Since and Until restrict the logs to the ones from the given
+	// time range, when set.
+	Since time.Time
+	Until time.Time
+	// Priority restricts the logs to the ones with the given syslog
+	// priority or more important, when set. It is either a priority
+	// name, e.g. "warning", or a number from 0 (emerg) to 7 (debug).
+	Priority string
+	// AllNamespaces is whether to read the logs from all the journal
+	// namespaces instead of the default one only.
+	AllNamespaces bool
+}
+
 // jctl calls journalctl to get the JSON logs of the given services.
-var jctl = func(svcs []string, n int, follow bool) (io.ReadCloser, error) {
+var jctl = func(svcs []string, opts *LogOptions) (io.ReadCloser, error) {
+	if opts == nil {
+		opts = &LogOptions{}
+	}
 	// args will need two entries per service, plus a fixed number (give or take
-	// one) for the initial options.
-	args := make([]string, 0, 2*len(svcs)+6)        // the fixed number is 6
-	args = append(args, "-o", "json", "--no-pager") //   3...
-	if n < 0 {
+	// one) for the initial options, plus one per filter.
+	filters := 0
+	for _, set := range []bool{!opts.Since.IsZero(), !opts.Until.IsZero(), opts.Priority != "", opts.AllNamespaces} {
+		if set {
+			filters++
+		}
+	}
+	args := make([]string, 0, 2*len(svcs)+6+filters) // the fixed number is 6
+	args = append(args, "-o", "json", "--no-pager")  //   3...
+	if opts.N < 0 {
 		args = append(args, "--no-tail") // < 2
 	} else {
-		args = append(args, "-n", strconv.Itoa(n)) // ... + 2 ...
+		args = append(args, "-n", strconv.Itoa(opts.N)) // ... + 2 ...
 	}
-	if follow {
+	if opts.Follow {
 		args = append(args, "-f") // ... + 1 == 6
 	}
+	if !opts.Since.IsZero() {
+		args = append(args, fmt.Sprintf("--since=@%d", opts.Since.Unix()))
+	}
+	if !opts.Until.IsZero() {
+		args = append(args, fmt.Sprintf("--until=@%d", opts.Until.Unix()))
+	}
+	if opts.Priority != "" {
+		args = append(args, "--priority="+opts.Priority)
+	}
+	if opts.AllNamespaces {
+		args = append(args, "--namespace=*")
+	}
 
 	for i := range svcs {
 		args = append(args, "-u", svcs[i]) // this is why 2×
@@ -152,7 +224,7 @@ var jctl = func(svcs []string, n int, follow bool) (io.ReadCloser, error) {
 	return osutilStreamCommand("journalctl", args...)
 }
 
-func MockJournalctl(f func(svcs []string, n int, follow bool) (io.ReadCloser, error)) func() {
+func MockJournalctl(f func(svcs []string, opts *LogOptions) (io.ReadCloser, error)) func() {
 	oldJctl := jctl
 	jctl = f
 	return func() {
@@ -173,7 +245,7 @@ type Systemd interface {
 	Status(units ...string) ([]*UnitStatus, error)
 	IsEnabled(service string) (bool, error)
 	IsActive(service string) (bool, error)
-	LogReader(services []string, n int, follow bool) (io.ReadCloser, error)
+	LogReader(services []string, opts *LogOptions) (io.ReadCloser, error)
 	AddMountUnitFile(name, revision, what, where, fstype string) (string, error)
 	RemoveMountUnitFile(baseDir string) error
 	Mask(service string) error
@@ -187,6 +259,9 @@ const (
 	// the default target for systemd units that we generate
 	ServicesTarget = "multi-user.target"
 
+	// the default target for systemd user units that we generate
+	UserServicesTarget = "default.target"
+
 	// the target prerequisite for systemd units we generate
 	PrerequisiteTarget = "network.target"
 
@@ -304,8 +379,8 @@ func (s *systemd) StartNoBlock(serviceNames ...string) error {
 }
 
 // LogReader for the given services
-func (*systemd) LogReader(serviceNames []string, n int, follow bool) (io.ReadCloser, error) {
-	return jctl(serviceNames, n, follow)
+func (*systemd) LogReader(serviceNames []string, opts *LogOptions) (io.ReadCloser, error) {
+	return jctl(serviceNames, opts)
 }
 
 var statusregex = regexp.MustCompile(`(?m)^(?:(.+?)=(.*)|(.*))?$`)
@@ -461,11 +536,9 @@ func (s *systemd) Status(unitNames ...string) ([]*UnitStatus, error) {
 	return sts, nil
 }
 
-// IsEnabled checkes whether the given service is enabled
+// IsEnabled checkes whether the given service is enabled, with
+// GlobalUserMode for all the users.
 func (s *systemd) IsEnabled(serviceName string) (bool, error) {
-	if s.mode == GlobalUserMode {
-		panic("cannot call is-enabled with GlobalUserMode")
-	}
 	_, err := s.systemctl("--root", s.rootDir, "is-enabled", serviceName)
 	if err == nil {
 		return true, nil
@@ -120,13 +120,13 @@ func (s *SystemdTestSuite) myRun(args ...string) (out []byte, err error) {
 	return out, err
 }
 
-func (s *SystemdTestSuite) myJctl(svcs []string, n int, follow bool) (io.ReadCloser, error) {
+func (s *SystemdTestSuite) myJctl(svcs []string, opts *LogOptions) (io.ReadCloser, error) {
 	var err error
 	var out []byte
 
-	s.jns = append(s.jns, strconv.Itoa(n))
+	s.jns = append(s.jns, strconv.Itoa(opts.N))
 	s.jsvcs = append(s.jsvcs, svcs)
-	s.jfollows = append(s.jfollows, follow)
+	s.jfollows = append(s.jfollows, opts.Follow)
 
 	if s.j < len(s.jouts) {
 		out = s.jouts[s.j]
@@ -390,6 +390,30 @@ func (s *SystemdTestSuite) TestAvailable(c *C) {
 	c.Check(s.argses, DeepEquals, [][]string{{"--version"}})
 }
 
+func (s *SystemdTestSuite) TestVersion(c *C) {
+	s.outs = [][]byte{[]byte("systemd 245 (245.4-4ubuntu3.4)\n+PAM +AUDIT +SELINUX\n")}
+	version, err := Version()
+	c.Assert(err, IsNil)
+	c.Check(version, Equals, 245)
+	c.Check(s.argses, DeepEquals, [][]string{{"--version"}})
+
+	for _, out := range []string{"", "frobnicator 245\n", "systemd two-hundred\n"} {
+		s.i = 0
+		s.outs = [][]byte{[]byte(out)}
+		_, err := Version()
+		c.Check(err, ErrorMatches, "cannot parse systemd version .*")
+	}
+}
+
+func (s *SystemdTestSuite) TestEnsureAtLeast(c *C) {
+	s.outs = [][]byte{
+		[]byte("systemd 245 (245.4-4ubuntu3.4)\n"),
+		[]byte("systemd 237\n"),
+	}
+	c.Check(EnsureAtLeast(245), IsNil)
+	c.Check(EnsureAtLeast(245), ErrorMatches, `systemd version 237 is too old \(expected at least 245\)`)
+}
+
 func (s *SystemdTestSuite) TestEnable(c *C) {
 	err := New("xyzzy", SystemMode, s.rep).Enable("foo")
 	c.Assert(err, IsNil)
@@ -438,7 +462,7 @@ func (s *SystemdTestSuite) TestIsTimeout(c *C) {
 func (s *SystemdTestSuite) TestLogErrJctl(c *C) {
 	s.jerrs = []error{&Timeout{}}
 
-	reader, err := New("", SystemMode, s.rep).LogReader([]string{"foo"}, 24, false)
+	reader, err := New("", SystemMode, s.rep).LogReader([]string{"foo"}, &LogOptions{N: 24})
 	c.Check(err, NotNil)
 	c.Check(reader, IsNil)
 	c.Check(s.jns, DeepEquals, []string{"24"})
@@ -453,7 +477,7 @@ func (s *SystemdTestSuite) TestLogs(c *C) {
 `
 	s.jouts = [][]byte{[]byte(expected)}
 
-	reader, err := New("", SystemMode, s.rep).LogReader([]string{"foo"}, 24, false)
+	reader, err := New("", SystemMode, s.rep).LogReader([]string{"foo"}, &LogOptions{N: 24})
 	c.Check(err, IsNil)
 	logs, err := ioutil.ReadAll(reader)
 	c.Assert(err, IsNil)
@@ -695,15 +719,25 @@ func (s *SystemdTestSuite) TestJctl(c *C) {
 		return nil, nil
 	})
 
-	_, err = Jctl([]string{"foo", "bar"}, 10, false)
+	_, err = Jctl([]string{"foo", "bar"}, &LogOptions{N: 10})
 	c.Assert(err, IsNil)
 	c.Check(args, DeepEquals, []string{"-o", "json", "--no-pager", "-n", "10", "-u", "foo", "-u", "bar"})
-	_, err = Jctl([]string{"foo", "bar", "baz"}, 99, true)
+	_, err = Jctl([]string{"foo", "bar", "baz"}, &LogOptions{N: 99, Follow: true})
 	c.Assert(err, IsNil)
 	c.Check(args, DeepEquals, []string{"-o", "json", "--no-pager", "-n", "99", "-f", "-u", "foo", "-u", "bar", "-u", "baz"})
-	_, err = Jctl([]string{"foo", "bar"}, -1, false)
+	_, err = Jctl([]string{"foo", "bar"}, &LogOptions{N: -1})
 	c.Assert(err, IsNil)
 	c.Check(args, DeepEquals, []string{"-o", "json", "--no-pager", "--no-tail", "-u", "foo", "-u", "bar"})
+	_, err = Jctl([]string{"foo"}, &LogOptions{
+		N:             10,
+		Follow:        true,
+		Since:         time.Unix(1600000000, 0),
+		Until:         time.Unix(1600003600, 0),
+		Priority:      "warning",
+		AllNamespaces: true,
+	})
+	c.Assert(err, IsNil)
+	c.Check(args, DeepEquals, []string{"-o", "json", "--no-pager", "-n", "10", "-f", "--since=@1600000000", "--until=@1600003600", "--priority=warning", "--namespace=*", "-u", "foo"})
 }
 
 func (s *SystemdTestSuite) TestIsActiveIsInactive(c *C) {
@@ -818,6 +852,9 @@ func (s *SystemdTestSuite) TestGlobalUserMode(c *C) {
 	c.Check(s.argses[2], DeepEquals, []string{"--user", "--global", "--root", rootDir, "mask", "foo"})
 	c.Assert(sysd.Unmask("foo"), IsNil)
 	c.Check(s.argses[3], DeepEquals, []string{"--user", "--global", "--root", rootDir, "unmask", "foo"})
+	_, err := sysd.IsEnabled("foo")
+	c.Assert(err, IsNil)
+	c.Check(s.argses[4], DeepEquals, []string{"--user", "--global", "--root", rootDir, "is-enabled", "foo"})
 
 	// Commands that don't make sense for GlobalUserMode panic
 	c.Check(sysd.DaemonReload, Panics, "cannot call daemon-reload with GlobalUserMode")
@@ -827,6 +864,5 @@ func (s *SystemdTestSuite) TestGlobalUserMode(c *C) {
 	c.Check(func() { sysd.Restart("foo", 0) }, Panics, "cannot call restart with GlobalUserMode")
 	c.Check(func() { sysd.Kill("foo", "HUP", "") }, Panics, "cannot call kill with GlobalUserMode")
 	c.Check(func() { sysd.Status("foo") }, Panics, "cannot call status with GlobalUserMode")
-	c.Check(func() { sysd.IsEnabled("foo") }, Panics, "cannot call is-enabled with GlobalUserMode")
 	c.Check(func() { sysd.IsActive("foo") }, Panics, "cannot call is-active with GlobalUserMode")
 }
@@ -19,6 +19,19 @@
 
 package agent
 
+import (
+	"time"
+)
+
 var (
-	SessionInfoCmd = sessionInfoCmd
+	SessionInfoCmd    = sessionInfoCmd
+	ServiceControlCmd = serviceControlCmd
 )
+
+func MockStopTimeout(t time.Duration) (restore func()) {
+	old := stopTimeout
+	stopTimeout = t
+	return func() {
+		stopTimeout = old
+	}
+}
@@ -20,12 +20,22 @@
 package agent
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/netutil"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/timeout"
 )
 
 var restApi = []*Command{
 	rootCmd,
 	sessionInfoCmd,
+	serviceControlCmd,
 }
 
 var (
@@ -38,6 +48,11 @@ var (
 		Path: "/v1/session-info",
 		GET:  sessionInfo,
 	}
+
+	serviceControlCmd = &Command{
+		Path: "/v1/service-control",
+		POST: postServiceControl,
+	}
 )
 
 func sessionInfo(c *Command, r *http.Request) Response {
@@ -46,3 +61,121 @@ func sessionInfo(c *Command, r *http.Request) Response {
 	}
 	return SyncResponse(m)
 }
+
+type serviceInstruction struct {
+	Action   string   `json:"action"`
+	Services []string `json:"services"`
+}
+
+type dummyReporter struct{}
+
+func (dummyReporter) Notify(string) {}
+
+// stopTimeout is how long to wait for a user service to stop.
+var stopTimeout = time.Duration(timeout.DefaultTimeout)
+
+func validateUserServiceUnits(units []string) error {
+	for _, unit := range units {
+		if !strings.HasPrefix(unit, "snap.") || !(strings.HasSuffix(unit, ".service") || strings.HasSuffix(unit, ".timer")) {
+			return fmt.Errorf("cannot control unit %q, not a snap service or timer", unit)
+		}
+	}
+	return nil
+}
+
+func serviceStart(inst *serviceInstruction, sysd systemd.Systemd) Response {
+	var started []string
+	for _, unit := range inst.Services {
+		if err := sysd.Start(unit); err != nil {
+			// stop the units started so far, in reverse order
+			for i := len(started) - 1; i >= 0; i-- {
+				sysd.Stop(started[i], stopTimeout)
+			}
+			return InternalError("cannot start %q: %v", unit, err)
+		}
+		started = append(started, unit)
+	}
+	return SyncResponse(nil)
+}
+
+func serviceStop(inst *serviceInstruction, sysd systemd.Systemd) Response {
+	var failures []string
+	for _, unit := range inst.Services {
+		if err := sysd.Stop(unit, stopTimeout); err != nil {
+			failures = append(failures, fmt.Sprintf("%q: %v", unit, err))
+		}
+	}
+	if len(failures) > 0 {
+		return InternalError("cannot stop %s", strings.Join(failures, ", "))
+	}
+	return SyncResponse(nil)
+}
+
+func serviceRestart(inst *serviceInstruction, sysd systemd.Systemd) Response {
+	if len(inst.Services) == 0 {
+		return SyncResponse(nil)
+	}
+	sts, err := sysd.Status(inst.Services...)
+	if err != nil {
+		return InternalError("cannot get the status of the services: %v", err)
+	}
+	for i, unit := range inst.Services {
+		// only restart the services that are running
+		if !sts[i].Active {
+			continue
+		}
+		if err := sysd.Restart(unit, stopTimeout); err != nil {
+			return InternalError("cannot restart %q: %v", unit, err)
+		}
+	}
+	return SyncResponse(nil)
+}
+
+func serviceDaemonReload(inst *serviceInstruction, sysd systemd.Systemd) Response {
+	if len(inst.Services) != 0 {
+		return BadRequest("daemon-reload should not be called with any services")
+	}
+	if err := sysd.DaemonReload(); err != nil {
+		return InternalError("cannot reload the user systemd instance: %v", err)
+	}
+	return SyncResponse(nil)
+}
+
+var serviceInstructionDispTable = map[string]func(*serviceInstruction, systemd.Systemd) Response{
+	"start":         serviceStart,
+	"stop":          serviceStop,
+	"restart":       serviceRestart,
+	"daemon-reload": serviceDaemonReload,
+}
+
+func postServiceControl(c *Command, r *http.Request) Response {
+	// only snapd, running as root, controls the user services
+	_, uid, _, err := netutil.UcrednetGet(r.RemoteAddr)
+	if err != nil {
+		return Forbidden("cannot get remote user: %v", err)
+	}
+	if uid != 0 {
+		return Forbidden("only root may control user services")
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType != "application/json" {
+		return BadRequest("unknown content type: %s", contentType)
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var inst serviceInstruction
+	if err := decoder.Decode(&inst); err != nil {
+		return BadRequest("cannot decode request body into service instruction: %v", err)
+	}
+	impl := serviceInstructionDispTable[inst.Action]
+	if impl == nil {
+		return BadRequest("unknown action %q", inst.Action)
+	}
+	if err := validateUserServiceUnits(inst.Services); err != nil {
+		return BadRequest("%v", err)
+	}
+
+	sysd := systemd.New(dirs.GlobalRootDir, systemd.UserMode, dummyReporter{})
+	return impl(&inst, sysd)
+}
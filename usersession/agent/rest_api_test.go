@@ -20,29 +20,76 @@
 package agent_test
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"time"
 
 	. "gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/testutil"
 	"github.com/snapcore/snapd/usersession/agent"
 )
 
-type restSuite struct{}
+type restSuite struct {
+	testutil.BaseTest
+
+	sysdLog [][]string
+	// systemctl invocations with these units as last argument fail
+	failingUnits []string
+	// units reported as inactive by is-active
+	inactiveUnits []string
+}
 
 var _ = Suite(&restSuite{})
 
 func (s *restSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
 	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
 	xdgRuntimeDir := fmt.Sprintf("%s/%d", dirs.XdgRuntimeDirBase, os.Getuid())
 	c.Assert(os.MkdirAll(xdgRuntimeDir, 0700), IsNil)
-}
 
-func (s *restSuite) TearDownTest(c *C) {
-	dirs.SetRootDir("")
+	s.sysdLog = nil
+	s.failingUnits = nil
+	s.inactiveUnits = nil
+	s.AddCleanup(systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {
+		s.sysdLog = append(s.sysdLog, cmd)
+		unit := cmd[len(cmd)-1]
+		for _, failing := range s.failingUnits {
+			if unit == failing {
+				return nil, fmt.Errorf("%s failed", unit)
+			}
+		}
+		if cmd[1] == "show" && strings.HasPrefix(cmd[2], "--property=Id,") {
+			var out bytes.Buffer
+			for i, unit := range cmd[3:] {
+				if i > 0 {
+					out.WriteString("\n")
+				}
+				state := "active"
+				for _, inactive := range s.inactiveUnits {
+					if unit == inactive {
+						state = "inactive"
+					}
+				}
+				fmt.Fprintf(&out, "Id=%s\nActiveState=%s\nUnitFileState=enabled\nType=simple\n", unit, state)
+			}
+			return out.Bytes(), nil
+		}
+		if cmd[1] == "show" {
+			return []byte("ActiveState=inactive\n"), nil
+		}
+		return nil, nil
+	}))
+	s.AddCleanup(systemd.MockStopDelays(time.Millisecond, 25*time.Second))
+	s.AddCleanup(agent.MockStopTimeout(time.Second))
 }
 
 type resp struct {
@@ -74,3 +121,152 @@ func (s *restSuite) TestSessionInfo(c *C) {
 		"version": "42b1",
 	})
 }
+
+func (s *restSuite) postServiceControl(c *C, body string) (*httptest.ResponseRecorder, *resp) {
+	// requests from snapd, which runs as root
+	return s.postServiceControlFrom(c, "pid=100;uid=0;socket=;", body)
+}
+
+func (s *restSuite) postServiceControlFrom(c *C, remoteAddr, body string) (*httptest.ResponseRecorder, *resp) {
+	req, err := http.NewRequest("POST", "/v1/service-control", bytes.NewBufferString(body))
+	c.Assert(err, IsNil)
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = remoteAddr
+	rec := httptest.NewRecorder()
+	agent.ServiceControlCmd.POST(agent.ServiceControlCmd, req).ServeHTTP(rec, req)
+
+	var rsp resp
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &rsp), IsNil)
+	return rec, &rsp
+}
+
+func (s *restSuite) TestServiceControl(c *C) {
+	// the agent.ServiceControl end point only supports POST requests
+	c.Check(agent.ServiceControlCmd.GET, IsNil)
+	c.Check(agent.ServiceControlCmd.PUT, IsNil)
+	c.Check(agent.ServiceControlCmd.DELETE, IsNil)
+	c.Assert(agent.ServiceControlCmd.POST, NotNil)
+
+	c.Check(agent.ServiceControlCmd.Path, Equals, "/v1/service-control")
+}
+
+func (s *restSuite) TestServiceControlForbidden(c *C) {
+	for _, t := range []struct {
+		remoteAddr string
+		message    string
+	}{
+		{"pid=100;uid=1000;socket=;", "only root may control user services"},
+		{"", "cannot get remote user: no pid/uid found"},
+	} {
+		rec, rsp := s.postServiceControlFrom(c, t.remoteAddr, `{"action":"start","services":["snap.foo.service"]}`)
+		c.Check(rec.Code, Equals, 403)
+		c.Check(rsp.Type, Equals, agent.ResponseTypeError)
+		c.Check(rsp.Result, DeepEquals, map[string]interface{}{
+			"message": t.message,
+		})
+	}
+	c.Check(s.sysdLog, HasLen, 0)
+}
+
+func (s *restSuite) TestServicesDaemonReload(c *C) {
+	rec, rsp := s.postServiceControl(c, `{"action":"daemon-reload"}`)
+	c.Check(rec.Code, Equals, 200)
+	c.Check(rsp.Type, Equals, agent.ResponseTypeSync)
+	c.Check(rsp.Result, IsNil)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "daemon-reload"},
+	})
+}
+
+func (s *restSuite) TestServicesDaemonReloadWithServices(c *C) {
+	rec, rsp := s.postServiceControl(c, `{"action":"daemon-reload","services":["snap.foo.service"]}`)
+	c.Check(rec.Code, Equals, 400)
+	c.Check(rsp.Type, Equals, agent.ResponseTypeError)
+	c.Check(rsp.Result, DeepEquals, map[string]interface{}{
+		"message": "daemon-reload should not be called with any services",
+	})
+	c.Check(s.sysdLog, HasLen, 0)
+}
+
+func (s *restSuite) TestServicesStart(c *C) {
+	rec, rsp := s.postServiceControl(c, `{"action":"start","services":["snap.foo.service","snap.bar.timer"]}`)
+	c.Check(rec.Code, Equals, 200)
+	c.Check(rsp.Type, Equals, agent.ResponseTypeSync)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "start", "snap.foo.service"},
+		{"--user", "start", "snap.bar.timer"},
+	})
+}
+
+func (s *restSuite) TestServicesStartFailureStopsStarted(c *C) {
+	s.failingUnits = []string{"snap.bar.service"}
+	rec, rsp := s.postServiceControl(c, `{"action":"start","services":["snap.foo.service","snap.bar.service"]}`)
+	c.Check(rec.Code, Equals, 500)
+	c.Check(rsp.Type, Equals, agent.ResponseTypeError)
+	c.Check(rsp.Result, DeepEquals, map[string]interface{}{
+		"message": `cannot start "snap.bar.service": snap.bar.service failed`,
+	})
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "start", "snap.foo.service"},
+		{"--user", "start", "snap.bar.service"},
+		{"--user", "stop", "snap.foo.service"},
+		{"--user", "show", "--property=ActiveState", "snap.foo.service"},
+	})
+}
+
+func (s *restSuite) TestServicesStop(c *C) {
+	s.failingUnits = []string{"snap.bar.service"}
+	rec, rsp := s.postServiceControl(c, `{"action":"stop","services":["snap.bar.service","snap.foo.service"]}`)
+	c.Check(rec.Code, Equals, 500)
+	c.Check(rsp.Result, DeepEquals, map[string]interface{}{
+		"message": `cannot stop "snap.bar.service": snap.bar.service failed`,
+	})
+	// the other services are still stopped
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "stop", "snap.bar.service"},
+		{"--user", "stop", "snap.foo.service"},
+		{"--user", "show", "--property=ActiveState", "snap.foo.service"},
+	})
+}
+
+func (s *restSuite) TestServicesRestart(c *C) {
+	s.inactiveUnits = []string{"snap.bar.service"}
+	rec, rsp := s.postServiceControl(c, `{"action":"restart","services":["snap.foo.service","snap.bar.service"]}`)
+	c.Check(rec.Code, Equals, 200)
+	c.Check(rsp.Type, Equals, agent.ResponseTypeSync)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "show", "--property=Id,ActiveState,UnitFileState,Type", "snap.foo.service", "snap.bar.service"},
+		{"--user", "stop", "snap.foo.service"},
+		{"--user", "show", "--property=ActiveState", "snap.foo.service"},
+		{"--user", "start", "snap.foo.service"},
+	})
+}
+
+func (s *restSuite) TestServiceControlErrors(c *C) {
+	for _, t := range []struct {
+		body string
+		err  string
+	}{
+		{`{"action":"start","services":["ssh.service"]}`, `cannot control unit "ssh.service", not a snap service or timer`},
+		{`{"action":"start","services":["snap.foo.mount"]}`, `cannot control unit "snap.foo.mount", not a snap service or timer`},
+		{`{"action":"explode"}`, `unknown action "explode"`},
+		{`{"action"`, `cannot decode request body into service instruction: .*`},
+	} {
+		rec, rsp := s.postServiceControl(c, t.body)
+		c.Check(rec.Code, Equals, 400, Commentf(t.body))
+		c.Check(rsp.Type, Equals, agent.ResponseTypeError)
+		c.Check(rsp.Result.(map[string]interface{})["message"], Matches, t.err)
+	}
+	c.Check(s.sysdLog, HasLen, 0)
+}
+
+func (s *restSuite) TestServiceControlBadContentType(c *C) {
+	req, err := http.NewRequest("POST", "/v1/service-control", strings.NewReader(`{"action":"start"}`))
+	c.Assert(err, IsNil)
+	req.Header.Set("Content-Type", "text/plain")
+	req.RemoteAddr = "pid=100;uid=0;socket=;"
+	rec := httptest.NewRecorder()
+	agent.ServiceControlCmd.POST(agent.ServiceControlCmd, req).ServeHTTP(rec, req)
+	c.Check(rec.Code, Equals, 400)
+	c.Check(rec.Body.String(), testutil.Contains, "unknown content type: text/plain")
+}
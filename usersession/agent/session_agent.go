@@ -85,9 +85,13 @@ func (s *SessionAgent) Init() error {
 		return err
 	}
 	agentSocket := fmt.Sprintf("%s/%d/snapd-session-agent.socket", dirs.XdgRuntimeDirBase, os.Getuid())
-	if s.listener, err = netutil.GetListener(agentSocket, listenerMap); err != nil {
+	listener, err := netutil.GetListener(agentSocket, listenerMap)
+	if err != nil {
 		return fmt.Errorf("cannot listen on socket %s: %v", agentSocket, err)
 	}
+	// the peer credentials of the connections are needed to tell
+	// requests from snapd apart
+	s.listener = netutil.WrapUcrednetListener(listener)
 	s.addRoutes()
 	s.serve = &http.Server{Handler: s.router}
 	return nil
@@ -0,0 +1,250 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package client talks to the session agents of the logged in users,
+// to control the services running in their sessions.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/timeout"
+)
+
+// ServicesTimeout is how long to wait for the session agents of the
+// users to act on user services.
+var ServicesTimeout = 2 * time.Duration(timeout.DefaultTimeout)
+
+// dialSessionAgent connects to the session agent of the user whose uid
+// is the host of the address.
+func dialSessionAgent(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	socket := filepath.Join(dirs.XdgRuntimeDirBase, host, "snapd-session-agent.socket")
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "unix", socket)
+}
+
+// Client talks to the session agents of all the users with a
+// running session.
+type Client struct {
+	doer *http.Client
+}
+
+// New returns a new Client.
+func New() *Client {
+	transport := &http.Transport{DialContext: dialSessionAgent, DisableKeepAlives: true}
+	return &Client{
+		doer: &http.Client{Transport: transport},
+	}
+}
+
+// Error is an error reported by a session agent.
+type Error struct {
+	Kind    string      `json:"kind"`
+	Value   interface{} `json:"value"`
+	Message string      `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+type response struct {
+	uid        int
+	statusCode int
+	err        error
+
+	Type   string          `json:"type"`
+	Result json.RawMessage `json:"result"`
+}
+
+func (resp *response) checkError() {
+	if resp.Type != "error" {
+		return
+	}
+	var resultErr Error
+	err := json.Unmarshal(resp.Result, &resultErr)
+	if err != nil || resultErr.Message == "" {
+		resp.err = fmt.Errorf("server error: %q", http.StatusText(resp.statusCode))
+	} else {
+		resp.err = &resultErr
+	}
+}
+
+// uids returns the uids of the users with a session agent listening.
+func (client *Client) uids() ([]int, error) {
+	sockets, err := filepath.Glob(filepath.Join(dirs.XdgRuntimeDirBase, "*", "snapd-session-agent.socket"))
+	if err != nil {
+		return nil, err
+	}
+	uids := make([]int, 0, len(sockets))
+	for _, sock := range sockets {
+		uidStr := filepath.Base(filepath.Dir(sock))
+		uid, err := strconv.Atoi(uidStr)
+		if err != nil {
+			// not a directory we're interested in
+			continue
+		}
+		uids = append(uids, uid)
+	}
+	sort.Ints(uids)
+	return uids, nil
+}
+
+// doMany sends the request to all the session agents concurrently,
+// the responses are in the order of the uids of the users.
+func (client *Client) doMany(ctx context.Context, method, urlpath string, query url.Values, headers map[string]string, body []byte) ([]*response, error) {
+	uids, err := client.uids()
+	if err != nil {
+		return nil, err
+	}
+	var wg sync.WaitGroup
+	responses := make([]*response, len(uids))
+	for i, uid := range uids {
+		wg.Add(1)
+		go func(i, uid int) {
+			defer wg.Done()
+			responses[i] = client.do(ctx, uid, method, urlpath, query, headers, body)
+		}(i, uid)
+	}
+	wg.Wait()
+	return responses, nil
+}
+
+func (client *Client) do(ctx context.Context, uid int, method, urlpath string, query url.Values, headers map[string]string, body []byte) *response {
+	resp := &response{uid: uid}
+
+	u := url.URL{
+		Scheme:   "http",
+		Host:     strconv.Itoa(uid),
+		Path:     urlpath,
+		RawQuery: query.Encode(),
+	}
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		resp.err = err
+		return resp
+	}
+	req = req.WithContext(ctx)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	httpResp, err := client.doer.Do(req)
+	if err != nil {
+		resp.err = err
+		return resp
+	}
+	defer httpResp.Body.Close()
+	resp.statusCode = httpResp.StatusCode
+
+	if err := json.NewDecoder(httpResp.Body).Decode(resp); err != nil {
+		resp.err = fmt.Errorf("cannot decode response: %v", err)
+		return resp
+	}
+	resp.checkError()
+	return resp
+}
+
+// isUnreachable returns whether the error is about a session agent
+// that is not running anymore, as the user logged out.
+func isUnreachable(err error) bool {
+	urlErr, ok := err.(*url.Error)
+	if !ok {
+		return false
+	}
+	opErr, ok := urlErr.Err.(*net.OpError)
+	return ok && opErr.Op == "dial"
+}
+
+type serviceInstruction struct {
+	Action   string   `json:"action"`
+	Services []string `json:"services,omitempty"`
+}
+
+func (client *Client) serviceControl(ctx context.Context, action string, services []string) error {
+	body, err := json.Marshal(&serviceInstruction{
+		Action:   action,
+		Services: services,
+	})
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{"Content-Type": "application/json"}
+	responses, err := client.doMany(ctx, "POST", "/v1/service-control", nil, headers, body)
+	if err != nil {
+		return err
+	}
+
+	var failures []string
+	for _, resp := range responses {
+		if resp.err == nil {
+			continue
+		}
+		if isUnreachable(resp.err) {
+			logger.Debugf("cannot reach the session agent of user %d: %v", resp.uid, resp.err)
+			continue
+		}
+		failures = append(failures, fmt.Sprintf("user %d: %v", resp.uid, resp.err))
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("cannot %s user services: %s", action, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// ServicesDaemonReload asks the systemd instances of all the users to
+// reload their configuration.
+func (client *Client) ServicesDaemonReload(ctx context.Context) error {
+	return client.serviceControl(ctx, "daemon-reload", nil)
+}
+
+// ServicesStart starts the given user services in all the user
+// sessions, in order.
+func (client *Client) ServicesStart(ctx context.Context, services []string) error {
+	return client.serviceControl(ctx, "start", services)
+}
+
+// ServicesStop stops the given user services in all the user sessions.
+func (client *Client) ServicesStop(ctx context.Context, services []string) error {
+	return client.serviceControl(ctx, "stop", services)
+}
+
+// ServicesRestart restarts the given user services in all the user
+// sessions where they are running.
+func (client *Client) ServicesRestart(ctx context.Context, services []string) error {
+	return client.serviceControl(ctx, "restart", services)
+}
@@ -0,0 +1,151 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/usersession/client"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type clientSuite struct {
+	cli *client.Client
+
+	server  *http.Server
+	handler http.Handler
+
+	mu       sync.Mutex
+	requests map[string][]string
+}
+
+var _ = Suite(&clientSuite{})
+
+func (s *clientSuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	s.cli = client.New()
+	s.requests = make(map[string][]string)
+
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write([]byte(`{"type": "sync", "result": null}`))
+	})
+	s.server = &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		c.Check(err, IsNil)
+		s.mu.Lock()
+		s.requests[r.Host] = append(s.requests[r.Host], fmt.Sprintf("%s %s %s", r.Method, r.URL.Path, body))
+		s.mu.Unlock()
+		s.handler.ServeHTTP(w, r)
+	})}
+	for _, uid := range []int{1000, 42} {
+		sock := filepath.Join(dirs.XdgRuntimeDirBase, fmt.Sprint(uid), "snapd-session-agent.socket")
+		c.Assert(os.MkdirAll(filepath.Dir(sock), 0755), IsNil)
+		l, err := net.Listen("unix", sock)
+		c.Assert(err, IsNil)
+		go s.server.Serve(l)
+	}
+}
+
+func (s *clientSuite) TearDownTest(c *C) {
+	c.Assert(s.server.Close(), IsNil)
+	dirs.SetRootDir("")
+}
+
+func (s *clientSuite) TestServicesDaemonReload(c *C) {
+	err := s.cli.ServicesDaemonReload(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(s.requests, DeepEquals, map[string][]string{
+		"42":   {`POST /v1/service-control {"action":"daemon-reload"}`},
+		"1000": {`POST /v1/service-control {"action":"daemon-reload"}`},
+	})
+}
+
+func (s *clientSuite) TestServicesStartStopRestart(c *C) {
+	ctx := context.Background()
+	c.Assert(s.cli.ServicesStart(ctx, []string{"snap.foo.service", "snap.bar.service"}), IsNil)
+	c.Assert(s.cli.ServicesStop(ctx, []string{"snap.foo.service"}), IsNil)
+	c.Assert(s.cli.ServicesRestart(ctx, []string{"snap.bar.service"}), IsNil)
+
+	expected := []string{
+		`POST /v1/service-control {"action":"start","services":["snap.foo.service","snap.bar.service"]}`,
+		`POST /v1/service-control {"action":"stop","services":["snap.foo.service"]}`,
+		`POST /v1/service-control {"action":"restart","services":["snap.bar.service"]}`,
+	}
+	c.Check(s.requests, DeepEquals, map[string][]string{
+		"42":   expected,
+		"1000": expected,
+	})
+}
+
+func (s *clientSuite) TestServicesStartFailure(c *C) {
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Host == "42" {
+			w.WriteHeader(500)
+			w.Write([]byte(`{"type": "error", "result": {"message": "cannot start \"snap.foo.service\": boom"}}`))
+			return
+		}
+		w.WriteHeader(200)
+		w.Write([]byte(`{"type": "sync", "result": null}`))
+	})
+	err := s.cli.ServicesStart(context.Background(), []string{"snap.foo.service"})
+	c.Check(err, ErrorMatches, `cannot start user services: user 42: cannot start "snap.foo.service": boom`)
+}
+
+func (s *clientSuite) TestServicesStartBadResponse(c *C) {
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+		w.Write([]byte(`garbage`))
+	})
+	err := s.cli.ServicesStart(context.Background(), []string{"snap.foo.service"})
+	c.Check(err, ErrorMatches, `cannot start user services: user 42: cannot decode response: .*; user 1000: cannot decode response: .*`)
+}
+
+func (s *clientSuite) TestStaleSocketIgnored(c *C) {
+	// the socket of a user that logged out is left behind
+	sock := filepath.Join(dirs.XdgRuntimeDirBase, "1234", "snapd-session-agent.socket")
+	c.Assert(os.MkdirAll(filepath.Dir(sock), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(sock, nil, 0644), IsNil)
+
+	err := s.cli.ServicesStop(context.Background(), []string{"snap.foo.service"})
+	c.Assert(err, IsNil)
+	c.Check(s.requests, HasLen, 2)
+}
+
+func (s *clientSuite) TestNoSessions(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	err := s.cli.ServicesDaemonReload(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(s.requests, HasLen, 0)
+}
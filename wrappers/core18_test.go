@@ -91,7 +91,7 @@ func (s *servicesTestSuite) TestAddSnapServicesForSnapdOnCore(c *C) {
 
 	info := makeMockSnapdSnap(c)
 	// add the snapd service
-	err := wrappers.AddSnapServices(info, nil)
+	err := wrappers.AddSnapServices(info, nil, nil)
 	c.Assert(err, IsNil)
 
 	// check that snapd.service is created
@@ -170,7 +170,7 @@ func (s *servicesTestSuite) TestAddSnapServicesForSnapdOnClassic(c *C) {
 
 	info := makeMockSnapdSnap(c)
 	// add the snapd service
-	err := wrappers.AddSnapServices(info, nil)
+	err := wrappers.AddSnapServices(info, nil, nil)
 	c.Assert(err, IsNil)
 
 	// check that snapd services were *not* created
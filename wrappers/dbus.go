@@ -0,0 +1,179 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package wrappers
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+)
+
+const dbusSnapNameKey = "X-Snap="
+
+// dbusSnapOwner returns the name of the snap that wrote the given D-Bus
+// service activation file, if any.
+func dbusSnapOwner(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, dbusSnapNameKey) {
+			return strings.TrimPrefix(line, dbusSnapNameKey), nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+// snapDBusServiceFiles returns the names of the D-Bus service activation
+// files in dir that belong to the snap.
+func snapDBusServiceFiles(dir, snapName string) (owned []string, others map[string]string, err error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.service"))
+	if err != nil {
+		return nil, nil, err
+	}
+	others = make(map[string]string)
+	for _, match := range matches {
+		owner, err := dbusSnapOwner(match)
+		if err != nil {
+			return nil, nil, err
+		}
+		if owner == snapName {
+			owned = append(owned, filepath.Base(match))
+		} else {
+			others[filepath.Base(match)] = owner
+		}
+	}
+	return owned, others, nil
+}
+
+func generateDBusActivationFile(app *snap.AppInfo, busName, bus string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `[D-BUS Service]
+Name=%s
+Comment=Bus name for snap application %s.%s
+SystemdService=%s
+Exec=%s
+AssumedAppArmorLabel=%s
+`, busName, app.Snap.InstanceName(), app.Name, app.ServiceName(), app.LauncherCommand(), app.SecurityTag())
+	// the system bus only activates services running as the configured
+	// user, all snap system services run as root
+	if bus == "system" {
+		buf.WriteString("User=root\n")
+	}
+	fmt.Fprintf(&buf, "%s%s\n", dbusSnapNameKey, app.Snap.InstanceName())
+	return buf.Bytes()
+}
+
+type dbusServicesDir struct {
+	dir     string
+	globs   []string
+	others  map[string]string
+	content map[string]*osutil.FileState
+}
+
+// AddSnapDBusActivationFiles writes the D-Bus service activation files for
+// the services of the snap activated on D-Bus names.
+func AddSnapDBusActivationFiles(s *snap.Info) error {
+	busDirs := map[string]*dbusServicesDir{
+		"session": {dir: dirs.SnapDBusSessionServicesDir},
+		"system":  {dir: dirs.SnapDBusSystemServicesDir},
+	}
+	for _, d := range busDirs {
+		if err := os.MkdirAll(d.dir, 0755); err != nil {
+			return err
+		}
+		owned, others, err := snapDBusServiceFiles(d.dir, s.InstanceName())
+		if err != nil {
+			return err
+		}
+		d.globs = owned
+		d.others = others
+		d.content = make(map[string]*osutil.FileState)
+	}
+
+	for _, app := range s.Apps {
+		if !app.IsService() {
+			continue
+		}
+		for _, slot := range app.ActivatesOn {
+			var bus, busName string
+			if err := slot.Attr("bus", &bus); err != nil {
+				return err
+			}
+			if err := slot.Attr("name", &busName); err != nil {
+				return err
+			}
+			d := busDirs[bus]
+			if d == nil {
+				return fmt.Errorf("internal error: unknown D-Bus bus %q", bus)
+			}
+
+			filename := busName + ".service"
+			if owner, ok := d.others[filename]; ok {
+				return fmt.Errorf("cannot add D-Bus activation of %q for snap %q: already provided by %q", busName, s.InstanceName(), owner)
+			}
+			d.globs = append(d.globs, filename)
+			d.content[filename] = &osutil.FileState{
+				Content: generateDBusActivationFile(app, busName, bus),
+				Mode:    0644,
+			}
+		}
+	}
+
+	for _, d := range busDirs {
+		if len(d.globs) == 0 {
+			continue
+		}
+		if _, _, err := osutil.EnsureDirStateGlobs(d.dir, d.globs, d.content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveSnapDBusActivationFiles removes the D-Bus service activation files
+// of the snap.
+func RemoveSnapDBusActivationFiles(s *snap.Info) error {
+	for _, dir := range []string{dirs.SnapDBusSessionServicesDir, dirs.SnapDBusSystemServicesDir} {
+		owned, _, err := snapDBusServiceFiles(dir, s.InstanceName())
+		if err != nil {
+			return err
+		}
+		if len(owned) == 0 {
+			continue
+		}
+		if _, _, err := osutil.EnsureDirStateGlobs(dir, owned, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package wrappers_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/testutil"
+	"github.com/snapcore/snapd/wrappers"
+)
+
+type dbusTestSuite struct {
+	testutil.BaseTest
+}
+
+var _ = Suite(&dbusTestSuite{})
+
+func (s *dbusTestSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+}
+
+const snapYamlActivatesOn = `name: snapname
+version: 1.0
+slots:
+  system-slot:
+    interface: dbus
+    bus: system
+    name: org.example.Foo
+  session-slot:
+    interface: dbus
+    bus: session
+    name: org.example.Session
+apps:
+  system-daemon:
+    daemon: simple
+    activates-on: [system-slot]
+  session-daemon:
+    daemon: simple
+    daemon-scope: user
+    activates-on: [session-slot]
+`
+
+func (s *dbusTestSuite) TestAddSnapDBusActivationFiles(c *C) {
+	info := snaptest.MockSnap(c, snapYamlActivatesOn, &snap.SideInfo{Revision: snap.R(12)})
+
+	err := wrappers.AddSnapDBusActivationFiles(info)
+	c.Assert(err, IsNil)
+
+	c.Check(filepath.Join(dirs.SnapDBusSystemServicesDir, "org.example.Foo.service"), testutil.FileEquals, `[D-BUS Service]
+Name=org.example.Foo
+Comment=Bus name for snap application snapname.system-daemon
+SystemdService=snap.snapname.system-daemon.service
+Exec=/usr/bin/snap run snapname.system-daemon
+AssumedAppArmorLabel=snap.snapname.system-daemon
+User=root
+X-Snap=snapname
+`)
+	c.Check(filepath.Join(dirs.SnapDBusSessionServicesDir, "org.example.Session.service"), testutil.FileEquals, `[D-BUS Service]
+Name=org.example.Session
+Comment=Bus name for snap application snapname.session-daemon
+SystemdService=snap.snapname.session-daemon.service
+Exec=/usr/bin/snap run snapname.session-daemon
+AssumedAppArmorLabel=snap.snapname.session-daemon
+X-Snap=snapname
+`)
+
+	err = wrappers.RemoveSnapDBusActivationFiles(info)
+	c.Assert(err, IsNil)
+	c.Check(filepath.Join(dirs.SnapDBusSystemServicesDir, "org.example.Foo.service"), testutil.FileAbsent)
+	c.Check(filepath.Join(dirs.SnapDBusSessionServicesDir, "org.example.Session.service"), testutil.FileAbsent)
+}
+
+func (s *dbusTestSuite) TestAddSnapDBusActivationFilesRemovesStale(c *C) {
+	info := snaptest.MockSnap(c, snapYamlActivatesOn, &snap.SideInfo{Revision: snap.R(12)})
+
+	c.Assert(os.MkdirAll(dirs.SnapDBusSystemServicesDir, 0755), IsNil)
+	stale := filepath.Join(dirs.SnapDBusSystemServicesDir, "org.example.Old.service")
+	c.Assert(ioutil.WriteFile(stale, []byte("[D-BUS Service]\nName=org.example.Old\nX-Snap=snapname\n"), 0644), IsNil)
+	other := filepath.Join(dirs.SnapDBusSystemServicesDir, "org.example.Other.service")
+	c.Assert(ioutil.WriteFile(other, []byte("[D-BUS Service]\nName=org.example.Other\nX-Snap=other-snap\n"), 0644), IsNil)
+
+	err := wrappers.AddSnapDBusActivationFiles(info)
+	c.Assert(err, IsNil)
+
+	c.Check(stale, testutil.FileAbsent)
+	c.Check(other, testutil.FilePresent)
+	c.Check(osutil.FileExists(filepath.Join(dirs.SnapDBusSystemServicesDir, "org.example.Foo.service")), Equals, true)
+
+	// the files of other snaps are kept on removal too
+	err = wrappers.RemoveSnapDBusActivationFiles(info)
+	c.Assert(err, IsNil)
+	c.Check(other, testutil.FilePresent)
+}
+
+func (s *dbusTestSuite) TestAddSnapDBusActivationFilesConflict(c *C) {
+	info := snaptest.MockSnap(c, snapYamlActivatesOn, &snap.SideInfo{Revision: snap.R(12)})
+
+	c.Assert(os.MkdirAll(dirs.SnapDBusSystemServicesDir, 0755), IsNil)
+	other := filepath.Join(dirs.SnapDBusSystemServicesDir, "org.example.Foo.service")
+	c.Assert(ioutil.WriteFile(other, []byte("[D-BUS Service]\nName=org.example.Foo\nX-Snap=other-snap\n"), 0644), IsNil)
+
+	err := wrappers.AddSnapDBusActivationFiles(info)
+	c.Assert(err, ErrorMatches, `cannot add D-Bus activation of "org.example.Foo" for snap "snapname": already provided by "other-snap"`)
+	c.Check(other, testutil.FileContains, "X-Snap=other-snap\n")
+}
@@ -0,0 +1,100 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package wrappers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/systemd"
+)
+
+func journalNamespaceConfPath(namespace string) string {
+	return filepath.Join(dirs.SnapSystemdDir, fmt.Sprintf("journald@%s.conf", namespace))
+}
+
+func journalNamespaceService(namespace string) string {
+	return fmt.Sprintf("systemd-journald@%s.service", namespace)
+}
+
+func genJournalNamespaceConf(size int64) []byte {
+	return []byte(fmt.Sprintf(`# Auto-generated, DO NOT EDIT
+[Journal]
+SystemMaxUse=%[1]d
+RuntimeMaxUse=%[1]d
+`, size))
+}
+
+// EnsureJournalNamespace writes the journald configuration of the
+// given journal namespace, limiting the space its journal files can
+// use to the given size. The journald instance of the namespace is
+// restarted if it is running for a new limit to take effect.
+func EnsureJournalNamespace(namespace string, size int64, inter interacter) error {
+	path := journalNamespaceConfPath(namespace)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	err := osutil.EnsureFileState(path, &osutil.FileState{Content: genJournalNamespaceConf(size), Mode: 0644})
+	if err == osutil.ErrSameState {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
+	svc := journalNamespaceService(namespace)
+	sts, err := sysd.Status(svc)
+	if err != nil {
+		return err
+	}
+	if !sts[0].Active {
+		// picked up when the namespace is next used
+		return nil
+	}
+	return sysd.Restart(svc, 10*time.Second)
+}
+
+// RemoveJournalNamespace removes the journald configuration of the
+// given journal namespace and stops its journald instance. The journal
+// files of the namespace are left alone.
+func RemoveJournalNamespace(namespace string, inter interacter) error {
+	if err := os.Remove(journalNamespaceConfPath(namespace)); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
+	svc := journalNamespaceService(namespace)
+	sts, err := sysd.Status(svc)
+	if err != nil {
+		return err
+	}
+	if !sts[0].Active {
+		return nil
+	}
+	return sysd.Stop(svc, 10*time.Second)
+}
@@ -0,0 +1,110 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package wrappers_test
+
+import (
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/testutil"
+	"github.com/snapcore/snapd/wrappers"
+)
+
+type journalTestSuite struct {
+	testutil.BaseTest
+
+	sysdLog [][]string
+	active  bool
+}
+
+var _ = Suite(&journalTestSuite{})
+
+func (s *journalTestSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	s.sysdLog = nil
+	s.active = false
+	s.AddCleanup(systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {
+		s.sysdLog = append(s.sysdLog, cmd)
+		if len(cmd) == 3 && cmd[1] == "--property=Id,ActiveState,UnitFileState,Type" {
+			state := "inactive"
+			if s.active {
+				state = "active"
+			}
+			return []byte("Id=" + cmd[2] + "\nType=notify\nActiveState=" + state + "\nUnitFileState=static\n"), nil
+		}
+		return []byte("ActiveState=inactive\n"), nil
+	}))
+}
+
+func (s *journalTestSuite) TestEnsureAndRemoveJournalNamespace(c *C) {
+	confPath := filepath.Join(dirs.SnapSystemdDir, "journald@snap-foo.conf")
+
+	err := wrappers.EnsureJournalNamespace("snap-foo", 10*1000*1000, nil)
+	c.Assert(err, IsNil)
+	c.Check(confPath, testutil.FileEquals, `# Auto-generated, DO NOT EDIT
+[Journal]
+SystemMaxUse=10000000
+RuntimeMaxUse=10000000
+`)
+	// not running, nothing to restart
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"show", "--property=Id,ActiveState,UnitFileState,Type", "systemd-journald@snap-foo.service"},
+	})
+
+	// unchanged
+	s.sysdLog = nil
+	err = wrappers.EnsureJournalNamespace("snap-foo", 10*1000*1000, nil)
+	c.Assert(err, IsNil)
+	c.Check(s.sysdLog, HasLen, 0)
+
+	// running instances are restarted for the new limit to apply
+	s.active = true
+	err = wrappers.EnsureJournalNamespace("snap-foo", 20*1000*1000, nil)
+	c.Assert(err, IsNil)
+	c.Check(confPath, testutil.FileContains, "SystemMaxUse=20000000\n")
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"show", "--property=Id,ActiveState,UnitFileState,Type", "systemd-journald@snap-foo.service"},
+		{"stop", "systemd-journald@snap-foo.service"},
+		{"show", "--property=ActiveState", "systemd-journald@snap-foo.service"},
+		{"start", "systemd-journald@snap-foo.service"},
+	})
+
+	s.sysdLog = nil
+	err = wrappers.RemoveJournalNamespace("snap-foo", nil)
+	c.Assert(err, IsNil)
+	c.Check(confPath, testutil.FileAbsent)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"show", "--property=Id,ActiveState,UnitFileState,Type", "systemd-journald@snap-foo.service"},
+		{"stop", "systemd-journald@snap-foo.service"},
+		{"show", "--property=ActiveState", "systemd-journald@snap-foo.service"},
+	})
+
+	// removing again is fine
+	s.sysdLog = nil
+	err = wrappers.RemoveJournalNamespace("snap-foo", nil)
+	c.Assert(err, IsNil)
+	c.Check(s.sysdLog, HasLen, 0)
+}
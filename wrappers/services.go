@@ -21,6 +21,7 @@ package wrappers
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"math/rand"
 	"os"
@@ -34,10 +35,13 @@ import (
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/osutil/sys"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/quota"
+	"github.com/snapcore/snapd/strutil"
 	"github.com/snapcore/snapd/systemd"
 	"github.com/snapcore/snapd/timeout"
 	"github.com/snapcore/snapd/timeutil"
 	"github.com/snapcore/snapd/timings"
+	userclient "github.com/snapcore/snapd/usersession/client"
 )
 
 type interacter interface {
@@ -55,15 +59,63 @@ func serviceStopTimeout(app *snap.AppInfo) time.Duration {
 	return time.Duration(tout)
 }
 
-func generateSnapServiceFile(app *snap.AppInfo) ([]byte, error) {
+func generateSnapServiceFile(app *snap.AppInfo, opts *AddSnapServicesOptions) ([]byte, error) {
 	if err := snap.ValidateApp(app); err != nil {
 		return nil, err
 	}
 
-	return genServiceFile(app), nil
+	return genServiceFile(app, opts), nil
+}
+
+func userSessionContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), userclient.ServicesTimeout)
+}
+
+// serviceSystemd returns the systemd instance controlling the units of
+// the app, for user daemons the configuration shared by all the users.
+func serviceSystemd(app *snap.AppInfo, inter interacter) systemd.Systemd {
+	if app.DaemonScope == snap.UserDaemon {
+		return systemd.New(dirs.GlobalRootDir, systemd.GlobalUserMode, inter)
+	}
+	return systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
+}
+
+// startUnit starts the unit of the app, the units of user daemons are
+// started in all the user sessions through their session agents.
+func startUnit(sysd systemd.Systemd, app *snap.AppInfo, unit string) error {
+	if app.DaemonScope == snap.UserDaemon {
+		ctx, cancel := userSessionContext()
+		defer cancel()
+		return userclient.New().ServicesStart(ctx, []string{unit})
+	}
+	return sysd.Start(unit)
+}
+
+// userDaemonReload reloads the systemd instances of all the users.
+func userDaemonReload() error {
+	ctx, cancel := userSessionContext()
+	defer cancel()
+	return userclient.New().ServicesDaemonReload(ctx)
+}
+
+// stopUserService stops the user service and its timer in all the
+// user sessions.
+func stopUserService(app *snap.AppInfo) error {
+	var units []string
+	if app.Timer != nil {
+		units = append(units, filepath.Base(app.Timer.File()))
+	}
+	units = append(units, app.ServiceName())
+
+	ctx, cancel := userSessionContext()
+	defer cancel()
+	return userclient.New().ServicesStop(ctx, units)
 }
 
 func stopService(sysd systemd.Systemd, app *snap.AppInfo, inter interacter) error {
+	if app.DaemonScope == snap.UserDaemon {
+		return stopUserService(app)
+	}
 	serviceName := app.ServiceName()
 	tout := serviceStopTimeout(app)
 
@@ -101,16 +153,19 @@ func stopService(sysd systemd.Systemd, app *snap.AppInfo, inter interacter) erro
 
 // StartServices starts service units for the applications from the snap which
 // are services. Service units will be started in the order provided by the
-// caller.
-func StartServices(apps []*snap.AppInfo, inter interacter, tm timings.Measurer) (err error) {
-	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
-
-	services := make([]string, 0, len(apps))
+// caller. The services of the apps listed in disabledSvcs, and their sockets
+// and timers, are neither enabled nor started.
+func StartServices(apps []*snap.AppInfo, disabledSvcs []string, inter interacter, tm timings.Measurer) (err error) {
+	services := make([]*snap.AppInfo, 0, len(apps))
 	for _, app := range apps {
 		// they're *supposed* to be all services, but checking doesn't hurt
 		if !app.IsService() {
 			continue
 		}
+		if strutil.ListContains(disabledSvcs, app.Name) {
+			continue
+		}
+		sysd := serviceSystemd(app, inter)
 
 		defer func(app *snap.AppInfo) {
 			if err == nil {
@@ -133,7 +188,7 @@ func StartServices(apps []*snap.AppInfo, inter interacter, tm timings.Measurer)
 			}
 		}(app)
 
-		if len(app.Sockets) == 0 && app.Timer == nil {
+		if len(app.Sockets) == 0 && app.Timer == nil && len(app.ActivatesOn) == 0 {
 			// check if the service is disabled, if so don't start it up
 			// this could happen for example if the service was disabled in
 			// the install hook by snapctl or if the service was disabled in
@@ -144,7 +199,7 @@ func StartServices(apps []*snap.AppInfo, inter interacter, tm timings.Measurer)
 			}
 
 			if isEnabled {
-				services = append(services, app.ServiceName())
+				services = append(services, app)
 			}
 		}
 
@@ -156,7 +211,7 @@ func StartServices(apps []*snap.AppInfo, inter interacter, tm timings.Measurer)
 			}
 
 			timings.Run(tm, "start-socket-service", fmt.Sprintf("start socket service %q", socketService), func(nested timings.Measurer) {
-				err = sysd.Start(socketService)
+				err = startUnit(sysd, app, socketService)
 			})
 			if err != nil {
 				return err
@@ -171,7 +226,7 @@ func StartServices(apps []*snap.AppInfo, inter interacter, tm timings.Measurer)
 			}
 
 			timings.Run(tm, "start-timer-service", fmt.Sprintf("start timer service %q", timerService), func(nested timings.Measurer) {
-				err = sysd.Start(timerService)
+				err = startUnit(sysd, app, timerService)
 			})
 			if err != nil {
 				return err
@@ -179,7 +234,8 @@ func StartServices(apps []*snap.AppInfo, inter interacter, tm timings.Measurer)
 		}
 	}
 
-	for _, srv := range services {
+	for _, app := range services {
+		srv := app.ServiceName()
 		// starting all services at once does not create a single
 		// transaction, but instead spawns multiple jobs, make sure the
 		// services started in the original order by bring them up one
@@ -187,7 +243,7 @@ func StartServices(apps []*snap.AppInfo, inter interacter, tm timings.Measurer)
 		// https://github.com/systemd/systemd/issues/8102
 		// https://lists.freedesktop.org/archives/systemd-devel/2018-January/040152.html
 		timings.Run(tm, "start-service", fmt.Sprintf("start service %q", srv), func(nested timings.Measurer) {
-			err = sysd.Start(srv)
+			err = startUnit(serviceSystemd(app, inter), app, srv)
 		})
 		if err != nil {
 			// cleanup was set up by iterating over apps
@@ -198,22 +254,37 @@ func StartServices(apps []*snap.AppInfo, inter interacter, tm timings.Measurer)
 	return nil
 }
 
+// AddSnapServicesOptions is a struct for controlling the generated service
+// definitions for a snap.
+type AddSnapServicesOptions struct {
+	// QuotaGroup is the quota group the snap belongs to, if any. The
+	// services are then placed in the slice of the quota group.
+	QuotaGroup *quota.Group
+	// JournalNamespace is the journal namespace the output of the
+	// services goes to, the default one if empty.
+	JournalNamespace string
+	// DisabledServices are the names of the apps whose services are
+	// not enabled.
+	DisabledServices []string
+}
+
 // AddSnapServices adds service units for the applications from the snap which are services.
-func AddSnapServices(s *snap.Info, inter interacter) (err error) {
+func AddSnapServices(s *snap.Info, opts *AddSnapServicesOptions, inter interacter) (err error) {
 	if s.GetType() == snap.TypeSnapd {
 		return writeSnapdServicesOnCore(s, inter)
 	}
 
 	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
 	var written []string
-	var enabled []string
+	var enabled []*snap.AppInfo
+	var writtenSystem, writtenUser bool
 	defer func() {
 		if err == nil {
 			return
 		}
-		for _, s := range enabled {
-			if e := sysd.Disable(s); e != nil {
-				inter.Notify(fmt.Sprintf("while trying to disable %s due to previous failure: %v", s, e))
+		for _, app := range enabled {
+			if e := serviceSystemd(app, inter).Disable(app.ServiceName()); e != nil {
+				inter.Notify(fmt.Sprintf("while trying to disable %s due to previous failure: %v", app.ServiceName(), e))
 			}
 		}
 		for _, s := range written {
@@ -221,11 +292,16 @@ func AddSnapServices(s *snap.Info, inter interacter) (err error) {
 				inter.Notify(fmt.Sprintf("while trying to remove %s due to previous failure: %v", s, e))
 			}
 		}
-		if len(written) > 0 {
+		if writtenSystem {
 			if e := sysd.DaemonReload(); e != nil {
 				inter.Notify(fmt.Sprintf("while trying to perform systemd daemon-reload due to previous failure: %v", e))
 			}
 		}
+		if writtenUser {
+			if e := userDaemonReload(); e != nil {
+				inter.Notify(fmt.Sprintf("while trying to perform user systemd daemon-reload due to previous failure: %v", e))
+			}
+		}
 	}()
 
 	for _, app := range s.Apps {
@@ -233,7 +309,7 @@ func AddSnapServices(s *snap.Info, inter interacter) (err error) {
 			continue
 		}
 		// Generate service file
-		content, err := generateSnapServiceFile(app)
+		content, err := generateSnapServiceFile(app, opts)
 		if err != nil {
 			return err
 		}
@@ -243,6 +319,11 @@ func AddSnapServices(s *snap.Info, inter interacter) (err error) {
 			return err
 		}
 		written = append(written, svcFilePath)
+		if app.DaemonScope == snap.UserDaemon {
+			writtenUser = true
+		} else {
+			writtenSystem = true
+		}
 
 		// Generate systemd .socket files if needed
 		socketFiles, err := generateSnapSocketFiles(app)
@@ -270,28 +351,136 @@ func AddSnapServices(s *snap.Info, inter interacter) (err error) {
 			written = append(written, path)
 		}
 
-		if app.Timer != nil || len(app.Sockets) != 0 {
-			// service is socket or timer activated, not during the
-			// boot
+		if app.Timer != nil || len(app.Sockets) != 0 || len(app.ActivatesOn) != 0 {
+			// service is socket, timer or D-Bus activated, not during
+			// the boot
+			continue
+		}
+
+		if opts != nil && strutil.ListContains(opts.DisabledServices, app.Name) {
 			continue
 		}
 
-		svcName := app.ServiceName()
-		if err := sysd.Enable(svcName); err != nil {
+		if err := serviceSystemd(app, inter).Enable(app.ServiceName()); err != nil {
 			return err
 		}
-		enabled = append(enabled, svcName)
+		enabled = append(enabled, app)
 	}
 
-	if len(written) > 0 {
+	if writtenSystem {
 		if err := sysd.DaemonReload(); err != nil {
 			return err
 		}
 	}
+	if writtenUser {
+		if err := userDaemonReload(); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
+// EnsureSnapServices rewrites the service units of the snap that are
+// out of date with respect to the given options, without changing
+// whether they are enabled. It returns whether any unit was rewritten,
+// in which case the running services need to be restarted for the
+// changes to take effect.
+func EnsureSnapServices(s *snap.Info, opts *AddSnapServicesOptions, inter interacter) (changed bool, err error) {
+	var changedSystem, changedUser bool
+	for _, app := range s.Apps {
+		if !app.IsService() {
+			continue
+		}
+		content, err := generateSnapServiceFile(app, opts)
+		if err != nil {
+			return changed, err
+		}
+		svcFilePath := app.ServiceFile()
+		os.MkdirAll(filepath.Dir(svcFilePath), 0755)
+		err = osutil.EnsureFileState(svcFilePath, &osutil.FileState{Content: content, Mode: 0644})
+		if err == osutil.ErrSameState {
+			continue
+		}
+		if err != nil {
+			return changed, err
+		}
+		changed = true
+		if app.DaemonScope == snap.UserDaemon {
+			changedUser = true
+		} else {
+			changedSystem = true
+		}
+	}
+
+	if changedSystem {
+		sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
+		if err := sysd.DaemonReload(); err != nil {
+			return changed, err
+		}
+	}
+	if changedUser {
+		if err := userDaemonReload(); err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// RestartServices restarts the given services that are running, so
+// that changes to their units take effect.
+func RestartServices(svcs []*snap.AppInfo, inter interacter, tm timings.Measurer) error {
+	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
+
+	var apps []*snap.AppInfo
+	var names []string
+	var userNames []string
+	for _, app := range svcs {
+		if !app.IsService() {
+			continue
+		}
+		if app.DaemonScope == snap.UserDaemon {
+			userNames = append(userNames, app.ServiceName())
+			continue
+		}
+		apps = append(apps, app)
+		names = append(names, app.ServiceName())
+	}
+	if len(userNames) > 0 {
+		// the session agents only restart the running services
+		var err error
+		timings.Run(tm, "restart-user-services", fmt.Sprintf("restart user services %q", userNames), func(nested timings.Measurer) {
+			ctx, cancel := userSessionContext()
+			defer cancel()
+			err = userclient.New().ServicesRestart(ctx, userNames)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sts, err := sysd.Status(names...)
+	if err != nil {
+		return err
+	}
+
+	for i, app := range apps {
+		if !sts[i].Active {
+			continue
+		}
+		svcName := names[i]
+		timings.Run(tm, "restart-service", fmt.Sprintf("restart service %q", svcName), func(nested timings.Measurer) {
+			err = sysd.Restart(svcName, serviceStopTimeout(app))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // StopServices stops service units for the applications from the snap which are services.
 func StopServices(apps []*snap.AppInfo, reason snap.ServiceStopReason, inter interacter, tm timings.Measurer) error {
 	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
@@ -324,7 +513,7 @@ func StopServices(apps []*snap.AppInfo, reason snap.ServiceStopReason, inter int
 
 		// ensure the service is really stopped on remove regardless
 		// of stop-mode
-		if reason == snap.StopReasonRemove && !app.StopMode.KillAll() {
+		if reason == snap.StopReasonRemove && !app.StopMode.KillAll() && app.DaemonScope != snap.UserDaemon {
 			// FIXME: make this smarter and avoid the killWait
 			//        delay if not needed (i.e. if all processes
 			//        have died)
@@ -338,10 +527,10 @@ func StopServices(apps []*snap.AppInfo, reason snap.ServiceStopReason, inter int
 }
 
 // ServicesEnableState returns a map of service names from the given snap,
-// together with their enable/disable status.
+// together with their enable/disable status. Socket and timer activated
+// services are enabled when any of their sockets or their timer is, D-Bus
+// activated services are always enabled.
 func ServicesEnableState(s *snap.Info, inter interacter) (map[string]bool, error) {
-	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
-
 	// loop over all services in the snap, querying systemd for the current
 	// systemd state of the snaps
 	snapSvcsState := make(map[string]bool, len(s.Apps))
@@ -349,25 +538,51 @@ func ServicesEnableState(s *snap.Info, inter interacter) (map[string]bool, error
 		if !app.IsService() {
 			continue
 		}
-		state, err := sysd.IsEnabled(app.ServiceName())
-		if err != nil {
-			return nil, err
+		if len(app.ActivatesOn) != 0 && len(app.Sockets) == 0 && app.Timer == nil {
+			// activated by the bus, regardless of the state of the unit
+			snapSvcsState[name] = true
+			continue
+		}
+		units := []string{app.ServiceName()}
+		if len(app.Sockets) != 0 || app.Timer != nil {
+			units = units[:0]
+			for _, socket := range app.Sockets {
+				units = append(units, filepath.Base(socket.File()))
+			}
+			if app.Timer != nil {
+				units = append(units, filepath.Base(app.Timer.File()))
+			}
+		}
+		sysd := serviceSystemd(app, inter)
+		snapSvcsState[name] = false
+		for _, unit := range units {
+			state, err := sysd.IsEnabled(unit)
+			if err != nil {
+				return nil, err
+			}
+			if state {
+				snapSvcsState[name] = true
+				break
+			}
 		}
-		snapSvcsState[name] = state
 	}
 	return snapSvcsState, nil
 }
 
 // RemoveSnapServices disables and removes service units for the applications from the snap which are services.
 func RemoveSnapServices(s *snap.Info, inter interacter) error {
-	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
-	nservices := 0
+	var removedSystem, removedUser bool
 
 	for _, app := range s.Apps {
 		if !app.IsService() || !osutil.FileExists(app.ServiceFile()) {
 			continue
 		}
-		nservices++
+		if app.DaemonScope == snap.UserDaemon {
+			removedUser = true
+		} else {
+			removedSystem = true
+		}
+		sysd := serviceSystemd(app, inter)
 
 		serviceName := filepath.Base(app.ServiceFile())
 
@@ -407,11 +622,17 @@ func RemoveSnapServices(s *snap.Info, inter interacter) error {
 	}
 
 	// only reload if we actually had services
-	if nservices > 0 {
+	if removedSystem {
+		sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
 		if err := sysd.DaemonReload(); err != nil {
 			return err
 		}
 	}
+	if removedUser {
+		if err := userDaemonReload(); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -427,13 +648,23 @@ func genServiceNames(snap *snap.Info, appNames []string) []string {
 	return names
 }
 
-func genServiceFile(appInfo *snap.AppInfo) []byte {
+func genServiceFile(appInfo *snap.AppInfo, opts *AddSnapServicesOptions) []byte {
+	if opts == nil {
+		opts = &AddSnapServicesOptions{}
+	}
+
 	serviceTemplate := `[Unit]
 # Auto-generated, DO NOT EDIT
 Description=Service for snap application {{.App.Snap.InstanceName}}.{{.App.Name}}
+{{- if .MountUnit}}
 Requires={{.MountUnit}}
+{{- end}}
+{{- if .PrerequisiteTarget}}
 Wants={{.PrerequisiteTarget}}
-After={{.MountUnit}} {{.PrerequisiteTarget}}{{if .After}} {{ stringsJoin .After " " }}{{end}}
+{{- end}}
+{{- if .After}}
+After={{ stringsJoin .After " " }}
+{{- end}}
 {{- if .Before}}
 Before={{ stringsJoin .Before " "}}
 {{- end}}
@@ -478,6 +709,12 @@ KillMode={{.KillMode}}
 {{- if .KillSignal}}
 KillSignal={{.KillSignal}}
 {{- end}}
+{{- if .SliceUnit}}
+Slice={{.SliceUnit}}
+{{- end}}
+{{- if .LogNamespace}}
+LogNamespace={{.LogNamespace}}
+{{- end}}
 {{- if not .App.Sockets}}
 
 [Install]
@@ -523,6 +760,8 @@ WantedBy={{.ServicesTarget}}
 		Remain             string
 		KillMode           string
 		KillSignal         string
+		SliceUnit          string
+		LogNamespace       string
 		Before             []string
 		After              []string
 
@@ -531,23 +770,36 @@ WantedBy={{.ServicesTarget}}
 	}{
 		App: appInfo,
 
-		Restart:            restartCond,
-		StopTimeout:        serviceStopTimeout(appInfo),
-		StartTimeout:       time.Duration(appInfo.StartTimeout),
-		ServicesTarget:     systemd.ServicesTarget,
-		PrerequisiteTarget: systemd.PrerequisiteTarget,
-		MountUnit:          filepath.Base(systemd.MountUnitPath(appInfo.Snap.MountDir())),
-		Remain:             remain,
-		KillMode:           killMode,
-		KillSignal:         appInfo.StopMode.KillSignal(),
+		Restart:      restartCond,
+		StopTimeout:  serviceStopTimeout(appInfo),
+		StartTimeout: time.Duration(appInfo.StartTimeout),
+		Remain:       remain,
+		KillMode:     killMode,
+		KillSignal:   appInfo.StopMode.KillSignal(),
+		LogNamespace: opts.JournalNamespace,
 
 		Before: genServiceNames(appInfo.Snap, appInfo.Before),
-		After:  genServiceNames(appInfo.Snap, appInfo.After),
 
 		// systemd runs as PID 1 so %h will not work.
 		Home: "/root",
 	}
 
+	if appInfo.DaemonScope == snap.UserDaemon {
+		// the user instances of systemd cannot depend on the
+		// units of the system instance, and have no slices for
+		// the quota groups
+		wrapperData.ServicesTarget = systemd.UserServicesTarget
+	} else {
+		wrapperData.ServicesTarget = systemd.ServicesTarget
+		wrapperData.PrerequisiteTarget = systemd.PrerequisiteTarget
+		wrapperData.MountUnit = filepath.Base(systemd.MountUnitPath(appInfo.Snap.MountDir()))
+		wrapperData.After = []string{wrapperData.MountUnit, wrapperData.PrerequisiteTarget}
+		if opts.QuotaGroup != nil {
+			wrapperData.SliceUnit = opts.QuotaGroup.SliceFileName()
+		}
+	}
+	wrapperData.After = append(wrapperData.After, genServiceNames(appInfo.Snap, appInfo.After)...)
+
 	if err := t.Execute(&templateOut, wrapperData); err != nil {
 		// this can never happen, except we forget a variable
 		logger.Panicf("Unable to execute template: %v", err)
@@ -633,8 +885,10 @@ func generateSnapTimerFile(app *snap.AppInfo) ([]byte, error) {
 	timerTemplate := `[Unit]
 # Auto-generated, DO NOT EDIT
 Description=Timer {{.TimerName}} for snap application {{.App.Snap.InstanceName}}.{{.App.Name}}
+{{- if .MountUnit}}
 Requires={{.MountUnit}}
 After={{.MountUnit}}
+{{- end}}
 X-Snappy=yes
 
 [Timer]
@@ -666,9 +920,11 @@ WantedBy={{.TimersTarget}}
 		ServiceFileName: filepath.Base(app.ServiceFile()),
 		TimersTarget:    systemd.TimersTarget,
 		TimerName:       app.Name,
-		MountUnit:       filepath.Base(systemd.MountUnitPath(app.Snap.MountDir())),
 		Schedules:       schedules,
 	}
+	if app.DaemonScope != snap.UserDaemon {
+		wrapperData.MountUnit = filepath.Base(systemd.MountUnitPath(app.Snap.MountDir()))
+	}
 
 	if err := t.Execute(&templateOut, wrapperData); err != nil {
 		// this can never happen, except we forget a variable
@@ -31,6 +31,7 @@ import (
 
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/quota"
 	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/testutil"
 	"github.com/snapcore/snapd/timeout"
@@ -127,11 +128,106 @@ apps:
 	info.Revision = snap.R(44)
 	app := info.Apps["app"]
 
-	generatedWrapper, err := wrappers.GenerateSnapServiceFile(app)
+	generatedWrapper, err := wrappers.GenerateSnapServiceFile(app, nil)
 	c.Assert(err, IsNil)
 	c.Check(string(generatedWrapper), Equals, expectedAppService)
 }
 
+func (s *servicesWrapperGenSuite) TestGenerateSnapUserServiceFile(c *C) {
+	yamlText := `
+name: snap
+version: 1.0
+apps:
+    app:
+        command: bin/start
+        stop-command: bin/stop
+        reload-command: bin/reload
+        post-stop-command: bin/stop --post
+        stop-timeout: 10s
+        daemon: simple
+        daemon-scope: user
+`
+	info, err := snap.InfoFromSnapYaml([]byte(yamlText))
+	c.Assert(err, IsNil)
+	info.Revision = snap.R(44)
+	app := info.Apps["app"]
+
+	generatedWrapper, err := wrappers.GenerateSnapServiceFile(app, nil)
+	c.Assert(err, IsNil)
+	c.Check(string(generatedWrapper), Equals, `[Unit]
+# Auto-generated, DO NOT EDIT
+Description=Service for snap application snap.app
+X-Snappy=yes
+
+[Service]
+ExecStart=/usr/bin/snap run snap.app
+SyslogIdentifier=snap.app
+Restart=on-failure
+WorkingDirectory=/var/snap/snap/44
+ExecStop=/usr/bin/snap run --command=stop snap.app
+ExecReload=/usr/bin/snap run --command=reload snap.app
+ExecStopPost=/usr/bin/snap run --command=post-stop snap.app
+TimeoutStopSec=10
+Type=simple
+
+[Install]
+WantedBy=default.target
+`)
+}
+
+func (s *servicesWrapperGenSuite) TestGenerateSnapServiceFileWithQuotaGroup(c *C) {
+	yamlText := `
+name: snap
+version: 1.0
+apps:
+    app:
+        command: bin/start
+        daemon: simple
+`
+	info, err := snap.InfoFromSnapYaml([]byte(yamlText))
+	c.Assert(err, IsNil)
+	info.Revision = snap.R(44)
+	app := info.Apps["app"]
+
+	opts := &wrappers.AddSnapServicesOptions{
+		QuotaGroup: &quota.Group{Name: "foo-group", MemoryLimit: 1024 * 1024},
+	}
+	generatedWrapper, err := wrappers.GenerateSnapServiceFile(app, opts)
+	c.Assert(err, IsNil)
+	c.Check(string(generatedWrapper), testutil.Contains, "\nType=simple\nSlice=snap.foo\\x2dgroup.slice\n\n[Install]\n")
+
+	generatedWrapper, err = wrappers.GenerateSnapServiceFile(app, &wrappers.AddSnapServicesOptions{})
+	c.Assert(err, IsNil)
+	c.Check(string(generatedWrapper), Not(testutil.Contains), "Slice=")
+}
+
+func (s *servicesWrapperGenSuite) TestGenerateSnapServiceFileWithJournalNamespace(c *C) {
+	yamlText := `
+name: snap
+version: 1.0
+apps:
+    app:
+        command: bin/start
+        daemon: simple
+`
+	info, err := snap.InfoFromSnapYaml([]byte(yamlText))
+	c.Assert(err, IsNil)
+	info.Revision = snap.R(44)
+	app := info.Apps["app"]
+
+	opts := &wrappers.AddSnapServicesOptions{
+		QuotaGroup:       &quota.Group{Name: "foo", MemoryLimit: 1024 * 1024},
+		JournalNamespace: "snap-snap",
+	}
+	generatedWrapper, err := wrappers.GenerateSnapServiceFile(app, opts)
+	c.Assert(err, IsNil)
+	c.Check(string(generatedWrapper), testutil.Contains, "\nType=simple\nSlice=snap.foo.slice\nLogNamespace=snap-snap\n\n[Install]\n")
+
+	generatedWrapper, err = wrappers.GenerateSnapServiceFile(app, nil)
+	c.Assert(err, IsNil)
+	c.Check(string(generatedWrapper), Not(testutil.Contains), "LogNamespace=")
+}
+
 func (s *servicesWrapperGenSuite) TestGenerateSnapServiceFileWithStartTimeout(c *C) {
 	yamlText := `
 name: snap
@@ -147,7 +243,7 @@ apps:
 	info.Revision = snap.R(44)
 	app := info.Apps["app"]
 
-	generatedWrapper, err := wrappers.GenerateSnapServiceFile(app)
+	generatedWrapper, err := wrappers.GenerateSnapServiceFile(app, nil)
 	c.Assert(err, IsNil)
 	c.Check(string(generatedWrapper), testutil.Contains, "\nTimeoutStartSec=600\n")
 }
@@ -168,7 +264,7 @@ apps:
 		info.Revision = snap.R(44)
 		app := info.Apps["app"]
 
-		generatedWrapper, err := wrappers.GenerateSnapServiceFile(app)
+		generatedWrapper, err := wrappers.GenerateSnapServiceFile(app, nil)
 		c.Assert(err, IsNil)
 		wrapperText := string(generatedWrapper)
 		if cond == snap.RestartNever {
@@ -197,7 +293,7 @@ func (s *servicesWrapperGenSuite) TestGenerateSnapServiceFileTypeForking(c *C) {
 		Daemon:          "forking",
 	}
 
-	generatedWrapper, err := wrappers.GenerateSnapServiceFile(service)
+	generatedWrapper, err := wrappers.GenerateSnapServiceFile(service, nil)
 	c.Assert(err, IsNil)
 	c.Assert(string(generatedWrapper), Equals, expectedTypeForkingWrapper)
 }
@@ -218,7 +314,7 @@ func (s *servicesWrapperGenSuite) TestGenerateSnapServiceFileIllegalChars(c *C)
 		Daemon:          "simple",
 	}
 
-	_, err := wrappers.GenerateSnapServiceFile(service)
+	_, err := wrappers.GenerateSnapServiceFile(service, nil)
 	c.Assert(err, NotNil)
 }
 
@@ -243,7 +339,7 @@ apps:
 	info.Revision = snap.R(44)
 	app := info.Apps["app"]
 
-	generatedWrapper, err := wrappers.GenerateSnapServiceFile(app)
+	generatedWrapper, err := wrappers.GenerateSnapServiceFile(app, nil)
 	c.Assert(err, IsNil)
 
 	c.Assert(string(generatedWrapper), Equals, expectedDbusService)
@@ -266,7 +362,7 @@ apps:
 
 	app := info.Apps["app"]
 
-	generatedWrapper, err := wrappers.GenerateSnapServiceFile(app)
+	generatedWrapper, err := wrappers.GenerateSnapServiceFile(app, nil)
 	c.Assert(err, IsNil)
 
 	c.Assert(string(generatedWrapper), Equals, expectedOneshotService)
@@ -336,7 +432,7 @@ WantedBy=sockets.target
 	sock1Expected := fmt.Sprintf(sock1ExpectedFmt, mountUnitPrefix, mountUnitPrefix, si.DataDir())
 	sock2Expected := fmt.Sprintf(sock2ExpectedFmt, mountUnitPrefix, mountUnitPrefix, si.DataDir())
 
-	generatedWrapper, err := wrappers.GenerateSnapServiceFile(service)
+	generatedWrapper, err := wrappers.GenerateSnapServiceFile(service, nil)
 	c.Assert(err, IsNil)
 	c.Assert(strings.Contains(string(generatedWrapper), "[Install]"), Equals, false)
 	c.Assert(strings.Contains(string(generatedWrapper), "WantedBy=multi-user.target"), Equals, false)
@@ -427,7 +523,7 @@ WantedBy=multi-user.target
 		c.Logf("tc: %v", tc)
 		service.After = tc.after
 		service.Before = tc.before
-		generatedWrapper, err := wrappers.GenerateSnapServiceFile(service)
+		generatedWrapper, err := wrappers.GenerateSnapServiceFile(service, nil)
 		c.Assert(err, IsNil)
 
 		expectedService := fmt.Sprintf(expectedServiceFmt, mountUnitPrefix, mountUnitPrefix,
@@ -536,7 +632,7 @@ WantedBy=multi-user.target
 		},
 	}
 
-	generatedWrapper, err := wrappers.GenerateSnapServiceFile(service)
+	generatedWrapper, err := wrappers.GenerateSnapServiceFile(service, nil)
 	c.Assert(err, IsNil)
 
 	c.Logf("service: \n%v\n", string(generatedWrapper))
@@ -657,7 +753,7 @@ func (s *servicesWrapperGenSuite) TestKillModeSig(c *C) {
 			StopMode: snap.StopModeType(rm),
 		}
 
-		generatedWrapper, err := wrappers.GenerateSnapServiceFile(service)
+		generatedWrapper, err := wrappers.GenerateSnapServiceFile(service, nil)
 		c.Assert(err, IsNil)
 
 		c.Check(string(generatedWrapper), Equals, fmt.Sprintf(`[Unit]
@@ -697,7 +793,7 @@ func (s *servicesWrapperGenSuite) TestRestartDelay(c *C) {
 		RestartDelay: timeout.Timeout(20 * time.Second),
 	}
 
-	generatedWrapper, err := wrappers.GenerateSnapServiceFile(service)
+	generatedWrapper, err := wrappers.GenerateSnapServiceFile(service, nil)
 	c.Assert(err, IsNil)
 
 	c.Check(string(generatedWrapper), Equals, fmt.Sprintf(`[Unit]
@@ -22,6 +22,9 @@ package wrappers_test
 import (
 	"fmt"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
@@ -34,6 +37,7 @@ import (
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/quota"
 	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/strutil"
 	"github.com/snapcore/snapd/systemd"
@@ -78,7 +82,7 @@ func (s *servicesTestSuite) TestAddSnapServicesAndRemove(c *C) {
 	info := snaptest.MockSnap(c, packageHello, &snap.SideInfo{Revision: snap.R(12)})
 	svcFile := filepath.Join(s.tempdir, "/etc/systemd/system/snap.hello-snap.svc1.service")
 
-	err := wrappers.AddSnapServices(info, nil)
+	err := wrappers.AddSnapServices(info, nil, nil)
 	c.Assert(err, IsNil)
 	c.Check(s.sysdLog, DeepEquals, [][]string{
 		{"--root", dirs.GlobalRootDir, "enable", filepath.Base(svcFile)},
@@ -113,6 +117,175 @@ func (s *servicesTestSuite) TestAddSnapServicesAndRemove(c *C) {
 	c.Check(s.sysdLog[1], DeepEquals, []string{"daemon-reload"})
 }
 
+func (s *servicesTestSuite) TestEnsureSnapServices(c *C) {
+	info := snaptest.MockSnap(c, packageHello, &snap.SideInfo{Revision: snap.R(12)})
+	svcFile := filepath.Join(s.tempdir, "/etc/systemd/system/snap.hello-snap.svc1.service")
+
+	opts := &wrappers.AddSnapServicesOptions{
+		QuotaGroup: &quota.Group{Name: "foo", ThreadLimit: 10},
+	}
+	changed, err := wrappers.EnsureSnapServices(info, opts, nil)
+	c.Assert(err, IsNil)
+	c.Check(changed, Equals, true)
+	c.Check(svcFile, testutil.FileContains, "\nSlice=snap.foo.slice\n")
+	// services are not enabled
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"daemon-reload"},
+	})
+
+	s.sysdLog = nil
+	changed, err = wrappers.EnsureSnapServices(info, opts, nil)
+	c.Assert(err, IsNil)
+	c.Check(changed, Equals, false)
+	c.Check(s.sysdLog, HasLen, 0)
+
+	changed, err = wrappers.EnsureSnapServices(info, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(changed, Equals, true)
+	c.Check(svcFile, Not(testutil.FileContains), "Slice=")
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"daemon-reload"},
+	})
+}
+
+func (s *servicesTestSuite) TestRestartServices(c *C) {
+	info := snaptest.MockSnap(c, packageHello+`
+ svc2:
+  command: bin/hello
+  daemon: forking
+`, &snap.SideInfo{Revision: snap.R(12)})
+
+	r := systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {
+		s.sysdLog = append(s.sysdLog, cmd)
+		if len(cmd) == 4 && cmd[1] == "--property=Id,ActiveState,UnitFileState,Type" {
+			return []byte(`Id=snap.hello-snap.svc1.service
+Type=simple
+ActiveState=active
+UnitFileState=enabled
+
+Id=snap.hello-snap.svc2.service
+Type=forking
+ActiveState=inactive
+UnitFileState=enabled
+`), nil
+		}
+		return []byte("ActiveState=inactive\n"), nil
+	})
+	defer r()
+
+	svcs := []*snap.AppInfo{info.Apps["svc1"], info.Apps["svc2"]}
+	err := wrappers.RestartServices(svcs, nil, s.perfTimings)
+	c.Assert(err, IsNil)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"show", "--property=Id,ActiveState,UnitFileState,Type", "snap.hello-snap.svc1.service", "snap.hello-snap.svc2.service"},
+		{"stop", "snap.hello-snap.svc1.service"},
+		{"show", "--property=ActiveState", "snap.hello-snap.svc1.service"},
+		{"start", "snap.hello-snap.svc1.service"},
+	})
+}
+
+// mockUserSessionAgent runs a fake session agent for the given user
+// recording the service requests it receives.
+func (s *servicesTestSuite) mockUserSessionAgent(c *C, uid int) (requests *[]string, restore func()) {
+	requests = &[]string{}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		c.Check(err, IsNil)
+		*requests = append(*requests, fmt.Sprintf("%s %s", r.URL.Path, strings.TrimSpace(string(body))))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write([]byte(`{"type": "sync", "result": null}`))
+	})}
+	sock := filepath.Join(dirs.XdgRuntimeDirBase, fmt.Sprint(uid), "snapd-session-agent.socket")
+	c.Assert(os.MkdirAll(filepath.Dir(sock), 0755), IsNil)
+	l, err := net.Listen("unix", sock)
+	c.Assert(err, IsNil)
+	go server.Serve(l)
+	return requests, func() { server.Close() }
+}
+
+func (s *servicesTestSuite) TestAddStartStopRemoveUserServices(c *C) {
+	info := snaptest.MockSnap(c, `name: hello-snap
+version: 1.10
+apps:
+ svc1:
+  command: bin/hello
+  daemon: simple
+  daemon-scope: user
+`, &snap.SideInfo{Revision: snap.R(12)})
+	svcFile := filepath.Join(s.tempdir, "/etc/systemd/user/snap.hello-snap.svc1.service")
+
+	requests, restore := s.mockUserSessionAgent(c, 42)
+	defer restore()
+
+	err := wrappers.AddSnapServices(info, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(svcFile, testutil.FileContains, "\nWantedBy=default.target\n")
+	// the system instance of systemd is not reloaded
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "--global", "--root", dirs.GlobalRootDir, "enable", "snap.hello-snap.svc1.service"},
+	})
+	c.Check(*requests, DeepEquals, []string{
+		`/v1/service-control {"action":"daemon-reload"}`,
+	})
+
+	s.sysdLog = nil
+	*requests = nil
+	err = wrappers.StartServices(info.Services(), nil, nil, s.perfTimings)
+	c.Assert(err, IsNil)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "--global", "--root", dirs.GlobalRootDir, "is-enabled", "snap.hello-snap.svc1.service"},
+	})
+	c.Check(*requests, DeepEquals, []string{
+		`/v1/service-control {"action":"start","services":["snap.hello-snap.svc1.service"]}`,
+	})
+
+	s.sysdLog = nil
+	*requests = nil
+	err = wrappers.RestartServices(info.Services(), nil, s.perfTimings)
+	c.Assert(err, IsNil)
+	c.Check(s.sysdLog, HasLen, 0)
+	c.Check(*requests, DeepEquals, []string{
+		`/v1/service-control {"action":"restart","services":["snap.hello-snap.svc1.service"]}`,
+	})
+
+	s.sysdLog = nil
+	*requests = nil
+	err = wrappers.StopServices(info.Services(), snap.StopReasonRemove, progress.Null, s.perfTimings)
+	c.Assert(err, IsNil)
+	c.Check(s.sysdLog, HasLen, 0)
+	c.Check(*requests, DeepEquals, []string{
+		`/v1/service-control {"action":"stop","services":["snap.hello-snap.svc1.service"]}`,
+	})
+
+	s.sysdLog = nil
+	*requests = nil
+	err = wrappers.RemoveSnapServices(info, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(osutil.FileExists(svcFile), Equals, false)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "--global", "--root", dirs.GlobalRootDir, "disable", "snap.hello-snap.svc1.service"},
+	})
+	c.Check(*requests, DeepEquals, []string{
+		`/v1/service-control {"action":"daemon-reload"}`,
+	})
+}
+
+func (s *servicesTestSuite) TestStartUserServicesWithoutSessions(c *C) {
+	info := snaptest.MockSnap(c, `name: hello-snap
+version: 1.10
+apps:
+ svc1:
+  command: bin/hello
+  daemon: simple
+  daemon-scope: user
+`, &snap.SideInfo{Revision: snap.R(12)})
+
+	// no session agent is running, there is nothing to start
+	err := wrappers.StartServices(info.Services(), nil, nil, s.perfTimings)
+	c.Assert(err, IsNil)
+}
+
 var snapdYaml = `name: snapd
 version: 1.0
 type: snapd
@@ -131,7 +304,7 @@ func (s *servicesTestSuite) TestRemoveSnapWithSocketsRemovesSocketsService(c *C)
       listen-stream: $SNAP_COMMON/sock2.socket
 `, &snap.SideInfo{Revision: snap.R(12)})
 
-	err := wrappers.AddSnapServices(info, nil)
+	err := wrappers.AddSnapServices(info, nil, nil)
 	c.Assert(err, IsNil)
 
 	err = wrappers.StopServices(info.Services(), "", &progress.Null, s.perfTimings)
@@ -171,7 +344,7 @@ apps:
    daemon: forking
 `, &snap.SideInfo{Revision: snap.R(11)})
 
-	err := wrappers.AddSnapServices(info, nil)
+	err := wrappers.AddSnapServices(info, nil, nil)
 	c.Assert(err, IsNil)
 
 	sysdLog = nil
@@ -253,6 +426,43 @@ func (s *servicesTestSuite) TestServicesEnableState(c *C) {
 	}
 }
 
+func (s *servicesTestSuite) TestServicesEnableStateActivated(c *C) {
+	info := snaptest.MockSnap(c, packageHello+`
+ svc2:
+  command: bin/hello
+  daemon: simple
+  timer: 10:00-12:00
+`, &snap.SideInfo{Revision: snap.R(12)})
+
+	s.systemctlRestorer()
+	r := testutil.MockCommand(c, "systemctl", `#!/bin/sh
+	if [ "$1" = "--root" ]; then
+	    shift 2
+	fi
+	case "$2" in
+	"snap.hello-snap.svc1.service")
+		echo "enabled"
+		exit 0
+		;;
+	"snap.hello-snap.svc2.timer")
+		echo "disabled"
+		exit 1
+		;;
+	esac
+	echo "unexpected $*"
+	exit 2
+	`)
+	defer r.Restore()
+
+	// the state of timer activated services is the one of their timer
+	states, err := wrappers.ServicesEnableState(info, progress.Null)
+	c.Assert(err, IsNil)
+	c.Assert(states, DeepEquals, map[string]bool{
+		"svc1": true,
+		"svc2": false,
+	})
+}
+
 func (s *servicesTestSuite) TestServicesEnableStateFail(c *C) {
 	info := snaptest.MockSnap(c, packageHello, &snap.SideInfo{Revision: snap.R(12)})
 	svc1File := "snap.hello-snap.svc1.service"
@@ -316,7 +526,7 @@ func (s *servicesTestSuite) TestStopServicesWithSockets(c *C) {
       listen-stream: $SNAP_DATA/sock2.socket
 `, &snap.SideInfo{Revision: snap.R(12)})
 
-	err := wrappers.AddSnapServices(info, nil)
+	err := wrappers.AddSnapServices(info, nil, nil)
 	c.Assert(err, IsNil)
 
 	sysdLog = nil
@@ -333,7 +543,7 @@ func (s *servicesTestSuite) TestStartServices(c *C) {
 	info := snaptest.MockSnap(c, packageHello, &snap.SideInfo{Revision: snap.R(12)})
 	svcFile := filepath.Join(s.tempdir, "/etc/systemd/system/snap.hello-snap.svc1.service")
 
-	err := wrappers.StartServices(info.Services(), nil, s.perfTimings)
+	err := wrappers.StartServices(info.Services(), nil, nil, s.perfTimings)
 	c.Assert(err, IsNil)
 
 	c.Assert(s.sysdLog, DeepEquals, [][]string{
@@ -342,6 +552,91 @@ func (s *servicesTestSuite) TestStartServices(c *C) {
 	})
 }
 
+func (s *servicesTestSuite) TestAddSnapServicesDisabled(c *C) {
+	info := snaptest.MockSnap(c, packageHello+`
+ svc2:
+  command: bin/hello
+  daemon: simple
+`, &snap.SideInfo{Revision: snap.R(12)})
+
+	opts := &wrappers.AddSnapServicesOptions{DisabledServices: []string{"svc1"}}
+	err := wrappers.AddSnapServices(info, opts, nil)
+	c.Assert(err, IsNil)
+	// the service units are all written, but svc1 is not enabled
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.hello-snap.svc1.service"), testutil.FilePresent)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--root", dirs.GlobalRootDir, "enable", "snap.hello-snap.svc2.service"},
+		{"daemon-reload"},
+	})
+}
+
+func (s *servicesTestSuite) TestStartServicesDisabled(c *C) {
+	info := snaptest.MockSnap(c, packageHello+`
+ svc2:
+  command: bin/hello
+  daemon: simple
+  timer: 10:00-12:00
+ svc3:
+  command: bin/hello
+  daemon: simple
+  timer: 10:00-12:00
+`, &snap.SideInfo{Revision: snap.R(12)})
+
+	apps := []*snap.AppInfo{info.Apps["svc1"], info.Apps["svc2"], info.Apps["svc3"]}
+	err := wrappers.StartServices(apps, []string{"svc1", "svc3"}, nil, s.perfTimings)
+	c.Assert(err, IsNil)
+	// the disabled services and their timers are neither enabled nor
+	// started
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--root", dirs.GlobalRootDir, "enable", "snap.hello-snap.svc2.timer"},
+		{"start", "snap.hello-snap.svc2.timer"},
+	})
+}
+
+const snapYamlDBusActivated = `name: dbus-snap
+version: 1.0
+slots:
+  dbus-slot:
+    interface: dbus
+    bus: system
+    name: org.example.Foo
+apps:
+  svc:
+    command: bin/svc
+    daemon: simple
+    activates-on: [dbus-slot]
+`
+
+func (s *servicesTestSuite) TestAddSnapServicesDBusActivated(c *C) {
+	info := snaptest.MockSnap(c, snapYamlDBusActivated, &snap.SideInfo{Revision: snap.R(12)})
+
+	err := wrappers.AddSnapServices(info, nil, nil)
+	c.Assert(err, IsNil)
+	// the service is started by D-Bus activation, it is not enabled
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.dbus-snap.svc.service"), testutil.FilePresent)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"daemon-reload"},
+	})
+}
+
+func (s *servicesTestSuite) TestStartServicesDBusActivated(c *C) {
+	info := snaptest.MockSnap(c, snapYamlDBusActivated, &snap.SideInfo{Revision: snap.R(12)})
+
+	err := wrappers.StartServices(info.Services(), nil, nil, s.perfTimings)
+	c.Assert(err, IsNil)
+	// neither enabled nor started
+	c.Check(s.sysdLog, HasLen, 0)
+}
+
+func (s *servicesTestSuite) TestServicesEnableStateDBusActivated(c *C) {
+	info := snaptest.MockSnap(c, snapYamlDBusActivated, &snap.SideInfo{Revision: snap.R(12)})
+
+	states, err := wrappers.ServicesEnableState(info, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(states, DeepEquals, map[string]bool{"svc": true})
+	c.Check(s.sysdLog, HasLen, 0)
+}
+
 func (s *servicesTestSuite) TestNoStartDisabledServices(c *C) {
 	info := snaptest.MockSnap(c, packageHello, &snap.SideInfo{Revision: snap.R(12)})
 	svcFile := filepath.Join(s.tempdir, "/etc/systemd/system/snap.hello-snap.svc1.service")
@@ -369,7 +664,7 @@ func (s *servicesTestSuite) TestNoStartDisabledServices(c *C) {
 	`)
 	defer r.Restore()
 
-	err := wrappers.StartServices(info.Services(), nil, s.perfTimings)
+	err := wrappers.StartServices(info.Services(), nil, nil, s.perfTimings)
 	c.Assert(err, IsNil)
 
 	c.Assert(r.Calls(), DeepEquals, [][]string{
@@ -387,7 +682,7 @@ func (s *servicesTestSuite) TestAddSnapMultiServicesFailCreateCleanup(c *C) {
   daemon: potato
 `, &snap.SideInfo{Revision: snap.R(12)})
 
-	err := wrappers.AddSnapServices(info, nil)
+	err := wrappers.AddSnapServices(info, nil, nil)
 	c.Assert(err, ErrorMatches, ".*potato.*")
 
 	// the services are cleaned up
@@ -452,7 +747,7 @@ func (s *servicesTestSuite) TestAddSnapMultiServicesFailEnableCleanup(c *C) {
   daemon: simple
 `, &snap.SideInfo{Revision: snap.R(12)})
 
-	err := wrappers.AddSnapServices(info, nil)
+	err := wrappers.AddSnapServices(info, nil, nil)
 	c.Assert(err, ErrorMatches, "failed")
 
 	// the services are cleaned up
@@ -500,7 +795,7 @@ func (s *servicesTestSuite) TestAddSnapMultiServicesStartFailOnSystemdReloadClea
   daemon: simple
 `, &snap.SideInfo{Revision: snap.R(12)})
 
-	err := wrappers.AddSnapServices(info, progress.Null)
+	err := wrappers.AddSnapServices(info, nil, progress.Null)
 	c.Assert(err, ErrorMatches, "failed")
 
 	// the services are cleaned up
@@ -536,7 +831,7 @@ func (s *servicesTestSuite) TestAddSnapSocketFiles(c *C) {
 	sock2File := filepath.Join(s.tempdir, "/etc/systemd/system/snap.hello-snap.svc1.sock2.socket")
 	sock3File := filepath.Join(s.tempdir, "/etc/systemd/system/snap.hello-snap.svc1.sock3.socket")
 
-	err := wrappers.AddSnapServices(info, nil)
+	err := wrappers.AddSnapServices(info, nil, nil)
 	c.Assert(err, IsNil)
 
 	expected := fmt.Sprintf(
@@ -596,7 +891,7 @@ func (s *servicesTestSuite) TestStartSnapMultiServicesFailStartCleanup(c *C) {
 	if svcs[0].Name == "svc2" {
 		svcs[0], svcs[1] = svcs[1], svcs[0]
 	}
-	err := wrappers.StartServices(svcs, nil, s.perfTimings)
+	err := wrappers.StartServices(svcs, nil, nil, s.perfTimings)
 	c.Assert(err, ErrorMatches, "failed")
 	c.Assert(sysdLog, HasLen, 8, Commentf("len: %v calls: %v", len(sysdLog), sysdLog))
 	c.Check(sysdLog, DeepEquals, [][]string{
@@ -650,7 +945,7 @@ func (s *servicesTestSuite) TestStartSnapMultiServicesFailStartCleanupWithSocket
 	// ensure desired order
 	apps := []*snap.AppInfo{info.Apps["svc1"], info.Apps["svc2"], info.Apps["svc3"]}
 
-	err := wrappers.StartServices(apps, nil, s.perfTimings)
+	err := wrappers.StartServices(apps, nil, nil, s.perfTimings)
 	c.Assert(err, ErrorMatches, "failed")
 	c.Logf("sysdlog: %v", sysdLog)
 	c.Assert(sysdLog, HasLen, 17, Commentf("len: %v calls: %v", len(sysdLog), sysdLog))
@@ -706,7 +1001,7 @@ apps:
 	sorted, err := snap.SortServices(svcs)
 	c.Assert(err, IsNil)
 
-	err = wrappers.StartServices(sorted, nil, s.perfTimings)
+	err = wrappers.StartServices(sorted, nil, nil, s.perfTimings)
 	c.Assert(err, IsNil)
 	c.Assert(sysdLog, HasLen, 6, Commentf("len: %v calls: %v", len(sysdLog), sysdLog))
 	c.Check(sysdLog, DeepEquals, [][]string{
@@ -722,7 +1017,7 @@ apps:
 	sorted[1], sorted[0] = sorted[0], sorted[1]
 
 	// we should observe the calls done in the same order as services
-	err = wrappers.StartServices(sorted, nil, s.perfTimings)
+	err = wrappers.StartServices(sorted, nil, nil, s.perfTimings)
 	c.Assert(err, IsNil)
 	c.Assert(sysdLog, HasLen, 12, Commentf("len: %v calls: %v", len(sysdLog), sysdLog))
 	c.Check(sysdLog[6:], DeepEquals, [][]string{
@@ -779,7 +1074,7 @@ func (s *servicesTestSuite) TestServiceAfterBefore(c *C) {
 		},
 	}}
 
-	err := wrappers.AddSnapServices(info, nil)
+	err := wrappers.AddSnapServices(info, nil, nil)
 	c.Assert(err, IsNil)
 
 	for _, check := range checks {
@@ -819,7 +1114,7 @@ func (s *servicesTestSuite) TestServiceWatchdog(c *C) {
 `
 	info := snaptest.MockSnap(c, snapYaml, &snap.SideInfo{Revision: snap.R(12)})
 
-	err := wrappers.AddSnapServices(info, nil)
+	err := wrappers.AddSnapServices(info, nil, nil)
 	c.Assert(err, IsNil)
 
 	content, err := ioutil.ReadFile(filepath.Join(s.tempdir, "/etc/systemd/system/snap.hello-snap.svc2.service"))
@@ -849,7 +1144,7 @@ apps:
 	info := snaptest.MockSnap(c, surviveYaml, &snap.SideInfo{Revision: snap.R(1)})
 	survivorFile := filepath.Join(s.tempdir, "/etc/systemd/system/snap.survive-snap.survivor.service")
 
-	err := wrappers.AddSnapServices(info, nil)
+	err := wrappers.AddSnapServices(info, nil, nil)
 	c.Assert(err, IsNil)
 	c.Check(s.sysdLog, DeepEquals, [][]string{
 		{"--root", dirs.GlobalRootDir, "enable", filepath.Base(survivorFile)},
@@ -901,7 +1196,7 @@ apps:
 		info := snaptest.MockSnap(c, surviveYaml, &snap.SideInfo{Revision: snap.R(1)})
 
 		s.sysdLog = nil
-		err := wrappers.AddSnapServices(info, nil)
+		err := wrappers.AddSnapServices(info, nil, nil)
 		c.Assert(err, IsNil)
 		c.Check(s.sysdLog, DeepEquals, [][]string{
 			{"--root", dirs.GlobalRootDir, "enable", filepath.Base(survivorFile)},
@@ -953,7 +1248,7 @@ func (s *servicesTestSuite) TestStartSnapTimerEnableStart(c *C) {
 
 	// fix the apps order to make the test stable
 	apps := []*snap.AppInfo{info.Apps["svc1"], info.Apps["svc2"]}
-	err := wrappers.StartServices(apps, nil, s.perfTimings)
+	err := wrappers.StartServices(apps, nil, nil, s.perfTimings)
 	c.Assert(err, IsNil)
 	c.Assert(s.sysdLog, HasLen, 4, Commentf("len: %v calls: %v", len(s.sysdLog), s.sysdLog))
 	c.Check(s.sysdLog, DeepEquals, [][]string{
@@ -988,7 +1283,7 @@ func (s *servicesTestSuite) TestStartSnapTimerCleanup(c *C) {
 
 	// fix the apps order to make the test stable
 	apps := []*snap.AppInfo{info.Apps["svc1"], info.Apps["svc2"]}
-	err := wrappers.StartServices(apps, nil, s.perfTimings)
+	err := wrappers.StartServices(apps, nil, nil, s.perfTimings)
 	c.Assert(err, ErrorMatches, "failed")
 	c.Assert(sysdLog, HasLen, 10, Commentf("len: %v calls: %v", len(sysdLog), sysdLog))
 	c.Check(sysdLog, DeepEquals, [][]string{
@@ -1013,7 +1308,7 @@ func (s *servicesTestSuite) TestAddRemoveSnapWithTimersAddsRemovesTimerFiles(c *
   timer: 10:00-12:00
 `, &snap.SideInfo{Revision: snap.R(12)})
 
-	err := wrappers.AddSnapServices(info, nil)
+	err := wrappers.AddSnapServices(info, nil, nil)
 	c.Assert(err, IsNil)
 
 	app := info.Apps["svc2"]
@@ -1060,7 +1355,7 @@ func (s *servicesTestSuite) TestFailedAddSnapCleansUp(c *C) {
 	})
 	defer r()
 
-	err := wrappers.AddSnapServices(info, &progress.Null)
+	err := wrappers.AddSnapServices(info, nil, &progress.Null)
 	c.Assert(err, NotNil)
 
 	c.Logf("services dir: %v", dirs.SnapServicesDir)
@@ -1102,7 +1397,7 @@ apps:
 
 	for i, info := range []*snap.Info{onlyServices, onlySockets, onlyTimers} {
 		s.sysdLog = nil
-		err := wrappers.AddSnapServices(info, &progress.Null)
+		err := wrappers.AddSnapServices(info, nil, &progress.Null)
 		c.Assert(err, IsNil)
 		reloads := 0
 		c.Logf("calls: %v", s.sysdLog)
@@ -1143,7 +1438,7 @@ apps:
 	info := snaptest.MockSnap(c, snapYaml, &snap.SideInfo{Revision: snap.R(12)})
 
 	// fix the apps order to make the test stable
-	err := wrappers.AddSnapServices(info, nil)
+	err := wrappers.AddSnapServices(info, nil, nil)
 	c.Assert(err, IsNil)
 	c.Assert(s.sysdLog, HasLen, 2, Commentf("len: %v calls: %v", len(s.sysdLog), s.sysdLog))
 	c.Check(s.sysdLog, DeepEquals, [][]string{
@@ -1163,7 +1458,7 @@ func (s *servicesTestSuite) TestServiceRestartDelay(c *C) {
 `
 	info := snaptest.MockSnap(c, snapYaml, &snap.SideInfo{Revision: snap.R(12)})
 
-	err := wrappers.AddSnapServices(info, nil)
+	err := wrappers.AddSnapServices(info, nil, nil)
 	c.Assert(err, IsNil)
 
 	content, err := ioutil.ReadFile(filepath.Join(s.tempdir, "/etc/systemd/system/snap.hello-snap.svc2.service"))
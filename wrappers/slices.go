@@ -0,0 +1,103 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package wrappers
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap/quota"
+	"github.com/snapcore/snapd/systemd"
+)
+
+func sliceFilePath(grp *quota.Group) string {
+	return filepath.Join(dirs.SnapServicesDir, grp.SliceFileName())
+}
+
+func genSliceFile(grp *quota.Group) []byte {
+	buf := bytes.NewBuffer(nil)
+
+	fmt.Fprintf(buf, `[Unit]
+# Auto-generated, DO NOT EDIT
+Description=Slice for snap quota group %s
+Before=slices.target
+X-Snappy=yes
+
+[Slice]
+`, grp.Name)
+
+	if grp.MemoryLimit != 0 {
+		fmt.Fprintf(buf, "MemoryAccounting=true\n")
+		fmt.Fprintf(buf, "MemoryMax=%d\n", grp.MemoryLimit)
+		// for compatibility with older versions of systemd and
+		// cgroup v1
+		fmt.Fprintf(buf, "MemoryLimit=%d\n", grp.MemoryLimit)
+	}
+	if grp.CPULimit != 0 {
+		fmt.Fprintf(buf, "CPUAccounting=true\n")
+		fmt.Fprintf(buf, "CPUQuota=%d%%\n", grp.CPULimit)
+	}
+	if grp.ThreadLimit != 0 {
+		fmt.Fprintf(buf, "TasksAccounting=true\n")
+		fmt.Fprintf(buf, "TasksMax=%d\n", grp.ThreadLimit)
+	}
+
+	return buf.Bytes()
+}
+
+// EnsureQuotaGroupSlice writes the systemd slice unit of the given
+// quota group if it is missing or out of date.
+func EnsureQuotaGroupSlice(grp *quota.Group, inter interacter) error {
+	path := sliceFilePath(grp)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	err := osutil.EnsureFileState(path, &osutil.FileState{Content: genSliceFile(grp), Mode: 0644})
+	if err == osutil.ErrSameState {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// reloading also applies the new limits to the slice if it is
+	// already active
+	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
+	return sysd.DaemonReload()
+}
+
+// RemoveQuotaGroupSlice removes the systemd slice unit of the given
+// quota group.
+func RemoveQuotaGroupSlice(grp *quota.Group, inter interacter) error {
+	path := sliceFilePath(grp)
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
+	return sysd.DaemonReload()
+}
@@ -0,0 +1,98 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package wrappers_test
+
+import (
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/snap/quota"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/testutil"
+	"github.com/snapcore/snapd/wrappers"
+)
+
+type slicesTestSuite struct {
+	testutil.BaseTest
+
+	sysdLog [][]string
+}
+
+var _ = Suite(&slicesTestSuite{})
+
+func (s *slicesTestSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	s.sysdLog = nil
+	s.AddCleanup(systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {
+		s.sysdLog = append(s.sysdLog, cmd)
+		return nil, nil
+	}))
+}
+
+func (s *slicesTestSuite) TestEnsureAndRemoveQuotaGroupSlice(c *C) {
+	grp := &quota.Group{
+		Name:        "foo",
+		MemoryLimit: 512 * 1024 * 1024,
+		CPULimit:    150,
+		ThreadLimit: 64,
+	}
+	slicePath := filepath.Join(dirs.SnapServicesDir, "snap.foo.slice")
+
+	err := wrappers.EnsureQuotaGroupSlice(grp, nil)
+	c.Assert(err, IsNil)
+	c.Check(slicePath, testutil.FileEquals, `[Unit]
+# Auto-generated, DO NOT EDIT
+Description=Slice for snap quota group foo
+Before=slices.target
+X-Snappy=yes
+
+[Slice]
+MemoryAccounting=true
+MemoryMax=536870912
+MemoryLimit=536870912
+CPUAccounting=true
+CPUQuota=150%
+TasksAccounting=true
+TasksMax=64
+`)
+	c.Check(s.sysdLog, DeepEquals, [][]string{{"daemon-reload"}})
+
+	// nothing to do if unchanged
+	s.sysdLog = nil
+	err = wrappers.EnsureQuotaGroupSlice(grp, nil)
+	c.Assert(err, IsNil)
+	c.Check(s.sysdLog, HasLen, 0)
+
+	err = wrappers.RemoveQuotaGroupSlice(grp, nil)
+	c.Assert(err, IsNil)
+	c.Check(slicePath, testutil.FileAbsent)
+	c.Check(s.sysdLog, DeepEquals, [][]string{{"daemon-reload"}})
+
+	// removing again is fine
+	s.sysdLog = nil
+	err = wrappers.RemoveQuotaGroupSlice(grp, nil)
+	c.Assert(err, IsNil)
+	c.Check(s.sysdLog, HasLen, 0)
+}